@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+
+	"go-cron/config"
+	"go-cron/internal/utils"
+	"go-cron/models"
+	"go-cron/repo"
+)
+
+// Changes returns the audit log of a product (?productId=) or of a sync run (?runId=),
+// newest first for products and in applied order for runs (?limit=, default 100, max 1000).
+// ?format=csv returns it as a CSV download instead, sorted by title with the
+// DISPLAY_LOCALE collation and with every change of a run whatever the limit; links signed with utils.SignLink, as sent in
+// notification digests, are accepted in place of the Bearer secret.
+func Changes(w http.ResponseWriter, r *http.Request) {
+	config := config.LoadConfig()
+	if !utils.Authenticate(r, config.Auth) && !utils.SignedLinkValid(r, config.Auth.CRONSecret, utils.Now()) {
+		utils.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if !utils.ConfigValid(w, config) {
+		return
+	}
+	db, ok := utils.Database(w, config)
+	if !ok {
+		return
+	}
+
+	productID := utils.QueryInt(r, "productId", 0, 0, math.MaxInt32)
+	runID := utils.QueryInt(r, "runId", 0, 0, math.MaxInt32)
+	if (productID == 0) == (runID == 0) {
+		utils.WriteError(w, http.StatusBadRequest, "Exactly one of productId or runId is required")
+		return
+	}
+
+	limit := utils.QueryInt(r, "limit", 100, 1, 1000)
+	audit := repo.NewAuditRepository(db)
+	audit.SetTable(config.Database.Schema, config.Database.ProductsTable)
+	asCSV := r.URL.Query().Get("format") == "csv"
+	if asCSV && runID != 0 {
+		writeRunChangesCSV(w, r, audit, runID, config.Display)
+		return
+	}
+
+	var changes []models.ProductChange
+	var err error
+	if productID != 0 {
+		changes, err = audit.ListChangesByProduct(r.Context(), productID, limit)
+	} else {
+		changes, err = audit.ListChangesByRun(r.Context(), runID, limit)
+	}
+	if err != nil {
+		log.Printf("Failed to list changes: %v\n", err)
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to list changes")
+		return
+	}
+
+	if asCSV {
+		writeChangesCSV(w, changes, productID, runID, config.Display)
+		return
+	}
+
+	response := models.ChangesResponse{Changes: make([]models.ProductChange, 0, len(changes))}
+	for _, c := range changes {
+		response.Changes = append(response.Changes, c.In(config.Display.Location))
+	}
+	utils.WriteJSON(w, http.StatusOK, response)
+}
+
+// changesFileSuffix names the CSV download after the product or run it covers
+func changesFileSuffix(productID, runID int) string {
+	if productID != 0 {
+		return fmt.Sprintf("product-%d", productID)
+	}
+	return fmt.Sprintf("run-%d", runID)
+}
+
+// writeRunChangesCSV writes every change of a run as a CSV download, read a
+// page of the audit log at a time and sorted by title like the other CSVs
+func writeRunChangesCSV(w http.ResponseWriter, r *http.Request, audit *repo.AuditRepository, runID int, display models.DisplayConfig) {
+	var changes []models.ProductChange
+	err := audit.EachChangeOfRun(r.Context(), runID, func(page []models.ProductChange) error {
+		changes = append(changes, page...)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to list changes: %v\n", err)
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to list changes")
+		return
+	}
+	writeChangesCSV(w, changes, 0, runID, display)
+}
+
+// writeChangesCSV writes changes as a CSV download, sorted by title with the
+// collation of the display locale
+func writeChangesCSV(w http.ResponseWriter, changes []models.ProductChange, productID, runID int, display models.DisplayConfig) {
+	utils.SortChangesByTitle(changes, display.Locale)
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="changes-%s.csv"`, changesFileSuffix(productID, runID)))
+	if err := utils.WriteChangesCSV(w, changes, display.Location); err != nil {
+		log.Printf("Failed to write changes CSV: %v\n", err)
+	}
+}
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-cron/config"
+	"go-cron/internal/utils"
+	"go-cron/models"
+	"go-cron/repo"
+)
+
+// Export streams the synced catalog as ?format=csv, json or ndjson (default
+// json), in ID order, one page of ?limit= products at a time (default 1000,
+// max 10000). ?category= or ?group= (an item group code, see SYNC_CATEGORIES)
+// keep the products of a category, ?updatedSince= (RFC 3339) those the audit
+// log records a change of since then, and ?archived=true adds the archived
+// products. When more products follow, the Link header points at the next
+// page, which starts after the ID in ?after=.
+func Export(w http.ResponseWriter, r *http.Request) {
+	config := config.LoadConfig()
+	if !utils.Authenticate(r, config.Auth) {
+		utils.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if !utils.ConfigValid(w, config) {
+		return
+	}
+
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = models.ExportFormatJSON
+	}
+	if format != models.ExportFormatCSV && format != models.ExportFormatJSON && format != models.ExportFormatNDJSON {
+		utils.WriteError(w, http.StatusBadRequest, "format must be csv, json or ndjson")
+		return
+	}
+	filter := models.ExportFilter{
+		Category:        strings.TrimSpace(query.Get("category")),
+		IncludeArchived: query.Get("archived") == "true",
+	}
+	if group := query.Get("group"); group != "" {
+		code, err := strconv.Atoi(group)
+		if err != nil || config.Sync.Categories[code] == "" {
+			utils.WriteError(w, http.StatusBadRequest, "group must be an item group code with a category")
+			return
+		}
+		filter.Category = config.Sync.Categories[code]
+	}
+	if since := query.Get("updatedSince"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "updatedSince must be an RFC 3339 time")
+			return
+		}
+		filter.UpdatedSince = t
+	}
+	limit := utils.QueryInt(r, "limit", 1000, 1, 10000)
+	after := utils.QueryInt(r, "after", 0, 0, math.MaxInt32)
+
+	db, ok := utils.Database(w, config)
+	if !ok {
+		return
+	}
+	products := repo.NewProductRepositoryFromConfig(db, config.Database)
+
+	// The headers go out before the first product, so the next page is looked up first
+	next, err := products.NextExportCursor(r.Context(), filter, after, limit)
+	if err != nil {
+		log.Printf("Failed to export products: %v\n", err)
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to export products")
+		return
+	}
+	if next != 0 {
+		nextQuery := r.URL.Query()
+		nextQuery.Set("after", strconv.Itoa(next))
+		w.Header().Set("Link", `<`+r.URL.Path+"?"+nextQuery.Encode()+`>; rel="next"`)
+	}
+	w.Header().Set("Content-Type", utils.ExportContentType(format))
+	if format == models.ExportFormatCSV {
+		w.Header().Set("Content-Disposition", `attachment; filename="products.csv"`)
+	}
+
+	pw := utils.NewProductWriter(w, format)
+	if err := products.ExportProducts(r.Context(), filter, after, limit, pw.Write); err != nil {
+		// The status is already sent; a truncated body is all the client can get
+		log.Printf("Export interrupted: %v\n", err)
+		return
+	}
+	if err := pw.Close(); err != nil {
+		log.Printf("Failed to finish the export: %v\n", err)
+	}
+}
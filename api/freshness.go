@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+
+	"go-cron/config"
+	"go-cron/internal/utils"
+	"go-cron/models"
+	"go-cron/repo"
+)
+
+// Freshness reports how old the synced data is, based on the last successful run
+func Freshness(w http.ResponseWriter, r *http.Request) {
+	config := config.LoadConfig()
+	if !utils.Authenticate(r, config.Auth) {
+		utils.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if !utils.ConfigValid(w, config) {
+		return
+	}
+	db, ok := utils.Database(w, config)
+	if !ok {
+		return
+	}
+
+	run, err := repo.NewRunRepository(db).GetLastSuccessfulRun(r.Context())
+	if err != nil {
+		log.Printf("Failed to fetch last successful run: %v\n", err)
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to fetch last successful run")
+		return
+	}
+
+	response := models.FreshnessResponse{
+		MaxAgeSeconds: config.Sync.FreshnessMaxAge.Seconds(),
+		Stale:         true, // Never synced successfully
+	}
+	if run != nil {
+		lastSuccessAt := run.FinishedAt.In(config.Display.Location)
+		age := utils.Now().Sub(run.FinishedAt)
+		response.LastSuccessAt = &lastSuccessAt
+		response.AgeSeconds = age.Seconds()
+		response.Stale = age > config.Sync.FreshnessMaxAge
+	}
+	utils.WriteJSON(w, http.StatusOK, response)
+}
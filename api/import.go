@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"go-cron/config"
+	"go-cron/engine"
+	"go-cron/internal/utils"
+	"go-cron/models"
+	"go-cron/repo"
+	"go-cron/sinks"
+	"go-cron/sources"
+)
+
+// maxImportSize bounds the uploaded file of /api/import
+const maxImportSize = 10 << 20
+
+// Import syncs the items of an uploaded file through the same pipeline as the
+// external API: sanitizing, validation, handle generation and diffing. The
+// file is the body of a POST, or the "file" field of a multipart form, in CSV
+// (see sources.ReadCSVItems) or JSON (see sources.ReadJSONItems), told apart
+// by ?format=, the content type or the file name. Products missing from the
+// file are left alone. ?dryRun=true only reports the changes. It requires the
+// admin secret.
+func Import(w http.ResponseWriter, r *http.Request) {
+	defer utils.RecoverPanic(w)
+	config := config.LoadConfig()
+	if !utils.Authorized(r, config.Auth.EffectiveAdminSecret()) {
+		utils.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if !utils.ConfigValid(w, config) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		utils.WriteError(w, http.StatusMethodNotAllowed, "Use POST to import items")
+		return
+	}
+
+	items, invalid, err := readImport(w, r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid import: "+err.Error())
+		return
+	}
+	if len(items) == 0 {
+		utils.WriteError(w, http.StatusUnprocessableEntity, "The file holds no valid item")
+		return
+	}
+	dryRun := r.URL.Query().Get("dryRun") == "true"
+
+	db, ok := utils.Database(w, config)
+	if !ok {
+		return
+	}
+	if config, ok = utils.ProfileConfig(w, r, config, db); !ok {
+		return
+	}
+	done, err := utils.BeginSync()
+	if err != nil {
+		utils.WriteError(w, http.StatusServiceUnavailable, "Service is shutting down")
+		return
+	}
+	defer done()
+
+	ctx := r.Context()
+	eng := engine.New(config, db)
+	eng.SetClock(utils.Now)
+	if config.Database.Driver == models.DatabaseDriverPgx {
+		pool, err := utils.PgxPool(config)
+		if err != nil {
+			log.Printf("Database unavailable: %v\n", err)
+			utils.WriteError(w, http.StatusServiceUnavailable, "Database unavailable")
+			return
+		}
+		eng.UsePgx(pool)
+	}
+	outboxRepo := repo.NewOutboxRepository(db)
+	fanOut := sinks.NewFanOut(outboxRepo, sinks.FromConfig(config, repo.NewSinkMappingRepository(db))...)
+	eng.SetOutbox(outboxRepo, fanOut.Names())
+
+	// Dry runs leave no trace in the run history
+	runRepo := repo.NewRunRepository(db)
+	run := &models.SyncRun{Entity: models.EntityProducts, Trigger: models.RunTriggerImport, StartedAt: utils.Now().UTC()}
+	if !dryRun {
+		if _, err := runRepo.StartRun(ctx, run); err != nil {
+			log.Printf("Failed to start sync run, its changes will not be audited: %v\n", err)
+		}
+	}
+
+	result, err := eng.Import(ctx, items, invalid, engine.Options{DryRun: dryRun, RunID: run.ID})
+	run.Result, run.FinishedAt = result, utils.Now().UTC()
+	if err != nil {
+		run.Status, run.Error = models.SyncStatusFailed, err.Error()
+	} else {
+		run.Status = result.Status
+		if !dryRun {
+			result.Pushed = sinks.Pushed(fanOut.Dispatch(ctx), result.Changes)
+		}
+	}
+	if run.ID != 0 {
+		if err := runRepo.FinishRun(context.Background(), run); err != nil {
+			log.Printf("Failed to record sync run: %v\n", err)
+		}
+	}
+	if err != nil {
+		log.Printf("Import failed: %v\n", err)
+		utils.WriteError(w, http.StatusInternalServerError, "Import failed: "+err.Error())
+		return
+	}
+
+	log.Printf("Imported %d items: %d created, %d updated\n", len(items), result.Created, result.Updated)
+	utils.WriteJSON(w, http.StatusOK, models.ImportResponse{RunID: run.ID, Items: len(items), DryRun: dryRun, Result: result})
+}
+
+// readImport decodes the items of the uploaded file
+func readImport(w http.ResponseWriter, r *http.Request) ([]models.ExternalItem, []models.ItemValidationError, error) {
+	body := http.MaxBytesReader(w, r.Body, maxImportSize)
+	format := r.URL.Query().Get("format")
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	var file io.Reader = body
+	if contentType == "multipart/form-data" {
+		r.Body = body
+		f, header, err := r.FormFile("file")
+		if err != nil {
+			return nil, nil, errors.New(`expected the file in the "file" field`)
+		}
+		defer f.Close()
+		file = f
+		if format == "" {
+			format = importFormat(header.Header.Get("Content-Type"), header.Filename)
+		}
+	} else if format == "" {
+		format = importFormat(contentType, "")
+	}
+
+	switch format {
+	case "csv":
+		return sources.ReadCSVItems(file)
+	case "json":
+		return sources.ReadJSONItems(file)
+	}
+	return nil, nil, errors.New("send CSV or JSON, or set ?format=csv or ?format=json")
+}
+
+// importFormat tells CSV from JSON by a content type, then a file name
+func importFormat(contentType, filename string) string {
+	switch {
+	case strings.Contains(contentType, "csv"):
+		return "csv"
+	case strings.Contains(contentType, "json"):
+		return "json"
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return "csv"
+	case ".json":
+		return "json"
+	}
+	return ""
+}
@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"go-cron/internal/testserver"
+	"go-cron/models"
+)
+
+// testSecret is the cron secret of the handler tests
+const testSecret = "test-secret"
+
+// setupHandler points the configuration of the handlers at a fake Service
+// Layer serving items and returns it
+func setupHandler(t *testing.T, items ...models.ExternalItem) *testserver.Server {
+	t.Helper()
+	server := testserver.New(items...)
+	t.Cleanup(server.Close)
+	server.Setenv(t)
+	t.Setenv("GO_CRON_CONFIG", "")
+	t.Setenv("CRON_SECRET", testSecret)
+	t.Setenv("DATABASE_URL", "postgres://gocron@127.0.0.1:1/gocron?sslmode=disable&connect_timeout=1")
+	return server
+}
+
+// requireDatabase points the handlers at the database of
+// GOCRON_TEST_DATABASE_URL, which must hold the go-cron schema, or skips the test
+func requireDatabase(t *testing.T) {
+	t.Helper()
+	uri := os.Getenv("GOCRON_TEST_DATABASE_URL")
+	if uri == "" {
+		t.Skip("GOCRON_TEST_DATABASE_URL is not set")
+	}
+	t.Setenv("DATABASE_URL", uri)
+}
+
+// trigger sends a sync request to Handler
+func trigger(body, accept string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/api", strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer "+testSecret)
+	if accept != "" {
+		r.Header.Set("Accept", accept)
+	}
+	w := httptest.NewRecorder()
+	Handler(w, r)
+	return w
+}
+
+// Test_Handler_Unauthorized tests that a trigger without the secret never reaches the external API
+func Test_Handler_Unauthorized(t *testing.T) {
+	server := setupHandler(t)
+
+	w := httptest.NewRecorder()
+	Handler(w, httptest.NewRequest(http.MethodPost, "/api", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401, got %d", w.Code)
+	}
+	if got := server.Requests(testserver.EndpointLogin); got != 0 {
+		t.Errorf("Expected no login, got %d", got)
+	}
+}
+
+// Test_Handler_Misconfigured tests that invalid settings are only answered,
+// without naming them, to an authenticated caller
+func Test_Handler_Misconfigured(t *testing.T) {
+	setupHandler(t)
+	t.Setenv("DATABASE_URL", "")
+
+	w := trigger("", "")
+	if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "DATABASE_URL") {
+		t.Errorf("Expected a generic 500, got %d: %s", w.Code, w.Body)
+	}
+	w = httptest.NewRecorder()
+	Handler(w, httptest.NewRequest(http.MethodPost, "/api", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 before the configuration is checked, got %d", w.Code)
+	}
+}
+
+// Test_Handler_NotAcceptable tests that a trigger accepting none of the response formats is refused
+func Test_Handler_NotAcceptable(t *testing.T) {
+	server := setupHandler(t)
+
+	w := trigger("", "text/html")
+	if w.Code != http.StatusNotAcceptable {
+		t.Errorf("Expected status 406, got %d", w.Code)
+	}
+	if got := server.Requests(testserver.EndpointLogin); got != 0 {
+		t.Errorf("Expected no login, got %d", got)
+	}
+}
+
+// Test_Handler_DryRun tests a dry run end to end, from the fake Service Layer to the response
+func Test_Handler_DryRun(t *testing.T) {
+	// Titles no earlier run created, so every item is planned as a create
+	suffix := time.Now().UnixNano()
+	items := make([]models.ExternalItem, 5)
+	for i := range items {
+		items[i] = models.ExternalItem{ItemCode: fmt.Sprintf("T%d-%d", suffix, i), ItemName: fmt.Sprintf("Handler test %d %d", suffix, i), ItemsGroupCode: 100}
+	}
+	server := setupHandler(t, items...)
+	server.MaxPageSize = 2
+	t.Setenv("PAGE_SIZE", "2")
+	requireDatabase(t)
+
+	w := trigger(`{"dryRun":true}`, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body)
+	}
+	var response models.TriggerResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.ItemsFetched != 5 || response.SyncResult == nil || !response.SyncResult.DryRun || response.SyncResult.Created != 5 {
+		t.Errorf("Expected 5 planned creates of 5 fetched items, got %+v", response)
+	}
+	if got := server.Requests(testserver.EndpointItems); got != 3 {
+		t.Errorf("Expected 3 pages, got %d", got)
+	}
+	if server.OpenSessions() != 0 {
+		t.Error("Expected the session to be logged out")
+	}
+}
+
+// Test_Handler_FetchFailure tests that an expired session fails the trigger
+// with the fetch error, classified as rejected by the external API
+func Test_Handler_FetchFailure(t *testing.T) {
+	server := setupHandler(t, models.ExternalItem{ItemCode: "A1", ItemName: "A", ItemsGroupCode: 100})
+	server.Fail(testserver.EndpointCount, testserver.SessionExpired)
+	requireDatabase(t)
+
+	w := trigger(`{"dryRun":true}`, "")
+	var response models.ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if w.Code != http.StatusBadGateway || !strings.Contains(response.Error, "Fetch failed") ||
+		response.Code != models.ErrorCodeUpstreamError || response.Status != models.OutcomeFailed {
+		t.Errorf("Expected a 502 upstream fetch failure, got %d: %s", w.Code, w.Body)
+	}
+	if server.OpenSessions() != 0 {
+		t.Error("Expected the session to be logged out")
+	}
+}
@@ -0,0 +1,14 @@
+package handler
+
+import (
+	"net/http"
+
+	"go-cron/internal/utils"
+)
+
+// Live answers liveness probes: the process is up and serving. It checks no
+// dependency, so a database outage never gets the instance restarted; probe
+// Ready for that.
+func Live(w http.ResponseWriter, r *http.Request) {
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
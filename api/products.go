@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strings"
+
+	"go-cron/config"
+	"go-cron/internal/utils"
+	"go-cron/models"
+	"go-cron/repo"
+)
+
+// Products returns a page of synced products (?limit=, default 100, max 1000; ?offset=),
+// optionally narrowed to titles containing ?title= and to the exact ?handle=
+func Products(w http.ResponseWriter, r *http.Request) {
+	config := config.LoadConfig()
+	if !utils.Authenticate(r, config.Auth) {
+		utils.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if !utils.ConfigValid(w, config) {
+		return
+	}
+	db, ok := utils.Database(w, config)
+	if !ok {
+		return
+	}
+
+	limit := utils.QueryInt(r, "limit", 100, 1, 1000)
+	offset := utils.QueryInt(r, "offset", 0, 0, math.MaxInt32)
+	filter := models.ProductFilter{
+		Title:  strings.TrimSpace(r.URL.Query().Get("title")),
+		Handle: strings.TrimSpace(r.URL.Query().Get("handle")),
+	}
+
+	productRepo := repo.NewProductRepositoryFromConfig(db, config.Database)
+	products, err := productRepo.FindProducts(r.Context(), filter, offset, limit)
+	if err != nil {
+		log.Printf("Failed to list products: %v\n", err)
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to list products")
+		return
+	}
+	total, err := productRepo.CountMatchingProducts(r.Context(), filter)
+	if err != nil {
+		log.Printf("Failed to count products: %v\n", err)
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to list products")
+		return
+	}
+
+	if products == nil {
+		products = []models.Product{}
+	}
+	utils.WriteJSON(w, http.StatusOK, models.ProductsResponse{Products: products, Total: total, Limit: limit, Offset: offset})
+}
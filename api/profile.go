@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"go-cron/config"
+	"go-cron/internal/utils"
+	"go-cron/models"
+	"go-cron/repo"
+)
+
+// Profile exports and imports the sync profile of the environment and
+// requires the admin secret. GET returns the effective sync settings as a
+// versioned profile; POST validates a profile and makes it the active one,
+// keeping every import for auditing. Environment variables still override an
+// imported profile.
+func Profile(w http.ResponseWriter, r *http.Request) {
+	cfg := config.LoadConfig()
+	if !utils.Authorized(r, cfg.Auth.EffectiveAdminSecret()) {
+		utils.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if !utils.ConfigValid(w, cfg) {
+		return
+	}
+	db, ok := utils.Database(w, cfg)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if cfg, ok = utils.ProfileConfig(w, r, cfg, db); !ok {
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, config.ExportProfile(cfg, utils.Now()))
+
+	case http.MethodPost:
+		var profile models.SyncProfile
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&profile); err != nil {
+			utils.WriteError(w, http.StatusBadRequest, "Invalid profile: "+err.Error())
+			return
+		}
+		var invalid *models.ValidationError
+		if err := config.CheckProfile(&profile); errors.As(err, &invalid) {
+			utils.WriteError(w, http.StatusUnprocessableEntity, "Invalid profile: "+err.Error())
+			return
+		}
+
+		stored, err := repo.NewProfileRepository(db).SaveProfile(r.Context(), profile, utils.Now())
+		if err != nil {
+			log.Printf("Failed to import sync profile: %v\n", err)
+			utils.WriteError(w, http.StatusInternalServerError, "Failed to import sync profile")
+			return
+		}
+		log.Printf("Imported sync profile %d (version %d, %d settings)\n", stored.ID, profile.Version, len(profile.Settings))
+		utils.WriteJSON(w, http.StatusCreated, stored)
+
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		utils.WriteError(w, http.StatusMethodNotAllowed, "Use GET to export or POST to import a profile")
+	}
+}
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"go-cron/config"
+	"go-cron/internal/utils"
+	"go-cron/models"
+)
+
+// readyPingTimeout bounds the database check of a readiness probe
+const readyPingTimeout = 2 * time.Second
+
+// Ready answers readiness probes: it reports 200 when the configuration is
+// valid, the database answers and the instance is not shutting down, and 503
+// naming the failed checks otherwise. It needs no secret, like load balancer
+// probes, so the invalid settings are logged rather than answered.
+func Ready(w http.ResponseWriter, r *http.Request) {
+	response := models.ReadinessResponse{Ready: true}
+	check := func(name string, err error) {
+		c := models.ReadinessCheck{Name: name, Status: models.CheckOK}
+		if err != nil {
+			c.Status, c.Error = models.CheckFailed, err.Error()
+			response.Ready = false
+		}
+		response.Checks = append(response.Checks, c)
+	}
+
+	config := config.LoadConfig()
+	configErr := config.Validate()
+	if configErr != nil {
+		log.Printf("Not ready: %v\n", configErr)
+		check("config", errors.New("invalid configuration"))
+	} else {
+		check("config", nil)
+	}
+	// An invalid configuration may name no database at all
+	if configErr == nil {
+		check("database", utils.PingDB(r.Context(), config, readyPingTimeout))
+	}
+	var shutdownErr error
+	if utils.ShuttingDown() {
+		shutdownErr = utils.ErrShuttingDown
+	}
+	check("shutdown", shutdownErr)
+
+	status := http.StatusOK
+	if !response.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	utils.WriteJSON(w, status, response)
+}
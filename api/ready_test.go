@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-cron/internal/testserver"
+	"go-cron/models"
+)
+
+// Test_Live tests that liveness checks no dependency
+func Test_Live(t *testing.T) {
+	setupHandler(t)
+	t.Setenv("DATABASE_URL", "")
+
+	w := httptest.NewRecorder()
+	Live(w, httptest.NewRequest(http.MethodGet, "/api/live", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 with a broken configuration, got %d", w.Code)
+	}
+}
+
+// Test_Ready tests that readiness fails on an invalid configuration and an
+// unreachable database, naming the failed check
+func Test_Ready(t *testing.T) {
+	setupHandler(t)
+	tests := []struct {
+		name        string
+		databaseURL string
+		failed      string
+	}{
+		{"misconfigured", "", "config"},
+		{"unreachable", "postgres://gocron@127.0.0.1:1/gocron?sslmode=disable&connect_timeout=1", "database"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DATABASE_URL", tt.databaseURL)
+			w := httptest.NewRecorder()
+			Ready(w, httptest.NewRequest(http.MethodGet, "/api/ready", nil))
+
+			var response models.ReadinessResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Invalid response %s: %v", w.Body, err)
+			}
+			if w.Code != http.StatusServiceUnavailable || response.Ready {
+				t.Errorf("Expected status 503 and not ready, got %d: %s", w.Code, w.Body)
+			}
+			for _, check := range response.Checks {
+				if (check.Status == models.CheckFailed) != (check.Name == tt.failed) {
+					t.Errorf("Expected only the %s check to fail, got %+v", tt.failed, check)
+				}
+			}
+		})
+	}
+}
+
+// Test_Warmup tests that the warmup logs in to the external API and reports
+// the database it could not reach
+func Test_Warmup(t *testing.T) {
+	server := setupHandler(t)
+
+	r := httptest.NewRequest(http.MethodPost, "/api/warmup?sap=true", nil)
+	r.Header.Set("Authorization", "Bearer "+testSecret)
+	w := httptest.NewRecorder()
+	Warmup(w, r)
+
+	var response models.WarmupResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Invalid response %s: %v", w.Body, err)
+	}
+	if w.Code != http.StatusServiceUnavailable || len(response.Errors) != 1 {
+		t.Errorf("Expected status 503 for the unreachable database, got %d: %s", w.Code, w.Body)
+	}
+	if !response.SAPSession || server.Requests(testserver.EndpointLogin) != 1 {
+		t.Errorf("Expected a session logged in, got %+v", response)
+	}
+}
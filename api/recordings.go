@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+
+	"go-cron/config"
+	"go-cron/external"
+	"go-cron/internal/utils"
+	"go-cron/models"
+)
+
+// Recordings returns the raw external API requests and responses recorded
+// while EXTERNAL_API_RECORD is set, with credentials redacted, and requires
+// the admin secret. DELETE discards them. In memory mode only the exchanges of
+// the serving instance are returned.
+func Recordings(w http.ResponseWriter, r *http.Request) {
+	cfg := config.LoadConfig()
+	if !utils.Authorized(r, cfg.Auth.EffectiveAdminSecret()) {
+		utils.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if !utils.ConfigValid(w, cfg) {
+		return
+	}
+	settings := cfg.ExternalAPI.Recording
+	if settings.Mode == models.RecordingOff {
+		utils.WriteError(w, http.StatusNotFound, "Recording is disabled; set EXTERNAL_API_RECORD to memory or dir")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		exchanges, err := external.Recordings(settings)
+		if err != nil {
+			log.Printf("Failed to read recordings: %v\n", err)
+			utils.WriteError(w, http.StatusInternalServerError, "Failed to read recordings")
+			return
+		}
+		if exchanges == nil {
+			exchanges = []models.RecordedExchange{}
+		}
+		utils.WriteJSON(w, http.StatusOK, models.RecordingsResponse{Mode: settings.Mode, Exchanges: exchanges})
+
+	case http.MethodDelete:
+		if err := external.ClearRecordings(settings); err != nil {
+			log.Printf("Failed to clear recordings: %v\n", err)
+			utils.WriteError(w, http.StatusInternalServerError, "Failed to clear recordings")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		utils.WriteError(w, http.StatusMethodNotAllowed, "Use GET to list or DELETE to clear the recordings")
+	}
+}
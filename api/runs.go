@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+
+	"go-cron/config"
+	"go-cron/internal/utils"
+	"go-cron/models"
+	"go-cron/repo"
+)
+
+// Runs returns the most recent sync runs, newest first (?limit=, default 20, max 100)
+func Runs(w http.ResponseWriter, r *http.Request) {
+	config := config.LoadConfig()
+	if !utils.Authenticate(r, config.Auth) {
+		utils.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if !utils.ConfigValid(w, config) {
+		return
+	}
+	db, ok := utils.Database(w, config)
+	if !ok {
+		return
+	}
+
+	limit := utils.QueryInt(r, "limit", 20, 1, 100)
+	runs, err := repo.NewRunRepository(db).ListRuns(r.Context(), limit)
+	if err != nil {
+		log.Printf("Failed to list runs: %v\n", err)
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to list runs")
+		return
+	}
+
+	response := models.RunsResponse{Runs: make([]models.SyncRun, 0, len(runs))}
+	for _, run := range runs {
+		response.Runs = append(response.Runs, run.In(config.Display.Location))
+	}
+	utils.WriteJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"go-cron/config"
+	"go-cron/internal/utils"
+	"go-cron/models"
+	"go-cron/repo"
+)
+
+// Search returns the products best matching a web-search style query (?q=; ?limit=, default 20, max 100)
+func Search(w http.ResponseWriter, r *http.Request) {
+	config := config.LoadConfig()
+	if !utils.Authenticate(r, config.Auth) {
+		utils.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if !utils.ConfigValid(w, config) {
+		return
+	}
+	db, ok := utils.Database(w, config)
+	if !ok {
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		utils.WriteError(w, http.StatusBadRequest, "Missing search query (q)")
+		return
+	}
+	limit := utils.QueryInt(r, "limit", 20, 1, 100)
+
+	products, err := repo.NewProductRepositoryFromConfig(db, config.Database).SearchProducts(r.Context(), query, limit)
+	if err != nil {
+		log.Printf("Failed to search products: %v\n", err)
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to search products")
+		return
+	}
+
+	if products == nil {
+		products = []models.Product{}
+	}
+	utils.WriteJSON(w, http.StatusOK, models.SearchResponse{Query: query, Products: products})
+}
@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+
+	"go-cron/config"
+	"go-cron/internal/utils"
+	"go-cron/models"
+	"go-cron/repo"
+)
+
+// Status returns the run in progress and the last finished run. The finished
+// run is served from memory for STATUS_CACHE_TTL, so dashboards polling the
+// endpoint cost one indexed query per request.
+func Status(w http.ResponseWriter, r *http.Request) {
+	config := config.LoadConfig()
+	if !utils.Authenticate(r, config.Auth) {
+		utils.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if !utils.ConfigValid(w, config) {
+		return
+	}
+	db, ok := utils.Database(w, config)
+	if !ok {
+		return
+	}
+
+	runRepo := repo.NewRunRepository(db)
+	runRepo.SetClock(utils.Now)
+	// A run started longer ago than twice the sync timeout was left running by a crashed instance
+	running, err := runRepo.GetRunningRun(r.Context(), utils.Now().Add(-2*config.Sync.Timeout))
+	if err != nil {
+		log.Printf("Failed to fetch running run: %v\n", err)
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to fetch last run")
+		return
+	}
+	finished, err := runRepo.GetLastFinishedRun(r.Context(), config.Sync.StatusCacheTTL)
+	if err != nil {
+		log.Printf("Failed to fetch last run: %v\n", err)
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to fetch last run")
+		return
+	}
+
+	response := models.StatusResponse{InProgress: running != nil || utils.SyncsInFlight() > 0}
+	if stats, err := utils.DBStats(); err == nil {
+		response.Pool = &models.PoolStats{
+			OpenConnections: stats.OpenConnections,
+			InUse:           stats.InUse,
+			Idle:            stats.Idle,
+			WaitCount:       stats.WaitCount,
+			WaitDuration:    stats.WaitDuration.String(),
+		}
+	}
+	if finished != nil {
+		local := finished.In(config.Display.Location)
+		response.LastFinishedRun = &local
+		response.LastRun = &local
+	}
+	if running != nil {
+		local := running.In(config.Display.Location)
+		response.LastRun = &local
+	}
+	utils.WriteJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"go-cron/config"
+	"go-cron/engine"
+	"go-cron/internal/utils"
+	"go-cron/models"
+	"go-cron/repo"
+	"go-cron/sinks"
+)
+
+// SyncItem fetches a single item by ItemCode and syncs it right away, returning
+// the product and the fields that changed. It answers POST /api/sync/item/{itemCode}
+// (rewritten to ?itemCode=) and requires the admin secret.
+func SyncItem(w http.ResponseWriter, r *http.Request) {
+	defer utils.RecoverPanic(w)
+	config := config.LoadConfig()
+	if !utils.Authorized(r, config.Auth.EffectiveAdminSecret()) {
+		utils.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if !utils.ConfigValid(w, config) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		utils.WriteError(w, http.StatusMethodNotAllowed, "Use POST to sync an item")
+		return
+	}
+
+	itemCode := strings.TrimSpace(r.URL.Query().Get("itemCode"))
+	if itemCode == "" {
+		itemCode = strings.TrimSpace(strings.TrimPrefix(r.URL.Path, "/api/sync/item/"))
+	}
+	if itemCode == "" || strings.Contains(itemCode, "/") {
+		utils.WriteError(w, http.StatusBadRequest, "An itemCode is required")
+		return
+	}
+
+	db, ok := utils.Database(w, config)
+	if !ok {
+		return
+	}
+	if config, ok = utils.ProfileConfig(w, r, config, db); !ok {
+		return
+	}
+	done, err := utils.BeginSync()
+	if err != nil {
+		utils.WriteError(w, http.StatusServiceUnavailable, "Service is shutting down")
+		return
+	}
+	defer done()
+
+	ctx := r.Context()
+	eng := engine.New(config, db)
+	eng.SetClock(utils.Now)
+	if config.Database.Driver == models.DatabaseDriverPgx {
+		pool, err := utils.PgxPool(config)
+		if err != nil {
+			log.Printf("Database unavailable: %v\n", err)
+			utils.WriteError(w, http.StatusServiceUnavailable, "Database unavailable")
+			return
+		}
+		eng.UsePgx(pool)
+	}
+	outboxRepo := repo.NewOutboxRepository(db)
+	fanOut := sinks.NewFanOut(outboxRepo, sinks.FromConfig(config, repo.NewSinkMappingRepository(db))...)
+	eng.SetOutbox(outboxRepo, fanOut.Names())
+
+	result, err := eng.SyncItem(ctx, itemCode, engine.Options{})
+	if errors.Is(err, engine.ErrItemNotFound) {
+		utils.WriteError(w, http.StatusNotFound, fmt.Sprintf("Item %s not found in the external API", itemCode))
+		return
+	}
+	if err != nil {
+		log.Printf("Sync of item %s failed: %v\n", itemCode, err)
+		status := http.StatusInternalServerError
+		var stageErr *engine.StageError
+		if errors.As(err, &stageErr) && stageErr.Stage == engine.StageFetch {
+			status = http.StatusBadGateway
+		}
+		utils.WriteError(w, status, fmt.Sprintf("Sync of item %s failed: %v", itemCode, err))
+		return
+	}
+
+	// Deliver the change to downstream sinks right away too
+	if result.Result != nil {
+		result.Result.Pushed = sinks.Pushed(fanOut.Dispatch(ctx), result.Result.Changes)
+	} else {
+		fanOut.Dispatch(ctx)
+	}
+
+	log.Printf("Synced item %s: %s\n", itemCode, result.Action)
+	utils.WriteJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,302 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-cron/config"
+	"go-cron/engine"
+	"go-cron/internal/recovery"
+	"go-cron/internal/utils"
+	"go-cron/models"
+	"go-cron/notify"
+	"go-cron/repo"
+	"go-cron/sinks"
+)
+
+// jobHeartbeat is how often a running job reports its progress
+const jobHeartbeat = 15 * time.Second
+
+// jobStaleAfter is how long a running job may go without a heartbeat before
+// its invocation is presumed dead and another one may take it over
+const jobStaleAfter = 4 * jobHeartbeat
+
+// jobKickTimeout bounds the request that starts a job in its own invocation;
+// the run is not awaited, only its start
+const jobKickTimeout = 2 * time.Second
+
+// SyncJobs runs syncs asynchronously so callers never hold a connection for
+// the length of a sync. POST /api/sync enqueues a job (?full=true, ?dryRun=true, ?confirm=true)
+// and answers 202 with its ID right away, after starting its run in a separate
+// invocation. GET /api/sync/{id} reports the job's status, progress and
+// result from the database, so any instance can answer. POST /api/sync/{id}/run
+// runs a queued job, or takes over a running one whose invocation stopped
+// sending heartbeats. The routes are rewritten to ?id= and ?run=true and
+// require the cron secret.
+func SyncJobs(w http.ResponseWriter, r *http.Request) {
+	defer utils.RecoverPanic(w)
+	config := config.LoadConfig()
+	if !utils.Authenticate(r, config.Auth) {
+		utils.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if !utils.ConfigValid(w, config) {
+		return
+	}
+
+	id, run, err := jobRoute(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	switch {
+	case id == 0 && r.Method == http.MethodPost:
+	case id != 0 && !run && r.Method == http.MethodGet:
+	case id != 0 && run && r.Method == http.MethodPost:
+	default:
+		allow := http.MethodPost
+		if id != 0 && !run {
+			allow = http.MethodGet
+		}
+		w.Header().Set("Allow", allow)
+		utils.WriteError(w, http.StatusMethodNotAllowed, "Use POST /api/sync, GET /api/sync/{id} or POST /api/sync/{id}/run")
+		return
+	}
+
+	db, ok := utils.Database(w, config)
+	if !ok {
+		return
+	}
+	jobs := repo.NewJobRepository(db)
+	jobs.SetClock(utils.Now)
+
+	switch {
+	case id == 0:
+		enqueueJob(w, r, config, jobs)
+	case !run:
+		job, err := jobs.GetJob(r.Context(), id)
+		if err != nil {
+			log.Printf("Failed to get sync job %d: %v\n", id, err)
+			utils.WriteError(w, http.StatusInternalServerError, "Failed to get sync job")
+			return
+		}
+		if job == nil {
+			utils.WriteError(w, http.StatusNotFound, fmt.Sprintf("Sync job %d not found", id))
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, job.In(config.Display.Location))
+	default:
+		if config, ok = utils.ProfileConfig(w, r, config, db); !ok {
+			return
+		}
+		runJob(w, r, config, db, jobs, id)
+	}
+}
+
+// jobRoute returns the job ID of the request, zero for the collection, and
+// whether it asks to run the job
+func jobRoute(r *http.Request) (int, bool, error) {
+	run, _ := strconv.ParseBool(r.URL.Query().Get("run"))
+	raw := r.URL.Query().Get("id")
+	if raw == "" {
+		path := strings.TrimPrefix(r.URL.Path, "/api/sync_job")
+		path = strings.Trim(strings.TrimPrefix(path, "/api/sync"), "/")
+		if rest, ok := strings.CutSuffix(path, "/run"); ok {
+			path, run = rest, true
+		}
+		raw = path
+	}
+	if raw == "" {
+		return 0, false, nil
+	}
+	id, err := strconv.Atoi(raw)
+	if err != nil || id <= 0 {
+		return 0, false, fmt.Errorf("invalid job ID %q", raw)
+	}
+	return id, run, nil
+}
+
+// enqueueJob queues a sync job and starts its run in another invocation
+func enqueueJob(w http.ResponseWriter, r *http.Request, config *models.AppConfig, jobs *repo.JobRepository) {
+	var opts models.JobOptions
+	opts.Full, _ = strconv.ParseBool(r.URL.Query().Get("full"))
+	opts.DryRun, _ = strconv.ParseBool(r.URL.Query().Get("dryRun"))
+	opts.Confirm, _ = strconv.ParseBool(r.URL.Query().Get("confirm"))
+
+	job, err := jobs.EnqueueJob(r.Context(), opts)
+	if err != nil {
+		log.Printf("Failed to enqueue sync job: %v\n", err)
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to enqueue sync job")
+		return
+	}
+	log.Printf("Enqueued sync job %d\n", job.ID)
+
+	statusURL := fmt.Sprintf("/api/sync/%d", job.ID)
+	kickJob(r, config, statusURL+"/run")
+
+	w.Header().Set("Location", statusURL)
+	utils.WriteJSON(w, http.StatusAccepted, models.JobAcceptedResponse{JobID: job.ID, Status: job.Status, StatusURL: statusURL})
+}
+
+// kickJob sends the run request of a job to this deployment, at JOB_BASE_URL,
+// without waiting for the run. The target is never taken from the request, so
+// a forged Host cannot receive the cron secret. A job that could not be
+// started stays queued until its run endpoint is called again.
+func kickJob(r *http.Request, config *models.AppConfig, path string) {
+	if config.Sync.JobBaseURL == "" {
+		log.Printf("JOB_BASE_URL is not set; call POST %s to start the sync job\n", path)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), jobKickTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.Sync.JobBaseURL+path, nil)
+	if err != nil {
+		log.Printf("Failed to start sync job: %v\n", err)
+		return
+	}
+	utils.AuthenticateRequest(req, config.Auth, nil)
+
+	resp, err := http.DefaultClient.Do(req)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return // The run is under way
+	}
+	if err != nil {
+		log.Printf("Failed to start sync job: %v\n", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("Failed to start sync job: status %d\n", resp.StatusCode)
+	}
+}
+
+// runJob claims a job and runs its sync, reporting progress as heartbeats,
+// then records the run, delivers the queued changes and stores the outcome
+func runJob(w http.ResponseWriter, r *http.Request, config *models.AppConfig, db *sql.DB, jobs *repo.JobRepository, id int) {
+	job, err := jobs.ClaimJob(r.Context(), id, jobStaleAfter)
+	if errors.Is(err, repo.ErrJobNotClaimable) {
+		utils.WriteError(w, http.StatusConflict, fmt.Sprintf("Sync job %d is finished or running", id))
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to claim sync job %d: %v\n", id, err)
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to claim sync job")
+		return
+	}
+	if job == nil {
+		utils.WriteError(w, http.StatusNotFound, fmt.Sprintf("Sync job %d not found", id))
+		return
+	}
+	log.Printf("Running sync job %d (attempt %d)\n", job.ID, job.Attempts)
+
+	// The run outlives the request that started it
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), config.Sync.Timeout)
+	defer cancel()
+
+	// Whatever happens below, the job ends in a final state
+	job.Status, job.Error = models.JobStatusFailed, ""
+	defer func() {
+		if err := jobs.FinishJob(context.Background(), job); err != nil {
+			log.Printf("Failed to record sync job %d: %v\n", job.ID, err)
+		}
+		utils.WriteJSON(w, http.StatusOK, job.In(config.Display.Location))
+	}()
+	// A panic fails the job like any other error
+	defer func() {
+		if err := recovery.Error(recover()); err != nil {
+			job.Status, job.Error = models.JobStatusFailed, err.Error()
+		}
+	}()
+
+	done, err := utils.BeginSync()
+	if err != nil {
+		job.Error = "Service is shutting down"
+		return
+	}
+	defer done()
+
+	eng := engine.New(config, db)
+	eng.SetClock(utils.Now)
+	if config.Database.Driver == models.DatabaseDriverPgx {
+		pool, err := utils.PgxPool(config)
+		if err != nil {
+			job.Error = fmt.Sprintf("Database unavailable: %v", err)
+			return
+		}
+		eng.UsePgx(pool)
+	}
+	if err := eng.CheckBackoff(ctx); err != nil {
+		job.Error = err.Error()
+		return
+	}
+	outboxRepo := repo.NewOutboxRepository(db)
+	fanOut := sinks.NewFanOut(outboxRepo, sinks.FromConfig(config, repo.NewSinkMappingRepository(db))...)
+	eng.SetOutbox(outboxRepo, fanOut.Names())
+
+	progress, stopHeartbeat := jobs.Heartbeat(context.Background(), job.ID, jobHeartbeat)
+	defer stopHeartbeat()
+
+	// Dry runs leave no trace in the run history, like dry runs of the CLI
+	runRepo := repo.NewRunRepository(db)
+	run := &models.SyncRun{Entity: models.EntityProducts, Trigger: models.RunTriggerJob, StartedAt: utils.Now().UTC()}
+	if !job.Options.DryRun {
+		if _, err := runRepo.StartRun(ctx, run); err != nil {
+			log.Printf("Failed to start sync run, its changes will not be audited: %v\n", err)
+		} else if err := jobs.SetJobRun(ctx, job.ID, run.ID); err != nil {
+			log.Println(err)
+		} else {
+			job.RunID = run.ID
+		}
+	}
+	// A panic of the run still records it as failed before the job does
+	defer func() {
+		if err := recovery.Error(recover()); err != nil {
+			if run.ID != 0 {
+				run.Status, run.Error, run.FinishedAt = models.SyncStatusFailed, err.Error(), utils.Now().UTC()
+				if err := runRepo.FinishRun(context.Background(), run); err != nil {
+					log.Printf("Failed to record sync run: %v\n", err)
+				}
+			}
+			panic(err)
+		}
+	}()
+
+	report, err := eng.Run(ctx, engine.Options{ForceFull: job.Options.Full, DryRun: job.Options.DryRun, Confirm: job.Options.Confirm, RunID: run.ID, Progress: progress})
+	job.Result, run.Result = report.Result, report.Result
+	if err != nil {
+		job.Error, run.Status, run.Error = err.Error(), models.SyncStatusFailed, err.Error()
+		log.Printf("Sync job %d failed: %v\n", job.ID, err)
+	} else {
+		job.Status, run.Status = models.JobStatusDone, report.Result.Status
+		if !job.Options.DryRun {
+			report.Result.Pushed = sinks.Pushed(fanOut.Dispatch(ctx), report.Result.Changes)
+		}
+	}
+	stopHeartbeat()
+
+	if run.ID == 0 {
+		return
+	}
+	run.FinishedAt = utils.Now().UTC()
+	if err := runRepo.FinishRun(context.Background(), run); err != nil {
+		log.Printf("Failed to record sync run: %v\n", err)
+	}
+	notifier, err := notify.NewFromConfig(context.Background(), config, repo.NewNotificationTemplateRepository(db), repo.NewDigestRepository(db))
+	if err != nil {
+		log.Printf("Notifications disabled: %v\n", err)
+		return
+	}
+	notifier.Notify(context.Background(), models.RunSummary{
+		Run:      run.In(config.Display.Location),
+		Duration: run.FinishedAt.Sub(run.StartedAt),
+		Timezone: config.Display.Timezone,
+	})
+}
@@ -0,0 +1,200 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go-cron/config"
+	"go-cron/engine"
+	"go-cron/internal/utils"
+	"go-cron/models"
+	"go-cron/repo"
+	"go-cron/sinks"
+)
+
+// SyncPlans reviews and approves the sync plans held by the change guard when
+// SYNC_REQUIRE_APPROVAL is set. GET /api/sync/plans/{id} returns a plan with
+// its status, and its result once applied. POST /api/sync/{id}/approve applies
+// a pending plan, once, and returns it with the result; a plan held for longer
+// than SYNC_PLAN_TTL expires instead, and an approved plan whose apply never
+// finished can be approved again once SYNC_TIMEOUT passed. POST
+// /api/sync/{id}/reject rejects a pending plan. The routes are rewritten to
+// ?id= and ?approve=true or ?reject=true and require the admin secret, so the
+// cron secret that planned the changes cannot approve them.
+func SyncPlans(w http.ResponseWriter, r *http.Request) {
+	defer utils.RecoverPanic(w)
+	config := config.LoadConfig()
+	if !utils.Authorized(r, config.Auth.EffectiveAdminSecret()) {
+		utils.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if !utils.ConfigValid(w, config) {
+		return
+	}
+
+	approve, _ := strconv.ParseBool(r.URL.Query().Get("approve"))
+	reject, _ := strconv.ParseBool(r.URL.Query().Get("reject"))
+	id, err := strconv.Atoi(strings.TrimSpace(r.URL.Query().Get("id")))
+	if err != nil || id <= 0 {
+		utils.WriteError(w, http.StatusBadRequest, "A valid plan ID is required")
+		return
+	}
+	decide := approve || reject
+	switch {
+	case approve && reject:
+		utils.WriteError(w, http.StatusBadRequest, "A plan is either approved or rejected")
+		return
+	case decide && r.Method == http.MethodPost:
+	case !decide && r.Method == http.MethodGet:
+	default:
+		allow := http.MethodGet
+		if decide {
+			allow = http.MethodPost
+		}
+		w.Header().Set("Allow", allow)
+		utils.WriteError(w, http.StatusMethodNotAllowed, "Use GET /api/sync/plans/{id}, POST /api/sync/{id}/approve or POST /api/sync/{id}/reject")
+		return
+	}
+
+	db, ok := utils.Database(w, config)
+	if !ok {
+		return
+	}
+	plans := repo.NewPlanRepository(db)
+	plans.SetClock(utils.Now)
+
+	if reject {
+		rejectPlan(w, r, plans, id)
+		return
+	}
+	if !approve {
+		plan, err := plans.GetPlan(r.Context(), id)
+		if err != nil {
+			log.Printf("Failed to get sync plan %d: %v\n", id, err)
+			utils.WriteError(w, http.StatusInternalServerError, "Failed to get sync plan")
+			return
+		}
+		if plan == nil {
+			utils.WriteError(w, http.StatusNotFound, fmt.Sprintf("Sync plan %d not found", id))
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, plan)
+		return
+	}
+	if config, ok = utils.ProfileConfig(w, r, config, db); !ok {
+		return
+	}
+	approvePlan(w, r, config, db, plans, id)
+}
+
+// approvePlan claims a pending plan, applies it as a recorded run, delivers
+// the queued changes and stores the outcome on the plan
+func approvePlan(w http.ResponseWriter, r *http.Request, config *models.AppConfig, db *sql.DB, plans *repo.PlanRepository, id int) {
+	done, err := utils.BeginSync()
+	if err != nil {
+		utils.WriteError(w, http.StatusServiceUnavailable, "Service is shutting down")
+		return
+	}
+	defer done()
+
+	// The apply is bounded like a sync, so an approved plan still unfinished
+	// after SYNC_TIMEOUT is known to be dead and can be approved again
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), config.Sync.Timeout)
+	defer cancel()
+	// The database is checked before the approval, which cannot be undone
+	eng := engine.New(config, db)
+	eng.SetClock(utils.Now)
+	if config.Database.Driver == models.DatabaseDriverPgx {
+		pool, err := utils.PgxPool(config)
+		if err != nil {
+			log.Printf("Database unavailable: %v\n", err)
+			utils.WriteError(w, http.StatusServiceUnavailable, "Database unavailable")
+			return
+		}
+		eng.UsePgx(pool)
+	}
+
+	stored, err := plans.ApprovePlan(ctx, id, config.Sync.PlanTTL, config.Sync.Timeout)
+	if errors.Is(err, repo.ErrPlanNotPending) {
+		utils.WriteError(w, http.StatusConflict, fmt.Sprintf("Sync plan %d was already decided", id))
+		return
+	}
+	if errors.Is(err, repo.ErrPlanExpired) {
+		utils.WriteError(w, http.StatusConflict, fmt.Sprintf("Sync plan %d expired; run the sync again", id))
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to approve sync plan %d: %v\n", id, err)
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to approve sync plan")
+		return
+	}
+	if stored == nil {
+		utils.WriteError(w, http.StatusNotFound, fmt.Sprintf("Sync plan %d not found", id))
+		return
+	}
+	log.Printf("Applying approved sync plan %d\n", id)
+
+	outboxRepo := repo.NewOutboxRepository(db)
+	fanOut := sinks.NewFanOut(outboxRepo, sinks.FromConfig(config, repo.NewSinkMappingRepository(db))...)
+	eng.SetOutbox(outboxRepo, fanOut.Names())
+
+	runRepo := repo.NewRunRepository(db)
+	run := &models.SyncRun{Entity: models.EntityProducts, Trigger: models.RunTriggerApproval, StartedAt: utils.Now().UTC()}
+	if _, err := runRepo.StartRun(ctx, run); err != nil {
+		log.Printf("Failed to start sync run, its changes will not be audited: %v\n", err)
+	}
+
+	result, err := eng.ApplyPlan(ctx, stored.Plan, engine.Options{Confirm: true, RunID: run.ID})
+	run.Result, run.FinishedAt = result, utils.Now().UTC()
+	stored.Result, stored.Status = result, models.PlanStatusApplied
+	if err != nil {
+		run.Status, run.Error = models.SyncStatusFailed, err.Error()
+		stored.Status = models.PlanStatusFailed
+	} else {
+		run.Status = result.Status
+		result.Pushed = sinks.Pushed(fanOut.Dispatch(ctx), result.Changes)
+	}
+	if run.ID != 0 {
+		if err := runRepo.FinishRun(context.Background(), run); err != nil {
+			log.Printf("Failed to record sync run: %v\n", err)
+		}
+	}
+	if err := plans.FinishPlan(context.Background(), id, stored.Status, result); err != nil {
+		log.Printf("Failed to record sync plan %d: %v\n", id, err)
+	}
+	if err != nil {
+		log.Printf("Sync plan %d failed: %v\n", id, err)
+		utils.WriteError(w, http.StatusInternalServerError, fmt.Sprintf("Sync plan %d failed: %v", id, err))
+		return
+	}
+
+	log.Printf("Applied sync plan %d: %d created, %d updated, %d archived\n", id, result.Created, result.Updated, result.Archived)
+	utils.WriteJSON(w, http.StatusOK, stored)
+}
+
+// rejectPlan marks a pending plan as rejected and returns it
+func rejectPlan(w http.ResponseWriter, r *http.Request, plans *repo.PlanRepository, id int) {
+	stored, err := plans.RejectPlan(r.Context(), id)
+	if errors.Is(err, repo.ErrPlanNotPending) {
+		utils.WriteError(w, http.StatusConflict, fmt.Sprintf("Sync plan %d was already decided", id))
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to reject sync plan %d: %v\n", id, err)
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to reject sync plan")
+		return
+	}
+	if stored == nil {
+		utils.WriteError(w, http.StatusNotFound, fmt.Sprintf("Sync plan %d not found", id))
+		return
+	}
+
+	log.Printf("Rejected sync plan %d\n", id)
+	utils.WriteJSON(w, http.StatusOK, stored)
+}
@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"go-cron/config"
+	"go-cron/external"
+	"go-cron/internal/utils"
+	"go-cron/models"
+)
+
+// Warmup prepares a cold instance for the next sync: it opens the database
+// pool with its idle connections and, with ?sap=true, logs in to the external
+// API, keeping the session for the next fetch of the instance. Schedule it
+// shortly before the sync cron. It answers 503 when a step failed.
+func Warmup(w http.ResponseWriter, r *http.Request) {
+	defer utils.RecoverPanic(w)
+	startTime := utils.Now()
+
+	config := config.LoadConfig()
+	if !utils.Authenticate(r, config.Auth) {
+		utils.WriteError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if !utils.ConfigValid(w, config) {
+		return
+	}
+
+	var response models.WarmupResponse
+	connections, err := utils.WarmDB(r.Context(), config)
+	response.Connections = connections
+	if err != nil {
+		log.Printf("Database warmup failed: %v\n", err)
+		response.Errors = append(response.Errors, "database: "+err.Error())
+	}
+	if sap, _ := strconv.ParseBool(r.URL.Query().Get("sap")); sap && config.Source.Kind == models.SourceSAP {
+		if err := external.Warm(r.Context(), config); err != nil {
+			log.Printf("External API warmup failed: %v\n", err)
+			response.Errors = append(response.Errors, "external API: "+err.Error())
+		} else {
+			response.SAPSession = true
+		}
+	}
+	response.Duration = utils.Now().Sub(startTime).String()
+
+	status := http.StatusOK
+	if len(response.Errors) > 0 {
+		status = http.StatusServiceUnavailable
+	}
+	utils.WriteJSON(w, status, response)
+}
@@ -0,0 +1,620 @@
+// Command gocron triggers and inspects product syncs from a terminal.
+// Run "gocron help" for the list of commands.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"go-cron/config"
+	"go-cron/engine"
+	"go-cron/external"
+	"go-cron/internal/utils"
+	"go-cron/models"
+	"go-cron/notify"
+	"go-cron/repo"
+	"go-cron/sinks"
+	"go-cron/sources"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	cfg := config.LoadConfig()
+	if cmd := os.Args[1]; cmd != "help" && cmd != "-h" && cmd != "--help" {
+		if err := cfg.Validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	// Ctrl-C cancels the running command; a sync then returns its partial result
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var err error
+	switch cmd, args := os.Args[1], os.Args[2:]; cmd {
+	case "sync":
+		err = runSync(ctx, cfg, args)
+	case "status":
+		err = runStatus(ctx, cfg)
+	case "list-products":
+		err = runListProducts(ctx, cfg, args)
+	case "purge-stale":
+		err = runPurgeStale(ctx, cfg, args)
+	case "test-connection":
+		err = runTestConnection(cfg)
+	case "preflight":
+		err = runPreflight(ctx, cfg)
+	case "sinks":
+		err = runSinks(ctx, cfg, args)
+	case "changes":
+		err = runChanges(ctx, cfg, args)
+	case "migrate":
+		err = runMigrate(ctx, cfg)
+	case "reindex-search":
+		err = runReindexSearch(ctx, cfg, args)
+	case "repair-handles":
+		err = runRepairHandles(ctx, cfg, args)
+	case "bench":
+		err = runBench(ctx, cfg, args)
+	case "help", "-h", "--help":
+		usage()
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", cmd)
+		usage()
+		os.Exit(2)
+	}
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancelShutdown()
+	if shutdownErr := utils.Shutdown(shutdownCtx); shutdownErr != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", shutdownErr)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `Usage: gocron <command> [flags]
+
+Commands:
+  sync             run a full sync (-dry-run to only report planned changes, -progress to report write progress, -profile <name> to use a named profile of the config file)
+  status           show the last recorded sync run
+  list-products    list products stored in the database (-sort-title for a locale-aware title order)
+  purge-stale      archive products no longer present in the external API (-confirm to archive, -hard to delete)
+  test-connection  check database and external API connectivity
+  preflight        check that the external API returns every selected item field
+  sinks            show per-sink outbox lag (-retry <sink> to retry its failed deliveries)
+  changes          show the audit log of a product (-product <id>) or a sync run (-run <id>), -csv for CSV
+  migrate          create the tables and apply the schema migrations the database is missing
+  reindex-search   fill in missing product search vectors (-all to rebuild every one)
+  repair-handles   regenerate missing, duplicated and non-conforming handles (-apply to write them, -ensure-index to add the unique index)
+  bench            measure insert and update throughput per batch size with synthetic products (-sizes 100,500,1000, -rows 2000)`)
+}
+
+// runSync fetches all external items and syncs them into the database
+func runSync(ctx context.Context, cfg *models.AppConfig, args []string) error {
+	fs := flag.NewFlagSet("sync", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "compute changes without writing them")
+	showProgress := fs.Bool("progress", false, "report the progress of the database writes on stderr")
+	confirm := fs.Bool("confirm", false, "apply the changes even when they trip the change guard")
+	profile := fs.String("profile", "", "sync with the named profile of the config file")
+	fs.Parse(args)
+
+	db, err := utils.OpenDB(cfg)
+	if err != nil {
+		return err
+	}
+	// Outside Postgres only the products are stored: there are no profiles nor run records
+	portable := cfg.Database.Dialect != models.DatabaseDialectPostgres
+	if portable {
+		if err := repo.NewSQLProductRepository(db, repo.Dialect(cfg.Database.Dialect)).EnsureSchema(ctx); err != nil {
+			return err
+		}
+	}
+	// Sync with the imported profile, like the scheduled syncs
+	var stored *models.StoredSyncProfile
+	if !portable {
+		if stored, err = repo.NewProfileRepository(db).GetActiveProfile(ctx); err != nil {
+			return err
+		}
+	}
+	if stored != nil || *profile != "" {
+		var imported *models.SyncProfile
+		if stored != nil {
+			imported = &stored.Profile
+		}
+		if cfg, err = config.LoadConfigWithNamedProfile(imported, *profile); err != nil {
+			return err
+		}
+		if err := cfg.Validate(); err != nil {
+			if stored != nil {
+				return fmt.Errorf("sync profile %d: %w", stored.ID, err)
+			}
+			return err
+		}
+	}
+	done, err := utils.BeginSync()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	runRepo := repo.NewRunRepository(db)
+	run := &models.SyncRun{Entity: models.EntityProducts, Trigger: models.RunTriggerCLI, StartedAt: utils.Now().UTC()}
+	// Dry runs leave no trace in the run history or the audit log
+	record := !*dryRun && !portable
+	if record {
+		if _, err := runRepo.StartRun(ctx, run); err != nil {
+			return err
+		}
+	}
+
+	// The CLI always runs a full sync, which also resets the incremental sync watermark
+	opts := engine.Options{DryRun: *dryRun, ForceFull: true, Confirm: *confirm, RunID: run.ID, Partial: cfg.Profile != ""}
+	if *showProgress {
+		opts.Progress = func(phase string, done, total int) {
+			fmt.Fprintf(os.Stderr, "%s: %d/%d\n", phase, done, total)
+		}
+	}
+	eng := engine.New(cfg, db)
+	if cfg.Database.Driver == models.DatabaseDriverPgx {
+		pool, err := utils.PgxPool(cfg)
+		if err != nil {
+			return err
+		}
+		eng.UsePgx(pool)
+	}
+	report, err := eng.Run(ctx, opts)
+	run.Result = report.Result
+
+	if record {
+		run.FinishedAt = utils.Now().UTC()
+		if err != nil {
+			run.Status, run.Error = models.SyncStatusFailed, err.Error()
+		} else {
+			run.Status = run.Result.Status
+		}
+		if recErr := runRepo.FinishRun(context.Background(), run); recErr != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", recErr)
+		}
+		if notifier, notifyErr := notify.NewFromConfig(context.Background(), cfg, repo.NewNotificationTemplateRepository(db), repo.NewDigestRepository(db)); notifyErr != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", notifyErr)
+		} else {
+			notifier.Notify(context.Background(), models.RunSummary{
+				Run:      run.In(cfg.Display.Location),
+				Duration: run.FinishedAt.Sub(run.StartedAt),
+				Timezone: cfg.Display.Timezone,
+			})
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+	return printJSON(run.Result)
+}
+
+// runStatus prints the last recorded sync run
+func runStatus(ctx context.Context, cfg *models.AppConfig) error {
+	db, err := utils.OpenDB(cfg)
+	if err != nil {
+		return err
+	}
+
+	run, err := repo.NewRunRepository(db).GetLastRun(ctx)
+	if err != nil {
+		return err
+	}
+	if run == nil {
+		fmt.Println("No sync runs recorded yet.")
+		return nil
+	}
+	return printJSON(run.In(cfg.Display.Location))
+}
+
+// runListProducts prints every product in the database
+func runListProducts(ctx context.Context, cfg *models.AppConfig, args []string) error {
+	fs := flag.NewFlagSet("list-products", flag.ExitOnError)
+	byTitle := fs.Bool("sort-title", false, "sort by title using the DISPLAY_LOCALE collation instead of by ID")
+	fs.Parse(args)
+
+	db, err := utils.OpenDB(cfg)
+	if err != nil {
+		return err
+	}
+
+	productRepo := repo.NewProductRepositoryFromConfig(db, cfg.Database)
+
+	// Sorting needs the whole catalog; otherwise stream it page by page
+	if *byTitle {
+		products, err := productRepo.GetAllProducts(ctx)
+		if err != nil {
+			return err
+		}
+		utils.SortProductsByTitle(products, cfg.Display.Locale)
+		for _, p := range products {
+			fmt.Printf("%d\t%s\t%s\n", p.ID, p.Handle, p.Title)
+		}
+		fmt.Fprintf(os.Stderr, "%d products\n", len(products))
+		return nil
+	}
+
+	const pageSize = 500
+	total := 0
+	for offset := 0; ; offset += pageSize {
+		products, err := productRepo.GetProductsPaged(ctx, offset, pageSize)
+		if err != nil {
+			return err
+		}
+		for _, p := range products {
+			fmt.Printf("%d\t%s\t%s\n", p.ID, p.Handle, p.Title)
+		}
+		total += len(products)
+		if len(products) < pageSize {
+			break
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%d products\n", total)
+	return nil
+}
+
+// runPurgeStale lists, and with -confirm archives (or with -hard deletes), products missing from the item source
+func runPurgeStale(ctx context.Context, cfg *models.AppConfig, args []string) error {
+	fs := flag.NewFlagSet("purge-stale", flag.ExitOnError)
+	confirm := fs.Bool("confirm", false, "actually archive the stale products")
+	hard := fs.Bool("hard", false, "delete the stale products instead of archiving them")
+	fs.Parse(args)
+
+	db, err := utils.OpenDB(cfg)
+	if err != nil {
+		return err
+	}
+	productRepo := repo.NewProductRepositoryFromConfig(db, cfg.Database)
+	titles, err := repo.NewNormalizer(cfg.Sync.TitleRules, cfg.Sync.VendorPrefixes)
+	if err != nil {
+		return err
+	}
+	if cfg.Sync.CaseSensitive {
+		titles = titles.CaseSensitive()
+	}
+	productRepo.SetNormalizer(titles)
+
+	fetched, err := sources.FromConfig(cfg).FetchAll(ctx)
+	if err != nil {
+		return err
+	}
+	// Never purge on an empty or truncated feed; it almost always means a broken filter, login or CompanyDB
+	if err := repo.CheckFeed(ctx, productRepo, len(fetched.Items), cfg.Sync.MinFeedRatio); err != nil {
+		return fmt.Errorf("refusing to purge: %w", err)
+	}
+
+	syncService := repo.NewSyncService(productRepo)
+	syncService.SetNormalizer(titles)
+	stale, err := syncService.FindStale(ctx, fetched.Items)
+	if err != nil {
+		return err
+	}
+
+	utils.SortProductsByTitle(stale, cfg.Display.Locale)
+	ids := make([]int, 0, len(stale))
+	for _, p := range stale {
+		fmt.Printf("%d\t%s\t%s\n", p.ID, p.Handle, p.Title)
+		ids = append(ids, p.ID)
+	}
+
+	if !*confirm {
+		fmt.Fprintf(os.Stderr, "%d stale products (re-run with -confirm to archive them)\n", len(stale))
+		return nil
+	}
+
+	// Archived products are reactivated by the sync if they reappear
+	action := models.ChangeActionArchive
+	removed := stale
+	if *hard {
+		action = models.ChangeActionDelete
+		deleted, err := productRepo.DeleteProducts(ctx, ids)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Deleted %d stale products\n", deleted)
+	} else {
+		archivedIDs, err := productRepo.ArchiveProductsBatch(ctx, ids)
+		if err != nil {
+			return err
+		}
+		// Only the products archived here are audited, not those a sync archived meanwhile
+		archived := make(map[int]bool, len(archivedIDs))
+		for _, id := range archivedIDs {
+			archived[id] = true
+		}
+		removed = nil
+		for _, p := range stale {
+			if archived[p.ID] {
+				removed = append(removed, p)
+			}
+		}
+		fmt.Fprintf(os.Stderr, "Archived %d stale products\n", len(removed))
+	}
+
+	changes := make([]models.ProductChange, 0, len(removed))
+	for _, p := range removed {
+		changes = append(changes, models.ProductChange{ProductID: p.ID, Action: action, OldTitle: p.Title, OldHandle: p.Handle})
+	}
+	audit := repo.NewAuditRepository(db)
+	audit.SetTable(cfg.Database.Schema, cfg.Database.ProductsTable)
+	if err := audit.RecordChanges(ctx, changes); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+	return nil
+}
+
+// runTestConnection verifies the database and external API are reachable
+func runTestConnection(cfg *models.AppConfig) error {
+	if _, err := utils.OpenDB(cfg); err != nil {
+		return fmt.Errorf("database connection failed: %w", err)
+	}
+	fmt.Println("Database: OK")
+
+	sessionID, err := external.Login(context.Background(), cfg)
+	if err != nil {
+		return fmt.Errorf("external API login failed: %w", err)
+	}
+	if err := external.Logout(cfg, sessionID); err != nil {
+		return fmt.Errorf("external API logout failed: %w", err)
+	}
+	fmt.Println("External API: OK")
+	return nil
+}
+
+// runPreflight checks the configured item query on a single item
+func runPreflight(ctx context.Context, cfg *models.AppConfig) error {
+	// No fetch follows to use the session of a passing check
+	defer external.DropWarm(cfg)
+	if err := external.Preflight(ctx, cfg); err != nil {
+		return err
+	}
+	fmt.Println("Preflight: OK")
+	return nil
+}
+
+// runSinks prints the outbox lag per sink, optionally retrying one sink first
+func runSinks(ctx context.Context, cfg *models.AppConfig, args []string) error {
+	fs := flag.NewFlagSet("sinks", flag.ExitOnError)
+	retry := fs.String("retry", "", "retry the failed deliveries of this sink")
+	fs.Parse(args)
+
+	db, err := utils.OpenDB(cfg)
+	if err != nil {
+		return err
+	}
+	outbox := repo.NewOutboxRepository(db)
+
+	if *retry != "" {
+		result, err := sinks.NewFanOut(outbox, sinks.FromConfig(cfg, repo.NewSinkMappingRepository(db))...).RetrySink(ctx, *retry)
+		if err != nil {
+			return err
+		}
+		if err := printJSON(result); err != nil {
+			return err
+		}
+	}
+
+	lags, err := outbox.SinkLag(ctx)
+	if err != nil {
+		return err
+	}
+	return printJSON(lags)
+}
+
+// runChanges prints the audited changes of a product or a sync run
+func runChanges(ctx context.Context, cfg *models.AppConfig, args []string) error {
+	fs := flag.NewFlagSet("changes", flag.ExitOnError)
+	productID := fs.Int("product", 0, "show the changes of this product")
+	runID := fs.Int("run", 0, "show the changes applied by this sync run")
+	limit := fs.Int("limit", 100, "maximum number of changes to show; the CSV of a run has them all")
+	asCSV := fs.Bool("csv", false, "print the changes as CSV with before and after values")
+	fs.Parse(args)
+
+	if (*productID == 0) == (*runID == 0) {
+		return fmt.Errorf("exactly one of -product or -run is required")
+	}
+
+	db, err := utils.OpenDB(cfg)
+	if err != nil {
+		return err
+	}
+	audit := repo.NewAuditRepository(db)
+	audit.SetTable(cfg.Database.Schema, cfg.Database.ProductsTable)
+	var changes []models.ProductChange
+	switch {
+	case *productID != 0:
+		changes, err = audit.ListChangesByProduct(ctx, *productID, *limit)
+	case *asCSV:
+		// The CSV of a run holds every change, whatever the limit
+		err = audit.EachChangeOfRun(ctx, *runID, func(page []models.ProductChange) error {
+			changes = append(changes, page...)
+			return nil
+		})
+	default:
+		changes, err = audit.ListChangesByRun(ctx, *runID, *limit)
+	}
+	if err != nil {
+		return err
+	}
+
+	if *asCSV {
+		utils.SortChangesByTitle(changes, cfg.Display.Locale)
+		return utils.WriteChangesCSV(os.Stdout, changes, cfg.Display.Location)
+	}
+	for i := range changes {
+		changes[i] = changes[i].In(cfg.Display.Location)
+	}
+	return printJSON(changes)
+}
+
+// runMigrate brings the database schema up to date
+func runMigrate(ctx context.Context, cfg *models.AppConfig) error {
+	db, err := utils.OpenDB(cfg)
+	if err != nil {
+		return err
+	}
+	if cfg.Database.Dialect != models.DatabaseDialectPostgres {
+		err = repo.NewSQLProductRepository(db, repo.Dialect(cfg.Database.Dialect)).EnsureSchema(ctx)
+	} else {
+		err = repo.NewProductRepositoryFromConfig(db, cfg.Database).EnsureSchema(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "The database schema is up to date")
+	return nil
+}
+
+// runReindexSearch backfills the full-text search vectors of products
+func runReindexSearch(ctx context.Context, cfg *models.AppConfig, args []string) error {
+	fs := flag.NewFlagSet("reindex-search", flag.ExitOnError)
+	all := fs.Bool("all", false, "rebuild the search vector of every product")
+	fs.Parse(args)
+
+	db, err := utils.OpenDB(cfg)
+	if err != nil {
+		return err
+	}
+	updated, err := repo.NewProductRepositoryFromConfig(db, cfg.Database).RefreshSearchVectors(ctx, *all)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Reindexed %d products\n", updated)
+	return nil
+}
+
+// runRepairHandles regenerates the handles that don't follow the current
+// handle rules, listing the repairs and writing them with -apply
+func runRepairHandles(ctx context.Context, cfg *models.AppConfig, args []string) error {
+	fs := flag.NewFlagSet("repair-handles", flag.ExitOnError)
+	apply := fs.Bool("apply", false, "write the regenerated handles")
+	ensureIndex := fs.Bool("ensure-index", false, "create the unique handle index after applying the repairs")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	fs.Parse(args)
+
+	db, err := utils.OpenDB(cfg)
+	if err != nil {
+		return err
+	}
+	productRepo := repo.NewProductRepositoryFromConfig(db, cfg.Database)
+	report, err := repo.RepairHandles(ctx, productRepo, *apply)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		if err := printJSON(report); err != nil {
+			return err
+		}
+	} else {
+		for _, r := range report.Repairs {
+			fmt.Printf("%d\t%s\t%s\t%s\t%s\n", r.ProductID, r.Reason, r.OldHandle, r.NewHandle, r.Title)
+		}
+	}
+	if !*apply {
+		fmt.Fprintf(os.Stderr, "%d of %d handles to repair (re-run with -apply to write them)\n", len(report.Repairs), report.Scanned)
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "Repaired %d of %d handles\n", report.Applied, report.Scanned)
+
+	changes := make([]models.ProductChange, 0, len(report.Repairs))
+	for _, r := range report.Repairs {
+		changes = append(changes, models.ProductChange{ProductID: r.ProductID, Action: models.ChangeActionUpdate,
+			OldTitle: r.Title, OldHandle: r.OldHandle, NewTitle: r.Title, NewHandle: r.NewHandle})
+	}
+	audit := repo.NewAuditRepository(db)
+	audit.SetTable(cfg.Database.Schema, cfg.Database.ProductsTable)
+	if err := audit.RecordChanges(ctx, changes); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+
+	if *ensureIndex {
+		if err := productRepo.EnsureHandleIndex(ctx); err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, "Unique handle index in place")
+	}
+	return nil
+}
+
+// runBench measures the product write throughput of the configured database per batch size
+func runBench(ctx context.Context, cfg *models.AppConfig, args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	sizes := fs.String("sizes", "100,500,1000,2500", "comma-separated batch sizes to measure")
+	rows := fs.Int("rows", 2000, "synthetic products written at every batch size")
+	workers := fs.Int("workers", cfg.Sync.UpdateWorkers, "update chunks applied at once")
+	asJSON := fs.Bool("json", false, "print the results as JSON")
+	fs.Parse(args)
+
+	opts := repo.BenchOptions{Rows: *rows, Workers: *workers}
+	for _, s := range strings.Split(*sizes, ",") {
+		size, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || size <= 0 {
+			return fmt.Errorf("invalid batch size %q", s)
+		}
+		opts.Sizes = append(opts.Sizes, size)
+	}
+	if opts.Rows <= 0 {
+		return fmt.Errorf("-rows must be positive, got %d", opts.Rows)
+	}
+	if cfg.Database.Dialect != models.DatabaseDialectPostgres {
+		return fmt.Errorf("bench measures the batched Postgres writes, not the %s dialect", cfg.Database.Dialect)
+	}
+
+	db, err := utils.OpenDB(cfg)
+	if err != nil {
+		return err
+	}
+	products := repo.NewProductRepositoryFromConfig(db, cfg.Database)
+	products.SetBatchTimeout(cfg.Sync.BatchTimeout)
+	var writer repo.ProductRepositoryInterface = products
+	if cfg.Database.Driver == models.DatabaseDriverPgx {
+		pool, err := utils.PgxPool(cfg)
+		if err != nil {
+			return err
+		}
+		writer = repo.NewPgxProductRepository(products, pool)
+	}
+
+	results, err := repo.BenchmarkBatchSizes(ctx, products, writer, opts)
+	if *asJSON {
+		if printErr := printJSON(results); printErr != nil {
+			return printErr
+		}
+	} else {
+		fmt.Println("batch\trows\tinsert ms\tinsert rows/s\tupdate ms\tupdate rows/s")
+		for _, r := range results {
+			fmt.Printf("%d\t%d\t%d\t%.0f\t%d\t%.0f\n", r.BatchSize, r.Rows, r.InsertMs, r.InsertRowsPerSec, r.UpdateMs, r.UpdateRowsPerSec)
+		}
+	}
+	return err
+}
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,21 @@
+// Command lambda runs the sync trigger as an AWS Lambda function on a custom
+// runtime (provided.al2023). Build it as the bootstrap of the function:
+//
+//	GOOS=linux GOARCH=arm64 go build -o bootstrap ./cmd/lambda
+//
+// HTTP events of a function URL or API Gateway are served like requests to
+// /api/index on Vercel; EventBridge schedules run a sync with the configuration.
+package main
+
+import (
+	"context"
+	"log"
+
+	"go-cron/runner"
+)
+
+func main() {
+	if err := runner.New().StartLambda(context.Background()); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -1,34 +1,458 @@
 package config
 
 import (
+	"encoding/json"
+	"fmt"
 	"go-cron/models"
 	"os"
+	"strconv"
+	"strings"
 	"time"
+
+	// Embed the timezone database, serverless images do not ship one
+	_ "time/tzdata"
 )
 
+// LoadConfig reads the configuration from the file named by GO_CRON_CONFIG, if
+// any, with environment variables taking precedence over the file. Values that
+// cannot be parsed fall back to their default and are reported by cfg.Validate().
 func LoadConfig() *models.AppConfig {
+	l := &loader{}
+	l.loadFile(os.Getenv("GO_CRON_CONFIG"))
+	return l.load()
+}
+
+// load reads every setting with l
+func (l *loader) load() *models.AppConfig {
 	cfg := &models.AppConfig{
 		ServerPort: 3000,
 		Database: models.DatabaseConfig{
-			DatabaseURI:     os.Getenv("DATABASE_URL"),
-			MaxOpenConns:    10,
-			MaxIdleConns:    5,
-			ConnMaxLifetime: 10 * time.Minute,
+			DatabaseURI:      l.string("DATABASE_URL", ""),
+			MaxOpenConns:     10,
+			MaxIdleConns:     5,
+			ConnMaxLifetime:  10 * time.Minute,
+			Driver:           l.string("DATABASE_DRIVER", models.DatabaseDriverPQ),
+			Dialect:          l.string("DATABASE_DIALECT", models.DatabaseDialectPostgres),
+			AutoCreateSchema: l.bool("AUTO_CREATE_SCHEMA", false),
+			Schema:           l.string("DATABASE_SCHEMA", ""),
+			ProductsTable:    l.string("DATABASE_PRODUCTS_TABLE", ""),
 		},
 		Auth: models.AuthConfig{
-			CRONSecret: os.Getenv("CRON_SECRET"),
+			CRONSecret:         l.string("CRON_SECRET", ""),
+			PreviousSecrets:    l.strings("CRON_PREVIOUS_SECRETS", nil),
+			Scheme:             l.string("AUTH_SCHEME", models.AuthSchemeBearer),
+			SignatureTolerance: l.duration("AUTH_SIGNATURE_TOLERANCE", 5*time.Minute),
+			AllowedIPs:         l.strings("AUTH_ALLOWED_IPS", nil),
+			TrustedProxies:     l.int("AUTH_TRUSTED_PROXIES", 0),
+			AdminSecret:        l.string("ADMIN_SECRET", ""),
 		},
 		ExternalAPI: models.ExternalApiConfig{
 			LoginURL:       "/Login",
 			ItemsURL:       "/Items",
-			ExternalAPIURL: os.Getenv("EXTERNAL_API_URL"),
-			Filter:         "?$select=ItemCode,ItemName,ItemsGroupCode&$filter=ItemsGroupCode eq 100 or ItemsGroupCode eq 101 or ItemsGroupCode eq 121 or ItemsGroupCode eq 118&$orderby=ItemCode",
+			ExternalAPIURL: l.string("EXTERNAL_API_URL", ""),
+			Filter:         l.string("ITEMS_FILTER", ""),
+			GroupCodes:     l.ints("ITEMS_GROUP_CODES", []int{100, 101, 121}),
+			PriceList:      l.int("ITEMS_PRICE_LIST", 0),
+			Timeout:        l.duration("EXTERNAL_API_TIMEOUT", time.Minute),
+			LoginTimeout:   l.duration("EXTERNAL_API_LOGIN_TIMEOUT", 30*time.Second),
+			FetchTimeout:   l.duration("EXTERNAL_API_FETCH_TIMEOUT", 3*time.Minute),
+			Preflight:      l.bool("EXTERNAL_API_PREFLIGHT", false),
+			BackoffBase:    l.duration("EXTERNAL_API_BACKOFF_BASE", time.Minute),
+			BackoffMax:     l.duration("EXTERNAL_API_BACKOFF_MAX", 30*time.Minute),
+			Breaker:        l.int("EXTERNAL_API_BREAKER_THRESHOLD", 5),
+			Headers:        l.strings("EXTERNAL_API_HEADERS", nil),
+			TLS: models.TLSConfig{
+				InsecureSkipVerify: l.bool("EXTERNAL_API_TLS_INSECURE", true),
+				CAFile:             l.string("EXTERNAL_API_CA_FILE", ""),
+			},
+			Transport: models.TransportConfig{
+				HTTP2:                 l.bool("EXTERNAL_API_HTTP2", false),
+				MaxConnsPerHost:       l.int("EXTERNAL_API_MAX_CONNS_PER_HOST", 0),
+				IdleConnTimeout:       l.duration("EXTERNAL_API_IDLE_CONN_TIMEOUT", 90*time.Second),
+				MaxIdleConnsPerHost:   l.int("EXTERNAL_API_MAX_IDLE_CONNS_PER_HOST", 0),
+				DialTimeout:           l.duration("EXTERNAL_API_DIAL_TIMEOUT", 10*time.Second),
+				TLSHandshakeTimeout:   l.duration("EXTERNAL_API_TLS_HANDSHAKE_TIMEOUT", 10*time.Second),
+				ResponseHeaderTimeout: l.duration("EXTERNAL_API_RESPONSE_HEADER_TIMEOUT", 0),
+				ProxyURL:              l.string("EXTERNAL_API_PROXY_URL", ""),
+			},
+			Recording: models.RecordingConfig{
+				Mode:    l.string("EXTERNAL_API_RECORD", models.RecordingOff),
+				Dir:     l.string("EXTERNAL_API_RECORD_DIR", ""),
+				Size:    l.int("EXTERNAL_API_RECORD_SIZE", 200),
+				MaxBody: l.int("EXTERNAL_API_RECORD_MAX_BODY", 64<<10),
+			},
+			PageSize:          l.int("PAGE_SIZE", 20),
+			NumWorkers:        l.int("NUM_WORKERS", 2),
+			SlowPageThreshold: l.duration("EXTERNAL_API_SLOW_PAGE", 10*time.Second),
+			Pagination:        l.string("PAGINATION_MODE", models.PaginationSkip),
+			MaxPageSize:       l.int("EXTERNAL_API_MAX_PAGE_SIZE", 0),
+			BatchPages:        l.int("EXTERNAL_API_BATCH_PAGES", 10),
+		},
+		Source: models.SourceConfig{
+			Kind:    l.string("SYNC_SOURCE", models.SourceSAP),
+			CSVFile: l.string("SOURCE_CSV_FILE", ""),
 		},
 		ExternalAuth: models.ExternalAuthConfig{
-			CompanyDB: os.Getenv("COMPANY_DB"),
-			UserName:  os.Getenv("USER_NAME"),
-			Password:  os.Getenv("PASSWORD"),
+			CompanyDB: l.string("COMPANY_DB", ""),
+			UserName:  l.string("USER_NAME", ""),
+			Password:  l.string("PASSWORD", ""),
+			Secondary: models.Credentials{
+				CompanyDB: l.string("SECONDARY_COMPANY_DB", ""),
+				UserName:  l.string("SECONDARY_USER_NAME", ""),
+				Password:  l.string("SECONDARY_PASSWORD", ""),
+			},
+			CredentialsFile:  l.string("CREDENTIALS_FILE", ""),
+			CredentialsURL:   l.string("CREDENTIALS_URL", ""),
+			CredentialsToken: l.string("CREDENTIALS_TOKEN", ""),
+		},
+		Sinks: models.SinksConfig{
+			IDMapCacheSize:     l.int("ID_MAP_CACHE_SIZE", 1000),
+			WebhookURL:         l.string("SINK_WEBHOOK_URL", ""),
+			WebhookSecret:      l.string("SINK_WEBHOOK_SECRET", ""),
+			ShopifyShop:        l.string("SHOPIFY_SHOP", ""),
+			ShopifyAccessToken: l.string("SHOPIFY_ACCESS_TOKEN", ""),
+			ShopifyAPIVersion:  l.string("SHOPIFY_API_VERSION", "2025-01"),
+			ShopifyRateLimit:   l.float("SHOPIFY_RATE_LIMIT", 2),
+			Destinations:       l.strings("SINK_DESTINATIONS", nil),
+		},
+		Anomaly: models.AnomalyConfig{
+			Factor:   l.float("ANOMALY_FACTOR", 10),
+			MinDelta: l.int("ANOMALY_MIN_DELTA", 50),
+		},
+		Display: l.displayConfig(l.string("DISPLAY_TIMEZONE", ""), l.string("DISPLAY_LOCALE", "en")),
+		Notify: models.NotifyConfig{
+			SlackWebhookURL: l.string("NOTIFY_SLACK_WEBHOOK_URL", ""),
+			WebhookURL:      l.string("NOTIFY_WEBHOOK_URL", ""),
+			WebhookSecret:   l.string("NOTIFY_WEBHOOK_SECRET", ""),
+			Templates: map[string]string{
+				models.ChannelSlack:   l.string("NOTIFY_TEMPLATE_SLACK", ""),
+				models.ChannelWebhook: l.string("NOTIFY_TEMPLATE_WEBHOOK", ""),
+				models.ChannelEmail:   l.string("NOTIFY_TEMPLATE_EMAIL", ""),
+			},
+			TemplatesFromDB: l.bool("NOTIFY_TEMPLATES_FROM_DB", false),
+			Routes:          l.notifyRoutes(l.string("NOTIFY_ROUTES", "")),
+			DiffLinkBaseURL: strings.TrimSuffix(l.string("NOTIFY_DIFF_LINK_BASE_URL", ""), "/"),
+			DiffLinkTTL:     l.duration("NOTIFY_DIFF_LINK_TTL", 30*24*time.Hour),
+			Email: models.EmailConfig{
+				SMTPHost:       l.string("NOTIFY_SMTP_HOST", ""),
+				SMTPPort:       l.int("NOTIFY_SMTP_PORT", 587),
+				Username:       l.string("NOTIFY_SMTP_USERNAME", ""),
+				Password:       l.string("NOTIFY_SMTP_PASSWORD", ""),
+				From:           l.string("NOTIFY_EMAIL_FROM", ""),
+				To:             l.strings("NOTIFY_EMAIL_TO", nil),
+				ErrorThreshold: l.int("NOTIFY_EMAIL_ERROR_THRESHOLD", 0),
+			},
+		},
+		Sync: models.SyncConfig{
+			Writes:            l.bool("SYNC_WRITES", false),
+			LookupBatchSize:   l.int("PRODUCT_LOOKUP_BATCH_SIZE", 500),
+			ProductCacheTTL:   l.duration("PRODUCT_CACHE_TTL", 0),
+			FreshnessMaxAge:   l.duration("FRESHNESS_MAX_AGE", 32*24*time.Hour),
+			UpdateChunkSize:   l.int("UPDATE_CHUNK_SIZE", 500),
+			UpdateWorkers:     l.int("UPDATE_WORKERS", 4),
+			CreateChunkSize:   l.int("CREATE_CHUNK_SIZE", 500),
+			IsolateFailedRows: l.bool("SYNC_ISOLATE_FAILED_ROWS", false),
+			MinFeedRatio:      l.float("SYNC_MIN_FEED_RATIO", 0.5),
+			Timeout:           l.duration("SYNC_TIMEOUT", 5*time.Minute),
+			BatchTimeout:      l.duration("SYNC_BATCH_TIMEOUT", 30*time.Second),
+			JobBaseURL:        strings.TrimSuffix(l.string("JOB_BASE_URL", vercelURL()), "/"),
+			IdempotencyTTL:    l.duration("IDEMPOTENCY_TTL", 24*time.Hour),
+			StatusCacheTTL:    l.duration("STATUS_CACHE_TTL", 30*time.Second),
+			PriorityItems:     l.strings("SYNC_PRIORITY_ITEMS", nil),
+			PriorityFromDB:    l.bool("SYNC_PRIORITY_FROM_DB", false),
+			PriorityLimit:     l.int("SYNC_PRIORITY_LIMIT", 200),
+			Incremental:       l.bool("SYNC_INCREMENTAL", false),
+			FullSyncEvery:     l.duration("SYNC_FULL_EVERY", 7*24*time.Hour),
+			Shards:            l.int("SYNC_SHARDS", 1),
+			PartitionByGroup:  l.bool("SYNC_PARTITION_BY_GROUP", false),
+			PartitionWorkers:  l.int("SYNC_PARTITION_WORKERS", 2),
+			TitleRules:        l.strings("TITLE_NORMALIZE_RULES", []string{models.TitleRuleTrim, models.TitleRuleLower}),
+			VendorPrefixes:    l.strings("TITLE_VENDOR_PREFIXES", nil),
+			Categories:        l.categories("CATEGORY_MAP"),
+			FieldMapping:      l.fieldMapping(l.string("SYNC_FIELD_MAPPING", "")),
+			CategoriesFromDB:  l.bool("CATEGORIES_FROM_DB", false),
+			Duplicates:        l.string("SYNC_DUPLICATES", models.DuplicatesReport),
+			CaseSensitive:     l.bool("SYNC_CASE_SENSITIVE", false),
+			UpdateHandles:     l.bool("SYNC_UPDATE_HANDLES", true),
+			DeleteMissing:     l.bool("SYNC_DELETE_MISSING", false),
+			DeleteAfterRuns:   l.int("SYNC_DELETE_AFTER_RUNS", 0),
+			MaxErrors:         l.int("SYNC_MAX_ERRORS", 0),
+			MaxChangeRatio:    l.float("SYNC_MAX_CHANGE_RATIO", 0),
+			MaxUpdateRatio:    l.float("SYNC_MAX_UPDATE_RATIO", 0),
+			RequireApproval:   l.bool("SYNC_REQUIRE_APPROVAL", false),
+			PlanTTL:           l.duration("SYNC_PLAN_TTL", time.Hour),
+			VerifyWrites:      l.bool("SYNC_VERIFY_WRITES", false),
+			VerifySample:      l.int("SYNC_VERIFY_SAMPLE", 100),
+			ItemRules: models.ItemRules{
+				IncludeCodes:       l.strings("SYNC_INCLUDE_CODES", nil),
+				ExcludeCodes:       l.strings("SYNC_EXCLUDE_CODES", nil),
+				IncludePrefixes:    l.strings("SYNC_INCLUDE_PREFIXES", nil),
+				ExcludePrefixes:    l.strings("SYNC_EXCLUDE_PREFIXES", nil),
+				IncludeNamePattern: l.string("SYNC_INCLUDE_NAME_PATTERN", ""),
+				ExcludeNamePattern: l.string("SYNC_EXCLUDE_NAME_PATTERN", ""),
+			},
+		},
+		Sanitize: models.SanitizeConfig{
+			Enabled:           l.bool("SANITIZE_TEXT", false),
+			MaxLength:         l.int("SANITIZE_MAX_LENGTH", 255),
+			KeepRaw:           l.bool("SANITIZE_KEEP_RAW", false),
+			TitleSteps:        l.strings("SANITIZE_TITLE_STEPS", nil),
+			TitleReplacements: l.titleReplacements(l.string("SANITIZE_TITLE_REPLACEMENTS", "")),
+			TitleSuffixes:     l.strings("SANITIZE_TITLE_SUFFIXES", nil),
+		},
+		Images: models.ImagesConfig{
+			Enabled:  l.bool("SYNC_IMAGES", false),
+			BaseURL:  l.string("IMAGES_BASE_URL", ""),
+			Download: l.bool("IMAGES_DOWNLOAD", false),
+			Workers:  l.int("IMAGES_DOWNLOAD_WORKERS", 4),
+			MaxBytes: int64(l.int("IMAGES_MAX_BYTES", 5<<20)),
+		},
+		Tracing: models.TracingConfig{
+			Endpoint:    l.string("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+			Headers:     l.strings("OTEL_EXPORTER_OTLP_HEADERS", nil),
+			ServiceName: l.string("OTEL_SERVICE_NAME", "go-cron"),
+			Timeout:     l.duration("OTEL_EXPORTER_OTLP_TIMEOUT", 10*time.Second),
 		},
 	}
+	cfg.Profile = l.profile
+	cfg.LoadErrors = l.errs
+	cfg.Settings = l.effective
 	return cfg
 }
+
+// loader reads typed settings from the named profile, the environment, then
+// the config file, collecting the ones it could not parse
+type loader struct {
+	file      map[string]string
+	errs      []models.FieldError
+	effective map[string]string
+	// profiles are the settings of the named profiles of the config file
+	profiles map[string]map[string]string
+	// profile is the named profile applied and named its settings
+	profile string
+	named   map[string]string
+}
+
+// vercelURL returns the URL of the Vercel deployment, from VERCEL_URL, or ""
+// outside Vercel
+func vercelURL() string {
+	if host := os.Getenv("VERCEL_URL"); host != "" {
+		return "https://" + host
+	}
+	return ""
+}
+
+// record keeps the effective value of a setting, in the format of its environment variable
+func (l *loader) record(key, value string) {
+	if l.effective == nil {
+		l.effective = make(map[string]string)
+	}
+	l.effective[key] = value
+}
+
+// lookup returns the raw value of a setting and whether it is set
+func (l *loader) lookup(key string) (string, bool) {
+	if v := l.named[key]; v != "" {
+		return v, true
+	}
+	if v := os.Getenv(key); v != "" {
+		return v, true
+	}
+	v, ok := l.file[key]
+	return v, ok && v != ""
+}
+
+// fail records an unparseable environment variable
+func (l *loader) fail(key, format string, args ...interface{}) {
+	l.errs = append(l.errs, models.FieldError{Field: key, Message: fmt.Sprintf(format, args...)})
+}
+
+// string reads a string setting, falling back to def when unset
+func (l *loader) string(key, def string) string {
+	v, ok := l.lookup(key)
+	if !ok {
+		v = def
+	}
+	l.record(key, v)
+	return v
+}
+
+// bool reads a boolean setting, falling back to def when unset or invalid
+func (l *loader) bool(key string, def bool) bool {
+	raw, ok := l.lookup(key)
+	if !ok {
+		l.record(key, strconv.FormatBool(def))
+		return def
+	}
+	l.record(key, raw)
+	v, err := strconv.ParseBool(raw)
+	if err != nil {
+		l.fail(key, "%q is not a boolean", raw)
+		return def
+	}
+	return v
+}
+
+// ints reads a comma-separated list of integers, falling back to def when unset or invalid
+func (l *loader) ints(key string, def []int) []int {
+	raw, ok := l.lookup(key)
+	if !ok {
+		parts := make([]string, len(def))
+		for i, v := range def {
+			parts[i] = strconv.Itoa(v)
+		}
+		l.record(key, strings.Join(parts, ","))
+		return def
+	}
+	l.record(key, raw)
+	var values []int
+	for _, part := range strings.Split(raw, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			l.fail(key, "%q is not a comma-separated list of integers", raw)
+			return def
+		}
+		values = append(values, v)
+	}
+	return values
+}
+
+// strings reads a comma-separated list of strings, dropping empty entries,
+// falling back to def when unset
+func (l *loader) strings(key string, def []string) []string {
+	raw, ok := l.lookup(key)
+	if !ok {
+		l.record(key, strings.Join(def, ","))
+		return def
+	}
+	l.record(key, raw)
+	var values []string
+	for _, part := range strings.Split(raw, ",") {
+		if v := strings.TrimSpace(part); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// int reads an integer setting, falling back to def when unset or invalid
+func (l *loader) int(key string, def int) int {
+	raw, ok := l.lookup(key)
+	if !ok {
+		l.record(key, strconv.Itoa(def))
+		return def
+	}
+	l.record(key, raw)
+	v, err := strconv.Atoi(raw)
+	if err != nil {
+		l.fail(key, "%q is not an integer", raw)
+		return def
+	}
+	return v
+}
+
+// float reads a float setting, falling back to def when unset or invalid
+func (l *loader) float(key string, def float64) float64 {
+	raw, ok := l.lookup(key)
+	if !ok {
+		l.record(key, strconv.FormatFloat(def, 'g', -1, 64))
+		return def
+	}
+	l.record(key, raw)
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		l.fail(key, "%q is not a number", raw)
+		return def
+	}
+	return v
+}
+
+// displayConfig resolves the display timezone, falling back to UTC when unset or unknown
+func (l *loader) displayConfig(timezone, locale string) models.DisplayConfig {
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		l.fail("DISPLAY_TIMEZONE", "unknown timezone %q", timezone)
+		timezone, loc = "UTC", time.UTC
+	}
+	return models.DisplayConfig{Timezone: timezone, Location: loc, Locale: locale}
+}
+
+// notifyRoutes parses the JSON list of notification routes, ignoring it when invalid
+func (l *loader) notifyRoutes(raw string) []models.NotifyRoute {
+	if raw == "" {
+		return nil
+	}
+	var routes []models.NotifyRoute
+	if err := json.Unmarshal([]byte(raw), &routes); err != nil {
+		l.fail("NOTIFY_ROUTES", "invalid JSON: %v", err)
+		return nil
+	}
+	return routes
+}
+
+// titleReplacements parses the JSON list of title replacements, ignoring it when invalid
+func (l *loader) titleReplacements(raw string) []models.TitleReplacement {
+	if raw == "" {
+		return nil
+	}
+	var replacements []models.TitleReplacement
+	if err := json.Unmarshal([]byte(raw), &replacements); err != nil {
+		l.fail("SANITIZE_TITLE_REPLACEMENTS", "invalid JSON: %v", err)
+		return nil
+	}
+	return replacements
+}
+
+// fieldMapping parses the JSON object of targets to item fields or
+// templates, ignoring it when invalid
+func (l *loader) fieldMapping(raw string) map[string]string {
+	if raw == "" {
+		return nil
+	}
+	var mapping map[string]string
+	if err := json.Unmarshal([]byte(raw), &mapping); err != nil {
+		l.fail("SYNC_FIELD_MAPPING", "invalid JSON: %v", err)
+		return nil
+	}
+	return mapping
+}
+
+// categories reads a comma-separated list of group code=category pairs,
+// e.g. "100=Beverages,101=Tea"
+func (l *loader) categories(key string) map[int]string {
+	raw, ok := l.lookup(key)
+	l.record(key, raw)
+	if !ok || raw == "" {
+		return nil
+	}
+	categories := make(map[int]string)
+	for _, pair := range strings.Split(raw, ",") {
+		code, category, found := strings.Cut(pair, "=")
+		group, err := strconv.Atoi(strings.TrimSpace(code))
+		if !found || err != nil || strings.TrimSpace(category) == "" {
+			l.fail(key, "%q is not a comma-separated list of code=category pairs", raw)
+			return nil
+		}
+		categories[group] = strings.TrimSpace(category)
+	}
+	return categories
+}
+
+// duration reads a duration setting, falling back to def when unset or invalid
+func (l *loader) duration(key string, def time.Duration) time.Duration {
+	raw, ok := l.lookup(key)
+	if !ok {
+		l.record(key, def.String())
+		return def
+	}
+	l.record(key, raw)
+	v, err := time.ParseDuration(raw)
+	if err != nil {
+		l.fail(key, "%q is not a duration (e.g. 90m, 24h)", raw)
+		return def
+	}
+	return v
+}
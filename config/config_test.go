@@ -0,0 +1,168 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go-cron/models"
+)
+
+// setValidEnv sets the minimal environment for a valid configuration
+func setValidEnv(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://localhost/gocron")
+	t.Setenv("CRON_SECRET", "secret")
+	t.Setenv("EXTERNAL_API_URL", "https://sap.example.com/b1s/v1")
+}
+
+// Test_LoadConfig_Valid tests that the defaults plus the required settings validate
+func Test_LoadConfig_Valid(t *testing.T) {
+	setValidEnv(t)
+
+	if err := LoadConfig().Validate(); err != nil {
+		t.Errorf("Expected a valid configuration, got %v", err)
+	}
+}
+
+// Test_LoadConfig_JobBaseURL tests that async jobs are started at the Vercel
+// deployment unless JOB_BASE_URL names another one
+func Test_LoadConfig_JobBaseURL(t *testing.T) {
+	setValidEnv(t)
+	t.Setenv("VERCEL_URL", "go-cron-abc.vercel.app")
+	if got := LoadConfig().Sync.JobBaseURL; got != "https://go-cron-abc.vercel.app" {
+		t.Errorf("Expected the Vercel deployment, got %q", got)
+	}
+	t.Setenv("JOB_BASE_URL", "https://sync.example.com/")
+	if got := LoadConfig().Sync.JobBaseURL; got != "https://sync.example.com" {
+		t.Errorf("Expected the configured URL, got %q", got)
+	}
+}
+
+// Test_LoadConfig_Invalid tests that every problem is reported with its setting name
+func Test_LoadConfig_Invalid(t *testing.T) {
+	setValidEnv(t)
+	t.Setenv("DATABASE_URL", "")
+	t.Setenv("CRON_SECRET", "")
+	t.Setenv("EXTERNAL_API_URL", "not a url")
+	t.Setenv("FRESHNESS_MAX_AGE", "a month")
+	t.Setenv("PAGE_SIZE", "0")
+	t.Setenv("UPDATE_WORKERS", "four")
+	t.Setenv("DISPLAY_TIMEZONE", "Mars/Olympus")
+	t.Setenv("NOTIFY_ROUTES", `[{"name":"ops","channel":"pager","url":"","digest":"weekly"}]`)
+	t.Setenv("SYNC_FIELD_MAPPING", `{"title":"{{.ItemName","price":"Price"}`)
+	t.Setenv("NOTIFY_SMTP_HOST", "smtp.example.com")
+	t.Setenv("NOTIFY_EMAIL_FROM", "go-cron")
+	t.Setenv("DATABASE_DIALECT", "oracle")
+	t.Setenv("SANITIZE_TITLE_STEPS", "strip_brackets,shout")
+	t.Setenv("EXTERNAL_API_PROXY_URL", "proxy.internal:3128")
+	t.Setenv("EXTERNAL_API_HEADERS", "X-Api-Key")
+	t.Setenv("DATABASE_SCHEMA", "Catalog; DROP")
+	t.Setenv("SYNC_DELETE_AFTER_RUNS", "-1")
+	t.Setenv("CREDENTIALS_URL", "vault.internal/sap")
+
+	err := LoadConfig().Validate()
+
+	var validationErr *models.ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected a *models.ValidationError, got %v", err)
+	}
+
+	fields := make(map[string]int)
+	for _, fe := range validationErr.Errors {
+		fields[fe.Field]++
+	}
+	for _, field := range []string{"DATABASE_URL", "CRON_SECRET", "EXTERNAL_API_URL", "FRESHNESS_MAX_AGE", "PAGE_SIZE", "UPDATE_WORKERS", "DISPLAY_TIMEZONE", "NOTIFY_EMAIL_FROM", "NOTIFY_EMAIL_TO", "DATABASE_DIALECT", "SANITIZE_TITLE_STEPS", "EXTERNAL_API_PROXY_URL", "EXTERNAL_API_HEADERS", "DATABASE_SCHEMA", "SYNC_DELETE_AFTER_RUNS", "CREDENTIALS_URL"} {
+		if fields[field] != 1 {
+			t.Errorf("Expected one error for %s, got %d (%v)", field, fields[field], err)
+		}
+	}
+	if fields["SYNC_FIELD_MAPPING"] != 2 {
+		t.Errorf("Expected template and target errors for the field mapping, got %d (%v)", fields["SYNC_FIELD_MAPPING"], err)
+	}
+	if fields["NOTIFY_ROUTES[0]"] != 3 {
+		t.Errorf("Expected channel, url and digest errors for the route, got %d (%v)", fields["NOTIFY_ROUTES[0]"], err)
+	}
+}
+
+// writeConfigFile writes content to a temporary config file and points GO_CRON_CONFIG at it
+func writeConfigFile(t *testing.T, name, content string) {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	t.Setenv("GO_CRON_CONFIG", path)
+}
+
+// Test_LoadConfig_YAMLFile tests that file values apply and environment variables override them
+func Test_LoadConfig_YAMLFile(t *testing.T) {
+	setValidEnv(t)
+	t.Setenv("NUM_WORKERS", "8")
+	writeConfigFile(t, "config.yaml", `
+externalApi:
+  numWorkers: 3
+  pageSize: 50
+  groupCodes: [100, 118]
+  timeout: 45s
+  tls:
+    insecureSkipVerify: false
+sync:
+  freshnessMaxAge: 72h
+  categories:
+    100: Beverages
+    101: Tea
+  fieldMapping:
+    title: "{{.ItemName}} ({{.ItemCode}})"
+notify:
+  routes:
+    - name: failures
+      channel: slack
+      url: https://hooks.example.com/x
+      outcomes: [failed]
+`)
+
+	cfg := LoadConfig()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Expected a valid configuration, got %v", err)
+	}
+
+	if cfg.ExternalAPI.NumWorkers != 8 {
+		t.Errorf("Expected the environment to override the file, got %d workers", cfg.ExternalAPI.NumWorkers)
+	}
+	if cfg.ExternalAPI.PageSize != 50 || cfg.ExternalAPI.Timeout != 45*time.Second || cfg.ExternalAPI.TLS.InsecureSkipVerify {
+		t.Errorf("File values not applied: %+v", cfg.ExternalAPI)
+	}
+	if len(cfg.ExternalAPI.GroupCodes) != 2 || cfg.ExternalAPI.GroupCodes[1] != 118 {
+		t.Errorf("Expected group codes [100 118], got %v", cfg.ExternalAPI.GroupCodes)
+	}
+	if cfg.Sync.FreshnessMaxAge != 72*time.Hour {
+		t.Errorf("Expected freshness max age 72h, got %s", cfg.Sync.FreshnessMaxAge)
+	}
+	if len(cfg.Sync.Categories) != 2 || cfg.Sync.Categories[101] != "Tea" {
+		t.Errorf("Expected the category map from the file, got %v", cfg.Sync.Categories)
+	}
+	if cfg.Sync.FieldMapping["title"] != "{{.ItemName}} ({{.ItemCode}})" {
+		t.Errorf("Expected the field mapping from the file, got %v", cfg.Sync.FieldMapping)
+	}
+	if len(cfg.Notify.Routes) != 1 || cfg.Notify.Routes[0].Outcomes[0] != "failed" {
+		t.Errorf("Expected the notification route from the file, got %+v", cfg.Notify.Routes)
+	}
+}
+
+// Test_LoadConfig_JSONFile tests JSON files and the reporting of unknown keys
+func Test_LoadConfig_JSONFile(t *testing.T) {
+	setValidEnv(t)
+	writeConfigFile(t, "config.json", `{"externalApi": {"pageSize": 10, "numWorkes": 4}}`)
+
+	cfg := LoadConfig()
+	if cfg.ExternalAPI.PageSize != 10 {
+		t.Errorf("Expected page size 10 from the file, got %d", cfg.ExternalAPI.PageSize)
+	}
+
+	err := cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "externalApi.numWorkes") {
+		t.Errorf("Expected the misspelled key to be reported, got %v", err)
+	}
+}
@@ -0,0 +1,324 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fileKeys maps the dotted keys of the config file to the environment
+// variable overriding them. Every setting keeps a single name in errors.
+var fileKeys = map[string]string{
+	"database.url":            "DATABASE_URL",
+	"database.driver":         "DATABASE_DRIVER",
+	"database.dialect":        "DATABASE_DIALECT",
+	"database.createSchema":   "AUTO_CREATE_SCHEMA",
+	"database.schema":         "DATABASE_SCHEMA",
+	"database.productsTable":  "DATABASE_PRODUCTS_TABLE",
+	"auth.cronSecret":         "CRON_SECRET",
+	"auth.previousSecrets":    "CRON_PREVIOUS_SECRETS",
+	"auth.scheme":             "AUTH_SCHEME",
+	"auth.signatureTolerance": "AUTH_SIGNATURE_TOLERANCE",
+	"auth.allowedIps":         "AUTH_ALLOWED_IPS",
+	"auth.trustedProxies":     "AUTH_TRUSTED_PROXIES",
+	"auth.adminSecret":        "ADMIN_SECRET",
+
+	"externalApi.url":                             "EXTERNAL_API_URL",
+	"externalApi.companyDb":                       "COMPANY_DB",
+	"externalApi.userName":                        "USER_NAME",
+	"externalApi.password":                        "PASSWORD",
+	"externalApi.secondaryCompanyDb":              "SECONDARY_COMPANY_DB",
+	"externalApi.secondaryUserName":               "SECONDARY_USER_NAME",
+	"externalApi.secondaryPassword":               "SECONDARY_PASSWORD",
+	"externalApi.credentialsFile":                 "CREDENTIALS_FILE",
+	"externalApi.credentialsUrl":                  "CREDENTIALS_URL",
+	"externalApi.credentialsToken":                "CREDENTIALS_TOKEN",
+	"externalApi.pageSize":                        "PAGE_SIZE",
+	"externalApi.numWorkers":                      "NUM_WORKERS",
+	"externalApi.slowPage":                        "EXTERNAL_API_SLOW_PAGE",
+	"externalApi.pagination":                      "PAGINATION_MODE",
+	"externalApi.maxPageSize":                     "EXTERNAL_API_MAX_PAGE_SIZE",
+	"externalApi.batchPages":                      "EXTERNAL_API_BATCH_PAGES",
+	"externalApi.filter":                          "ITEMS_FILTER",
+	"externalApi.groupCodes":                      "ITEMS_GROUP_CODES",
+	"externalApi.priceList":                       "ITEMS_PRICE_LIST",
+	"externalApi.timeout":                         "EXTERNAL_API_TIMEOUT",
+	"externalApi.headers":                         "EXTERNAL_API_HEADERS",
+	"externalApi.loginTimeout":                    "EXTERNAL_API_LOGIN_TIMEOUT",
+	"externalApi.fetchTimeout":                    "EXTERNAL_API_FETCH_TIMEOUT",
+	"externalApi.preflight":                       "EXTERNAL_API_PREFLIGHT",
+	"externalApi.backoffBase":                     "EXTERNAL_API_BACKOFF_BASE",
+	"externalApi.backoffMax":                      "EXTERNAL_API_BACKOFF_MAX",
+	"externalApi.breakerThreshold":                "EXTERNAL_API_BREAKER_THRESHOLD",
+	"externalApi.tls.insecureSkipVerify":          "EXTERNAL_API_TLS_INSECURE",
+	"externalApi.tls.caFile":                      "EXTERNAL_API_CA_FILE",
+	"externalApi.transport.http2":                 "EXTERNAL_API_HTTP2",
+	"externalApi.transport.maxConnsPerHost":       "EXTERNAL_API_MAX_CONNS_PER_HOST",
+	"externalApi.transport.idleConnTimeout":       "EXTERNAL_API_IDLE_CONN_TIMEOUT",
+	"externalApi.transport.maxIdleConnsPerHost":   "EXTERNAL_API_MAX_IDLE_CONNS_PER_HOST",
+	"externalApi.transport.dialTimeout":           "EXTERNAL_API_DIAL_TIMEOUT",
+	"externalApi.transport.tlsHandshakeTimeout":   "EXTERNAL_API_TLS_HANDSHAKE_TIMEOUT",
+	"externalApi.transport.responseHeaderTimeout": "EXTERNAL_API_RESPONSE_HEADER_TIMEOUT",
+	"externalApi.transport.proxyUrl":              "EXTERNAL_API_PROXY_URL",
+	"externalApi.recording.mode":                  "EXTERNAL_API_RECORD",
+	"externalApi.recording.dir":                   "EXTERNAL_API_RECORD_DIR",
+	"externalApi.recording.size":                  "EXTERNAL_API_RECORD_SIZE",
+	"externalApi.recording.maxBody":               "EXTERNAL_API_RECORD_MAX_BODY",
+
+	"source.kind":    "SYNC_SOURCE",
+	"source.csvFile": "SOURCE_CSV_FILE",
+
+	"sync.writes":             "SYNC_WRITES",
+	"sync.timeout":            "SYNC_TIMEOUT",
+	"sync.batchTimeout":       "SYNC_BATCH_TIMEOUT",
+	"sync.jobBaseUrl":         "JOB_BASE_URL",
+	"sync.idempotencyTtl":     "IDEMPOTENCY_TTL",
+	"sync.statusCacheTtl":     "STATUS_CACHE_TTL",
+	"sync.priorityItems":      "SYNC_PRIORITY_ITEMS",
+	"sync.priorityFromDb":     "SYNC_PRIORITY_FROM_DB",
+	"sync.priorityLimit":      "SYNC_PRIORITY_LIMIT",
+	"sync.incremental":        "SYNC_INCREMENTAL",
+	"sync.fullSyncEvery":      "SYNC_FULL_EVERY",
+	"sync.shards":             "SYNC_SHARDS",
+	"sync.partitionByGroup":   "SYNC_PARTITION_BY_GROUP",
+	"sync.partitionWorkers":   "SYNC_PARTITION_WORKERS",
+	"sync.lookupBatchSize":    "PRODUCT_LOOKUP_BATCH_SIZE",
+	"sync.productCacheTtl":    "PRODUCT_CACHE_TTL",
+	"sync.freshnessMaxAge":    "FRESHNESS_MAX_AGE",
+	"sync.updateChunkSize":    "UPDATE_CHUNK_SIZE",
+	"sync.updateWorkers":      "UPDATE_WORKERS",
+	"sync.createChunkSize":    "CREATE_CHUNK_SIZE",
+	"sync.isolateFailedRows":  "SYNC_ISOLATE_FAILED_ROWS",
+	"sync.minFeedRatio":       "SYNC_MIN_FEED_RATIO",
+	"sync.titleRules":         "TITLE_NORMALIZE_RULES",
+	"sync.vendorPrefixes":     "TITLE_VENDOR_PREFIXES",
+	"sync.categories":         "CATEGORY_MAP",
+	"sync.fieldMapping":       "SYNC_FIELD_MAPPING",
+	"sync.categoriesFromDb":   "CATEGORIES_FROM_DB",
+	"sync.duplicates":         "SYNC_DUPLICATES",
+	"sync.caseSensitive":      "SYNC_CASE_SENSITIVE",
+	"sync.updateHandles":      "SYNC_UPDATE_HANDLES",
+	"sync.deleteMissing":      "SYNC_DELETE_MISSING",
+	"sync.deleteAfterRuns":    "SYNC_DELETE_AFTER_RUNS",
+	"sync.maxErrors":          "SYNC_MAX_ERRORS",
+	"sync.maxChangeRatio":     "SYNC_MAX_CHANGE_RATIO",
+	"sync.maxUpdateRatio":     "SYNC_MAX_UPDATE_RATIO",
+	"sync.requireApproval":    "SYNC_REQUIRE_APPROVAL",
+	"sync.planTtl":            "SYNC_PLAN_TTL",
+	"sync.verifyWrites":       "SYNC_VERIFY_WRITES",
+	"sync.verifySample":       "SYNC_VERIFY_SAMPLE",
+	"sync.includeCodes":       "SYNC_INCLUDE_CODES",
+	"sync.excludeCodes":       "SYNC_EXCLUDE_CODES",
+	"sync.includePrefixes":    "SYNC_INCLUDE_PREFIXES",
+	"sync.excludePrefixes":    "SYNC_EXCLUDE_PREFIXES",
+	"sync.includeNamePattern": "SYNC_INCLUDE_NAME_PATTERN",
+	"sync.excludeNamePattern": "SYNC_EXCLUDE_NAME_PATTERN",
+
+	"sanitize.enabled":           "SANITIZE_TEXT",
+	"sanitize.maxLength":         "SANITIZE_MAX_LENGTH",
+	"sanitize.keepRaw":           "SANITIZE_KEEP_RAW",
+	"sanitize.titleSteps":        "SANITIZE_TITLE_STEPS",
+	"sanitize.titleReplacements": "SANITIZE_TITLE_REPLACEMENTS",
+	"sanitize.titleSuffixes":     "SANITIZE_TITLE_SUFFIXES",
+
+	"images.enabled":  "SYNC_IMAGES",
+	"images.baseUrl":  "IMAGES_BASE_URL",
+	"images.download": "IMAGES_DOWNLOAD",
+	"images.workers":  "IMAGES_DOWNLOAD_WORKERS",
+	"images.maxBytes": "IMAGES_MAX_BYTES",
+
+	"tracing.endpoint":    "OTEL_EXPORTER_OTLP_ENDPOINT",
+	"tracing.headers":     "OTEL_EXPORTER_OTLP_HEADERS",
+	"tracing.serviceName": "OTEL_SERVICE_NAME",
+	"tracing.timeout":     "OTEL_EXPORTER_OTLP_TIMEOUT",
+
+	"sinks.idMapCacheSize":      "ID_MAP_CACHE_SIZE",
+	"sinks.webhookUrl":          "SINK_WEBHOOK_URL",
+	"sinks.webhookSecret":       "SINK_WEBHOOK_SECRET",
+	"sinks.shopify.shop":        "SHOPIFY_SHOP",
+	"sinks.shopify.accessToken": "SHOPIFY_ACCESS_TOKEN",
+	"sinks.shopify.apiVersion":  "SHOPIFY_API_VERSION",
+	"sinks.shopify.rateLimit":   "SHOPIFY_RATE_LIMIT",
+	"sinks.destinations":        "SINK_DESTINATIONS",
+
+	"anomaly.factor":   "ANOMALY_FACTOR",
+	"anomaly.minDelta": "ANOMALY_MIN_DELTA",
+
+	"display.timezone": "DISPLAY_TIMEZONE",
+	"display.locale":   "DISPLAY_LOCALE",
+
+	"notify.slackWebhookUrl":   "NOTIFY_SLACK_WEBHOOK_URL",
+	"notify.webhookUrl":        "NOTIFY_WEBHOOK_URL",
+	"notify.webhookSecret":     "NOTIFY_WEBHOOK_SECRET",
+	"notify.templates.slack":   "NOTIFY_TEMPLATE_SLACK",
+	"notify.templates.webhook": "NOTIFY_TEMPLATE_WEBHOOK",
+	"notify.templates.email":   "NOTIFY_TEMPLATE_EMAIL",
+	"notify.templatesFromDb":   "NOTIFY_TEMPLATES_FROM_DB",
+	"notify.routes":            "NOTIFY_ROUTES",
+	"notify.diffLinkBaseUrl":   "NOTIFY_DIFF_LINK_BASE_URL",
+	"notify.diffLinkTtl":       "NOTIFY_DIFF_LINK_TTL",
+
+	"notify.email.smtpHost":       "NOTIFY_SMTP_HOST",
+	"notify.email.smtpPort":       "NOTIFY_SMTP_PORT",
+	"notify.email.username":       "NOTIFY_SMTP_USERNAME",
+	"notify.email.password":       "NOTIFY_SMTP_PASSWORD",
+	"notify.email.from":           "NOTIFY_EMAIL_FROM",
+	"notify.email.to":             "NOTIFY_EMAIL_TO",
+	"notify.email.errorThreshold": "NOTIFY_EMAIL_ERROR_THRESHOLD",
+}
+
+// loadFile reads a YAML or JSON config file (JSON being valid YAML) into the
+// loader's file values. An empty path loads nothing.
+func (l *loader) loadFile(path string) {
+	if path == "" {
+		return
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		l.fail("GO_CRON_CONFIG", "cannot read config file: %v", err)
+		return
+	}
+
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		l.fail("GO_CRON_CONFIG", "cannot parse %s: %v", path, err)
+		return
+	}
+
+	if profiles, ok := doc["profiles"]; ok {
+		delete(doc, "profiles")
+		l.loadProfiles(path, profiles)
+	}
+
+	var unknown []string
+	l.file, unknown = fileSettings(doc)
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		l.fail("GO_CRON_CONFIG", "unknown keys in %s: %s", path, strings.Join(unknown, ", "))
+	}
+}
+
+// loadProfiles reads the named profiles of a config file: each maps a name
+// to settings nested like those of the file. Profiles hold sync settings
+// only, like exported profiles.
+func (l *loader) loadProfiles(path string, raw interface{}) {
+	profiles, ok := raw.(map[string]interface{})
+	if !ok {
+		l.fail("GO_CRON_CONFIG", "profiles in %s must map names to settings", path)
+		return
+	}
+	l.profiles = make(map[string]map[string]string, len(profiles))
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		doc, ok := profiles[name].(map[string]interface{})
+		if !ok {
+			l.fail("GO_CRON_CONFIG", "profile %s in %s must map settings to values", name, path)
+			continue
+		}
+		settings, unknown := fileSettings(doc)
+		if len(unknown) > 0 {
+			sort.Strings(unknown)
+			l.fail("GO_CRON_CONFIG", "unknown keys in profile %s of %s: %s", name, path, strings.Join(unknown, ", "))
+			continue
+		}
+		var excluded []string
+		for env := range settings {
+			if !profileSettings[env] {
+				excluded = append(excluded, env)
+			}
+		}
+		if len(excluded) > 0 {
+			sort.Strings(excluded)
+			l.fail("GO_CRON_CONFIG", "profile %s of %s sets environment-specific settings: %s", name, path, strings.Join(excluded, ", "))
+			continue
+		}
+		l.profiles[name] = settings
+	}
+}
+
+// fileSettings flattens a config document into the values of its settings by
+// environment variable, and returns the keys that are no setting
+func fileSettings(doc map[string]interface{}) (map[string]string, []string) {
+	settings := make(map[string]string)
+	var unknown []string
+	flattenFile("", doc, func(key string, value interface{}) {
+		env, ok := fileKeys[key]
+		if !ok {
+			unknown = append(unknown, key)
+			return
+		}
+		if env == "SYNC_FIELD_MAPPING" {
+			// Templates may contain the separators of key=value pairs
+			encoded, _ := json.Marshal(value)
+			settings[env] = string(encoded)
+			return
+		}
+		settings[env] = fileValue(value)
+	})
+	return settings, unknown
+}
+
+// flattenFile walks nested maps and calls set with the dotted key of every
+// leaf. Lists are leaves: notify.routes is a list of objects. So are the
+// sync.categories map of group codes to categories and the sync.fieldMapping
+// map of targets to fields or templates.
+func flattenFile(prefix string, node map[string]interface{}, set func(key string, value interface{})) {
+	for k, v := range node {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		if child, ok := v.(map[string]interface{}); ok && key != "notify.routes" && key != "sync.categories" && key != "sync.fieldMapping" {
+			flattenFile(key, child, set)
+			continue
+		}
+		set(key, v)
+	}
+}
+
+// fileValue renders a file value in the format of its environment variable:
+// scalar lists are comma-separated, structured lists are JSON and maps are
+// comma-separated key=value pairs
+func fileValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case map[string]interface{}:
+		pairs := make([]string, 0, len(v))
+		for key, item := range v {
+			pairs = append(pairs, key+"="+fmt.Sprint(item))
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, ",")
+	case map[interface{}]interface{}:
+		// YAML maps with integer keys, like group codes
+		pairs := make([]string, 0, len(v))
+		for key, item := range v {
+			pairs = append(pairs, fmt.Sprint(key)+"="+fmt.Sprint(item))
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, ",")
+	case []interface{}:
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			switch item.(type) {
+			case map[string]interface{}, []interface{}:
+				encoded, _ := json.Marshal(v)
+				return string(encoded)
+			}
+			parts = append(parts, fmt.Sprint(item))
+		}
+		return strings.Join(parts, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
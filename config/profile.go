@@ -0,0 +1,209 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"go-cron/models"
+	"os"
+	"sort"
+	"time"
+)
+
+// profileSettings are the settings sync profiles may carry: how items are
+// fetched, matched and written. Anything else, such as secrets, credentials,
+// endpoints, proxies, TLS trust, headers and the database location, belongs
+// to an environment and is left out, including settings added later until
+// they are listed here.
+var profileSettings = map[string]bool{
+	"PAGE_SIZE":                            true,
+	"NUM_WORKERS":                          true,
+	"EXTERNAL_API_SLOW_PAGE":               true,
+	"PAGINATION_MODE":                      true,
+	"EXTERNAL_API_MAX_PAGE_SIZE":           true,
+	"EXTERNAL_API_BATCH_PAGES":             true,
+	"ITEMS_FILTER":                         true,
+	"ITEMS_GROUP_CODES":                    true,
+	"ITEMS_PRICE_LIST":                     true,
+	"EXTERNAL_API_TIMEOUT":                 true,
+	"EXTERNAL_API_LOGIN_TIMEOUT":           true,
+	"EXTERNAL_API_FETCH_TIMEOUT":           true,
+	"EXTERNAL_API_PREFLIGHT":               true,
+	"EXTERNAL_API_BACKOFF_BASE":            true,
+	"EXTERNAL_API_BACKOFF_MAX":             true,
+	"EXTERNAL_API_BREAKER_THRESHOLD":       true,
+	"EXTERNAL_API_HTTP2":                   true,
+	"EXTERNAL_API_MAX_CONNS_PER_HOST":      true,
+	"EXTERNAL_API_IDLE_CONN_TIMEOUT":       true,
+	"EXTERNAL_API_MAX_IDLE_CONNS_PER_HOST": true,
+	"EXTERNAL_API_DIAL_TIMEOUT":            true,
+	"EXTERNAL_API_TLS_HANDSHAKE_TIMEOUT":   true,
+	"EXTERNAL_API_RESPONSE_HEADER_TIMEOUT": true,
+
+	"SYNC_TIMEOUT":              true,
+	"SYNC_BATCH_TIMEOUT":        true,
+	"IDEMPOTENCY_TTL":           true,
+	"STATUS_CACHE_TTL":          true,
+	"SYNC_PRIORITY_ITEMS":       true,
+	"SYNC_PRIORITY_FROM_DB":     true,
+	"SYNC_PRIORITY_LIMIT":       true,
+	"SYNC_INCREMENTAL":          true,
+	"SYNC_FULL_EVERY":           true,
+	"SYNC_SHARDS":               true,
+	"SYNC_PARTITION_BY_GROUP":   true,
+	"SYNC_PARTITION_WORKERS":    true,
+	"PRODUCT_LOOKUP_BATCH_SIZE": true,
+	"PRODUCT_CACHE_TTL":         true,
+	"FRESHNESS_MAX_AGE":         true,
+	"UPDATE_CHUNK_SIZE":         true,
+	"UPDATE_WORKERS":            true,
+	"CREATE_CHUNK_SIZE":         true,
+	"SYNC_ISOLATE_FAILED_ROWS":  true,
+	"SYNC_MIN_FEED_RATIO":       true,
+	"TITLE_NORMALIZE_RULES":     true,
+	"TITLE_VENDOR_PREFIXES":     true,
+	"CATEGORY_MAP":              true,
+	"SYNC_FIELD_MAPPING":        true,
+	"CATEGORIES_FROM_DB":        true,
+	"SYNC_DUPLICATES":           true,
+	"SYNC_CASE_SENSITIVE":       true,
+	"SYNC_UPDATE_HANDLES":       true,
+	"SYNC_DELETE_MISSING":       true,
+	"SYNC_DELETE_AFTER_RUNS":    true,
+	"SYNC_MAX_ERRORS":           true,
+	"SYNC_MAX_CHANGE_RATIO":     true,
+	"SYNC_MAX_UPDATE_RATIO":     true,
+	"SYNC_REQUIRE_APPROVAL":     true,
+	"SYNC_PLAN_TTL":             true,
+	"SYNC_VERIFY_WRITES":        true,
+	"SYNC_VERIFY_SAMPLE":        true,
+	"SYNC_INCLUDE_CODES":        true,
+	"SYNC_EXCLUDE_CODES":        true,
+	"SYNC_INCLUDE_PREFIXES":     true,
+	"SYNC_EXCLUDE_PREFIXES":     true,
+	"SYNC_INCLUDE_NAME_PATTERN": true,
+	"SYNC_EXCLUDE_NAME_PATTERN": true,
+
+	"SANITIZE_TEXT":               true,
+	"SANITIZE_MAX_LENGTH":         true,
+	"SANITIZE_KEEP_RAW":           true,
+	"SANITIZE_TITLE_STEPS":        true,
+	"SANITIZE_TITLE_REPLACEMENTS": true,
+	"SANITIZE_TITLE_SUFFIXES":     true,
+
+	"SYNC_IMAGES":             true,
+	"IMAGES_DOWNLOAD":         true,
+	"IMAGES_DOWNLOAD_WORKERS": true,
+	"IMAGES_MAX_BYTES":        true,
+
+	"OTEL_SERVICE_NAME":          true,
+	"OTEL_EXPORTER_OTLP_TIMEOUT": true,
+
+	"ID_MAP_CACHE_SIZE":   true,
+	"SHOPIFY_API_VERSION": true,
+	"SHOPIFY_RATE_LIMIT":  true,
+	"SINK_DESTINATIONS":   true,
+
+	"ANOMALY_FACTOR":    true,
+	"ANOMALY_MIN_DELTA": true,
+
+	"DISPLAY_TIMEZONE": true,
+	"DISPLAY_LOCALE":   true,
+
+	"NOTIFY_TEMPLATE_SLACK":        true,
+	"NOTIFY_TEMPLATE_WEBHOOK":      true,
+	"NOTIFY_TEMPLATE_EMAIL":        true,
+	"NOTIFY_TEMPLATES_FROM_DB":     true,
+	"NOTIFY_DIFF_LINK_TTL":         true,
+	"NOTIFY_EMAIL_ERROR_THRESHOLD": true,
+}
+
+// ExportProfile returns the effective sync settings of cfg as a profile
+func ExportProfile(cfg *models.AppConfig, now time.Time) *models.SyncProfile {
+	profile := &models.SyncProfile{
+		Version:    models.SyncProfileVersion,
+		ExportedAt: now.UTC(),
+		Settings:   make(map[string]string),
+	}
+	for key, env := range fileKeys {
+		if !profileSettings[env] {
+			continue
+		}
+		if v, ok := cfg.Settings[env]; ok {
+			profile.Settings[key] = v
+		}
+	}
+	return profile
+}
+
+// ErrUnknownProfile is returned for a named profile the config file does not define
+var ErrUnknownProfile = errors.New("unknown sync profile")
+
+// LoadConfigWithProfile loads the configuration like LoadConfig with the
+// settings of profile layered over the config file. Environment variables
+// still take precedence. A nil profile loads the plain configuration.
+func LoadConfigWithProfile(profile *models.SyncProfile) *models.AppConfig {
+	return profileLoader(profile).load()
+}
+
+// LoadConfigWithNamedProfile loads the configuration like
+// LoadConfigWithProfile, then applies the settings of the profile of the
+// config file called name. They take precedence over the environment, as
+// runs choose the profile on purpose, e.g. a daily and a weekly cron syncing
+// other item groups. An empty name applies none.
+func LoadConfigWithNamedProfile(profile *models.SyncProfile, name string) (*models.AppConfig, error) {
+	l := profileLoader(profile)
+	if name != "" {
+		settings, ok := l.profiles[name]
+		if !ok {
+			return nil, fmt.Errorf("%w %q", ErrUnknownProfile, name)
+		}
+		l.profile, l.named = name, settings
+	}
+	return l.load(), nil
+}
+
+// profileLoader returns a loader of the config file with the settings of
+// profile layered over it
+func profileLoader(profile *models.SyncProfile) *loader {
+	l := &loader{}
+	l.loadFile(os.Getenv("GO_CRON_CONFIG"))
+	if profile != nil {
+		if l.file == nil {
+			l.file = make(map[string]string)
+		}
+		for key, value := range profile.Settings {
+			if env, ok := fileKeys[key]; ok && profileSettings[env] {
+				l.file[env] = value
+			}
+		}
+	}
+	return l
+}
+
+// CheckProfile validates a profile before it is imported: its version must be
+// supported, every key must be a sync setting, and the configuration with the
+// profile applied must be valid. Problems are reported in a *models.ValidationError.
+func CheckProfile(profile *models.SyncProfile) error {
+	var errs []models.FieldError
+	if profile.Version != models.SyncProfileVersion {
+		errs = append(errs, models.FieldError{Field: "version", Message: fmt.Sprintf("unsupported profile version %d, expected %d", profile.Version, models.SyncProfileVersion)})
+	}
+	keys := make([]string, 0, len(profile.Settings))
+	for key := range profile.Settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		env, ok := fileKeys[key]
+		switch {
+		case !ok:
+			errs = append(errs, models.FieldError{Field: key, Message: "unknown setting"})
+		case !profileSettings[env]:
+			errs = append(errs, models.FieldError{Field: key, Message: "is environment-specific and cannot be imported"})
+		}
+	}
+	if len(errs) > 0 {
+		return &models.ValidationError{Errors: errs}
+	}
+	return LoadConfigWithProfile(profile).Validate()
+}
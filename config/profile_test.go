@@ -0,0 +1,156 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go-cron/models"
+)
+
+// Test_ExportProfile tests that a profile carries the effective settings but no secrets
+func Test_ExportProfile(t *testing.T) {
+	setValidEnv(t)
+	t.Setenv("UPDATE_WORKERS", "8")
+
+	profile := ExportProfile(LoadConfig(), time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC))
+
+	if profile.Version != models.SyncProfileVersion {
+		t.Errorf("Expected version %d, got %d", models.SyncProfileVersion, profile.Version)
+	}
+	if got := profile.Settings["sync.updateWorkers"]; got != "8" {
+		t.Errorf("Expected the configured worker count, got %q", got)
+	}
+	if got := profile.Settings["sync.lookupBatchSize"]; got != "500" {
+		t.Errorf("Expected the default lookup batch size, got %q", got)
+	}
+	if _, ok := profile.Settings["auth.cronSecret"]; ok {
+		t.Error("Expected the cron secret to be left out of the profile")
+	}
+}
+
+// Test_profileSettings tests that profiles only carry known settings and
+// none that belong to an environment
+func Test_profileSettings(t *testing.T) {
+	known := make(map[string]bool, len(fileKeys))
+	for _, env := range fileKeys {
+		known[env] = true
+	}
+	for env := range profileSettings {
+		if !known[env] {
+			t.Errorf("Expected %s to be a setting", env)
+		}
+	}
+	for _, env := range []string{"DATABASE_URL", "DATABASE_SCHEMA", "DATABASE_PRODUCTS_TABLE", "CRON_SECRET", "PASSWORD",
+		"EXTERNAL_API_HEADERS", "EXTERNAL_API_PROXY_URL", "EXTERNAL_API_TLS_INSECURE", "JOB_BASE_URL", "SHOPIFY_ACCESS_TOKEN"} {
+		if profileSettings[env] {
+			t.Errorf("Expected %s to be left out of profiles", env)
+		}
+	}
+}
+
+// Test_CheckProfile tests that unknown, environment-specific and invalid settings are rejected
+func Test_CheckProfile(t *testing.T) {
+	setValidEnv(t)
+
+	profile := &models.SyncProfile{
+		Version: models.SyncProfileVersion + 1,
+		Settings: map[string]string{
+			"sync.unknown":       "1",
+			"auth.cronSecret":    "other",
+			"sync.updateWorkers": "four",
+		},
+	}
+
+	var validationErr *models.ValidationError
+	if err := CheckProfile(profile); !errors.As(err, &validationErr) {
+		t.Fatalf("Expected a *models.ValidationError, got %v", err)
+	}
+	fields := make(map[string]bool)
+	for _, fe := range validationErr.Errors {
+		fields[fe.Field] = true
+	}
+	for _, field := range []string{"version", "sync.unknown", "auth.cronSecret"} {
+		if !fields[field] {
+			t.Errorf("Expected an error for %s, got %v", field, validationErr)
+		}
+	}
+
+	profile.Version = models.SyncProfileVersion
+	delete(profile.Settings, "sync.unknown")
+	delete(profile.Settings, "auth.cronSecret")
+	if err := CheckProfile(profile); !errors.As(err, &validationErr) || validationErr.Errors[0].Field != "UPDATE_WORKERS" {
+		t.Errorf("Expected the invalid worker count to be reported, got %v", err)
+	}
+}
+
+// Test_LoadConfigWithProfile tests that a profile overrides the defaults but not the environment
+func Test_LoadConfigWithProfile(t *testing.T) {
+	setValidEnv(t)
+	t.Setenv("UPDATE_WORKERS", "6")
+
+	cfg := LoadConfigWithProfile(&models.SyncProfile{
+		Version:  models.SyncProfileVersion,
+		Settings: map[string]string{"sync.updateWorkers": "2", "sync.lookupBatchSize": "100"},
+	})
+
+	if cfg.Sync.LookupBatchSize != 100 {
+		t.Errorf("Expected the profile lookup batch size, got %d", cfg.Sync.LookupBatchSize)
+	}
+	if cfg.Sync.UpdateWorkers != 6 {
+		t.Errorf("Expected the environment to take precedence, got %d workers", cfg.Sync.UpdateWorkers)
+	}
+}
+
+// Test_LoadConfigWithNamedProfile tests that a named profile of the config
+// file overrides the file and the environment, and that unknown names and
+// environment-specific settings are rejected
+func Test_LoadConfigWithNamedProfile(t *testing.T) {
+	setValidEnv(t)
+	t.Setenv("PAGE_SIZE", "40")
+	writeConfigFile(t, "config.yaml", `
+externalApi:
+  groupCodes: [100, 101]
+profiles:
+  weekly:
+    externalApi:
+      groupCodes: [118, 121]
+      pageSize: 100
+    sinks:
+      destinations: [webhook]
+`)
+
+	cfg, err := LoadConfigWithNamedProfile(nil, "weekly")
+	if err != nil {
+		t.Fatalf("LoadConfigWithNamedProfile failed: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Expected a valid configuration, got %v", err)
+	}
+	if cfg.Profile != "weekly" || !reflect.DeepEqual(cfg.ExternalAPI.GroupCodes, []int{118, 121}) || cfg.ExternalAPI.PageSize != 100 {
+		t.Errorf("Expected the weekly groups and page size, got %v and %d", cfg.ExternalAPI.GroupCodes, cfg.ExternalAPI.PageSize)
+	}
+	if !reflect.DeepEqual(cfg.Sinks.Destinations, []string{"webhook"}) {
+		t.Errorf("Expected the webhook destination, got %v", cfg.Sinks.Destinations)
+	}
+
+	plain, _ := LoadConfigWithNamedProfile(nil, "")
+	if plain.Profile != "" || !reflect.DeepEqual(plain.ExternalAPI.GroupCodes, []int{100, 101}) || plain.ExternalAPI.PageSize != 40 {
+		t.Errorf("Expected the file and environment settings without a profile, got %v and %d", plain.ExternalAPI.GroupCodes, plain.ExternalAPI.PageSize)
+	}
+	if _, err := LoadConfigWithNamedProfile(nil, "daily"); !errors.Is(err, ErrUnknownProfile) {
+		t.Errorf("Expected an unknown profile error, got %v", err)
+	}
+
+	writeConfigFile(t, "config.yaml", `
+profiles:
+  leaky:
+    auth:
+      cronSecret: other
+`)
+	if err := LoadConfig().Validate(); err == nil || !strings.Contains(err.Error(), "CRON_SECRET") {
+		t.Errorf("Expected the environment-specific setting to be rejected, got %v", err)
+	}
+}
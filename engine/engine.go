@@ -0,0 +1,780 @@
+// Package engine runs product syncs from the external API into the database.
+// It is the entry point for services that embed the sync directly instead of
+// calling the HTTP handler:
+//
+//	eng := engine.New(config.LoadConfig(), db)
+//	report, err := eng.Run(ctx, engine.Options{})
+//
+// Recording runs, notifications and sink delivery are left to the caller.
+package engine
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"go-cron/external"
+	"go-cron/internal/utils"
+	"go-cron/models"
+	"go-cron/repo"
+	"go-cron/sources"
+	"go-cron/tracing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Stages of a sync reported by *StageError
+const (
+	StagePreflight = "preflight"
+	StageFetch     = "fetch"
+	StageFeedCheck = "feed_check"
+	StageSync      = "sync"
+)
+
+// ErrItemNotFound is returned by SyncItem when no item with the code matches the configured filter
+var ErrItemNotFound = errors.New("item not found")
+
+// BackoffError is returned by CheckBackoff while syncs are skipped because
+// the external API was unreachable
+type BackoffError struct {
+	Until     time.Time
+	Failures  int
+	LastError string
+}
+
+func (e *BackoffError) Error() string {
+	return fmt.Sprintf("circuit open: backing off until %s after %d failed attempts to reach the external API: %s",
+		e.Until.Format(time.RFC3339), e.Failures, e.LastError)
+}
+
+// StageError is returned by Run when a stage of the sync failed
+type StageError struct {
+	Stage string
+	Err   error
+}
+
+func (e *StageError) Error() string {
+	return fmt.Sprintf("%s failed: %v", e.Stage, e.Err)
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+// Options tune a single Run
+type Options struct {
+	// DryRun computes the changes without writing them
+	DryRun bool
+	// ForceFull runs a full sync even when an incremental one is due
+	ForceFull bool
+	// RunID attributes the changes in the audit log to a recorded run; 0 disables the audit log
+	RunID int
+	// Shard restricts the sync to the items of a claimed shard
+	Shard *models.ShardAssignment
+	// Progress observes the database writes of the run; it may be nil
+	Progress repo.ProgressFunc
+	// MaxItems caps the number of fetched items synced; zero syncs them all
+	MaxItems int
+	// Sample syncs this fraction of the fetched items, picked by a hash of
+	// their item code before MaxItems applies; zero syncs them all
+	Sample float64
+	// Partial marks a run restricted to part of the catalog on purpose: its
+	// feed is not checked against the catalog size
+	Partial bool
+	// Confirm applies the changes even when they trip the change guard
+	Confirm bool
+}
+
+// limited reports whether the run syncs only some of the fetched items
+func (o Options) limited() bool {
+	return o.MaxItems > 0 || (o.Sample > 0 && o.Sample < 1)
+}
+
+// Report is the outcome of a Run
+type Report struct {
+	// Mode is the sync mode that was run (full or incremental)
+	Mode string
+	// Fetched is the feed fetched from the source, nil when the fetch failed
+	Fetched *external.FetchResult
+	// Result is the sync result, including the priority pass
+	Result *models.SyncResult
+}
+
+// Engine fetches the external items and syncs them into the products table
+type Engine struct {
+	config     *models.AppConfig
+	db         *sql.DB
+	source     sources.Source
+	products   *repo.ProductRepository
+	writer     repo.ProductRepositoryInterface
+	runs       *repo.RunRepository
+	watermarks *repo.WatermarkRepository
+	backoff    *repo.BackoffRepository
+	outbox     repo.OutboxRepositoryInterface
+	sinks      []string
+	titles     *repo.Normalizer
+	categories map[int]string
+	now        func() time.Time
+	// halfOpen is set by CheckBackoff when the backoff window of an earlier
+	// failure has passed, so the first failed request of the run stops it
+	halfOpen bool
+}
+
+// New creates a sync engine for the configuration and database
+func New(config *models.AppConfig, db *sql.DB) *Engine {
+	products := repo.NewProductRepositoryFromConfig(db, config.Database)
+	products.SetUpdateParallelism(config.Sync.UpdateChunkSize, config.Sync.UpdateWorkers)
+	products.SetCreateChunks(config.Sync.CreateChunkSize, config.Sync.IsolateFailedRows)
+	products.SetBatchTimeout(config.Sync.BatchTimeout)
+	// The rules are checked by config.Validate; the service and the lookups must agree on them
+	titles, err := repo.NewNormalizer(config.Sync.TitleRules, config.Sync.VendorPrefixes)
+	if err != nil {
+		log.Printf("Using the default title rules: %v\n", err)
+		titles, _ = repo.NewNormalizer([]string{models.TitleRuleTrim, models.TitleRuleLower}, nil)
+	}
+	if config.Sync.CaseSensitive {
+		titles = titles.CaseSensitive()
+	}
+	products.SetNormalizer(titles)
+	tracing.Configure(config.Tracing)
+
+	e := &Engine{
+		config:     config,
+		db:         db,
+		source:     sources.FromConfig(config),
+		products:   products,
+		writer:     products,
+		titles:     titles,
+		categories: config.Sync.Categories,
+		now:        time.Now,
+	}
+	// Other databases than Postgres store the products through portable SQL
+	// and keep no run history, watermark nor backoff state
+	if portable(config) {
+		sqlProducts := repo.NewSQLProductRepository(db, repo.Dialect(config.Database.Dialect))
+		sqlProducts.SetNormalizer(titles)
+		e.writer = sqlProducts
+		return e
+	}
+	e.runs = repo.NewRunRepository(db)
+	e.watermarks = repo.NewWatermarkRepository(db)
+	e.backoff = repo.NewBackoffRepository(db)
+	return e
+}
+
+// SetOutbox enables queueing of applied changes in the outbox for the given sinks
+func (e *Engine) SetOutbox(outbox repo.OutboxRepositoryInterface, sinks []string) {
+	e.outbox = outbox
+	e.sinks = sinks
+}
+
+// SetSource replaces the configured source of the synced items
+func (e *Engine) SetSource(source sources.Source) {
+	e.source = source
+}
+
+// SetClock replaces the time source of runs (watermarks, sync mode, backoff)
+func (e *Engine) SetClock(now func() time.Time) {
+	e.now = now
+}
+
+// UsePgx sends the bulk product writes through a pgx pool (COPY and batched
+// statements) instead of one database/sql statement per row
+func (e *Engine) UsePgx(pool *pgxpool.Pool) {
+	e.writer = repo.NewPgxProductRepository(e.products, pool)
+}
+
+// Products returns the product repository the engine writes to
+func (e *Engine) Products() *repo.ProductRepository {
+	return e.products
+}
+
+// CheckBackoff returns a *BackoffError while the external API is in its
+// backoff window, so a scheduled invocation can exit without a login attempt.
+// After the window the circuit of the run is half-open: a single failed
+// request stops it. Failing to read the backoff state does not block the sync.
+func (e *Engine) CheckBackoff(ctx context.Context) error {
+	if !e.backsOff() {
+		return nil
+	}
+	state, err := e.backoff.GetBackoff(ctx, models.BackoffSourceExternalAPI)
+	if err != nil {
+		log.Printf("Ignoring backoff state: %v\n", err)
+		return nil
+	}
+	switch state.Circuit(e.now()) {
+	case models.CircuitClosed:
+		return nil
+	case models.CircuitHalfOpen:
+		log.Printf("External API circuit half-open after %d failed attempts: trying again\n", state.Failures)
+		e.halfOpen = true
+		return nil
+	}
+	return &BackoffError{Until: state.NextAttemptAt, Failures: state.Failures, LastError: state.LastError}
+}
+
+// Run syncs the external items into the database. Priority items are synced
+// first, then the full catalog or, when configured and due, only the items
+// changed since the last sync. A full feed that looks like an upstream outage
+// is rejected. On a *StageError the report holds what was synced before the
+// failure. With preflight enabled, the selected fields are checked on a single
+// item first. Failing to reach the external API starts or extends its backoff
+// (see CheckBackoff, which Run leaves to the caller); a successful fetch ends it.
+func (e *Engine) Run(ctx context.Context, opts Options) (*Report, error) {
+	opts = e.begin(opts)
+	ctx, span := tracing.Start(ctx, "sync.run", tracing.Bool("sync.dry_run", opts.DryRun), tracing.Int("sync.run_id", opts.RunID))
+	report, err := e.run(ctx, opts)
+	span.SetAttributes(tracing.String("sync.mode", report.Mode))
+	if report.Result != nil {
+		span.SetAttributes(tracing.String("sync.status", report.Result.Status))
+		utils.SortDiffsByTitle(report.Result.Diffs, e.config.Display.Locale)
+	}
+	span.RecordError(err)
+	span.End()
+	flushSpans(ctx)
+	return report, err
+}
+
+// run runs Run within its span
+func (e *Engine) run(ctx context.Context, opts Options) (*Report, error) {
+	startTime := e.now()
+	ctx = e.withBreaker(ctx)
+	e.loadCategories(ctx)
+	syncService := e.newSyncService(opts)
+	report := &Report{Mode: models.SyncModeFull}
+
+	// Catch misnamed fields on a single item before spending the budget on a full fetch
+	if preflighter, ok := e.source.(sources.Preflighter); ok && e.config.ExternalAPI.Preflight {
+		if err := preflighter.Preflight(ctx); err != nil {
+			e.recordFetch(ctx, err)
+			return report, &StageError{Stage: StagePreflight, Err: err}
+		}
+	}
+
+	// Top sellers are fetched and written first so they stay fresh even when the run is cut short
+	prioritySynced, priorityResult := e.syncPriorityItems(ctx, syncService, opts)
+	report.Result = priorityResult
+
+	// Incremental runs only fetch recent changes; a full sync runs when forced and periodically
+	var watermark *models.SyncWatermark
+	var err error
+	if e.watermarks != nil {
+		watermark, err = e.watermarks.GetWatermark(ctx, models.EntityProducts)
+		if err != nil && e.config.Sync.Incremental {
+			log.Printf("Falling back to a full sync: %v\n", err)
+		}
+	}
+	mode, since := repo.ChooseSyncMode(e.config.Sync, watermark, opts.ForceFull, startTime)
+	report.Mode = mode
+
+	// Fetch the items from the source and sync them, per item group when partitioned
+	if mode == models.SyncModeIncremental {
+		log.Printf("Incremental sync of items updated since %s\n", since.Format("2006-01-02"))
+	}
+	var fetched *external.FetchResult
+	var result *models.SyncResult
+	if e.partitioned(opts) {
+		fetched, result, err = e.syncGroups(ctx, opts, mode, since, prioritySynced)
+	} else {
+		fetched, result, err = e.syncFeed(ctx, syncService, e.runSource(opts), opts, mode, since, prioritySynced)
+	}
+	report.Fetched = fetched
+	if err != nil {
+		if result != nil {
+			report.Result = result
+		}
+		return report, err
+	}
+	if priorityResult != nil {
+		result.Add(priorityResult)
+		result.Status = models.WorseStatus(result.Status, priorityResult.Status)
+	}
+	result.Mode = mode
+	report.Result = result
+
+	// Only a complete full feed tells which products left the catalog
+	if e.archivesMissing(opts, mode, fetched, result) {
+		start := time.Now()
+		syncService.ArchiveMissing(ctx, fetched.Items, result)
+		result.AddTimings(0, time.Since(start))
+	}
+
+	// The next incremental sync picks up from this run, unless it was cut short or partial
+	if e.watermarks != nil && !opts.DryRun && !opts.Partial && !opts.limited() && (result.Status == models.SyncStatusOK || result.Status == models.SyncStatusDegraded) {
+		if err := e.watermarks.AdvanceWatermark(ctx, models.EntityProducts, mode, startTime); err != nil {
+			log.Printf("Failed to advance sync watermark: %v\n", err)
+		}
+	}
+
+	// Surface items rejected by the decoder alongside the sync errors
+	for _, invalid := range fetched.Invalid {
+		result.Errors = append(result.Errors, invalid.Error())
+	}
+	// Flag unusual deltas compared to the previous successful run
+	if e.runs != nil {
+		if err := e.detectAnomalies(ctx, opts, result); err != nil {
+			log.Printf("Anomaly detection failed: %v\n", err)
+		}
+	}
+
+	return report, nil
+}
+
+// archivesMissing reports whether the run archives the products missing from
+// the feed: only full runs over the whole catalog whose items all decoded do,
+// on the first shard of sharded runs
+func (e *Engine) archivesMissing(opts Options, mode string, fetched *external.FetchResult, result *models.SyncResult) bool {
+	if !e.config.Sync.DeleteMissing || mode != models.SyncModeFull || opts.Partial || opts.limited() {
+		return false
+	}
+	if opts.Shard != nil && (opts.Shard.Shard != 0 || e.shardedAtSource(opts)) {
+		return false
+	}
+	if len(fetched.Invalid) > 0 {
+		log.Printf("Not archiving missing products: %d items were rejected by the decoder\n", len(fetched.Invalid))
+		return false
+	}
+	return result.Status == models.SyncStatusOK || result.Status == models.SyncStatusDegraded
+}
+
+// fetch returns the items of source for the sync mode, recording the outcome
+// for the backoff of the external API
+func (e *Engine) fetch(ctx context.Context, source sources.Source, mode string, since time.Time) (*external.FetchResult, error) {
+	ctx, span := tracing.Start(ctx, "sync.fetch", tracing.String("sync.source", source.Name()), tracing.String("sync.mode", mode))
+	defer span.End()
+
+	var fetched *external.FetchResult
+	var err error
+	start := time.Now()
+	if mode == models.SyncModeIncremental {
+		fetched, err = source.FetchUpdatedSince(ctx, since)
+	} else {
+		fetched, err = source.FetchAll(ctx)
+	}
+	// Sources without steps of their own, like files, only time the fetch
+	if fetched != nil && fetched.Timings == nil {
+		fetched.Timings = &models.Timings{FetchMs: time.Since(start).Milliseconds()}
+	}
+	if fetched != nil {
+		span.SetAttributes(tracing.Int("sync.items", len(fetched.Items)), tracing.Int("sync.invalid", len(fetched.Invalid)))
+		if c := fetched.Concurrency; c != nil {
+			span.SetAttributes(tracing.Int("sap.workers", c.Final), tracing.Int("sap.workers_min", c.Min))
+		}
+	}
+	span.RecordError(err)
+	e.recordFetch(ctx, err)
+	if err != nil {
+		return nil, &StageError{Stage: StageFetch, Err: err}
+	}
+	return fetched, nil
+}
+
+// checkFeed never lets a full feed that looks like an upstream outage be
+// applied; incremental feeds are small by design. The feed of a shard fetched
+// by its ItemCode range is held against the same shard's previous feed.
+func (e *Engine) checkFeed(ctx context.Context, opts Options, mode string, items int) error {
+	if mode != models.SyncModeFull || opts.Partial {
+		return nil
+	}
+	var err error
+	if e.shardedAtSource(opts) {
+		var previous *models.SyncResult
+		if previous, err = repo.NewShardRepository(e.db).LastShardResult(ctx, *opts.Shard); err != nil {
+			log.Printf("Feed check skipped: %v\n", err)
+			return nil
+		}
+		err = repo.CheckShardFeed(items, previous, e.config.Sync.MinFeedRatio)
+	} else {
+		err = repo.CheckFeed(ctx, e.writer, items, e.config.Sync.MinFeedRatio)
+	}
+	if err != nil {
+		return &StageError{Stage: StageFeedCheck, Err: err}
+	}
+	return nil
+}
+
+// detectAnomalies flags the unusual deltas of result compared to the previous
+// successful run over the whole catalog, or to the previous run of the same
+// shard for a shard
+func (e *Engine) detectAnomalies(ctx context.Context, opts Options, result *models.SyncResult) error {
+	if opts.Shard == nil {
+		return repo.DetectRunAnomalies(ctx, e.runs, result, e.config.Anomaly)
+	}
+	previous, err := repo.NewShardRepository(e.db).LastShardResult(ctx, *opts.Shard)
+	if err != nil || previous == nil {
+		return err
+	}
+	result.Anomalies = repo.CompareRunResults(result, previous, e.config.Anomaly)
+	if len(result.Anomalies) > 0 {
+		log.Printf("Unusual deltas compared to the previous cycle of shard %d: %v", opts.Shard.Shard, result.Anomalies)
+	}
+	return nil
+}
+
+// shardedAtSource reports whether the run fetches only the items of its shard:
+// the Service Layer filters them by the ItemCode range of the shard
+func (e *Engine) shardedAtSource(opts Options) bool {
+	return opts.Shard != nil && e.source.Name() == models.SourceSAP
+}
+
+// shardConfig returns config narrowed to the ItemCode range of the shard of
+// the run when the Service Layer filters it
+func (e *Engine) shardConfig(config *models.AppConfig, opts Options) *models.AppConfig {
+	if !e.shardedAtSource(opts) {
+		return config
+	}
+	from, to := repo.ShardRange(opts.Shard.Shard, opts.Shard.Shards)
+	return external.WithItemCodeRange(config, from, to)
+}
+
+// shardItems returns the items of the shard of the run, by the ItemCode range
+// the Service Layer filters the fetch of the run with when sharded at source
+func (e *Engine) shardItems(items []models.ExternalItem, opts Options) []models.ExternalItem {
+	switch {
+	case opts.Shard == nil:
+		return items
+	case e.shardedAtSource(opts):
+		from, to := repo.ShardRange(opts.Shard.Shard, opts.Shard.Shards)
+		return repo.FilterRange(items, from, to)
+	default:
+		return repo.FilterShard(items, opts.Shard.Shard, opts.Shard.Shards)
+	}
+}
+
+// runSource returns the source of the items of the run
+func (e *Engine) runSource(opts Options) sources.Source {
+	if !e.shardedAtSource(opts) {
+		return e.source
+	}
+	return sources.FromConfig(e.shardConfig(e.config, opts))
+}
+
+// runItems returns the fetched items a run syncs: the shard's items that were
+// not synced by the priority pass, in the sample of the run, up to MaxItems of them
+func (e *Engine) runItems(items []models.ExternalItem, opts Options, prioritySynced []models.ExternalItem) []models.ExternalItem {
+	// Other sources fetch the whole catalog; only the shard's items are synced
+	if !e.shardedAtSource(opts) {
+		items = e.shardItems(items, opts)
+	}
+	items = repo.ExcludeSynced(items, prioritySynced)
+	if opts.Sample > 0 && opts.Sample < 1 {
+		total := len(items)
+		items = repo.SampleItems(items, opts.Sample)
+		log.Printf("Syncing a sample of %d of %d items\n", len(items), total)
+	}
+	if opts.MaxItems > 0 && len(items) > opts.MaxItems {
+		log.Printf("Syncing the first %d of %d items\n", opts.MaxItems, len(items))
+		items = items[:opts.MaxItems]
+	}
+	return items
+}
+
+// syncFeed fetches the items of source, checks the feed and syncs the items
+// of the run
+func (e *Engine) syncFeed(ctx context.Context, syncService *repo.SyncService, source sources.Source, opts Options, mode string, since time.Time, prioritySynced []models.ExternalItem) (*external.FetchResult, *models.SyncResult, error) {
+	fetched, err := e.fetch(ctx, source, mode, since)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := e.checkFeed(ctx, opts, mode, len(fetched.Items)); err != nil {
+		return fetched, nil, err
+	}
+
+	log.Println("Starting database synchronization...")
+	skipSynced(syncService, mode)
+	result, err := syncService.CompareAndSync(ctx, e.runItems(fetched.Items, opts, prioritySynced))
+	if err != nil {
+		return fetched, nil, &StageError{Stage: StageSync, Err: err}
+	}
+	recordConcurrency(result, fetched)
+	return fetched, result, nil
+}
+
+// skipSynced makes the incremental runs of syncService skip the items not
+// updated since their product was last synced
+func skipSynced(syncService *repo.SyncService, mode string) {
+	if mode != models.SyncModeIncremental {
+		return
+	}
+	opts := syncService.Options()
+	opts.SkipSynced = true
+	syncService.SetOptions(opts)
+}
+
+// recordConcurrency adds how the page workers of fetched adapted to the
+// performance breakdown of result
+func recordConcurrency(result *models.SyncResult, fetched *external.FetchResult) {
+	if fetched.Concurrency == nil {
+		return
+	}
+	if result.Performance == nil {
+		result.Performance = &models.SyncPerformance{}
+	}
+	result.Performance.Add(&models.SyncPerformance{Fetch: fetched.Concurrency})
+}
+
+// SyncItem fetches a single item by its ItemCode and syncs it right away,
+// reporting the resulting product and the fields that changed. Priority
+// items, watermarks and the feed check are left to the regular runs, and the
+// changes are only audited when opts has a RunID.
+func (e *Engine) SyncItem(ctx context.Context, itemCode string, opts Options) (*models.ItemSyncResult, error) {
+	opts = e.begin(opts)
+	ctx, span := tracing.Start(ctx, "sync.item", tracing.String("sync.item_code", itemCode))
+	defer flushSpans(ctx)
+	defer span.End()
+
+	fetched, err := e.source.FetchByCodes(ctx, []string{itemCode})
+	if err != nil {
+		return nil, &StageError{Stage: StageFetch, Err: err}
+	}
+	if len(fetched.Items) == 0 {
+		if len(fetched.Invalid) > 0 {
+			return nil, &StageError{Stage: StageFetch, Err: fetched.Invalid[0]}
+		}
+		return nil, ErrItemNotFound
+	}
+
+	e.loadCategories(ctx)
+	result, err := e.newSyncService(opts).SyncItem(ctx, fetched.Items[0])
+	if err != nil {
+		return nil, &StageError{Stage: StageSync, Err: err}
+	}
+	return result, nil
+}
+
+// Import syncs items read from an uploaded file through CompareAndSync, like
+// the items of a fetch, reporting the invalid ones with the sync errors. The
+// products missing from the file are left alone, as are watermarks and the
+// feed check.
+func (e *Engine) Import(ctx context.Context, items []models.ExternalItem, invalid []models.ItemValidationError, opts Options) (*models.SyncResult, error) {
+	opts = e.begin(opts)
+	ctx, span := tracing.Start(ctx, "sync.import", tracing.Int("sync.items", len(items)), tracing.Bool("sync.dry_run", opts.DryRun))
+	defer flushSpans(ctx)
+	defer span.End()
+
+	external.SanitizeItems(items, e.config.Sanitize)
+	e.loadCategories(ctx)
+	result, err := e.newSyncService(opts).CompareAndSync(ctx, items)
+	if err != nil {
+		span.RecordError(err)
+		return result, &StageError{Stage: StageSync, Err: err}
+	}
+	for _, i := range invalid {
+		result.Errors = append(result.Errors, i.Error())
+	}
+	utils.SortDiffsByTitle(result.Diffs, e.config.Display.Locale)
+	return result, nil
+}
+
+// ApplyPlan applies a sync plan held by the change guard once it was
+// approved, attributing its changes to opts.RunID
+func (e *Engine) ApplyPlan(ctx context.Context, plan *repo.SyncPlan, opts Options) (*models.SyncResult, error) {
+	opts = e.begin(opts)
+	ctx, span := tracing.Start(ctx, "sync.apply_plan")
+	defer flushSpans(ctx)
+	defer span.End()
+
+	plan.Approve()
+	result, err := e.newSyncService(opts).Apply(ctx, plan)
+	if err != nil {
+		span.RecordError(err)
+		return result, &StageError{Stage: StageSync, Err: err}
+	}
+	return result, nil
+}
+
+// begin prepares a run with opts before any sync service is created, as the
+// group pipelines create theirs concurrently: the batch writes report to
+// opts.Progress. It returns opts as a dry run unless SYNC_WRITES allows the
+// database writes.
+func (e *Engine) begin(opts Options) Options {
+	e.products.SetProgress(opts.Progress)
+	if !e.config.Sync.Writes {
+		opts.DryRun = true
+	}
+	return opts
+}
+
+// flushSpans exports the spans of a run before the function handling it returns
+func flushSpans(ctx context.Context) {
+	if err := tracing.Flush(context.WithoutCancel(ctx)); err != nil {
+		log.Printf("Failed to export spans: %v\n", err)
+	}
+}
+
+// recordFetch updates the backoff state of the external API after a fetch
+// that returned err: unreachable extends the backoff, success clears it.
+// Rejected requests (bad filter, credentials) leave it alone.
+func (e *Engine) recordFetch(ctx context.Context, err error) {
+	if !e.backsOff() {
+		return
+	}
+	// The fetch may have used up the sync deadline
+	ctx = context.WithoutCancel(ctx)
+
+	if err == nil {
+		if err := e.backoff.ResetBackoff(ctx, models.BackoffSourceExternalAPI); err != nil {
+			log.Printf("Failed to reset backoff: %v\n", err)
+		}
+		return
+	}
+	if !external.IsUnavailable(err) {
+		return
+	}
+	state, recordErr := e.backoff.RecordFailure(ctx, models.BackoffSourceExternalAPI, err.Error(),
+		e.config.ExternalAPI.BackoffBase, e.config.ExternalAPI.BackoffMax, e.now())
+	if recordErr != nil {
+		log.Printf("Failed to record backoff: %v\n", recordErr)
+		return
+	}
+	log.Printf("External API unreachable (%d failed attempts), backing off until %s\n",
+		state.Failures, state.NextAttemptAt.Format(time.RFC3339))
+}
+
+// withBreaker returns ctx stopping the requests of the run to the external
+// API once the configured number of consecutive requests failed
+func (e *Engine) withBreaker(ctx context.Context) context.Context {
+	if e.config.ExternalAPI.Breaker <= 0 {
+		return ctx
+	}
+	breaker := external.NewBreaker(e.config.ExternalAPI.Breaker)
+	if e.halfOpen {
+		breaker.HalfOpen()
+	}
+	return external.WithBreaker(ctx, breaker)
+}
+
+// backsOff reports whether failed fetches start a backoff: it is enabled, the
+// items come from the Service Layer and its state is kept in Postgres
+func (e *Engine) backsOff() bool {
+	return e.backoff != nil && e.config.ExternalAPI.BackoffBase > 0 && e.source.Name() == models.SourceSAP
+}
+
+// imageFetcher returns the downloader of changed pictures when configured, or
+// nil to store their URLs only
+func (e *Engine) imageFetcher() repo.ImageFetcher {
+	if !e.config.Images.Download {
+		return nil
+	}
+	fetcher, err := external.NewImageFetcher(e.config)
+	if err != nil {
+		log.Printf("Picture downloads skipped: %v\n", err)
+		return nil
+	}
+	return fetcher
+}
+
+// loadCategories reads the item group categories from the database when
+// configured. Categories are left alone for the run when they cannot be read.
+func (e *Engine) loadCategories(ctx context.Context) {
+	if !e.config.Sync.CategoriesFromDB {
+		return
+	}
+	categories, err := repo.NewCategoryRepository(e.db).GetCategoryMap(ctx)
+	if err != nil {
+		log.Printf("Categories skipped: %v\n", err)
+		return
+	}
+	e.categories = categories
+}
+
+// portable reports whether the products are stored outside Postgres, through
+// repo.SQLProductRepository
+func portable(config *models.AppConfig) bool {
+	return config.Database.Dialect != "" && config.Database.Dialect != models.DatabaseDialectPostgres
+}
+
+// productCache keeps the catalog between the runs of a warm instance
+var productCache = repo.NewProductCache()
+
+// newSyncService creates the sync service of a single run
+func (e *Engine) newSyncService(opts Options) *repo.SyncService {
+	writer := e.writer
+	if ttl := e.config.Sync.ProductCacheTTL; ttl > 0 {
+		writer = repo.NewCachingProductRepository(writer, productCache, e.config.Database.DatabaseURI, ttl)
+	}
+	syncService := repo.NewSyncServiceWithOptions(writer, repo.SyncOptions{
+		CaseSensitive:   e.config.Sync.CaseSensitive,
+		UpdateHandles:   e.config.Sync.UpdateHandles,
+		DeleteMissing:   e.config.Sync.DeleteMissing,
+		DeleteAfterRuns: e.config.Sync.DeleteAfterRuns,
+		MaxErrors:       e.config.Sync.MaxErrors,
+		MaxChangeRatio:  e.config.Sync.MaxChangeRatio,
+		MaxUpdateRatio:  e.config.Sync.MaxUpdateRatio,
+		Confirmed:       opts.Confirm,
+		VerifyWrites:    e.config.Sync.VerifyWrites,
+		VerifySample:    e.config.Sync.VerifySample,
+		LookupBatchSize: e.config.Sync.LookupBatchSize,
+	})
+	syncService.SetNormalizer(e.titles)
+	syncService.SetDuplicates(e.config.Sync.Duplicates)
+	syncService.SetCategories(e.categories)
+	syncService.SetPriceList(e.config.ExternalAPI.PriceList)
+	if !e.config.Sync.ItemRules.Empty() {
+		// The patterns are checked by config.Validate
+		if items, err := repo.NewItemFilter(e.config.Sync.ItemRules); err != nil {
+			log.Printf("Ignoring the item rules: %v\n", err)
+		} else {
+			syncService.SetItemFilter(items)
+		}
+	}
+	if e.config.Images.Enabled {
+		media := repo.NewMediaRepository(e.db)
+		media.SetTable(e.config.Database.Schema, e.config.Database.ProductsTable)
+		syncService.SetImages(media, e.imageFetcher(), e.config.Images)
+	}
+	syncService.SetDryRun(opts.DryRun)
+	if e.outbox != nil {
+		syncService.SetOutbox(e.outbox, e.sinks)
+	}
+	// Changes are only audited against a recorded run, so dry runs and runs
+	// without one leave no trace in the audit log, which only exists in Postgres
+	if !opts.DryRun && opts.RunID != 0 && !portable(e.config) {
+		audit := repo.NewAuditRepository(e.db)
+		audit.SetTable(e.config.Database.Schema, e.config.Database.ProductsTable)
+		syncService.SetAudit(audit, opts.RunID)
+	}
+	// Plans held for approval are kept in Postgres too
+	if e.config.Sync.RequireApproval && !portable(e.config) {
+		plans := repo.NewPlanRepository(e.db)
+		plans.SetClock(e.now)
+		syncService.SetApprovals(plans)
+	}
+	return syncService
+}
+
+// syncPriorityItems fetches and syncs the configured priority items of the
+// shard ahead of the full catalog. It returns the items it synced and their
+// result, or nothing when no priority items are configured or the pass failed,
+// in which case they are simply synced with the rest.
+func (e *Engine) syncPriorityItems(ctx context.Context, syncService *repo.SyncService, opts Options) ([]models.ExternalItem, *models.SyncResult) {
+	codes := e.config.Sync.PriorityItems
+	if e.config.Sync.PriorityFromDB {
+		var err error
+		if codes, err = repo.NewPriorityRepository(e.db).ListPriorityItemCodes(ctx, e.config.Sync.PriorityLimit); err != nil {
+			log.Printf("Priority sync skipped: %v\n", err)
+			return nil, nil
+		}
+	}
+	if len(codes) == 0 {
+		return nil, nil
+	}
+
+	fetched, err := e.source.FetchByCodes(ctx, codes)
+	if err != nil {
+		log.Printf("Priority sync skipped: %v\n", err)
+		return nil, nil
+	}
+	items := e.shardItems(fetched.Items, opts)
+
+	log.Printf("Synchronizing %d priority items first...\n", len(items))
+	result, err := syncService.CompareAndSync(ctx, items)
+	if err != nil {
+		log.Printf("Priority sync failed: %v\n", err)
+		return nil, nil
+	}
+	return items, result
+}
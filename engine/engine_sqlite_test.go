@@ -0,0 +1,70 @@
+//go:build sqlite
+
+package engine
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"go-cron/config"
+	"go-cron/internal/testserver"
+	"go-cron/internal/utils"
+	"go-cron/models"
+	"go-cron/repo"
+)
+
+// Test_Engine_Run_SQLite tests syncing the items into a SQLite database
+// through the driver built in with -tags sqlite, creating then renaming them
+func Test_Engine_Run_SQLite(t *testing.T) {
+	server := testserver.New(
+		models.ExternalItem{ItemCode: "A001", ItemName: "Green Tea"},
+		models.ExternalItem{ItemCode: "A002", ItemName: "Black Tea"},
+	)
+	defer server.Close()
+	server.Setenv(t)
+	t.Setenv("GO_CRON_CONFIG", "")
+	t.Setenv("CRON_SECRET", "secret")
+	t.Setenv("DATABASE_DIALECT", models.DatabaseDialectSQLite)
+	t.Setenv("DATABASE_URL", filepath.Join(t.TempDir(), "gocron.db"))
+	t.Setenv("AUTO_CREATE_SCHEMA", "true")
+	t.Setenv("SYNC_WRITES", "true")
+	cfg := config.LoadConfig()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Invalid configuration: %v", err)
+	}
+
+	db, err := utils.OpenDB(cfg)
+	if err != nil {
+		t.Fatalf("OpenDB failed: %v", err)
+	}
+	defer utils.CloseDB()
+	ctx := context.Background()
+
+	report, err := New(cfg, db).Run(ctx, Options{})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if report.Result.Created != 2 || len(report.Result.Errors) > 0 {
+		t.Fatalf("Expected 2 products created, got %+v", report.Result)
+	}
+
+	server.SetItems(
+		models.ExternalItem{ItemCode: "A001", ItemName: "Green Tea"},
+		models.ExternalItem{ItemCode: "A002", ItemName: "Black Tea Leaves"},
+	)
+	if report, err = New(cfg, db).Run(ctx, Options{}); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if report.Result.Created != 1 || len(report.Result.Errors) > 0 {
+		t.Fatalf("Expected the renamed item to be created, got %+v", report.Result)
+	}
+
+	products, err := repo.NewSQLProductRepository(db, repo.DialectSQLite).GetAllProducts(ctx)
+	if err != nil {
+		t.Fatalf("GetAllProducts failed: %v", err)
+	}
+	if len(products) != 3 {
+		t.Errorf("Expected 3 stored products, got %+v", products)
+	}
+}
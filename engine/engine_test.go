@@ -0,0 +1,144 @@
+package engine
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go-cron/config"
+	"go-cron/internal/testserver"
+	"go-cron/models"
+	"go-cron/repo"
+)
+
+// emptyDriver is a database/sql driver answering every count with zero, other
+// queries with no rows and statements with no affected rows, standing in for
+// an empty catalog
+type emptyDriver struct{}
+
+func (emptyDriver) Open(name string) (driver.Conn, error) { return emptyConn{}, nil }
+
+type emptyConn struct{}
+
+func (emptyConn) Prepare(query string) (driver.Stmt, error) { return emptyStmt{query}, nil }
+func (emptyConn) Close() error                              { return nil }
+func (emptyConn) Begin() (driver.Tx, error)                 { return emptyTx{}, nil }
+
+type emptyTx struct{}
+
+func (emptyTx) Commit() error   { return nil }
+func (emptyTx) Rollback() error { return nil }
+
+type emptyStmt struct{ query string }
+
+func (emptyStmt) Close() error  { return nil }
+func (emptyStmt) NumInput() int { return -1 }
+func (emptyStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(0), nil
+}
+func (s emptyStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &emptyRows{count: strings.Contains(strings.ToUpper(s.query), "COUNT(")}, nil
+}
+
+type emptyRows struct{ count bool }
+
+func (r *emptyRows) Columns() []string {
+	if r.count {
+		return []string{"count"}
+	}
+	return nil
+}
+func (r *emptyRows) Close() error { return nil }
+func (r *emptyRows) Next(dest []driver.Value) error {
+	if !r.count {
+		return io.EOF
+	}
+	r.count = false
+	dest[0] = int64(0)
+	return nil
+}
+
+func init() {
+	sql.Register("engine-empty", emptyDriver{})
+}
+
+// Test_Engine_Run_Partitioned tests syncing item groups as concurrent
+// pipelines reporting their progress; run it with -race
+func Test_Engine_Run_Partitioned(t *testing.T) {
+	server := testserver.New(
+		models.ExternalItem{ItemCode: "A001", ItemName: "Green Tea"},
+		models.ExternalItem{ItemCode: "B001", ItemName: "Black Tea"},
+	)
+	defer server.Close()
+	server.Setenv(t)
+	t.Setenv("GO_CRON_CONFIG", "")
+	t.Setenv("CRON_SECRET", "secret")
+	t.Setenv("DATABASE_URL", "postgres://localhost/gocron")
+	t.Setenv("ITEMS_GROUP_CODES", "100,101,102")
+	t.Setenv("SYNC_PARTITION_BY_GROUP", "true")
+	t.Setenv("SYNC_PARTITION_WORKERS", "3")
+	cfg := config.LoadConfig()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Invalid configuration: %v", err)
+	}
+
+	db, err := sql.Open("engine-empty", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	progress := func(phase string, done, total int) {}
+	report, err := New(cfg, db).Run(context.Background(), Options{Progress: progress})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(report.Result.Groups) != 3 {
+		t.Fatalf("Expected a result per item group, got %+v", report.Result.Groups)
+	}
+	for _, group := range report.Result.Groups {
+		if group.ItemsFetched != 2 || group.Result.Created != 2 {
+			t.Errorf("Expected group %d to plan its items, got %+v", group.GroupCode, group.Result)
+		}
+	}
+}
+
+// Test_Engine_LoadCategories_Unreadable tests that categories which cannot be
+// read leave the configured ones in place
+func Test_Engine_LoadCategories_Unreadable(t *testing.T) {
+	db, err := sql.Open("engine-empty", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	configured := map[int]string{100: "Tea"}
+	e := New(&models.AppConfig{Sync: models.SyncConfig{CategoriesFromDB: true}}, db)
+	e.categories = configured
+	e.loadCategories(context.Background())
+	if !reflect.DeepEqual(e.categories, configured) {
+		t.Errorf("Expected the configured categories to be kept, got %v", e.categories)
+	}
+}
+
+// Test_Engine_ShardItems tests that priority items of a run sharded at source
+// are ranged like the fetch of the run, lowercase codes included
+func Test_Engine_ShardItems(t *testing.T) {
+	items := []models.ExternalItem{{ItemCode: "A100"}, {ItemCode: "a100"}}
+	opts := Options{Shard: &models.ShardAssignment{Shard: 1, Shards: 4}}
+
+	e := New(&models.AppConfig{Source: models.SourceConfig{Kind: models.SourceSAP}}, nil)
+	from, to := repo.ShardRange(1, 4)
+	if got := e.shardItems(items, opts); !reflect.DeepEqual(got, repo.FilterRange(items, from, to)) || len(got) != 1 {
+		t.Errorf("Expected the ItemCode range of the fetch, got %+v", got)
+	}
+
+	e = New(&models.AppConfig{Source: models.SourceConfig{Kind: models.SourceCSV}}, nil)
+	if got := e.shardItems(items, opts); len(got) != 2 {
+		t.Errorf("Expected both codes in the shard of a whole catalog, got %+v", got)
+	}
+}
@@ -0,0 +1,124 @@
+package engine
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"go-cron/external"
+	"go-cron/internal/recovery"
+	"go-cron/models"
+	"go-cron/sources"
+)
+
+// groupPipeline is the fetch and sync of a single item group
+type groupPipeline struct {
+	code    int
+	fetched *external.FetchResult
+	result  *models.SyncResult
+	err     error
+}
+
+// partitioned reports whether the run syncs every item group as its own
+// pipeline. Runs capped by MaxItems or sampled and custom sources sync the
+// feed as a whole.
+func (e *Engine) partitioned(opts Options) bool {
+	return e.config.Sync.PartitionByGroup && len(e.config.ExternalAPI.GroupCodes) > 1 &&
+		!opts.limited() && e.source.Name() == models.SourceSAP
+}
+
+// groupSource returns the source of the items of a single group of the run
+func (e *Engine) groupSource(code int, opts Options) sources.Source {
+	config := *e.config
+	config.ExternalAPI.GroupCodes = []int{code}
+	return sources.FromConfig(e.shardConfig(&config, opts))
+}
+
+// syncGroups fetches the items of every group concurrently, each with its own
+// count query and page workers, checks the combined feed and then syncs the
+// groups concurrently with a sync service each. The feed check needs every
+// group, so no group is written before all were fetched. The combined result
+// breaks down the groups in Groups; integrity is asserted once for all groups.
+func (e *Engine) syncGroups(ctx context.Context, opts Options, mode string, since time.Time, prioritySynced []models.ExternalItem) (*external.FetchResult, *models.SyncResult, error) {
+	pipelines := make([]*groupPipeline, len(e.config.ExternalAPI.GroupCodes))
+	for i, code := range e.config.ExternalAPI.GroupCodes {
+		pipelines[i] = &groupPipeline{code: code}
+	}
+	log.Printf("Syncing %d item groups, %d at a time\n", len(pipelines), e.config.Sync.PartitionWorkers)
+
+	e.eachGroup(pipelines, func(p *groupPipeline) {
+		p.fetched, p.err = e.fetch(ctx, e.groupSource(p.code, opts), mode, since)
+	})
+	fetched := &external.FetchResult{}
+	for _, p := range pipelines {
+		if p.err != nil {
+			return nil, nil, p.err
+		}
+		fetched.Items = append(fetched.Items, p.fetched.Items...)
+		fetched.Invalid = append(fetched.Invalid, p.fetched.Invalid...)
+		fetched.TotalCount += p.fetched.TotalCount
+	}
+	if err := e.checkFeed(ctx, opts, mode, len(fetched.Items)); err != nil {
+		return fetched, nil, err
+	}
+
+	productsBefore, countErr := e.writer.CountProducts(ctx)
+	e.eachGroup(pipelines, func(p *groupPipeline) {
+		syncService := e.newSyncService(opts)
+		syncService.SetIntegrityCheck(false)
+		skipSynced(syncService, mode)
+		p.result, p.err = syncService.CompareAndSync(ctx, e.runItems(p.fetched.Items, opts, prioritySynced))
+	})
+
+	result := &models.SyncResult{Status: models.SyncStatusOK}
+	var syncErr error
+	for _, p := range pipelines {
+		if p.err != nil {
+			log.Printf("Sync of item group %d failed: %v\n", p.code, p.err)
+			if syncErr == nil {
+				syncErr = &StageError{Stage: StageSync, Err: p.err}
+			}
+			continue
+		}
+		recordConcurrency(p.result, p.fetched)
+		result.Add(p.result)
+		result.Status = models.WorseStatus(result.Status, p.result.Status)
+		group := *p.result
+		group.Diffs = nil
+		result.Groups = append(result.Groups, models.GroupSyncResult{GroupCode: p.code, ItemsFetched: len(p.fetched.Items), Result: &group})
+	}
+	if syncErr != nil {
+		return fetched, result, syncErr
+	}
+
+	// The product count only adds up once every group has written
+	if countErr != nil {
+		log.Printf("Integrity check skipped: %v\n", countErr)
+	} else if !opts.DryRun && result.Status != models.SyncStatusTimedOut {
+		e.newSyncService(opts).VerifyIntegrity(ctx, productsBefore, result)
+	}
+	return fetched, result, nil
+}
+
+// eachGroup runs fn on every pipeline, PartitionWorkers at a time
+func (e *Engine) eachGroup(pipelines []*groupPipeline, fn func(p *groupPipeline)) {
+	sem := make(chan struct{}, e.config.Sync.PartitionWorkers)
+	var wg sync.WaitGroup
+	for _, p := range pipelines {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(p *groupPipeline) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			// A panicking group fails on its own
+			defer func() {
+				if err := recovery.Error(recover()); err != nil {
+					p.err = err
+				}
+			}()
+			fn(p)
+		}(p)
+	}
+	wg.Wait()
+}
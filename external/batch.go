@@ -0,0 +1,194 @@
+package external
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-cron/models"
+	"go-cron/tracing"
+)
+
+// FetchAllItemsByBatch fetches the totalCount items in $top/$skip pages of
+// pageSize, bundling batchPages pages into each OData $batch request so a
+// high-latency link pays one round trip per batch instead of per page
+func FetchAllItemsByBatch(ctx context.Context, config *models.AppConfig, sessionID string, totalCount, pageSize, batchPages int) ([]models.ExternalItem, []models.ItemValidationError, error) {
+	var allItems []models.ExternalItem
+	var allInvalid []models.ItemValidationError
+	for skip := 0; skip < totalCount; {
+		var pages []PageJob
+		for len(pages) < batchPages && skip < totalCount {
+			pages = append(pages, PageJob{Skip: skip, Top: min(pageSize, totalCount-skip)})
+			skip += pageSize
+		}
+
+		log.Printf("Fetching %d pages from skip=%d in one batch\n", len(pages), pages[0].Skip)
+		responses, err := fetchBatch(ctx, config, sessionID, pages)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error fetching batch at skip %d: %w", pages[0].Skip, err)
+		}
+		for i, page := range pages {
+			items, invalid, err := decodeConfigured(config, responses[i].Value)
+			if err != nil {
+				return nil, nil, err
+			}
+			allItems = append(allItems, items...)
+			allInvalid = append(allInvalid, invalid...)
+
+			// A server capping its pages below pageSize leaves the rest of the page to fetch
+			if got := len(responses[i].Value); got > 0 && got < page.Top {
+				log.Printf("Server returned %d of %d items at skip=%d, fetching the rest of the page\n", got, page.Top, page.Skip)
+				items, invalid, err := FetchItemsPage(ctx, config, sessionID, page.Top-got, page.Skip+got)
+				if err != nil {
+					return nil, nil, fmt.Errorf("error fetching page at skip %d: %w", page.Skip+got, err)
+				}
+				allItems = append(allItems, items...)
+				allInvalid = append(allInvalid, invalid...)
+			}
+		}
+	}
+	return allItems, allInvalid, nil
+}
+
+// fetchBatch requests pages in one $batch request, retrying transient
+// Service Layer errors, and returns their responses in the order of pages
+func fetchBatch(ctx context.Context, config *models.AppConfig, sessionID string, pages []PageJob) ([]*models.ItemsResponse, error) {
+	ctx, span := tracing.Start(ctx, "sap.batch", tracing.Int("sap.pages", len(pages)), tracing.Int("sap.skip", pages[0].Skip))
+	defer span.End()
+	defer recordPage(ctx, time.Now())
+
+	var responses []*models.ItemsResponse
+	err := withRetry(ctx, func() (err error) {
+		responses, err = fetchBatchOnce(ctx, config, sessionID, pages)
+		return err
+	})
+	span.RecordError(err)
+	return responses, err
+}
+
+// fetchBatchOnce sends one $batch request of a GET per page and reads the
+// page of each part of the multipart response
+func fetchBatchOnce(ctx context.Context, config *models.AppConfig, sessionID string, pages []PageJob) ([]*models.ItemsResponse, error) {
+	boundary := batchBoundary()
+	body, err := batchBody(config, boundary, pages)
+	if err != nil {
+		return nil, err
+	}
+
+	batchURL, err := url.Parse(strings.TrimSuffix(config.ExternalAPI.ExternalAPIURL, "/") + "/$batch")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse base URL: %v", err)
+	}
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	jar.SetCookies(batchURL, []*http.Cookie{{Name: "B1SESSION", Value: sessionID}})
+	client, err := newHTTPClient(config, jar)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", batchURL.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "multipart/mixed; boundary="+boundary)
+	req.Header.Set("Accept", "multipart/mixed")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		return nil, newAPIError("batch", resp)
+	}
+	return readBatchResponse(resp, len(pages))
+}
+
+// batchBoundary returns a random multipart boundary
+func batchBoundary() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "batch_" + hex.EncodeToString(b)
+}
+
+// batchBody returns the multipart body of a $batch request of a GET per page.
+// The request lines carry the path of the items URL, as the Service Layer
+// resolves them against its root rather than the $batch URL.
+func batchBody(config *models.AppConfig, boundary string, pages []PageJob) ([]byte, error) {
+	var b bytes.Buffer
+	for _, page := range pages {
+		pageURL, err := itemsURL(config, map[string]string{"$top": strconv.Itoa(page.Top), "$skip": strconv.Itoa(page.Skip)})
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&b, "--%s\r\nContent-Type: application/http\r\nContent-Transfer-Encoding: binary\r\n\r\n", boundary)
+		fmt.Fprintf(&b, "GET %s HTTP/1.1\r\nAccept: application/json\r\n", pageURL.RequestURI())
+		if config.ExternalAPI.MaxPageSize > 0 {
+			fmt.Fprintf(&b, "Prefer: odata.maxpagesize=%d\r\n", config.ExternalAPI.MaxPageSize)
+		}
+		// The blank line ends the headers; the CRLF after it belongs to the next boundary
+		b.WriteString("\r\n\r\n")
+	}
+	fmt.Fprintf(&b, "--%s--\r\n", boundary)
+	return b.Bytes(), nil
+}
+
+// readBatchResponse reads the page of each part of a $batch response. A part
+// that failed fails the batch with its Service Layer error, so it is retried
+// like a failed page.
+func readBatchResponse(resp *http.Response, parts int) ([]*models.ItemsResponse, error) {
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		return nil, fmt.Errorf("unexpected batch response type %q", resp.Header.Get("Content-Type"))
+	}
+
+	reader := multipart.NewReader(resp.Body, params["boundary"])
+	responses := make([]*models.ItemsResponse, 0, parts)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid batch response: %w", err)
+		}
+		partResp, err := http.ReadResponse(bufio.NewReader(part), nil)
+		if err != nil {
+			return nil, fmt.Errorf("invalid batch response part %d: %w", len(responses)+1, err)
+		}
+		if partResp.StatusCode != http.StatusOK {
+			apiErr := newAPIError("fetch", partResp)
+			partResp.Body.Close()
+			return nil, apiErr
+		}
+		var itemsResp models.ItemsResponse
+		err = json.NewDecoder(partResp.Body).Decode(&itemsResp)
+		partResp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid batch response part %d: %w", len(responses)+1, err)
+		}
+		responses = append(responses, &itemsResp)
+	}
+	if len(responses) != parts {
+		return nil, fmt.Errorf("batch response has %d parts, expected %d", len(responses), parts)
+	}
+	return responses, nil
+}
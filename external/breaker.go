@@ -0,0 +1,112 @@
+package external
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// CircuitOpenError is returned instead of sending a request once the circuit
+// breaker of the run opened
+type CircuitOpenError struct {
+	Failures  int
+	LastError error
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit open after %d consecutive failed requests to the external API: %v", e.Failures, e.LastError)
+}
+
+func (e *CircuitOpenError) Unwrap() error {
+	return e.LastError
+}
+
+// IsCircuitOpen reports whether err was returned by an open circuit breaker
+func IsCircuitOpen(err error) bool {
+	var open *CircuitOpenError
+	return errors.As(err, &open)
+}
+
+// Breaker stops the requests of a run to the Service Layer after threshold
+// consecutive requests failed because it was unreachable or overloaded, so a
+// run fails fast instead of retrying every page against a server that is down.
+// It is safe for concurrent use by the page workers.
+type Breaker struct {
+	mu        sync.Mutex
+	threshold int
+	failures  int
+	halfOpen  bool
+	lastErr   error
+}
+
+// NewBreaker creates a closed breaker opening after threshold consecutive failures
+func NewBreaker(threshold int) *Breaker {
+	return &Breaker{threshold: threshold}
+}
+
+// HalfOpen makes the breaker open on the first failure until a request
+// succeeds, for a run trying the external API again after an earlier run
+// opened the breaker
+func (b *Breaker) HalfOpen() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.halfOpen = true
+}
+
+// Open reports whether requests are stopped
+func (b *Breaker) Open() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.open()
+}
+
+// open reports whether requests are stopped; b.mu must be held
+func (b *Breaker) open() bool {
+	return b.failures > 0 && (b.halfOpen || b.failures >= b.threshold)
+}
+
+// allow returns a *CircuitOpenError while the breaker is open
+func (b *Breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.open() {
+		return &CircuitOpenError{Failures: b.failures, LastError: b.lastErr}
+	}
+	return nil
+}
+
+// record counts the outcome of a request: a success closes the breaker, a
+// failure to reach the Service Layer brings it closer to opening
+func (b *Breaker) record(err error) {
+	if err != nil && !IsUnavailable(err) {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		b.failures, b.halfOpen, b.lastErr = 0, false, nil
+		return
+	}
+	wasOpen := b.open()
+	b.failures++
+	b.lastErr = err
+	if !wasOpen && b.open() {
+		log.Printf("Circuit open after %d consecutive failed requests to the external API\n", b.failures)
+	}
+}
+
+// breakerKey is the context key of the breaker of a run
+type breakerKey struct{}
+
+// WithBreaker returns ctx stopping the requests of withRetry while b is open
+func WithBreaker(ctx context.Context, b *Breaker) context.Context {
+	return context.WithValue(ctx, breakerKey{}, b)
+}
+
+// breakerFrom returns the breaker of ctx, or nil
+func breakerFrom(ctx context.Context) *Breaker {
+	b, _ := ctx.Value(breakerKey{}).(*Breaker)
+	return b
+}
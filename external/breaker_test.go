@@ -0,0 +1,64 @@
+package external
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go-cron/internal/testserver"
+	"go-cron/models"
+)
+
+// Test_Breaker_FailsFast tests that requests stop once the threshold of
+// consecutive failures is reached and that the error still counts as the
+// Service Layer being unavailable
+func Test_Breaker_FailsFast(t *testing.T) {
+	defer func(backoff time.Duration) { requestBackoff = backoff }(requestBackoff)
+	requestBackoff = time.Millisecond
+
+	server := testserver.New(fakeItems(3)...)
+	defer server.Close()
+	config := &models.AppConfig{}
+	server.Configure(config)
+	server.Fail(testserver.EndpointCount, testserver.Unavailable, testserver.Unavailable, testserver.Unavailable,
+		testserver.Unavailable, testserver.Unavailable, testserver.Unavailable)
+
+	ctx := WithBreaker(context.Background(), NewBreaker(4))
+	if _, err := GetItemCount(ctx, config, "session"); err == nil || IsCircuitOpen(err) {
+		t.Fatalf("Expected the first count to fail after its retries, got %v", err)
+	}
+	_, err := GetItemCount(ctx, config, "session")
+	if !IsCircuitOpen(err) || !IsUnavailable(err) {
+		t.Fatalf("Expected the circuit to open, got %v", err)
+	}
+	if got := server.Requests(testserver.EndpointCount); got != 4 {
+		t.Errorf("Expected 4 requests before the circuit opened, got %d", got)
+	}
+}
+
+// Test_Breaker_HalfOpen tests that a half-open breaker opens on the first
+// failure and closes on a success, and that rejected requests are not counted
+func Test_Breaker_HalfOpen(t *testing.T) {
+	unavailable := &APIError{Op: "fetch", StatusCode: 503}
+
+	breaker := NewBreaker(3)
+	breaker.HalfOpen()
+	breaker.record(nil)
+	breaker.record(unavailable)
+	if breaker.Open() {
+		t.Error("Expected a success to close the half-open breaker")
+	}
+
+	breaker = NewBreaker(3)
+	breaker.HalfOpen()
+	breaker.record(&APIError{Op: "fetch", StatusCode: 400})
+	if breaker.Open() {
+		t.Error("Expected a rejected request not to open the breaker")
+	}
+	breaker.record(unavailable)
+	var open *CircuitOpenError
+	if err := breaker.allow(); !errors.As(err, &open) || open.Failures != 1 {
+		t.Errorf("Expected the first failure to open the half-open breaker, got %v", err)
+	}
+}
@@ -0,0 +1,773 @@
+package external
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-cron/internal/recovery"
+	"go-cron/models"
+	"go-cron/tracing"
+)
+
+// itemFields are the item fields requested with $select and decoded by DecodeItems
+var itemFields = []string{"ItemCode", "ItemName", "ItemsGroupCode"}
+
+// priceFields is the item price collection, selected when a price list is synced
+const priceFields = "ItemPrices"
+
+// pictureField is the picture file name, selected when images are synced
+const pictureField = "Picture"
+
+// updateDateField is the day of the last change of an item, selected by
+// incremental syncs to skip the items synced since
+const updateDateField = "UpdateDate"
+
+// selectedFields returns the item fields requested with $select
+func selectedFields(config *models.AppConfig) []string {
+	fields := itemFields[:len(itemFields):len(itemFields)]
+	if config.ExternalAPI.PriceList > 0 {
+		fields = append(fields, priceFields)
+	}
+	if config.Images.Enabled {
+		fields = append(fields, pictureField)
+	}
+	if config.Sync.Incremental {
+		fields = append(fields, updateDateField)
+	}
+	// Mapped fields are read as well as the default ones, which keep the
+	// item code and the decoding of prices
+	if mapping, err := mappingFor(config); err == nil && mapping != nil {
+		for _, field := range mapping.sources {
+			if !containsField(fields, field) {
+				fields = append(fields, field)
+			}
+		}
+	}
+	return fields
+}
+
+// containsField reports whether fields includes field
+func containsField(fields []string, field string) bool {
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// FetchResult contains the items fetched from the external API
+type FetchResult struct {
+	Items      []models.ExternalItem
+	TotalCount int
+	Invalid    []models.ItemValidationError
+	// Concurrency describes the page workers of a $skip fetch, nil for other fetches
+	Concurrency *models.FetchConcurrency
+	// Timings holds the login, count and fetch steps of the fetch
+	Timings *models.Timings
+}
+
+// FetchAllItems logs in to the external API, counts and fetches every item
+// matching the configured filter, and logs out again. The whole fetch is bounded
+// by the configured fetch timeout so a slow API leaves time for the database sync.
+func FetchAllItems(ctx context.Context, config *models.AppConfig) (*FetchResult, error) {
+	parent := ctx
+	if config.ExternalAPI.FetchTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.ExternalAPI.FetchTimeout)
+		defer cancel()
+	}
+
+	result, err := fetchAllItems(ctx, config)
+	if err != nil && ctx.Err() == context.DeadlineExceeded && parent.Err() == nil {
+		return nil, fmt.Errorf("fetch exceeded its %v timeout: %w", config.ExternalAPI.FetchTimeout, err)
+	}
+	return result, err
+}
+
+// FetchItemsUpdatedSince fetches the items matching the configured filter
+// whose UpdateDate or CreateDate is on or after the day of since, for
+// incremental syncs. Like FetchAllItems it is bounded by the fetch timeout.
+func FetchItemsUpdatedSince(ctx context.Context, config *models.AppConfig, since time.Time) (*FetchResult, error) {
+	incremental := *config
+	incremental.ExternalAPI.Filter = "(" + itemsFilter(config) + ") and (" + updatedSinceFilter(since) + ")"
+	return FetchAllItems(ctx, &incremental)
+}
+
+// WithItemCodeRange returns a copy of config fetching only the items whose
+// ItemCode is from from up to but excluding to; an empty bound is left open
+func WithItemCodeRange(config *models.AppConfig, from, to string) *models.AppConfig {
+	var bounds []string
+	if from != "" {
+		bounds = append(bounds, "ItemCode ge '"+strings.ReplaceAll(from, "'", "''")+"'")
+	}
+	if to != "" {
+		bounds = append(bounds, "ItemCode lt '"+strings.ReplaceAll(to, "'", "''")+"'")
+	}
+	if len(bounds) == 0 {
+		return config
+	}
+	ranged := *config
+	ranged.ExternalAPI.Filter = strings.Join(bounds, " and ")
+	if filter := itemsFilter(config); filter != "" {
+		ranged.ExternalAPI.Filter = "(" + filter + ") and (" + ranged.ExternalAPI.Filter + ")"
+	}
+	return &ranged
+}
+
+// updatedSinceFilter returns an OData filter matching items created or updated on or after the day of since
+func updatedSinceFilter(since time.Time) string {
+	day := since.UTC().Format("2006-01-02")
+	return "UpdateDate ge '" + day + "' or CreateDate ge '" + day + "'"
+}
+
+// fetchAllItems runs the login, count, fetch and logout steps of FetchAllItems
+func fetchAllItems(ctx context.Context, config *models.AppConfig) (*FetchResult, error) {
+	timings := &models.Timings{}
+	step := time.Now()
+
+	// Step 1: Login and get session
+	log.Println("Logging in to external API...")
+	sessionID, err := loginOrWarm(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("login failed: %w", err)
+	}
+	log.Printf("Logged in successfully with session: %s\n", sessionID)
+	timings.LoginMs, step = time.Since(step).Milliseconds(), time.Now()
+
+	// Ensure logout happens at the end
+	defer func() {
+		if err := Logout(config, sessionID); err != nil {
+			log.Printf("Logout failed: %v\n", err)
+		} else {
+			log.Println("Logged out successfully")
+		}
+	}()
+
+	// Step 2: Get the total count of items
+	log.Println("Fetching item count from external API...")
+	count, err := GetItemCount(ctx, config, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get item count: %w", err)
+	}
+	log.Printf("Total count of items: %d\n", count)
+	timings.CountMs, step = time.Since(step).Milliseconds(), time.Now()
+
+	// Step 3: Fetch all items, following nextLinks, in $batch requests or with a worker pool over $skip
+	pages := &pageTimer{}
+	ctx = withPageTimer(ctx, pages)
+	var items []models.ExternalItem
+	var invalid []models.ItemValidationError
+	var concurrency *models.FetchConcurrency
+	switch config.ExternalAPI.Pagination {
+	case models.PaginationNextLink:
+		log.Println("Starting nextLink fetch...")
+		items, invalid, err = FetchAllItemsByNextLink(ctx, config, sessionID, config.ExternalAPI.PageSize)
+	case models.PaginationBatch:
+		log.Printf("Starting batch fetch of %d pages per request...\n", config.ExternalAPI.BatchPages)
+		items, invalid, err = FetchAllItemsByBatch(ctx, config, sessionID, count, config.ExternalAPI.PageSize, config.ExternalAPI.BatchPages)
+	default:
+		numWorkers := config.ExternalAPI.NumWorkers
+		log.Printf("Starting concurrent fetch with up to %d workers...\n", numWorkers)
+		items, invalid, concurrency, err = fetchConcurrently(ctx, config, sessionID, count, config.ExternalAPI.PageSize, numWorkers)
+		log.Printf("Fetch ended with %d of %d workers (fewest %d, %d throttled and %d slow pages)\n",
+			concurrency.Final, concurrency.Initial, concurrency.Min, concurrency.Throttled, concurrency.Slow)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch items: %w", err)
+	}
+	// A short feed would pass the items left out for products gone from the catalog
+	if fetched := len(items) + len(invalid); fetched != count {
+		return nil, fmt.Errorf("failed to fetch items: got %d of the %d items counted", fetched, count)
+	}
+	log.Printf("Successfully fetched %d items from external API (%d invalid)\n", len(items), len(invalid))
+	timings.FetchMs, timings.Pages = time.Since(step).Milliseconds(), pages.timings()
+
+	// Clean up free-text fields before they reach the database
+	SanitizeItems(items, config.Sanitize)
+
+	return &FetchResult{Items: items, TotalCount: count, Invalid: invalid, Concurrency: concurrency, Timings: timings}, nil
+}
+
+// priorityChunkSize is how many item codes are requested per priority fetch, keeping URLs short
+const priorityChunkSize = 50
+
+// FetchItemsByCodes logs in to the external API and fetches the items among
+// codes that match the configured filter, in the order of codes, so they can
+// be synced ahead of the full catalog
+func FetchItemsByCodes(ctx context.Context, config *models.AppConfig, codes []string) (*FetchResult, error) {
+	sessionID, err := Login(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("login failed: %w", err)
+	}
+	defer func() {
+		if err := Logout(config, sessionID); err != nil {
+			log.Printf("Logout failed: %v\n", err)
+		}
+	}()
+
+	byCode := make(map[string]models.ExternalItem, len(codes))
+	var invalid []models.ItemValidationError
+	for start := 0; start < len(codes); start += priorityChunkSize {
+		end := min(start+priorityChunkSize, len(codes))
+		pageURL, err := itemsURL(config, nil)
+		if err != nil {
+			return nil, err
+		}
+		query := pageURL.Query()
+		query.Set("$filter", "("+itemsFilter(config)+") and ("+itemCodeFilter(codes[start:end])+")")
+		pageURL.RawQuery = query.Encode()
+
+		itemsResp, err := fetchPage(ctx, config, pageURL, sessionID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch priority items: %w", err)
+		}
+		items, pageInvalid, err := decodeConfigured(config, itemsResp.Value)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			byCode[item.ItemCode] = item
+		}
+		invalid = append(invalid, pageInvalid...)
+	}
+
+	items := make([]models.ExternalItem, 0, len(byCode))
+	for _, code := range codes {
+		if item, ok := byCode[code]; ok {
+			items = append(items, item)
+			delete(byCode, code)
+		}
+	}
+	SanitizeItems(items, config.Sanitize)
+
+	return &FetchResult{Items: items, TotalCount: len(items), Invalid: invalid}, nil
+}
+
+// itemCodeFilter returns an OData filter matching any of codes
+func itemCodeFilter(codes []string) string {
+	clauses := make([]string, len(codes))
+	for i, code := range codes {
+		clauses[i] = "ItemCode eq '" + strings.ReplaceAll(code, "'", "''") + "'"
+	}
+	return strings.Join(clauses, " or ")
+}
+
+// PageJob represents a page fetching job
+type PageJob struct {
+	Skip int
+	Top  int
+}
+
+// PageResult represents the result of fetching a page
+type PageResult struct {
+	Items   []models.ExternalItem
+	Invalid []models.ItemValidationError
+	Skip    int
+	Err     error
+}
+
+// FetchAllItemsConcurrently fetches all items from external API using a worker
+// pool of up to numWorkers workers that adapts to throttling (see adaptivePool)
+func FetchAllItemsConcurrently(ctx context.Context, config *models.AppConfig, sessionID string, totalCount, pageSize, numWorkers int) ([]models.ExternalItem, []models.ItemValidationError, error) {
+	items, invalid, _, err := fetchConcurrently(ctx, config, sessionID, totalCount, pageSize, numWorkers)
+	return items, invalid, err
+}
+
+// fetchConcurrently runs FetchAllItemsConcurrently and also returns how its workers adapted
+func fetchConcurrently(ctx context.Context, config *models.AppConfig, sessionID string, totalCount, pageSize, numWorkers int) ([]models.ExternalItem, []models.ItemValidationError, *models.FetchConcurrency, error) {
+	// Create job channel and result channel
+	jobs := make(chan PageJob, numWorkers*2)
+	results := make(chan PageResult, numWorkers*2)
+
+	// Start worker pool; the adaptive pool decides how many of them fetch at once
+	pool := newAdaptivePool(numWorkers, config.ExternalAPI.SlowPageThreshold)
+	var wg sync.WaitGroup
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go func(workerID int) {
+			defer wg.Done()
+			worker(ctx, workerID, config, sessionID, pool, jobs, results)
+		}(i)
+	}
+
+	// Send jobs to workers
+	go func() {
+		for skip := 0; skip < totalCount; skip += pageSize {
+			select {
+			// The last page asks for the remaining items only, so a short page always means a capped one
+			case jobs <- PageJob{Skip: skip, Top: min(pageSize, totalCount-skip)}:
+			case <-ctx.Done():
+				close(jobs)
+				return
+			}
+		}
+		close(jobs)
+	}()
+
+	// Collect results in a separate goroutine
+	allResults := make([]PageResult, 0)
+	var resultWg sync.WaitGroup
+	resultWg.Add(1)
+	go func() {
+		defer resultWg.Done()
+		for result := range results {
+			allResults = append(allResults, result)
+		}
+	}()
+
+	// Wait for all workers to finish
+	wg.Wait()
+	close(results)
+
+	// Wait for result collection to finish
+	resultWg.Wait()
+
+	// Workers leave without a result once the context ends, so the pages
+	// collected are not the whole feed
+	if err := ctx.Err(); err != nil {
+		return nil, nil, pool.concurrency(), fmt.Errorf("fetch stopped after %d of %d items: %w", countItems(allResults), totalCount, err)
+	}
+
+	// Check for errors and combine all items
+	var allItems []models.ExternalItem
+	var allInvalid []models.ItemValidationError
+	for _, result := range allResults {
+		if result.Err != nil {
+			return nil, nil, pool.concurrency(), fmt.Errorf("error fetching page at skip %d: %w", result.Skip, result.Err)
+		}
+		allItems = append(allItems, result.Items...)
+		allInvalid = append(allInvalid, result.Invalid...)
+	}
+
+	return allItems, allInvalid, pool.concurrency(), nil
+}
+
+// countItems returns the items and invalid items of results
+func countItems(results []PageResult) int {
+	n := 0
+	for _, result := range results {
+		n += len(result.Items) + len(result.Invalid)
+	}
+	return n
+}
+
+// worker is a worker goroutine that fetches pages from the external API
+func worker(ctx context.Context, workerID int, config *models.AppConfig, sessionID string, pool *adaptivePool, jobs <-chan PageJob, results chan<- PageResult) {
+	log.Printf("Worker %d started\n", workerID)
+
+	for job := range jobs {
+		select {
+		case <-ctx.Done():
+			log.Printf("Worker %d cancelled\n", workerID)
+			return
+		default:
+			generation, err := pool.acquire(ctx)
+			if err != nil {
+				log.Printf("Worker %d cancelled\n", workerID)
+				return
+			}
+			log.Printf("Worker %d fetching page at skip=%d\n", workerID, job.Skip)
+			throttled := false
+			pageCtx := withThrottleObserver(ctx, func() { throttled = true })
+			start := time.Now()
+			items, invalid, err := fetchItemsPageRecovered(pageCtx, config, sessionID, job.Top, job.Skip)
+			pool.release(generation, time.Since(start), throttled)
+
+			result := PageResult{
+				Items:   items,
+				Invalid: invalid,
+				Skip:    job.Skip,
+				Err:     err,
+			}
+
+			select {
+			case results <- result:
+				if err == nil {
+					log.Printf("Worker %d completed page at skip=%d (%d items)\n", workerID, job.Skip, len(items))
+				} else {
+					log.Printf("Worker %d error at skip=%d: %v\n", workerID, job.Skip, err)
+				}
+			case <-ctx.Done():
+				log.Printf("Worker %d cancelled while sending result\n", workerID)
+				return
+			}
+		}
+	}
+
+	log.Printf("Worker %d finished\n", workerID)
+}
+
+// fetchItemsPageRecovered runs FetchItemsPage, turning a panic into the error
+// of the page so a bad page fails the fetch instead of the function
+func fetchItemsPageRecovered(ctx context.Context, config *models.AppConfig, sessionID string, top, skip int) (items []models.ExternalItem, invalid []models.ItemValidationError, err error) {
+	defer func() {
+		if p := recovery.Error(recover()); p != nil {
+			err = p
+		}
+	}()
+	return FetchItemsPage(ctx, config, sessionID, top, skip)
+}
+
+// GetItemCount returns the number of items matching the configured filter,
+// retrying transient Service Layer errors
+func GetItemCount(ctx context.Context, config *models.AppConfig, sessionID string) (int, error) {
+	ctx, span := tracing.Start(ctx, "sap.count")
+	defer span.End()
+
+	var count int
+	err := withRetry(ctx, func() (err error) {
+		count, err = getItemCount(ctx, config, sessionID)
+		return err
+	})
+	span.SetAttributes(tracing.Int("sap.count", count))
+	span.RecordError(err)
+	return count, err
+}
+
+// getItemCount requests the number of items matching the configured filter once
+func getItemCount(ctx context.Context, config *models.AppConfig, sessionID string) (int, error) {
+	baseURL := config.ExternalAPI.ExternalAPIURL
+	u, err := url.Parse(baseURL + config.ExternalAPI.ItemsURL + "/$count?")
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse base URL: %v", err)
+	}
+
+	params := url.Values{}
+	params.Add("$select", strings.Join(selectedFields(config), ","))
+	params.Add("$filter", itemsFilter(config))
+	params.Add("$orderby", "ItemCode")
+
+	u.RawQuery = params.Encode()
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return 0, err
+	}
+	jar.SetCookies(u, []*http.Cookie{{Name: "B1SESSION", Value: sessionID}})
+
+	client, err := newHTTPClient(config, jar)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Accept", "text/plain")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, newAPIError("count fetch", resp)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := strconv.Atoi(strings.TrimSpace(string(body)))
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse count: %v", err)
+	}
+
+	return count, nil
+}
+
+// Login opens a Service Layer session and returns its session ID, retrying
+// transient Service Layer errors and giving up after the configured login
+// timeout. The accounts of the credentials provider of config are tried in
+// turn while the Service Layer rejects them.
+func Login(ctx context.Context, config *models.AppConfig) (string, error) {
+	ctx, span := tracing.Start(ctx, "sap.login")
+	defer span.End()
+
+	if config.ExternalAPI.LoginTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.ExternalAPI.LoginTimeout)
+		defer cancel()
+	}
+
+	accounts, err := NewCredentialsProvider(config).Credentials(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return "", err
+	}
+
+	var sessionID string
+	for i, account := range accounts {
+		err = withRetry(ctx, func() (err error) {
+			sessionID, err = login(ctx, config, account)
+			return err
+		})
+		if err == nil || !credentialsRejected(err) || i == len(accounts)-1 {
+			break
+		}
+		log.Printf("Login as %s rejected, trying the next credentials: %v\n", account.UserName, err)
+	}
+	span.RecordError(err)
+	return sessionID, err
+}
+
+// login sends a single login request for account
+func login(ctx context.Context, config *models.AppConfig, account models.Credentials) (string, error) {
+	loginURL := config.ExternalAPI.ExternalAPIURL + config.ExternalAPI.LoginURL
+	jsonBody, err := json.Marshal(account)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", loginURL, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client, err := newHTTPClient(config, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", newAPIError("login", resp)
+	}
+
+	var loginResp models.LoginResponse
+	err = json.NewDecoder(resp.Body).Decode(&loginResp)
+	if err != nil {
+		return "", err
+	}
+
+	return loginResp.SessionID, nil
+}
+
+// FetchItemsPage fetches the top items from skip. A server capping its pages
+// below top returns fewer of them, so the rest is requested until top items
+// are fetched or a page comes back empty; otherwise the next page's $skip
+// would silently step over the items past the cap.
+func FetchItemsPage(ctx context.Context, config *models.AppConfig, sessionID string, top, skip int) ([]models.ExternalItem, []models.ItemValidationError, error) {
+	var items []models.ExternalItem
+	var invalid []models.ItemValidationError
+	for top > 0 {
+		pageURL, err := itemsURL(config, map[string]string{"$top": strconv.Itoa(top), "$skip": strconv.Itoa(skip)})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		itemsResp, err := fetchPage(ctx, config, pageURL, sessionID)
+		if err != nil {
+			return nil, nil, err
+		}
+		pageItems, pageInvalid, err := decodeConfigured(config, itemsResp.Value)
+		if err != nil {
+			return nil, nil, err
+		}
+		items = append(items, pageItems...)
+		invalid = append(invalid, pageInvalid...)
+
+		got := len(itemsResp.Value)
+		if got == 0 || got >= top {
+			break
+		}
+		log.Printf("Server returned %d of %d items at skip=%d, fetching the rest of the page\n", got, top, skip)
+		skip, top = skip+got, top-got
+	}
+	return items, invalid, nil
+}
+
+// FetchAllItemsByNextLink fetches every item one page at a time by following
+// the odata.nextLink returned with each page, for Service Layer versions that
+// cap $skip. The server decides the page size; pageSize only sizes the first request.
+func FetchAllItemsByNextLink(ctx context.Context, config *models.AppConfig, sessionID string, pageSize int) ([]models.ExternalItem, []models.ItemValidationError, error) {
+	// With a page size preference the server sizes every page, the first one included
+	params := map[string]string{"$top": strconv.Itoa(pageSize)}
+	if config.ExternalAPI.MaxPageSize > 0 {
+		params = nil
+	}
+	pageURL, err := itemsURL(config, params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var allItems []models.ExternalItem
+	var allInvalid []models.ItemValidationError
+	seen := make(map[string]bool)
+	for pageURL != nil {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		// A server echoing the same link would otherwise loop forever
+		if seen[pageURL.String()] {
+			return nil, nil, fmt.Errorf("nextLink loop detected at %s", pageURL)
+		}
+		seen[pageURL.String()] = true
+
+		log.Printf("Fetching page %d via nextLink\n", len(seen))
+		itemsResp, err := fetchPage(ctx, config, pageURL, sessionID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error fetching page %d: %w", len(seen), err)
+		}
+
+		items, invalid, err := decodeConfigured(config, itemsResp.Value)
+		if err != nil {
+			return nil, nil, err
+		}
+		allItems = append(allItems, items...)
+		allInvalid = append(allInvalid, invalid...)
+
+		pageURL = nil
+		if itemsResp.ODataNextLink != "" {
+			next, err := url.Parse(itemsResp.ODataNextLink)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid nextLink %q: %w", itemsResp.ODataNextLink, err)
+			}
+			// nextLink is usually relative to the entity set
+			pageURL = entitySetURL(config).ResolveReference(next)
+		}
+	}
+
+	return allItems, allInvalid, nil
+}
+
+// entitySetURL returns the items entity set URL that relative nextLinks resolve against
+func entitySetURL(config *models.AppConfig) *url.URL {
+	u, _ := url.Parse(config.ExternalAPI.ExternalAPIURL + config.ExternalAPI.ItemsURL)
+	return u
+}
+
+// itemsURL builds the items query URL with the select, filter and ordering of
+// every page plus the given extra query parameters
+func itemsURL(config *models.AppConfig, extra map[string]string) (*url.URL, error) {
+	u, err := url.Parse(config.ExternalAPI.ExternalAPIURL + config.ExternalAPI.ItemsURL + "?")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse base URL: %v", err)
+	}
+
+	params := url.Values{}
+	params.Add("$select", strings.Join(selectedFields(config), ","))
+	params.Add("$filter", itemsFilter(config))
+	params.Add("$orderby", "ItemCode")
+	for k, v := range extra {
+		params.Add(k, v)
+	}
+
+	u.RawQuery = params.Encode()
+	return u, nil
+}
+
+// fetchPage requests one page of items from u, bounded by the client's
+// per-request timeout and retrying transient Service Layer errors
+func fetchPage(ctx context.Context, config *models.AppConfig, u *url.URL, sessionID string) (*models.ItemsResponse, error) {
+	query := u.Query()
+	ctx, span := tracing.Start(ctx, "sap.page", tracing.String("sap.top", query.Get("$top")), tracing.String("sap.skip", query.Get("$skip")))
+	defer span.End()
+	defer recordPage(ctx, time.Now())
+
+	var itemsResp *models.ItemsResponse
+	err := withRetry(ctx, func() (err error) {
+		itemsResp, err = fetchPageOnce(ctx, config, u, sessionID)
+		return err
+	})
+	if itemsResp != nil {
+		span.SetAttributes(tracing.Int("sap.items", len(itemsResp.Value)))
+	}
+	span.RecordError(err)
+	return itemsResp, err
+}
+
+// fetchPageOnce requests one page of items from u
+func fetchPageOnce(ctx context.Context, config *models.AppConfig, u *url.URL, sessionID string) (*models.ItemsResponse, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	jar.SetCookies(u, []*http.Cookie{{Name: "B1SESSION", Value: sessionID}})
+
+	client, err := newHTTPClient(config, jar)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if config.ExternalAPI.MaxPageSize > 0 {
+		req.Header.Set("Prefer", "odata.maxpagesize="+strconv.Itoa(config.ExternalAPI.MaxPageSize))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError("fetch", resp)
+	}
+
+	var itemsResp models.ItemsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&itemsResp); err != nil {
+		return nil, err
+	}
+	return &itemsResp, nil
+}
+
+// Logout closes a Service Layer session
+func Logout(config *models.AppConfig, sessionID string) error {
+	baseURL := config.ExternalAPI.ExternalAPIURL
+	logoutURL := baseURL + "/Logout"
+
+	req, err := http.NewRequest("POST", logoutURL, nil)
+	if err != nil {
+		return err
+	}
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return err
+	}
+	u, _ := url.Parse(baseURL)
+	jar.SetCookies(u, []*http.Cookie{{Name: "B1SESSION", Value: sessionID}})
+
+	client, err := newHTTPClient(config, jar)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return newAPIError("logout", resp)
+	}
+
+	return nil
+}
@@ -0,0 +1,365 @@
+package external
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-cron/internal/testserver"
+	"go-cron/models"
+)
+
+// Test_FetchAllItemsByNextLink tests following relative nextLinks until the last page
+func Test_FetchAllItemsByNextLink(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if c, err := r.Cookie("B1SESSION"); err != nil || c.Value != "session" {
+			t.Errorf("Expected the session cookie, got %v", c)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Query().Get("$skiptoken") {
+		case "":
+			if r.URL.Query().Get("$top") != "2" {
+				t.Errorf("Expected the first request to ask for 2 items, got %q", r.URL.Query().Get("$top"))
+			}
+			fmt.Fprint(w, `{"value":[{"ItemCode":"A1","ItemName":"A","ItemsGroupCode":100},{"ItemCode":"B1","ItemName":"B","ItemsGroupCode":100}],
+				"odata.nextLink":"Items?$skiptoken=2"}`)
+		case "2":
+			fmt.Fprint(w, `{"value":[{"ItemCode":"C1","ItemName":"C","ItemsGroupCode":"bad"}]}`)
+		default:
+			t.Errorf("Unexpected request %s", r.URL)
+		}
+	}))
+	defer server.Close()
+
+	config := &models.AppConfig{ExternalAPI: models.ExternalApiConfig{ExternalAPIURL: server.URL + "/b1s/v1/", ItemsURL: "Items"}}
+	items, invalid, err := FetchAllItemsByNextLink(context.Background(), config, "session", 2)
+	if err != nil {
+		t.Fatalf("FetchAllItemsByNextLink failed: %v", err)
+	}
+
+	if requests != 2 {
+		t.Errorf("Expected 2 requests, got %d", requests)
+	}
+	if len(items) != 2 || items[1].ItemCode != "B1" {
+		t.Errorf("Expected items A1 and B1, got %+v", items)
+	}
+	if len(invalid) != 1 || invalid[0].ItemCode != "C1" {
+		t.Errorf("Expected C1 to be reported invalid, got %+v", invalid)
+	}
+}
+
+// Test_FetchAllItemsByNextLink_Loop tests that a repeated nextLink aborts the fetch
+func Test_FetchAllItemsByNextLink_Loop(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"value":[],"odata.nextLink":"Items?$skiptoken=1"}`)
+	}))
+	defer server.Close()
+
+	config := &models.AppConfig{ExternalAPI: models.ExternalApiConfig{ExternalAPIURL: server.URL + "/", ItemsURL: "Items"}}
+	if _, _, err := FetchAllItemsByNextLink(context.Background(), config, "session", 2); err == nil {
+		t.Error("Expected a nextLink loop to be reported")
+	}
+}
+
+// Test_FetchAllItems_FetchTimeout tests that a slow API is cut off by the fetch timeout
+func Test_FetchAllItems_FetchTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	config := &models.AppConfig{ExternalAPI: models.ExternalApiConfig{
+		ExternalAPIURL: server.URL,
+		LoginURL:       "/Login",
+		Timeout:        time.Minute,
+		LoginTimeout:   time.Minute,
+		FetchTimeout:   50 * time.Millisecond,
+	}}
+	start := time.Now()
+	_, err := FetchAllItems(context.Background(), config)
+	if err == nil || !strings.Contains(err.Error(), "fetch exceeded") {
+		t.Fatalf("Expected a fetch timeout error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Fetch took %v, want it cut off by the fetch timeout", elapsed)
+	}
+}
+
+// Test_FetchAllItemsConcurrently_Deadline tests that pages cut off by the
+// deadline fail the fetch instead of returning a short feed
+func Test_FetchAllItemsConcurrently_Deadline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("$skip") != "0" {
+			<-r.Context().Done()
+			return
+		}
+		fmt.Fprint(w, `{"value":[{"ItemCode":"A1","ItemName":"A","ItemsGroupCode":100}]}`)
+	}))
+	defer server.Close()
+
+	config := &models.AppConfig{ExternalAPI: models.ExternalApiConfig{ExternalAPIURL: server.URL, ItemsURL: "/Items", Timeout: time.Minute}}
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+	items, _, err := FetchAllItemsConcurrently(ctx, config, "session", 4, 1, 2)
+	if !errors.Is(err, context.DeadlineExceeded) || items != nil {
+		t.Errorf("Expected the deadline to fail the fetch, got %d items (%v)", len(items), err)
+	}
+}
+
+// Test_FetchAllItems_ShortFeed tests that a feed with fewer items than counted is rejected
+func Test_FetchAllItems_ShortFeed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/Login":
+			fmt.Fprint(w, `{"SessionId":"session"}`)
+		case "/Logout":
+			w.WriteHeader(http.StatusNoContent)
+		case "/Items/$count":
+			fmt.Fprint(w, "3")
+		case "/Items":
+			fmt.Fprint(w, `{"value":[{"ItemCode":"A1","ItemName":"A","ItemsGroupCode":100}]}`)
+		}
+	}))
+	defer server.Close()
+
+	config := &models.AppConfig{ExternalAPI: models.ExternalApiConfig{
+		ExternalAPIURL: server.URL, LoginURL: "/Login", ItemsURL: "/Items",
+		PageSize: 10, Pagination: models.PaginationNextLink,
+	}}
+	if _, err := FetchAllItems(context.Background(), config); err == nil || !strings.Contains(err.Error(), "1 of the 3") {
+		t.Errorf("Expected the short feed to be rejected, got %v", err)
+	}
+}
+
+// Test_FetchItemsByCodes tests that priority items are filtered by code and returned in priority order
+func Test_FetchItemsByCodes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/Login":
+			fmt.Fprint(w, `{"SessionId":"session"}`)
+		case "/Logout":
+			w.WriteHeader(http.StatusNoContent)
+		case "/Items":
+			want := "(ItemsGroupCode eq 100) and (ItemCode eq 'B1' or ItemCode eq 'O''Neil' or ItemCode eq 'A1')"
+			if got := r.URL.Query().Get("$filter"); got != want {
+				t.Errorf("Expected filter %q, got %q", want, got)
+			}
+			fmt.Fprint(w, `{"value":[{"ItemCode":"A1","ItemName":"A","ItemsGroupCode":100},{"ItemCode":"B1","ItemName":"B","ItemsGroupCode":100}]}`)
+		default:
+			t.Errorf("Unexpected request %s", r.URL)
+		}
+	}))
+	defer server.Close()
+
+	config := &models.AppConfig{ExternalAPI: models.ExternalApiConfig{
+		ExternalAPIURL: server.URL,
+		LoginURL:       "/Login",
+		ItemsURL:       "/Items",
+		GroupCodes:     []int{100},
+	}}
+	fetched, err := FetchItemsByCodes(context.Background(), config, []string{"B1", "O'Neil", "A1"})
+	if err != nil {
+		t.Fatalf("FetchItemsByCodes failed: %v", err)
+	}
+	if len(fetched.Items) != 2 || fetched.Items[0].ItemCode != "B1" || fetched.Items[1].ItemCode != "A1" {
+		t.Errorf("Expected items B1 then A1, got %+v", fetched.Items)
+	}
+}
+
+// Test_UpdatedSinceFilter tests the OData filter of incremental syncs
+func Test_UpdatedSinceFilter(t *testing.T) {
+	since := time.Date(2026, 3, 9, 23, 30, 0, 0, time.FixedZone("CET", 3600))
+	expected := "UpdateDate ge '2026-03-09' or CreateDate ge '2026-03-09'"
+	if got := updatedSinceFilter(since); got != expected {
+		t.Errorf("updatedSinceFilter = %q, want %q", got, expected)
+	}
+}
+
+// Test_WithItemCodeRange tests narrowing the configured filter to the
+// ItemCode range of a shard
+func Test_WithItemCodeRange(t *testing.T) {
+	config := &models.AppConfig{ExternalAPI: models.ExternalApiConfig{GroupCodes: []int{100, 101}}}
+	tests := []struct {
+		from, to string
+		want     string
+	}{
+		{"", "C", "(ItemsGroupCode eq 100 or ItemsGroupCode eq 101) and (ItemCode lt 'C')"},
+		{"C", "M", "(ItemsGroupCode eq 100 or ItemsGroupCode eq 101) and (ItemCode ge 'C' and ItemCode lt 'M')"},
+		{"M", "", "(ItemsGroupCode eq 100 or ItemsGroupCode eq 101) and (ItemCode ge 'M')"},
+		{"", "", "ItemsGroupCode eq 100 or ItemsGroupCode eq 101"},
+	}
+	for _, tt := range tests {
+		if got := itemsFilter(WithItemCodeRange(config, tt.from, tt.to)); got != tt.want {
+			t.Errorf("WithItemCodeRange(%q, %q) filters %q, want %q", tt.from, tt.to, got, tt.want)
+		}
+	}
+	if config.ExternalAPI.Filter != "" {
+		t.Errorf("Expected the configuration to be left alone, got %q", config.ExternalAPI.Filter)
+	}
+}
+
+// fakeItems returns n items with distinct codes and names
+func fakeItems(n int) []models.ExternalItem {
+	items := make([]models.ExternalItem, n)
+	for i := range items {
+		items[i] = models.ExternalItem{ItemCode: fmt.Sprintf("I%03d", i), ItemName: fmt.Sprintf("Item %d", i), ItemsGroupCode: 100}
+	}
+	return items
+}
+
+// Test_FetchAllItems_FakeServiceLayer tests a whole fetch against the fake
+// Service Layer with both pagination modes
+func Test_FetchAllItems_FakeServiceLayer(t *testing.T) {
+	for _, pagination := range []string{models.PaginationSkip, models.PaginationNextLink} {
+		t.Run(pagination, func(t *testing.T) {
+			server := testserver.New(fakeItems(5)...)
+			defer server.Close()
+			server.MaxPageSize = 2
+			server.NextLink = pagination == models.PaginationNextLink
+
+			config := &models.AppConfig{ExternalAPI: models.ExternalApiConfig{PageSize: 2, NumWorkers: 2, Pagination: pagination}}
+			server.Configure(config)
+			fetched, err := FetchAllItems(context.Background(), config)
+			if err != nil {
+				t.Fatalf("FetchAllItems failed: %v", err)
+			}
+
+			if fetched.TotalCount != 5 || len(fetched.Items) != 5 {
+				t.Errorf("Expected 5 of 5 items, got %d of %d", len(fetched.Items), fetched.TotalCount)
+			}
+			if got := server.Requests(testserver.EndpointItems); got != 3 {
+				t.Errorf("Expected 3 pages, got %d", got)
+			}
+			if fetched.Timings == nil || fetched.Timings.Pages == nil || fetched.Timings.Pages.Count != 3 {
+				t.Errorf("Expected the timings of 3 pages, got %+v", fetched.Timings)
+			}
+			if server.OpenSessions() != 0 {
+				t.Error("Expected the session to be logged out")
+			}
+		})
+	}
+}
+
+// Test_FetchAllItems_ServerPageCap tests that pages capped below PAGE_SIZE
+// lose no items in skip mode, and that a page size preference lets the server
+// drive nextLink paging
+func Test_FetchAllItems_ServerPageCap(t *testing.T) {
+	t.Run(models.PaginationSkip, func(t *testing.T) {
+		server := testserver.New(fakeItems(7)...)
+		defer server.Close()
+		server.MaxPageSize = 2
+		config := &models.AppConfig{ExternalAPI: models.ExternalApiConfig{PageSize: 5, NumWorkers: 1}}
+		server.Configure(config)
+
+		fetched, err := FetchAllItems(context.Background(), config)
+		if err != nil {
+			t.Fatalf("FetchAllItems failed: %v", err)
+		}
+		if len(fetched.Items) != 7 || fetched.Items[6].ItemCode != "I006" {
+			t.Errorf("Expected all 7 items, got %d", len(fetched.Items))
+		}
+		// Pages of 5 and 2 items, the first one fetched in 3 requests
+		if got := server.Requests(testserver.EndpointItems); got != 4 {
+			t.Errorf("Expected 4 requests, got %d", got)
+		}
+	})
+
+	t.Run(models.PaginationNextLink, func(t *testing.T) {
+		server := testserver.New(fakeItems(7)...)
+		defer server.Close()
+		config := &models.AppConfig{ExternalAPI: models.ExternalApiConfig{PageSize: 100, NumWorkers: 1, Pagination: models.PaginationNextLink, MaxPageSize: 3}}
+		server.Configure(config)
+
+		fetched, err := FetchAllItems(context.Background(), config)
+		if err != nil {
+			t.Fatalf("FetchAllItems failed: %v", err)
+		}
+		if len(fetched.Items) != 7 {
+			t.Errorf("Expected all 7 items, got %d", len(fetched.Items))
+		}
+		if got := server.Requests(testserver.EndpointItems); got != 3 {
+			t.Errorf("Expected 3 server-sized pages, got %d", got)
+		}
+	})
+}
+
+// Test_FetchAllItems_Batch tests that batch mode bundles the pages into
+// $batch requests, retries a batch with a failed part and completes pages
+// capped by the server
+func Test_FetchAllItems_Batch(t *testing.T) {
+	server := testserver.New(fakeItems(5)...)
+	defer server.Close()
+	server.Fail(testserver.EndpointItems, testserver.Unavailable)
+	config := &models.AppConfig{ExternalAPI: models.ExternalApiConfig{PageSize: 2, Pagination: models.PaginationBatch, BatchPages: 2}}
+	server.Configure(config)
+
+	fetched, err := FetchAllItems(context.Background(), config)
+	if err != nil {
+		t.Fatalf("FetchAllItems failed: %v", err)
+	}
+	if len(fetched.Items) != 5 || fetched.Items[4].ItemCode != "I004" {
+		t.Errorf("Expected all 5 items in order, got %+v", fetched.Items)
+	}
+	// Two batches of 2 and 1 pages, the first one sent twice
+	if got := server.Requests(testserver.EndpointBatch); got != 3 {
+		t.Errorf("Expected 3 batch requests, got %d", got)
+	}
+	if got := server.Requests(testserver.EndpointItems); got != 5 {
+		t.Errorf("Expected 5 page requests inside the batches, got %d", got)
+	}
+
+	capped := testserver.New(fakeItems(4)...)
+	defer capped.Close()
+	capped.MaxPageSize = 1
+	capped.Configure(config)
+	fetched, err = FetchAllItems(context.Background(), config)
+	if err != nil {
+		t.Fatalf("FetchAllItems failed: %v", err)
+	}
+	if len(fetched.Items) != 4 || fetched.Items[1].ItemCode != "I001" || fetched.Items[3].ItemCode != "I003" {
+		t.Errorf("Expected all 4 items of the capped pages in order, got %+v", fetched.Items)
+	}
+}
+
+// Test_FetchAllItems_FakeServiceLayerFailures tests that transient errors are
+// retried while expired sessions and wrong credentials fail the fetch
+func Test_FetchAllItems_FakeServiceLayerFailures(t *testing.T) {
+	defer func(backoff time.Duration) { requestBackoff = backoff }(requestBackoff)
+	requestBackoff = time.Millisecond
+
+	server := testserver.New(fakeItems(3)...)
+	defer server.Close()
+	config := &models.AppConfig{ExternalAPI: models.ExternalApiConfig{PageSize: 10, NumWorkers: 1}}
+	server.Configure(config)
+
+	server.Fail(testserver.EndpointItems, testserver.Unavailable, testserver.Unavailable)
+	if fetched, err := FetchAllItems(context.Background(), config); err != nil || len(fetched.Items) != 3 {
+		t.Errorf("Expected the unavailable pages to be retried, got %v", err)
+	}
+
+	server.Fail(testserver.EndpointCount, testserver.SessionExpired)
+	var apiErr *APIError
+	if _, err := FetchAllItems(context.Background(), config); !errors.As(err, &apiErr) || apiErr.Class() != SAPErrorSession {
+		t.Errorf("Expected a session error, got %v", err)
+	}
+	if got := server.Requests(testserver.EndpointCount); got != 2 {
+		t.Errorf("Expected the session error not to be retried, got %d count requests", got)
+	}
+
+	config.ExternalAuth.Password = "wrong"
+	if _, err := FetchAllItems(context.Background(), config); err == nil || !strings.Contains(err.Error(), "Login failed") {
+		t.Errorf("Expected the login to fail, got %v", err)
+	}
+	if server.OpenSessions() != 0 {
+		t.Errorf("Expected every session to be logged out, got %d open", server.OpenSessions())
+	}
+}
@@ -0,0 +1,137 @@
+package external
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"go-cron/models"
+)
+
+// credentialsFetchTimeout bounds fetching the accounts from a secret manager
+const credentialsFetchTimeout = 10 * time.Second
+
+// CredentialsProvider returns the Service Layer accounts to log in with, in
+// order of preference. Login asks it on every login, so credentials rotated
+// in a file or a secret manager are used by the next run without a redeploy.
+type CredentialsProvider interface {
+	Credentials(ctx context.Context) ([]models.Credentials, error)
+}
+
+// StaticCredentials provides fixed accounts, such as those of the environment
+type StaticCredentials []models.Credentials
+
+// Credentials returns the accounts
+func (c StaticCredentials) Credentials(ctx context.Context) ([]models.Credentials, error) {
+	return c, nil
+}
+
+// FileCredentials reads the accounts from a JSON file on every login
+type FileCredentials struct {
+	Path string
+}
+
+// Credentials reads the accounts from the file
+func (c FileCredentials) Credentials(ctx context.Context) ([]models.Credentials, error) {
+	data, err := os.ReadFile(c.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credentials file: %w", err)
+	}
+	return parseCredentials(data)
+}
+
+// URLCredentials fetches the accounts from a secret manager on every login,
+// sending Token as a bearer token when set
+type URLCredentials struct {
+	URL   string
+	Token string
+}
+
+// Credentials fetches the accounts from the URL
+func (c URLCredentials) Credentials(ctx context.Context) ([]models.Credentials, error) {
+	ctx, cancel := context.WithTimeout(ctx, credentialsFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch credentials: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch credentials: status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch credentials: %w", err)
+	}
+	return parseCredentials(data)
+}
+
+// parseCredentials decodes an account, or a list of accounts in order of
+// preference. Accounts without a CompanyDB log in to the first one's.
+func parseCredentials(data []byte) ([]models.Credentials, error) {
+	var accounts []models.Credentials
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		if err := json.Unmarshal(data, &accounts); err != nil {
+			return nil, fmt.Errorf("invalid credentials: %w", err)
+		}
+	} else {
+		var account models.Credentials
+		if err := json.Unmarshal(data, &account); err != nil {
+			return nil, fmt.Errorf("invalid credentials: %w", err)
+		}
+		accounts = append(accounts, account)
+	}
+	if len(accounts) == 0 || accounts[0].UserName == "" {
+		return nil, errors.New("invalid credentials: no UserName")
+	}
+	for i := range accounts {
+		if accounts[i].CompanyDB == "" {
+			accounts[i].CompanyDB = accounts[0].CompanyDB
+		}
+	}
+	return accounts, nil
+}
+
+// NewCredentialsProvider returns the provider of the accounts of config: its
+// credentials file or URL when set, otherwise its primary and secondary
+// accounts
+func NewCredentialsProvider(config *models.AppConfig) CredentialsProvider {
+	auth := config.ExternalAuth
+	switch {
+	case auth.CredentialsURL != "":
+		return URLCredentials{URL: auth.CredentialsURL, Token: auth.CredentialsToken}
+	case auth.CredentialsFile != "":
+		return FileCredentials{Path: auth.CredentialsFile}
+	}
+	accounts := StaticCredentials{{CompanyDB: auth.CompanyDB, UserName: auth.UserName, Password: auth.Password}}
+	if secondary := auth.Secondary; secondary.UserName != "" {
+		if secondary.CompanyDB == "" {
+			secondary.CompanyDB = auth.CompanyDB
+		}
+		accounts = append(accounts, secondary)
+	}
+	return accounts
+}
+
+// credentialsRejected reports whether a login failed because the Service
+// Layer refused the account, rather than because it could not be reached
+func credentialsRejected(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && !apiErr.Retryable()
+}
@@ -0,0 +1,102 @@
+package external
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"go-cron/internal/testserver"
+	"go-cron/models"
+)
+
+// Test_NewCredentialsProvider tests that the secondary account follows the
+// primary one and inherits its company database
+func Test_NewCredentialsProvider(t *testing.T) {
+	config := &models.AppConfig{ExternalAuth: models.ExternalAuthConfig{CompanyDB: "SBO", UserName: "sync", Password: "old",
+		Secondary: models.Credentials{UserName: "sync2", Password: "new"}}}
+	accounts, err := NewCredentialsProvider(config).Credentials(context.Background())
+	if err != nil {
+		t.Fatalf("Credentials failed: %v", err)
+	}
+	want := []models.Credentials{{CompanyDB: "SBO", UserName: "sync", Password: "old"}, {CompanyDB: "SBO", UserName: "sync2", Password: "new"}}
+	if !reflect.DeepEqual(accounts, want) {
+		t.Errorf("Expected %v, got %v", want, accounts)
+	}
+}
+
+// Test_FileCredentials tests that the file is read again on every login, as
+// an account or a list of accounts
+func Test_FileCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	provider := FileCredentials{Path: path}
+	if err := os.WriteFile(path, []byte(`{"CompanyDB":"SBO","UserName":"sync","Password":"old"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	accounts, err := provider.Credentials(context.Background())
+	if err != nil || len(accounts) != 1 || accounts[0].Password != "old" {
+		t.Fatalf("Expected the account of the file, got %v (%v)", accounts, err)
+	}
+
+	if err := os.WriteFile(path, []byte(`[{"CompanyDB":"SBO","UserName":"sync","Password":"new"},{"UserName":"sync2","Password":"other"}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	accounts, err = provider.Credentials(context.Background())
+	if err != nil || len(accounts) != 2 || accounts[0].Password != "new" || accounts[1].CompanyDB != "SBO" {
+		t.Errorf("Expected the rotated accounts, got %v (%v)", accounts, err)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"Password":"new"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.Credentials(context.Background()); err == nil {
+		t.Error("Expected an account without a user name to be rejected")
+	}
+}
+
+// Test_URLCredentials tests fetching the accounts with the bearer token
+func Test_URLCredentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"CompanyDB":"SBO","UserName":"sync","Password":"secret"}`))
+	}))
+	defer server.Close()
+
+	accounts, err := URLCredentials{URL: server.URL, Token: "token"}.Credentials(context.Background())
+	if err != nil || len(accounts) != 1 || accounts[0].Password != "secret" {
+		t.Errorf("Expected the account of the secret manager, got %v (%v)", accounts, err)
+	}
+	if _, err := (URLCredentials{URL: server.URL}).Credentials(context.Background()); err == nil {
+		t.Error("Expected a refused fetch to fail")
+	}
+}
+
+// Test_Login_SecondaryCredentials tests that a rejected primary account falls
+// back to the secondary one
+func Test_Login_SecondaryCredentials(t *testing.T) {
+	server := testserver.New()
+	defer server.Close()
+	config := &models.AppConfig{}
+	server.Configure(config)
+	config.ExternalAuth.Secondary = models.Credentials{CompanyDB: testserver.CompanyDB, UserName: testserver.UserName, Password: testserver.Password}
+	config.ExternalAuth.Password = "rotated"
+
+	sessionID, err := Login(context.Background(), config)
+	if err != nil || sessionID == "" {
+		t.Fatalf("Expected the secondary account to log in, got %q (%v)", sessionID, err)
+	}
+	if got := server.Requests(testserver.EndpointLogin); got != 2 {
+		t.Errorf("Expected 2 logins, got %d", got)
+	}
+
+	config.ExternalAuth.Secondary = models.Credentials{}
+	if _, err := Login(context.Background(), config); !credentialsRejected(err) {
+		t.Errorf("Expected the rejected login error, got %v", err)
+	}
+}
@@ -0,0 +1,182 @@
+package external
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go-cron/models"
+)
+
+// DecodeItems decodes raw item objects into typed items. Items with a field of
+// the wrong type are skipped and one validation error is collected per offending
+// field, so a single malformed item never fails the whole page.
+func DecodeItems(raw []json.RawMessage) ([]models.ExternalItem, []models.ItemValidationError) {
+	return decodeItems(raw, nil)
+}
+
+// decodeConfigured decodes raw item objects like DecodeItems and reshapes
+// them with the field mapping of config
+func decodeConfigured(config *models.AppConfig, raw []json.RawMessage) ([]models.ExternalItem, []models.ItemValidationError, error) {
+	mapping, err := mappingFor(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	items, invalid := decodeItems(raw, mapping)
+	return items, invalid, nil
+}
+
+// decodeItems decodes raw item objects, applying mapping when it is not nil
+func decodeItems(raw []json.RawMessage, mapping *fieldMapping) ([]models.ExternalItem, []models.ItemValidationError) {
+	items := make([]models.ExternalItem, 0, len(raw))
+	var invalid []models.ItemValidationError
+
+	for i, r := range raw {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(r, &fields); err != nil {
+			invalid = append(invalid, models.ItemValidationError{
+				ItemCode: fmt.Sprintf("#%d", i),
+				Message:  "not a JSON object",
+			})
+			continue
+		}
+
+		var item models.ExternalItem
+		var errs []models.ItemValidationError
+		fail := func(field, msg string) {
+			errs = append(errs, models.ItemValidationError{Field: field, Message: msg})
+		}
+
+		if err := decodeString(fields["ItemCode"], &item.ItemCode); err != nil {
+			fail("ItemCode", err.Error())
+		}
+		if err := decodeString(fields["ItemName"], &item.ItemName); err != nil {
+			fail("ItemName", err.Error())
+		}
+		if err := decodeInt(fields["ItemsGroupCode"], &item.ItemsGroupCode); err != nil {
+			fail("ItemsGroupCode", err.Error())
+		}
+		if err := decodePrices(fields[priceFields], &item.ItemPrices); err != nil {
+			fail(priceFields, err.Error())
+		}
+		if err := decodeString(fields[pictureField], &item.Picture); err != nil {
+			fail(pictureField, err.Error())
+		}
+		// A missing or unreadable date only means the item is never skipped
+		item.UpdateDate = decodeDate(fields[updateDateField])
+		if mapping != nil && len(errs) == 0 {
+			for target, msg := range mapping.apply(fields, &item) {
+				fail(target, msg)
+			}
+		}
+
+		if len(errs) > 0 {
+			code := item.ItemCode
+			if code == "" {
+				code = fmt.Sprintf("#%d", i)
+			}
+			for _, e := range errs {
+				e.ItemCode = code
+				invalid = append(invalid, e)
+			}
+			continue
+		}
+
+		items = append(items, item)
+	}
+
+	return items, invalid
+}
+
+// decodeDate decodes a Service Layer date such as "2024-01-15" or
+// "2024-01-15T00:00:00Z", returning zero for missing and invalid values
+func decodeDate(raw json.RawMessage) time.Time {
+	var s string
+	if len(raw) == 0 || json.Unmarshal(raw, &s) != nil {
+		return time.Time{}
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC()
+		}
+	}
+	return time.Time{}
+}
+
+// decodeString decodes a JSON string; missing and null values leave dst empty
+func decodeString(raw json.RawMessage, dst *string) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(raw, dst); err != nil {
+		return fmt.Errorf("expected a string, got %s", raw)
+	}
+	return nil
+}
+
+// decodeInt decodes a JSON number or numeric string; missing and null values leave dst zero
+func decodeInt(raw json.RawMessage, dst *int) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(raw, dst); err == nil {
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		if n, err := strconv.Atoi(s); err == nil {
+			*dst = n
+			return nil
+		}
+	}
+	return fmt.Errorf("expected an integer, got %s", raw)
+}
+
+// decodePrices decodes the price list entries of an item; missing and null
+// values leave dst empty
+func decodePrices(raw json.RawMessage, dst *[]models.ItemPrice) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	var entries []map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		return fmt.Errorf("expected a list of prices, got %s", raw)
+	}
+	prices := make([]models.ItemPrice, len(entries))
+	for i, entry := range entries {
+		if err := decodeInt(entry["PriceList"], &prices[i].PriceList); err != nil {
+			return fmt.Errorf("price %d: PriceList: %w", i, err)
+		}
+		if err := decodeFloat(entry["Price"], &prices[i].Price); err != nil {
+			return fmt.Errorf("price list %d: Price: %w", prices[i].PriceList, err)
+		}
+		if err := decodeString(entry["Currency"], &prices[i].Currency); err != nil {
+			return fmt.Errorf("price list %d: Currency: %w", prices[i].PriceList, err)
+		}
+	}
+	*dst = prices
+	return nil
+}
+
+// decodeFloat decodes a JSON number or numeric string; missing and null values leave dst nil
+func decodeFloat(raw json.RawMessage, dst **float64) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	var f float64
+	if err := json.Unmarshal(raw, &f); err == nil {
+		*dst = &f
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			*dst = &f
+			return nil
+		}
+	}
+	return fmt.Errorf("expected a number, got %s", raw)
+}
@@ -0,0 +1,102 @@
+package external
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// Test_DecodeItems tests tolerant decoding of raw external items
+func Test_DecodeItems(t *testing.T) {
+	var raw []json.RawMessage
+	err := json.Unmarshal([]byte(`[
+		{"ItemCode": "A001", "ItemName": "Product A", "ItemsGroupCode": 100},
+		{"ItemCode": "B001", "ItemName": 123, "ItemsGroupCode": 101},
+		{"ItemCode": "C001", "ItemName": "Product C", "ItemsGroupCode": "121"},
+		{"ItemCode": "D001", "ItemName": null},
+		{"ItemName": ["x"], "ItemsGroupCode": "abc"},
+		"not an object"
+	]`), &raw)
+	if err != nil {
+		t.Fatalf("failed to build fixture: %v", err)
+	}
+
+	items, invalid := DecodeItems(raw)
+
+	if len(items) != 3 {
+		t.Fatalf("Expected 3 decoded items, got %d: %+v", len(items), items)
+	}
+	if items[1].ItemsGroupCode != 121 {
+		t.Errorf("Expected numeric string group code to decode as 121, got %d", items[1].ItemsGroupCode)
+	}
+	if items[2].ItemName != "" {
+		t.Errorf("Expected null ItemName to decode as empty, got %q", items[2].ItemName)
+	}
+
+	// B001 has one bad field, #4 has two, #5 is not an object
+	if len(invalid) != 4 {
+		t.Fatalf("Expected 4 validation errors, got %d: %v", len(invalid), invalid)
+	}
+	if invalid[0].ItemCode != "B001" || invalid[0].Field != "ItemName" {
+		t.Errorf("Unexpected first validation error: %+v", invalid[0])
+	}
+	if invalid[1].ItemCode != "#4" || invalid[2].Field != "ItemsGroupCode" {
+		t.Errorf("Expected per-field errors for item #4, got %v", invalid[1:3])
+	}
+}
+
+// Test_DecodeItems_Prices tests decoding the price lists of an item
+func Test_DecodeItems_Prices(t *testing.T) {
+	var raw []json.RawMessage
+	err := json.Unmarshal([]byte(`[
+		{"ItemCode": "A001", "ItemName": "A", "ItemPrices": [{"PriceList": 1, "Price": 9.5, "Currency": "EUR"}, {"PriceList": "2", "Price": "12.25", "Currency": null}]},
+		{"ItemCode": "B001", "ItemName": "B", "ItemPrices": [{"PriceList": 1, "Price": "free"}]}
+	]`), &raw)
+	if err != nil {
+		t.Fatalf("failed to build fixture: %v", err)
+	}
+
+	items, invalid := DecodeItems(raw)
+
+	if len(items) != 1 || len(items[0].ItemPrices) != 2 {
+		t.Fatalf("Expected one item with 2 prices, got %+v", items)
+	}
+	if p := items[0].PriceIn(2); p == nil || *p.Price != 12.25 || p.Currency != "" {
+		t.Errorf("Expected 12.25 in price list 2, got %+v", p)
+	}
+	if items[0].PriceIn(3) != nil {
+		t.Error("Expected no price in an unknown price list")
+	}
+	if len(invalid) != 1 || invalid[0].ItemCode != "B001" || invalid[0].Field != "ItemPrices" {
+		t.Errorf("Expected the invalid price of B001 to be reported, got %v", invalid)
+	}
+}
+
+// Test_DecodeItems_UpdateDate tests that update dates are read in both
+// Service Layer formats and that a bad date never rejects an item
+func Test_DecodeItems_UpdateDate(t *testing.T) {
+	var raw []json.RawMessage
+	err := json.Unmarshal([]byte(`[
+		{"ItemCode": "A001", "ItemName": "A", "UpdateDate": "2024-01-15"},
+		{"ItemCode": "B001", "ItemName": "B", "UpdateDate": "2024-01-16T00:00:00Z"},
+		{"ItemCode": "C001", "ItemName": "C", "UpdateDate": "yesterday"}
+	]`), &raw)
+	if err != nil {
+		t.Fatalf("failed to build fixture: %v", err)
+	}
+
+	items, invalid := DecodeItems(raw)
+
+	if len(items) != 3 || len(invalid) != 0 {
+		t.Fatalf("Expected 3 valid items, got %+v and %v", items, invalid)
+	}
+	if want := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC); !items[0].UpdateDate.Equal(want) {
+		t.Errorf("Expected %v, got %v", want, items[0].UpdateDate)
+	}
+	if want := time.Date(2024, 1, 16, 0, 0, 0, 0, time.UTC); !items[1].UpdateDate.Equal(want) {
+		t.Errorf("Expected %v, got %v", want, items[1].UpdateDate)
+	}
+	if !items[2].UpdateDate.IsZero() {
+		t.Errorf("Expected no date for an unreadable one, got %v", items[2].UpdateDate)
+	}
+}
@@ -0,0 +1,56 @@
+package external
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"go-cron/models"
+)
+
+// ImageFetcher downloads item pictures with the TLS and transport settings of
+// the external API
+type ImageFetcher struct {
+	client   *http.Client
+	maxBytes int64
+}
+
+// NewImageFetcher creates a fetcher for the configured pictures
+func NewImageFetcher(config *models.AppConfig) (*ImageFetcher, error) {
+	client, err := newHTTPClient(config, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &ImageFetcher{client: client, maxBytes: config.Images.MaxBytes}, nil
+}
+
+// FetchImage downloads the picture at imageURL and returns it with its
+// content type. Pictures over the size limit are rejected.
+func (f *ImageFetcher) FetchImage(ctx context.Context, imageURL string) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", imageURL, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to download %s: %w", imageURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("failed to download %s: %s", imageURL, resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, f.maxBytes+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to download %s: %w", imageURL, err)
+	}
+	if int64(len(data)) > f.maxBytes {
+		return nil, "", fmt.Errorf("picture %s is larger than %d bytes", imageURL, f.maxBytes)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	return data, contentType, nil
+}
@@ -0,0 +1,42 @@
+package external
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-cron/models"
+)
+
+// Test_ImageFetcher tests downloading pictures within the size limit
+func Test_ImageFetcher(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oak.png":
+			w.Write([]byte("\x89PNG\r\n\x1a\nsmall"))
+		case "/large.jpg":
+			w.Header().Set("Content-Type", "image/jpeg")
+			w.Write([]byte(strings.Repeat("x", 64)))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	fetcher, err := NewImageFetcher(&models.AppConfig{Images: models.ImagesConfig{MaxBytes: 32}})
+	if err != nil {
+		t.Fatalf("NewImageFetcher failed: %v", err)
+	}
+	data, contentType, err := fetcher.FetchImage(context.Background(), server.URL+"/oak.png")
+	if err != nil || contentType != "image/png" || len(data) != 13 {
+		t.Errorf("Expected the sniffed PNG, got %q (%d bytes, %v)", contentType, len(data), err)
+	}
+	if _, _, err := fetcher.FetchImage(context.Background(), server.URL+"/large.jpg"); err == nil || !strings.Contains(err.Error(), "larger than 32 bytes") {
+		t.Errorf("Expected the large picture to be rejected, got %v", err)
+	}
+	if _, _, err := fetcher.FetchImage(context.Background(), server.URL+"/missing.jpg"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Expected a missing picture to fail, got %v", err)
+	}
+}
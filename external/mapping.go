@@ -0,0 +1,173 @@
+package external
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"text/template/parse"
+
+	"go-cron/models"
+)
+
+// fieldMapping is the compiled SYNC_FIELD_MAPPING of a configuration
+type fieldMapping struct {
+	targets []mappedTarget
+	// sources are the item fields the mapping reads, selected with the default fields
+	sources []string
+}
+
+// mappedTarget is one target read from an item field or rendered by a template
+type mappedTarget struct {
+	target string
+	field  string
+	tmpl   *template.Template
+}
+
+// mappings caches compiled mappings by their encoded configuration, so pages
+// don't parse the templates again
+var mappings sync.Map
+
+// mappingFor returns the compiled field mapping of config, or nil when it maps nothing
+func mappingFor(config *models.AppConfig) (*fieldMapping, error) {
+	if len(config.Sync.FieldMapping) == 0 {
+		return nil, nil
+	}
+	key, _ := json.Marshal(config.Sync.FieldMapping)
+	if cached, ok := mappings.Load(string(key)); ok {
+		return cached.(*fieldMapping), nil
+	}
+	mapping, err := compileMapping(config.Sync.FieldMapping)
+	if err != nil {
+		return nil, err
+	}
+	mappings.Store(string(key), mapping)
+	return mapping, nil
+}
+
+// compileMapping parses every source of mapping and collects the item fields they read
+func compileMapping(mapping map[string]string) (*fieldMapping, error) {
+	compiled := &fieldMapping{}
+	sources := make(map[string]bool)
+	for target, source := range mapping {
+		field, tmpl, err := models.ParseMapping(target, source)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mapping of %s: %w", target, err)
+		}
+		if tmpl != nil {
+			templateFields(tmpl.Tree.Root, sources)
+		} else {
+			sources[field] = true
+		}
+		compiled.targets = append(compiled.targets, mappedTarget{target: target, field: field, tmpl: tmpl})
+	}
+	sort.Slice(compiled.targets, func(i, j int) bool { return compiled.targets[i].target < compiled.targets[j].target })
+	for field := range sources {
+		compiled.sources = append(compiled.sources, field)
+	}
+	sort.Strings(compiled.sources)
+	return compiled, nil
+}
+
+// templateFields adds the item fields referenced by node, like ItemName in
+// {{.ItemName}}, to fields
+func templateFields(node parse.Node, fields map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			templateFields(child, fields)
+		}
+	case *parse.ActionNode:
+		templateFields(n.Pipe, fields)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			templateFields(cmd, fields)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			templateFields(arg, fields)
+		}
+	case *parse.FieldNode:
+		fields[n.Ident[0]] = true
+	case *parse.IfNode:
+		templateFields(&n.BranchNode, fields)
+	case *parse.RangeNode:
+		templateFields(&n.BranchNode, fields)
+	case *parse.WithNode:
+		templateFields(&n.BranchNode, fields)
+	case *parse.BranchNode:
+		templateFields(n.Pipe, fields)
+		templateFields(n.List, fields)
+		templateFields(n.ElseList, fields)
+	}
+}
+
+// apply sets the mapped targets of item from its raw fields, returning the
+// targets that could not be mapped with their reason
+func (m *fieldMapping) apply(raw map[string]json.RawMessage, item *models.ExternalItem) map[string]string {
+	data := make(map[string]interface{}, len(m.sources))
+	for _, field := range m.sources {
+		data[field] = mappingValue(raw[field])
+	}
+
+	var failed map[string]string
+	for _, t := range m.targets {
+		var value string
+		if t.tmpl != nil {
+			var out bytes.Buffer
+			if err := t.tmpl.Execute(&out, data); err != nil {
+				if failed == nil {
+					failed = make(map[string]string)
+				}
+				failed[t.target] = err.Error()
+				continue
+			}
+			value = out.String()
+		} else {
+			value = fmt.Sprint(data[t.field])
+		}
+
+		switch t.target {
+		case models.MappingTitle:
+			item.ItemName = value
+		case models.MappingPicture:
+			item.Picture = value
+		case models.MappingGroup:
+			group, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil && strings.TrimSpace(value) != "" {
+				if failed == nil {
+					failed = make(map[string]string)
+				}
+				failed[t.target] = fmt.Sprintf("%q is not a group code", value)
+				continue
+			}
+			item.ItemsGroupCode = group
+		}
+	}
+	return failed
+}
+
+// mappingValue decodes a raw field for templates. Numbers keep their JSON
+// text and missing or null fields render as empty strings.
+func mappingValue(raw json.RawMessage) interface{} {
+	if len(raw) == 0 || string(raw) == "null" {
+		return ""
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil || value == nil {
+		return ""
+	}
+	return value
+}
@@ -0,0 +1,55 @@
+package external
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"go-cron/models"
+)
+
+// Test_DecodeItems_FieldMapping tests that mapped targets are read from other
+// fields or rendered by templates, and that unmappable items are rejected
+func Test_DecodeItems_FieldMapping(t *testing.T) {
+	config := &models.AppConfig{Sync: models.SyncConfig{FieldMapping: map[string]string{
+		models.MappingTitle: "{{.ItemName}} ({{.ItemCode}})",
+		models.MappingGroup: "U_WebGroup",
+	}}}
+	var raw []json.RawMessage
+	err := json.Unmarshal([]byte(`[
+		{"ItemCode": "A001", "ItemName": "Green tea", "ItemsGroupCode": 100, "U_WebGroup": 7},
+		{"ItemCode": 1234567, "ItemName": null, "ItemsGroupCode": 100, "U_WebGroup": null},
+		{"ItemCode": "C001", "ItemName": "Mug", "U_WebGroup": "cups"}
+	]`), &raw)
+	if err != nil {
+		t.Fatalf("failed to build fixture: %v", err)
+	}
+
+	items, invalid, err := decodeConfigured(config, raw)
+	if err != nil {
+		t.Fatalf("decodeConfigured failed: %v", err)
+	}
+
+	// The numeric item code of the second item fails its default decoding
+	if len(items) != 1 || len(invalid) != 2 {
+		t.Fatalf("Expected 1 item and 2 errors, got %+v and %+v", items, invalid)
+	}
+	if items[0].ItemName != "Green tea (A001)" || items[0].ItemsGroupCode != 7 {
+		t.Errorf("Expected the mapped title and group, got %+v", items[0])
+	}
+	if e := invalid[1]; e.ItemCode != "C001" || e.Field != models.MappingGroup {
+		t.Errorf("Expected the unmappable group to reject C001, got %+v", e)
+	}
+}
+
+// Test_selectedFields_FieldMapping tests that the fields read by a mapping are selected
+func Test_selectedFields_FieldMapping(t *testing.T) {
+	config := &models.AppConfig{Sync: models.SyncConfig{FieldMapping: map[string]string{
+		models.MappingTitle:   `{{if .FrgnName}}{{.FrgnName}}{{else}}{{.ItemName}}{{end}}`,
+		models.MappingPicture: "U_Photo",
+	}}}
+	want := []string{"ItemCode", "ItemName", "ItemsGroupCode", "FrgnName", "U_Photo"}
+	if got := selectedFields(config); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
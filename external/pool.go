@@ -0,0 +1,142 @@
+package external
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"go-cron/models"
+)
+
+// healthyPagesToGrow is the number of healthy pages in a row after which the
+// pool adds back a worker
+const healthyPagesToGrow = 5
+
+// adaptivePool bounds the pages fetched at once. It halves the bound when the
+// Service Layer throttles (429 or 5xx) or a page is slower than the threshold,
+// and grows it back one worker at a time, up to the configured number, after
+// a run of healthy pages.
+type adaptivePool struct {
+	slow time.Duration
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	max     int
+	limit   int
+	active  int
+	healthy int
+	// generation changes with every scale down, so the pages that were
+	// already in flight when the pool shrank don't shrink it again
+	generation int
+	stats      models.FetchConcurrency
+}
+
+// newAdaptivePool returns a pool of at most workers pages at once
+func newAdaptivePool(workers int, slow time.Duration) *adaptivePool {
+	if workers < 1 {
+		workers = 1
+	}
+	p := &adaptivePool{slow: slow, max: workers, limit: workers}
+	p.cond = sync.NewCond(&p.mu)
+	p.stats = models.FetchConcurrency{Initial: workers, Min: workers}
+	return p
+}
+
+// acquire waits for a free worker and returns the generation the page runs
+// in, or the error of ctx
+func (p *adaptivePool) acquire(ctx context.Context) (int, error) {
+	stop := context.AfterFunc(ctx, func() {
+		p.mu.Lock()
+		p.cond.Broadcast()
+		p.mu.Unlock()
+	})
+	defer stop()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for p.active >= p.limit {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		p.cond.Wait()
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	p.active++
+	return p.generation, nil
+}
+
+// release frees the worker of a page started in generation, scaling the pool
+// by how the page went
+func (p *adaptivePool) release(generation int, latency time.Duration, throttled bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	defer p.cond.Broadcast()
+	p.active--
+
+	slow := p.slow > 0 && latency > p.slow
+	if throttled {
+		p.stats.Throttled++
+	}
+	if slow {
+		p.stats.Slow++
+	}
+	if !throttled && !slow {
+		p.healthy++
+		if p.healthy >= healthyPagesToGrow && p.limit < p.max {
+			p.limit++
+			p.healthy = 0
+			p.stats.ScaleUps++
+			log.Printf("Fetch concurrency up to %d workers\n", p.limit)
+		}
+		return
+	}
+
+	p.healthy = 0
+	if generation != p.generation || p.limit == 1 {
+		return
+	}
+	p.generation++
+	p.limit = (p.limit + 1) / 2
+	if p.limit < p.stats.Min {
+		p.stats.Min = p.limit
+	}
+	p.stats.ScaleDowns++
+	reason := "external API throttling"
+	if !throttled {
+		reason = "page took " + latency.Round(time.Millisecond).String()
+	}
+	log.Printf("Fetch concurrency down to %d workers: %s\n", p.limit, reason)
+}
+
+// concurrency returns the statistics of the pool so far
+func (p *adaptivePool) concurrency() *models.FetchConcurrency {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := p.stats
+	stats.Final = p.limit
+	return &stats
+}
+
+// throttleKey is the context key of the function told about throttled requests
+type throttleKey struct{}
+
+// withThrottleObserver returns ctx telling observe about every request of
+// withRetry the Service Layer throttled, retried or not
+func withThrottleObserver(ctx context.Context, observe func()) context.Context {
+	return context.WithValue(ctx, throttleKey{}, observe)
+}
+
+// noteThrottled tells the observer of ctx, if any, when err is a throttled request
+func noteThrottled(ctx context.Context, err error) {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || !apiErr.Retryable() {
+		return
+	}
+	if observe, ok := ctx.Value(throttleKey{}).(func()); ok {
+		observe()
+	}
+}
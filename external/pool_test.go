@@ -0,0 +1,87 @@
+package external
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go-cron/internal/testserver"
+	"go-cron/models"
+)
+
+// Test_adaptivePool tests that the pool halves on throttled or slow pages once
+// per generation and grows back after a run of healthy pages
+func Test_adaptivePool(t *testing.T) {
+	pool := newAdaptivePool(4, time.Second)
+	ctx := context.Background()
+
+	var generations []int
+	for i := 0; i < 4; i++ {
+		generation, err := pool.acquire(ctx)
+		if err != nil {
+			t.Fatalf("acquire failed: %v", err)
+		}
+		generations = append(generations, generation)
+	}
+	// Pages in flight when the pool shrank don't shrink it again
+	pool.release(generations[0], time.Millisecond, true)
+	pool.release(generations[1], time.Millisecond, true)
+	if got := pool.concurrency(); got.Final != 2 || got.ScaleDowns != 1 || got.Throttled != 2 {
+		t.Errorf("Expected one scale down to 2 workers, got %+v", got)
+	}
+	pool.release(generations[2], time.Millisecond, false)
+	generation, _ := pool.acquire(ctx)
+	pool.release(generation, 2*time.Second, false)
+	if got := pool.concurrency(); got.Final != 1 || got.Min != 1 || got.Slow != 1 {
+		t.Errorf("Expected the slow page to scale down to 1 worker, got %+v", got)
+	}
+	pool.release(generations[3], time.Millisecond, false)
+
+	for i := 0; i < healthyPagesToGrow; i++ {
+		generation, _ := pool.acquire(ctx)
+		pool.release(generation, time.Millisecond, false)
+	}
+	got := pool.concurrency()
+	want := models.FetchConcurrency{Initial: 4, Min: 1, Final: 2, ScaleDowns: 2, ScaleUps: 1, Throttled: 2, Slow: 1}
+	if *got != want {
+		t.Errorf("Expected %+v, got %+v", want, *got)
+	}
+}
+
+// Test_adaptivePool_Cancel tests that a worker waiting for the pool gives up with its context
+func Test_adaptivePool_Cancel(t *testing.T) {
+	pool := newAdaptivePool(1, 0)
+	if _, err := pool.acquire(context.Background()); err != nil {
+		t.Fatalf("acquire failed: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := pool.acquire(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected the deadline to end the wait, got %v", err)
+	}
+}
+
+// Test_FetchAllItems_AdaptsConcurrency tests that a throttled page scales the
+// workers down even when its retry succeeds
+func Test_FetchAllItems_AdaptsConcurrency(t *testing.T) {
+	defer func(backoff time.Duration) { requestBackoff = backoff }(requestBackoff)
+	requestBackoff = time.Millisecond
+
+	server := testserver.New(fakeItems(6)...)
+	defer server.Close()
+	server.MaxPageSize = 1
+	config := &models.AppConfig{ExternalAPI: models.ExternalApiConfig{PageSize: 1, NumWorkers: 4}}
+	server.Configure(config)
+	server.Fail(testserver.EndpointItems, testserver.Unavailable)
+
+	fetched, err := FetchAllItems(context.Background(), config)
+	if err != nil {
+		t.Fatalf("FetchAllItems failed: %v", err)
+	}
+	if len(fetched.Items) != 6 {
+		t.Errorf("Expected 6 items, got %d", len(fetched.Items))
+	}
+	if c := fetched.Concurrency; c == nil || c.Initial != 4 || c.Throttled != 1 || c.ScaleDowns != 1 || c.Min != 2 {
+		t.Errorf("Expected one throttled page to halve the workers, got %+v", c)
+	}
+}
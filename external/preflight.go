@@ -0,0 +1,99 @@
+package external
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"go-cron/models"
+)
+
+// PreflightError lists the selected fields missing from the external API
+// response and the mapped targets the sample item could not fill
+type PreflightError struct {
+	Missing []string
+	// Unmapped holds the reason of every SYNC_FIELD_MAPPING target that failed
+	Unmapped map[string]string
+}
+
+func (e *PreflightError) Error() string {
+	var problems []string
+	if len(e.Missing) > 0 {
+		problems = append(problems, fmt.Sprintf("lacks the selected fields %s", strings.Join(e.Missing, ", ")))
+	}
+	if len(e.Unmapped) > 0 {
+		targets := make([]string, 0, len(e.Unmapped))
+		for target, reason := range e.Unmapped {
+			targets = append(targets, fmt.Sprintf("%s (%s)", target, reason))
+		}
+		sort.Strings(targets)
+		problems = append(problems, fmt.Sprintf("cannot be mapped to %s", strings.Join(targets, ", ")))
+	}
+	return "external API response " + strings.Join(problems, " and ")
+}
+
+// Preflight fetches a single item with the configured $select and filter and
+// checks that every selected field, mapped UDFs included, is present in the
+// response and that the field mapping applies to it, so a typo in a field
+// name fails fast instead of after a full fetch. An empty result cannot be
+// checked and passes. A *PreflightError lists the problems.
+//
+// The check uses the session kept by Warm if there is one, and a passing
+// check keeps its session for the fetch that follows, so a preflighted sync
+// logs in once. DropWarm logs it out when no fetch follows.
+func Preflight(ctx context.Context, config *models.AppConfig) error {
+	mapping, err := mappingFor(config)
+	if err != nil {
+		return err
+	}
+	sessionID, err := loginOrWarm(ctx, config)
+	if err != nil {
+		return fmt.Errorf("login failed: %w", err)
+	}
+	if err := preflight(ctx, config, mapping, sessionID); err != nil {
+		if err := Logout(config, sessionID); err != nil {
+			log.Printf("Logout failed: %v\n", err)
+		}
+		return err
+	}
+	keepWarm(config, sessionID)
+	return nil
+}
+
+// preflight checks a single item fetched with sessionID
+func preflight(ctx context.Context, config *models.AppConfig, mapping *fieldMapping, sessionID string) error {
+	pageURL, err := itemsURL(config, map[string]string{"$top": "1"})
+	if err != nil {
+		return err
+	}
+	itemsResp, err := fetchPage(ctx, config, pageURL, sessionID)
+	if err != nil {
+		return fmt.Errorf("preflight query failed: %w", err)
+	}
+	if len(itemsResp.Value) == 0 {
+		log.Println("Preflight query matched no items, selected fields not checked")
+		return nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(itemsResp.Value[0], &fields); err != nil {
+		return fmt.Errorf("preflight item is not a JSON object: %w", err)
+	}
+	preflightErr := &PreflightError{}
+	for _, field := range selectedFields(config) {
+		if _, ok := fields[field]; !ok {
+			preflightErr.Missing = append(preflightErr.Missing, field)
+		}
+	}
+	if mapping != nil {
+		var item models.ExternalItem
+		preflightErr.Unmapped = mapping.apply(fields, &item)
+	}
+	if len(preflightErr.Missing) > 0 || len(preflightErr.Unmapped) > 0 {
+		return preflightErr
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package external
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-cron/internal/testserver"
+	"go-cron/models"
+)
+
+// Test_Preflight tests that fields missing from the response are listed
+func Test_Preflight(t *testing.T) {
+	item := `{"ItemCode":"A1","ItemName":"A","ItemsGroupCode":100}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/Login":
+			fmt.Fprint(w, `{"SessionId":"session"}`)
+		case "/Logout":
+			w.WriteHeader(http.StatusNoContent)
+		case "/Items":
+			if r.URL.Query().Get("$top") != "1" {
+				t.Errorf("Expected a single item to be requested, got %q", r.URL.Query().Get("$top"))
+			}
+			fmt.Fprintf(w, `{"value":[%s]}`, item)
+		default:
+			t.Errorf("Unexpected request %s", r.URL)
+		}
+	}))
+	defer server.Close()
+
+	config := &models.AppConfig{ExternalAPI: models.ExternalApiConfig{
+		ExternalAPIURL: server.URL,
+		LoginURL:       "/Login",
+		ItemsURL:       "/Items",
+	}}
+	defer DropWarm(config)
+	if err := Preflight(context.Background(), config); err != nil {
+		t.Fatalf("Expected the preflight to pass, got %v", err)
+	}
+
+	item = `{"ItemCode":"A1"}`
+	var preflightErr *PreflightError
+	if err := Preflight(context.Background(), config); !errors.As(err, &preflightErr) {
+		t.Fatalf("Expected a PreflightError, got %v", err)
+	}
+	if len(preflightErr.Missing) != 2 || preflightErr.Missing[0] != "ItemName" || preflightErr.Missing[1] != "ItemsGroupCode" {
+		t.Errorf("Expected ItemName and ItemsGroupCode to be missing, got %v", preflightErr.Missing)
+	}
+}
+
+// Test_Preflight_Mapping tests that the mapped UDFs are checked and that a
+// mapping failing on the sample item is reported
+func Test_Preflight_Mapping(t *testing.T) {
+	server := testserver.New()
+	defer server.Close()
+	server.SetRawItems(`{"ItemCode":"A1","ItemName":"A","ItemsGroupCode":100,"U_Group":"tea"}`)
+	config := &models.AppConfig{ExternalAPI: models.ExternalApiConfig{PageSize: 10, NumWorkers: 1}}
+	config.Sync.FieldMapping = map[string]string{models.MappingTitle: "U_WebName", models.MappingGroup: "U_Group"}
+	server.Configure(config)
+	defer DropWarm(config)
+
+	var preflightErr *PreflightError
+	if err := Preflight(context.Background(), config); !errors.As(err, &preflightErr) {
+		t.Fatalf("Expected a PreflightError, got %v", err)
+	}
+	if len(preflightErr.Missing) != 1 || preflightErr.Missing[0] != "U_WebName" {
+		t.Errorf("Expected the mapped U_WebName to be missing, got %v", preflightErr.Missing)
+	}
+	if _, ok := preflightErr.Unmapped[models.MappingGroup]; !ok || len(preflightErr.Unmapped) != 1 {
+		t.Errorf("Expected the group not to be mapped, got %v", preflightErr.Unmapped)
+	}
+	if server.OpenSessions() != 0 {
+		t.Error("Expected the session of a failed check to be logged out")
+	}
+
+	config.Sync.FieldMapping = map[string]string{models.MappingTitle: "{{.ItemName"}
+	if err := Preflight(context.Background(), config); err == nil || errors.As(err, &preflightErr) {
+		t.Errorf("Expected the invalid mapping to fail before the query, got %v", err)
+	}
+}
+
+// Test_Preflight_ReusesSession tests that the fetch after a passing check
+// uses its session instead of logging in again
+func Test_Preflight_ReusesSession(t *testing.T) {
+	server := testserver.New(fakeItems(3)...)
+	defer server.Close()
+	config := &models.AppConfig{ExternalAPI: models.ExternalApiConfig{PageSize: 10, NumWorkers: 1}}
+	server.Configure(config)
+
+	if err := Preflight(context.Background(), config); err != nil {
+		t.Fatalf("Expected the preflight to pass, got %v", err)
+	}
+	if _, err := FetchAllItems(context.Background(), config); err != nil {
+		t.Fatalf("FetchAllItems failed: %v", err)
+	}
+	if got := server.Requests(testserver.EndpointLogin); got != 1 {
+		t.Errorf("Expected the check and the fetch to share a login, got %d logins", got)
+	}
+	if server.OpenSessions() != 0 {
+		t.Error("Expected every session to be logged out")
+	}
+}
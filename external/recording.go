@@ -0,0 +1,239 @@
+package external
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-cron/models"
+)
+
+// redacted replaces credentials in recorded exchanges
+const redacted = "REDACTED"
+
+// credentialHeaders are the headers whose values are never recorded
+var credentialHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// credentialFields matches the JSON fields of the login request and response
+// that carry credentials
+var credentialFields = regexp.MustCompile(`("(?:Password|SessionId)"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+
+// recordingTransport records every exchange with the external API as
+// configured, with credentials redacted
+type recordingTransport struct {
+	next     http.RoundTripper
+	settings models.RecordingConfig
+}
+
+// RoundTrip sends req and records it with its response. The bodies are read
+// in full so they can be recorded, and handed on unchanged.
+func (t recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	exchange := models.RecordedExchange{Time: time.Now(), Method: req.Method, URL: req.URL.String(), RequestHeaders: redactHeaders(req.Header)}
+	if req.Body != nil && req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			content, _ := io.ReadAll(body)
+			body.Close()
+			exchange.RequestBody = t.recordBody(&exchange, content)
+		}
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	exchange.DurationMs = time.Since(exchange.Time).Milliseconds()
+	if err != nil {
+		exchange.Error = err.Error()
+		record(t.settings, exchange)
+		return nil, err
+	}
+
+	exchange.Status = resp.StatusCode
+	exchange.ResponseHeaders = redactHeaders(resp.Header)
+	content, readErr := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if readErr != nil {
+		exchange.Error = readErr.Error()
+		resp.Body = io.NopCloser(io.MultiReader(bytes.NewReader(content), errReader{readErr}))
+	} else {
+		resp.Body = io.NopCloser(bytes.NewReader(content))
+	}
+	exchange.ResponseBody = t.recordBody(&exchange, content)
+	record(t.settings, exchange)
+	return resp, nil
+}
+
+// errReader fails every read with err, to hand a body's read error on to the caller
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
+
+// recordBody returns content as recorded: credentials redacted, cut at MaxBody
+func (t recordingTransport) recordBody(exchange *models.RecordedExchange, content []byte) string {
+	body := credentialFields.ReplaceAllString(string(content), `$1"`+redacted+`"`)
+	if t.settings.MaxBody > 0 && len(body) > t.settings.MaxBody {
+		body = body[:t.settings.MaxBody]
+		exchange.Truncated = true
+	}
+	return body
+}
+
+// redactHeaders returns a copy of h with the values of credential headers redacted
+func redactHeaders(h http.Header) http.Header {
+	if len(h) == 0 {
+		return nil
+	}
+	copied := h.Clone()
+	for _, name := range credentialHeaders {
+		if values := copied.Values(name); len(values) > 0 {
+			copied[http.CanonicalHeaderKey(name)] = []string{redacted}
+		}
+	}
+	return copied
+}
+
+// recordings is the ring buffer of RecordingMemory mode, shared by the
+// clients of the instance
+var (
+	recordingsMu sync.Mutex
+	recordings   []models.RecordedExchange
+	recordingSeq atomic.Int64
+)
+
+// record keeps exchange as configured, logging rather than failing when a
+// recording cannot be written
+func record(settings models.RecordingConfig, exchange models.RecordedExchange) {
+	switch settings.Mode {
+	case models.RecordingMemory:
+		recordingsMu.Lock()
+		defer recordingsMu.Unlock()
+		recordings = append(recordings, exchange)
+		if over := len(recordings) - settings.Size; settings.Size > 0 && over > 0 {
+			recordings = append([]models.RecordedExchange(nil), recordings[over:]...)
+		}
+	case models.RecordingDir:
+		dir := recordingDir(settings)
+		if err := writeRecording(dir, exchange); err != nil {
+			log.Printf("Failed to record external API exchange: %v\n", err)
+		}
+		if err := pruneRecordings(dir, settings.Size); err != nil {
+			log.Printf("Failed to prune external API recordings: %v\n", err)
+		}
+	}
+}
+
+// recordingDir returns the directory of RecordingDir mode
+func recordingDir(settings models.RecordingConfig) string {
+	if settings.Dir != "" {
+		return settings.Dir
+	}
+	return filepath.Join(os.TempDir(), "go-cron-recordings")
+}
+
+// writeRecording writes exchange to its own file in dir, named so the files
+// sort by time
+func writeRecording(dir string, exchange models.RecordedExchange) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(exchange, "", "  ")
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%06d-%s.json", exchange.Time.UTC().Format("20060102T150405.000000000"), recordingSeq.Add(1), strings.ToLower(exchange.Method))
+	return os.WriteFile(filepath.Join(dir, name), content, 0o600)
+}
+
+// pruneMu serializes the pruning of the recording directory by the clients of the instance
+var pruneMu sync.Mutex
+
+// pruneRecordings removes the oldest files of dir beyond the latest size, so
+// the directory holds no more than Recordings returns
+func pruneRecordings(dir string, size int) error {
+	if size <= 0 {
+		return nil
+	}
+	pruneMu.Lock()
+	defer pruneMu.Unlock()
+
+	names, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+	for len(names) > size {
+		if err := os.Remove(names[0]); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		names = names[1:]
+	}
+	return nil
+}
+
+// Recordings returns the latest recorded exchanges, oldest first: the ring
+// buffer of RecordingMemory mode, or the last Size files of RecordingDir mode
+func Recordings(settings models.RecordingConfig) ([]models.RecordedExchange, error) {
+	switch settings.Mode {
+	case models.RecordingMemory:
+		recordingsMu.Lock()
+		defer recordingsMu.Unlock()
+		exchanges := append([]models.RecordedExchange(nil), recordings...)
+		if over := len(exchanges) - settings.Size; settings.Size > 0 && over > 0 {
+			exchanges = exchanges[over:]
+		}
+		return exchanges, nil
+	case models.RecordingDir:
+		dir := recordingDir(settings)
+		names, err := filepath.Glob(filepath.Join(dir, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(names)
+		if over := len(names) - settings.Size; settings.Size > 0 && over > 0 {
+			names = names[over:]
+		}
+		exchanges := make([]models.RecordedExchange, 0, len(names))
+		for _, name := range names {
+			content, err := os.ReadFile(name)
+			if err != nil {
+				return nil, err
+			}
+			var exchange models.RecordedExchange
+			if err := json.Unmarshal(content, &exchange); err != nil {
+				return nil, fmt.Errorf("invalid recording %s: %w", filepath.Base(name), err)
+			}
+			exchanges = append(exchanges, exchange)
+		}
+		return exchanges, nil
+	}
+	return nil, nil
+}
+
+// ClearRecordings discards the recorded exchanges of the configured mode
+func ClearRecordings(settings models.RecordingConfig) error {
+	switch settings.Mode {
+	case models.RecordingMemory:
+		recordingsMu.Lock()
+		defer recordingsMu.Unlock()
+		recordings = nil
+	case models.RecordingDir:
+		names, err := filepath.Glob(filepath.Join(recordingDir(settings), "*.json"))
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package external
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go-cron/internal/testserver"
+	"go-cron/models"
+)
+
+// Test_Recording tests that every exchange of a fetch is recorded with its
+// bodies, and that credentials never are, in both recording modes
+func Test_Recording(t *testing.T) {
+	for _, mode := range []string{models.RecordingMemory, models.RecordingDir} {
+		t.Run(mode, func(t *testing.T) {
+			server := testserver.New(fakeItems(3)...)
+			defer server.Close()
+			settings := models.RecordingConfig{Mode: mode, Dir: t.TempDir(), Size: 10, MaxBody: 1 << 10}
+			defer ClearRecordings(settings)
+			config := &models.AppConfig{ExternalAPI: models.ExternalApiConfig{PageSize: 10, NumWorkers: 1, Recording: settings}}
+			server.Configure(config)
+
+			if _, err := FetchAllItems(context.Background(), config); err != nil {
+				t.Fatalf("FetchAllItems failed: %v", err)
+			}
+			// Login, count, items and logout
+			exchanges, err := Recordings(settings)
+			if err != nil {
+				t.Fatalf("Recordings failed: %v", err)
+			}
+			if len(exchanges) != 4 {
+				t.Fatalf("Expected 4 exchanges, got %d", len(exchanges))
+			}
+			login := exchanges[0]
+			if login.Method != "POST" || !strings.Contains(login.RequestBody, `"UserName":"`+testserver.UserName+`"`) {
+				t.Fatalf("Expected the login to be recorded first, got %+v", login)
+			}
+			for _, secret := range []string{testserver.Password, "session-1"} {
+				if strings.Contains(login.RequestBody+login.ResponseBody+strings.Join(login.ResponseHeaders.Values("Set-Cookie"), ""), secret) {
+					t.Errorf("Expected %q to be redacted, got %+v", secret, login)
+				}
+			}
+
+			// Only the latest Size exchanges are returned
+			settings.Size = 2
+			exchanges, _ = Recordings(settings)
+			if len(exchanges) != 2 {
+				t.Fatalf("Expected the latest 2 exchanges, got %d", len(exchanges))
+			}
+			items := exchanges[0]
+			if !strings.Contains(items.URL, "/Items?") || items.Status != 200 || !strings.Contains(items.ResponseBody, `"ItemCode":"I002"`) {
+				t.Errorf("Expected the items page to be recorded, got %+v", items)
+			}
+			if got := items.RequestHeaders.Get("Cookie"); got != redacted {
+				t.Errorf("Expected the session cookie to be redacted, got %q", got)
+			}
+
+			if err := ClearRecordings(settings); err != nil {
+				t.Fatalf("ClearRecordings failed: %v", err)
+			}
+			if exchanges, _ := Recordings(settings); len(exchanges) != 0 {
+				t.Errorf("Expected no recordings after clearing, got %d", len(exchanges))
+			}
+		})
+	}
+}
+
+// Test_Recording_Truncates tests that bodies are cut at the configured maximum
+func Test_Recording_Truncates(t *testing.T) {
+	exchange := models.RecordedExchange{}
+	transport := recordingTransport{settings: models.RecordingConfig{MaxBody: 4}}
+	if got := transport.recordBody(&exchange, []byte(`{"value":[]}`)); got != `{"va` || !exchange.Truncated {
+		t.Errorf("Expected a truncated body, got %q", got)
+	}
+}
+
+// Test_Recording_PrunesDir tests that the recording directory keeps only the
+// latest Size files
+func Test_Recording_PrunesDir(t *testing.T) {
+	settings := models.RecordingConfig{Mode: models.RecordingDir, Dir: t.TempDir(), Size: 2}
+	for i := 0; i < 5; i++ {
+		record(settings, models.RecordedExchange{Time: time.Now(), Method: "GET", URL: fmt.Sprintf("/Items?page=%d", i)})
+	}
+
+	names, err := filepath.Glob(filepath.Join(settings.Dir, "*.json"))
+	if err != nil || len(names) != 2 {
+		t.Fatalf("Expected 2 files left, got %v (%v)", names, err)
+	}
+	exchanges, err := Recordings(settings)
+	if err != nil || len(exchanges) != 2 || exchanges[0].URL != "/Items?page=3" || exchanges[1].URL != "/Items?page=4" {
+		t.Errorf("Expected the latest 2 exchanges, got %+v (%v)", exchanges, err)
+	}
+}
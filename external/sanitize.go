@@ -0,0 +1,158 @@
+package external
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"go-cron/models"
+)
+
+var (
+	// scriptOrStyle matches blocks whose content is never visible text
+	scriptOrStyle = regexp.MustCompile(`(?is)<(script|style)\b.*?</(script|style)\s*>`)
+	// htmlTag matches any tag or comment
+	htmlTag = regexp.MustCompile(`(?s)<!--.*?-->|<[^>]*>`)
+	// rtfDestination matches RTF header groups (font and color tables, ...) that hold no text
+	rtfDestination = regexp.MustCompile(`\{\\(?:\*|fonttbl|colortbl|stylesheet|info)[^{}]*(?:\{[^{}]*\}[^{}]*)*\}`)
+	// rtfHex matches an escaped 8-bit character such as \'e9
+	rtfHex = regexp.MustCompile(`\\'[0-9a-fA-F]{2}`)
+	// rtfControl matches RTF control words and control symbols
+	rtfControl = regexp.MustCompile(`\\[a-zA-Z]+-?\d* ?|\\[^a-zA-Z]`)
+)
+
+// Sanitize turns a free-text field into plain text: RTF control words and
+// HTML tags are stripped, entities decoded, whitespace collapsed and the
+// result cut to maxLength characters (0 for no limit)
+func Sanitize(s string, maxLength int) string {
+	if strings.HasPrefix(strings.TrimSpace(s), `{\rtf`) {
+		s = rtfDestination.ReplaceAllString(s, "")
+		s = rtfHex.ReplaceAllStringFunc(s, func(m string) string {
+			b, _ := strconv.ParseUint(m[2:], 16, 8)
+			return string(rune(b)) // Latin-1 covers the Western code pages SAP exports
+		})
+		s = rtfControl.ReplaceAllString(s, "")
+		s = strings.NewReplacer("{", "", "}", "").Replace(s)
+	}
+
+	s = scriptOrStyle.ReplaceAllString(s, " ")
+	s = htmlTag.ReplaceAllString(s, " ")
+	s = html.UnescapeString(s)
+	s = strings.Join(strings.Fields(s), " ")
+
+	if maxLength > 0 && utf8.RuneCountInString(s) > maxLength {
+		s = strings.TrimSpace(string([]rune(s)[:maxLength]))
+	}
+	return s
+}
+
+// SanitizeItems sanitizes the free-text fields of items in place and runs
+// their names through the title steps. With KeepRaw set, the original value of
+// every field that changed is kept on the item so it can be stored alongside
+// the cleaned one.
+func SanitizeItems(items []models.ExternalItem, config models.SanitizeConfig) {
+	titles, err := NewTitlePipeline(config)
+	if err != nil {
+		// The steps are checked by config.Validate
+		log.Printf("Ignoring the title steps: %v\n", err)
+		titles = &TitlePipeline{}
+	}
+	if !config.Enabled && titles.empty() {
+		return
+	}
+	for i := range items {
+		raw := items[i].ItemName
+		name := raw
+		if config.Enabled {
+			name = Sanitize(name, config.MaxLength)
+		}
+		items[i].ItemName = titles.Apply(name)
+		if config.KeepRaw && items[i].ItemName != raw {
+			items[i].RawItemName = raw
+		}
+	}
+}
+
+// bracketNote matches a note in parentheses or square brackets and the space before it
+var bracketNote = regexp.MustCompile(`\s*(?:\([^()]*\)|\[[^\[\]]*\])`)
+
+// TitlePipeline applies the title steps of a models.SanitizeConfig
+type TitlePipeline struct {
+	steps []func(string) string
+}
+
+// NewTitlePipeline compiles the title steps of config
+func NewTitlePipeline(config models.SanitizeConfig) (*TitlePipeline, error) {
+	p := &TitlePipeline{}
+	for _, step := range config.TitleSteps {
+		switch step {
+		case models.TitleStepReplace:
+			for i, r := range config.TitleReplacements {
+				re, err := regexp.Compile(r.Pattern)
+				if err != nil {
+					return nil, fmt.Errorf("title replacement %d: %w", i+1, err)
+				}
+				replacement := r.Replacement
+				p.steps = append(p.steps, func(s string) string { return re.ReplaceAllString(s, replacement) })
+			}
+		case models.TitleStepStripBrackets:
+			p.steps = append(p.steps, func(s string) string { return bracketNote.ReplaceAllString(s, "") })
+		case models.TitleStepTrimSuffixes:
+			suffixes := config.TitleSuffixes
+			p.steps = append(p.steps, func(s string) string { return trimSuffixes(s, suffixes) })
+		case models.TitleStepTitleCase:
+			p.steps = append(p.steps, titleCase)
+		case models.TitleStepUpper:
+			p.steps = append(p.steps, strings.ToUpper)
+		default:
+			return nil, fmt.Errorf("unknown title step %q", step)
+		}
+	}
+	return p, nil
+}
+
+// empty reports whether the pipeline has no steps
+func (p *TitlePipeline) empty() bool {
+	return len(p.steps) == 0
+}
+
+// Apply runs title through the steps and collapses the whitespace they leave
+func (p *TitlePipeline) Apply(title string) string {
+	if p.empty() {
+		return title
+	}
+	for _, step := range p.steps {
+		title = step(title)
+	}
+	return strings.Join(strings.Fields(title), " ")
+}
+
+// trimSuffixes removes the first of suffixes that ends s, ignoring case
+func trimSuffixes(s string, suffixes []string) string {
+	s = strings.TrimSpace(s)
+	for _, suffix := range suffixes {
+		if suffix != "" && len(s) >= len(suffix) && strings.EqualFold(s[len(s)-len(suffix):], suffix) {
+			return strings.TrimSpace(s[:len(s)-len(suffix)])
+		}
+	}
+	return s
+}
+
+// titleCase capitalizes every word of s, keeping the words with digits
+func titleCase(s string) string {
+	words := strings.Fields(s)
+	for i, word := range words {
+		if strings.IndexFunc(word, unicode.IsDigit) >= 0 {
+			continue
+		}
+		runes := []rune(strings.ToLower(word))
+		runes[0] = unicode.ToUpper(runes[0])
+		words[i] = string(runes)
+	}
+	return strings.Join(words, " ")
+}
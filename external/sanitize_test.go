@@ -0,0 +1,92 @@
+package external
+
+import (
+	"testing"
+
+	"go-cron/models"
+)
+
+// Test_Sanitize tests stripping markup from free-text fields
+func Test_Sanitize(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		maxLength int
+		want      string
+	}{
+		{"plain text", "Product A", 0, "Product A"},
+		{"html tags", "<b>Product</b>&nbsp;<i>A</i>", 0, "Product A"},
+		{"entities", "Fish &amp; Chips &lt;XL&gt;", 0, "Fish & Chips <XL>"},
+		{"script", "Product<script>alert('x')</script> A", 0, "Product A"},
+		{"comments", "Product <!-- internal --> A", 0, "Product A"},
+		{"whitespace", "  Product \n\t A  ", 0, "Product A"},
+		{"rtf", `{\rtf1\ansi\deff0 {\fonttbl {\f0 Arial;}}\f0\fs20 Caf\'e9 Product\par}`, 0, "Café Product"},
+		{"max length", "Ünïcödé Product", 7, "Ünïcödé"},
+		{"max length trims", "Product A", 8, "Product"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sanitize(tt.input, tt.maxLength); got != tt.want {
+				t.Errorf("Sanitize(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+// Test_SanitizeItems tests that raw values are only kept when asked and when they changed
+func Test_SanitizeItems(t *testing.T) {
+	items := []models.ExternalItem{{ItemName: "<b>Product A</b>"}, {ItemName: "Product B"}}
+
+	SanitizeItems(items, models.SanitizeConfig{Enabled: true, KeepRaw: true})
+
+	if items[0].ItemName != "Product A" || items[0].RawItemName != "<b>Product A</b>" {
+		t.Errorf("Unexpected sanitized item: %+v", items[0])
+	}
+	if items[1].RawItemName != "" {
+		t.Errorf("Expected no raw value for clean text, got %q", items[1].RawItemName)
+	}
+
+	disabled := []models.ExternalItem{{ItemName: "<b>Product A</b>"}}
+	SanitizeItems(disabled, models.SanitizeConfig{})
+	if disabled[0].ItemName != "<b>Product A</b>" {
+		t.Errorf("Expected sanitization to be skipped when disabled, got %q", disabled[0].ItemName)
+	}
+}
+
+// Test_TitlePipeline tests that the title steps run in order and leave clean titles
+func Test_TitlePipeline(t *testing.T) {
+	pipeline, err := NewTitlePipeline(models.SanitizeConfig{
+		TitleSteps:        []string{models.TitleStepStripBrackets, models.TitleStepReplace, models.TitleStepTrimSuffixes, models.TitleStepTitleCase},
+		TitleReplacements: []models.TitleReplacement{{Pattern: `(?i)\bPCS\b`, Replacement: "pieces"}},
+		TitleSuffixes:     []string{"- old"},
+	})
+	if err != nil {
+		t.Fatalf("NewTitlePipeline failed: %v", err)
+	}
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"COFFEE BEANS 1KG (DO NOT USE)", "Coffee Beans 1KG"},
+		{"TEA [discontinued] 20 PCS", "Tea 20 Pieces"},
+		{"green tea - OLD", "Green Tea"},
+		{"Plain", "Plain"},
+	}
+	for _, tt := range tests {
+		if got := pipeline.Apply(tt.input); got != tt.want {
+			t.Errorf("Apply(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+// Test_SanitizeItems_TitleSteps tests that the title steps run even when
+// sanitization is disabled, keeping the raw name
+func Test_SanitizeItems_TitleSteps(t *testing.T) {
+	items := []models.ExternalItem{{ItemName: "COFFEE BEANS (DO NOT USE)"}}
+	SanitizeItems(items, models.SanitizeConfig{KeepRaw: true, TitleSteps: []string{models.TitleStepStripBrackets}})
+	if items[0].ItemName != "COFFEE BEANS" || items[0].RawItemName != "COFFEE BEANS (DO NOT USE)" {
+		t.Errorf("Unexpected item: %+v", items[0])
+	}
+}
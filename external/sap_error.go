@@ -0,0 +1,180 @@
+package external
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Classes of Service Layer errors, deciding whether a request is retried
+const (
+	// SAPErrorSession is an invalid or expired session; retrying with the same session cannot succeed
+	SAPErrorSession = "session"
+	// SAPErrorNotFound is a query or entity that matched nothing
+	SAPErrorNotFound = "not_found"
+	// SAPErrorTransient is an overloaded or unavailable server; the request is retried
+	SAPErrorTransient = "transient"
+	// SAPErrorPermanent is any other rejected request, e.g. an invalid filter or credentials
+	SAPErrorPermanent = "permanent"
+)
+
+// sapErrorClasses maps the Service Layer error codes that are not classified by their HTTP status
+var sapErrorClasses = map[int]string{
+	301:   SAPErrorSession,  // Invalid session or session already timeout
+	-304:  SAPErrorSession,  // Session expired
+	-2028: SAPErrorNotFound, // No matching records found
+}
+
+// maxErrorBodyLength bounds how much of an unparseable error body ends up in run errors
+const maxErrorBodyLength = 200
+
+// APIError is an error response of the Service Layer. The OData error body is
+// parsed into the SAP code and message; a body that is not an OData error is
+// kept, truncated, instead.
+type APIError struct {
+	// Op is the failed operation, e.g. "login" or "fetch"
+	Op         string
+	StatusCode int
+	// Code is the SAP error code, zero when the body is not an OData error
+	Code    int
+	Message string
+	// Body is the start of a response body that is not an OData error
+	Body string
+}
+
+func (e *APIError) Error() string {
+	if e.Code != 0 || e.Message != "" {
+		return fmt.Sprintf("%s failed with status %d: SAP error %d: %s", e.Op, e.StatusCode, e.Code, e.Message)
+	}
+	return fmt.Sprintf("%s failed with status %d: %s", e.Op, e.StatusCode, e.Body)
+}
+
+// Class classifies the error by its SAP code, falling back to its HTTP status
+func (e *APIError) Class() string {
+	if class, ok := sapErrorClasses[e.Code]; ok {
+		return class
+	}
+	switch {
+	case e.StatusCode == http.StatusUnauthorized:
+		return SAPErrorSession
+	case e.StatusCode == http.StatusNotFound:
+		return SAPErrorNotFound
+	case e.StatusCode == http.StatusTooManyRequests, e.StatusCode >= 500:
+		return SAPErrorTransient
+	default:
+		return SAPErrorPermanent
+	}
+}
+
+// Retryable reports whether the request may succeed when sent again
+func (e *APIError) Retryable() bool {
+	return e.Class() == SAPErrorTransient
+}
+
+// odataError is the error body of the Service Layer. OData v3 returns a
+// numeric code and a localized message object, OData v4 strings for both.
+type odataError struct {
+	Error struct {
+		Code    json.RawMessage `json:"code"`
+		Message json.RawMessage `json:"message"`
+	} `json:"error"`
+}
+
+// newAPIError reads the error response of op into an *APIError
+func newAPIError(op string, resp *http.Response) *APIError {
+	body, _ := io.ReadAll(resp.Body)
+	apiErr := &APIError{Op: op, StatusCode: resp.StatusCode}
+
+	var parsed odataError
+	if err := json.Unmarshal(body, &parsed); err != nil || parsed.Error.Code == nil {
+		apiErr.Body = truncate(strings.TrimSpace(string(body)), maxErrorBodyLength)
+		return apiErr
+	}
+
+	var code string
+	if err := json.Unmarshal(parsed.Error.Code, &code); err != nil {
+		code = string(parsed.Error.Code)
+	}
+	apiErr.Code, _ = strconv.Atoi(strings.TrimSpace(code))
+
+	var localized struct {
+		Value string `json:"value"`
+	}
+	if err := json.Unmarshal(parsed.Error.Message, &apiErr.Message); err != nil {
+		if json.Unmarshal(parsed.Error.Message, &localized) == nil {
+			apiErr.Message = localized.Value
+		}
+	}
+	return apiErr
+}
+
+// truncate shortens s to at most n bytes, marking the cut
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
+
+// maxRequestAttempts bounds how often a request failing with a transient error is sent
+const maxRequestAttempts = 3
+
+// requestBackoff is the delay before the second attempt, growing linearly with every attempt
+var requestBackoff = 500 * time.Millisecond
+
+// withRetry runs request, running it again with a growing backoff while it
+// fails with a retryable *APIError. Any other error fails fast, and so does
+// every request while the breaker of ctx, if any, is open.
+func withRetry(ctx context.Context, request func() error) error {
+	breaker := breakerFrom(ctx)
+	var err error
+	for attempt := 1; attempt <= maxRequestAttempts; attempt++ {
+		var apiErr *APIError
+		if breaker != nil {
+			if openErr := breaker.allow(); openErr != nil {
+				return openErr
+			}
+		}
+		err = request()
+		noteThrottled(ctx, err)
+		if breaker != nil {
+			breaker.record(err)
+		}
+		if err == nil || !errors.As(err, &apiErr) || !apiErr.Retryable() || attempt == maxRequestAttempts {
+			return err
+		}
+		log.Printf("%v (attempt %d), retrying", err, attempt)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt) * requestBackoff):
+		}
+	}
+	return err
+}
+
+// IsUnavailable reports whether err means the Service Layer could not be
+// reached (refused connection, unknown host) or answered with a server error,
+// as opposed to rejecting the request. Running out of time, a canceled run or
+// a refused certificate say nothing about the Service Layer being down.
+func IsUnavailable(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= http.StatusInternalServerError
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) || errors.Is(err, syscall.ECONNREFUSED)
+}
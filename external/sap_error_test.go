@@ -0,0 +1,125 @@
+package external
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"go-cron/models"
+)
+
+// Test_newAPIError tests parsing OData v3 and v4 error bodies and classifying them
+func Test_newAPIError(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		code    int
+		message string
+		class   string
+	}{
+		{"v3 session", 401, `{"error":{"code":-304,"message":{"lang":"en-us","value":"Session expired"}}}`, -304, "Session expired", SAPErrorSession},
+		{"v4 not found", 404, `{"error":{"code":"-2028","message":"No matching records found"}}`, -2028, "No matching records found", SAPErrorNotFound},
+		{"unknown code on 503", 503, `{"error":{"code":-1,"message":"Server busy"}}`, -1, "Server busy", SAPErrorTransient},
+		{"invalid filter", 400, `{"error":{"code":-1000,"message":"Invalid property 'ItemNme'"}}`, -1000, "Invalid property 'ItemNme'", SAPErrorPermanent},
+		{"not OData", 502, `<html>Bad Gateway</html>`, 0, "", SAPErrorTransient},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{StatusCode: tt.status, Body: io.NopCloser(strings.NewReader(tt.body))}
+		err := newAPIError("fetch", resp)
+		if err.Code != tt.code || err.Message != tt.message {
+			t.Errorf("%s: expected code %d and message %q, got %d and %q", tt.name, tt.code, tt.message, err.Code, err.Message)
+		}
+		if err.Class() != tt.class {
+			t.Errorf("%s: expected class %s, got %s", tt.name, tt.class, err.Class())
+		}
+	}
+
+	resp := &http.Response{StatusCode: 500, Body: io.NopCloser(strings.NewReader(strings.Repeat("x", 1000)))}
+	if err := newAPIError("fetch", resp); len(err.Error()) > 300 {
+		t.Errorf("Expected an unparseable body to be truncated, got %d bytes", len(err.Error()))
+	}
+}
+
+// Test_fetchPage_RetriesTransientErrors tests that transient errors are retried and session errors fail fast
+func Test_fetchPage_RetriesTransientErrors(t *testing.T) {
+	defer func(backoff time.Duration) { requestBackoff = backoff }(requestBackoff)
+	requestBackoff = time.Millisecond
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch {
+		case r.URL.Query().Get("$top") == "expired":
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error":{"code":-304,"message":{"lang":"en-us","value":"Session expired"}}}`)
+		case requests == 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, `{"error":{"code":-5002,"message":"Service unavailable"}}`)
+		default:
+			fmt.Fprint(w, `{"value":[{"ItemCode":"A1","ItemName":"A","ItemsGroupCode":100}]}`)
+		}
+	}))
+	defer server.Close()
+
+	config := &models.AppConfig{ExternalAPI: models.ExternalApiConfig{ExternalAPIURL: server.URL, ItemsURL: "/Items"}}
+	items, _, err := FetchItemsPage(context.Background(), config, "session", 1, 0)
+	if err != nil {
+		t.Fatalf("Expected the page to be fetched on retry, got %v", err)
+	}
+	if requests != 2 || len(items) != 1 {
+		t.Errorf("Expected 1 item after 2 requests, got %d items after %d requests", len(items), requests)
+	}
+
+	requests = 0
+	u, _ := itemsURL(config, map[string]string{"$top": "expired"})
+	_, err = fetchPage(context.Background(), config, u, "session")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Class() != SAPErrorSession {
+		t.Fatalf("Expected a session error, got %v", err)
+	}
+	if requests != 1 {
+		t.Errorf("Expected session errors not to be retried, got %d requests", requests)
+	}
+	if got := err.Error(); got != "fetch failed with status 401: SAP error -304: Session expired" {
+		t.Errorf("Unexpected error message %q", got)
+	}
+}
+
+// Test_IsUnavailable tests telling an unreachable API from a rejected request
+func Test_IsUnavailable(t *testing.T) {
+	config := &models.AppConfig{ExternalAPI: models.ExternalApiConfig{ExternalAPIURL: "http://127.0.0.1:1", LoginTimeout: time.Second}}
+	if _, err := Login(context.Background(), config); !IsUnavailable(err) {
+		t.Errorf("Expected a refused connection to be unavailable, got %v", err)
+	}
+	if IsUnavailable(fmt.Errorf("login failed: %w", &APIError{Op: "login", StatusCode: 401, Code: -304})) {
+		t.Error("Expected a rejected login not to be unavailable")
+	}
+	if !IsUnavailable(fmt.Errorf("fetch: %w", &APIError{Op: "fetch", StatusCode: 503})) {
+		t.Error("Expected a 503 to be unavailable")
+	}
+	if IsUnavailable(fmt.Errorf("fetch: %w", &APIError{Op: "fetch", StatusCode: 429})) {
+		t.Error("Expected a throttled request not to be unavailable")
+	}
+	dial := func(err error) error {
+		return &url.Error{Op: "Get", URL: "https://sap.example.com/b1s/v1/Items", Err: &net.OpError{Op: "dial", Net: "tcp", Err: err}}
+	}
+	if !IsUnavailable(dial(&net.DNSError{Err: "no such host", Name: "sap.example.com", IsNotFound: true})) {
+		t.Error("Expected an unknown host to be unavailable")
+	}
+	if IsUnavailable(&url.Error{Op: "Get", URL: "https://sap.example.com", Err: context.DeadlineExceeded}) {
+		t.Error("Expected a request out of time not to be unavailable")
+	}
+	if IsUnavailable(&url.Error{Op: "Get", URL: "https://sap.example.com", Err: x509.UnknownAuthorityError{}}) {
+		t.Error("Expected a refused certificate not to be unavailable")
+	}
+}
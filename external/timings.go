@@ -0,0 +1,57 @@
+package external
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go-cron/models"
+)
+
+// pageTimer collects the durations of the page requests of a fetch. It is
+// safe for concurrent use by the page workers.
+type pageTimer struct {
+	mu            sync.Mutex
+	count         int
+	total, lo, hi time.Duration
+}
+
+// record adds the duration of a page request
+func (t *pageTimer) record(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.count == 0 || d < t.lo {
+		t.lo = d
+	}
+	if d > t.hi {
+		t.hi = d
+	}
+	t.count++
+	t.total += d
+}
+
+// timings summarizes the recorded pages, or returns nil when there were none
+func (t *pageTimer) timings() *models.PageTimings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.count == 0 {
+		return nil
+	}
+	return &models.PageTimings{Count: t.count, MinMs: t.lo.Milliseconds(),
+		AvgMs: (t.total / time.Duration(t.count)).Milliseconds(), MaxMs: t.hi.Milliseconds()}
+}
+
+// pageTimerKey is the context key of the page timer of a fetch
+type pageTimerKey struct{}
+
+// withPageTimer returns ctx recording the page requests of fetchPage and fetchBatch in t
+func withPageTimer(ctx context.Context, t *pageTimer) context.Context {
+	return context.WithValue(ctx, pageTimerKey{}, t)
+}
+
+// recordPage records a page request of ctx that started at start, if ctx has a timer
+func recordPage(ctx context.Context, start time.Time) {
+	if t, ok := ctx.Value(pageTimerKey{}).(*pageTimer); ok {
+		t.record(time.Since(start))
+	}
+}
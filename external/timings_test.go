@@ -0,0 +1,30 @@
+package external
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go-cron/models"
+)
+
+// Test_pageTimer tests the summary of the page requests recorded through a context
+func Test_pageTimer(t *testing.T) {
+	timer := &pageTimer{}
+	if timer.timings() != nil {
+		t.Error("Expected no timings without pages")
+	}
+	for _, d := range []time.Duration{30 * time.Millisecond, 10 * time.Millisecond, 20 * time.Millisecond} {
+		timer.record(d)
+	}
+	want := models.PageTimings{Count: 3, MinMs: 10, AvgMs: 20, MaxMs: 30}
+	if got := timer.timings(); got == nil || *got != want {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+
+	recordPage(context.Background(), time.Now())
+	recordPage(withPageTimer(context.Background(), timer), time.Now())
+	if got := timer.timings().Count; got != 4 {
+		t.Errorf("Expected the page of the timer's context only, got %d pages", got)
+	}
+}
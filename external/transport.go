@@ -0,0 +1,215 @@
+package external
+
+import (
+	"compress/gzip"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-cron/models"
+	"go-cron/tracing"
+)
+
+// newHTTPClient returns a client for the external API honouring the configured
+// timeouts, TLS and transport settings. jar may be nil.
+func newHTTPClient(config *models.AppConfig, jar http.CookieJar) (*http.Client, error) {
+	transport, err := sharedTransport(config)
+	if err != nil {
+		return nil, err
+	}
+	var next http.RoundTripper = gzipTransport{next: transport}
+	// Below the recording, so the header values, often API keys, are never recorded
+	if len(config.ExternalAPI.Headers) > 0 {
+		next = headerTransport{next: next, headers: config.ExternalAPI.Headers}
+	}
+	if config.ExternalAPI.Recording.Mode != models.RecordingOff {
+		next = recordingTransport{next: next, settings: config.ExternalAPI.Recording}
+	}
+	return &http.Client{Jar: jar, Timeout: config.ExternalAPI.Timeout, Transport: tracingTransport{next}}, nil
+}
+
+// tracingTransport sends the trace context of each request to the external API
+type tracingTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip injects the traceparent header of the request's span, on a copy
+// of the request as RoundTrippers must not modify it
+func (t tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if tracing.FromContext(req.Context()) != nil {
+		req = req.Clone(req.Context())
+		tracing.Inject(req.Context(), req.Header)
+	}
+	return t.next.RoundTrip(req)
+}
+
+// headerTransport sends the name=value pairs of headers with every request
+type headerTransport struct {
+	next    http.RoundTripper
+	headers []string
+}
+
+// RoundTrip sets the headers on a copy of the request
+func (t headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for _, header := range t.headers {
+		if name, value, ok := strings.Cut(header, "="); ok {
+			req.Header.Set(strings.TrimSpace(name), strings.TrimSpace(value))
+		}
+	}
+	return t.next.RoundTrip(req)
+}
+
+// gzipTransport asks for gzip responses and decompresses them. The standard
+// transport only does so when the request has no Accept-Encoding of its own,
+// so this keeps pages compressed when the configured headers name one.
+type gzipTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip sends Accept-Encoding: gzip, unless the request chose an encoding,
+// and replaces a gzip body with its decompressed content
+func (t gzipTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Accept-Encoding") == "" && req.Header.Get("Range") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("Accept-Encoding", "gzip")
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || !strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") || req.Method == http.MethodHead {
+		return resp, err
+	}
+	resp.Body = &gzipBody{body: resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return resp, nil
+}
+
+// gzipBody decompresses a response body, reading the gzip header on the first
+// Read so empty error bodies fail only when read
+type gzipBody struct {
+	body io.ReadCloser
+	zr   *gzip.Reader
+	err  error
+}
+
+// Read returns decompressed bytes of the body
+func (b *gzipBody) Read(p []byte) (int, error) {
+	if b.zr == nil && b.err == nil {
+		b.zr, b.err = gzip.NewReader(b.body)
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+	return b.zr.Read(p)
+}
+
+// Close closes the underlying body
+func (b *gzipBody) Close() error {
+	return b.body.Close()
+}
+
+// transportKey identifies the settings a transport was built from
+type transportKey struct {
+	tls       models.TLSConfig
+	transport models.TransportConfig
+}
+
+var (
+	transportsMu sync.Mutex
+	transports   = make(map[transportKey]*http.Transport)
+)
+
+// sharedTransport returns the transport for the configured TLS and connection
+// settings. Clients are created per request, so they share one transport per
+// settings; otherwise connections would never be reused and MaxConnsPerHost
+// would only cap a single request.
+func sharedTransport(config *models.AppConfig) (*http.Transport, error) {
+	key := transportKey{tls: config.ExternalAPI.TLS, transport: config.ExternalAPI.Transport}
+
+	transportsMu.Lock()
+	defer transportsMu.Unlock()
+	if t, ok := transports[key]; ok {
+		return t, nil
+	}
+
+	t, err := newTransport(key.tls, key.transport)
+	if err != nil {
+		return nil, err
+	}
+	transports[key] = t
+	return t, nil
+}
+
+// newTransport builds a transport from TLS and connection settings. Its
+// timeouts bound each step of a request, so a hung server fails the request
+// before its own Timeout when they are shorter.
+func newTransport(tlsSettings models.TLSConfig, settings models.TransportConfig) (*http.Transport, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: tlsSettings.InsecureSkipVerify}
+
+	if caFile := tlsSettings.CAFile; caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	idle := settings.MaxIdleConnsPerHost
+	if idle == 0 {
+		idle = max(settings.MaxConnsPerHost, http.DefaultMaxIdleConnsPerHost)
+	}
+	dialer := &net.Dialer{Timeout: settings.DialTimeout, KeepAlive: 30 * time.Second}
+	t := &http.Transport{
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   settings.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: settings.ResponseHeaderTimeout,
+		MaxConnsPerHost:       settings.MaxConnsPerHost,
+		MaxIdleConnsPerHost:   idle,
+		IdleConnTimeout:       settings.IdleConnTimeout,
+		ForceAttemptHTTP2:     settings.HTTP2,
+	}
+	t.Proxy = http.ProxyFromEnvironment
+	if settings.ProxyURL != "" {
+		proxy, err := url.Parse(settings.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		t.Proxy = http.ProxyURL(proxy)
+	}
+	if !settings.HTTP2 {
+		// A non-nil empty map disables the HTTP/2 upgrade altogether
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return t, nil
+}
+
+// itemsFilter returns the OData $filter selecting the synced items
+func itemsFilter(config *models.AppConfig) string {
+	if config.ExternalAPI.Filter != "" {
+		return config.ExternalAPI.Filter
+	}
+	clauses := make([]string, len(config.ExternalAPI.GroupCodes))
+	for i, code := range config.ExternalAPI.GroupCodes {
+		clauses[i] = "ItemsGroupCode eq " + strconv.Itoa(code)
+	}
+	return strings.Join(clauses, " or ")
+}
@@ -0,0 +1,144 @@
+package external
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-cron/models"
+)
+
+// Test_SharedTransport tests that clients share one transport per settings and honour the connection settings
+func Test_SharedTransport(t *testing.T) {
+	pinned := &models.AppConfig{ExternalAPI: models.ExternalApiConfig{
+		Transport: models.TransportConfig{MaxConnsPerHost: 4, IdleConnTimeout: 30 * time.Second},
+	}}
+	first, err := sharedTransport(pinned)
+	if err != nil {
+		t.Fatalf("sharedTransport failed: %v", err)
+	}
+	second, _ := sharedTransport(pinned)
+	if first != second {
+		t.Error("Expected the same settings to share a transport")
+	}
+	if first.MaxConnsPerHost != 4 || first.IdleConnTimeout != 30*time.Second {
+		t.Errorf("Unexpected connection settings: %d conns, %v idle", first.MaxConnsPerHost, first.IdleConnTimeout)
+	}
+	if first.ForceAttemptHTTP2 || first.TLSNextProto == nil {
+		t.Error("Expected HTTP/2 to be disabled")
+	}
+
+	h2 := &models.AppConfig{ExternalAPI: models.ExternalApiConfig{Transport: models.TransportConfig{HTTP2: true}}}
+	third, _ := sharedTransport(h2)
+	if third == first || !third.ForceAttemptHTTP2 || third.TLSNextProto != nil {
+		t.Error("Expected a separate transport attempting HTTP/2")
+	}
+}
+
+// Test_NewTransport_Timeouts tests that the dial, handshake, header and proxy
+// settings reach the transport and that a hung server fails the request
+func Test_NewTransport_Timeouts(t *testing.T) {
+	transport, err := newTransport(models.TLSConfig{}, models.TransportConfig{
+		MaxIdleConnsPerHost:   8,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: 50 * time.Millisecond,
+		ProxyURL:              "http://proxy.internal:3128",
+	})
+	if err != nil {
+		t.Fatalf("newTransport failed: %v", err)
+	}
+	if transport.MaxIdleConnsPerHost != 8 || transport.TLSHandshakeTimeout != 5*time.Second {
+		t.Errorf("Unexpected settings: %d idle conns, %v handshake", transport.MaxIdleConnsPerHost, transport.TLSHandshakeTimeout)
+	}
+	req := httptest.NewRequest(http.MethodGet, "https://sap.example.com/b1s/v1/Items", nil)
+	if proxy, err := transport.Proxy(req); err != nil || proxy == nil || proxy.Host != "proxy.internal:3128" {
+		t.Errorf("Expected requests to go through the proxy, got %v (%v)", proxy, err)
+	}
+
+	hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(500 * time.Millisecond)
+	}))
+	defer hung.Close()
+	direct, _ := newTransport(models.TLSConfig{}, models.TransportConfig{ResponseHeaderTimeout: 50 * time.Millisecond})
+	if direct.Proxy == nil {
+		t.Error("Expected the proxy of the environment to be used without a proxy URL")
+	}
+	start := time.Now()
+	resp, err := (&http.Client{Transport: direct}).Get(hung.URL)
+	if err == nil {
+		resp.Body.Close()
+		t.Fatal("Expected the hung server to time out")
+	}
+	if elapsed := time.Since(start); elapsed > 400*time.Millisecond {
+		t.Errorf("Expected the header timeout to fail the request early, took %v", elapsed)
+	}
+}
+
+// Test_NewHTTPClient_Headers tests that the configured headers are sent with
+// every request but never recorded
+func Test_NewHTTPClient_Headers(t *testing.T) {
+	var received string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get("X-Api-Key")
+	}))
+	defer server.Close()
+	settings := models.RecordingConfig{Mode: models.RecordingMemory, Size: 10, MaxBody: 1 << 10}
+	defer ClearRecordings(settings)
+	config := &models.AppConfig{ExternalAPI: models.ExternalApiConfig{
+		Timeout:   time.Second,
+		Headers:   []string{"X-Api-Key = proxy-secret"},
+		Recording: settings,
+	}}
+
+	client, err := newHTTPClient(config, nil)
+	if err != nil {
+		t.Fatalf("newHTTPClient failed: %v", err)
+	}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if received != "proxy-secret" {
+		t.Errorf("Expected the API key header to be sent, got %q", received)
+	}
+	exchanges, _ := Recordings(settings)
+	if len(exchanges) != 1 || exchanges[0].RequestHeaders.Get("X-Api-Key") != "" {
+		t.Errorf("Expected one exchange recorded without the API key, got %+v", exchanges)
+	}
+}
+
+// Test_NewHTTPClient_Gzip tests that pages are requested gzipped and
+// decompressed, also when the configured headers choose the encoding
+func Test_NewHTTPClient_Gzip(t *testing.T) {
+	const body = `{"value":[{"ItemCode":"A001","ItemName":"Product A"}]}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept-Encoding") != "gzip" {
+			t.Errorf("Expected Accept-Encoding: gzip, got %q", r.Header.Get("Accept-Encoding"))
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		io.WriteString(zw, body)
+		zw.Close()
+	}))
+	defer server.Close()
+
+	for _, headers := range [][]string{nil, {"Accept-Encoding=gzip"}} {
+		client, err := newHTTPClient(&models.AppConfig{ExternalAPI: models.ExternalApiConfig{Timeout: time.Second, Headers: headers}}, nil)
+		if err != nil {
+			t.Fatalf("newHTTPClient failed: %v", err)
+		}
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		got, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil || string(got) != body || resp.Header.Get("Content-Encoding") != "" {
+			t.Errorf("Expected the decompressed body with headers %v, got %q (%v)", headers, got, err)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package external
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"go-cron/models"
+)
+
+// warmSessionTTL is how long a session opened by Warm is used. It stays well
+// below the Service Layer's default 30-minute session timeout, so a fetch
+// never starts with a session about to expire.
+const warmSessionTTL = 20 * time.Minute
+
+// warmKey identifies the Service Layer account a warm session belongs to
+type warmKey struct {
+	url       string
+	companyDB string
+	userName  string
+}
+
+// warmSession is a Service Layer session logged in ahead of a fetch
+type warmSession struct {
+	key     warmKey
+	id      string
+	expires time.Time
+}
+
+var (
+	warmMu sync.Mutex
+	warm   *warmSession
+)
+
+// keyOf returns the account of config
+func keyOf(config *models.AppConfig) warmKey {
+	return warmKey{url: config.ExternalAPI.ExternalAPIURL, companyDB: config.ExternalAuth.CompanyDB, userName: config.ExternalAuth.UserName}
+}
+
+// Warm logs in to the external API and keeps the session for the next fetch
+// of this instance, so the first sync after a cold start skips the login. A
+// session kept by an earlier Warm is logged out.
+func Warm(ctx context.Context, config *models.AppConfig) error {
+	sessionID, err := Login(ctx, config)
+	if err != nil {
+		return err
+	}
+
+	keepWarm(config, sessionID)
+	return nil
+}
+
+// keepWarm keeps sessionID for the next fetch of this instance, like Warm
+// does with the session it opens
+func keepWarm(config *models.AppConfig, sessionID string) {
+	warmMu.Lock()
+	previous := warm
+	warm = &warmSession{key: keyOf(config), id: sessionID, expires: time.Now().Add(warmSessionTTL)}
+	warmMu.Unlock()
+
+	if previous != nil {
+		logoutWarm(config, previous)
+	}
+}
+
+// DropWarm logs out the session kept for the next fetch, if any, when the
+// instance will not fetch again
+func DropWarm(config *models.AppConfig) {
+	warmMu.Lock()
+	session := warm
+	warm = nil
+	warmMu.Unlock()
+
+	if session != nil {
+		logoutWarm(config, session)
+	}
+}
+
+// takeWarmSession returns the session kept by Warm for the account of config,
+// if it has not expired, and forgets it: the fetch using it logs it out
+func takeWarmSession(config *models.AppConfig) (string, bool) {
+	warmMu.Lock()
+	session := warm
+	warm = nil
+	warmMu.Unlock()
+
+	if session == nil {
+		return "", false
+	}
+	if session.key != keyOf(config) || time.Now().After(session.expires) {
+		logoutWarm(config, session)
+		return "", false
+	}
+	return session.id, true
+}
+
+// logoutWarm logs out a warm session that will not be used
+func logoutWarm(config *models.AppConfig, session *warmSession) {
+	if session.key != keyOf(config) {
+		// The session belongs to other settings; the Service Layer times it out
+		return
+	}
+	if err := Logout(config, session.id); err != nil {
+		log.Printf("Logout of the warm session failed: %v\n", err)
+	}
+}
+
+// loginOrWarm returns the session kept by Warm, or else logs in
+func loginOrWarm(ctx context.Context, config *models.AppConfig) (string, error) {
+	if sessionID, ok := takeWarmSession(config); ok {
+		log.Println("Using the session opened by the warmup")
+		return sessionID, nil
+	}
+	return Login(ctx, config)
+}
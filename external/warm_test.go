@@ -0,0 +1,42 @@
+package external
+
+import (
+	"context"
+	"testing"
+
+	"go-cron/internal/testserver"
+	"go-cron/models"
+)
+
+// Test_Warm tests that the next fetch uses the warm session once and that a
+// warm session of other settings is not used
+func Test_Warm(t *testing.T) {
+	server := testserver.New(fakeItems(3)...)
+	defer server.Close()
+	config := &models.AppConfig{ExternalAPI: models.ExternalApiConfig{PageSize: 10, NumWorkers: 1}}
+	server.Configure(config)
+
+	if err := Warm(context.Background(), config); err != nil {
+		t.Fatalf("Warm failed: %v", err)
+	}
+	for range 2 {
+		if _, err := FetchAllItems(context.Background(), config); err != nil {
+			t.Fatalf("FetchAllItems failed: %v", err)
+		}
+	}
+	if got := server.Requests(testserver.EndpointLogin); got != 2 {
+		t.Errorf("Expected the warmup and the second fetch to log in, got %d logins", got)
+	}
+	if server.OpenSessions() != 0 {
+		t.Error("Expected every session to be logged out")
+	}
+
+	if err := Warm(context.Background(), config); err != nil {
+		t.Fatalf("Warm failed: %v", err)
+	}
+	other := *config
+	other.ExternalAuth.UserName = "other"
+	if _, ok := takeWarmSession(&other); ok {
+		t.Error("Expected the session of other settings to be left unused")
+	}
+}
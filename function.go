@@ -0,0 +1,19 @@
+// Package gocron is the entry point of the sync trigger on Google Cloud
+// Functions, which builds the HTTP function from the root package of the
+// module:
+//
+//	gcloud functions deploy go-cron --runtime=go124 --trigger-http --entry-point=Sync
+//
+// Cloud Scheduler sends the cron secret like Vercel Cron does.
+package gocron
+
+import (
+	"net/http"
+
+	"go-cron/runner"
+)
+
+// Sync is the HTTP function of the sync trigger
+func Sync(w http.ResponseWriter, r *http.Request) {
+	runner.New().ServeHTTP(w, r)
+}
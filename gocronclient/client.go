@@ -0,0 +1,243 @@
+// Package gocronclient is a typed Go client for the go-cron HTTP API.
+//
+//	client := gocronclient.New("https://sync.example.com", os.Getenv("CRON_SECRET"))
+//	status, err := client.Status(ctx)
+package gocronclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-cron/models"
+	"go-cron/webhooksig"
+)
+
+// Client calls the go-cron HTTP API with Bearer authentication and retries
+type Client struct {
+	baseURL    string
+	secret     string
+	sign       bool
+	httpClient *http.Client
+	maxRetries int
+	backoff    time.Duration
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sets the underlying HTTP client
+func WithHTTPClient(c *http.Client) Option {
+	return func(client *Client) { client.httpClient = c }
+}
+
+// WithRetries sets how many times idempotent requests are retried and the initial backoff, doubled on every attempt
+func WithRetries(maxRetries int, backoff time.Duration) Option {
+	return func(client *Client) {
+		client.maxRetries = maxRetries
+		client.backoff = backoff
+	}
+}
+
+// WithHMAC signs requests with the secret instead of sending it, for servers
+// configured with AUTH_SCHEME=hmac
+func WithHMAC() Option {
+	return func(client *Client) { client.sign = true }
+}
+
+// New creates a client for the API at baseURL authenticating with secret
+func New(baseURL, secret string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		secret:     secret,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		maxRetries: 3,
+		backoff:    500 * time.Millisecond,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// APIError is returned when the API responds with a non-2xx status
+type APIError struct {
+	StatusCode int
+	Message    string
+	// Code classifies the failure, one of the models.ErrorCode constants, when the API sent one
+	Code string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("go-cron API returned %d: %s", e.StatusCode, e.Message)
+}
+
+// Trigger runs a sync and waits for its result. It is never retried, since a
+// retried trigger could start a second sync.
+func (c *Client) Trigger(ctx context.Context) (*models.TriggerResponse, error) {
+	var resp models.TriggerResponse
+	if err := c.do(ctx, "/api/index", nil, nil, false, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// TriggerIdempotent runs a sync tagged with an idempotency key. Since the
+// server answers a repeated key with the stored result instead of syncing
+// again, it is retried like the read-only calls.
+func (c *Client) TriggerIdempotent(ctx context.Context, key string) (*models.TriggerResponse, error) {
+	var resp models.TriggerResponse
+	header := http.Header{models.IdempotencyKeyHeader: {key}}
+	if err := c.do(ctx, "/api/index", nil, header, true, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Status returns the last recorded sync run, or nil if none exist
+func (c *Client) Status(ctx context.Context) (*models.SyncRun, error) {
+	var resp models.StatusResponse
+	if err := c.do(ctx, "/api/status", nil, nil, true, &resp); err != nil {
+		return nil, err
+	}
+	return resp.LastRun, nil
+}
+
+// Runs returns up to limit recent sync runs, newest first
+func (c *Client) Runs(ctx context.Context, limit int) ([]models.SyncRun, error) {
+	var resp models.RunsResponse
+	query := url.Values{"limit": {strconv.Itoa(limit)}}
+	if err := c.do(ctx, "/api/runs", query, nil, true, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Runs, nil
+}
+
+// Products returns a page of synced products
+func (c *Client) Products(ctx context.Context, offset, limit int) ([]models.Product, error) {
+	var resp models.ProductsResponse
+	query := url.Values{"offset": {strconv.Itoa(offset)}, "limit": {strconv.Itoa(limit)}}
+	if err := c.do(ctx, "/api/products", query, nil, true, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Products, nil
+}
+
+// SearchProducts returns a page of products whose title contains filter.Title
+// and whose handle equals filter.Handle (empty fields match everything),
+// along with the total number of matches
+func (c *Client) SearchProducts(ctx context.Context, filter models.ProductFilter, offset, limit int) (*models.ProductsResponse, error) {
+	var resp models.ProductsResponse
+	query := url.Values{"offset": {strconv.Itoa(offset)}, "limit": {strconv.Itoa(limit)}}
+	if filter.Title != "" {
+		query.Set("title", filter.Title)
+	}
+	if filter.Handle != "" {
+		query.Set("handle", filter.Handle)
+	}
+	if err := c.do(ctx, "/api/products", query, nil, true, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Search returns up to limit products best matching a web-search style query
+func (c *Client) Search(ctx context.Context, query string, limit int) ([]models.Product, error) {
+	var resp models.SearchResponse
+	params := url.Values{"q": {query}, "limit": {strconv.Itoa(limit)}}
+	if err := c.do(ctx, "/api/search", params, nil, true, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Products, nil
+}
+
+// Freshness reports how old the synced data is
+func (c *Client) Freshness(ctx context.Context) (*models.FreshnessResponse, error) {
+	var resp models.FreshnessResponse
+	if err := c.do(ctx, "/api/freshness", nil, nil, true, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// do sends a GET request with the extra header and decodes the JSON response
+// into out, retrying transport errors, 429 and 5xx responses when retry is set
+func (c *Client) do(ctx context.Context, path string, query url.Values, header http.Header, retry bool, out interface{}) error {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	attempts := 1
+	if retry {
+		attempts += c.maxRetries
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(c.backoff << (attempt - 1)):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		lastErr = c.doOnce(ctx, u, header, out)
+		if lastErr == nil || !retryable(lastErr) {
+			return lastErr
+		}
+	}
+	return lastErr
+}
+
+func (c *Client) doOnce(ctx context.Context, u string, header http.Header, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if c.sign {
+		content := webhooksig.RequestContent(req.Method, req.URL.RequestURI(), nil)
+		req.Header.Set(webhooksig.Header, webhooksig.Sign(c.secret, content, time.Now()))
+	} else {
+		req.Header.Set("Authorization", "Bearer "+c.secret)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		var apiErr models.ErrorResponse
+		message := strings.TrimSpace(string(body))
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Error != "" {
+			message = apiErr.Error
+		}
+		return &APIError{StatusCode: resp.StatusCode, Message: message, Code: apiErr.Code}
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// retryable reports whether a request that failed with err may succeed on retry
+func retryable(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= 500
+	}
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,188 @@
+package gocronclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-cron/models"
+	"go-cron/webhooksig"
+)
+
+// Test_Client_StatusSendsAuthAndRetries tests auth headers and retries on 5xx
+func Test_Client_StatusSendsAuthAndRetries(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("Unexpected Authorization header: %q", r.Header.Get("Authorization"))
+		}
+		if calls < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		json.NewEncoder(w).Encode(models.StatusResponse{LastRun: &models.SyncRun{ID: 42, Status: models.SyncStatusOK}})
+	}))
+	defer server.Close()
+
+	client := New(server.URL, "secret", WithRetries(3, time.Millisecond))
+	run, err := client.Status(context.Background())
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+
+	if calls != 3 {
+		t.Errorf("Expected 3 calls, got %d", calls)
+	}
+	if run == nil || run.ID != 42 {
+		t.Errorf("Unexpected run: %+v", run)
+	}
+}
+
+// Test_Client_WithHMAC tests that signing clients send a signature of the request instead of the secret
+func Test_Client_WithHMAC(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			t.Errorf("Expected no Authorization header, got %q", r.Header.Get("Authorization"))
+		}
+		content := webhooksig.RequestContent(r.Method, r.URL.RequestURI(), nil)
+		if err := webhooksig.VerifySignature("secret", r.Header.Get(webhooksig.Header), content); err != nil {
+			t.Errorf("Expected a valid signature: %v", err)
+		}
+		json.NewEncoder(w).Encode(models.RunsResponse{})
+	}))
+	defer server.Close()
+
+	if _, err := New(server.URL, "secret", WithHMAC()).Runs(context.Background(), 5); err != nil {
+		t.Fatalf("Runs failed: %v", err)
+	}
+}
+
+// Test_Client_DoesNotRetryClientErrors tests that 4xx responses fail immediately with an APIError
+func Test_Client_DoesNotRetryClientErrors(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(models.ErrorResponse{Error: "Unauthorized"})
+	}))
+	defer server.Close()
+
+	client := New(server.URL, "wrong", WithRetries(3, time.Millisecond))
+	_, err := client.Products(context.Background(), 0, 10)
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized || apiErr.Message != "Unauthorized" {
+		t.Fatalf("Expected a 401 APIError, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("Expected 1 call, got %d", calls)
+	}
+}
+
+// Test_Client_TriggerIsNotRetried tests that triggering a sync is never retried
+func Test_Client_TriggerIsNotRetried(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	client := New(server.URL, "secret", WithRetries(3, time.Millisecond))
+	if _, err := client.Trigger(context.Background()); err == nil {
+		t.Fatal("Expected Trigger to fail")
+	}
+	if calls != 1 {
+		t.Errorf("Expected 1 call, got %d", calls)
+	}
+}
+
+// Test_Client_TriggerIdempotentRetries tests that an idempotent trigger sends its key on every attempt
+func Test_Client_TriggerIdempotentRetries(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if got := r.Header.Get(models.IdempotencyKeyHeader); got != "run-42" {
+			t.Errorf("Expected idempotency key run-42, got %q", got)
+		}
+		if calls < 2 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		fmt.Fprint(w, `{"message":"ok","itemsFetched":3}`)
+	}))
+	defer server.Close()
+
+	client := New(server.URL, "secret", WithRetries(3, time.Millisecond))
+	resp, err := client.TriggerIdempotent(context.Background(), "run-42")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if resp.ItemsFetched != 3 || calls != 2 {
+		t.Errorf("Expected 3 items after 2 calls, got %d after %d", resp.ItemsFetched, calls)
+	}
+}
+
+// Test_Client_RunsQuery tests query parameters and decoding of the runs endpoint
+func Test_Client_RunsQuery(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/runs" || r.URL.Query().Get("limit") != "5" {
+			t.Errorf("Unexpected request: %s", r.URL)
+		}
+		json.NewEncoder(w).Encode(models.RunsResponse{Runs: []models.SyncRun{{ID: 2}, {ID: 1}}})
+	}))
+	defer server.Close()
+
+	runs, err := New(server.URL+"/", "secret").Runs(context.Background(), 5)
+	if err != nil {
+		t.Fatalf("Runs failed: %v", err)
+	}
+	if len(runs) != 2 || runs[0].ID != 2 {
+		t.Errorf("Unexpected runs: %+v", runs)
+	}
+}
+
+// Test_Client_SearchProducts tests that filters are sent as query parameters
+func Test_Client_SearchProducts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("title") != "shirt" || q.Get("handle") != "" || q.Get("limit") != "5" {
+			t.Errorf("Unexpected query %q", r.URL.RawQuery)
+		}
+		json.NewEncoder(w).Encode(models.ProductsResponse{Products: []models.Product{{ID: 1, Title: "Blue Shirt"}}, Total: 1, Limit: 5})
+	}))
+	defer server.Close()
+
+	resp, err := New(server.URL, "secret").SearchProducts(context.Background(), models.ProductFilter{Title: "shirt"}, 0, 5)
+	if err != nil {
+		t.Fatalf("SearchProducts failed: %v", err)
+	}
+	if resp.Total != 1 || len(resp.Products) != 1 {
+		t.Errorf("Unexpected response: %+v", resp)
+	}
+}
+
+// Test_Client_Search tests that the query is passed through unchanged
+func Test_Client_Search(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/search" || r.URL.Query().Get("q") != `"blue shirt" -xl` {
+			t.Errorf("Unexpected request %s", r.URL)
+		}
+		json.NewEncoder(w).Encode(models.SearchResponse{Products: []models.Product{{ID: 3}}})
+	}))
+	defer server.Close()
+
+	products, err := New(server.URL, "secret").Search(context.Background(), `"blue shirt" -xl`, 10)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(products) != 1 || products[0].ID != 3 {
+		t.Errorf("Unexpected products: %+v", products)
+	}
+}
@@ -0,0 +1,183 @@
+// Package pgtest gives integration tests a scratch Postgres database: the one
+// of GOCRON_TEST_DATABASE_URL, or else a throwaway container started with
+// docker. Every test gets an empty schema of its own, where it applies the
+// migrations of the repositories, dropped when the test ends. Tests are
+// skipped in short mode and when neither database is available.
+package pgtest
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	_ "github.com/lib/pq"
+)
+
+// EnvDatabaseURL names the variable holding the URL of an existing database
+// to test against instead of a container
+const EnvDatabaseURL = "GOCRON_TEST_DATABASE_URL"
+
+// image is the Postgres image of the throwaway container
+const image = "postgres:16-alpine"
+
+// The database shared by the tests of a package, started on first use
+var (
+	startOnce   sync.Once
+	databaseURL string
+	startErr    error
+	containerID string
+)
+
+// Main runs the tests of a package, then removes the container they started.
+// Call it from TestMain.
+func Main(m *testing.M) {
+	code := m.Run()
+	if containerID != "" {
+		exec.Command("docker", "rm", "-f", containerID).Run()
+	}
+	os.Exit(code)
+}
+
+// Open returns a connection to a fresh, empty schema, first in the search
+// path, or skips the test when no database is available
+func Open(t testing.TB) *sql.DB {
+	t.Helper()
+	return openURL(t, schemaURL(t))
+}
+
+// OpenPool returns a connection and a pgx pool to the same fresh, empty
+// schema, or skips the test when no database is available
+func OpenPool(t testing.TB) (*sql.DB, *pgxpool.Pool) {
+	t.Helper()
+	uri := schemaURL(t)
+	db := openURL(t, uri)
+	pool, err := pgxpool.New(context.Background(), uri)
+	if err != nil {
+		t.Fatalf("Failed to open pgx pool: %v", err)
+	}
+	t.Cleanup(pool.Close)
+	return db, pool
+}
+
+// schemaURL creates a fresh schema, dropped when the test ends, and returns
+// the connection string putting it first in the search path
+func schemaURL(t testing.TB) string {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("Skipping Postgres integration test in short mode")
+	}
+	startOnce.Do(func() {
+		databaseURL = os.Getenv(EnvDatabaseURL)
+		if databaseURL == "" {
+			databaseURL, startErr = startContainer()
+		}
+	})
+	if startErr != nil {
+		t.Skipf("No Postgres available (set %s or install docker): %v", EnvDatabaseURL, startErr)
+	}
+
+	admin, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	name := "pgtest_" + randomSuffix()
+	if _, err := admin.Exec(`CREATE SCHEMA ` + name); err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec(`DROP SCHEMA ` + name + ` CASCADE`); err != nil {
+			t.Errorf("Failed to drop schema %s: %v", name, err)
+		}
+	})
+	return withSearchPath(databaseURL, name)
+}
+
+// openURL opens uri, closed when the test ends
+func openURL(t testing.TB, uri string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("postgres", uri)
+	if err != nil {
+		t.Fatalf("Failed to open schema: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// startContainer starts a Postgres container on a free local port and waits
+// until it accepts connections
+func startContainer() (string, error) {
+	if _, err := exec.LookPath("docker"); err != nil {
+		return "", err
+	}
+	out, err := exec.Command("docker", "run", "-d", "--rm",
+		"-e", "POSTGRES_PASSWORD=pgtest", "-e", "POSTGRES_DB=pgtest",
+		"-p", "127.0.0.1::5432", image).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to start %s: %w", image, commandError(err))
+	}
+	containerID = strings.TrimSpace(string(out))
+
+	out, err = exec.Command("docker", "port", containerID, "5432/tcp").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the port of %s: %w", image, commandError(err))
+	}
+	address, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	uri := "postgres://postgres:pgtest@" + address + "/pgtest?sslmode=disable"
+
+	db, err := sql.Open("postgres", uri)
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+	deadline := time.Now().Add(time.Minute)
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		err = db.PingContext(ctx)
+		cancel()
+		if err == nil {
+			return uri, nil
+		}
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("%s did not accept connections: %w", image, err)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+// commandError adds the stderr of a failed command to its error
+func commandError(err error) error {
+	if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return err
+}
+
+// withSearchPath returns the connection string uri with its search_path set to schema
+func withSearchPath(uri, schema string) string {
+	if u, err := url.Parse(uri); err == nil && (u.Scheme == "postgres" || u.Scheme == "postgresql") {
+		query := u.Query()
+		query.Set("search_path", schema)
+		u.RawQuery = query.Encode()
+		return u.String()
+	}
+	return uri + " search_path=" + schema
+}
+
+// randomSuffix returns a short random schema name suffix
+func randomSuffix() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,42 @@
+// Package recovery turns panics into errors, so a bug in one page, chunk or
+// sink fails that unit of work instead of crashing the whole function
+package recovery
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+)
+
+// PanicError is a recovered panic with the stack of the goroutine that panicked
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Error returns p, the value of recover(), as a *PanicError and logs it with
+// its stack, or returns nil when nothing panicked. Call it with recover() from
+// the deferred function itself:
+//
+//	defer func() {
+//		if p := recovery.Error(recover()); p != nil {
+//			err = p
+//		}
+//	}()
+//
+// A *PanicError recovered again, after being re-panicked, is returned as is.
+func Error(p interface{}) error {
+	if p == nil {
+		return nil
+	}
+	if err, ok := p.(*PanicError); ok {
+		return err
+	}
+	err := &PanicError{Value: p, Stack: debug.Stack()}
+	log.Printf("Recovered %v\n%s", err, err.Stack)
+	return err
+}
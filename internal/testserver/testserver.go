@@ -0,0 +1,390 @@
+// Package testserver is a fake SAP Business One Service Layer for tests. It
+// serves the login, logout, $count, Items and $batch endpoints go-cron uses,
+// pages items with $top/$skip or nextLinks, expires sessions and answers with
+// injected OData errors, so the fetch and the HTTP handlers can be tested
+// end to end without an SAP system.
+package testserver
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-cron/models"
+)
+
+// Endpoints of the fake Service Layer, relative to its URL
+const (
+	EndpointLogin  = "/Login"
+	EndpointLogout = "/Logout"
+	EndpointCount  = "/Items/$count"
+	EndpointItems  = "/Items"
+	EndpointBatch  = "/$batch"
+)
+
+// Credentials accepted by a new server
+const (
+	CompanyDB = "SBODEMO"
+	UserName  = "manager"
+	Password  = "secret"
+)
+
+// defaultPageSize is the page size of a request without $top, like the
+// Service Layer's default
+const defaultPageSize = 20
+
+// Failure is an OData error the server answers a request with
+type Failure struct {
+	Status  int
+	Code    int
+	Message string
+}
+
+// Common failures of the Service Layer
+var (
+	// Unavailable is an overloaded server; go-cron retries it
+	Unavailable = Failure{Status: http.StatusServiceUnavailable, Code: -1, Message: "Service Unavailable"}
+	// SessionExpired is the answer to a request with an unknown or expired session
+	SessionExpired = Failure{Status: http.StatusUnauthorized, Code: 301, Message: "Invalid session or session already timeout."}
+	// LoginFailed is the answer to a login with the wrong credentials
+	LoginFailed = Failure{Status: http.StatusUnauthorized, Code: 100000027, Message: "Login failed"}
+)
+
+// Server is a fake Service Layer listening on a local port. Set its fields
+// before the first request.
+type Server struct {
+	*httptest.Server
+
+	// MaxPageSize caps $top like the PageSize of the Service Layer; zero
+	// serves any page size
+	MaxPageSize int
+	// NextLink adds an odata.nextLink to every page but the last
+	NextLink bool
+	// SessionTimeout expires sessions after their last use; zero keeps them
+	SessionTimeout time.Duration
+	// Delay holds every response back, for timeout tests
+	Delay time.Duration
+
+	mu       sync.Mutex
+	items    []json.RawMessage
+	sessions map[string]time.Time
+	failures map[string][]Failure
+	requests map[string]int
+	logins   int
+}
+
+// New starts a server serving items; close it when done
+func New(items ...models.ExternalItem) *Server {
+	s := &Server{
+		sessions: make(map[string]time.Time),
+		failures: make(map[string][]Failure),
+		requests: make(map[string]int),
+	}
+	s.SetItems(items...)
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// SetItems replaces the items served
+func (s *Server) SetItems(items ...models.ExternalItem) {
+	raw := make([]string, len(items))
+	for i, item := range items {
+		encoded, _ := json.Marshal(item)
+		raw[i] = string(encoded)
+	}
+	s.SetRawItems(raw...)
+}
+
+// SetRawItems replaces the items served with JSON objects, for items with
+// missing or mistyped fields
+func (s *Server) SetRawItems(items ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items = make([]json.RawMessage, len(items))
+	for i, item := range items {
+		s.items[i] = json.RawMessage(item)
+	}
+}
+
+// Fail answers the next requests to endpoint with failures, one per request
+func (s *Server) Fail(endpoint string, failures ...Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[endpoint] = append(s.failures[endpoint], failures...)
+}
+
+// ExpireSessions ends every open session, as a Service Layer restart does
+func (s *Server) ExpireSessions() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions = make(map[string]time.Time)
+}
+
+// Requests returns the number of requests served for endpoint, failed ones included
+func (s *Server) Requests(endpoint string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[endpoint]
+}
+
+// OpenSessions returns the number of sessions logged in and not logged out
+func (s *Server) OpenSessions() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sessions)
+}
+
+// Configure points the external API settings of config at the server
+func (s *Server) Configure(config *models.AppConfig) {
+	config.ExternalAPI.ExternalAPIURL = s.URL
+	config.ExternalAPI.LoginURL = EndpointLogin
+	config.ExternalAPI.ItemsURL = EndpointItems
+	config.ExternalAuth = models.ExternalAuthConfig{CompanyDB: CompanyDB, UserName: UserName, Password: Password}
+}
+
+// Setenv points the external API settings of the environment at the server
+// for the rest of the test, for code that loads its own configuration
+func (s *Server) Setenv(t testing.TB) {
+	t.Setenv("EXTERNAL_API_URL", s.URL)
+	t.Setenv("COMPANY_DB", CompanyDB)
+	t.Setenv("USER_NAME", UserName)
+	t.Setenv("PASSWORD", Password)
+}
+
+// serve routes a request to its endpoint after the injected failures and delay
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	if s.Delay > 0 {
+		select {
+		case <-time.After(s.Delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	endpoint := r.URL.Path
+	if failure := s.count(endpoint); failure != nil {
+		writeFailure(w, *failure)
+		return
+	}
+
+	switch {
+	case endpoint == EndpointLogin && r.Method == http.MethodPost:
+		s.login(w, r)
+	case endpoint == EndpointLogout && r.Method == http.MethodPost:
+		if session, ok := s.session(w, r); ok {
+			s.mu.Lock()
+			delete(s.sessions, session)
+			s.mu.Unlock()
+			w.WriteHeader(http.StatusNoContent)
+		}
+	case endpoint == EndpointCount && r.Method == http.MethodGet:
+		if _, ok := s.session(w, r); ok {
+			s.mu.Lock()
+			count := len(s.items)
+			s.mu.Unlock()
+			w.Header().Set("Content-Type", "text/plain")
+			fmt.Fprint(w, count)
+		}
+	case endpoint == EndpointItems && r.Method == http.MethodGet:
+		if _, ok := s.session(w, r); ok {
+			s.page(w, r)
+		}
+	case endpoint == EndpointBatch && r.Method == http.MethodPost:
+		if _, ok := s.session(w, r); ok {
+			s.batch(w, r)
+		}
+	default:
+		writeFailure(w, Failure{Status: http.StatusNotFound, Code: -1, Message: "Resource not found for the segment '" + endpoint + "'"})
+	}
+}
+
+// count counts a request to endpoint and returns the next failure injected
+// for it, if any
+func (s *Server) count(endpoint string) *Failure {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests[endpoint]++
+	var failure *Failure
+	if queued := s.failures[endpoint]; len(queued) > 0 {
+		failure, s.failures[endpoint] = &queued[0], queued[1:]
+	}
+	return failure
+}
+
+// batch serves the GET requests of the parts of a $batch request, each in the
+// session of the batch, and answers with a response part per request. Parts
+// count as requests to their endpoint and answer with its injected failures.
+func (s *Server) batch(w http.ResponseWriter, r *http.Request) {
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		writeFailure(w, Failure{Status: http.StatusBadRequest, Code: -1000, Message: "Invalid batch content type"})
+		return
+	}
+
+	var responses []*http.Response
+	reader := multipart.NewReader(r.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			writeFailure(w, Failure{Status: http.StatusBadRequest, Code: -1000, Message: "Invalid batch body"})
+			return
+		}
+		req, err := http.ReadRequest(bufio.NewReader(part))
+		if err != nil {
+			writeFailure(w, Failure{Status: http.StatusBadRequest, Code: -1000, Message: "Invalid batch request"})
+			return
+		}
+
+		rec := httptest.NewRecorder()
+		switch failure := s.count(req.URL.Path); {
+		case failure != nil:
+			writeFailure(rec, *failure)
+		case req.URL.Path == EndpointItems && req.Method == http.MethodGet:
+			s.page(rec, req)
+		default:
+			writeFailure(rec, Failure{Status: http.StatusNotFound, Code: -1, Message: "Resource not found for the segment '" + req.URL.Path + "'"})
+		}
+		responses = append(responses, rec.Result())
+	}
+
+	mw := multipart.NewWriter(w)
+	w.Header().Set("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+	w.WriteHeader(http.StatusAccepted)
+	for _, resp := range responses {
+		part, _ := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {"application/http"},
+			"Content-Transfer-Encoding": {"binary"},
+		})
+		resp.Write(part)
+	}
+	mw.Close()
+}
+
+// login opens a session for the expected credentials
+func (s *Server) login(w http.ResponseWriter, r *http.Request) {
+	var credentials models.Credentials
+	if err := json.NewDecoder(r.Body).Decode(&credentials); err != nil {
+		writeFailure(w, Failure{Status: http.StatusBadRequest, Code: -1, Message: "Invalid login body"})
+		return
+	}
+	if credentials != (models.Credentials{CompanyDB: CompanyDB, UserName: UserName, Password: Password}) {
+		writeFailure(w, LoginFailed)
+		return
+	}
+
+	s.mu.Lock()
+	s.logins++
+	session := fmt.Sprintf("session-%d", s.logins)
+	s.sessions[session] = time.Now()
+	s.mu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{Name: "B1SESSION", Value: session, Path: "/"})
+	writeJSON(w, models.LoginResponse{SessionID: session, Version: "1000190", SessionTimeout: int(s.SessionTimeout.Minutes())})
+}
+
+// session returns the open session of the request, renewing it, or answers
+// with SessionExpired
+func (s *Server) session(w http.ResponseWriter, r *http.Request) (string, bool) {
+	cookie, err := r.Cookie("B1SESSION")
+	if err != nil {
+		writeFailure(w, SessionExpired)
+		return "", false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lastUsed, ok := s.sessions[cookie.Value]
+	if ok && s.SessionTimeout > 0 && time.Since(lastUsed) > s.SessionTimeout {
+		delete(s.sessions, cookie.Value)
+		ok = false
+	}
+	if !ok {
+		writeFailure(w, SessionExpired)
+		return "", false
+	}
+	s.sessions[cookie.Value] = time.Now()
+	return cookie.Value, true
+}
+
+// page serves the items selected by $top and $skip, in pages no larger than
+// an odata.maxpagesize preference
+func (s *Server) page(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	top, skip := defaultPageSize, 0
+	preferred := 0
+	if v, ok := strings.CutPrefix(r.Header.Get("Prefer"), "odata.maxpagesize="); ok {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			preferred = n
+		}
+	}
+	if v := query.Get("$top"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeFailure(w, Failure{Status: http.StatusBadRequest, Code: -1000, Message: "Invalid $top " + v})
+			return
+		}
+		top = n
+	}
+	if v := query.Get("$skip"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeFailure(w, Failure{Status: http.StatusBadRequest, Code: -1000, Message: "Invalid $skip " + v})
+			return
+		}
+		skip = n
+	}
+	// Paging is server-driven when the preference sizes the page
+	serverPaged := preferred > 0 && (query.Get("$top") == "" || top > preferred)
+	if serverPaged {
+		top = preferred
+		w.Header().Set("Preference-Applied", "odata.maxpagesize="+strconv.Itoa(preferred))
+	}
+	if s.MaxPageSize > 0 && top > s.MaxPageSize {
+		top = s.MaxPageSize
+	}
+
+	s.mu.Lock()
+	total := len(s.items)
+	start, end := min(skip, total), min(skip+top, total)
+	response := models.ItemsResponse{Value: append([]json.RawMessage{}, s.items[start:end]...)}
+	s.mu.Unlock()
+
+	// The server drives the paging of a preference, like the Service Layer
+	if (s.NextLink || serverPaged) && end < total {
+		next := url.Values{}
+		for k, v := range query {
+			next[k] = v
+		}
+		next.Set("$skip", strconv.Itoa(end))
+		response.ODataNextLink = "Items?" + next.Encode()
+	}
+	writeJSON(w, response)
+}
+
+// writeFailure writes f as an OData v3 error body
+func writeFailure(w http.ResponseWriter, f Failure) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(f.Status)
+	fmt.Fprintf(w, `{"error":{"code":%d,"message":{"lang":"en-us","value":%q}}}`, f.Code, f.Message)
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
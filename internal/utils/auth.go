@@ -0,0 +1,117 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"go-cron/models"
+	"go-cron/webhooksig"
+)
+
+// maxSignedBody bounds the request bodies read to check their signature
+const maxSignedBody = 1 << 20
+
+// Authenticate reports whether r may call the cron endpoints: it must come
+// from one of the allowed addresses, if any are set, and prove with the
+// configured scheme that it knows the cron secret or one of the previous ones
+func Authenticate(r *http.Request, auth models.AuthConfig) bool {
+	if len(auth.AllowedIPs) > 0 && !ipAllowed(r, auth.AllowedIPs, auth.TrustedProxies) {
+		return false
+	}
+	if auth.Scheme == models.AuthSchemeHMAC {
+		return signatureValid(r, auth)
+	}
+	for _, secret := range auth.Secrets() {
+		if Authorized(r, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthenticateRequest adds the credentials of the configured scheme, made with
+// the current cron secret, to a request go-cron sends to its own endpoints
+func AuthenticateRequest(req *http.Request, auth models.AuthConfig, body []byte) {
+	if auth.Scheme == models.AuthSchemeHMAC {
+		content := webhooksig.RequestContent(req.Method, req.URL.RequestURI(), body)
+		req.Header.Set(webhooksig.Header, webhooksig.Sign(auth.CRONSecret, content, Now()))
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+auth.CRONSecret)
+}
+
+// signatureValid reports whether r carries a signature of its method, path
+// and body made with one of the secrets within the tolerance. The body is
+// restored for the handler.
+func signatureValid(r *http.Request, auth models.AuthConfig) bool {
+	header := r.Header.Get(webhooksig.Header)
+	if header == "" {
+		return false
+	}
+	var body []byte
+	if r.Body != nil {
+		var err error
+		body, err = io.ReadAll(io.LimitReader(r.Body, maxSignedBody+1))
+		if err != nil || len(body) > maxSignedBody {
+			return false
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	content := webhooksig.RequestContent(r.Method, r.URL.RequestURI(), body)
+	for _, secret := range auth.Secrets() {
+		if secret != "" && webhooksig.VerifySignatureAt(secret, header, content, Now(), auth.SignatureTolerance) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// ipAllowed reports whether the caller of r is one of the allowed addresses
+// or in one of the allowed CIDR ranges
+func ipAllowed(r *http.Request, allowed []string, trustedProxies int) bool {
+	ip, ok := clientIP(r, trustedProxies)
+	if !ok {
+		return false
+	}
+	for _, entry := range allowed {
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			if prefix.Contains(ip) {
+				return true
+			}
+		} else if addr, err := netip.ParseAddr(entry); err == nil && addr == ip {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address of the caller. Behind trustedProxies proxies
+// each appending to X-Forwarded-For, it is the entry the outermost one added,
+// that many from the right; the entries left of it are whatever the caller
+// sent. Without trusted proxies the header is ignored and the address of the
+// connection is used.
+func clientIP(r *http.Request, trustedProxies int) (netip.Addr, bool) {
+	raw := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(raw); err == nil {
+		raw = host
+	}
+	if trustedProxies > 0 {
+		var hops []string
+		for _, header := range r.Header.Values("X-Forwarded-For") {
+			hops = append(hops, strings.Split(header, ",")...)
+		}
+		if len(hops) > 0 {
+			raw = hops[max(len(hops)-trustedProxies, 0)]
+		}
+	}
+	ip, err := netip.ParseAddr(strings.TrimSpace(raw))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return ip.Unmap(), true
+}
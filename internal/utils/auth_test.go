@@ -0,0 +1,117 @@
+package utils
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-cron/models"
+)
+
+// Test_Authenticate_Bearer tests that the current and previous secrets are accepted
+func Test_Authenticate_Bearer(t *testing.T) {
+	auth := models.AuthConfig{CRONSecret: "new", PreviousSecrets: []string{"old"}, Scheme: models.AuthSchemeBearer}
+
+	for token, want := range map[string]bool{"new": true, "old": true, "other": false} {
+		r := httptest.NewRequest("GET", "/api/status", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		if got := Authenticate(r, auth); got != want {
+			t.Errorf("Expected %v for secret %q, got %v", want, token, got)
+		}
+	}
+
+	// A missing secret must not let an empty bearer token in
+	r := httptest.NewRequest("GET", "/api/status", nil)
+	r.Header.Set("Authorization", "Bearer ")
+	if Authenticate(r, models.AuthConfig{Scheme: models.AuthSchemeBearer}) {
+		t.Error("Expected an empty secret to authorize nothing")
+	}
+}
+
+// Test_Authenticate_HMAC tests signed requests, including their body, path and age
+func Test_Authenticate_HMAC(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	defer SetClock(func() time.Time { return now })()
+	auth := models.AuthConfig{CRONSecret: "new", PreviousSecrets: []string{"old"}, Scheme: models.AuthSchemeHMAC, SignatureTolerance: 5 * time.Minute}
+
+	// request authenticates a POST of {} to /api/sync?full=true carrying the
+	// signature of the given request
+	request := func(secret, target, body string, at time.Time) bool {
+		sign := httptest.NewRequest("POST", target, nil)
+		restore := SetClock(func() time.Time { return at })
+		AuthenticateRequest(sign, models.AuthConfig{CRONSecret: secret, Scheme: models.AuthSchemeHMAC}, []byte(body))
+		restore()
+
+		r := httptest.NewRequest("POST", "/api/sync?full=true", strings.NewReader("{}"))
+		r.Header = sign.Header
+		ok := Authenticate(r, auth)
+		if read, _ := io.ReadAll(r.Body); string(read) != "{}" {
+			t.Errorf("Expected the body to be restored, got %q", read)
+		}
+		return ok
+	}
+
+	tests := []struct {
+		name   string
+		secret string
+		target string
+		body   string
+		at     time.Time
+		want   bool
+	}{
+		{"current secret", "new", "/api/sync?full=true", "{}", now, true},
+		{"previous secret", "old", "/api/sync?full=true", "{}", now, true},
+		{"unknown secret", "other", "/api/sync?full=true", "{}", now, false},
+		{"other path", "new", "/api/sync", "{}", now, false},
+		{"other body", "new", "/api/sync?full=true", `{"x":1}`, now, false},
+		{"expired", "new", "/api/sync?full=true", "{}", now.Add(-10 * time.Minute), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := request(tt.secret, tt.target, tt.body, tt.at); got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	bearer := httptest.NewRequest("GET", "/api/status", nil)
+	bearer.Header.Set("Authorization", "Bearer new")
+	if Authenticate(bearer, auth) {
+		t.Error("Expected a Bearer secret to be rejected by the hmac scheme")
+	}
+}
+
+// Test_Authenticate_AllowedIPs tests the address allowlist
+func Test_Authenticate_AllowedIPs(t *testing.T) {
+	auth := models.AuthConfig{CRONSecret: "secret", Scheme: models.AuthSchemeBearer, AllowedIPs: []string{"10.0.0.0/8", "2001:db8::1"}}
+
+	tests := []struct {
+		remote    string
+		forwarded string
+		trusted   int
+		want      bool
+	}{
+		{remote: "10.1.2.3:1234", want: true},
+		{remote: "192.168.0.1:1234", want: false},
+		{remote: "[2001:db8::1]:1234", want: true},
+		{remote: "192.168.0.1:1234", forwarded: "10.9.9.9", want: false},
+		{remote: "192.168.0.1:1234", forwarded: "10.9.9.9", trusted: 1, want: true},
+		{remote: "10.1.2.3:1234", forwarded: "203.0.113.7, 10.1.2.3", trusted: 1, want: true},
+		{remote: "192.168.0.1:1234", forwarded: "10.9.9.9, 203.0.113.7", trusted: 1, want: false},
+		{remote: "192.168.0.1:1234", forwarded: "10.9.9.9, 203.0.113.7, 192.168.0.2", trusted: 2, want: false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/api/status", nil)
+		r.RemoteAddr = tt.remote
+		if tt.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		r.Header.Set("Authorization", "Bearer secret")
+		auth.TrustedProxies = tt.trusted
+		if got := Authenticate(r, auth); got != tt.want {
+			t.Errorf("Expected %v for %s (forwarded %q, %d trusted), got %v", tt.want, tt.remote, tt.forwarded, tt.trusted, got)
+		}
+	}
+}
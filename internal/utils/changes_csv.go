@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-cron/models"
+)
+
+// changesCSVHeader names the columns written by WriteChangesCSV
+var changesCSVHeader = []string{"run_id", "changed_at", "action", "product_id", "old_title", "new_title", "old_handle", "new_handle"}
+
+// WriteChangesCSV writes audited product changes as CSV with their before and
+// after values, one row per change, for readers who won't open JSON. Cells
+// that a spreadsheet would take for a formula are prefixed with a quote.
+func WriteChangesCSV(w io.Writer, changes []models.ProductChange, loc *time.Location) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(changesCSVHeader); err != nil {
+		return err
+	}
+	for _, c := range changes {
+		productID := ""
+		if c.ProductID != 0 {
+			productID = strconv.Itoa(c.ProductID)
+		}
+		row := []string{
+			strconv.Itoa(c.RunID),
+			c.ChangedAt.In(loc).Format("2006-01-02 15:04:05"),
+			c.Action,
+			productID,
+			csvText(c.OldTitle),
+			csvText(c.NewTitle),
+			csvText(c.OldHandle),
+			csvText(c.NewHandle),
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvText prefixes s with a quote when it starts like a spreadsheet formula,
+// so a title from the external API cannot run as one when the CSV is opened
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"go-cron/models"
+)
+
+// Test_WriteChangesCSV tests the CSV rendering of audited changes
+func Test_WriteChangesCSV(t *testing.T) {
+	changes := []models.ProductChange{
+		{RunID: 3, ProductID: 9, Action: models.ChangeActionUpdate, OldTitle: "Chair, oak", NewTitle: "Oak chair",
+			OldHandle: "chair-oak", NewHandle: "oak-chair", ChangedAt: time.Date(2026, 3, 1, 8, 30, 0, 0, time.UTC)},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteChangesCSV(&buf, changes, time.UTC); err != nil {
+		t.Fatalf("WriteChangesCSV failed: %v", err)
+	}
+	expected := "run_id,changed_at,action,product_id,old_title,new_title,old_handle,new_handle\n" +
+		`3,2026-03-01 08:30:00,update,9,"Chair, oak",Oak chair,chair-oak,oak-chair` + "\n"
+	if buf.String() != expected {
+		t.Errorf("CSV = %q, want %q", buf.String(), expected)
+	}
+}
+
+// Test_WriteChangesCSV_Formulas tests that text cells starting like a formula are quoted
+func Test_WriteChangesCSV_Formulas(t *testing.T) {
+	changes := []models.ProductChange{{RunID: 3, Action: models.ChangeActionCreate, NewTitle: "=HYPERLINK(\"x\")",
+		NewHandle: "-1", OldTitle: "@SUM(A1)", OldHandle: "+1", ChangedAt: time.Date(2026, 3, 1, 8, 30, 0, 0, time.UTC)}}
+
+	var buf bytes.Buffer
+	if err := WriteChangesCSV(&buf, changes, time.UTC); err != nil {
+		t.Fatalf("WriteChangesCSV failed: %v", err)
+	}
+	expected := "run_id,changed_at,action,product_id,old_title,new_title,old_handle,new_handle\n" +
+		`3,2026-03-01 08:30:00,create,,'@SUM(A1),"'=HYPERLINK(""x"")",'+1,'-1` + "\n"
+	if buf.String() != expected {
+		t.Errorf("CSV = %q, want %q", buf.String(), expected)
+	}
+}
@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// clock is the time source of the handlers and the repositories they build
+var (
+	clock   = time.Now
+	clockMu sync.RWMutex
+)
+
+// Now returns the current time of the handlers' clock. Handlers read it, and
+// hand it to the engine and repositories, instead of calling time.Now, so
+// tests of scheduling, retention, freshness and watermarks can pin it.
+func Now() time.Time {
+	clockMu.RLock()
+	defer clockMu.RUnlock()
+	return clock()
+}
+
+// SetClock replaces the clock returned by Now and returns a function restoring the previous one
+func SetClock(now func() time.Time) (restore func()) {
+	clockMu.Lock()
+	defer clockMu.Unlock()
+	previous := clock
+	clock = now
+	return func() {
+		clockMu.Lock()
+		defer clockMu.Unlock()
+		clock = previous
+	}
+}
@@ -0,0 +1,19 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_SetClock(t *testing.T) {
+	fixed := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	restore := SetClock(func() time.Time { return fixed })
+	if got := Now(); !got.Equal(fixed) {
+		t.Errorf("Expected the pinned time %s, got %s", fixed, got)
+	}
+
+	restore()
+	if got := Now(); time.Since(got) > time.Minute {
+		t.Errorf("Expected the wall clock after restoring, got %s", got)
+	}
+}
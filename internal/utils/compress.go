@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// AcceptsGzip reports whether the Accept-Encoding header of r allows a gzip
+// response, by naming gzip or a wildcard with a nonzero quality
+func AcceptsGzip(r *http.Request) bool {
+	accepted := false
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		params := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(params[0]))
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range params[1:] {
+			if name, value, ok := strings.Cut(strings.TrimSpace(param), "="); ok && strings.TrimSpace(name) == "q" {
+				if v, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+					q = v
+				}
+			}
+		}
+		// An explicit gzip entry overrides the wildcard
+		if coding == "gzip" {
+			return q > 0
+		}
+		accepted = q > 0
+	}
+	return accepted
+}
+
+// CompressResponse returns a writer compressing the response with gzip when
+// r accepts it, and the function to call once the response is written, which
+// flushes the compressed body. Otherwise it returns w unchanged.
+func CompressResponse(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, func()) {
+	w.Header().Add("Vary", "Accept-Encoding")
+	if !AcceptsGzip(r) {
+		return w, func() {}
+	}
+	gw := &gzipResponseWriter{ResponseWriter: w}
+	return gw, gw.close
+}
+
+// gzipResponseWriter compresses the body written to the wrapped writer. The
+// gzip stream starts with the first write, so responses without a body, such
+// as 204 and 304, are sent as they are.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	gz          *gzip.Writer
+	wroteHeader bool
+}
+
+// WriteHeader announces the gzip encoding, unless the status has no body
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if status != http.StatusNoContent && status != http.StatusNotModified && status >= http.StatusOK {
+		header := w.Header()
+		header.Set("Content-Encoding", "gzip")
+		// The length set by the handler is that of the uncompressed body
+		header.Del("Content-Length")
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write compresses b into the response
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.gz == nil {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.gz.Write(b)
+}
+
+// Flush sends the data compressed so far, so streamed responses keep streaming
+func (w *gzipResponseWriter) Flush() {
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the wrapped writer for http.ResponseController
+func (w *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// close ends the gzip stream
+func (w *gzipResponseWriter) close() {
+	if w.gz != nil {
+		w.gz.Close()
+	}
+}
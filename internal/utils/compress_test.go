@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Test_AcceptsGzip tests that the Accept-Encoding header decides on gzip
+func Test_AcceptsGzip(t *testing.T) {
+	tests := []struct {
+		encoding string
+		expected bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"deflate, gzip;q=0.5", true},
+		{"br", false},
+		{"*", true},
+		{"gzip;q=0", false},
+		{"*, gzip;q=0", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/api", nil)
+		r.Header.Set("Accept-Encoding", tt.encoding)
+		if got := AcceptsGzip(r); got != tt.expected {
+			t.Errorf("AcceptsGzip(%q) = %v, want %v", tt.encoding, got, tt.expected)
+		}
+	}
+}
+
+// Test_CompressResponse tests that accepted responses are gzipped and others
+// written as they are
+func Test_CompressResponse(t *testing.T) {
+	body := `{"message":"` + strings.Repeat("synced ", 1000) + `"}`
+
+	r := httptest.NewRequest(http.MethodPost, "/api", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	w, finish := CompressResponse(rec, r)
+	WriteRawJSON(w, http.StatusOK, []byte(body))
+	finish()
+
+	if rec.Header().Get("Content-Encoding") != "gzip" || rec.Header().Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("Expected a gzip response varying on Accept-Encoding, got headers %v", rec.Header())
+	}
+	if rec.Body.Len() >= len(body) {
+		t.Errorf("Expected the body compressed below %d bytes, got %d", len(body), rec.Body.Len())
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("Invalid gzip body: %v", err)
+	}
+	if got, _ := io.ReadAll(zr); string(got) != body {
+		t.Errorf("Expected the decompressed body to match, got %q", got)
+	}
+
+	plain := httptest.NewRecorder()
+	w, finish = CompressResponse(plain, httptest.NewRequest(http.MethodPost, "/api", nil))
+	WriteRawJSON(w, http.StatusOK, []byte(body))
+	finish()
+	if plain.Header().Get("Content-Encoding") != "" || plain.Body.String() != body {
+		t.Errorf("Expected an uncompressed response without Accept-Encoding, got headers %v", plain.Header())
+	}
+}
+
+// Test_CompressResponse_NoContent tests that a response without a body is not gzipped
+func Test_CompressResponse_NoContent(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/api", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	w, finish := CompressResponse(rec, r)
+	w.WriteHeader(http.StatusNoContent)
+	finish()
+	if rec.Header().Get("Content-Encoding") != "" || rec.Body.Len() != 0 {
+		t.Errorf("Expected an empty uncompressed 204, got headers %v and %d bytes", rec.Header(), rec.Body.Len())
+	}
+}
@@ -0,0 +1,278 @@
+package utils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"go-cron/models"
+	"go-cron/repo"
+	"log"
+	"sync"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// Global DB handle for connection pooling, opened lazily by InitDB
+var (
+	db     *sql.DB
+	dbErr  error
+	dbMu   sync.Mutex
+	dbOnce = &sync.Once{}
+	// dbConfig is the configuration of the last InitDB, used to reopen a closed pool
+	dbConfig *models.AppConfig
+)
+
+// poolIdleConns is the number of idle connections the pool keeps open
+const poolIdleConns = 5
+
+// ErrDBNotInitialized is returned by GetDB before InitDB was called
+var ErrDBNotInitialized = errors.New("database not initialized")
+
+// ErrShuttingDown is returned by BeginSync once Shutdown has been called
+var ErrShuttingDown = errors.New("shutting down")
+
+// In-flight sync tracking used by Shutdown to drain work before closing the pool
+var (
+	inFlightMu   sync.Mutex
+	inFlight     sync.WaitGroup
+	inFlightN    int
+	shuttingDown bool
+)
+
+// GetDB returns the connection pool. A pool closed by CloseDB or Shutdown is
+// reopened with the configuration of the last InitDB; before any InitDB it
+// returns ErrDBNotInitialized.
+func GetDB() (*sql.DB, error) {
+	dbMu.Lock()
+	conn, config := db, dbConfig
+	dbMu.Unlock()
+
+	if conn != nil {
+		return conn, nil
+	}
+	if config == nil {
+		return nil, ErrDBNotInitialized
+	}
+	if err := InitDB(config); err != nil {
+		return nil, err
+	}
+	return GetDB()
+}
+
+// OpenDB initializes the connection pool if needed and returns it
+func OpenDB(config *models.AppConfig) (*sql.DB, error) {
+	if err := InitDB(config); err != nil {
+		return nil, err
+	}
+	return GetDB()
+}
+
+// DBStats returns the statistics of the connection pool, for metrics
+func DBStats() (sql.DBStats, error) {
+	conn, err := GetDB()
+	if err != nil {
+		return sql.DBStats{}, err
+	}
+	return conn.Stats(), nil
+}
+
+// CloseDB closes the connection pools; the next GetDB reopens it
+func CloseDB() error {
+	closePgxPool()
+
+	dbMu.Lock()
+	conn := db
+	db, dbErr, dbOnce = nil, nil, &sync.Once{}
+	dbMu.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+	return conn.Close()
+}
+
+// InitDB opens the connection pool on first use. It is safe for concurrent
+// use: callers racing a cold start share a single connection attempt. Once
+// the pool is open later calls return immediately; a failed attempt is
+// reported to the callers that waited on it and retried by the next call.
+func InitDB(config *models.AppConfig) error {
+	dbMu.Lock()
+	once := dbOnce
+	dbConfig = config
+	dbMu.Unlock()
+
+	once.Do(func() {
+		conn, openErr := dialDB(config)
+		if openErr == nil && config.Database.AutoCreateSchema {
+			if openErr = createSchema(config, conn); openErr != nil {
+				conn.Close()
+				conn = nil
+			}
+		}
+
+		dbMu.Lock()
+		defer dbMu.Unlock()
+		db, dbErr = conn, openErr
+		if openErr != nil {
+			dbOnce = &sync.Once{}
+		}
+	})
+
+	dbMu.Lock()
+	defer dbMu.Unlock()
+	if db != nil {
+		return nil
+	}
+	return dbErr
+}
+
+// dialDB opens and pings a connection pool
+func dialDB(config *models.AppConfig) (*sql.DB, error) {
+	conn, err := sql.Open(config.Database.SQLDriver(), config.Database.DatabaseURI)
+	if err != nil {
+		// database/sql only knows the drivers built into the binary
+		return nil, fmt.Errorf("unable to open %s database (was gocron built with -tags %s?): %w", config.Database.SQLDriver(), config.Database.Dialect, err)
+	}
+
+	// Configure connection pool settings.
+	conn.SetMaxOpenConns(5)
+	conn.SetMaxIdleConns(poolIdleConns)
+	conn.SetConnMaxLifetime(5 * time.Minute)
+
+	// Ping the database to verify the connection.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := conn.PingContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("database ping failed: %w", err)
+	}
+	log.Println("Database connection pool established successfully.")
+	return conn, nil
+}
+
+// createSchema creates the products table of the configured dialect if it
+// does not exist; in Postgres it applies the migrations of every table
+func createSchema(config *models.AppConfig, conn *sql.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var err error
+	if config.Database.Dialect == models.DatabaseDialectPostgres || config.Database.Dialect == "" {
+		err = repo.NewProductRepositoryFromConfig(conn, config.Database).EnsureSchema(ctx)
+	} else {
+		err = repo.NewSQLProductRepository(conn, repo.Dialect(config.Database.Dialect)).EnsureSchema(ctx)
+	}
+	if err != nil {
+		return fmt.Errorf("schema bootstrap failed: %w", err)
+	}
+	log.Println("Database schema is up to date.")
+	return nil
+}
+
+// PingDB checks that the database answers within timeout, opening the pool if needed
+func PingDB(ctx context.Context, config *models.AppConfig, timeout time.Duration) error {
+	conn, err := OpenDB(config)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return conn.PingContext(ctx)
+}
+
+// WarmDB opens the connection pool and fills it with its idle connections, so
+// the first sync after a cold start does not wait on connection setup. It
+// returns the number of connections opened.
+func WarmDB(ctx context.Context, config *models.AppConfig) (int, error) {
+	conn, err := OpenDB(config)
+	if err != nil {
+		return 0, err
+	}
+	// Holding every connection at once makes the pool open distinct ones;
+	// closing them returns them to the idle pool
+	conns := make([]*sql.Conn, 0, poolIdleConns)
+	defer func() {
+		for _, c := range conns {
+			c.Close()
+		}
+	}()
+	for len(conns) < poolIdleConns {
+		c, err := conn.Conn(ctx)
+		if err != nil {
+			return len(conns), err
+		}
+		conns = append(conns, c)
+		if err := c.PingContext(ctx); err != nil {
+			return len(conns) - 1, err
+		}
+	}
+	return len(conns), nil
+}
+
+// BeginSync registers an in-flight sync. The returned function must be called
+// when the sync finishes. It fails once Shutdown has started.
+func BeginSync() (func(), error) {
+	inFlightMu.Lock()
+	defer inFlightMu.Unlock()
+
+	if shuttingDown {
+		return nil, ErrShuttingDown
+	}
+	inFlight.Add(1)
+	inFlightN++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			inFlightMu.Lock()
+			inFlightN--
+			inFlightMu.Unlock()
+			inFlight.Done()
+		})
+	}, nil
+}
+
+// ShuttingDown reports whether Shutdown has started
+func ShuttingDown() bool {
+	inFlightMu.Lock()
+	defer inFlightMu.Unlock()
+	return shuttingDown
+}
+
+// SyncsInFlight returns the number of syncs running on this instance
+func SyncsInFlight() int {
+	inFlightMu.Lock()
+	defer inFlightMu.Unlock()
+	return inFlightN
+}
+
+// Shutdown stops accepting new syncs, waits for in-flight ones to finish (or
+// ctx to expire), then closes the connection pool
+func Shutdown(ctx context.Context) error {
+	inFlightMu.Lock()
+	shuttingDown = true
+	inFlightMu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		inFlight.Wait()
+		close(drained)
+	}()
+
+	var err error
+	select {
+	case <-drained:
+		log.Println("All in-flight syncs finished.")
+	case <-ctx.Done():
+		err = ctx.Err()
+		log.Printf("Shutdown deadline reached with syncs still in flight: %v\n", err)
+	}
+
+	if closeErr := CloseDB(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	log.Println("Database connection pool closed.")
+	return err
+}
@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"go-cron/models"
+)
+
+// Test_InitDB_ReportsErrors tests that an unreachable database is reported to
+// every concurrent caller instead of crashing the process
+func Test_InitDB_ReportsErrors(t *testing.T) {
+	cfg := &models.AppConfig{Database: models.DatabaseConfig{
+		DatabaseURI: "postgres://gocron@127.0.0.1:1/gocron?sslmode=disable&connect_timeout=1",
+	}}
+	if _, err := GetDB(); !errors.Is(err, ErrDBNotInitialized) {
+		t.Errorf("Expected ErrDBNotInitialized before InitDB, got %v", err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = InitDB(cfg)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err == nil {
+			t.Errorf("caller %d: expected an error for an unreachable database", i)
+		}
+	}
+	if db, err := GetDB(); db != nil || err == nil {
+		t.Error("Expected no connection pool after a failed init")
+	}
+
+	// A failed attempt is retried rather than cached
+	if err := InitDB(cfg); err == nil {
+		t.Error("Expected the retry to fail as well")
+	}
+}
+
+// Test_SyncsInFlight tests that syncs count as in flight until done, which may be called twice
+func Test_SyncsInFlight(t *testing.T) {
+	done, err := BeginSync()
+	if err != nil {
+		t.Fatalf("BeginSync failed: %v", err)
+	}
+	if n := SyncsInFlight(); n != 1 {
+		t.Errorf("Expected 1 sync in flight, got %d", n)
+	}
+	done()
+	done()
+	if n := SyncsInFlight(); n != 0 {
+		t.Errorf("Expected no sync in flight, got %d", n)
+	}
+}
@@ -0,0 +1,6 @@
+//go:build mysql
+
+package utils
+
+// The mysql dialect is built in with -tags mysql
+import _ "github.com/go-sql-driver/mysql"
@@ -0,0 +1,6 @@
+//go:build sqlite
+
+package utils
+
+// The sqlite dialect is built in with -tags sqlite; the driver needs cgo
+import _ "github.com/mattn/go-sqlite3"
@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+
+	"go-cron/models"
+)
+
+// exportCSVHeader names the columns of a CSV catalog export
+var exportCSVHeader = []string{"id", "title", "handle", "status", "category", "price", "currency", "image", "archived_at",
+	"created_at", "updated_at", "last_synced_at"}
+
+// ProductWriter encodes the products of a catalog export one at a time
+type ProductWriter interface {
+	Write(p models.Product) error
+	// Close ends the export; it must be called even when no product was written
+	Close() error
+}
+
+// NewProductWriter returns the writer of a models.ExportFormat* format, or
+// nil for an unknown format
+func NewProductWriter(w io.Writer, format string) ProductWriter {
+	switch format {
+	case models.ExportFormatCSV:
+		return &csvProductWriter{w: csv.NewWriter(w)}
+	case models.ExportFormatJSON:
+		return &jsonProductWriter{w: w}
+	case models.ExportFormatNDJSON:
+		return &ndjsonProductWriter{enc: json.NewEncoder(w)}
+	}
+	return nil
+}
+
+// ExportContentType returns the content type of an export format
+func ExportContentType(format string) string {
+	switch format {
+	case models.ExportFormatCSV:
+		return "text/csv; charset=utf-8"
+	case models.ExportFormatNDJSON:
+		return "application/x-ndjson"
+	}
+	return "application/json"
+}
+
+// csvProductWriter writes a header then a row per product
+type csvProductWriter struct {
+	w           *csv.Writer
+	wroteHeader bool
+}
+
+func (c *csvProductWriter) header() error {
+	if c.wroteHeader {
+		return nil
+	}
+	c.wroteHeader = true
+	return c.w.Write(exportCSVHeader)
+}
+
+func (c *csvProductWriter) Write(p models.Product) error {
+	if err := c.header(); err != nil {
+		return err
+	}
+	price := ""
+	if p.Price != nil {
+		price = strconv.FormatFloat(*p.Price, 'f', -1, 64)
+	}
+	return c.w.Write([]string{strconv.Itoa(p.ID), p.Title, p.Handle, p.Status, p.Category, price, p.Currency, p.Image,
+		csvTime(p.ArchivedAt), csvTime(p.CreatedAt), csvTime(p.UpdatedAt), csvTime(p.LastSyncedAt)})
+}
+
+// csvTime formats t in RFC 3339, or empty for nil
+func csvTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func (c *csvProductWriter) Close() error {
+	if err := c.header(); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// jsonProductWriter writes the products as the elements of one JSON array
+type jsonProductWriter struct {
+	w       io.Writer
+	written int
+}
+
+func (j *jsonProductWriter) Write(p models.Product) error {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	sep := ","
+	if j.written == 0 {
+		sep = "["
+	}
+	j.written++
+	_, err = io.WriteString(j.w, sep+string(b))
+	return err
+}
+
+func (j *jsonProductWriter) Close() error {
+	end := "]\n"
+	if j.written == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(j.w, end)
+	return err
+}
+
+// ndjsonProductWriter writes one JSON product per line
+type ndjsonProductWriter struct {
+	enc *json.Encoder
+}
+
+func (n *ndjsonProductWriter) Write(p models.Product) error {
+	return n.enc.Encode(p)
+}
+
+func (n *ndjsonProductWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"go-cron/models"
+)
+
+// exportFixture returns an active product with a price and an archived one
+func exportFixture() []models.Product {
+	price := 12.5
+	archivedAt := time.Date(2024, 3, 4, 5, 6, 7, 0, time.UTC)
+	return []models.Product{
+		{ID: 1, Title: `Mug, "large"`, Handle: "mug-large", Status: models.ProductStatusActive, Category: "Kitchen", Price: &price, Currency: "EUR"},
+		{ID: 2, Title: "Tea", Handle: "tea", Status: models.ProductStatusArchived, ArchivedAt: &archivedAt, CreatedAt: &archivedAt},
+	}
+}
+
+// writeExport writes products in format
+func writeExport(t *testing.T, format string, products []models.Product) string {
+	t.Helper()
+	var b strings.Builder
+	pw := NewProductWriter(&b, format)
+	for _, p := range products {
+		if err := pw.Write(p); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	if err := pw.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	return b.String()
+}
+
+// Test_ProductWriter tests the encoding of every export format, empty exports included
+func Test_ProductWriter(t *testing.T) {
+	products := exportFixture()
+
+	want := "id,title,handle,status,category,price,currency,image,archived_at,created_at,updated_at,last_synced_at\n" +
+		"1,\"Mug, \"\"large\"\"\",mug-large,active,Kitchen,12.5,EUR,,,,,\n" +
+		"2,Tea,tea,archived,,,,,2024-03-04T05:06:07Z,2024-03-04T05:06:07Z,,\n"
+	if got := writeExport(t, models.ExportFormatCSV, products); got != want {
+		t.Errorf("Unexpected CSV:\n%s", got)
+	}
+	if got := writeExport(t, models.ExportFormatCSV, nil); got != "id,title,handle,status,category,price,currency,image,archived_at,created_at,updated_at,last_synced_at\n" {
+		t.Errorf("Expected only the header of an empty CSV, got %q", got)
+	}
+
+	var decoded []models.Product
+	if err := json.Unmarshal([]byte(writeExport(t, models.ExportFormatJSON, products)), &decoded); err != nil || len(decoded) != 2 {
+		t.Errorf("Expected a JSON array of 2 products, got %+v (%v)", decoded, err)
+	}
+	if got := writeExport(t, models.ExportFormatJSON, nil); got != "[]\n" {
+		t.Errorf("Expected an empty JSON array, got %q", got)
+	}
+
+	lines := strings.Split(strings.TrimSpace(writeExport(t, models.ExportFormatNDJSON, products)), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[1], `{"id":2,`) {
+		t.Errorf("Expected a product per line, got %q", lines)
+	}
+
+	if NewProductWriter(&strings.Builder{}, "xml") != nil {
+		t.Error("Expected no writer for an unknown format")
+	}
+}
@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go-cron/config"
+	"go-cron/internal/recovery"
+	"go-cron/models"
+	"go-cron/repo"
+)
+
+// Authorized reports whether the request carries the expected Bearer secret.
+// An empty secret, as left by a missing setting, authorizes nothing.
+func Authorized(r *http.Request, secret string) bool {
+	authHeader := r.Header.Get("authorization")
+	return secret != "" && strings.HasPrefix(authHeader, "Bearer ") && strings.TrimPrefix(authHeader, "Bearer ") == secret
+}
+
+// ConfigValid reports whether cfg is usable, writing a generic 500 response
+// when it is not. The invalid settings are only logged: call it once the
+// request is authenticated.
+func ConfigValid(w http.ResponseWriter, cfg *models.AppConfig) bool {
+	if err := cfg.Validate(); err != nil {
+		log.Printf("Refusing request: %v\n", err)
+		WriteError(w, http.StatusInternalServerError, "Server misconfigured")
+		return false
+	}
+	return true
+}
+
+// Database returns the connection pool, opening it on first use, and writes
+// a 503 response when the database cannot be reached
+func Database(w http.ResponseWriter, cfg *models.AppConfig) (*sql.DB, bool) {
+	db, err := OpenDB(cfg)
+	if err != nil {
+		log.Printf("Database unavailable: %v\n", err)
+		WriteError(w, http.StatusServiceUnavailable, "Database unavailable")
+		return nil, false
+	}
+	return db, true
+}
+
+// WriteJSON writes v as a JSON response with the given status code
+func WriteJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to encode response: %v\n", err)
+	}
+}
+
+// WriteRawJSON writes an already encoded JSON body with the given status code
+func WriteRawJSON(w http.ResponseWriter, status int, body []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err := w.Write(body); err != nil {
+		log.Printf("Failed to write response: %v\n", err)
+	}
+}
+
+// WriteError writes a JSON error response
+func WriteError(w http.ResponseWriter, status int, message string) {
+	WriteJSON(w, status, models.ErrorResponse{Error: message})
+}
+
+// WriteFailure answers a sync trigger that failed with a JSON error
+// classified by code, one of the models.ErrorCode constants
+func WriteFailure(w http.ResponseWriter, status int, code, message string) {
+	WriteJSON(w, status, models.ErrorResponse{Error: message, Code: code, Status: models.OutcomeFailed})
+}
+
+// RecoverPanic answers the request of a handler that panicked with a 500 JSON
+// error instead of crashing the function, logging the stack. Defer it first
+// thing in a handler.
+func RecoverPanic(w http.ResponseWriter) {
+	if err := recovery.Error(recover()); err != nil {
+		WriteJSON(w, http.StatusInternalServerError, models.ErrorResponse{Error: "Internal server error", Code: models.ErrorCodePanic})
+	}
+}
+
+// QueryInt reads an integer query parameter clamped to [min, max], falling back to def when absent or invalid
+func QueryInt(r *http.Request, key string, def, min, max int) int {
+	v, err := strconv.Atoi(r.URL.Query().Get(key))
+	if err != nil {
+		return def
+	}
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+// ProfileConfig reloads cfg with the sync profile imported into the database,
+// if any, and the named profile of the config file chosen by ?profile=. It
+// writes a 400 response for an unknown named profile and a 500 response when
+// the imported profile cannot be read or a profile leaves the configuration invalid.
+func ProfileConfig(w http.ResponseWriter, r *http.Request, cfg *models.AppConfig, db *sql.DB) (*models.AppConfig, bool) {
+	stored, err := repo.NewProfileRepository(db).GetActiveProfile(r.Context())
+	if err != nil {
+		log.Printf("Failed to load sync profile: %v\n", err)
+		WriteError(w, http.StatusInternalServerError, "Failed to load sync profile")
+		return nil, false
+	}
+	name := r.URL.Query().Get("profile")
+	if stored == nil && name == "" {
+		return cfg, true
+	}
+	var profile *models.SyncProfile
+	if stored != nil {
+		profile = &stored.Profile
+	}
+	profiled, err := config.LoadConfigWithNamedProfile(profile, name)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	if !ConfigValid(w, profiled) {
+		return nil, false
+	}
+	return profiled, true
+}
@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"go-cron/models"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Global pgx pool for bulk product writes, opened lazily by PgxPool
+var (
+	pgxPool   *pgxpool.Pool
+	pgxPoolMu sync.Mutex
+)
+
+// PgxPool returns the pgx connection pool used for bulk product writes with
+// the pgx driver, opening it on first use. A failed attempt is retried by the
+// next call. The pool is closed together with the database/sql pool.
+func PgxPool(config *models.AppConfig) (*pgxpool.Pool, error) {
+	pgxPoolMu.Lock()
+	defer pgxPoolMu.Unlock()
+
+	if pgxPool != nil {
+		return pgxPool, nil
+	}
+	pool, err := dialPgx(config)
+	if err != nil {
+		return nil, err
+	}
+	pgxPool = pool
+	return pgxPool, nil
+}
+
+// closePgxPool closes the pgx pool, if open; the next PgxPool reopens it
+func closePgxPool() {
+	pgxPoolMu.Lock()
+	pool := pgxPool
+	pgxPool = nil
+	pgxPoolMu.Unlock()
+
+	if pool != nil {
+		pool.Close()
+	}
+}
+
+// dialPgx opens and pings a pgx connection pool
+func dialPgx(config *models.AppConfig) (*pgxpool.Pool, error) {
+	poolConfig, err := pgxpool.ParseConfig(config.Database.DatabaseURI)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse database URL: %w", err)
+	}
+
+	// Same limits as the database/sql pool
+	poolConfig.MaxConns = 5
+	poolConfig.MaxConnLifetime = 5 * time.Minute
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open pgx pool: %w", err)
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("database ping failed: %w", err)
+	}
+	log.Println("pgx connection pool established successfully.")
+	return pool, nil
+}
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// SignLink returns baseURL+path with query, an expiry and an HMAC signature
+// over them, so the link can be opened without the Bearer secret until it expires
+func SignLink(secret, baseURL, path string, query url.Values, expires time.Time) string {
+	signed := url.Values{}
+	for k, v := range query {
+		signed[k] = v
+	}
+	signed.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	signed.Set("sig", linkSignature(secret, path, signed))
+	return baseURL + path + "?" + signed.Encode()
+}
+
+// SignedLinkValid reports whether the request carries an unexpired signature
+// made by SignLink for its path and query
+func SignedLinkValid(r *http.Request, secret string, now time.Time) bool {
+	query := r.URL.Query()
+	sig, err := hex.DecodeString(query.Get("sig"))
+	if err != nil || len(sig) == 0 || secret == "" {
+		return false
+	}
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil || now.Unix() > expires {
+		return false
+	}
+	want, _ := hex.DecodeString(linkSignature(secret, r.URL.Path, query))
+	return hmac.Equal(sig, want)
+}
+
+// linkSignature signs the path and every query parameter but sig itself
+func linkSignature(secret, path string, query url.Values) string {
+	signed := url.Values{}
+	for k, v := range query {
+		if k != "sig" {
+			signed[k] = v
+		}
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(path + "?" + signed.Encode()))
+	return hex.EncodeToString(mac.Sum(nil))
+}
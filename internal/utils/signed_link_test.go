@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test_SignedLink tests that signed links verify until they expire or are altered
+func Test_SignedLink(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	link := SignLink("secret", "https://sync.example.com", "/api/changes",
+		url.Values{"runId": {"42"}, "format": {"csv"}}, now.Add(time.Hour))
+
+	valid := httptest.NewRequest("GET", link, nil)
+	if !SignedLinkValid(valid, "secret", now) {
+		t.Errorf("Expected %s to be valid", link)
+	}
+	if SignedLinkValid(valid, "other", now) {
+		t.Error("Expected the link to be rejected with another secret")
+	}
+	if SignedLinkValid(valid, "secret", now.Add(2*time.Hour)) {
+		t.Error("Expected the link to be rejected once expired")
+	}
+
+	tampered := httptest.NewRequest("GET", strings.Replace(link, "runId=42", "runId=43", 1), nil)
+	if SignedLinkValid(tampered, "secret", now) {
+		t.Error("Expected a link with another run ID to be rejected")
+	}
+	if SignedLinkValid(httptest.NewRequest("GET", "/api/changes?runId=42", nil), "secret", now) {
+		t.Error("Expected an unsigned request to be rejected")
+	}
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"sort"
+
+	"go-cron/models"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// newCollator returns a case-insensitive collator for locale, falling back to
+// the root collation when the tag cannot be parsed
+func newCollator(locale string) *collate.Collator {
+	tag, err := language.Parse(locale)
+	if err != nil {
+		tag = language.Und
+	}
+	return collate.New(tag, collate.IgnoreCase)
+}
+
+// SortDiffsByTitle sorts the planned changes of a run in place by title
+// following the collation rules of locale, breaking ties by item code
+func SortDiffsByTitle(diffs []models.ItemDiff, locale string) {
+	c := newCollator(locale)
+	sort.SliceStable(diffs, func(i, j int) bool {
+		if cmp := c.CompareString(diffs[i].Title, diffs[j].Title); cmp != 0 {
+			return cmp < 0
+		}
+		return diffs[i].ItemCode < diffs[j].ItemCode
+	})
+}
+
+// SortChangesByTitle sorts audited changes in place by their new title, or
+// old title when the change has none, following the collation rules of
+// locale, breaking ties by the order they were recorded
+func SortChangesByTitle(changes []models.ProductChange, locale string) {
+	c := newCollator(locale)
+	title := func(change models.ProductChange) string {
+		if change.NewTitle != "" {
+			return change.NewTitle
+		}
+		return change.OldTitle
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		if cmp := c.CompareString(title(changes[i]), title(changes[j])); cmp != 0 {
+			return cmp < 0
+		}
+		return changes[i].ID < changes[j].ID
+	})
+}
+
+// SortProductsByTitle sorts products in place by title following the collation
+// rules of locale, breaking ties by handle and then ID so the order is stable
+func SortProductsByTitle(products []models.Product, locale string) {
+	c := newCollator(locale)
+	sort.SliceStable(products, func(i, j int) bool {
+		if cmp := c.CompareString(products[i].Title, products[j].Title); cmp != 0 {
+			return cmp < 0
+		}
+		if products[i].Handle != products[j].Handle {
+			return products[i].Handle < products[j].Handle
+		}
+		return products[i].ID < products[j].ID
+	})
+}
@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"testing"
+
+	"go-cron/models"
+)
+
+// Test_SortProductsByTitle tests locale-aware, case-insensitive title ordering
+func Test_SortProductsByTitle(t *testing.T) {
+	products := []models.Product{
+		{ID: 1, Title: "zebra"},
+		{ID: 2, Title: "Éclair"},
+		{ID: 3, Title: "apple"},
+		{ID: 4, Title: "Banana"},
+		{ID: 5, Title: "eclair"},
+	}
+
+	SortProductsByTitle(products, "en")
+
+	// Byte order would put "Banana" and "Éclair" in the wrong places
+	want := []int{3, 4, 5, 2, 1}
+	for i, p := range products {
+		if p.ID != want[i] {
+			t.Fatalf("Unexpected order at %d: got %+v", i, products)
+		}
+	}
+}
+
+// Test_SortDiffsByTitle tests that the planned changes of a run follow the
+// collation of the locale
+func Test_SortDiffsByTitle(t *testing.T) {
+	diffs := []models.ItemDiff{{ItemCode: "1", Title: "zebra"}, {ItemCode: "2", Title: "Éclair"}, {ItemCode: "3", Title: "apple"}}
+
+	SortDiffsByTitle(diffs, "en")
+
+	if diffs[0].ItemCode != "3" || diffs[1].ItemCode != "2" || diffs[2].ItemCode != "1" {
+		t.Errorf("Unexpected order: %+v", diffs)
+	}
+}
+
+// Test_SortChangesByTitle tests that audited changes are ordered by their new
+// title, or their old one for archives, following the collation of the locale
+func Test_SortChangesByTitle(t *testing.T) {
+	changes := []models.ProductChange{
+		{ID: 1, NewTitle: "zebra"},
+		{ID: 2, OldTitle: "Éclair"},
+		{ID: 3, NewTitle: "apple"},
+	}
+
+	SortChangesByTitle(changes, "en")
+
+	if changes[0].ID != 3 || changes[1].ID != 2 || changes[2].ID != 1 {
+		t.Errorf("Unexpected order: %+v", changes)
+	}
+}
@@ -0,0 +1,257 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go-cron/models"
+)
+
+// Response formats of the sync trigger, chosen by the Accept header
+const (
+	FormatJSON   = "application/json"
+	FormatText   = "text/plain"
+	FormatNDJSON = "application/x-ndjson"
+)
+
+// NegotiateFormat returns the offer the Accept header of r prefers, or the
+// first offer when the header is missing. Exact media types beat wildcards of
+// the same quality. It returns "" when the header accepts none of the offers.
+func NegotiateFormat(r *http.Request, offers ...string) string {
+	if len(offers) == 0 {
+		return ""
+	}
+	accept := strings.TrimSpace(r.Header.Get("Accept"))
+	if accept == "" {
+		return offers[0]
+	}
+
+	best, bestQ, bestExact := "", 0.0, false
+	for _, offer := range offers {
+		q, exact := acceptQuality(accept, offer)
+		if q > bestQ || (q == bestQ && q > 0 && exact && !bestExact) {
+			best, bestQ, bestExact = offer, q, exact
+		}
+	}
+	return best
+}
+
+// acceptQuality returns the quality the Accept header gives to mediaType, taken
+// from its most specific matching range, and whether that range names it exactly
+func acceptQuality(accept, mediaType string) (float64, bool) {
+	typ, _, _ := strings.Cut(mediaType, "/")
+	q, specificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		rng := strings.ToLower(strings.TrimSpace(params[0]))
+		s := -1
+		switch rng {
+		case mediaType:
+			s = 2
+		case typ + "/*":
+			s = 1
+		case "*/*":
+			s = 0
+		}
+		if s <= specificity {
+			continue
+		}
+		specificity, q = s, 1
+		for _, param := range params[1:] {
+			if name, value, ok := strings.Cut(strings.TrimSpace(param), "="); ok && strings.TrimSpace(name) == "q" {
+				if v, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+					q = v
+				}
+			}
+		}
+	}
+	return q, specificity == 2
+}
+
+// triggerItem is a line of an NDJSON trigger response for one changed product
+type triggerItem struct {
+	Type   string `json:"type"`
+	Action string `json:"action"`
+	Handle string `json:"handle"`
+}
+
+// triggerSummary is the last line of an NDJSON trigger response
+type triggerSummary struct {
+	Type string `json:"type"`
+	models.TriggerResponse
+}
+
+// TriggerOutcome sets the Status and Errors of response from its sync result
+// and sink deliveries and returns its HTTP status: 200 for a success and 207
+// Multi-Status for a partial sync, except for the problems callers already
+// handle by status, 504 for a sync cut short by its deadline and 409 for
+// changes held back by the change guard
+func TriggerOutcome(response *models.TriggerResponse, dryRun bool) int {
+	status := http.StatusOK
+	response.Status, response.Errors = models.OutcomeSuccess, nil
+	problem := func(code, message string) {
+		response.Status = models.OutcomePartial
+		response.Errors = append(response.Errors, models.ErrorDetail{Code: code, Message: message})
+		if status == http.StatusOK {
+			status = http.StatusMultiStatus
+		}
+	}
+
+	if result := response.SyncResult; result != nil {
+		if result.Status == models.SyncStatusTimedOut {
+			problem(models.ErrorCodeTimedOut, "the sync was cut short by its deadline")
+			status = http.StatusGatewayTimeout
+		}
+		// The trip of the guard is also listed among the errors of the result
+		errs, tripped := len(result.Errors), ""
+		if guard := result.Guard; guard != nil {
+			tripped = guard.String()
+			if !guard.Confirmed && !dryRun {
+				problem(models.ErrorCodeChangeGuard, tripped)
+				status = http.StatusConflict
+			}
+		}
+		for _, err := range result.Errors {
+			if err == tripped {
+				errs--
+			}
+		}
+		if errs > 0 {
+			problem(models.ErrorCodeItemErrors, fmt.Sprintf("%d errors applying the changes", errs))
+		}
+		if len(result.IntegrityIssues) > 0 {
+			problem(models.ErrorCodeIntegrity, fmt.Sprintf("%d integrity issues after the sync", len(result.IntegrityIssues)))
+		} else if result.Status == models.SyncStatusDegraded && errs == 0 {
+			problem(models.ErrorCodeItemErrors, "the sync completed degraded")
+		}
+	}
+	for _, sink := range response.Sinks {
+		if sink.Failed > 0 || sink.Error != "" {
+			problem(models.ErrorCodeSinks, fmt.Sprintf("sink %s: %d changes failed to deliver", sink.Sink, sink.Failed))
+		}
+	}
+	return status
+}
+
+// WriteTriggerResponse writes the response of a sync trigger in format. The
+// changed handles are listed only when verbose, except in NDJSON, which
+// streams one line per changed product before the summary line.
+func WriteTriggerResponse(w http.ResponseWriter, status int, response models.TriggerResponse, format string, verbose bool) {
+	var handles models.ChangedHandles
+	if response.Handles != nil {
+		handles = *response.Handles
+	}
+	if !verbose {
+		response.Handles = nil
+	}
+
+	switch format {
+	case FormatText:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(status)
+		if err := writeTriggerText(w, response); err != nil {
+			log.Printf("Failed to write response: %v\n", err)
+		}
+	case FormatNDJSON:
+		w.Header().Set("Content-Type", FormatNDJSON)
+		w.WriteHeader(status)
+		if err := writeTriggerNDJSON(w, response, handles); err != nil {
+			log.Printf("Failed to write response: %v\n", err)
+		}
+	default:
+		WriteJSON(w, status, response)
+	}
+}
+
+// writeTriggerNDJSON writes a line per changed product, then the summary
+func writeTriggerNDJSON(w io.Writer, response models.TriggerResponse, handles models.ChangedHandles) error {
+	encoder := json.NewEncoder(w)
+	for _, group := range changedGroups(handles) {
+		for _, handle := range group.handles {
+			if err := encoder.Encode(triggerItem{Type: "item", Action: group.action, Handle: handle}); err != nil {
+				return err
+			}
+		}
+	}
+	return encoder.Encode(triggerSummary{Type: "summary", TriggerResponse: response})
+}
+
+// writeTriggerText writes a summary of the response for people reading it in
+// a terminal
+func writeTriggerText(w io.Writer, response models.TriggerResponse) error {
+	var b strings.Builder
+	fmt.Fprintln(&b, response.Message)
+	if result := response.SyncResult; result != nil {
+		status := result.Status
+		if result.DryRun {
+			status += " (dry run)"
+		}
+		fmt.Fprintf(&b, "Status: %s\n", status)
+		fmt.Fprintf(&b, "Items: %d fetched of %d\n", response.ItemsFetched, response.TotalItems)
+		fmt.Fprintf(&b, "Created: %d, Updated: %d, Reactivated: %d, Archived: %d, Unchanged: %d\n",
+			result.Created, result.Updated, result.Reactivated, result.Archived, result.Unchanged)
+		writeTextList(&b, "Errors", result.Errors)
+		writeTextList(&b, "Warnings", result.Warnings)
+		writeTextList(&b, "Integrity issues", result.IntegrityIssues)
+		writeTextList(&b, "Anomalies", result.Anomalies)
+	}
+	for _, sink := range response.Sinks {
+		fmt.Fprintf(&b, "Sink %s: %d delivered, %d failed", sink.Sink, sink.Delivered, sink.Failed)
+		if sink.Error != "" {
+			fmt.Fprintf(&b, " (%s)", sink.Error)
+		}
+		fmt.Fprintln(&b)
+	}
+	if shard := response.Shard; shard != nil {
+		fmt.Fprintf(&b, "Shard: %d/%d of cycle %d, %d done\n", shard.Shard+1, shard.Shards, shard.CycleID, shard.Done)
+	}
+	fmt.Fprintf(&b, "Started: %s, took %s\n", response.StartedAt, response.Duration)
+	if t := response.Timings; t != nil {
+		fmt.Fprintf(&b, "Timings: login %dms, count %dms, fetch %dms, diff %dms, db writes %dms\n",
+			t.LoginMs, t.CountMs, t.FetchMs, t.DiffMs, t.DBWriteMs)
+		if p := t.Pages; p != nil {
+			fmt.Fprintf(&b, "Pages: %d, %dms min, %dms avg, %dms max\n", p.Count, p.MinMs, p.AvgMs, p.MaxMs)
+		}
+	}
+	if response.Handles != nil {
+		for _, group := range changedGroups(*response.Handles) {
+			writeTextList(&b, group.title, group.handles)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeTextList writes a titled list of lines, or nothing when it is empty
+func writeTextList(b *strings.Builder, title string, lines []string) {
+	if len(lines) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "%s (%d):\n", title, len(lines))
+	for _, line := range lines {
+		fmt.Fprintf(b, "  %s\n", line)
+	}
+}
+
+// changedGroup is the handles of one kind of change
+type changedGroup struct {
+	action  string
+	title   string
+	handles []string
+}
+
+// changedGroups returns the handles by kind of change, in a fixed order
+func changedGroups(h models.ChangedHandles) []changedGroup {
+	return []changedGroup{
+		{models.ChangeActionCreate, "Created", h.Created},
+		{models.ChangeActionUpdate, "Updated", h.Updated},
+		{models.ChangeActionReactivate, "Reactivated", h.Reactivated},
+		{models.ChangeActionArchive, "Archived", h.Archived},
+		{models.ChangeActionDelete, "Deleted", h.Deleted},
+	}
+}
@@ -0,0 +1,134 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-cron/models"
+)
+
+// Test_NegotiateFormat tests that the Accept header picks the trigger response format
+func Test_NegotiateFormat(t *testing.T) {
+	tests := []struct {
+		accept   string
+		expected string
+	}{
+		{"", FormatJSON},
+		{"*/*", FormatJSON},
+		{"text/plain", FormatText},
+		{"text/plain, */*", FormatText},
+		{"application/x-ndjson", FormatNDJSON},
+		{"application/json;q=0.5, text/*;q=0.8", FormatText},
+		{"text/plain;q=0, */*", FormatJSON},
+		{"text/html", ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/api", nil)
+		if tt.accept != "" {
+			r.Header.Set("Accept", tt.accept)
+		}
+		if got := NegotiateFormat(r, FormatJSON, FormatText, FormatNDJSON); got != tt.expected {
+			t.Errorf("NegotiateFormat(%q) = %q, want %q", tt.accept, got, tt.expected)
+		}
+	}
+}
+
+// Test_WriteTriggerResponse tests the handles in each format, with and without verbose
+func Test_WriteTriggerResponse(t *testing.T) {
+	response := models.TriggerResponse{
+		Message:      "Successfully synchronized data from external API",
+		TotalItems:   3,
+		ItemsFetched: 3,
+		SyncResult:   &models.SyncResult{Status: models.SyncStatusOK, Created: 1, Archived: 1, Unchanged: 1},
+		StartedAt:    "2026-03-01T08:30:00Z",
+		Duration:     "1.5s",
+		Handles:      &models.ChangedHandles{Created: []string{"oak-chair"}, Archived: []string{"pine-desk"}},
+	}
+
+	tests := []struct {
+		name     string
+		format   string
+		verbose  bool
+		contains []string
+		excludes []string
+	}{
+		{"json", FormatJSON, false, []string{`"created":1`}, []string{"oak-chair"}},
+		{"json verbose", FormatJSON, true, []string{`"handles":{"created":["oak-chair"]`}, nil},
+		{"text", FormatText, false, []string{"Status: ok\n", "Created: 1, Updated: 0, Reactivated: 0, Archived: 1, Unchanged: 1\n"}, []string{"oak-chair"}},
+		{"text verbose", FormatText, true, []string{"Created (1):\n  oak-chair\n", "Archived (1):\n  pine-desk\n"}, nil},
+		{"ndjson", FormatNDJSON, false, []string{
+			`{"type":"item","action":"create","handle":"oak-chair"}` + "\n" +
+				`{"type":"item","action":"archive","handle":"pine-desk"}` + "\n" +
+				`{"type":"summary","message":`,
+		}, []string{`"handles"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			WriteTriggerResponse(w, http.StatusOK, response, tt.format, tt.verbose)
+			if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, tt.format) {
+				t.Errorf("Content-Type = %q, want %q", got, tt.format)
+			}
+			body := w.Body.String()
+			for _, s := range tt.contains {
+				if !strings.Contains(body, s) {
+					t.Errorf("Expected %q in %q", s, body)
+				}
+			}
+			for _, s := range tt.excludes {
+				if strings.Contains(body, s) {
+					t.Errorf("Expected no %q in %q", s, body)
+				}
+			}
+		})
+	}
+}
+
+// Test_TriggerOutcome tests the status and error categories of successful and
+// partial syncs
+func Test_TriggerOutcome(t *testing.T) {
+	guard := &models.ChangeGuard{Creates: 50, Catalog: 10, MaxRatio: 0.5}
+	tests := []struct {
+		name     string
+		response models.TriggerResponse
+		dryRun   bool
+		status   int
+		codes    []string
+	}{
+		{"success", models.TriggerResponse{SyncResult: &models.SyncResult{Status: models.SyncStatusOK}}, false, http.StatusOK, nil},
+		{"item errors", models.TriggerResponse{
+			SyncResult: &models.SyncResult{Status: models.SyncStatusOK, Errors: []string{"failed to save raw titles: boom"}},
+			Sinks:      []models.SinkDispatchResult{{Sink: "shopify", Delivered: 2, Failed: 1}},
+		}, false, http.StatusMultiStatus, []string{models.ErrorCodeItemErrors, models.ErrorCodeSinks}},
+		{"integrity", models.TriggerResponse{
+			SyncResult: &models.SyncResult{Status: models.SyncStatusDegraded, IntegrityIssues: []string{"1 titles are duplicated"}},
+		}, false, http.StatusMultiStatus, []string{models.ErrorCodeIntegrity}},
+		{"timed out", models.TriggerResponse{
+			SyncResult: &models.SyncResult{Status: models.SyncStatusTimedOut, Errors: []string{"sync timed out: context deadline exceeded"}},
+		}, false, http.StatusGatewayTimeout, []string{models.ErrorCodeTimedOut, models.ErrorCodeItemErrors}},
+		{"guard", models.TriggerResponse{
+			SyncResult: &models.SyncResult{Status: models.SyncStatusOK, Guard: guard, Errors: []string{guard.String()}},
+		}, false, http.StatusConflict, []string{models.ErrorCodeChangeGuard}},
+		{"guard dry run", models.TriggerResponse{
+			SyncResult: &models.SyncResult{Status: models.SyncStatusOK, Guard: guard, Errors: []string{guard.String()}},
+		}, true, http.StatusOK, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := TriggerOutcome(&tt.response, tt.dryRun)
+			var codes []string
+			for _, e := range tt.response.Errors {
+				codes = append(codes, e.Code)
+			}
+			outcome := models.OutcomeSuccess
+			if len(tt.codes) > 0 {
+				outcome = models.OutcomePartial
+			}
+			if status != tt.status || tt.response.Status != outcome || strings.Join(codes, ",") != strings.Join(tt.codes, ",") {
+				t.Errorf("Expected %d %s %v, got %d %s %v", tt.status, outcome, tt.codes, status, tt.response.Status, codes)
+			}
+		})
+	}
+}
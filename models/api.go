@@ -0,0 +1,301 @@
+package models
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// TriggerResponse is returned by the sync trigger endpoint
+type TriggerResponse struct {
+	Message      string               `json:"message"`
+	Status       string               `json:"status"`
+	TotalItems   int                  `json:"totalItems"`
+	ItemsFetched int                  `json:"itemsFetched"`
+	SyncResult   *SyncResult          `json:"syncResult"`
+	Sinks        []SinkDispatchResult `json:"sinks"`
+	Shard        *ShardProgress       `json:"shard,omitempty"`
+	StartedAt    string               `json:"startedAt"`
+	Duration     string               `json:"duration"`
+	// Timings breaks the duration down by step of the sync
+	Timings *Timings `json:"timings,omitempty"`
+	// Handles lists the changed products, included with ?verbose=true
+	Handles *ChangedHandles `json:"handles,omitempty"`
+	// Errors classifies the problems of a partial sync for alerting; the
+	// sync result and the sinks hold the details
+	Errors []ErrorDetail `json:"errors,omitempty"`
+}
+
+// Outcomes of a sync trigger, the Status of its response. A partial sync
+// applied its changes, or planned them in a dry run, but ran into problems
+// along the way.
+const (
+	OutcomeSuccess = "success"
+	OutcomePartial = "partial"
+	OutcomeFailed  = "failed"
+)
+
+// ErrorDetail is a problem of a partial sync, classified by one of the
+// ErrorCode constants
+type ErrorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Timings breaks down the duration of a sync trigger in milliseconds: logging
+// in to the external API, counting and fetching its items, comparing them
+// with the products and writing the changes. Steps a run skipped stay zero.
+type Timings struct {
+	LoginMs int64 `json:"login_ms"`
+	CountMs int64 `json:"count_ms"`
+	FetchMs int64 `json:"fetch_ms"`
+	// Pages summarizes the page requests of the fetch, nil for sources
+	// without pages
+	Pages     *PageTimings `json:"pages,omitempty"`
+	DiffMs    int64        `json:"diff_ms"`
+	DBWriteMs int64        `json:"db_write_ms"`
+	TotalMs   int64        `json:"total_ms"`
+}
+
+// PageTimings summarizes the durations of the page requests of a fetch,
+// retries included; a $batch request counts as one
+type PageTimings struct {
+	Count int   `json:"count"`
+	MinMs int64 `json:"min_ms"`
+	AvgMs int64 `json:"avg_ms"`
+	MaxMs int64 `json:"max_ms"`
+}
+
+// SyncRequest is the optional JSON body of the sync trigger, overriding the
+// configuration for a single run. Unset fields keep the configured behavior.
+type SyncRequest struct {
+	// DryRun computes the changes without writing, recording or delivering them
+	DryRun bool `json:"dryRun,omitempty"`
+	// GroupCodes replaces ITEMS_GROUP_CODES
+	GroupCodes []int `json:"groupCodes,omitempty"`
+	// MaxItems caps the number of fetched items the run syncs
+	MaxItems int `json:"maxItems,omitempty"`
+	// Sample syncs this fraction of the fetched items, between 0 and 1, the
+	// same items for every run
+	Sample float64 `json:"sample,omitempty"`
+	// Workers replaces NUM_WORKERS, up to MaxRequestWorkers
+	Workers int `json:"workers,omitempty"`
+	// PageSize replaces PAGE_SIZE, up to MaxRequestPageSize
+	PageSize int `json:"pageSize,omitempty"`
+	// Incremental replaces SYNC_INCREMENTAL
+	Incremental *bool `json:"incremental,omitempty"`
+	// Confirm applies the changes even when they trip the change guard
+	Confirm bool `json:"confirm,omitempty"`
+	// Destinations are the names of the sinks the run delivers to; an empty
+	// list delivers to none
+	Destinations []string `json:"destinations"`
+}
+
+// Caps of the fetch overrides of a SyncRequest, so a single request cannot
+// open enough connections or ask for pages large enough to overload the
+// Service Layer
+const (
+	MaxRequestWorkers  = 16
+	MaxRequestPageSize = 1000
+)
+
+// Partial reports whether the run covers part of the catalog on purpose, in
+// which case the feed check and the sync watermark are left alone
+func (o SyncRequest) Partial() bool {
+	return len(o.GroupCodes) > 0 || o.MaxItems > 0 || (o.Sample > 0 && o.Sample < 1)
+}
+
+// Apply returns a copy of cfg with the overrides of the request, or an error
+// naming the first invalid option
+func (o SyncRequest) Apply(cfg *AppConfig) (*AppConfig, error) {
+	if o.MaxItems < 0 {
+		return nil, fmt.Errorf("maxItems must not be negative, got %d", o.MaxItems)
+	}
+	if o.Sample < 0 || o.Sample > 1 {
+		return nil, fmt.Errorf("sample must be between 0 and 1, got %g", o.Sample)
+	}
+	if o.Workers < 0 || o.Workers > MaxRequestWorkers {
+		return nil, fmt.Errorf("workers must be between 0 and %d, got %d", MaxRequestWorkers, o.Workers)
+	}
+	if o.PageSize < 0 || o.PageSize > MaxRequestPageSize {
+		return nil, fmt.Errorf("pageSize must be between 0 and %d, got %d", MaxRequestPageSize, o.PageSize)
+	}
+
+	applied := *cfg
+	if len(o.GroupCodes) > 0 {
+		if cfg.ExternalAPI.Filter != "" {
+			return nil, fmt.Errorf("groupCodes cannot be combined with ITEMS_FILTER")
+		}
+		applied.ExternalAPI.GroupCodes = o.GroupCodes
+	}
+	if o.Workers > 0 {
+		applied.ExternalAPI.NumWorkers = o.Workers
+	}
+	if o.PageSize > 0 {
+		applied.ExternalAPI.PageSize = o.PageSize
+	}
+	if o.Incremental != nil {
+		applied.Sync.Incremental = *o.Incremental
+	}
+	if err := applied.Validate(); err != nil {
+		return nil, err
+	}
+	return &applied, nil
+}
+
+// StatusResponse is returned by the status endpoint
+type StatusResponse struct {
+	// LastRun is the run in progress, or else the last finished run
+	LastRun *SyncRun `json:"lastRun"`
+	// LastFinishedRun is the last run that finished, with its outcome and counters
+	LastFinishedRun *SyncRun `json:"lastFinishedRun"`
+	// InProgress reports a sync running on any instance
+	InProgress bool `json:"inProgress"`
+	// Pool reports the database connection pool of the serving instance
+	Pool *PoolStats `json:"pool,omitempty"`
+}
+
+// Outcomes of a readiness check
+const (
+	CheckOK     = "ok"
+	CheckFailed = "failed"
+)
+
+// ReadinessCheck is the outcome of one dependency checked by the readiness endpoint
+type ReadinessCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ReadinessResponse is returned by the readiness endpoint
+type ReadinessResponse struct {
+	Ready  bool             `json:"ready"`
+	Checks []ReadinessCheck `json:"checks"`
+}
+
+// WarmupResponse is returned by the warmup endpoint
+type WarmupResponse struct {
+	// Connections is the number of database connections opened and left idle in the pool
+	Connections int `json:"connections"`
+	// SAPSession reports a Service Layer session logged in for the next sync
+	SAPSession bool     `json:"sapSession"`
+	Errors     []string `json:"errors,omitempty"`
+	Duration   string   `json:"duration"`
+}
+
+// PoolStats are the statistics of a database connection pool
+type PoolStats struct {
+	OpenConnections int    `json:"openConnections"`
+	InUse           int    `json:"inUse"`
+	Idle            int    `json:"idle"`
+	WaitCount       int64  `json:"waitCount"`
+	WaitDuration    string `json:"waitDuration"`
+}
+
+// RunsResponse is returned by the runs endpoint
+type RunsResponse struct {
+	Runs []SyncRun `json:"runs"`
+}
+
+// ChangesResponse is returned by the changes endpoint
+type ChangesResponse struct {
+	Changes []ProductChange `json:"changes"`
+}
+
+// ProductsResponse is returned by the products endpoint
+type ProductsResponse struct {
+	Products []Product `json:"products"`
+	// Total is the number of products matching the filter across all pages
+	Total  int `json:"total"`
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+// SearchResponse is returned by the search endpoint
+type SearchResponse struct {
+	Query    string    `json:"query"`
+	Products []Product `json:"products"`
+}
+
+// FreshnessResponse is returned by the freshness endpoint
+type FreshnessResponse struct {
+	LastSuccessAt *time.Time `json:"lastSuccessAt"`
+	AgeSeconds    float64    `json:"ageSeconds"`
+	MaxAgeSeconds float64    `json:"maxAgeSeconds"`
+	Stale         bool       `json:"stale"`
+}
+
+// RecordingsResponse is returned by the recordings endpoint
+type RecordingsResponse struct {
+	Mode      string             `json:"mode"`
+	Exchanges []RecordedExchange `json:"exchanges"`
+}
+
+// RecordedExchange is a recorded request to the external API and its
+// response, with credentials redacted
+type RecordedExchange struct {
+	Time            time.Time   `json:"time"`
+	Method          string      `json:"method"`
+	URL             string      `json:"url"`
+	RequestHeaders  http.Header `json:"requestHeaders,omitempty"`
+	RequestBody     string      `json:"requestBody,omitempty"`
+	Status          int         `json:"status,omitempty"`
+	ResponseHeaders http.Header `json:"responseHeaders,omitempty"`
+	ResponseBody    string      `json:"responseBody,omitempty"`
+	// Truncated reports a body cut at the configured maximum
+	Truncated  bool   `json:"truncated,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+	Error      string `json:"error,omitempty"`
+}
+
+// ImportResponse is returned by /api/import
+type ImportResponse struct {
+	// RunID is the run recording the import; dry runs are not recorded
+	RunID  int         `json:"runId,omitempty"`
+	Items  int         `json:"items"`
+	DryRun bool        `json:"dryRun,omitempty"`
+	Result *SyncResult `json:"result"`
+}
+
+// ErrorResponse is returned by the read endpoints on failure
+type ErrorResponse struct {
+	Error string `json:"error"`
+	// Code classifies errors callers may handle specially, such as ErrorCodePanic
+	Code string `json:"code,omitempty"`
+	// Status is OutcomeFailed on the failures of the sync trigger
+	Status string `json:"status,omitempty"`
+}
+
+// Error codes of ErrorResponse
+const (
+	// ErrorCodePanic marks the response of a handler that panicked
+	ErrorCodePanic = "panic"
+	// ErrorCodeCircuitOpen marks a sync skipped or stopped because the
+	// external API kept failing; retry after the Retry-After header
+	ErrorCodeCircuitOpen = "circuit_open"
+	// ErrorCodeUpstreamUnavailable marks a sync that could not reach the external API
+	ErrorCodeUpstreamUnavailable = "upstream_unavailable"
+	// ErrorCodeUpstreamError marks a sync whose requests the external API rejected
+	ErrorCodeUpstreamError = "upstream_error"
+	// ErrorCodePreflight marks a sync stopped by the check of the selected fields
+	ErrorCodePreflight = "preflight_failed"
+	// ErrorCodeFeedCheck marks a sync aborted because the feed looked like an outage
+	ErrorCodeFeedCheck = "feed_check_failed"
+	// ErrorCodeDatabase marks a sync that could not use the database
+	ErrorCodeDatabase = "database_unavailable"
+	// ErrorCodeSync marks a sync that failed writing its changes
+	ErrorCodeSync = "sync_failed"
+	// ErrorCodeTimedOut marks a sync cut short by its deadline
+	ErrorCodeTimedOut = "timed_out"
+	// ErrorCodeShuttingDown marks a trigger refused while the service drains
+	ErrorCodeShuttingDown = "shutting_down"
+	// ErrorCodeItemErrors marks a sync that failed to apply some of its changes
+	ErrorCodeItemErrors = "item_errors"
+	// ErrorCodeIntegrity marks a sync that left the products failing an integrity check
+	ErrorCodeIntegrity = "integrity"
+	// ErrorCodeChangeGuard marks changes held back by the change guard
+	ErrorCodeChangeGuard = "change_guard"
+	// ErrorCodeSinks marks changes some sinks failed to deliver
+	ErrorCodeSinks = "sink_failed"
+)
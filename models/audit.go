@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// ProductChange is one audited create, update or delete of a product during a sync run
+type ProductChange struct {
+	ID        int64     `json:"id"`
+	RunID     int       `json:"runId,omitempty"`
+	ProductID int       `json:"productId,omitempty"`
+	Action    string    `json:"action"`
+	OldTitle  string    `json:"oldTitle,omitempty"`
+	OldHandle string    `json:"oldHandle,omitempty"`
+	NewTitle  string    `json:"newTitle,omitempty"`
+	NewHandle string    `json:"newHandle,omitempty"`
+	ChangedAt time.Time `json:"changedAt"`
+}
+
+// In returns a copy of the change with its timestamp rendered in loc
+func (c ProductChange) In(loc *time.Location) ProductChange {
+	c.ChangedAt = c.ChangedAt.In(loc)
+	return c
+}
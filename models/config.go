@@ -1,6 +1,12 @@
 package models
 
-import "time"
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+)
 
 type AppConfig struct {
 	ServerPort   uint16
@@ -8,6 +14,24 @@ type AppConfig struct {
 	Auth         AuthConfig
 	ExternalAuth ExternalAuthConfig
 	ExternalAPI  ExternalApiConfig
+	Source       SourceConfig
+	Sinks        SinksConfig
+	Anomaly      AnomalyConfig
+	Display      DisplayConfig
+	Notify       NotifyConfig
+	Sync         SyncConfig
+	Sanitize     SanitizeConfig
+	Tracing      TracingConfig
+	Images       ImagesConfig
+
+	// Profile is the named profile of the config file applied, if any
+	Profile string
+
+	// LoadErrors lists the settings that could not be parsed while loading; see Validate
+	LoadErrors []FieldError
+	// Settings holds the effective value of every setting by environment
+	// variable name, in the format of the variable, for exporting profiles
+	Settings map[string]string
 }
 
 type DatabaseConfig struct {
@@ -16,21 +40,561 @@ type DatabaseConfig struct {
 	MaxIdleConns    int
 	ConnMaxLifetime time.Duration
 	DataSourceURL   string
+	// Driver selects the connection used for bulk product writes: DatabaseDriverPQ or DatabaseDriverPgx
+	Driver string
+	// Dialect is the database the products are stored in: DatabaseDialectPostgres,
+	// DatabaseDialectMySQL or DatabaseDialectSQLite. Only the products are
+	// portable; runs, jobs, the outbox and the other bookkeeping tables need Postgres.
+	Dialect string
+	// AutoCreateSchema applies the schema migrations the database is missing
+	// when the connection pool is opened, creating the tables on first-time
+	// setups; gocron migrate applies them on demand
+	AutoCreateSchema bool
+	// Schema and ProductsTable name the table of the products, such as
+	// staging.products; empty values use the products table of the search path.
+	// Only the products move; the other tables stay on the search path.
+	Schema        string
+	ProductsTable string
+}
+
+// Database dialects
+const (
+	DatabaseDialectPostgres = "postgres"
+	// DatabaseDialectMySQL needs a binary built with -tags mysql, with parseTime=true in DATABASE_URL
+	DatabaseDialectMySQL = "mysql"
+	// DatabaseDialectSQLite needs a binary built with -tags sqlite (and cgo); DATABASE_URL is the file path
+	DatabaseDialectSQLite = "sqlite"
+)
+
+// SQLDriver returns the database/sql driver name of the dialect
+func (c DatabaseConfig) SQLDriver() string {
+	switch c.Dialect {
+	case "":
+		return DatabaseDialectPostgres
+	case DatabaseDialectSQLite:
+		// github.com/mattn/go-sqlite3 registers under its own name
+		return "sqlite3"
+	}
+	return c.Dialect
 }
 
+// Database drivers for bulk product writes
+const (
+	// DatabaseDriverPQ writes through database/sql with a prepared statement per row
+	DatabaseDriverPQ = "pq"
+	// DatabaseDriverPgx writes through a pgx pool with CopyFrom and batched statements
+	DatabaseDriverPgx = "pgx"
+)
+
 type AuthConfig struct {
 	CRONSecret string
+	// PreviousSecrets are accepted alongside CRONSecret while callers move to a rotated secret
+	PreviousSecrets []string
+	// Scheme selects how callers of the cron endpoints prove they know a secret:
+	// AuthSchemeBearer or AuthSchemeHMAC
+	Scheme string
+	// SignatureTolerance is how far the timestamp of a signed request may be from the server's clock
+	SignatureTolerance time.Duration
+	// AllowedIPs restricts the cron endpoints to these addresses and CIDR ranges; empty allows any
+	AllowedIPs []string
+	// TrustedProxies is the number of proxies in front of go-cron appending
+	// the caller to X-Forwarded-For (1 on Vercel); 0 ignores the header
+	TrustedProxies int
+	// AdminSecret guards the admin endpoints; they accept CRONSecret when it is unset
+	AdminSecret string
+}
+
+// Authentication schemes of the cron endpoints
+const (
+	// AuthSchemeBearer expects the secret in an "Authorization: Bearer" header
+	AuthSchemeBearer = "bearer"
+	// AuthSchemeHMAC expects a webhooksig signature of the request made with the secret
+	AuthSchemeHMAC = "hmac"
+)
+
+// Secrets returns the secrets the cron endpoints accept, the current one first
+func (c AuthConfig) Secrets() []string {
+	return append([]string{c.CRONSecret}, c.PreviousSecrets...)
+}
+
+// EffectiveAdminSecret returns the secret the admin endpoints accept
+func (c AuthConfig) EffectiveAdminSecret() string {
+	if c.AdminSecret != "" {
+		return c.AdminSecret
+	}
+	return c.CRONSecret
 }
 
 type ExternalAuthConfig struct {
 	CompanyDB string `json:"CompanyDB"`
 	UserName  string `json:"UserName"`
 	Password  string `json:"Password"`
+	// Secondary is the account logged in with when the Service Layer rejects
+	// the primary one, e.g. while its password is being rotated; its
+	// CompanyDB defaults to the primary one and an empty UserName disables it
+	Secondary Credentials `json:"Secondary"`
+	// CredentialsFile is a JSON file of the accounts, read on every login
+	// instead of the ones above, such as a secret mounted into the function
+	CredentialsFile string `json:"CredentialsFile"`
+	// CredentialsURL is an endpoint of a secret manager returning the
+	// accounts as JSON, fetched on every login, sending CredentialsToken as
+	// a bearer token
+	CredentialsURL   string `json:"CredentialsURL"`
+	CredentialsToken string `json:"-"`
 }
 
 type ExternalApiConfig struct {
 	ExternalAPIURL string
 	LoginURL       string
 	ItemsURL       string
-	Filter         string
+	PageSize       int
+	// NumWorkers is the number of pages fetched at once. The pool halves it
+	// while the external API throttles or slows down and grows it back once
+	// pages are healthy again.
+	NumWorkers int
+	// SlowPageThreshold is the page latency that counts as the external API
+	// slowing down; zero only reacts to throttling
+	SlowPageThreshold time.Duration
+	// Pagination selects how pages are fetched: PaginationSkip,
+	// PaginationNextLink or PaginationBatch
+	Pagination string
+	// MaxPageSize is sent as the Prefer: odata.maxpagesize header of item
+	// requests, and lets the server size the pages of PaginationNextLink
+	// fetches; 0 sends no preference
+	MaxPageSize int
+	// BatchPages is the number of $skip pages bundled into each $batch
+	// request of PaginationBatch
+	BatchPages int
+	// Filter is the OData $filter expression; empty builds one from GroupCodes
+	Filter string
+	// GroupCodes are the item groups synced when no Filter is set
+	GroupCodes []int
+	// PriceList is the number of the price list whose prices are fetched with
+	// the items and stored on the products; zero syncs no prices
+	PriceList int
+	// Timeout bounds every request to the external API, i.e. each page of items
+	Timeout time.Duration
+	// LoginTimeout bounds opening a session
+	LoginTimeout time.Duration
+	// FetchTimeout bounds the whole fetch (login, count and every page) so the database sync keeps its share of the budget
+	FetchTimeout time.Duration
+	// Preflight checks the selected and mapped fields on a single item before
+	// every sync, in the session the fetch then uses
+	Preflight bool
+	// Headers are name=value pairs sent with every request to the external
+	// API, such as the API key of a reverse proxy in front of the Service Layer
+	Headers []string
+	// BackoffBase is how long syncs are skipped after the external API was
+	// unreachable, doubling with every further failure up to BackoffMax; zero disables it
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+	// Breaker is how many consecutive requests of a run may fail to reach the
+	// external API before the rest of the run fails fast; zero disables it
+	Breaker   int
+	TLS       TLSConfig
+	Transport TransportConfig
+	Recording RecordingConfig
+}
+
+// TLSConfig controls how the external API's certificate is verified
+type TLSConfig struct {
+	// InsecureSkipVerify accepts any certificate, for Service Layer installs with self-signed ones
+	InsecureSkipVerify bool
+	// CAFile is a PEM bundle of extra CAs to trust
+	CAFile string
+}
+
+// TransportConfig controls the connections to the external API
+type TransportConfig struct {
+	// HTTP2 negotiates HTTP/2 when the server offers it; off pins HTTP/1.1 for proxies that mishandle h2
+	HTTP2 bool
+	// MaxConnsPerHost caps the connections to the external API, across all requests of an invocation; 0 is unlimited
+	MaxConnsPerHost int
+	// IdleConnTimeout closes keep-alive connections idle for longer; 0 keeps them open
+	IdleConnTimeout time.Duration
+	// MaxIdleConnsPerHost is the number of keep-alive connections kept per
+	// host; 0 keeps MaxConnsPerHost of them, and at least Go's default of 2
+	MaxIdleConnsPerHost int
+	// DialTimeout bounds opening a TCP connection; 0 leaves it to the system
+	DialTimeout time.Duration
+	// TLSHandshakeTimeout bounds the TLS handshake of a connection; 0 waits forever
+	TLSHandshakeTimeout time.Duration
+	// ResponseHeaderTimeout bounds the wait for the headers of a response once
+	// the request is sent; 0 leaves it to the request Timeout
+	ResponseHeaderTimeout time.Duration
+	// ProxyURL is the HTTP(S) proxy of the requests to the external API;
+	// empty uses the proxy of the HTTPS_PROXY, HTTP_PROXY and NO_PROXY variables
+	ProxyURL string
 }
+
+// RecordingConfig controls the recording of raw external API requests and
+// responses for debugging, e.g. of OData filters. Credentials are redacted.
+type RecordingConfig struct {
+	// Mode is RecordingOff, RecordingMemory or RecordingDir
+	Mode string
+	// Dir receives one JSON file per exchange in RecordingDir mode; empty uses
+	// a go-cron-recordings directory under the system temp directory
+	Dir string
+	// Size is the number of exchanges kept, in memory or in the directory,
+	// the oldest ones being discarded
+	Size int
+	// MaxBody truncates recorded bodies to this many bytes
+	MaxBody int
+}
+
+// External API recording modes
+const (
+	// RecordingOff records nothing
+	RecordingOff = "off"
+	// RecordingMemory keeps the latest exchanges in a ring buffer of the instance
+	RecordingMemory = "memory"
+	// RecordingDir writes every exchange to a file, keeping the latest files
+	RecordingDir = "dir"
+)
+
+// External API pagination modes
+const (
+	// PaginationSkip fetches $top/$skip pages concurrently with a worker pool
+	PaginationSkip = "skip"
+	// PaginationNextLink follows odata.nextLink sequentially
+	PaginationNextLink = "nextlink"
+	// PaginationBatch requests several $top/$skip pages per OData $batch
+	// request, saving round trips on high-latency links
+	PaginationBatch = "batch"
+)
+
+// SourceConfig selects where the synced items come from
+type SourceConfig struct {
+	// Kind is SourceSAP or SourceCSV
+	Kind string
+	// CSVFile is the path of the item export read by the CSV source
+	CSVFile string
+}
+
+// Item sources
+const (
+	// SourceSAP fetches the items from the SAP Service Layer
+	SourceSAP = "sap"
+	// SourceCSV reads the items from a CSV file with ItemCode, ItemName and ItemsGroupCode columns
+	SourceCSV = "csv"
+)
+
+type SinksConfig struct {
+	IDMapCacheSize int
+	WebhookURL     string
+	// WebhookSecret signs webhook deliveries when set
+	WebhookSecret string
+	// ShopifyShop enables pushing changes to the Shopify shop with this domain (e.g. my-store.myshopify.com)
+	ShopifyShop        string
+	ShopifyAccessToken string
+	ShopifyAPIVersion  string
+	// ShopifyRateLimit is the maximum number of Shopify requests per second
+	ShopifyRateLimit float64
+	// Destinations are the names of the sinks runs of the sync trigger deliver
+	// to, unless their request names them; empty delivers to every configured sink
+	Destinations []string
+}
+
+// AnomalyConfig controls when a run's deltas are flagged as unusual compared
+// to the previous successful run
+type AnomalyConfig struct {
+	Factor   float64
+	MinDelta int
+}
+
+// DisplayConfig controls how stored (UTC) timestamps are rendered for humans
+type DisplayConfig struct {
+	Timezone string
+	Location *time.Location
+	// Locale is the BCP 47 tag whose collation orders exports and reports
+	Locale string
+}
+
+type NotifyConfig struct {
+	SlackWebhookURL string
+	WebhookURL      string
+	WebhookSecret   string
+	Templates       map[string]string
+	TemplatesFromDB bool
+	Routes          []NotifyRoute
+	// DiffLinkBaseURL is the public URL of this deployment; when set, digests link to a CSV of each run's changes
+	DiffLinkBaseURL string
+	// DiffLinkTTL is how long those links stay valid
+	DiffLinkTTL time.Duration
+	// Email mails a summary of failed runs; an empty SMTPHost disables it
+	Email EmailConfig
+}
+
+// EmailConfig is the SMTP server and recipients of failure emails
+type EmailConfig struct {
+	SMTPHost string
+	SMTPPort int
+	// Username and Password authenticate with the server when Username is set
+	Username string
+	Password string
+	From     string
+	To       []string
+	// ErrorThreshold also mails runs that did not fail but reported more
+	// errors than this
+	ErrorThreshold int
+}
+
+// SanitizeConfig controls the cleanup of free-text fields received from the external API
+type SanitizeConfig struct {
+	// Enabled strips markup from item names. It is off by default, as the
+	// cleaned name is also the key products are matched by: turning it on
+	// for an existing catalog creates products whose titles change.
+	Enabled bool
+	// MaxLength is the maximum number of characters kept; 0 keeps everything
+	MaxLength int
+	// KeepRaw stores the original text alongside the sanitized one
+	KeepRaw bool
+	// TitleSteps is the chain of TitleStep transformations applied, in order,
+	// to item names after sanitization, so the stored and compared titles are clean
+	TitleSteps []string
+	// TitleReplacements are applied, in order, by the TitleStepReplace step
+	TitleReplacements []TitleReplacement
+	// TitleSuffixes are removed from the end of titles by the TitleStepTrimSuffixes step, ignoring case
+	TitleSuffixes []string
+}
+
+// TitleReplacement replaces the matches of a regular expression in titles
+type TitleReplacement struct {
+	Pattern string `json:"pattern"`
+	// Replacement may refer to the groups of Pattern as $1 or ${name}
+	Replacement string `json:"replacement"`
+}
+
+// Title transformation steps
+const (
+	// TitleStepReplace applies the TitleReplacements
+	TitleStepReplace = "replace"
+	// TitleStepStripBrackets removes notes in parentheses or square brackets, such as "(DO NOT USE)"
+	TitleStepStripBrackets = "strip_brackets"
+	// TitleStepTrimSuffixes removes one of the TitleSuffixes from the end of titles
+	TitleStepTrimSuffixes = "trim_suffixes"
+	// TitleStepTitleCase capitalizes the first letter of every word and
+	// lowercases the rest; words with digits, such as "1KG", are kept
+	TitleStepTitleCase = "title_case"
+	// TitleStepUpper uppercases titles
+	TitleStepUpper = "upper"
+)
+
+// TitleSteps are the known title transformation steps
+var TitleSteps = []string{TitleStepReplace, TitleStepStripBrackets, TitleStepTrimSuffixes, TitleStepTitleCase, TitleStepUpper}
+
+// ImagesConfig controls the sync of item pictures. The Picture file name of
+// an item is resolved against BaseURL, and the resulting URL is stored on the
+// product and compared like the other synced fields.
+type ImagesConfig struct {
+	Enabled bool
+	// BaseURL is where the pictures of the Service Layer's bitmap folder are served
+	BaseURL string
+	// Download fetches new and changed pictures and stores them in the media repository
+	Download bool
+	// Workers is the number of pictures downloaded at once
+	Workers int
+	// MaxBytes rejects larger pictures
+	MaxBytes int64
+}
+
+// URL returns the URL of the picture file name, or "" for an item without a picture
+func (c ImagesConfig) URL(picture string) string {
+	if picture == "" {
+		return ""
+	}
+	return strings.TrimSuffix(c.BaseURL, "/") + "/" + url.PathEscape(picture)
+}
+
+// TracingConfig controls the export of the spans of a sync to an OpenTelemetry collector
+type TracingConfig struct {
+	// Endpoint is the OTLP/HTTP base URL, or its /v1/traces URL; empty disables tracing
+	Endpoint string
+	// Headers are name=value pairs sent with every export, such as an API key
+	Headers []string
+	// ServiceName identifies the spans of this service
+	ServiceName string
+	// Timeout bounds each export request
+	Timeout time.Duration
+}
+
+type SyncConfig struct {
+	// Writes lets syncs create and update products; without it every sync
+	// runs as a dry run
+	Writes bool
+	// LookupBatchSize is the number of titles looked up per query; 0 loads the whole catalog
+	LookupBatchSize int
+	// ProductCacheTTL keeps the catalog loaded by a run in memory for the next
+	// runs of a warm instance, checked against a change marker of the table; 0 disables the cache
+	ProductCacheTTL time.Duration
+	// FreshnessMaxAge is how old the last successful run may be before data is considered stale
+	FreshnessMaxAge time.Duration
+	// UpdateChunkSize is the number of updates applied per transaction; 0 uses a single transaction
+	UpdateChunkSize int
+	// UpdateWorkers is the number of update transactions run in parallel
+	UpdateWorkers int
+	// CreateChunkSize is the number of inserts committed per transaction; 0 uses a single transaction
+	CreateChunkSize int
+	// IsolateFailedRows retries the rows of a failed insert chunk one by one so only the offending ones are lost
+	IsolateFailedRows bool
+	// Timeout bounds a whole sync triggered over HTTP
+	Timeout time.Duration
+	// BatchTimeout bounds each database batch (lookup chunk, insert batch,
+	// update chunk) per 500 rows, so unchunked batches get proportionally longer
+	BatchTimeout time.Duration
+	// JobBaseURL is the public URL of this deployment the run requests of
+	// async jobs are sent to; VERCEL_URL by default. Without it a job waits
+	// for its run endpoint to be called.
+	JobBaseURL string
+	// IdempotencyTTL is how long the successful response of a trigger with an Idempotency-Key is replayed
+	IdempotencyTTL time.Duration
+	// StatusCacheTTL is how long the status endpoint serves the last finished
+	// run from memory before reading it from the database again
+	StatusCacheTTL time.Duration
+	// PriorityItems are item codes fetched and written ahead of the rest of the catalog, most important first
+	PriorityItems []string
+	// PriorityFromDB reads the priority items from the priority_items table instead, up to PriorityLimit of them
+	PriorityFromDB bool
+	PriorityLimit  int
+	// Incremental only fetches items whose UpdateDate or CreateDate is on or after the last successful sync
+	Incremental bool
+	// FullSyncEvery forces a full sync once the last one is older than this
+	FullSyncEvery time.Duration
+	// Shards splits HTTP-triggered syncs into this many ItemCode ranges, one per
+	// invocation fetching only its range (see ShardKeys); 1 disables sharding
+	Shards int
+	// PartitionByGroup fetches and syncs every item group of GroupCodes as its
+	// own pipeline, PartitionWorkers of them at a time
+	PartitionByGroup bool
+	PartitionWorkers int
+	// MinFeedRatio rejects feeds smaller than this fraction of the catalog; empty feeds are always rejected
+	MinFeedRatio float64
+	// TitleRules is the chain of normalization rules applied, in order, to the
+	// titles matched between items and products
+	TitleRules []string
+	// VendorPrefixes are stripped from the start of titles by the TitleRuleStripPrefixes rule
+	VendorPrefixes []string
+	// Categories maps item group codes to the category stored on their
+	// products; items of unmapped groups get no category. Empty leaves the
+	// categories alone.
+	Categories map[int]string
+	// FieldMapping reshapes Service Layer items before they are synced. It maps
+	// a target (MappingTitle, MappingGroup or MappingPicture) to the item field
+	// it is read from, or to a text/template over the item's fields such as
+	// "{{.ItemName}} ({{.ItemCode}})". Unmapped targets keep their default field.
+	FieldMapping map[string]string
+	// CategoriesFromDB reads the mapping from the item_group_categories table instead
+	CategoriesFromDB bool
+	// Duplicates is what a sync does with database products sharing a title
+	// key or a handle: DuplicatesReport, DuplicatesFlag or DuplicatesMerge
+	Duplicates string
+	// CaseSensitive matches titles differing in case with different products,
+	// ignoring the lowercasing rules of TitleRules
+	CaseSensitive bool
+	// UpdateHandles regenerates the handle of matched products from their title
+	UpdateHandles bool
+	// DeleteMissing archives the active products missing from complete full feeds
+	DeleteMissing bool
+	// DeleteAfterRuns deletes, instead of archiving, the products missing
+	// from this many consecutive complete full feeds, so an item left out by
+	// a passing glitch upstream is kept; 0 archives them on the first miss
+	DeleteAfterRuns int
+	// MaxErrors aborts a sync before writing once more items were rejected; 0 never aborts
+	MaxErrors int
+	// MaxChangeRatio aborts a sync whose creates and archives exceed this
+	// fraction of the catalog, unless the run is confirmed; 0 disables the guard
+	MaxChangeRatio float64
+	// MaxUpdateRatio trips the same guard when the updates of a sync exceed
+	// this fraction of the catalog; 0 never trips it
+	MaxUpdateRatio float64
+	// RequireApproval stores the changes of syncs tripping the guard as a
+	// pending plan, applied once approved, instead of dropping them
+	RequireApproval bool
+	// PlanTTL is how long a held plan may be approved; older plans expire
+	PlanTTL time.Duration
+	// VerifyWrites reads back the written products after a sync and reports
+	// the ones not stored with the intended values
+	VerifyWrites bool
+	// VerifySample is the number of written products read back; 0 reads back all of them
+	VerifySample int
+	// ItemRules select the items synced; the others are skipped
+	ItemRules ItemRules
+}
+
+// ItemRules include and exclude items by code and name. With include rules,
+// only the items matching one of them are synced; an item matching an exclude
+// rule is never synced. Products of skipped items are left alone.
+type ItemRules struct {
+	IncludeCodes    []string
+	ExcludeCodes    []string
+	IncludePrefixes []string
+	ExcludePrefixes []string
+	// IncludeNamePattern and ExcludeNamePattern are regular expressions matched against item names
+	IncludeNamePattern string
+	ExcludeNamePattern string
+}
+
+// Empty reports whether the rules keep every item
+func (r ItemRules) Empty() bool {
+	return len(r.IncludeCodes) == 0 && len(r.ExcludeCodes) == 0 && len(r.IncludePrefixes) == 0 &&
+		len(r.ExcludePrefixes) == 0 && r.IncludeNamePattern == "" && r.ExcludeNamePattern == ""
+}
+
+// Field mapping targets
+const (
+	// MappingTitle is the title of the product, read from ItemName by default
+	MappingTitle = "title"
+	// MappingGroup is the item group code the category is mapped from, read from ItemsGroupCode by default
+	MappingGroup = "group"
+	// MappingPicture is the picture file name, read from Picture by default
+	MappingPicture = "picture"
+)
+
+// MappingTargets are the targets of a field mapping
+var MappingTargets = []string{MappingTitle, MappingGroup, MappingPicture}
+
+// ParseMapping parses the source of a field mapping: a template when it
+// contains an action, else the name of an item field
+func ParseMapping(target, source string) (field string, tmpl *template.Template, err error) {
+	source = strings.TrimSpace(source)
+	if !strings.Contains(source, "{{") {
+		if source == "" || strings.ContainsAny(source, " \t,/()") {
+			return "", nil, fmt.Errorf("%q is neither a field name nor a template", source)
+		}
+		return source, nil, nil
+	}
+	tmpl, err = template.New(target).Option("missingkey=error").Parse(source)
+	if err != nil {
+		return "", nil, err
+	}
+	return "", tmpl, nil
+}
+
+// Duplicate product policies
+const (
+	// DuplicatesReport lists duplicates in the warnings of the result
+	DuplicatesReport = "report"
+	// DuplicatesFlag also marks the run as degraded
+	DuplicatesFlag = "flag"
+	// DuplicatesMerge also archives every product of a title group but the one the sync keeps
+	DuplicatesMerge = "merge"
+)
+
+// Title normalization rules
+const (
+	// TitleRuleTrim removes leading and trailing whitespace
+	TitleRuleTrim = "trim"
+	// TitleRuleLower lowercases titles
+	TitleRuleLower = "lower"
+	// TitleRuleLowerTurkish lowercases titles with the Turkish dotted and dotless i
+	TitleRuleLowerTurkish = "lower_tr"
+	// TitleRuleCollapseSpace replaces runs of whitespace with a single space
+	TitleRuleCollapseSpace = "collapse_space"
+	// TitleRuleStripPunct removes every character that is neither a letter, a digit nor whitespace
+	TitleRuleStripPunct = "strip_punct"
+	// TitleRuleStripPrefixes removes one of VendorPrefixes from the start of titles, ignoring case
+	TitleRuleStripPrefixes = "strip_prefixes"
+)
+
+// TitleRules are the known title normalization rules
+var TitleRules = []string{TitleRuleTrim, TitleRuleLower, TitleRuleLowerTurkish, TitleRuleCollapseSpace, TitleRuleStripPunct, TitleRuleStripPrefixes}
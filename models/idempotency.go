@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// IdempotencyKeyHeader is the request header carrying the idempotency key of a sync trigger
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotencyReplayedHeader is set on responses replayed from an earlier request with the same key
+const IdempotencyReplayedHeader = "Idempotent-Replayed"
+
+// IdempotencyRecord is the stored response of a request made with an idempotency key
+type IdempotencyRecord struct {
+	Key        string
+	StatusCode int
+	Response   []byte
+	CreatedAt  time.Time
+}
@@ -0,0 +1,46 @@
+package models
+
+// ItemActionUnchanged reports a single-item sync that found the product up to date
+const ItemActionUnchanged = "unchanged"
+
+// FieldChange is the before and after value of a product field
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// ItemSyncResult is the outcome of syncing a single external item
+type ItemSyncResult struct {
+	ItemCode string `json:"itemCode"`
+	// Action is ChangeActionCreate, ChangeActionUpdate, ChangeActionReactivate or ItemActionUnchanged
+	Action  string        `json:"action"`
+	Product *Product      `json:"product,omitempty"`
+	Fields  []FieldChange `json:"fields,omitempty"`
+	Result  *SyncResult   `json:"syncResult"`
+}
+
+// Product fields compared when syncing
+const (
+	FieldTitle  = "title"
+	FieldHandle = "handle"
+	FieldStatus = "status"
+	// FieldCategory is compared only when item groups are mapped to categories
+	FieldCategory = "category"
+	// FieldPrice, the price with its currency, is compared only when a price list is synced
+	FieldPrice = "price"
+	// FieldImage, the picture URL, is compared only when images are synced
+	FieldImage = "image"
+)
+
+// ItemDiff is the change planned for one external item, with the old and new
+// value of every field that differs
+type ItemDiff struct {
+	ItemCode  string `json:"itemCode,omitempty"`
+	ProductID int    `json:"productId,omitempty"`
+	// Title is the title of the product the item asks for
+	Title string `json:"title,omitempty"`
+	// Action is ChangeActionCreate, ChangeActionUpdate, ChangeActionReactivate or ItemActionUnchanged
+	Action string        `json:"action"`
+	Fields []FieldChange `json:"fields,omitempty"`
+}
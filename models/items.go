@@ -1,16 +1,82 @@
 package models
 
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ItemsResponse is a page of items from the external API. Items are kept raw
+// so they can be decoded tolerantly, one field at a time.
 type ItemsResponse struct {
-	ODataMetadata string                   `json:"odata.metadata"`
-	ODataNextLink string                   `json:"odata.nextLink"`
-	Value         []map[string]interface{} `json:"value"`
+	ODataMetadata string            `json:"odata.metadata"`
+	ODataNextLink string            `json:"odata.nextLink"`
+	Value         []json.RawMessage `json:"value"`
 }
 
+// Product statuses
+const (
+	ProductStatusActive = "active"
+	// ProductStatusArchived marks a product that disappeared from the external feed
+	ProductStatusArchived = "archived"
+)
+
 // Product represents a product in the database
 type Product struct {
-	ID     int    `json:"id"`
-	Title  string `json:"title"`
-	Handle string `json:"handle"`
+	ID         int        `json:"id"`
+	Title      string     `json:"title"`
+	Handle     string     `json:"handle"`
+	Status     string     `json:"status,omitempty"`
+	ArchivedAt *time.Time `json:"archivedAt,omitempty"`
+	// Category is derived from the item group of the product (see SyncConfig.Categories)
+	Category string `json:"category,omitempty"`
+	// Price and Currency come from the synced price list (see ExternalApiConfig.PriceList)
+	Price    *float64 `json:"price,omitempty"`
+	Currency string   `json:"currency,omitempty"`
+	// Image is the URL of the item's picture (see ImagesConfig)
+	Image string `json:"image,omitempty"`
+	// CreatedAt and UpdatedAt are maintained by the repository; UpdatedAt
+	// moves with every change of a synced field
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
+	// LastSyncedAt is when a sync last found the product's item in the feed
+	LastSyncedAt *time.Time `json:"lastSyncedAt,omitempty"`
+	// Version is incremented by every write, so an update computed from a
+	// stale read can be detected
+	Version int `json:"version,omitempty"`
+	// Locked products are managed by hand: syncs leave their title and handle alone
+	Locked bool `json:"locked,omitempty"`
+}
+
+// ExportFilter narrows the products of a catalog export
+type ExportFilter struct {
+	// Category keeps the products of this category; empty keeps all
+	Category string
+	// UpdatedSince keeps the products the audit log records a change of at or
+	// after it; zero keeps all
+	UpdatedSince time.Time
+	// IncludeArchived also exports the archived products
+	IncludeArchived bool
+}
+
+// Catalog export formats
+const (
+	ExportFormatCSV    = "csv"
+	ExportFormatJSON   = "json"
+	ExportFormatNDJSON = "ndjson"
+)
+
+// Archived reports whether the product disappeared from the external feed
+func (p Product) Archived() bool {
+	return p.Status == ProductStatusArchived
+}
+
+// ProductFilter narrows product listings; empty fields match everything
+type ProductFilter struct {
+	// Title matches products whose title contains it, case-insensitively
+	Title string
+	// Handle matches the product with exactly this handle
+	Handle string
 }
 
 // ExternalItem represents an item from the external API
@@ -18,12 +84,380 @@ type ExternalItem struct {
 	ItemCode       string `json:"ItemCode"`
 	ItemName       string `json:"ItemName"`
 	ItemsGroupCode int    `json:"ItemsGroupCode"`
+	// ItemPrices are the prices of the item in every price list, fetched only
+	// when a price list is synced
+	ItemPrices []ItemPrice `json:"ItemPrices,omitempty"`
+	// Picture is the file name of the item's picture, fetched only when images are synced
+	Picture string `json:"Picture,omitempty"`
+	// RawItemName is the ItemName as received, set only when sanitization changed it
+	RawItemName string `json:"-"`
+	// UpdateDate is the day the item was last changed in SAP, fetched only by incremental syncs
+	UpdateDate time.Time `json:"-"`
+}
+
+// ItemPrice is the price of an item in one price list
+type ItemPrice struct {
+	PriceList int      `json:"PriceList"`
+	Price     *float64 `json:"Price"`
+	Currency  string   `json:"Currency"`
+}
+
+// PriceIn returns the price of the item in price list list, or nil. The
+// Service Layer reports prices that were never set as 0 without a currency;
+// those count as no price.
+func (i ExternalItem) PriceIn(list int) *ItemPrice {
+	for _, p := range i.ItemPrices {
+		if p.PriceList != list {
+			continue
+		}
+		if p.Price == nil || (*p.Price == 0 && p.Currency == "") {
+			return nil
+		}
+		price := p
+		return &price
+	}
+	return nil
+}
+
+// ProductImage is a downloaded product picture
+type ProductImage struct {
+	// ProductID identifies the product of the picture; Handle is its handle
+	ProductID   int
+	Handle      string
+	URL         string
+	ContentType string
+	Data        []byte
+	// SHA256 is the hex digest of Data
+	SHA256 string
+}
+
+// ImageSyncResult reports the picture changes of a sync
+type ImageSyncResult struct {
+	// Changed counts the products whose picture URL was stored or cleared
+	Changed int `json:"changed"`
+	// Downloaded and Failed count the downloads of the changed pictures
+	Downloaded int   `json:"downloaded"`
+	Failed     int   `json:"failed"`
+	Bytes      int64 `json:"bytes"`
+}
+
+// ProductPrice is the price stored on a product; a nil Amount clears it
+type ProductPrice struct {
+	Amount   *float64
+	Currency string
+}
+
+// ItemValidationError describes an external item field that could not be decoded
+type ItemValidationError struct {
+	ItemCode string `json:"itemCode,omitempty"`
+	Field    string `json:"field,omitempty"`
+	Message  string `json:"message"`
+}
+
+func (e ItemValidationError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("item %s: %s", e.ItemCode, e.Message)
+	}
+	return fmt.Sprintf("item %s: %s: %s", e.ItemCode, e.Field, e.Message)
 }
 
+// Sync run statuses
+const (
+	SyncStatusRunning  = "running"
+	SyncStatusOK       = "ok"
+	SyncStatusDegraded = "degraded"
+	SyncStatusFailed   = "failed"
+	SyncStatusTimedOut = "timed_out"
+)
+
 // SyncResult contains statistics about the sync operation
 type SyncResult struct {
-	Created   int      `json:"created"`
-	Updated   int      `json:"updated"`
-	Unchanged int      `json:"unchanged"`
-	Errors    []string `json:"errors,omitempty"`
+	Status  string `json:"status"`
+	Mode    string `json:"mode,omitempty"`
+	DryRun  bool   `json:"dryRun,omitempty"`
+	Created int    `json:"created"`
+	Updated int    `json:"updated"`
+	// UpdatesAttempted counts planned updates, including those that turned out to be no-ops in the database
+	UpdatesAttempted int `json:"updatesAttempted,omitempty"`
+	Unchanged        int `json:"unchanged"`
+	// Reactivated counts archived products that reappeared in the external feed
+	Reactivated int `json:"reactivated,omitempty"`
+	// Archived counts active products archived because the feed no longer has them
+	Archived int `json:"archived,omitempty"`
+	// Deleted counts products deleted because the feeds of consecutive runs no longer had them
+	Deleted int `json:"deleted,omitempty"`
+	// Skipped counts the items left out by the item rules or locked
+	Skipped int `json:"skipped,omitempty"`
+	// Conflicts lists the handles of the products edited elsewhere while the
+	// sync ran, whose update was skipped to keep the edit
+	Conflicts []string `json:"conflicts,omitempty"`
+	// Locked lists the handles of the locked products whose title or handle
+	// the feed would have changed; the items are counted as skipped
+	Locked []string `json:"locked,omitempty"`
+	// Pushed counts the changes pushed to Shopify after the local sync
+	Pushed int `json:"pushed,omitempty"`
+	// Changes lists the outbox IDs of the changes the run queued for the sinks
+	Changes []int64 `json:"-"`
+	// Diffs lists the changes planned by a dry run, field by field
+	Diffs []ItemDiff `json:"diffs,omitempty"`
+	// DiffsOmitted counts the planned changes left out of Diffs
+	DiffsOmitted    int      `json:"diffsOmitted,omitempty"`
+	Errors          []string `json:"errors,omitempty"`
+	IntegrityIssues []string `json:"integrityIssues,omitempty"`
+	Anomalies       []string `json:"anomalies,omitempty"`
+	// Warnings report problems found in the data that did not stop the sync
+	Warnings []string `json:"warnings,omitempty"`
+	// Guard reports the change guard tripping on a run whose changes were out
+	// of proportion with the catalog
+	Guard *ChangeGuard `json:"guard,omitempty"`
+	// Verification reports the written products read back after the sync
+	Verification *WriteVerification `json:"verification,omitempty"`
+	// Images reports the picture changes when images are synced
+	Images *ImageSyncResult `json:"images,omitempty"`
+	// Groups breaks down a sync partitioned by item group; the diffs of dry
+	// runs are only reported in the combined result
+	Groups []GroupSyncResult `json:"groups,omitempty"`
+	// Performance breaks down where the run spent its effort
+	Performance *SyncPerformance `json:"performance,omitempty"`
+	// Handles lists the products behind the counters. It stays out of the run
+	// history; trigger responses include it on request.
+	Handles ChangedHandles `json:"-"`
+}
+
+// ChangedHandles lists the handles of the products a sync changed, or plans
+// to change in a dry run, by kind of change
+type ChangedHandles struct {
+	Created     []string `json:"created"`
+	Updated     []string `json:"updated"`
+	Reactivated []string `json:"reactivated"`
+	Archived    []string `json:"archived"`
+	Deleted     []string `json:"deleted"`
+}
+
+// Add appends the handles of other to h
+func (h *ChangedHandles) Add(other ChangedHandles) {
+	h.Created = append(h.Created, other.Created...)
+	h.Updated = append(h.Updated, other.Updated...)
+	h.Reactivated = append(h.Reactivated, other.Reactivated...)
+	h.Archived = append(h.Archived, other.Archived...)
+	h.Deleted = append(h.Deleted, other.Deleted...)
+}
+
+// ChangeGuard describes the creates and archives, or the updates, of a run
+// compared to the size of the catalog, when they exceeded the allowed share of it
+type ChangeGuard struct {
+	Creates        int     `json:"creates"`
+	Archives       int     `json:"archives"`
+	Updates        int     `json:"updates,omitempty"`
+	Catalog        int     `json:"catalog"`
+	MaxRatio       float64 `json:"maxRatio"`
+	MaxUpdateRatio float64 `json:"maxUpdateRatio,omitempty"`
+	// Confirmed runs apply the changes anyway
+	Confirmed bool `json:"confirmed"`
+	// PlanID is the sync plan holding the changes until they are approved
+	PlanID int `json:"planId,omitempty"`
+}
+
+// String describes the trip for the errors of the result
+func (g *ChangeGuard) String() string {
+	if g.MaxRatio <= 0 || float64(g.Creates+g.Archives) <= g.MaxRatio*float64(g.Catalog) {
+		return fmt.Sprintf("change guard tripped: %d updates exceed %g%% of the %d products", g.Updates, g.MaxUpdateRatio*100, g.Catalog)
+	}
+	return fmt.Sprintf("change guard tripped: %d creates and %d archives exceed %g%% of the %d products",
+		g.Creates, g.Archives, g.MaxRatio*100, g.Catalog)
+}
+
+// WriteVerification is the outcome of reading back the written products
+type WriteVerification struct {
+	// Written counts the products the sync wrote, Checked the ones read back
+	Written int `json:"written"`
+	Checked int `json:"checked"`
+	// Mismatches describe the products not stored with the intended values
+	Mismatches []string `json:"mismatches,omitempty"`
+}
+
+// GroupSyncResult is the outcome of the pipeline of one item group
+type GroupSyncResult struct {
+	GroupCode    int         `json:"groupCode"`
+	ItemsFetched int         `json:"itemsFetched"`
+	Result       *SyncResult `json:"result"`
+}
+
+// SyncPerformance is the performance breakdown of a sync run
+type SyncPerformance struct {
+	// NormalizeCacheHits counts title normalizations and handles served from the per-run cache
+	NormalizeCacheHits   int `json:"normalizeCacheHits"`
+	NormalizeCacheMisses int `json:"normalizeCacheMisses"`
+	// Fetch reports how the page workers adapted to the external API
+	Fetch *FetchConcurrency `json:"fetch,omitempty"`
+	// DiffMs is the time spent comparing the items with the products and
+	// DBWriteMs the time spent writing the changes, in milliseconds
+	DiffMs    int64 `json:"diffMs,omitempty"`
+	DBWriteMs int64 `json:"dbWriteMs,omitempty"`
+}
+
+// Add accumulates the counters of other into p
+func (p *SyncPerformance) Add(other *SyncPerformance) {
+	p.NormalizeCacheHits += other.NormalizeCacheHits
+	p.NormalizeCacheMisses += other.NormalizeCacheMisses
+	p.DiffMs += other.DiffMs
+	p.DBWriteMs += other.DBWriteMs
+	if other.Fetch != nil {
+		if p.Fetch == nil {
+			p.Fetch = &FetchConcurrency{}
+		}
+		p.Fetch.Add(other.Fetch)
+	}
+}
+
+// AddTimings adds the time spent comparing items with the products and
+// writing the changes to the performance breakdown of r
+func (r *SyncResult) AddTimings(diff, write time.Duration) {
+	if r.Performance == nil {
+		r.Performance = &SyncPerformance{}
+	}
+	r.Performance.Add(&SyncPerformance{DiffMs: diff.Milliseconds(), DBWriteMs: write.Milliseconds()})
+}
+
+// FetchConcurrency describes the page workers of a fetch
+type FetchConcurrency struct {
+	// Initial is the configured number of workers, the most the fetch used
+	Initial int `json:"initial"`
+	// Min is the fewest workers the fetch scaled down to, Final the workers at its end
+	Min   int `json:"min"`
+	Final int `json:"final"`
+	// ScaleDowns and ScaleUps count the changes of the number of workers
+	ScaleDowns int `json:"scaleDowns"`
+	ScaleUps   int `json:"scaleUps"`
+	// Throttled counts pages answered with 429 or 5xx, Slow the pages over the latency threshold
+	Throttled int `json:"throttled"`
+	Slow      int `json:"slow"`
+}
+
+// Add accumulates the workers of other into c, for fetches running side by side
+func (c *FetchConcurrency) Add(other *FetchConcurrency) {
+	c.Initial += other.Initial
+	c.Min += other.Min
+	c.Final += other.Final
+	c.ScaleDowns += other.ScaleDowns
+	c.ScaleUps += other.ScaleUps
+	c.Throttled += other.Throttled
+	c.Slow += other.Slow
+}
+
+// Add accumulates the counters and messages of other into r
+func (r *SyncResult) Add(other *SyncResult) {
+	r.Created += other.Created
+	r.Updated += other.Updated
+	r.UpdatesAttempted += other.UpdatesAttempted
+	r.Unchanged += other.Unchanged
+	r.Reactivated += other.Reactivated
+	r.Archived += other.Archived
+	r.Deleted += other.Deleted
+	r.Skipped += other.Skipped
+	r.Conflicts = append(r.Conflicts, other.Conflicts...)
+	r.Locked = append(r.Locked, other.Locked...)
+	r.Pushed += other.Pushed
+	r.Changes = append(r.Changes, other.Changes...)
+	r.Diffs = append(r.Diffs, other.Diffs...)
+	r.DiffsOmitted += other.DiffsOmitted
+	r.Errors = append(r.Errors, other.Errors...)
+	r.IntegrityIssues = append(r.IntegrityIssues, other.IntegrityIssues...)
+	r.Anomalies = append(r.Anomalies, other.Anomalies...)
+	r.Warnings = append(r.Warnings, other.Warnings...)
+	r.Groups = append(r.Groups, other.Groups...)
+	r.Handles.Add(other.Handles)
+	if other.Guard != nil {
+		r.Guard = other.Guard
+	}
+	if other.Verification != nil {
+		if r.Verification == nil {
+			r.Verification = &WriteVerification{}
+		}
+		r.Verification.Written += other.Verification.Written
+		r.Verification.Checked += other.Verification.Checked
+		r.Verification.Mismatches = append(r.Verification.Mismatches, other.Verification.Mismatches...)
+	}
+	if other.Images != nil {
+		if r.Images == nil {
+			r.Images = &ImageSyncResult{}
+		}
+		r.Images.Changed += other.Images.Changed
+		r.Images.Downloaded += other.Images.Downloaded
+		r.Images.Failed += other.Images.Failed
+		r.Images.Bytes += other.Images.Bytes
+	}
+	if other.Performance != nil {
+		if r.Performance == nil {
+			r.Performance = &SyncPerformance{}
+		}
+		r.Performance.Add(other.Performance)
+	}
+}
+
+// syncStatusSeverity ranks run statuses from best to worst
+var syncStatusSeverity = map[string]int{
+	SyncStatusOK:       0,
+	SyncStatusDegraded: 1,
+	SyncStatusTimedOut: 2,
+	SyncStatusFailed:   3,
+}
+
+// WorseStatus returns the more severe of two run statuses
+func WorseStatus(a, b string) string {
+	if syncStatusSeverity[b] > syncStatusSeverity[a] {
+		return b
+	}
+	return a
+}
+
+// IntegrityReport contains the results of post-sync data integrity checks
+type IntegrityReport struct {
+	TotalProducts   int `json:"totalProducts"`
+	EmptyHandles    int `json:"emptyHandles"`
+	DuplicateTitles int `json:"duplicateTitles"`
+}
+
+// Reasons a handle is repaired
+const (
+	// HandleMissing is a product without a handle
+	HandleMissing = "missing"
+	// HandleDuplicate is a product sharing its handle with a product kept first
+	HandleDuplicate = "duplicate"
+	// HandleNonConforming is a handle the current rules don't generate from the title
+	HandleNonConforming = "nonconforming"
+)
+
+// HandleRepair is a product handle regenerated by the handle repair
+type HandleRepair struct {
+	ProductID int    `json:"productId"`
+	Title     string `json:"title"`
+	OldHandle string `json:"oldHandle,omitempty"`
+	NewHandle string `json:"newHandle"`
+	Reason    string `json:"reason"`
+}
+
+// HandleRepairReport lists the handles a repair regenerated, or would
+// regenerate when it was not applied
+type HandleRepairReport struct {
+	Scanned int            `json:"scanned"`
+	Repairs []HandleRepair `json:"repairs"`
+	Applied int            `json:"applied"`
+}
+
+// BatchBenchmark is the throughput of synthetic product writes in batches of one size
+type BatchBenchmark struct {
+	BatchSize        int     `json:"batchSize"`
+	Rows             int     `json:"rows"`
+	InsertMs         int64   `json:"insertMs"`
+	InsertRowsPerSec float64 `json:"insertRowsPerSec"`
+	UpdateMs         int64   `json:"updateMs"`
+	UpdateRowsPerSec float64 `json:"updateRowsPerSec"`
+}
+
+// SinkMapping links a product to its object ID in a downstream sink (Shopify, search, ...)
+type SinkMapping struct {
+	ProductID  int    `json:"productId"`
+	Sink       string `json:"sink"`
+	ExternalID string `json:"externalId"`
 }
@@ -0,0 +1,73 @@
+package models
+
+import "time"
+
+// RunTriggerJob marks runs executed for an async sync job
+const RunTriggerJob = "job"
+
+// Sync job statuses
+const (
+	JobStatusQueued  = "queued"
+	JobStatusRunning = "running"
+	JobStatusDone    = "done"
+	JobStatusFailed  = "failed"
+)
+
+// JobOptions are the options a sync job was enqueued with
+type JobOptions struct {
+	// Full forces a full sync when incremental ones are enabled
+	Full   bool `json:"full,omitempty"`
+	DryRun bool `json:"dryRun,omitempty"`
+	// Confirm applies the changes even when they trip the change guard
+	Confirm bool `json:"confirm,omitempty"`
+}
+
+// JobProgress is the last write phase reported by a running job
+type JobProgress struct {
+	Phase string `json:"phase"`
+	Done  int    `json:"done"`
+	Total int    `json:"total"`
+}
+
+// SyncJob is a sync enqueued with POST /api/sync and run by a separate
+// invocation. Its state lives in the database so any instance can report it.
+type SyncJob struct {
+	ID       int          `json:"id"`
+	Status   string       `json:"status"`
+	Options  JobOptions   `json:"options"`
+	RunID    int          `json:"runId,omitempty"`
+	Progress *JobProgress `json:"progress,omitempty"`
+	Result   *SyncResult  `json:"result,omitempty"`
+	Error    string       `json:"error,omitempty"`
+	// Attempts counts the claims of the job, more than one when a stalled run was taken over
+	Attempts   int        `json:"attempts"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	// HeartbeatAt is when the running job last reported progress
+	HeartbeatAt *time.Time `json:"heartbeatAt,omitempty"`
+}
+
+// Finished reports whether the job reached a final status
+func (j SyncJob) Finished() bool {
+	return j.Status == JobStatusDone || j.Status == JobStatusFailed
+}
+
+// In returns a copy of the job with its timestamps rendered in loc
+func (j SyncJob) In(loc *time.Location) SyncJob {
+	j.CreatedAt = j.CreatedAt.In(loc)
+	for _, t := range []**time.Time{&j.StartedAt, &j.FinishedAt, &j.HeartbeatAt} {
+		if *t != nil {
+			local := (*t).In(loc)
+			*t = &local
+		}
+	}
+	return j
+}
+
+// JobAcceptedResponse is returned when a sync job is enqueued
+type JobAcceptedResponse struct {
+	JobID     int    `json:"jobId"`
+	Status    string `json:"status"`
+	StatusURL string `json:"statusUrl"`
+}
@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// Notification channels
+const (
+	ChannelSlack   = "slack"
+	ChannelWebhook = "webhook"
+	ChannelEmail   = "email"
+)
+
+// RunSummary is the data available to notification templates
+type RunSummary struct {
+	Run      SyncRun
+	Duration time.Duration
+	Timezone string
+	// StatusURL links to the status endpoint of the deployment, when its public URL is configured
+	StatusURL string
+}
+
+// NotifyRoute sends notifications for runs of an entity with one of the given
+// outcomes to a single target, either immediately or as a periodic digest
+type NotifyRoute struct {
+	Name     string   `json:"name"`
+	Entity   string   `json:"entity,omitempty"`   // Empty matches every entity
+	Outcomes []string `json:"outcomes,omitempty"` // Empty matches every outcome
+	Channel  string   `json:"channel"`
+	URL      string   `json:"url"`
+	Digest   string   `json:"digest,omitempty"` // Digest interval like "168h"; empty notifies every run
+}
+
+// Matches reports whether the route applies to the run
+func (r NotifyRoute) Matches(run SyncRun) bool {
+	if r.Entity != "" && r.Entity != run.Entity {
+		return false
+	}
+	if len(r.Outcomes) == 0 {
+		return true
+	}
+	for _, outcome := range r.Outcomes {
+		if outcome == run.Status {
+			return true
+		}
+	}
+	return false
+}
+
+// DigestSummary is the data available to digest templates
+type DigestSummary struct {
+	Route  string
+	Since  time.Time
+	Runs   []SyncRun
+	Totals SyncResult
+	// DiffLinks maps run IDs to a link to the CSV of their changes, when enabled
+	DiffLinks map[int]string
+}
@@ -0,0 +1,60 @@
+package models
+
+import "time"
+
+// Change actions recorded in the outbox
+const (
+	ChangeActionCreate = "create"
+	ChangeActionUpdate = "update"
+	ChangeActionDelete = "delete"
+	// ChangeActionArchive and ChangeActionReactivate mark products leaving and re-entering the external feed
+	ChangeActionArchive    = "archive"
+	ChangeActionReactivate = "reactivate"
+)
+
+// Per-sink delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// Change is a single product change queued in the outbox for downstream sinks
+type Change struct {
+	ID        int64  `json:"id"`
+	Action    string `json:"action"`
+	ProductID int    `json:"productId,omitempty"`
+	Title     string `json:"title"`
+	Handle    string `json:"handle"`
+	// OldHandle is the handle an update replaced, for sinks that only know
+	// the product by its handle
+	OldHandle string    `json:"oldHandle,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Delivery tracks the delivery of one change to one sink
+type Delivery struct {
+	Change    Change `json:"change"`
+	Sink      string `json:"sink"`
+	Status    string `json:"status"`
+	Attempts  int    `json:"attempts"`
+	LastError string `json:"lastError,omitempty"`
+}
+
+// SinkLag describes how far behind a sink is in consuming the outbox
+type SinkLag struct {
+	Sink              string  `json:"sink"`
+	Pending           int     `json:"pending"`
+	Failed            int     `json:"failed"`
+	OldestPendingSecs float64 `json:"oldestPendingSeconds"`
+}
+
+// SinkDispatchResult summarizes one dispatch pass of the outbox to a sink
+type SinkDispatchResult struct {
+	Sink      string `json:"sink"`
+	Delivered int    `json:"delivered"`
+	Failed    int    `json:"failed"`
+	Error     string `json:"error,omitempty"`
+	// Changes lists the IDs of the delivered changes
+	Changes []int64 `json:"-"`
+}
@@ -0,0 +1,14 @@
+package models
+
+// RunTriggerApproval marks runs applying an approved sync plan
+const RunTriggerApproval = "approval"
+
+// Statuses of the sync plans held for approval
+const (
+	PlanStatusPending  = "pending"
+	PlanStatusApproved = "approved"
+	PlanStatusApplied  = "applied"
+	PlanStatusFailed   = "failed"
+	PlanStatusRejected = "rejected"
+	PlanStatusExpired  = "expired"
+)
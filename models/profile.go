@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// SyncProfileVersion is the version of the sync profile format written by exports
+const SyncProfileVersion = 1
+
+// SyncProfile is a versioned export of the sync settings of an environment
+// (filters, batching, policies, notification templates, ...), keyed by their
+// config file names. Secrets and the endpoints of the environment are left
+// out so a profile can be promoted from staging to production.
+type SyncProfile struct {
+	Version    int               `json:"version"`
+	ExportedAt time.Time         `json:"exportedAt"`
+	Settings   map[string]string `json:"settings"`
+}
+
+// StoredSyncProfile is a sync profile imported into an environment
+type StoredSyncProfile struct {
+	ID         int         `json:"id"`
+	Profile    SyncProfile `json:"profile"`
+	ImportedAt time.Time   `json:"importedAt"`
+}
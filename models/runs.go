@@ -0,0 +1,83 @@
+package models
+
+import "time"
+
+// Sync run triggers
+const (
+	RunTriggerHTTP = "http"
+	RunTriggerCLI  = "cli"
+	// RunTriggerImport marks runs syncing an uploaded file of items
+	RunTriggerImport = "import"
+)
+
+// Synced entities
+const (
+	EntityProducts = "products"
+)
+
+// Sync modes
+const (
+	SyncModeFull = "full"
+	// SyncModeIncremental only fetches the items updated since the last successful sync
+	SyncModeIncremental = "incremental"
+)
+
+// SyncWatermark records when an entity was last synced successfully, in any mode and in full
+type SyncWatermark struct {
+	Entity         string    `json:"entity"`
+	LastSyncAt     time.Time `json:"lastSyncAt"`
+	LastFullSyncAt time.Time `json:"lastFullSyncAt"`
+}
+
+// Backoff sources
+const (
+	BackoffSourceExternalAPI = "external_api"
+)
+
+// BackoffState records the consecutive failures to reach an upstream and when
+// the next attempt is allowed
+type BackoffState struct {
+	Source        string    `json:"source"`
+	Failures      int       `json:"failures"`
+	NextAttemptAt time.Time `json:"nextAttemptAt"`
+	LastError     string    `json:"lastError,omitempty"`
+}
+
+// Circuit states of an upstream, derived from its BackoffState
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+// Circuit returns the state of the circuit breaker of the upstream at now:
+// open during the backoff window, then half-open until an attempt succeeds
+func (s *BackoffState) Circuit(now time.Time) string {
+	switch {
+	case s == nil || s.Failures == 0:
+		return CircuitClosed
+	case now.Before(s.NextAttemptAt):
+		return CircuitOpen
+	default:
+		return CircuitHalfOpen
+	}
+}
+
+// SyncRun records the outcome of a single sync invocation
+type SyncRun struct {
+	ID         int         `json:"id"`
+	Entity     string      `json:"entity"`
+	Trigger    string      `json:"trigger"`
+	Status     string      `json:"status"`
+	StartedAt  time.Time   `json:"startedAt"`
+	FinishedAt time.Time   `json:"finishedAt"`
+	Result     *SyncResult `json:"result,omitempty"`
+	Error      string      `json:"error,omitempty"`
+}
+
+// In returns a copy of the run with its timestamps rendered in loc
+func (r SyncRun) In(loc *time.Location) SyncRun {
+	r.StartedAt = r.StartedAt.In(loc)
+	r.FinishedAt = r.FinishedAt.In(loc)
+	return r
+}
@@ -0,0 +1,22 @@
+package models
+
+// ShardKeys are the first characters of the item codes in order, split into
+// the ItemCode ranges of the shards; there are at most as many shards as keys
+const ShardKeys = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// ShardAssignment identifies the shard of a sharded sync handled by one invocation
+type ShardAssignment struct {
+	CycleID int `json:"cycleId"`
+	Shard   int `json:"shard"`
+	Shards  int `json:"shards"`
+}
+
+// ShardProgress reports how far a cycle over all shards has come after a shard finished
+type ShardProgress struct {
+	ShardAssignment
+	// Done is the number of shards of the cycle that completed successfully
+	Done     int  `json:"done"`
+	Complete bool `json:"complete"`
+	// Report combines the results of every shard once the cycle is complete
+	Report *SyncResult `json:"report,omitempty"`
+}
@@ -0,0 +1,460 @@
+package models
+
+import (
+	"fmt"
+	"net/mail"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// FieldError describes one invalid configuration setting, named after its environment variable
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// ValidationError aggregates every invalid setting found by AppConfig.Validate
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		msgs[i] = fe.Error()
+	}
+	return "invalid configuration: " + strings.Join(msgs, "; ")
+}
+
+// Validate checks the configuration and returns a *ValidationError listing
+// every problem, or nil when the configuration is usable
+func (c *AppConfig) Validate() error {
+	errs := append([]FieldError(nil), c.LoadErrors...)
+	fail := func(field, format string, args ...interface{}) {
+		errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if c.Database.DatabaseURI == "" {
+		fail("DATABASE_URL", "is required")
+	}
+	if c.Database.Driver != DatabaseDriverPQ && c.Database.Driver != DatabaseDriverPgx {
+		fail("DATABASE_DRIVER", "must be %q or %q, got %q", DatabaseDriverPQ, DatabaseDriverPgx, c.Database.Driver)
+	}
+	switch c.Database.Dialect {
+	case DatabaseDialectPostgres:
+	case DatabaseDialectMySQL, DatabaseDialectSQLite:
+		if c.Database.Driver == DatabaseDriverPgx {
+			fail("DATABASE_DRIVER", "%q needs the %q dialect, got %q", DatabaseDriverPgx, DatabaseDialectPostgres, c.Database.Dialect)
+		}
+		// Only the products are portable: these features read or write the other tables
+		for _, feature := range []struct {
+			field   string
+			enabled bool
+		}{
+			{"SYNC_INCREMENTAL", c.Sync.Incremental},
+			{"SYNC_PRIORITY_FROM_DB", c.Sync.PriorityFromDB},
+			{"CATEGORIES_FROM_DB", c.Sync.CategoriesFromDB},
+			{"SYNC_IMAGES", c.Images.Enabled},
+			{"SYNC_REQUIRE_APPROVAL", c.Sync.RequireApproval},
+		} {
+			if feature.enabled {
+				fail(feature.field, "needs the %q dialect, got %q", DatabaseDialectPostgres, c.Database.Dialect)
+			}
+		}
+	default:
+		fail("DATABASE_DIALECT", "must be %q, %q or %q, got %q", DatabaseDialectPostgres, DatabaseDialectMySQL, DatabaseDialectSQLite, c.Database.Dialect)
+	}
+	if c.Database.Schema != "" && !ValidIdentifier(c.Database.Schema) {
+		fail("DATABASE_SCHEMA", "must be a lowercase SQL identifier, got %q", c.Database.Schema)
+	}
+	if c.Database.ProductsTable != "" && !ValidIdentifier(c.Database.ProductsTable) {
+		fail("DATABASE_PRODUCTS_TABLE", "must be a lowercase SQL identifier, got %q", c.Database.ProductsTable)
+	}
+	if (c.Database.Schema != "" || c.Database.ProductsTable != "") && c.Database.Dialect != DatabaseDialectPostgres {
+		fail("DATABASE_PRODUCTS_TABLE", "needs the %q dialect, got %q", DatabaseDialectPostgres, c.Database.Dialect)
+	}
+	if c.Auth.CRONSecret == "" {
+		fail("CRON_SECRET", "is required")
+	}
+	for _, secret := range c.Auth.PreviousSecrets {
+		if secret == "" {
+			fail("CRON_PREVIOUS_SECRETS", "must not contain empty secrets")
+		}
+	}
+	if c.Auth.Scheme != AuthSchemeBearer && c.Auth.Scheme != AuthSchemeHMAC {
+		fail("AUTH_SCHEME", "must be %q or %q, got %q", AuthSchemeBearer, AuthSchemeHMAC, c.Auth.Scheme)
+	}
+	if c.Auth.Scheme == AuthSchemeHMAC && c.Auth.SignatureTolerance <= 0 {
+		fail("AUTH_SIGNATURE_TOLERANCE", "must be positive, got %s", c.Auth.SignatureTolerance)
+	}
+	if c.Auth.TrustedProxies < 0 {
+		fail("AUTH_TRUSTED_PROXIES", "must not be negative, got %d", c.Auth.TrustedProxies)
+	}
+	for _, ip := range c.Auth.AllowedIPs {
+		if _, err := netip.ParsePrefix(ip); err != nil {
+			if _, err := netip.ParseAddr(ip); err != nil {
+				fail("AUTH_ALLOWED_IPS", "%q is neither an IP address nor a CIDR range", ip)
+			}
+		}
+	}
+	switch c.Source.Kind {
+	case SourceSAP:
+		if u, err := url.Parse(c.ExternalAPI.ExternalAPIURL); c.ExternalAPI.ExternalAPIURL == "" {
+			fail("EXTERNAL_API_URL", "is required")
+		} else if err != nil || u.Scheme == "" || u.Host == "" {
+			fail("EXTERNAL_API_URL", "%q is not an absolute URL", c.ExternalAPI.ExternalAPIURL)
+		}
+	case SourceCSV:
+		if c.Source.CSVFile == "" {
+			fail("SOURCE_CSV_FILE", "is required with SYNC_SOURCE=%s", SourceCSV)
+		}
+	default:
+		fail("SYNC_SOURCE", "must be %q or %q, got %q", SourceSAP, SourceCSV, c.Source.Kind)
+	}
+
+	if c.ExternalAPI.PageSize <= 0 {
+		fail("PAGE_SIZE", "must be positive, got %d", c.ExternalAPI.PageSize)
+	}
+	if c.ExternalAPI.MaxPageSize < 0 {
+		fail("EXTERNAL_API_MAX_PAGE_SIZE", "must not be negative, got %d", c.ExternalAPI.MaxPageSize)
+	}
+	if c.ExternalAPI.NumWorkers <= 0 {
+		fail("NUM_WORKERS", "must be positive, got %d", c.ExternalAPI.NumWorkers)
+	}
+	if c.ExternalAPI.SlowPageThreshold < 0 {
+		fail("EXTERNAL_API_SLOW_PAGE", "must not be negative, got %s", c.ExternalAPI.SlowPageThreshold)
+	}
+	if c.ExternalAPI.Filter == "" && len(c.ExternalAPI.GroupCodes) == 0 {
+		fail("ITEMS_GROUP_CODES", "is required when ITEMS_FILTER is not set")
+	}
+	if c.ExternalAPI.PriceList < 0 {
+		fail("ITEMS_PRICE_LIST", "must not be negative, got %d", c.ExternalAPI.PriceList)
+	}
+	if c.ExternalAPI.Timeout <= 0 {
+		fail("EXTERNAL_API_TIMEOUT", "must be positive, got %s", c.ExternalAPI.Timeout)
+	}
+	if c.ExternalAPI.Transport.MaxConnsPerHost < 0 {
+		fail("EXTERNAL_API_MAX_CONNS_PER_HOST", "must not be negative, got %d", c.ExternalAPI.Transport.MaxConnsPerHost)
+	}
+	if c.ExternalAPI.Transport.IdleConnTimeout < 0 {
+		fail("EXTERNAL_API_IDLE_CONN_TIMEOUT", "must not be negative, got %s", c.ExternalAPI.Transport.IdleConnTimeout)
+	}
+	if c.ExternalAPI.Transport.MaxIdleConnsPerHost < 0 {
+		fail("EXTERNAL_API_MAX_IDLE_CONNS_PER_HOST", "must not be negative, got %d", c.ExternalAPI.Transport.MaxIdleConnsPerHost)
+	}
+	if c.ExternalAPI.Transport.DialTimeout < 0 {
+		fail("EXTERNAL_API_DIAL_TIMEOUT", "must not be negative, got %s", c.ExternalAPI.Transport.DialTimeout)
+	}
+	if c.ExternalAPI.Transport.TLSHandshakeTimeout < 0 {
+		fail("EXTERNAL_API_TLS_HANDSHAKE_TIMEOUT", "must not be negative, got %s", c.ExternalAPI.Transport.TLSHandshakeTimeout)
+	}
+	if c.ExternalAPI.Transport.ResponseHeaderTimeout < 0 {
+		fail("EXTERNAL_API_RESPONSE_HEADER_TIMEOUT", "must not be negative, got %s", c.ExternalAPI.Transport.ResponseHeaderTimeout)
+	}
+	for _, header := range c.ExternalAPI.Headers {
+		if name, _, ok := strings.Cut(header, "="); !ok || strings.TrimSpace(name) == "" {
+			fail("EXTERNAL_API_HEADERS", "%q is not a name=value pair", header)
+		}
+	}
+	if auth := c.ExternalAuth; auth.CredentialsFile != "" && auth.CredentialsURL != "" {
+		fail("CREDENTIALS_URL", "cannot be combined with CREDENTIALS_FILE")
+	} else if auth.CredentialsURL != "" {
+		if u, err := url.Parse(auth.CredentialsURL); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			fail("CREDENTIALS_URL", "%q is not an http or https URL", auth.CredentialsURL)
+		}
+	}
+	if secondary := c.ExternalAuth.Secondary; secondary.UserName == "" && (secondary.Password != "" || secondary.CompanyDB != "") {
+		fail("SECONDARY_USER_NAME", "is required by the secondary credentials")
+	}
+	if proxy := c.ExternalAPI.Transport.ProxyURL; proxy != "" {
+		if u, err := url.Parse(proxy); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			fail("EXTERNAL_API_PROXY_URL", "%q is not an http or https URL", proxy)
+		}
+	}
+	if mode := c.ExternalAPI.Recording.Mode; mode != RecordingOff && mode != RecordingMemory && mode != RecordingDir {
+		fail("EXTERNAL_API_RECORD", "must be %q, %q or %q, got %q", RecordingOff, RecordingMemory, RecordingDir, mode)
+	}
+	if c.ExternalAPI.Recording.Size <= 0 {
+		fail("EXTERNAL_API_RECORD_SIZE", "must be positive, got %d", c.ExternalAPI.Recording.Size)
+	}
+	if c.ExternalAPI.Recording.MaxBody < 0 {
+		fail("EXTERNAL_API_RECORD_MAX_BODY", "must not be negative, got %d", c.ExternalAPI.Recording.MaxBody)
+	}
+	if c.ExternalAPI.LoginTimeout <= 0 {
+		fail("EXTERNAL_API_LOGIN_TIMEOUT", "must be positive, got %s", c.ExternalAPI.LoginTimeout)
+	}
+	if c.ExternalAPI.FetchTimeout <= 0 {
+		fail("EXTERNAL_API_FETCH_TIMEOUT", "must be positive, got %s", c.ExternalAPI.FetchTimeout)
+	}
+	if c.ExternalAPI.BackoffBase < 0 {
+		fail("EXTERNAL_API_BACKOFF_BASE", "must not be negative, got %s", c.ExternalAPI.BackoffBase)
+	} else if c.ExternalAPI.BackoffBase > 0 && c.ExternalAPI.BackoffMax < c.ExternalAPI.BackoffBase {
+		fail("EXTERNAL_API_BACKOFF_MAX", "must be at least EXTERNAL_API_BACKOFF_BASE (%s), got %s", c.ExternalAPI.BackoffBase, c.ExternalAPI.BackoffMax)
+	}
+	if c.ExternalAPI.Breaker < 0 {
+		fail("EXTERNAL_API_BREAKER_THRESHOLD", "must not be negative, got %d", c.ExternalAPI.Breaker)
+	}
+	if c.Sync.Timeout <= 0 {
+		fail("SYNC_TIMEOUT", "must be positive, got %s", c.Sync.Timeout)
+	}
+	if c.Sync.BatchTimeout <= 0 {
+		fail("SYNC_BATCH_TIMEOUT", "must be positive, got %s", c.Sync.BatchTimeout)
+	}
+	if c.Sync.PlanTTL <= 0 {
+		fail("SYNC_PLAN_TTL", "must be positive, got %s", c.Sync.PlanTTL)
+	}
+	if base := c.Sync.JobBaseURL; base != "" {
+		if u, err := url.Parse(base); err != nil || u.Scheme == "" || u.Host == "" {
+			fail("JOB_BASE_URL", "%q is not an absolute URL", base)
+		}
+	}
+	if c.Sync.IdempotencyTTL <= 0 {
+		fail("IDEMPOTENCY_TTL", "must be positive, got %s", c.Sync.IdempotencyTTL)
+	}
+	if c.Sync.StatusCacheTTL < 0 {
+		fail("STATUS_CACHE_TTL", "must not be negative, got %s", c.Sync.StatusCacheTTL)
+	}
+	if c.Sync.PriorityFromDB && c.Sync.PriorityLimit <= 0 {
+		fail("SYNC_PRIORITY_LIMIT", "must be positive, got %d", c.Sync.PriorityLimit)
+	}
+	switch c.ExternalAPI.Pagination {
+	case PaginationSkip, PaginationNextLink:
+	case PaginationBatch:
+		if c.ExternalAPI.BatchPages <= 0 {
+			fail("EXTERNAL_API_BATCH_PAGES", "must be positive, got %d", c.ExternalAPI.BatchPages)
+		}
+	default:
+		fail("PAGINATION_MODE", "must be %q, %q or %q, got %q", PaginationSkip, PaginationNextLink, PaginationBatch, c.ExternalAPI.Pagination)
+	}
+
+	if c.Sync.FreshnessMaxAge <= 0 {
+		fail("FRESHNESS_MAX_AGE", "must be positive, got %s", c.Sync.FreshnessMaxAge)
+	}
+	if c.Sync.LookupBatchSize < 0 {
+		fail("PRODUCT_LOOKUP_BATCH_SIZE", "must not be negative, got %d", c.Sync.LookupBatchSize)
+	}
+	if c.Sync.ProductCacheTTL < 0 {
+		fail("PRODUCT_CACHE_TTL", "must not be negative, got %s", c.Sync.ProductCacheTTL)
+	}
+	if c.Sync.UpdateChunkSize < 0 {
+		fail("UPDATE_CHUNK_SIZE", "must not be negative, got %d", c.Sync.UpdateChunkSize)
+	}
+	if c.Sync.CreateChunkSize < 0 {
+		fail("CREATE_CHUNK_SIZE", "must not be negative, got %d", c.Sync.CreateChunkSize)
+	}
+	if c.Sync.UpdateWorkers <= 0 {
+		fail("UPDATE_WORKERS", "must be positive, got %d", c.Sync.UpdateWorkers)
+	}
+	if c.Sync.Shards < 1 || c.Sync.Shards > len(ShardKeys) {
+		fail("SYNC_SHARDS", "must be between 1 and %d, got %d", len(ShardKeys), c.Sync.Shards)
+	}
+	// A shard fetches its ItemCode range only, which cannot tell the products that left the catalog
+	if c.Sync.DeleteMissing && c.Sync.Shards > 1 && c.Source.Kind == SourceSAP {
+		fail("SYNC_DELETE_MISSING", "cannot be combined with SYNC_SHARDS > 1")
+	}
+	if c.Sync.Incremental {
+		if c.Sync.FullSyncEvery <= 0 {
+			fail("SYNC_FULL_EVERY", "must be positive, got %s", c.Sync.FullSyncEvery)
+		}
+		if c.Sync.Shards > 1 {
+			fail("SYNC_INCREMENTAL", "cannot be combined with SYNC_SHARDS > 1")
+		}
+	}
+	if c.Sync.PartitionByGroup {
+		if c.Sync.PartitionWorkers <= 0 {
+			fail("SYNC_PARTITION_WORKERS", "must be positive, got %d", c.Sync.PartitionWorkers)
+		}
+		if c.Source.Kind != SourceSAP {
+			fail("SYNC_PARTITION_BY_GROUP", "requires SYNC_SOURCE=%s", SourceSAP)
+		}
+		if c.ExternalAPI.Filter != "" {
+			fail("SYNC_PARTITION_BY_GROUP", "cannot be combined with ITEMS_FILTER")
+		}
+	}
+	stripsPrefixes := false
+	for _, rule := range c.Sync.TitleRules {
+		switch rule {
+		case TitleRuleTrim, TitleRuleLower, TitleRuleLowerTurkish, TitleRuleCollapseSpace, TitleRuleStripPunct:
+		case TitleRuleStripPrefixes:
+			stripsPrefixes = true
+		default:
+			fail("TITLE_NORMALIZE_RULES", "unknown rule %q, expected one of %s", rule, strings.Join(TitleRules, ", "))
+		}
+	}
+	if stripsPrefixes && len(c.Sync.VendorPrefixes) == 0 {
+		fail("TITLE_VENDOR_PREFIXES", "is required with the %s rule", TitleRuleStripPrefixes)
+	}
+	for target, source := range c.Sync.FieldMapping {
+		switch target {
+		case MappingTitle, MappingGroup, MappingPicture:
+		default:
+			fail("SYNC_FIELD_MAPPING", "unknown target %q, expected one of %s", target, strings.Join(MappingTargets, ", "))
+			continue
+		}
+		if _, _, err := ParseMapping(target, source); err != nil {
+			fail("SYNC_FIELD_MAPPING", "invalid mapping of %s: %v", target, err)
+		}
+	}
+	switch c.Sync.Duplicates {
+	case DuplicatesReport, DuplicatesFlag, DuplicatesMerge:
+	default:
+		fail("SYNC_DUPLICATES", "must be %q, %q or %q, got %q", DuplicatesReport, DuplicatesFlag, DuplicatesMerge, c.Sync.Duplicates)
+	}
+	if c.Sync.DeleteAfterRuns < 0 {
+		fail("SYNC_DELETE_AFTER_RUNS", "must not be negative, got %d", c.Sync.DeleteAfterRuns)
+	} else if c.Sync.DeleteAfterRuns > 0 && !c.Sync.DeleteMissing {
+		fail("SYNC_DELETE_AFTER_RUNS", "requires SYNC_DELETE_MISSING")
+	}
+	if c.Sync.MaxErrors < 0 {
+		fail("SYNC_MAX_ERRORS", "must not be negative, got %d", c.Sync.MaxErrors)
+	}
+	if c.Sync.VerifySample < 0 {
+		fail("SYNC_VERIFY_SAMPLE", "must not be negative, got %d", c.Sync.VerifySample)
+	}
+	if _, err := regexp.Compile(c.Sync.ItemRules.IncludeNamePattern); err != nil {
+		fail("SYNC_INCLUDE_NAME_PATTERN", "is not a valid regular expression: %v", err)
+	}
+	if _, err := regexp.Compile(c.Sync.ItemRules.ExcludeNamePattern); err != nil {
+		fail("SYNC_EXCLUDE_NAME_PATTERN", "is not a valid regular expression: %v", err)
+	}
+	if c.Sync.MaxChangeRatio < 0 {
+		fail("SYNC_MAX_CHANGE_RATIO", "must not be negative, got %g", c.Sync.MaxChangeRatio)
+	}
+	if c.Sync.MaxUpdateRatio < 0 {
+		fail("SYNC_MAX_UPDATE_RATIO", "must not be negative, got %g", c.Sync.MaxUpdateRatio)
+	}
+	if c.Sync.MinFeedRatio < 0 || c.Sync.MinFeedRatio > 1 {
+		fail("SYNC_MIN_FEED_RATIO", "must be between 0 and 1, got %g", c.Sync.MinFeedRatio)
+	}
+	if c.Sanitize.MaxLength < 0 {
+		fail("SANITIZE_MAX_LENGTH", "must not be negative, got %d", c.Sanitize.MaxLength)
+	}
+	replaces, trimsSuffixes := false, false
+	for _, step := range c.Sanitize.TitleSteps {
+		switch step {
+		case TitleStepStripBrackets, TitleStepTitleCase, TitleStepUpper:
+		case TitleStepReplace:
+			replaces = true
+		case TitleStepTrimSuffixes:
+			trimsSuffixes = true
+		default:
+			fail("SANITIZE_TITLE_STEPS", "unknown step %q, expected one of %s", step, strings.Join(TitleSteps, ", "))
+		}
+	}
+	if replaces && len(c.Sanitize.TitleReplacements) == 0 {
+		fail("SANITIZE_TITLE_REPLACEMENTS", "is required with the %s step", TitleStepReplace)
+	}
+	for i, r := range c.Sanitize.TitleReplacements {
+		if _, err := regexp.Compile(r.Pattern); err != nil {
+			fail("SANITIZE_TITLE_REPLACEMENTS", "replacement %d is not a valid regular expression: %v", i+1, err)
+		}
+	}
+	if trimsSuffixes && len(c.Sanitize.TitleSuffixes) == 0 {
+		fail("SANITIZE_TITLE_SUFFIXES", "is required with the %s step", TitleStepTrimSuffixes)
+	}
+	if c.Images.Enabled {
+		if u, err := url.Parse(c.Images.BaseURL); c.Images.BaseURL == "" {
+			fail("IMAGES_BASE_URL", "is required with SYNC_IMAGES")
+		} else if err != nil || u.Scheme == "" || u.Host == "" {
+			fail("IMAGES_BASE_URL", "%q is not an absolute URL", c.Images.BaseURL)
+		}
+		if c.Images.Download && c.Images.Workers <= 0 {
+			fail("IMAGES_DOWNLOAD_WORKERS", "must be positive, got %d", c.Images.Workers)
+		}
+		if c.Images.Download && c.Images.MaxBytes <= 0 {
+			fail("IMAGES_MAX_BYTES", "must be positive, got %d", c.Images.MaxBytes)
+		}
+	}
+	if endpoint := c.Tracing.Endpoint; endpoint != "" {
+		if u, err := url.Parse(endpoint); err != nil || u.Scheme == "" || u.Host == "" {
+			fail("OTEL_EXPORTER_OTLP_ENDPOINT", "%q is not an absolute URL", endpoint)
+		}
+		if c.Tracing.Timeout <= 0 {
+			fail("OTEL_EXPORTER_OTLP_TIMEOUT", "must be positive, got %s", c.Tracing.Timeout)
+		}
+	}
+	for _, header := range c.Tracing.Headers {
+		if name, _, ok := strings.Cut(header, "="); !ok || strings.TrimSpace(name) == "" {
+			fail("OTEL_EXPORTER_OTLP_HEADERS", "%q is not a name=value pair", header)
+		}
+	}
+	if c.Sinks.IDMapCacheSize < 0 {
+		fail("ID_MAP_CACHE_SIZE", "must not be negative, got %d", c.Sinks.IDMapCacheSize)
+	}
+	if c.Sinks.ShopifyShop != "" {
+		if c.Sinks.ShopifyAccessToken == "" {
+			fail("SHOPIFY_ACCESS_TOKEN", "is required with SHOPIFY_SHOP")
+		}
+		if c.Sinks.ShopifyRateLimit <= 0 {
+			fail("SHOPIFY_RATE_LIMIT", "must be positive, got %g", c.Sinks.ShopifyRateLimit)
+		}
+	}
+	if c.Anomaly.Factor <= 0 {
+		fail("ANOMALY_FACTOR", "must be positive, got %g", c.Anomaly.Factor)
+	}
+	if base := c.Notify.DiffLinkBaseURL; base != "" {
+		if u, err := url.Parse(base); err != nil || u.Scheme == "" || u.Host == "" {
+			fail("NOTIFY_DIFF_LINK_BASE_URL", "%q is not an absolute URL", base)
+		}
+		if c.Notify.DiffLinkTTL <= 0 {
+			fail("NOTIFY_DIFF_LINK_TTL", "must be positive, got %s", c.Notify.DiffLinkTTL)
+		}
+	}
+
+	if email := c.Notify.Email; email.SMTPHost != "" {
+		if email.SMTPPort <= 0 || email.SMTPPort > 65535 {
+			fail("NOTIFY_SMTP_PORT", "must be a port number, got %d", email.SMTPPort)
+		}
+		if _, err := mail.ParseAddress(email.From); err != nil {
+			fail("NOTIFY_EMAIL_FROM", "%q is not an email address", email.From)
+		}
+		if len(email.To) == 0 {
+			fail("NOTIFY_EMAIL_TO", "is required with NOTIFY_SMTP_HOST")
+		}
+		for _, to := range email.To {
+			if _, err := mail.ParseAddress(to); err != nil {
+				fail("NOTIFY_EMAIL_TO", "%q is not an email address", to)
+			}
+		}
+		if email.ErrorThreshold < 0 {
+			fail("NOTIFY_EMAIL_ERROR_THRESHOLD", "must not be negative, got %d", email.ErrorThreshold)
+		}
+	}
+
+	for i, route := range c.Notify.Routes {
+		field := fmt.Sprintf("NOTIFY_ROUTES[%d]", i)
+		if route.Channel != ChannelSlack && route.Channel != ChannelWebhook {
+			fail(field, "unsupported channel %q", route.Channel)
+		}
+		if route.URL == "" {
+			fail(field, "url is required")
+		}
+		if route.Digest != "" {
+			if d, err := time.ParseDuration(route.Digest); err != nil || d <= 0 {
+				fail(field, "digest %q is not a positive duration", route.Digest)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+// identifierPattern matches the unquoted SQL identifiers Postgres keeps as
+// written: lowercase, at most 63 bytes
+var identifierPattern = regexp.MustCompile(`^[a-z_][a-z0-9_]{0,62}$`)
+
+// ValidIdentifier reports whether s can name a schema or table, such as
+// DATABASE_SCHEMA and DATABASE_PRODUCTS_TABLE
+func ValidIdentifier(s string) bool {
+	return identifierPattern.MatchString(s)
+}
@@ -0,0 +1,110 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"go-cron/models"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runFilter is implemented by notifiers that only want some runs
+type runFilter interface {
+	Wants(run models.SyncRun) bool
+}
+
+// EmailNotifier mails messages to fixed recipients over SMTP. The first line
+// of a rendered message is its subject and the rest its body.
+type EmailNotifier struct {
+	config  models.EmailConfig
+	timeout time.Duration
+}
+
+// NewEmailNotifier creates a new email notifier
+func NewEmailNotifier(config models.EmailConfig) *EmailNotifier {
+	return &EmailNotifier{config: config, timeout: 10 * time.Second}
+}
+
+// Channel returns the notifier channel
+func (n *EmailNotifier) Channel() string {
+	return models.ChannelEmail
+}
+
+// Wants reports whether run is worth an email: it failed, or reported more
+// errors than the threshold
+func (n *EmailNotifier) Wants(run models.SyncRun) bool {
+	if run.Status == models.SyncStatusFailed {
+		return true
+	}
+	return run.Result != nil && len(run.Result.Errors) > n.config.ErrorThreshold
+}
+
+// Send mails body to the recipients, upgrading the connection with STARTTLS
+// when the server offers it
+func (n *EmailNotifier) Send(ctx context.Context, body string) error {
+	ctx, cancel := context.WithTimeout(ctx, n.timeout)
+	defer cancel()
+
+	addr := net.JoinHostPort(n.config.SMTPHost, strconv.Itoa(n.config.SMTPPort))
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	client, err := smtp.NewClient(conn, n.config.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: n.config.SMTPHost}); err != nil {
+			return fmt.Errorf("STARTTLS failed: %w", err)
+		}
+	}
+	if n.config.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", n.config.Username, n.config.Password, n.config.SMTPHost)); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+	if err := client.Mail(n.config.From); err != nil {
+		return err
+	}
+	for _, to := range n.config.To {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("recipient %s rejected: %w", to, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(n.message(body, time.Now())); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// message builds the email of a rendered body
+func (n *EmailNotifier) message(body string, now time.Time) []byte {
+	subject, text, _ := strings.Cut(strings.TrimLeft(body, "\r\n"), "\n")
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", n.config.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(n.config.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", strings.TrimSpace(subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	// SMTP lines end with CRLF
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(strings.TrimLeft(text, "\r\n"), "\r\n", "\n"), "\n", "\r\n"))
+	return []byte(b.String())
+}
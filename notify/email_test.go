@@ -0,0 +1,106 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"go-cron/models"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeSMTP accepts one message on a local port and returns it with its envelope
+func fakeSMTP(t *testing.T) (host string, port int, received <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	messages := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		var transcript strings.Builder
+		fmt.Fprint(conn, "220 fake ESMTP\r\n")
+		inData := false
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			transcript.WriteString(line)
+			switch {
+			case inData && line == ".\r\n":
+				inData = false
+				fmt.Fprint(conn, "250 queued\r\n")
+			case inData:
+			case strings.HasPrefix(line, "EHLO"):
+				fmt.Fprint(conn, "250 fake\r\n")
+			case strings.HasPrefix(line, "DATA"):
+				inData = true
+				fmt.Fprint(conn, "354 go ahead\r\n")
+			case strings.HasPrefix(line, "QUIT"):
+				fmt.Fprint(conn, "221 bye\r\n")
+				messages <- transcript.String()
+				return
+			default:
+				fmt.Fprint(conn, "250 ok\r\n")
+			}
+		}
+	}()
+	addr := ln.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port, messages
+}
+
+// Test_EmailNotifier tests that failed runs are mailed with their errors and
+// status link, and that healthy runs are not
+func Test_EmailNotifier(t *testing.T) {
+	host, port, received := fakeSMTP(t)
+	email := NewEmailNotifier(models.EmailConfig{SMTPHost: host, SMTPPort: port, From: "go-cron@example.com", To: []string{"ops@example.com", "dev@example.com"}, ErrorThreshold: 2})
+	templates, err := LoadTemplates(context.Background(), nil, nil)
+	if err != nil {
+		t.Fatalf("LoadTemplates failed: %v", err)
+	}
+	d := NewDispatcher(templates, email)
+	d.statusURL = "https://cron.example.com/api/status"
+
+	// Two errors don't exceed the threshold
+	d.Notify(context.Background(), models.RunSummary{Run: models.SyncRun{ID: 6, Status: models.SyncStatusDegraded, Result: &models.SyncResult{Errors: []string{"a", "b"}}}})
+	d.Notify(context.Background(), models.RunSummary{Run: models.SyncRun{ID: 7, Status: models.SyncStatusFailed, Error: "login failed", Result: &models.SyncResult{Errors: []string{"item X001: bad group"}}}})
+
+	message := <-received
+	for _, want := range []string{
+		"RCPT TO:<ops@example.com>", "RCPT TO:<dev@example.com>",
+		"Subject: Sync run 7 finished with status failed.",
+		"  - item X001: bad group\r\n", "Error: login failed", "Status: https://cron.example.com/api/status",
+	} {
+		if !strings.Contains(message, want) {
+			t.Errorf("Expected the message to contain %q, got:\n%s", want, message)
+		}
+	}
+	if strings.Contains(message, "run 6") {
+		t.Errorf("Expected the run under the threshold not to be mailed, got:\n%s", message)
+	}
+}
+
+// Test_EmailNotifier_Unreachable tests that a closed SMTP port fails the send
+func Test_EmailNotifier_Unreachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	email := NewEmailNotifier(models.EmailConfig{SMTPHost: "127.0.0.1", SMTPPort: port, From: "a@example.com", To: []string{"b@example.com"}})
+	if err := email.Send(context.Background(), "subject\nbody"); err == nil || !strings.Contains(err.Error(), strconv.Itoa(port)) {
+		t.Errorf("Expected a connection error, got %v", err)
+	}
+}
@@ -0,0 +1,318 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go-cron/internal/utils"
+	"go-cron/models"
+	"go-cron/webhooksig"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Notifier sends a rendered message body over a single channel
+type Notifier interface {
+	Channel() string
+	Send(ctx context.Context, body string) error
+}
+
+// FromConfig builds the list of notifiers enabled in the configuration
+func FromConfig(config *models.AppConfig) []Notifier {
+	var notifiers []Notifier
+	if config.Notify.SlackWebhookURL != "" {
+		notifiers = append(notifiers, NewSlackNotifier(config.Notify.SlackWebhookURL))
+	}
+	if config.Notify.WebhookURL != "" {
+		webhook := NewWebhookNotifier(config.Notify.WebhookURL)
+		webhook.SetSecret(config.Notify.WebhookSecret)
+		notifiers = append(notifiers, webhook)
+	}
+	if config.Notify.Email.SMTPHost != "" {
+		notifiers = append(notifiers, NewEmailNotifier(config.Notify.Email))
+	}
+	return notifiers
+}
+
+// newNotifier creates a notifier for a channel and target URL; webhooks are signed with secret
+func newNotifier(channel, url, secret string) (Notifier, error) {
+	switch channel {
+	case models.ChannelSlack:
+		return NewSlackNotifier(url), nil
+	case models.ChannelWebhook:
+		webhook := NewWebhookNotifier(url)
+		webhook.SetSecret(secret)
+		return webhook, nil
+	default:
+		return nil, fmt.Errorf("unsupported notification channel %q", channel)
+	}
+}
+
+// NewFromConfig builds a dispatcher for the configured notifiers, routes and
+// templates. The template store is only consulted when templates are
+// configured to come from the database.
+func NewFromConfig(ctx context.Context, config *models.AppConfig, store TemplateStore, digests DigestStore) (*Dispatcher, error) {
+	if !config.Notify.TemplatesFromDB {
+		store = nil
+	}
+	templates, err := LoadTemplates(ctx, config.Notify.Templates, store)
+	if err != nil {
+		return nil, err
+	}
+
+	d := NewDispatcher(templates, FromConfig(config)...)
+	d.location = config.Display.Location
+	d.digests = digests
+	if base := config.Notify.DiffLinkBaseURL; base != "" {
+		d.statusURL = base + "/api/status"
+		secret, ttl := config.Auth.CRONSecret, config.Notify.DiffLinkTTL
+		d.SetDiffLinks(func(runID int) string {
+			query := url.Values{"runId": {strconv.Itoa(runID)}, "format": {"csv"}}
+			return utils.SignLink(secret, base, "/api/changes", query, time.Now().Add(ttl))
+		})
+	}
+	for _, rule := range config.Notify.Routes {
+		n, err := newNotifier(rule.Channel, rule.URL, config.Notify.WebhookSecret)
+		if err != nil {
+			return nil, fmt.Errorf("route %s: %w", rule.Name, err)
+		}
+		if err := d.AddRoute(rule, n); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// DigestStore persists digest state and provides the runs to summarize
+type DigestStore interface {
+	GetLastDigestAt(ctx context.Context, route string) (time.Time, error)
+	SetLastDigestAt(ctx context.Context, route string, at time.Time) error
+	ListRunsSince(ctx context.Context, since time.Time) ([]models.SyncRun, error)
+}
+
+// route pairs a routing rule with the notifier of its target
+type route struct {
+	rule     models.NotifyRoute
+	notifier Notifier
+	digest   time.Duration
+}
+
+// Dispatcher renders run summaries with the channel templates and sends them
+// to the notifiers. Without routes every run goes to every notifier; with
+// routes each run only goes to the targets whose rule matches it.
+type Dispatcher struct {
+	templates *Templates
+	notifiers []Notifier
+	routes    []route
+	digests   DigestStore
+	location  *time.Location
+	now       func() time.Time
+	diffLink  func(runID int) string
+	statusURL string
+}
+
+// NewDispatcher creates a new notification dispatcher
+func NewDispatcher(templates *Templates, notifiers ...Notifier) *Dispatcher {
+	return &Dispatcher{templates: templates, notifiers: notifiers, location: time.UTC, now: time.Now}
+}
+
+// SetDiffLinks makes digests link every run to the CSV of its changes built by link
+func (d *Dispatcher) SetDiffLinks(link func(runID int) string) {
+	d.diffLink = link
+}
+
+// AddRoute routes matching runs to a notifier instead of broadcasting them
+func (d *Dispatcher) AddRoute(rule models.NotifyRoute, n Notifier) error {
+	r := route{rule: rule, notifier: n}
+	if rule.Digest != "" {
+		every, err := time.ParseDuration(rule.Digest)
+		if err != nil || every <= 0 {
+			return fmt.Errorf("route %s: invalid digest interval %q", rule.Name, rule.Digest)
+		}
+		r.digest = every
+	}
+	d.routes = append(d.routes, r)
+	return nil
+}
+
+// Notify sends the run summary to the matching targets; failures are logged and do not stop the others
+func (d *Dispatcher) Notify(ctx context.Context, summary models.RunSummary) {
+	if summary.StatusURL == "" {
+		summary.StatusURL = d.statusURL
+	}
+	if len(d.routes) == 0 {
+		for _, n := range d.notifiers {
+			if wants(n, summary.Run) {
+				d.send(ctx, n, n.Channel(), summary)
+			}
+		}
+		return
+	}
+
+	for _, r := range d.routes {
+		if !r.rule.Matches(summary.Run) || !wants(r.notifier, summary.Run) {
+			continue
+		}
+		if r.digest > 0 {
+			d.sendDigest(ctx, r)
+			continue
+		}
+		d.send(ctx, r.notifier, r.notifier.Channel(), summary)
+	}
+}
+
+// wants reports whether n sends a notification for run; notifiers without a
+// filter want every run
+func wants(n Notifier, run models.SyncRun) bool {
+	f, ok := n.(runFilter)
+	return !ok || f.Wants(run)
+}
+
+// sendDigest sends a digest of the route's matching runs once its interval has elapsed
+func (d *Dispatcher) sendDigest(ctx context.Context, r route) {
+	if d.digests == nil {
+		log.Printf("Digest %s skipped: no digest store configured", r.rule.Name)
+		return
+	}
+
+	now := d.now().UTC()
+	last, err := d.digests.GetLastDigestAt(ctx, r.rule.Name)
+	if err != nil {
+		log.Printf("Digest %s skipped: %v", r.rule.Name, err)
+		return
+	}
+	if last.IsZero() {
+		// First matching run opens the digest window
+		if err := d.digests.SetLastDigestAt(ctx, r.rule.Name, now); err != nil {
+			log.Printf("Digest %s: %v", r.rule.Name, err)
+		}
+		return
+	}
+	if now.Sub(last) < r.digest {
+		return
+	}
+
+	runs, err := d.digests.ListRunsSince(ctx, last)
+	if err != nil {
+		log.Printf("Digest %s skipped: %v", r.rule.Name, err)
+		return
+	}
+
+	summary := models.DigestSummary{Route: r.rule.Name, Since: last.In(d.location)}
+	for _, run := range runs {
+		if !r.rule.Matches(run) {
+			continue
+		}
+		summary.Runs = append(summary.Runs, run.In(d.location))
+		if run.Result != nil {
+			summary.Totals.Add(run.Result)
+		}
+		if d.diffLink != nil && run.Result != nil && run.Result.Created+run.Result.Updated > 0 {
+			if summary.DiffLinks == nil {
+				summary.DiffLinks = make(map[int]string)
+			}
+			summary.DiffLinks[run.ID] = d.diffLink(run.ID)
+		}
+	}
+
+	if d.send(ctx, r.notifier, digestTemplate(r.notifier.Channel()), summary) {
+		if err := d.digests.SetLastDigestAt(ctx, r.rule.Name, now); err != nil {
+			log.Printf("Digest %s: %v", r.rule.Name, err)
+		}
+	}
+}
+
+// send renders a template and sends it, reporting whether it was delivered
+func (d *Dispatcher) send(ctx context.Context, n Notifier, templateName string, data interface{}) bool {
+	body, err := d.templates.Render(templateName, data)
+	if err != nil {
+		log.Printf("Notification to %s skipped: %v", n.Channel(), err)
+		return false
+	}
+	if err := n.Send(ctx, body); err != nil {
+		log.Printf("Notification to %s failed: %v", n.Channel(), err)
+		return false
+	}
+	return true
+}
+
+// SlackNotifier posts messages to a Slack incoming webhook
+type SlackNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// NewSlackNotifier creates a new Slack notifier
+func NewSlackNotifier(url string) *SlackNotifier {
+	return &SlackNotifier{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Channel returns the notifier channel
+func (n *SlackNotifier) Channel() string {
+	return models.ChannelSlack
+}
+
+// Send posts the body as the Slack message text
+func (n *SlackNotifier) Send(ctx context.Context, body string) error {
+	payload, err := json.Marshal(map[string]string{"text": body})
+	if err != nil {
+		return err
+	}
+	return post(ctx, n.client, n.url, payload, "")
+}
+
+// WebhookNotifier posts the rendered body as-is to a URL
+type WebhookNotifier struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+// NewWebhookNotifier creates a new webhook notifier
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// SetSecret makes the notifier sign every request with secret (see package webhooksig)
+func (n *WebhookNotifier) SetSecret(secret string) {
+	n.secret = secret
+}
+
+// Channel returns the notifier channel
+func (n *WebhookNotifier) Channel() string {
+	return models.ChannelWebhook
+}
+
+// Send posts the body to the webhook URL
+func (n *WebhookNotifier) Send(ctx context.Context, body string) error {
+	return post(ctx, n.client, n.url, []byte(body), n.secret)
+}
+
+// post sends body as JSON, signing it when secret is set
+func post(ctx context.Context, client *http.Client, url string, body []byte, secret string) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		req.Header.Set(webhooksig.Header, webhooksig.Sign(secret, body, time.Now()))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("notification failed with status %d: %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
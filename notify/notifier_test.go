@@ -0,0 +1,152 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"go-cron/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordingNotifier records the bodies it is asked to send
+type recordingNotifier struct {
+	channel string
+	sent    []string
+}
+
+func (n *recordingNotifier) Channel() string { return n.channel }
+
+func (n *recordingNotifier) Send(ctx context.Context, body string) error {
+	n.sent = append(n.sent, body)
+	return nil
+}
+
+// mockDigestStore keeps digest state and runs in memory
+type mockDigestStore struct {
+	last map[string]time.Time
+	runs []models.SyncRun
+}
+
+func (m *mockDigestStore) GetLastDigestAt(ctx context.Context, route string) (time.Time, error) {
+	return m.last[route], nil
+}
+
+func (m *mockDigestStore) SetLastDigestAt(ctx context.Context, route string, at time.Time) error {
+	m.last[route] = at
+	return nil
+}
+
+func (m *mockDigestStore) ListRunsSince(ctx context.Context, since time.Time) ([]models.SyncRun, error) {
+	var runs []models.SyncRun
+	for _, r := range m.runs {
+		if !r.StartedAt.Before(since) {
+			runs = append(runs, r)
+		}
+	}
+	return runs, nil
+}
+
+func runWith(entity, status string) models.RunSummary {
+	return models.RunSummary{Run: models.SyncRun{Entity: entity, Status: status, Result: &models.SyncResult{Created: 1}}}
+}
+
+// Test_Dispatcher_RoutesByEntityAndOutcome tests that runs only reach matching routes
+func Test_Dispatcher_RoutesByEntityAndOutcome(t *testing.T) {
+	templates, _ := LoadTemplates(context.Background(), map[string]string{models.ChannelSlack: "{{.Run.Entity}} {{.Run.Status}}"}, nil)
+	opsInventory := &recordingNotifier{channel: models.ChannelSlack}
+	ecommerce := &recordingNotifier{channel: models.ChannelSlack}
+
+	d := NewDispatcher(templates)
+	_ = d.AddRoute(models.NotifyRoute{Name: "inventory-failures", Entity: "inventory", Outcomes: []string{models.SyncStatusFailed}}, opsInventory)
+	_ = d.AddRoute(models.NotifyRoute{Name: "products", Entity: models.EntityProducts}, ecommerce)
+
+	ctx := context.Background()
+	d.Notify(ctx, runWith("inventory", models.SyncStatusFailed))
+	d.Notify(ctx, runWith("inventory", models.SyncStatusOK))
+	d.Notify(ctx, runWith(models.EntityProducts, models.SyncStatusOK))
+
+	if len(opsInventory.sent) != 1 || opsInventory.sent[0] != "inventory failed" {
+		t.Errorf("Expected only the inventory failure to reach ops, got %v", opsInventory.sent)
+	}
+	if len(ecommerce.sent) != 1 || ecommerce.sent[0] != "products ok" {
+		t.Errorf("Expected only the product run to reach ecommerce, got %v", ecommerce.sent)
+	}
+}
+
+// Test_Dispatcher_Digest tests that digest routes batch runs until their interval elapses
+func Test_Dispatcher_Digest(t *testing.T) {
+	templates, _ := LoadTemplates(context.Background(), nil, nil)
+	ecommerce := &recordingNotifier{channel: models.ChannelSlack}
+	store := &mockDigestStore{last: map[string]time.Time{}}
+
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+
+	d := NewDispatcher(templates)
+	d.digests = store
+	d.now = func() time.Time { return now }
+	if err := d.AddRoute(models.NotifyRoute{Name: "weekly", Entity: models.EntityProducts, Outcomes: []string{models.SyncStatusOK}, Digest: "168h"}, ecommerce); err != nil {
+		t.Fatalf("AddRoute failed: %v", err)
+	}
+
+	ctx := context.Background()
+	for day := 0; day < 8; day++ {
+		now = start.Add(time.Duration(day) * 24 * time.Hour)
+		run := runWith(models.EntityProducts, models.SyncStatusOK)
+		run.Run.StartedAt = now
+		store.runs = append(store.runs, run.Run)
+		d.Notify(ctx, run)
+	}
+
+	if len(ecommerce.sent) != 1 {
+		t.Fatalf("Expected exactly one digest after a week, got %d: %v", len(ecommerce.sent), ecommerce.sent)
+	}
+	expected := "weekly digest since 2026-03-01: 8 runs, 8 created, 0 updated, 0 unchanged"
+	if ecommerce.sent[0] != expected {
+		t.Errorf("Digest = %q, want %q", ecommerce.sent[0], expected)
+	}
+	if !store.last["weekly"].Equal(now) {
+		t.Errorf("Expected digest window to restart at %v, got %v", now, store.last["weekly"])
+	}
+}
+
+// Test_Dispatcher_InvalidDigest tests that bad digest intervals are rejected
+func Test_Dispatcher_InvalidDigest(t *testing.T) {
+	d := NewDispatcher(nil)
+	if err := d.AddRoute(models.NotifyRoute{Name: "bad", Digest: "weekly"}, &recordingNotifier{}); err == nil {
+		t.Error("Expected an error for an invalid digest interval")
+	}
+}
+
+// Test_Dispatcher_DigestDiffLinks tests that digests link the runs that changed products to their CSV
+func Test_Dispatcher_DigestDiffLinks(t *testing.T) {
+	templates, _ := LoadTemplates(context.Background(), nil, nil)
+	email := &recordingNotifier{channel: models.ChannelEmail}
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	store := &mockDigestStore{
+		last: map[string]time.Time{"weekly": start},
+		runs: []models.SyncRun{
+			{ID: 7, Entity: models.EntityProducts, Status: models.SyncStatusOK, StartedAt: start, Result: &models.SyncResult{Updated: 2}},
+			{ID: 8, Entity: models.EntityProducts, Status: models.SyncStatusOK, StartedAt: start, Result: &models.SyncResult{Unchanged: 5}},
+		},
+	}
+
+	d := NewDispatcher(templates)
+	d.digests = store
+	d.now = func() time.Time { return start.Add(8 * 24 * time.Hour) }
+	d.SetDiffLinks(func(runID int) string { return fmt.Sprintf("https://example.com/changes/%d.csv", runID) })
+	_ = d.AddRoute(models.NotifyRoute{Name: "weekly", Channel: models.ChannelEmail, Digest: "168h"}, email)
+
+	d.Notify(context.Background(), models.RunSummary{Run: store.runs[1]})
+
+	if len(email.sent) != 1 {
+		t.Fatalf("Expected one digest, got %d", len(email.sent))
+	}
+	if !strings.Contains(email.sent[0], "changes (CSV): https://example.com/changes/7.csv") {
+		t.Errorf("Expected a CSV link for run 7, got:\n%s", email.sent[0])
+	}
+	if strings.Contains(email.sent[0], "/8.csv") {
+		t.Errorf("Expected no CSV link for the unchanged run 8, got:\n%s", email.sent[0])
+	}
+}
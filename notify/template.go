@@ -0,0 +1,120 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go-cron/models"
+	"strings"
+	"text/template"
+)
+
+// defaultTemplates are used for channels without a configured template
+var defaultTemplates = map[string]string{
+	models.ChannelSlack: `Sync {{.Run.Status}} ({{.Run.Trigger}}) at {{.Run.StartedAt.Format "2006-01-02 15:04 MST"}} in {{.Duration}}` +
+		`{{with .Run.Result}}: {{.Created}} created, {{.Updated}} updated, {{.Unchanged}} unchanged{{if .Errors}}, {{len .Errors}} errors{{end}}{{end}}` +
+		`{{with .Run.Error}} - {{.}}{{end}}`,
+	models.ChannelWebhook: `{{json .Run}}`,
+	models.ChannelEmail: `Sync run {{.Run.ID}} finished with status {{.Run.Status}}.
+
+Started:  {{.Run.StartedAt.Format "2006-01-02 15:04:05 MST"}}
+Duration: {{.Duration}}
+{{with .Run.Result}}
+Created:   {{.Created}}
+Updated:   {{.Updated}}
+Unchanged: {{.Unchanged}}
+{{if .Errors}}
+Errors:
+{{range .Errors}}  - {{.}}
+{{end}}{{end}}{{end}}{{with .Run.Error}}
+Error: {{.}}
+{{end}}{{with .StatusURL}}
+Status: {{.}}
+{{end}}`,
+	digestTemplate(models.ChannelSlack): `{{.Route}} digest since {{.Since.Format "2006-01-02"}}: {{len .Runs}} runs, ` +
+		`{{.Totals.Created}} created, {{.Totals.Updated}} updated, {{.Totals.Unchanged}} unchanged` +
+		`{{range $id, $link := .DiffLinks}}` + "\n" + `<{{$link}}|Changes of run {{$id}} (CSV)>{{end}}`,
+	digestTemplate(models.ChannelWebhook): `{{json .}}`,
+	digestTemplate(models.ChannelEmail): `{{.Route}} digest since {{.Since.Format "2006-01-02 15:04 MST"}}
+
+Runs:      {{len .Runs}}
+Created:   {{.Totals.Created}}
+Updated:   {{.Totals.Updated}}
+Unchanged: {{.Totals.Unchanged}}
+{{range .Runs}}
+  - run {{.ID}} at {{.StartedAt.Format "2006-01-02 15:04"}}: {{.Status}}{{with index $.DiffLinks .ID}}
+    changes (CSV): {{.}}{{end}}{{end}}
+`,
+}
+
+// digestTemplate returns the template name used for digests on a channel
+func digestTemplate(channel string) string {
+	return channel + "_digest"
+}
+
+var templateFuncs = template.FuncMap{
+	"join": strings.Join,
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// TemplateStore loads notification templates keyed by channel, e.g. from the database
+type TemplateStore interface {
+	GetNotificationTemplates(ctx context.Context) (map[string]string, error)
+}
+
+// Templates renders run summaries into message bodies per channel
+type Templates struct {
+	byChannel map[string]*template.Template
+}
+
+// LoadTemplates builds the templates for every channel. Configured templates
+// override the defaults and templates from the store override both.
+func LoadTemplates(ctx context.Context, configured map[string]string, store TemplateStore) (*Templates, error) {
+	sources := make(map[string]string, len(defaultTemplates))
+	for channel, text := range defaultTemplates {
+		sources[channel] = text
+	}
+	for channel, text := range configured {
+		if text != "" {
+			sources[channel] = text
+		}
+	}
+	if store != nil {
+		stored, err := store.GetNotificationTemplates(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load notification templates: %w", err)
+		}
+		for channel, text := range stored {
+			sources[channel] = text
+		}
+	}
+
+	t := &Templates{byChannel: make(map[string]*template.Template, len(sources))}
+	for channel, text := range sources {
+		tmpl, err := template.New(channel).Funcs(templateFuncs).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s template: %w", channel, err)
+		}
+		t.byChannel[channel] = tmpl
+	}
+	return t, nil
+}
+
+// Render executes a template, keyed by channel (or channel digest), against a
+// models.RunSummary or models.DigestSummary
+func (t *Templates) Render(name string, data interface{}) (string, error) {
+	tmpl, ok := t.byChannel[name]
+	if !ok {
+		return "", fmt.Errorf("no template for %q", name)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render %s template: %w", name, err)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,83 @@
+package notify
+
+import (
+	"context"
+	"go-cron/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mockTemplateStore map[string]string
+
+func (m mockTemplateStore) GetNotificationTemplates(ctx context.Context) (map[string]string, error) {
+	return m, nil
+}
+
+func testSummary() models.RunSummary {
+	return models.RunSummary{
+		Run: models.SyncRun{
+			ID:        7,
+			Trigger:   models.RunTriggerHTTP,
+			Status:    models.SyncStatusOK,
+			StartedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+			Result:    &models.SyncResult{Created: 3, Updated: 2, Unchanged: 10},
+		},
+		Duration: 90 * time.Second,
+		Timezone: "UTC",
+	}
+}
+
+// Test_LoadTemplates_Defaults tests the built-in templates render run summary fields
+func Test_LoadTemplates_Defaults(t *testing.T) {
+	templates, err := LoadTemplates(context.Background(), nil, nil)
+	if err != nil {
+		t.Fatalf("LoadTemplates failed: %v", err)
+	}
+
+	body, err := templates.Render(models.ChannelSlack, testSummary())
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	expected := "Sync ok (http) at 2026-01-02 03:04 UTC in 1m30s: 3 created, 2 updated, 10 unchanged"
+	if body != expected {
+		t.Errorf("Render() = %q, want %q", body, expected)
+	}
+
+	body, err = templates.Render(models.ChannelWebhook, testSummary())
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if !strings.HasPrefix(body, `{"id":7,`) {
+		t.Errorf("Expected webhook body to be the run as JSON, got %s", body)
+	}
+}
+
+// Test_LoadTemplates_Overrides tests that configured templates override defaults and stored ones override both
+func Test_LoadTemplates_Overrides(t *testing.T) {
+	configured := map[string]string{
+		models.ChannelSlack:   "Lauf {{.Run.ID}}: {{.Run.Result.Created}} neu",
+		models.ChannelWebhook: "config webhook",
+	}
+	store := mockTemplateStore{models.ChannelWebhook: "db webhook {{.Run.Status}}"}
+
+	templates, err := LoadTemplates(context.Background(), configured, store)
+	if err != nil {
+		t.Fatalf("LoadTemplates failed: %v", err)
+	}
+
+	if body, _ := templates.Render(models.ChannelSlack, testSummary()); body != "Lauf 7: 3 neu" {
+		t.Errorf("Unexpected slack body: %q", body)
+	}
+	if body, _ := templates.Render(models.ChannelWebhook, testSummary()); body != "db webhook ok" {
+		t.Errorf("Unexpected webhook body: %q", body)
+	}
+}
+
+// Test_LoadTemplates_Invalid tests that broken templates are reported at load time
+func Test_LoadTemplates_Invalid(t *testing.T) {
+	_, err := LoadTemplates(context.Background(), map[string]string{models.ChannelSlack: "{{.Run.Status"}, nil)
+	if err == nil {
+		t.Error("Expected an error for an invalid template")
+	}
+}
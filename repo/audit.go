@@ -0,0 +1,124 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"go-cron/models"
+)
+
+// AuditRepository handles database operations for the per-product change log
+type AuditRepository struct {
+	db    *sql.DB
+	table productsTable
+}
+
+// NewAuditRepository creates a new audit repository
+func NewAuditRepository(db *sql.DB) *AuditRepository {
+	return &AuditRepository{db: db}
+}
+
+// RecordChanges appends changes to the product_changes log in a single transaction.
+// Creates without a product ID are resolved through their handle.
+func (r *AuditRepository) RecordChanges(ctx context.Context, changes []models.ProductChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, r.table.sql(`
+		INSERT INTO product_changes (run_id, product_id, action, old_title, old_handle, new_title, new_handle)
+		VALUES (NULLIF($1, 0),
+		        COALESCE(NULLIF($2, 0), (SELECT id FROM products WHERE handle = $7 LIMIT 1)),
+		        $3, NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, ''))`))
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	progress := newBatchProgress("audit", len(changes), nil)
+	for _, c := range changes {
+		if _, err := stmt.ExecContext(ctx, c.RunID, c.ProductID, c.Action, c.OldTitle, c.OldHandle, c.NewTitle, c.NewHandle); err != nil {
+			return fmt.Errorf("failed to record %s of product %d: %w", c.Action, c.ProductID, err)
+		}
+		if err := progress.row(ctx); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// changeColumns are the product_changes columns read by ListChangesByProduct and ListChangesByRun
+const changeColumns = `id, COALESCE(run_id, 0), COALESCE(product_id, 0), action,
+	COALESCE(old_title, ''), COALESCE(old_handle, ''), COALESCE(new_title, ''), COALESCE(new_handle, ''), changed_at`
+
+// ListChangesByProduct returns up to limit changes of a product, newest first
+func (r *AuditRepository) ListChangesByProduct(ctx context.Context, productID, limit int) ([]models.ProductChange, error) {
+	query := `SELECT ` + changeColumns + ` FROM product_changes WHERE product_id = $1 ORDER BY id DESC LIMIT $2`
+	return r.listChanges(ctx, query, productID, limit)
+}
+
+// ListChangesByRun returns up to limit changes applied by a sync run, in the order they were recorded
+func (r *AuditRepository) ListChangesByRun(ctx context.Context, runID, limit int) ([]models.ProductChange, error) {
+	query := `SELECT ` + changeColumns + ` FROM product_changes WHERE run_id = $1 ORDER BY id LIMIT $2`
+	return r.listChanges(ctx, query, runID, limit)
+}
+
+// changesPage is the number of changes read per query by EachChangeOfRun
+const changesPage = 1000
+
+// EachChangeOfRun calls fn with every change applied by a sync run, in the
+// order they were recorded, a page at a time, so no single query reads the
+// whole log of a large run
+func (r *AuditRepository) EachChangeOfRun(ctx context.Context, runID int, fn func([]models.ProductChange) error) error {
+	query := `SELECT ` + changeColumns + ` FROM product_changes WHERE run_id = $1 AND id > $2 ORDER BY id LIMIT $3`
+	for after := int64(0); ; {
+		changes, err := r.listChanges(ctx, query, runID, after, changesPage)
+		if err != nil || len(changes) == 0 {
+			return err
+		}
+		if err := fn(changes); err != nil {
+			return err
+		}
+		if len(changes) < changesPage {
+			return nil
+		}
+		after = changes[len(changes)-1].ID
+	}
+}
+
+// listChanges scans every change returned by query
+func (r *AuditRepository) listChanges(ctx context.Context, query string, args ...interface{}) ([]models.ProductChange, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query product changes: %w", err)
+	}
+	defer rows.Close()
+
+	var changes []models.ProductChange
+	for rows.Next() {
+		var c models.ProductChange
+		if err := rows.Scan(&c.ID, &c.RunID, &c.ProductID, &c.Action,
+			&c.OldTitle, &c.OldHandle, &c.NewTitle, &c.NewHandle, &c.ChangedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan product change: %w", err)
+		}
+		c.ChangedAt = c.ChangedAt.UTC()
+		changes = append(changes, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating product changes: %w", err)
+	}
+
+	return changes, nil
+}
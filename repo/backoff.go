@@ -0,0 +1,89 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"go-cron/models"
+	"time"
+)
+
+// BackoffRepository persists the backoff state of upstreams across invocations
+type BackoffRepository struct {
+	db *sql.DB
+}
+
+// NewBackoffRepository creates a new backoff repository
+func NewBackoffRepository(db *sql.DB) *BackoffRepository {
+	return &BackoffRepository{db: db}
+}
+
+// GetBackoff returns the backoff state of source, or nil when its last attempt succeeded
+func (r *BackoffRepository) GetBackoff(ctx context.Context, source string) (*models.BackoffState, error) {
+	state := models.BackoffState{Source: source}
+	var lastError sql.NullString
+	err := r.db.QueryRowContext(ctx,
+		`SELECT failures, next_attempt_at, last_error FROM sync_backoff WHERE source = $1`, source).
+		Scan(&state.Failures, &state.NextAttemptAt, &lastError)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query backoff state: %w", err)
+	}
+	state.NextAttemptAt, state.LastError = state.NextAttemptAt.UTC(), lastError.String
+	return &state, nil
+}
+
+// RecordFailure counts a failed attempt to reach source at now and pushes its
+// next allowed attempt back by BackoffDelay, returning the new state
+func (r *BackoffRepository) RecordFailure(ctx context.Context, source, lastError string, base, max time.Duration, now time.Time) (*models.BackoffState, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	state := models.BackoffState{Source: source, LastError: lastError}
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO sync_backoff (source, failures, next_attempt_at, last_error)
+		VALUES ($1, 1, $2, $3)
+		ON CONFLICT (source) DO UPDATE
+		SET failures = sync_backoff.failures + 1, last_error = EXCLUDED.last_error
+		RETURNING failures`, source, now.UTC(), lastError).Scan(&state.Failures)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record backoff failure: %w", err)
+	}
+
+	state.NextAttemptAt = now.Add(BackoffDelay(base, max, state.Failures)).UTC()
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE sync_backoff SET next_attempt_at = $2 WHERE source = $1`, source, state.NextAttemptAt); err != nil {
+		return nil, fmt.Errorf("failed to record backoff failure: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return &state, nil
+}
+
+// ResetBackoff clears the backoff state of source after a successful attempt
+func (r *BackoffRepository) ResetBackoff(ctx context.Context, source string) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM sync_backoff WHERE source = $1`, source); err != nil {
+		return fmt.Errorf("failed to reset backoff state: %w", err)
+	}
+	return nil
+}
+
+// BackoffDelay returns how long to wait after the given number of consecutive
+// failures: base after the first one, doubling with each further one up to max
+func BackoffDelay(base, max time.Duration, failures int) time.Duration {
+	delay := base
+	for i := 1; i < failures && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		return max
+	}
+	return delay
+}
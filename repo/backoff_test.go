@@ -0,0 +1,25 @@
+package repo
+
+import (
+	"testing"
+	"time"
+)
+
+// Test_BackoffDelay tests the doubling of the backoff delay and its cap
+func Test_BackoffDelay(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{4, 8 * time.Minute},
+		{6, 30 * time.Minute},
+		{1000, 30 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := BackoffDelay(time.Minute, 30*time.Minute, tt.failures); got != tt.want {
+			t.Errorf("BackoffDelay after %d failures = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+}
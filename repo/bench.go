@@ -0,0 +1,115 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"go-cron/models"
+	"time"
+)
+
+// benchHandlePrefix marks the products written by BenchmarkBatchSizes, which
+// removes them when it is done
+const benchHandlePrefix = "gocron-bench-"
+
+// BenchOptions configures BenchmarkBatchSizes
+type BenchOptions struct {
+	// Sizes are the batch sizes measured, in order
+	Sizes []int
+	// Rows is the number of products inserted then updated at every size
+	Rows int
+	// Workers is the number of update chunks applied at once
+	Workers int
+}
+
+// BenchmarkBatchSizes measures the throughput of the bulk writes of a sync at
+// every batch size: it inserts opts.Rows synthetic products through writer
+// with products creating chunks of that size, updates them in chunks of that
+// size, then deletes them. The synthetic products never outlive the call.
+func BenchmarkBatchSizes(ctx context.Context, products *ProductRepository, writer ProductRepositoryInterface, opts BenchOptions) ([]models.BatchBenchmark, error) {
+	// Leftovers of an interrupted benchmark would collide with the new handles
+	defer products.deleteBenchProducts(context.WithoutCancel(ctx))
+	if err := products.deleteBenchProducts(ctx); err != nil {
+		return nil, err
+	}
+
+	var results []models.BatchBenchmark
+	for _, size := range opts.Sizes {
+		products.SetCreateChunks(size, false)
+		products.SetUpdateParallelism(size, opts.Workers)
+		result := models.BatchBenchmark{BatchSize: size, Rows: opts.Rows}
+
+		creates := make([]struct{ Title, Handle string }, opts.Rows)
+		for i := range creates {
+			creates[i].Title = fmt.Sprintf("Benchmark product %d-%d", size, i)
+			creates[i].Handle = fmt.Sprintf("%s%d-%d", benchHandlePrefix, size, i)
+		}
+		start := time.Now()
+		if err := writer.CreateProductsBatch(ctx, creates); err != nil {
+			return results, fmt.Errorf("batch size %d: %w", size, err)
+		}
+		result.InsertMs, result.InsertRowsPerSec = throughput(opts.Rows, time.Since(start))
+
+		ids, err := products.benchProductIDs(ctx)
+		if err != nil {
+			return results, err
+		}
+		updates := make([]struct {
+			ID      int
+			Title   string
+			Handle  string
+			Fields  ProductFields
+			Version int
+		}, len(ids))
+		for i, id := range ids {
+			updates[i].ID = id
+			updates[i].Title = fmt.Sprintf("Benchmark product %d-%d updated", size, i)
+			updates[i].Handle = fmt.Sprintf("%s%d-%d-updated", benchHandlePrefix, size, i)
+		}
+		start = time.Now()
+		if _, err := writer.UpdateProductsBatch(ctx, updates); err != nil {
+			return results, fmt.Errorf("batch size %d: %w", size, err)
+		}
+		result.UpdateMs, result.UpdateRowsPerSec = throughput(len(updates), time.Since(start))
+
+		if err := products.deleteBenchProducts(ctx); err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// throughput returns the duration of writing rows in milliseconds and the rows written per second
+func throughput(rows int, d time.Duration) (int64, float64) {
+	if d <= 0 {
+		return 0, 0
+	}
+	return d.Milliseconds(), float64(rows) / d.Seconds()
+}
+
+// benchProductIDs returns the IDs of the synthetic products in order
+func (r *ProductRepository) benchProductIDs(ctx context.Context) ([]int, error) {
+	rows, err := r.db.QueryContext(ctx, r.table.sql(`SELECT id FROM products WHERE handle LIKE $1 ORDER BY id`), benchHandlePrefix+"%")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query benchmark products: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan benchmark product: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// deleteBenchProducts removes the synthetic products
+func (r *ProductRepository) deleteBenchProducts(ctx context.Context) error {
+	if _, err := r.db.ExecContext(ctx, r.table.sql(`DELETE FROM products WHERE handle LIKE $1`), benchHandlePrefix+"%"); err != nil {
+		return fmt.Errorf("failed to delete benchmark products: %w", err)
+	}
+	return nil
+}
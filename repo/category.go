@@ -0,0 +1,47 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"go-cron/models"
+)
+
+// CategoryRepository reads the mapping of item group codes to the categories
+// stored on products
+type CategoryRepository struct {
+	db *sql.DB
+}
+
+// NewCategoryRepository creates a new category repository
+func NewCategoryRepository(db *sql.DB) *CategoryRepository {
+	return &CategoryRepository{db: db}
+}
+
+// GetCategoryMap returns the category of every mapped item group code
+func (r *CategoryRepository) GetCategoryMap(ctx context.Context) (map[int]string, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT group_code, category FROM item_group_categories`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query item group categories: %w", err)
+	}
+	defer rows.Close()
+
+	categories := make(map[int]string)
+	for rows.Next() {
+		var code int
+		var category string
+		if err := rows.Scan(&code, &category); err != nil {
+			return nil, fmt.Errorf("failed to scan item group category: %w", err)
+		}
+		categories[code] = category
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating item group categories: %w", err)
+	}
+	return categories, nil
+}
+
+// itemCategory returns the category of the item's group, empty when unmapped
+func itemCategory(categories map[int]string, item models.ExternalItem) string {
+	return categories[item.ItemsGroupCode]
+}
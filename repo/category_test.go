@@ -0,0 +1,66 @@
+package repo
+
+import (
+	"context"
+	"go-cron/models"
+	"reflect"
+	"testing"
+)
+
+// Test_SyncService_CompareAndSync_Categories tests that categories are derived
+// from item groups, diffed like other fields and stored by product ID
+func Test_SyncService_CompareAndSync_Categories(t *testing.T) {
+	var saved map[int]string
+	mockRepo := &MockProductRepository{
+		GetAllProductsFunc: func(ctx context.Context) ([]models.Product, error) {
+			return []models.Product{
+				{ID: 1, Title: "Green Tea", Handle: "green-tea", Status: models.ProductStatusActive, Category: "Beverages"},
+				{ID: 2, Title: "Cola", Handle: "cola", Status: models.ProductStatusActive, Category: "Beverages"},
+			}, nil
+		},
+		GetProductsByTitlesFunc: func(ctx context.Context, titles []string) ([]models.Product, error) {
+			return []models.Product{{ID: 3, Title: "Black Tea", Handle: "black-tea", Status: models.ProductStatusActive}}, nil
+		},
+		SaveCategoriesFunc: func(ctx context.Context, categories map[int]string) ([]int, error) {
+			saved = categories
+			var changed []int
+			for id := range categories {
+				changed = append(changed, id)
+			}
+			return changed, nil
+		},
+	}
+	syncService := NewSyncService(mockRepo)
+	syncService.SetCategories(map[int]string{100: "Beverages", 101: "Tea"})
+
+	items := []models.ExternalItem{
+		{ItemCode: "T1", ItemName: "Green Tea", ItemsGroupCode: 101},
+		{ItemCode: "C1", ItemName: "Cola", ItemsGroupCode: 100},
+		{ItemCode: "M1", ItemName: "Mug", ItemsGroupCode: 200},
+		{ItemCode: "B1", ItemName: "Black Tea", ItemsGroupCode: 101},
+	}
+	result, err := syncService.CompareAndSync(context.Background(), items)
+	if err != nil {
+		t.Fatalf("CompareAndSync failed: %v", err)
+	}
+
+	// The unmapped group gets no category and needs no save
+	expected := map[int]string{1: "Tea", 3: "Tea"}
+	if !reflect.DeepEqual(saved, expected) {
+		t.Errorf("Expected categories %v, got %v", expected, saved)
+	}
+	if result.Updated != 1 || result.Unchanged != 1 || result.Created != 2 {
+		t.Errorf("Expected 1 recategorized, 1 unchanged and 2 created products, got %+v", result)
+	}
+
+	// Dry runs report the category change
+	syncService.SetDryRun(true)
+	result, err = syncService.CompareAndSync(context.Background(), items[:1])
+	if err != nil {
+		t.Fatalf("CompareAndSync failed: %v", err)
+	}
+	want := []models.FieldChange{{Field: models.FieldCategory, Old: "Beverages", New: "Tea"}}
+	if len(result.Diffs) != 1 || result.Diffs[0].Action != models.ChangeActionUpdate || !reflect.DeepEqual(result.Diffs[0].Fields, want) {
+		t.Errorf("Expected a category update, got %+v", result.Diffs)
+	}
+}
@@ -0,0 +1,112 @@
+package repo
+
+import (
+	"go-cron/models"
+	"strings"
+)
+
+// Dialect is the SQL flavour of a database other than Postgres, written by
+// SQLProductRepository with ? placeholders
+type Dialect string
+
+// Dialects of SQLProductRepository
+const (
+	DialectMySQL  Dialect = models.DatabaseDialectMySQL
+	DialectSQLite Dialect = models.DatabaseDialectSQLite
+)
+
+// maxInParams bounds the placeholders of an IN list; older SQLite builds
+// reject statements with more than 999 parameters
+const maxInParams = 500
+
+// insertIgnore returns the statement prefix inserting rows unless they break a unique key
+func (d Dialect) insertIgnore() string {
+	if d == DialectMySQL {
+		return "INSERT IGNORE INTO"
+	}
+	return "INSERT OR IGNORE INTO"
+}
+
+// distinct returns a comparison of a and b that treats NULLs as equal values
+func (d Dialect) distinct(a, b string) string {
+	if d == DialectMySQL {
+		return "NOT (" + a + " <=> " + b + ")"
+	}
+	return a + " IS NOT " + b
+}
+
+// productsSchema returns the DDL of the products table
+func (d Dialect) productsSchema() []string {
+	if d == DialectMySQL {
+		return []string{`
+		CREATE TABLE IF NOT EXISTS products (
+			id             INT AUTO_INCREMENT PRIMARY KEY,
+			title          VARCHAR(512) NOT NULL,
+			handle         VARCHAR(255) UNIQUE,
+			status         VARCHAR(32) NOT NULL DEFAULT 'active',
+			archived_at    DATETIME NULL,
+			category       VARCHAR(255),
+			raw_title      TEXT,
+			price          DECIMAL(19, 6),
+			currency       VARCHAR(16),
+			image_url      TEXT,
+			created_at     DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at     DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			last_synced_at DATETIME NULL,
+			version        INT NOT NULL DEFAULT 1,
+			locked         BOOLEAN NOT NULL DEFAULT FALSE,
+			missing_since  DATETIME NULL,
+			missing_runs   INT NOT NULL DEFAULT 0
+		)`}
+	}
+	return []string{`
+		CREATE TABLE IF NOT EXISTS products (
+			id             INTEGER PRIMARY KEY AUTOINCREMENT,
+			title          TEXT NOT NULL,
+			handle         TEXT UNIQUE,
+			status         TEXT NOT NULL DEFAULT 'active',
+			archived_at    TIMESTAMP,
+			category       TEXT,
+			raw_title      TEXT,
+			price          NUMERIC,
+			currency       TEXT,
+			image_url      TEXT,
+			created_at     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			last_synced_at TIMESTAMP,
+			version        INTEGER NOT NULL DEFAULT 1,
+			locked         BOOLEAN NOT NULL DEFAULT FALSE,
+			missing_since  TIMESTAMP,
+			missing_runs   INTEGER NOT NULL DEFAULT 0
+		)`,
+		`CREATE INDEX IF NOT EXISTS products_title_key ON products (LOWER(TRIM(title)))`,
+	}
+}
+
+// inList returns the placeholders of an IN list of n values and the values as arguments
+func inList(ids []int) (string, []interface{}) {
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return "(" + strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ") + ")", args
+}
+
+// idChunks splits ids into slices of at most maxInParams
+func idChunks(ids []int) [][]int {
+	var chunks [][]int
+	for len(ids) > maxInParams {
+		chunks = append(chunks, ids[:maxInParams])
+		ids = ids[maxInParams:]
+	}
+	if len(ids) > 0 {
+		chunks = append(chunks, ids)
+	}
+	return chunks
+}
+
+// escapeLikeBang escapes the LIKE wildcards in s with '!', which, unlike a
+// backslash, needs no escaping in MySQL string literals
+func escapeLikeBang(s string) string {
+	return strings.NewReplacer(`!`, `!!`, `%`, `!%`, `_`, `!_`).Replace(s)
+}
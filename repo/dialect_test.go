@@ -0,0 +1,172 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Test_Dialect tests the statements that differ between MySQL and SQLite
+func Test_Dialect(t *testing.T) {
+	if got := DialectMySQL.insertIgnore(); got != "INSERT IGNORE INTO" {
+		t.Errorf("Unexpected MySQL insert: %q", got)
+	}
+	if got := DialectSQLite.insertIgnore(); got != "INSERT OR IGNORE INTO" {
+		t.Errorf("Unexpected SQLite insert: %q", got)
+	}
+	if got := DialectMySQL.distinct("title", "?"); got != "NOT (title <=> ?)" {
+		t.Errorf("Unexpected MySQL comparison: %q", got)
+	}
+	if got := DialectSQLite.distinct("title", "?"); got != "title IS NOT ?" {
+		t.Errorf("Unexpected SQLite comparison: %q", got)
+	}
+	if got := escapeLikeBang("50%_off!"); got != "50!%!_off!!" {
+		t.Errorf("Unexpected LIKE escape: %q", got)
+	}
+}
+
+// recordedExec is a statement run through the recording driver
+type recordedExec struct {
+	query string
+	args  []driver.Value
+}
+
+// recordingDriver accepts every statement, reporting one affected row, and
+// records it; queries return no rows, or fail with queryErr when set
+type recordingDriver struct {
+	mu       sync.Mutex
+	execs    []recordedExec
+	queryErr error
+}
+
+func (d *recordingDriver) Open(string) (driver.Conn, error) { return recordingConn{d}, nil }
+
+type recordingConn struct{ d *recordingDriver }
+
+func (c recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return recordingStmt{c.d, query}, nil
+}
+func (c recordingConn) Close() error              { return nil }
+func (c recordingConn) Begin() (driver.Tx, error) { return recordingTx{}, nil }
+
+type recordingTx struct{}
+
+func (recordingTx) Commit() error   { return nil }
+func (recordingTx) Rollback() error { return nil }
+
+type recordingStmt struct {
+	d     *recordingDriver
+	query string
+}
+
+func (s recordingStmt) Close() error  { return nil }
+func (s recordingStmt) NumInput() int { return -1 }
+func (s recordingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	s.d.execs = append(s.d.execs, recordedExec{query: s.query, args: args})
+	return driver.RowsAffected(1), nil
+}
+func (s recordingStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	if s.d.queryErr != nil {
+		return nil, s.d.queryErr
+	}
+	return recordingRows{}, nil
+}
+
+type recordingRows struct{}
+
+func (recordingRows) Columns() []string              { return nil }
+func (recordingRows) Close() error                   { return nil }
+func (recordingRows) Next(dest []driver.Value) error { return io.EOF }
+
+var recorder = &recordingDriver{}
+
+func init() {
+	sql.Register("recording", recorder)
+}
+
+// Test_SQLProductRepository_Writes tests the arguments of the portable writes
+// and that long ID lists are split into chunks
+func Test_SQLProductRepository_Writes(t *testing.T) {
+	db, err := sql.Open("recording", "")
+	if err != nil {
+		t.Fatalf("failed to open the recording driver: %v", err)
+	}
+	defer db.Close()
+	r := NewSQLProductRepository(db, DialectSQLite)
+	ctx := context.Background()
+
+	recorder.execs = nil
+	ids := make([]int, maxInParams+1)
+	for i := range ids {
+		ids[i] = i + 1
+	}
+	reactivated, err := r.ReactivateProductsBatch(ctx, ids)
+	if err != nil || reactivated != 2 {
+		t.Fatalf("Expected two chunks of one recorded row each, got %d (%v)", reactivated, err)
+	}
+	last := recorder.execs[1]
+	if want := []driver.Value{"active", "active", int64(maxInParams + 1)}; !reflect.DeepEqual(last.args, want) {
+		t.Errorf("Expected the arguments %v, got %v", want, last.args)
+	}
+
+	recorder.execs = nil
+	archived, err := r.ArchiveProductsBatch(ctx, []int{5, 3})
+	if err != nil || !reflect.DeepEqual(archived, []int{5, 3}) {
+		t.Fatalf("Expected both IDs archived, got %v (%v)", archived, err)
+	}
+	if got := recorder.execs[1].args; !reflect.DeepEqual(got, []driver.Value{"archived", int64(3), "archived"}) {
+		t.Errorf("Unexpected archive arguments %v", got)
+	}
+
+	recorder.execs = nil
+	changed, err := r.SaveCategories(ctx, map[int]string{2: "Drinks", 1: ""})
+	if err != nil {
+		t.Fatalf("SaveCategories failed: %v", err)
+	}
+	if !reflect.DeepEqual(changed, []int{1, 2}) {
+		t.Errorf("Expected both IDs in order, got %v", changed)
+	}
+	if got := recorder.execs[1].args; !reflect.DeepEqual(got, []driver.Value{"Drinks", int64(2), "Drinks"}) {
+		t.Errorf("Unexpected category arguments %v", got)
+	}
+	if !strings.HasPrefix(strings.TrimSpace(recorder.execs[0].query), "UPDATE products SET category") {
+		t.Errorf("Unexpected category statement %q", recorder.execs[0].query)
+	}
+}
+
+// Test_SQLProductRepository_PartialUpdates tests that updates only write their columns
+func Test_SQLProductRepository_PartialUpdates(t *testing.T) {
+	db, err := sql.Open("recording", "")
+	if err != nil {
+		t.Fatalf("failed to open the recording driver: %v", err)
+	}
+	defer db.Close()
+	r := NewSQLProductRepository(db, DialectSQLite)
+
+	recorder.execs = nil
+	_, err = r.UpdateProductsBatch(context.Background(), []productUpdate{
+		{ID: 1, Title: "Tea", Handle: "tea", Fields: UpdateHandle, Version: 3},
+		{ID: 2, Title: "Mug", Handle: "mug"},
+	})
+	if err != nil {
+		t.Fatalf("UpdateProductsBatch failed: %v", err)
+	}
+	if got, want := recorder.execs[0].query, "UPDATE products SET handle = ?, updated_at = CURRENT_TIMESTAMP, version = version + 1 WHERE id = ? AND version = ? AND (handle IS NOT ?)"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+	if got := recorder.execs[0].args; !reflect.DeepEqual(got, []driver.Value{"tea", int64(1), int64(3), "tea"}) {
+		t.Errorf("Unexpected handle arguments %v", got)
+	}
+	if got := recorder.execs[1].args; !reflect.DeepEqual(got, []driver.Value{"Mug", "mug", int64(2), "Mug", "mug"}) {
+		t.Errorf("Expected every column without fields, got %v", got)
+	}
+}
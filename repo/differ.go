@@ -0,0 +1,129 @@
+package repo
+
+import (
+	"go-cron/models"
+	"strconv"
+)
+
+// productField is a product field compared by the Differ
+type productField struct {
+	name  string
+	value func(models.Product) string
+	// update marks the fields whose change is an update: the ones written by
+	// UpdateProductsBatch and the category. The status is changed by
+	// reactivation instead.
+	update bool
+}
+
+// Differ compares the stored version of a product with the version an
+// external item asks for, field by field. Its diffs drive the update
+// decisions of CompareAndSync and are reported by dry runs, so a synced
+// field only needs to be declared here to be compared everywhere.
+type Differ struct {
+	fields []productField
+}
+
+// NewDiffer creates a differ for the synced product fields
+func NewDiffer() *Differ {
+	return &Differ{fields: []productField{
+		{name: models.FieldTitle, value: func(p models.Product) string { return p.Title }, update: true},
+		{name: models.FieldHandle, value: func(p models.Product) string { return p.Handle }, update: true},
+		{name: models.FieldStatus, value: productStatus},
+	}}
+}
+
+// categoryField compares the categories derived from item groups
+var categoryField = productField{name: models.FieldCategory, value: func(p models.Product) string { return p.Category }, update: true}
+
+// priceField compares the prices of the synced price list with their currency
+var priceField = productField{name: models.FieldPrice, value: productPrice, update: true}
+
+// productPrice formats the price of p with its currency, empty without a price
+func productPrice(p models.Product) string {
+	if p.Price == nil {
+		return ""
+	}
+	price := strconv.FormatFloat(*p.Price, 'f', -1, 64)
+	if p.Currency != "" {
+		price += " " + p.Currency
+	}
+	return price
+}
+
+// imageField compares the picture URLs
+var imageField = productField{name: models.FieldImage, value: func(p models.Product) string { return p.Image }, update: true}
+
+// track adds a field to the compared ones
+func (d *Differ) track(f productField) {
+	d.fields = append(d.fields, f)
+}
+
+// productStatus returns the status of p, products without one being active
+func productStatus(p models.Product) string {
+	if p.Status == "" {
+		return models.ProductStatusActive
+	}
+	return p.Status
+}
+
+// Diff lists the fields whose value differs between existing and desired, in
+// declaration order. Without an existing product every field of desired is new.
+func (d *Differ) Diff(existing *models.Product, desired models.Product) []models.FieldChange {
+	var changes []models.FieldChange
+	for _, f := range d.fields {
+		old, new := "", f.value(desired)
+		if existing != nil {
+			old = f.value(*existing)
+		}
+		if old != new {
+			changes = append(changes, models.FieldChange{Field: f.name, Old: old, New: new})
+		}
+	}
+	return changes
+}
+
+// NeedsUpdate reports whether changes include a field changed by an update
+func (d *Differ) NeedsUpdate(changes []models.FieldChange) bool {
+	for _, c := range changes {
+		for _, f := range d.fields {
+			if f.name == c.Field && f.update {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// DiffItem plans the change of item given the product its title matched, if
+// any: a create without a product, a reactivation when it is archived, an
+// update when a field written by updates differs, and unchanged otherwise.
+// desired is the product the item asks for.
+func (d *Differ) DiffItem(item models.ExternalItem, existing *models.Product, desired models.Product) models.ItemDiff {
+	diff := models.ItemDiff{ItemCode: item.ItemCode, Title: desired.Title, Fields: d.Diff(existing, desired)}
+	switch {
+	case existing == nil:
+		diff.Action = models.ChangeActionCreate
+		return diff
+	case existing.Archived():
+		diff.Action = models.ChangeActionReactivate
+	case d.NeedsUpdate(diff.Fields):
+		diff.Action = models.ChangeActionUpdate
+	default:
+		diff.Action = models.ItemActionUnchanged
+	}
+	diff.ProductID = existing.ID
+	return diff
+}
+
+// maxReportedDiffs bounds the diffs a dry run reports, keeping responses for
+// a first sync of a large catalog readable
+const maxReportedDiffs = 1000
+
+// reportDiff adds a planned change to the result of a dry run
+func reportDiff(result *models.SyncResult, diff models.ItemDiff) {
+	if len(result.Diffs) >= maxReportedDiffs {
+		result.DiffsOmitted++
+		return
+	}
+	result.Diffs = append(result.Diffs, diff)
+}
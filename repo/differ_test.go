@@ -0,0 +1,99 @@
+package repo
+
+import (
+	"context"
+	"go-cron/models"
+	"reflect"
+	"testing"
+)
+
+// Test_Differ_DiffItem tests the planned action and field changes of an item
+func Test_Differ_DiffItem(t *testing.T) {
+	differ := NewDiffer()
+	item := models.ExternalItem{ItemCode: "A1", ItemName: "Blue Shirt"}
+	desired := models.Product{Title: "Blue Shirt", Handle: "blue-shirt", Status: models.ProductStatusActive}
+
+	tests := []struct {
+		name     string
+		existing *models.Product
+		action   string
+		fields   []models.FieldChange
+	}{
+		{
+			name:   "new product",
+			action: models.ChangeActionCreate,
+			fields: []models.FieldChange{
+				{Field: models.FieldTitle, New: "Blue Shirt"},
+				{Field: models.FieldHandle, New: "blue-shirt"},
+				{Field: models.FieldStatus, New: models.ProductStatusActive},
+			},
+		},
+		{
+			name:     "unchanged product without a status",
+			existing: &models.Product{ID: 1, Title: "Blue Shirt", Handle: "blue-shirt"},
+			action:   models.ItemActionUnchanged,
+		},
+		{
+			name:     "renamed handle",
+			existing: &models.Product{ID: 2, Title: "Blue Shirt", Handle: "old", Status: models.ProductStatusActive},
+			action:   models.ChangeActionUpdate,
+			fields:   []models.FieldChange{{Field: models.FieldHandle, Old: "old", New: "blue-shirt"}},
+		},
+		{
+			name:     "archived product",
+			existing: &models.Product{ID: 3, Title: "Blue Shirt", Handle: "blue-shirt", Status: models.ProductStatusArchived},
+			action:   models.ChangeActionReactivate,
+			fields:   []models.FieldChange{{Field: models.FieldStatus, Old: models.ProductStatusArchived, New: models.ProductStatusActive}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff := differ.DiffItem(item, tt.existing, desired)
+			if diff.Action != tt.action {
+				t.Errorf("Expected action %q, got %q", tt.action, diff.Action)
+			}
+			if !reflect.DeepEqual(diff.Fields, tt.fields) {
+				t.Errorf("Expected fields %+v, got %+v", tt.fields, diff.Fields)
+			}
+			if tt.existing != nil && diff.ProductID != tt.existing.ID {
+				t.Errorf("Expected product %d, got %d", tt.existing.ID, diff.ProductID)
+			}
+		})
+	}
+}
+
+// Test_SyncService_CompareAndSync_DryRunDiffs tests that dry runs report their planned changes field by field
+func Test_SyncService_CompareAndSync_DryRunDiffs(t *testing.T) {
+	mockRepo := &MockProductRepository{
+		GetAllProductsFunc: func(ctx context.Context) ([]models.Product, error) {
+			return []models.Product{
+				{ID: 1, Title: "Product A", Handle: "old-handle", Status: models.ProductStatusActive},
+				{ID: 2, Title: "Product B", Handle: "product-b", Status: models.ProductStatusActive},
+			}, nil
+		},
+	}
+	syncService := NewSyncService(mockRepo)
+	syncService.SetDryRun(true)
+
+	result, err := syncService.CompareAndSync(context.Background(), []models.ExternalItem{
+		{ItemCode: "A", ItemName: "Product A"},
+		{ItemCode: "B", ItemName: "Product B"},
+		{ItemCode: "C", ItemName: "Product C"},
+	})
+	if err != nil {
+		t.Fatalf("CompareAndSync failed: %v", err)
+	}
+
+	if len(result.Diffs) != 2 {
+		t.Fatalf("Expected diffs for the update and the create only, got %+v", result.Diffs)
+	}
+	update, create := result.Diffs[0], result.Diffs[1]
+	if update.ItemCode != "A" || update.Action != models.ChangeActionUpdate || update.ProductID != 1 ||
+		!reflect.DeepEqual(update.Fields, []models.FieldChange{{Field: models.FieldHandle, Old: "old-handle", New: "product-a"}}) {
+		t.Errorf("Unexpected update diff: %+v", update)
+	}
+	if create.ItemCode != "C" || create.Action != models.ChangeActionCreate {
+		t.Errorf("Unexpected create diff: %+v", create)
+	}
+}
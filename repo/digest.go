@@ -0,0 +1,46 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// DigestRepository tracks when each notification digest was last sent and
+// provides the runs to summarize in the next one
+type DigestRepository struct {
+	*RunRepository
+}
+
+// NewDigestRepository creates a new digest repository
+func NewDigestRepository(db *sql.DB) *DigestRepository {
+	return &DigestRepository{RunRepository: NewRunRepository(db)}
+}
+
+// GetLastDigestAt returns when the digest of a route was last sent, or the zero time if never
+func (r *DigestRepository) GetLastDigestAt(ctx context.Context, route string) (time.Time, error) {
+	var lastSentAt time.Time
+	err := r.db.QueryRowContext(ctx,
+		`SELECT last_sent_at FROM notification_digests WHERE route = $1`, route).Scan(&lastSentAt)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to query notification digest: %w", err)
+	}
+	return lastSentAt.UTC(), nil
+}
+
+// SetLastDigestAt records when the digest of a route was sent
+func (r *DigestRepository) SetLastDigestAt(ctx context.Context, route string, at time.Time) error {
+	query := `
+		INSERT INTO notification_digests (route, last_sent_at)
+		VALUES ($1, $2)
+		ON CONFLICT (route) DO UPDATE SET last_sent_at = EXCLUDED.last_sent_at`
+
+	if _, err := r.db.ExecContext(ctx, query, route, at.UTC()); err != nil {
+		return fmt.Errorf("failed to record notification digest: %w", err)
+	}
+	return nil
+}
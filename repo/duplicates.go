@@ -0,0 +1,184 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"go-cron/models"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// duplicateGroup is a set of database products sharing a title key or a handle
+type duplicateGroup struct {
+	// by is the shared field, models.FieldTitle or models.FieldHandle
+	by       string
+	key      string
+	products []*models.Product
+}
+
+// findDuplicates groups the products sharing a title key, then the products
+// sharing a non-empty handle, each in the order of their first product.
+// titleKeys holds the title key of each product.
+func findDuplicates(products []models.Product, titleKeys []string) []duplicateGroup {
+	fields := []struct {
+		by  string
+		key func(i int) string
+	}{
+		{models.FieldTitle, func(i int) string { return titleKeys[i] }},
+		{models.FieldHandle, func(i int) string { return products[i].Handle }},
+	}
+
+	var duplicates []duplicateGroup
+	for _, f := range fields {
+		index := make(map[string]int)
+		var groups []duplicateGroup
+		for i := range products {
+			key := f.key(i)
+			if key == "" {
+				continue
+			}
+			if j, ok := index[key]; ok {
+				groups[j].products = append(groups[j].products, &products[i])
+				continue
+			}
+			index[key] = len(groups)
+			groups = append(groups, duplicateGroup{by: f.by, key: key, products: []*models.Product{&products[i]}})
+		}
+		for _, g := range groups {
+			if len(g.products) > 1 {
+				duplicates = append(duplicates, g)
+			}
+		}
+	}
+	return duplicates
+}
+
+// keeper returns the product of the group items are matched with: the active
+// product with the lowest ID, or the archived one with the lowest ID
+func (g duplicateGroup) keeper() *models.Product {
+	keep := g.products[0]
+	for _, p := range g.products[1:] {
+		if p.Archived() != keep.Archived() {
+			if !p.Archived() {
+				keep = p
+			}
+		} else if p.ID < keep.ID {
+			keep = p
+		}
+	}
+	return keep
+}
+
+// warning describes the group for the result of the sync
+func (g duplicateGroup) warning() string {
+	ids := make([]string, len(g.products))
+	for i, p := range g.products {
+		ids[i] = strconv.Itoa(p.ID)
+	}
+	return fmt.Sprintf("%d products share the %s %q (IDs %s), keeping %d",
+		len(g.products), g.by, g.key, strings.Join(ids, ", "), g.keeper().ID)
+}
+
+// checkDuplicates reports the duplicates among the products loaded for the
+// sync and points the title keys of duplicated titles at their keeper. It
+// returns the other active products of those titles, which the merge policy
+// archives.
+func (s *SyncService) checkDuplicates(dbProducts []models.Product, titleKeys []string, dbProductMap map[string]*models.Product, result *models.SyncResult) []*models.Product {
+	duplicates := findDuplicates(dbProducts, titleKeys)
+	if len(duplicates) == 0 {
+		return nil
+	}
+
+	var extras []*models.Product
+	for _, g := range duplicates {
+		result.Warnings = append(result.Warnings, g.warning())
+		if g.by != models.FieldTitle {
+			continue
+		}
+		keep := g.keeper()
+		dbProductMap[g.key] = keep
+		for _, p := range g.products {
+			if p != keep && !p.Archived() {
+				extras = append(extras, p)
+			}
+		}
+	}
+	log.Printf("Found %d groups of duplicate products", len(duplicates))
+
+	if s.duplicates == models.DuplicatesFlag {
+		result.Status = models.WorseStatus(result.Status, models.SyncStatusDegraded)
+	}
+	if s.duplicates != models.DuplicatesMerge {
+		return nil
+	}
+	return extras
+}
+
+// mergeDuplicates archives the duplicates of a title other than its keeper
+func (s *SyncService) mergeDuplicates(ctx context.Context, extras []*models.Product, result *models.SyncResult) {
+	archived, err := s.archive(ctx, extras, result)
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("failed to merge duplicates: %v", err))
+		return
+	}
+	log.Printf("Archived %d duplicate products", len(archived))
+}
+
+// archive archives products and returns those the database archived, queueing
+// and auditing their archives like the other applied changes. Products
+// archived already, by another run for instance, are left out.
+func (s *SyncService) archive(ctx context.Context, products []*models.Product, result *models.SyncResult) ([]*models.Product, error) {
+	ids := make([]int, len(products))
+	for i, p := range products {
+		ids[i] = p.ID
+	}
+	archivedIDs, err := s.repo.ArchiveProductsBatch(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	archived := withIDs(products, archivedIDs)
+	if len(archived) > 0 {
+		s.recordRemovals(ctx, archived, models.ChangeActionArchive, result)
+	}
+	return archived, nil
+}
+
+// withIDs returns the products whose ID is one of ids, in order
+func withIDs(products []*models.Product, ids []int) []*models.Product {
+	in := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		in[id] = true
+	}
+	var filtered []*models.Product
+	for _, p := range products {
+		if in[p.ID] {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered
+}
+
+// recordRemovals queues and audits the archive or deletion (action) of products
+func (s *SyncService) recordRemovals(ctx context.Context, products []*models.Product, action string, result *models.SyncResult) {
+	if s.outbox != nil && len(s.sinks) > 0 {
+		changes := make([]models.Change, len(products))
+		for i, p := range products {
+			changes[i] = models.Change{Action: action, ProductID: p.ID, Title: p.Title, Handle: p.Handle}
+		}
+		if err := s.outbox.EnqueueChanges(ctx, changes, s.sinks); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("failed to enqueue changes: %v", err))
+		} else {
+			result.Changes = append(result.Changes, changeIDs(changes)...)
+		}
+	}
+	if s.audit != nil {
+		changes := make([]models.ProductChange, len(products))
+		for i, p := range products {
+			changes[i] = models.ProductChange{RunID: s.runID, ProductID: p.ID, Action: action, OldTitle: p.Title, OldHandle: p.Handle}
+		}
+		if err := s.audit.RecordChanges(ctx, changes); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("failed to record audit log: %v", err))
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package repo
+
+import (
+	"context"
+	"go-cron/models"
+	"reflect"
+	"testing"
+)
+
+// Test_SyncService_CompareAndSync_Duplicates tests that duplicates are reported, matched with their keeper and merged
+func Test_SyncService_CompareAndSync_Duplicates(t *testing.T) {
+	products := []models.Product{
+		{ID: 3, Title: "Product A", Handle: "product-a", Status: models.ProductStatusActive},
+		{ID: 1, Title: "product a ", Handle: "product-a-1", Status: models.ProductStatusArchived},
+		{ID: 2, Title: "PRODUCT A", Handle: "product-a-2", Status: models.ProductStatusActive},
+		{ID: 4, Title: "Product B", Handle: "shared", Status: models.ProductStatusActive},
+		{ID: 5, Title: "Product C", Handle: "shared", Status: models.ProductStatusActive},
+	}
+
+	tests := []struct {
+		policy   string
+		status   string
+		archived []int
+	}{
+		{policy: models.DuplicatesReport, status: models.SyncStatusOK},
+		{policy: models.DuplicatesFlag, status: models.SyncStatusDegraded},
+		{policy: models.DuplicatesMerge, status: models.SyncStatusOK, archived: []int{3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			var archived []int
+			var updated []int
+			mockRepo := &MockProductRepository{
+				GetAllProductsFunc: func(ctx context.Context) ([]models.Product, error) {
+					return append([]models.Product(nil), products...), nil
+				},
+				ArchiveProductsBatchFunc: func(ctx context.Context, ids []int) ([]int, error) {
+					archived = ids
+					return ids, nil
+				},
+				UpdateProductsBatchFunc: func(ctx context.Context, updates []struct {
+					ID      int
+					Title   string
+					Handle  string
+					Fields  ProductFields
+					Version int
+				}) error {
+					for _, u := range updates {
+						updated = append(updated, u.ID)
+					}
+					return nil
+				},
+			}
+			syncService := NewSyncService(mockRepo)
+			syncService.SetDuplicates(tt.policy)
+
+			result, err := syncService.CompareAndSync(context.Background(), []models.ExternalItem{{ItemCode: "A", ItemName: "Product A"}})
+			if err != nil {
+				t.Fatalf("CompareAndSync failed: %v", err)
+			}
+
+			expected := []string{
+				`3 products share the title "product a" (IDs 3, 1, 2), keeping 2`,
+				`2 products share the handle "shared" (IDs 4, 5), keeping 4`,
+			}
+			if !reflect.DeepEqual(result.Warnings, expected) {
+				t.Errorf("Expected warnings %q, got %q", expected, result.Warnings)
+			}
+			if result.Status != tt.status {
+				t.Errorf("Expected status %q, got %q", tt.status, result.Status)
+			}
+			if !reflect.DeepEqual(archived, tt.archived) {
+				t.Errorf("Expected archived products %v, got %v", tt.archived, archived)
+			}
+			// The item is matched with the active product with the lowest ID
+			if !reflect.DeepEqual(updated, []int{2}) {
+				t.Errorf("Expected product 2 to be updated, got %v", updated)
+			}
+		})
+	}
+}
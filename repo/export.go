@@ -0,0 +1,73 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"go-cron/models"
+)
+
+// exportClause matches the products, aliased p, after ID $1 kept by a models.ExportFilter
+// passed as $2 (category), $3 (include archived) and $4 (updated since)
+const exportClause = `id > $1
+	AND ($2 = '' OR category = $2)
+	AND ($3 OR status IS DISTINCT FROM 'archived')
+	AND ($4::timestamptz IS NULL OR EXISTS (
+		SELECT 1 FROM product_changes c WHERE c.product_id = p.id AND c.changed_at >= $4))`
+
+// exportArgs returns the arguments of exportClause
+func exportArgs(filter models.ExportFilter, afterID int) []interface{} {
+	since := sql.NullTime{Time: filter.UpdatedSince, Valid: !filter.UpdatedSince.IsZero()}
+	return []interface{}{afterID, filter.Category, filter.IncludeArchived, since}
+}
+
+// ExportProducts calls fn with up to limit products kept by filter, in ID
+// order from the first ID after afterID, reading them row by row so a large
+// export is never held in memory
+func (r *ProductRepository) ExportProducts(ctx context.Context, filter models.ExportFilter, afterID, limit int, fn func(models.Product) error) error {
+	query := `SELECT ` + productColumns + ` FROM products p WHERE ` + exportClause + ` ORDER BY id LIMIT $5`
+	rows, err := r.db.QueryContext(ctx, r.table.sql(query), append(exportArgs(filter, afterID), limit)...)
+	if err != nil {
+		return fmt.Errorf("failed to query products: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p, err := scanProduct(rows)
+		if err != nil {
+			return fmt.Errorf("failed to scan product: %w", err)
+		}
+		if err := fn(*p); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// NextExportCursor returns the afterID of the export page following the one
+// of afterID and limit, or 0 when that page is the last one
+func (r *ProductRepository) NextExportCursor(ctx context.Context, filter models.ExportFilter, afterID, limit int) (int, error) {
+	// The last ID of the page, when a product follows it
+	query := `SELECT id FROM products p WHERE ` + exportClause + ` ORDER BY id LIMIT 2 OFFSET $5`
+	rows, err := r.db.QueryContext(ctx, r.table.sql(query), append(exportArgs(filter, afterID), limit-1)...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query the next export page: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return 0, fmt.Errorf("failed to scan product ID: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(ids) < 2 {
+		return 0, nil
+	}
+	return ids[0], nil
+}
@@ -0,0 +1,50 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-cron/models"
+)
+
+// ErrImplausibleFeed is returned when the external feed is empty or far smaller
+// than the catalog, which usually means a broken filter, login or CompanyDB
+// rather than products actually being removed
+var ErrImplausibleFeed = errors.New("implausible external feed")
+
+// CheckFeed compares the number of fetched items with the size of the active
+// catalog. An empty feed against a non-empty catalog is always rejected; a feed
+// smaller than minRatio of the catalog is rejected when minRatio is positive.
+func CheckFeed(ctx context.Context, products ProductRepositoryInterface, itemCount int, minRatio float64) error {
+	catalog, err := products.CountActiveProducts(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to count products: %w", err)
+	}
+
+	if itemCount == 0 && catalog > 0 {
+		return fmt.Errorf("%w: external API returned no items but the catalog has %d products", ErrImplausibleFeed, catalog)
+	}
+	if minRatio > 0 && float64(itemCount) < float64(catalog)*minRatio {
+		return fmt.Errorf("%w: external API returned %d items, less than %.0f%% of the %d products in the catalog",
+			ErrImplausibleFeed, itemCount, minRatio*100, catalog)
+	}
+	return nil
+}
+
+// CheckShardFeed is CheckFeed for the feed of a shard, which is held against
+// the items the same shard synced in its previous cycle rather than against
+// the whole catalog. The first cycle of a shard is not checked.
+func CheckShardFeed(itemCount int, previous *models.SyncResult, minRatio float64) error {
+	if previous == nil {
+		return nil
+	}
+	synced := previous.Created + previous.Updated + previous.Unchanged + previous.Reactivated + previous.Skipped
+	if itemCount == 0 && synced > 0 {
+		return fmt.Errorf("%w: external API returned no items but the shard synced %d items in its previous cycle", ErrImplausibleFeed, synced)
+	}
+	if minRatio > 0 && float64(itemCount) < float64(synced)*minRatio {
+		return fmt.Errorf("%w: external API returned %d items, less than %.0f%% of the %d items the shard synced in its previous cycle",
+			ErrImplausibleFeed, itemCount, minRatio*100, synced)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// Test_CheckFeed tests the detection of empty and implausibly small feeds
+func Test_CheckFeed(t *testing.T) {
+	tests := []struct {
+		name      string
+		catalog   int
+		items     int
+		minRatio  float64
+		wantError bool
+	}{
+		{"normal feed", 100, 98, 0.5, false},
+		{"empty catalog", 0, 0, 0.5, false},
+		{"empty feed", 100, 0, 0.5, true},
+		{"empty feed without ratio", 100, 0, 0, true},
+		{"tiny feed", 100, 10, 0.5, true},
+		{"tiny feed without ratio", 100, 10, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := &MockProductRepository{
+				CountActiveProductsFunc: func(ctx context.Context) (int, error) { return tt.catalog, nil },
+			}
+			err := CheckFeed(context.Background(), mockRepo, tt.items, tt.minRatio)
+			if got := errors.Is(err, ErrImplausibleFeed); got != tt.wantError {
+				t.Errorf("CheckFeed() = %v, want implausible: %v", err, tt.wantError)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"go-cron/models"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// saveHandleSQL gives the product with ID $1 the handle $2
+const saveHandleSQL = `
+		UPDATE products SET handle = $2, updated_at = NOW(), version = version + 1
+		WHERE id = $1 AND handle IS DISTINCT FROM $2`
+
+// moveImageSQL gives the downloaded picture of the product with ID $1 the
+// handle $2 of its product
+const moveImageSQL = `
+		UPDATE product_images SET handle = $2 WHERE product_id = $1`
+
+// RepairHandles finds the products with a missing, duplicated or
+// non-conforming handle and regenerates it from the title, suffixing -2, -3,
+// ... on collisions. The repairs are only written when apply is set.
+func RepairHandles(ctx context.Context, r HandleRepositoryInterface, apply bool) (*models.HandleRepairReport, error) {
+	products, err := r.GetAllProducts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch database products: %w", err)
+	}
+
+	report := &models.HandleRepairReport{Scanned: len(products), Repairs: planHandleRepairs(products)}
+	if !apply || len(report.Repairs) == 0 {
+		return report, nil
+	}
+
+	handles := make(map[int]string, len(report.Repairs))
+	for _, repair := range report.Repairs {
+		handles[repair.ProductID] = repair.NewHandle
+	}
+	report.Applied, err = r.SaveHandles(ctx, handles)
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// planHandleRepairs returns the handles to regenerate, by product ID. A
+// duplicated handle stays with the product a sync keeps: the active one with
+// the lowest ID. New handles never take one in use, so they can be written in
+// any order without breaking the unique index.
+func planHandleRepairs(products []models.Product) []models.HandleRepair {
+	sorted := append([]models.Product(nil), products...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+
+	taken := make(map[string]bool, len(sorted))
+	owners := make(map[string]*models.Product, len(sorted))
+	for i := range sorted {
+		p := &sorted[i]
+		if p.Handle == "" {
+			continue
+		}
+		taken[p.Handle] = true
+		// Sorted by ID, so an owner is only replaced by the first active product
+		if owner := owners[p.Handle]; owner == nil || (owner.Archived() && !p.Archived()) {
+			owners[p.Handle] = p
+		}
+	}
+
+	var repairs []models.HandleRepair
+	for i := range sorted {
+		p := &sorted[i]
+		base := handleBase(*p)
+		var reason string
+		switch {
+		case p.Handle == "":
+			reason = models.HandleMissing
+		case owners[p.Handle] != p:
+			reason = models.HandleDuplicate
+		case !conformingHandle(p.Handle, base):
+			reason = models.HandleNonConforming
+		default:
+			continue
+		}
+
+		handle := base
+		for n := 2; taken[handle]; n++ {
+			handle = base + "-" + strconv.Itoa(n)
+		}
+		taken[handle] = true
+		repairs = append(repairs, models.HandleRepair{ProductID: p.ID, Title: p.Title, OldHandle: p.Handle, NewHandle: handle, Reason: reason})
+	}
+	return repairs
+}
+
+// handleBase returns the handle generated from the title of p, or one built
+// from its ID when the title has no character a handle keeps
+func handleBase(p models.Product) string {
+	if base := generateHandle(p.Title); base != "" {
+		return base
+	}
+	return "product-" + strconv.Itoa(p.ID)
+}
+
+// conformingHandle reports whether handle is base, possibly with the numeric
+// suffix the handle repair adds on collisions
+func conformingHandle(handle, base string) bool {
+	if handle == base {
+		return true
+	}
+	suffix, ok := strings.CutPrefix(handle, base+"-")
+	if !ok || suffix == "" {
+		return false
+	}
+	for _, r := range suffix {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// SaveHandles gives the products the handles of handles (map of product ID to
+// handle) in a single transaction and returns how many changed. Downloaded
+// pictures follow the handle of their product.
+func (r *ProductRepository) SaveHandles(ctx context.Context, handles map[int]string) (int, error) {
+	if len(handles) == 0 {
+		return 0, nil
+	}
+
+	ctx, span := startSpan(ctx, "save_handles", len(handles))
+	defer span.End()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Deployments that never downloaded pictures have no product_images table
+	var hasImages bool
+	if err := tx.QueryRowContext(ctx, `SELECT to_regclass('product_images') IS NOT NULL`).Scan(&hasImages); err != nil {
+		return 0, fmt.Errorf("failed to look up product_images: %w", err)
+	}
+
+	ids := make([]int, 0, len(handles))
+	for id := range handles {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	changed := 0
+	for _, id := range ids {
+		res, err := tx.ExecContext(ctx, r.table.sql(saveHandleSQL), id, handles[id])
+		if err != nil {
+			return 0, fmt.Errorf("failed to save the handle of product %d: %w", id, err)
+		}
+		if n, err := res.RowsAffected(); err == nil && n > 0 {
+			changed++
+		}
+		if hasImages {
+			if _, err := tx.ExecContext(ctx, moveImageSQL, id, handles[id]); err != nil {
+				return 0, fmt.Errorf("failed to move the picture of product %d: %w", id, err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return changed, nil
+}
+
+// EnsureHandleIndex creates the unique index on product handles when the
+// table lacks it. It fails while duplicated handles remain.
+func (r *ProductRepository) EnsureHandleIndex(ctx context.Context) error {
+	if _, err := r.db.ExecContext(ctx, r.table.sql(`CREATE UNIQUE INDEX IF NOT EXISTS products_handle_key ON products (handle)`)); err != nil {
+		return fmt.Errorf("failed to create the handle index: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package repo
+
+import (
+	"context"
+	"go-cron/models"
+	"reflect"
+	"testing"
+)
+
+// mockHandleRepository serves products to RepairHandles and records the saved handles
+type mockHandleRepository struct {
+	products []models.Product
+	saved    map[int]string
+}
+
+func (m *mockHandleRepository) GetAllProducts(ctx context.Context) ([]models.Product, error) {
+	return m.products, nil
+}
+
+func (m *mockHandleRepository) SaveHandles(ctx context.Context, handles map[int]string) (int, error) {
+	m.saved = handles
+	return len(handles), nil
+}
+
+// Test_RepairHandles tests that missing, duplicated and non-conforming handles
+// are regenerated around the handles in use, and only written when applied
+func Test_RepairHandles(t *testing.T) {
+	store := &mockHandleRepository{products: []models.Product{
+		{ID: 5, Title: "Green Tea", Handle: "green_tea", Status: models.ProductStatusActive},
+		{ID: 1, Title: "Green Tea", Handle: "green-tea", Status: models.ProductStatusArchived},
+		{ID: 2, Title: "Mug", Handle: "mug", Status: models.ProductStatusActive},
+		{ID: 3, Title: "Mug", Handle: "mug", Status: models.ProductStatusActive},
+		{ID: 4, Title: "Black Tea", Handle: "", Status: models.ProductStatusActive},
+		{ID: 6, Title: "Oolong", Handle: "oolong-2", Status: models.ProductStatusActive},
+		{ID: 7, Title: "???", Handle: "", Status: models.ProductStatusActive},
+	}}
+
+	report, err := RepairHandles(context.Background(), store, false)
+	if err != nil {
+		t.Fatalf("RepairHandles failed: %v", err)
+	}
+	want := []models.HandleRepair{
+		{ProductID: 3, Title: "Mug", OldHandle: "mug", NewHandle: "mug-2", Reason: models.HandleDuplicate},
+		{ProductID: 4, Title: "Black Tea", NewHandle: "black-tea", Reason: models.HandleMissing},
+		{ProductID: 5, Title: "Green Tea", OldHandle: "green_tea", NewHandle: "green-tea-2", Reason: models.HandleNonConforming},
+		{ProductID: 7, Title: "???", NewHandle: "product-7", Reason: models.HandleMissing},
+	}
+	if !reflect.DeepEqual(report.Repairs, want) {
+		t.Errorf("Expected repairs %+v, got %+v", want, report.Repairs)
+	}
+	if report.Scanned != 7 || report.Applied != 0 || store.saved != nil {
+		t.Errorf("Expected a dry run to write nothing, got %+v and %v", report, store.saved)
+	}
+
+	if report, err = RepairHandles(context.Background(), store, true); err != nil || report.Applied != 4 {
+		t.Fatalf("Expected the 4 repairs to be applied, got %+v (%v)", report, err)
+	}
+	if store.saved[5] != "green-tea-2" {
+		t.Errorf("Expected the regenerated handles to be saved, got %v", store.saved)
+	}
+}
+
+// Test_conformingHandle tests which handles follow the rules for their title
+func Test_conformingHandle(t *testing.T) {
+	for handle, want := range map[string]bool{"tea": true, "tea-2": true, "tea-": false, "tea-x": false, "teapot": false} {
+		if got := conformingHandle(handle, "tea"); got != want {
+			t.Errorf("conformingHandle(%q) = %v, want %v", handle, got, want)
+		}
+	}
+}
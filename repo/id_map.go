@@ -0,0 +1,159 @@
+package repo
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"go-cron/models"
+	"log"
+	"sync"
+)
+
+// SinkObjectChecker reports whether an object still exists in a downstream sink
+type SinkObjectChecker func(ctx context.Context, externalID string) (bool, error)
+
+type idMapKey struct {
+	sink      string
+	productID int
+}
+
+type idMapEntry struct {
+	key        idMapKey
+	externalID string
+}
+
+// IDMapCache is a concurrency-safe LRU cache in front of the sink mapping table,
+// used by push sinks to resolve product IDs to their external object IDs
+type IDMapCache struct {
+	repo     SinkMappingRepositoryInterface
+	capacity int
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[idMapKey]*list.Element
+}
+
+// NewIDMapCache creates a new ID mapping cache holding at most capacity entries
+func NewIDMapCache(repo SinkMappingRepositoryInterface, capacity int) *IDMapCache {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	return &IDMapCache{
+		repo:     repo,
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[idMapKey]*list.Element),
+	}
+}
+
+// Lookup returns the external ID of a product in the given sink, reading through
+// to the database on a cache miss. The boolean is false when no mapping exists.
+func (c *IDMapCache) Lookup(ctx context.Context, sink string, productID int) (string, bool, error) {
+	key := idMapKey{sink: sink, productID: productID}
+	if externalID, ok := c.get(key); ok {
+		return externalID, true, nil
+	}
+
+	mapping, err := c.repo.GetSinkMapping(ctx, sink, productID)
+	if err != nil {
+		return "", false, err
+	}
+	if mapping == nil {
+		return "", false, nil
+	}
+
+	c.put(key, mapping.ExternalID)
+	return mapping.ExternalID, true, nil
+}
+
+// Store persists a mapping and caches it
+func (c *IDMapCache) Store(ctx context.Context, sink string, productID int, externalID string) error {
+	err := c.repo.SaveSinkMapping(ctx, models.SinkMapping{
+		ProductID:  productID,
+		Sink:       sink,
+		ExternalID: externalID,
+	})
+	if err != nil {
+		return err
+	}
+
+	c.put(idMapKey{sink: sink, productID: productID}, externalID)
+	return nil
+}
+
+// Forget removes a mapping from the database and the cache
+func (c *IDMapCache) Forget(ctx context.Context, sink string, productID int) error {
+	c.remove(idMapKey{sink: sink, productID: productID})
+	return c.repo.DeleteSinkMapping(ctx, sink, productID)
+}
+
+// Reconcile resolves the external ID of a product and verifies the object still
+// exists in the sink. If the sink deleted it out-of-band, the stale mapping is
+// dropped and ("", false) is returned so the caller re-creates the object.
+func (c *IDMapCache) Reconcile(ctx context.Context, sink string, productID int, exists SinkObjectChecker) (string, bool, error) {
+	externalID, ok, err := c.Lookup(ctx, sink, productID)
+	if err != nil || !ok {
+		return "", false, err
+	}
+
+	found, err := exists(ctx, externalID)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to check %s object %s: %w", sink, externalID, err)
+	}
+	if found {
+		return externalID, true, nil
+	}
+
+	log.Printf("%s object %s for product %d was deleted out-of-band, dropping mapping", sink, externalID, productID)
+	if err := c.Forget(ctx, sink, productID); err != nil {
+		return "", false, err
+	}
+	return "", false, nil
+}
+
+// Len returns the number of cached mappings
+func (c *IDMapCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *IDMapCache) get(key idMapKey) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*idMapEntry).externalID, true
+}
+
+func (c *IDMapCache) put(key idMapKey, externalID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*idMapEntry).externalID = externalID
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&idMapEntry{key: key, externalID: externalID})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*idMapEntry).key)
+	}
+}
+
+func (c *IDMapCache) remove(key idMapKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+	}
+}
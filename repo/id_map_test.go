@@ -0,0 +1,107 @@
+package repo
+
+import (
+	"context"
+	"go-cron/models"
+	"testing"
+)
+
+// MockSinkMappingRepository is an in-memory implementation of SinkMappingRepositoryInterface for testing
+type MockSinkMappingRepository struct {
+	Mappings map[string]map[int]string
+	Reads    int
+}
+
+func NewMockSinkMappingRepository() *MockSinkMappingRepository {
+	return &MockSinkMappingRepository{Mappings: make(map[string]map[int]string)}
+}
+
+func (m *MockSinkMappingRepository) GetSinkMapping(ctx context.Context, sink string, productID int) (*models.SinkMapping, error) {
+	m.Reads++
+	externalID, ok := m.Mappings[sink][productID]
+	if !ok {
+		return nil, nil
+	}
+	return &models.SinkMapping{ProductID: productID, Sink: sink, ExternalID: externalID}, nil
+}
+
+func (m *MockSinkMappingRepository) SaveSinkMapping(ctx context.Context, mapping models.SinkMapping) error {
+	if m.Mappings[mapping.Sink] == nil {
+		m.Mappings[mapping.Sink] = make(map[int]string)
+	}
+	m.Mappings[mapping.Sink][mapping.ProductID] = mapping.ExternalID
+	return nil
+}
+
+func (m *MockSinkMappingRepository) DeleteSinkMapping(ctx context.Context, sink string, productID int) error {
+	delete(m.Mappings[sink], productID)
+	return nil
+}
+
+// Test_IDMapCache_LookupCachesReads tests that repeated lookups are served from memory
+func Test_IDMapCache_LookupCachesReads(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := NewMockSinkMappingRepository()
+	mockRepo.Mappings["shopify"] = map[int]string{1: "gid://shopify/Product/100"}
+
+	cache := NewIDMapCache(mockRepo, 10)
+
+	for i := 0; i < 3; i++ {
+		externalID, ok, err := cache.Lookup(ctx, "shopify", 1)
+		if err != nil || !ok {
+			t.Fatalf("Lookup failed: ok=%v err=%v", ok, err)
+		}
+		if externalID != "gid://shopify/Product/100" {
+			t.Errorf("Unexpected external ID: %s", externalID)
+		}
+	}
+
+	if mockRepo.Reads != 1 {
+		t.Errorf("Expected 1 database read, got %d", mockRepo.Reads)
+	}
+}
+
+// Test_IDMapCache_EvictsLeastRecentlyUsed tests the cache capacity bound
+func Test_IDMapCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	cache := NewIDMapCache(NewMockSinkMappingRepository(), 2)
+
+	_ = cache.Store(ctx, "search", 1, "doc-1")
+	_ = cache.Store(ctx, "search", 2, "doc-2")
+	_, _, _ = cache.Lookup(ctx, "search", 1) // Touch 1 so 2 becomes the oldest
+	_ = cache.Store(ctx, "search", 3, "doc-3")
+
+	if cache.Len() != 2 {
+		t.Errorf("Expected 2 cached entries, got %d", cache.Len())
+	}
+	if _, ok := cache.get(idMapKey{sink: "search", productID: 2}); ok {
+		t.Error("Expected entry 2 to be evicted")
+	}
+	if _, ok := cache.get(idMapKey{sink: "search", productID: 1}); !ok {
+		t.Error("Expected entry 1 to remain cached")
+	}
+}
+
+// Test_IDMapCache_ReconcileDropsDeletedObjects tests out-of-band deletion handling
+func Test_IDMapCache_ReconcileDropsDeletedObjects(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := NewMockSinkMappingRepository()
+	cache := NewIDMapCache(mockRepo, 10)
+	_ = cache.Store(ctx, "shopify", 1, "gid://shopify/Product/100")
+
+	externalID, ok, err := cache.Reconcile(ctx, "shopify", 1, func(ctx context.Context, externalID string) (bool, error) {
+		return false, nil // Deleted in the sink
+	})
+	if err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+	if ok || externalID != "" {
+		t.Errorf("Expected no mapping after reconcile, got %q", externalID)
+	}
+	if _, exists := mockRepo.Mappings["shopify"][1]; exists {
+		t.Error("Expected stale mapping to be deleted from the database")
+	}
+	if cache.Len() != 0 {
+		t.Errorf("Expected empty cache, got %d entries", cache.Len())
+	}
+}
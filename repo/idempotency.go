@@ -0,0 +1,97 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"go-cron/models"
+	"time"
+)
+
+// ErrIdempotencyInProgress is returned when a request with the same idempotency key is still running
+var ErrIdempotencyInProgress = errors.New("a request with this idempotency key is in progress")
+
+// IdempotencyRepository stores the responses of requests made with an
+// idempotency key so retried triggers are answered without running again
+type IdempotencyRepository struct {
+	db  *sql.DB
+	now func() time.Time
+}
+
+// NewIdempotencyRepository creates a new idempotency repository
+func NewIdempotencyRepository(db *sql.DB) *IdempotencyRepository {
+	return &IdempotencyRepository{db: db, now: time.Now}
+}
+
+// SetClock replaces the time source of reservations and retention
+func (r *IdempotencyRepository) SetClock(now func() time.Time) {
+	r.now = now
+}
+
+// Reserve claims key for a new request. It returns nil when the caller should
+// proceed, the stored record when the key was already processed within ttl,
+// or ErrIdempotencyInProgress when another request holds it. A reservation
+// left without a response for longer than staleAfter is presumed abandoned
+// and handed over.
+func (r *IdempotencyRepository) Reserve(ctx context.Context, key string, ttl, staleAfter time.Duration) (*models.IdempotencyRecord, error) {
+	now := r.now().UTC()
+	var reserved string
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO idempotency_keys (key, created_at)
+		VALUES ($1, $2)
+		ON CONFLICT (key) DO UPDATE
+		SET created_at = EXCLUDED.created_at, status_code = NULL, response = NULL
+		WHERE idempotency_keys.created_at < $3
+		   OR (idempotency_keys.status_code IS NULL AND idempotency_keys.created_at < $4)
+		RETURNING key`, key, now, now.Add(-ttl), now.Add(-staleAfter)).Scan(&reserved)
+	if err == nil {
+		return nil, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to reserve idempotency key: %w", err)
+	}
+
+	record := &models.IdempotencyRecord{Key: key}
+	var statusCode sql.NullInt64
+	err = r.db.QueryRowContext(ctx,
+		`SELECT status_code, response, created_at FROM idempotency_keys WHERE key = $1`, key).
+		Scan(&statusCode, &record.Response, &record.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query idempotency key: %w", err)
+	}
+	if !statusCode.Valid {
+		return nil, ErrIdempotencyInProgress
+	}
+	record.StatusCode, record.CreatedAt = int(statusCode.Int64), record.CreatedAt.UTC()
+	return record, nil
+}
+
+// Complete stores the response of the request that reserved key
+func (r *IdempotencyRepository) Complete(ctx context.Context, key string, statusCode int, response []byte) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE idempotency_keys SET status_code = $2, response = $3 WHERE key = $1`, key, statusCode, response)
+	if err != nil {
+		return fmt.Errorf("failed to store idempotent response: %w", err)
+	}
+	return nil
+}
+
+// Release drops the reservation of key so a retry runs the request again
+func (r *IdempotencyRepository) Release(ctx context.Context, key string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE key = $1 AND status_code IS NULL`, key)
+	if err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
+
+// PurgeIdempotencyKeys deletes the keys older than ttl
+func (r *IdempotencyRepository) PurgeIdempotencyKeys(ctx context.Context, ttl time.Duration) (int, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE created_at < $1`, r.now().UTC().Add(-ttl))
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge idempotency keys: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
@@ -0,0 +1,97 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"go-cron/internal/recovery"
+	"go-cron/models"
+	"log"
+	"sync"
+)
+
+// syncImages stores the changed picture URLs (map of handle to URL) on the
+// products of ids and, with a fetcher, downloads the new pictures and removes
+// the cleared ones. Failed downloads are warnings: the URL stays stored and
+// the next change of the picture retries. It returns the handles whose URL
+// changed.
+func (s *SyncService) syncImages(ctx context.Context, urls map[string]string, ids map[string]int, result *models.SyncResult) []string {
+	changed, err := s.media.SaveImageURLs(ctx, byID(urls, ids))
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("failed to save picture URLs: %v", err))
+	}
+	handles := handlesOfIDs(changed, ids)
+	stats := &models.ImageSyncResult{Changed: len(changed)}
+	result.Images = stats
+	if s.imageFetcher == nil || len(changed) == 0 {
+		return handles
+	}
+
+	var cleared []int
+	var downloads []models.ProductImage
+	for i, id := range changed {
+		if url := urls[handles[i]]; url == "" {
+			cleared = append(cleared, id)
+		} else {
+			downloads = append(downloads, models.ProductImage{ProductID: id, Handle: handles[i], URL: url})
+		}
+	}
+	if _, err := s.media.DeleteImages(ctx, cleared); err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("failed to delete pictures: %v", err))
+	}
+	s.downloadImages(ctx, downloads, stats, result)
+	log.Printf("Downloaded %d of %d changed pictures (%d bytes)", stats.Downloaded, len(downloads), stats.Bytes)
+	return handles
+}
+
+// downloadImages downloads and stores the pictures, at most the configured
+// number at once
+func (s *SyncService) downloadImages(ctx context.Context, images []models.ProductImage, stats *models.ImageSyncResult, result *models.SyncResult) {
+	workers := s.images.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	jobs := make(chan models.ProductImage)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for image := range jobs {
+				err := s.downloadImage(ctx, &image)
+				mu.Lock()
+				if err != nil {
+					stats.Failed++
+					result.Warnings = append(result.Warnings, err.Error())
+				} else {
+					stats.Downloaded++
+					stats.Bytes += int64(len(image.Data))
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, image := range images {
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- image
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// downloadImage downloads and stores one picture, reporting a panic as its error
+func (s *SyncService) downloadImage(ctx context.Context, image *models.ProductImage) (err error) {
+	defer func() {
+		if p := recovery.Error(recover()); p != nil {
+			err = fmt.Errorf("failed to download picture of %s: %w", image.Handle, p)
+		}
+	}()
+	data, contentType, err := s.imageFetcher.FetchImage(ctx, image.URL)
+	if err != nil {
+		return fmt.Errorf("picture of %s: %w", image.Handle, err)
+	}
+	image.Data, image.ContentType = data, contentType
+	return s.media.SaveImage(ctx, *image)
+}
@@ -0,0 +1,121 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"go-cron/models"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+)
+
+// MockMediaRepository is a mock implementation of MediaRepositoryInterface
+type MockMediaRepository struct {
+	mu      sync.Mutex
+	URLs    map[int]string
+	Images  map[int]models.ProductImage
+	Deleted []int
+}
+
+func (m *MockMediaRepository) SaveImageURLs(ctx context.Context, urls map[int]string) ([]int, error) {
+	m.URLs = urls
+	var changed []int
+	for id := range urls {
+		changed = append(changed, id)
+	}
+	sort.Ints(changed)
+	return changed, nil
+}
+
+func (m *MockMediaRepository) SaveImage(ctx context.Context, image models.ProductImage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Images == nil {
+		m.Images = make(map[int]models.ProductImage)
+	}
+	m.Images[image.ProductID] = image
+	return nil
+}
+
+func (m *MockMediaRepository) GetImage(ctx context.Context, productID int) (*models.ProductImage, error) {
+	if image, ok := m.Images[productID]; ok {
+		return &image, nil
+	}
+	return nil, nil
+}
+
+func (m *MockMediaRepository) DeleteImages(ctx context.Context, ids []int) (int, error) {
+	m.Deleted = append(m.Deleted, ids...)
+	return len(ids), nil
+}
+
+// imageFetcherFunc adapts a function to ImageFetcher
+type imageFetcherFunc func(ctx context.Context, url string) ([]byte, string, error)
+
+func (f imageFetcherFunc) FetchImage(ctx context.Context, url string) ([]byte, string, error) {
+	return f(ctx, url)
+}
+
+// Test_SyncService_CompareAndSync_Images tests that picture URLs are diffed
+// like other fields, stored by product ID, and that changed pictures are
+// downloaded or removed
+func Test_SyncService_CompareAndSync_Images(t *testing.T) {
+	mockRepo := &MockProductRepository{
+		GetAllProductsFunc: func(ctx context.Context) ([]models.Product, error) {
+			return []models.Product{
+				{ID: 1, Title: "Oak Chair", Handle: "oak-chair", Status: models.ProductStatusActive, Image: "https://img.example.com/oak.jpg"},
+				{ID: 2, Title: "Pine Desk", Handle: "pine-desk", Status: models.ProductStatusActive, Image: "https://img.example.com/pine.jpg"},
+				{ID: 3, Title: "Lamp", Handle: "lamp", Status: models.ProductStatusActive, Image: "https://img.example.com/lamp.jpg"},
+			}, nil
+		},
+		GetProductsByTitlesFunc: func(ctx context.Context, titles []string) ([]models.Product, error) {
+			return []models.Product{{ID: 4, Title: "Stool", Handle: "stool", Status: models.ProductStatusActive}}, nil
+		},
+	}
+	media := &MockMediaRepository{}
+	fetcher := imageFetcherFunc(func(ctx context.Context, url string) ([]byte, string, error) {
+		if url == "https://img.example.com/missing.png" {
+			return nil, "", errors.New("404 Not Found")
+		}
+		return []byte(url), "image/jpeg", nil
+	})
+	syncService := NewSyncService(mockRepo)
+	syncService.SetImages(media, fetcher, models.ImagesConfig{Enabled: true, BaseURL: "https://img.example.com/", Workers: 2})
+
+	items := []models.ExternalItem{
+		{ItemCode: "C1", ItemName: "Oak Chair", Picture: "oak.jpg"},
+		{ItemCode: "D1", ItemName: "Pine Desk", Picture: "pine desk.jpg"},
+		{ItemCode: "L1", ItemName: "Lamp"},
+		{ItemCode: "S1", ItemName: "Stool", Picture: "missing.png"},
+	}
+	result, err := syncService.CompareAndSync(context.Background(), items)
+	if err != nil {
+		t.Fatalf("CompareAndSync failed: %v", err)
+	}
+
+	expected := map[int]string{
+		2: "https://img.example.com/pine%20desk.jpg",
+		3: "",
+		4: "https://img.example.com/missing.png",
+	}
+	if !reflect.DeepEqual(media.URLs, expected) {
+		t.Errorf("Expected picture URLs %v, got %v", expected, media.URLs)
+	}
+	if result.Updated != 2 || result.Unchanged != 1 || result.Created != 1 {
+		t.Errorf("Expected 2 updated, 1 unchanged and 1 created products, got %+v", result)
+	}
+	want := &models.ImageSyncResult{Changed: 3, Downloaded: 1, Failed: 1, Bytes: int64(len(expected[2]))}
+	if !reflect.DeepEqual(result.Images, want) {
+		t.Errorf("Expected image stats %+v, got %+v", want, result.Images)
+	}
+	if image := media.Images[2]; image.ContentType != "image/jpeg" || image.Handle != "pine-desk" || len(media.Images) != 1 {
+		t.Errorf("Expected only the new desk picture to be stored, got %+v", media.Images)
+	}
+	if !reflect.DeepEqual(media.Deleted, []int{3}) {
+		t.Errorf("Expected the cleared lamp picture to be removed, got %v", media.Deleted)
+	}
+	if len(result.Warnings) != 1 || result.Status != models.SyncStatusOK {
+		t.Errorf("Expected the failed download to be a warning, got %+v", result)
+	}
+}
@@ -3,11 +3,19 @@ package repo
 import (
 	"context"
 	"go-cron/models"
+	"time"
 )
 
 // ProductRepositoryInterface defines the interface for product repository operations
 type ProductRepositoryInterface interface {
 	GetAllProducts(ctx context.Context) ([]models.Product, error)
+	GetProductsPaged(ctx context.Context, offset, limit int) ([]models.Product, error)
+	FindProducts(ctx context.Context, filter models.ProductFilter, offset, limit int) ([]models.Product, error)
+	CountMatchingProducts(ctx context.Context, filter models.ProductFilter) (int, error)
+	SearchProducts(ctx context.Context, query string, limit int) ([]models.Product, error)
+	GetProductsByTitles(ctx context.Context, titles []string) ([]models.Product, error)
+	CountProducts(ctx context.Context) (int, error)
+	CountActiveProducts(ctx context.Context) (int, error)
 	GetProductByTitle(ctx context.Context, title string) (*models.Product, error)
 	CreateProduct(ctx context.Context, title, handle string) (int, error)
 	UpdateProduct(ctx context.Context, id int, title, handle string) error
@@ -16,8 +24,130 @@ type ProductRepositoryInterface interface {
 		ID     int
 		Title  string
 		Handle string
-	}) error
+		Fields ProductFields
+		// Version, when set, skips the row unless it still has this version
+		Version int
+	}) ([]int, error)
+	SaveRawTitles(ctx context.Context, rawTitles map[int]string) error
+	SaveCategories(ctx context.Context, categories map[int]string) ([]int, error)
+	SavePrices(ctx context.Context, prices map[int]models.ProductPrice) ([]int, error)
+	CheckIntegrity(ctx context.Context) (*models.IntegrityReport, error)
+	ArchiveProductsBatch(ctx context.Context, ids []int) ([]int, error)
+	ReactivateProductsBatch(ctx context.Context, ids []int) (int, error)
+	DeleteProducts(ctx context.Context, ids []int) (int, error)
+}
+
+// SinkMappingRepositoryInterface defines the interface for product ↔ sink ID mapping operations
+type SinkMappingRepositoryInterface interface {
+	GetSinkMapping(ctx context.Context, sink string, productID int) (*models.SinkMapping, error)
+	SaveSinkMapping(ctx context.Context, m models.SinkMapping) error
+	DeleteSinkMapping(ctx context.Context, sink string, productID int) error
+}
+
+// MediaRepositoryInterface defines the interface for product picture operations
+type MediaRepositoryInterface interface {
+	SaveImageURLs(ctx context.Context, urls map[int]string) ([]int, error)
+	SaveImage(ctx context.Context, image models.ProductImage) error
+	GetImage(ctx context.Context, productID int) (*models.ProductImage, error)
+	DeleteImages(ctx context.Context, ids []int) (int, error)
+}
+
+// ImageFetcher downloads a picture and returns it with its content type
+type ImageFetcher interface {
+	FetchImage(ctx context.Context, url string) ([]byte, string, error)
+}
+
+// RunRepositoryInterface defines the interface for sync run record operations
+type RunRepositoryInterface interface {
+	StartRun(ctx context.Context, run *models.SyncRun) (int, error)
+	FinishRun(ctx context.Context, run *models.SyncRun) error
+	GetLastRun(ctx context.Context) (*models.SyncRun, error)
+	GetLastSuccessfulRun(ctx context.Context) (*models.SyncRun, error)
+	GetLastSuccessfulCatalogRun(ctx context.Context) (*models.SyncRun, error)
+	ListRuns(ctx context.Context, limit int) ([]models.SyncRun, error)
+}
+
+// OutboxRepositoryInterface defines the interface for change outbox operations
+type OutboxRepositoryInterface interface {
+	EnqueueChanges(ctx context.Context, changes []models.Change, sinks []string) error
+	PendingDeliveries(ctx context.Context, sink string, limit int) ([]models.Delivery, error)
+	MarkDelivered(ctx context.Context, changeID int64, sink string) error
+	MarkFailed(ctx context.Context, changeID int64, sink string, reason string) error
+	ResetFailed(ctx context.Context, sink string) (int, error)
+	SinkLag(ctx context.Context) ([]models.SinkLag, error)
+}
+
+// AuditRepositoryInterface defines the interface for product change log operations
+type AuditRepositoryInterface interface {
+	RecordChanges(ctx context.Context, changes []models.ProductChange) error
+	ListChangesByProduct(ctx context.Context, productID, limit int) ([]models.ProductChange, error)
+	ListChangesByRun(ctx context.Context, runID, limit int) ([]models.ProductChange, error)
+}
+
+// ShardRepositoryInterface defines the interface for sharded sync bookkeeping
+type ShardRepositoryInterface interface {
+	ClaimShard(ctx context.Context, shards, requested int, staleAfter time.Duration) (*models.ShardAssignment, error)
+	FinishShard(ctx context.Context, a models.ShardAssignment, runID int, status string, result *models.SyncResult) (*models.ShardProgress, error)
+}
+
+// IdempotencyRepositoryInterface defines the interface for idempotency key operations
+type IdempotencyRepositoryInterface interface {
+	Reserve(ctx context.Context, key string, ttl, staleAfter time.Duration) (*models.IdempotencyRecord, error)
+	Complete(ctx context.Context, key string, statusCode int, response []byte) error
+	Release(ctx context.Context, key string) error
+	PurgeIdempotencyKeys(ctx context.Context, ttl time.Duration) (int, error)
+}
+
+// WatermarkRepositoryInterface defines the interface for sync watermark operations
+type WatermarkRepositoryInterface interface {
+	GetWatermark(ctx context.Context, entity string) (*models.SyncWatermark, error)
+	AdvanceWatermark(ctx context.Context, entity, mode string, syncedAt time.Time) error
+}
+
+// PlanRepositoryInterface defines the interface for sync plans held for approval
+type PlanRepositoryInterface interface {
+	SavePlan(ctx context.Context, plan *SyncPlan) (int, error)
+	GetPlan(ctx context.Context, id int) (*StoredPlan, error)
+	ApprovePlan(ctx context.Context, id int, ttl, staleAfter time.Duration) (*StoredPlan, error)
+	RejectPlan(ctx context.Context, id int) (*StoredPlan, error)
+	FinishPlan(ctx context.Context, id int, status string, result *models.SyncResult) error
+}
+
+// HandleRepositoryInterface defines the interface for handle repair operations
+type HandleRepositoryInterface interface {
+	GetAllProducts(ctx context.Context) ([]models.Product, error)
+	SaveHandles(ctx context.Context, handles map[int]string) (int, error)
 }
 
 // Ensure ProductRepository implements the interface
 var _ ProductRepositoryInterface = (*ProductRepository)(nil)
+
+// Ensure ProductRepository implements the handle repair interface
+var _ HandleRepositoryInterface = (*ProductRepository)(nil)
+
+// Ensure SinkMappingRepository implements the interface
+var _ SinkMappingRepositoryInterface = (*SinkMappingRepository)(nil)
+
+// Ensure MediaRepository implements the interface
+var _ MediaRepositoryInterface = (*MediaRepository)(nil)
+
+// Ensure RunRepository implements the interface
+var _ RunRepositoryInterface = (*RunRepository)(nil)
+
+// Ensure OutboxRepository implements the interface
+var _ OutboxRepositoryInterface = (*OutboxRepository)(nil)
+
+// Ensure AuditRepository implements the interface
+var _ AuditRepositoryInterface = (*AuditRepository)(nil)
+
+// Ensure ShardRepository implements the interface
+var _ ShardRepositoryInterface = (*ShardRepository)(nil)
+
+// Ensure IdempotencyRepository implements the interface
+var _ IdempotencyRepositoryInterface = (*IdempotencyRepository)(nil)
+
+// Ensure WatermarkRepository implements the interface
+var _ WatermarkRepositoryInterface = (*WatermarkRepository)(nil)
+
+// Ensure PlanRepository implements the interface
+var _ PlanRepositoryInterface = (*PlanRepository)(nil)
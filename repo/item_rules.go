@@ -0,0 +1,84 @@
+package repo
+
+import (
+	"fmt"
+	"go-cron/models"
+	"regexp"
+	"strings"
+)
+
+// ItemFilter selects the items synced by the rules of a models.ItemRules
+type ItemFilter struct {
+	includeCodes    map[string]bool
+	excludeCodes    map[string]bool
+	includePrefixes []string
+	excludePrefixes []string
+	includeNames    *regexp.Regexp
+	excludeNames    *regexp.Regexp
+}
+
+// NewItemFilter compiles rules into a filter
+func NewItemFilter(rules models.ItemRules) (*ItemFilter, error) {
+	f := &ItemFilter{
+		includeCodes:    codeSet(rules.IncludeCodes),
+		excludeCodes:    codeSet(rules.ExcludeCodes),
+		includePrefixes: rules.IncludePrefixes,
+		excludePrefixes: rules.ExcludePrefixes,
+	}
+	var err error
+	if rules.IncludeNamePattern != "" {
+		if f.includeNames, err = regexp.Compile(rules.IncludeNamePattern); err != nil {
+			return nil, fmt.Errorf("invalid include name pattern: %w", err)
+		}
+	}
+	if rules.ExcludeNamePattern != "" {
+		if f.excludeNames, err = regexp.Compile(rules.ExcludeNamePattern); err != nil {
+			return nil, fmt.Errorf("invalid exclude name pattern: %w", err)
+		}
+	}
+	return f, nil
+}
+
+// codeSet returns the set of codes
+func codeSet(codes []string) map[string]bool {
+	set := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		set[code] = true
+	}
+	return set
+}
+
+// hasAnyPrefix reports whether s starts with one of prefixes
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows reports whether item is synced: it matches an include rule, or
+// there are none, and matches no exclude rule
+func (f *ItemFilter) Allows(item models.ExternalItem) bool {
+	if f.excludeCodes[item.ItemCode] || hasAnyPrefix(item.ItemCode, f.excludePrefixes) ||
+		(f.excludeNames != nil && f.excludeNames.MatchString(item.ItemName)) {
+		return false
+	}
+	if len(f.includeCodes) == 0 && len(f.includePrefixes) == 0 && f.includeNames == nil {
+		return true
+	}
+	return f.includeCodes[item.ItemCode] || hasAnyPrefix(item.ItemCode, f.includePrefixes) ||
+		(f.includeNames != nil && f.includeNames.MatchString(item.ItemName))
+}
+
+// Filter returns the items allowed by f, in order, and the number skipped
+func (f *ItemFilter) Filter(items []models.ExternalItem) ([]models.ExternalItem, int) {
+	kept := make([]models.ExternalItem, 0, len(items))
+	for _, item := range items {
+		if f.Allows(item) {
+			kept = append(kept, item)
+		}
+	}
+	return kept, len(items) - len(kept)
+}
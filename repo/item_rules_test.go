@@ -0,0 +1,94 @@
+package repo
+
+import (
+	"context"
+	"go-cron/models"
+	"testing"
+)
+
+// Test_ItemFilter_Allows tests that include rules select items and exclude
+// rules win over them
+func Test_ItemFilter_Allows(t *testing.T) {
+	filter, err := NewItemFilter(models.ItemRules{
+		IncludePrefixes:    []string{"A"},
+		IncludeCodes:       []string{"B001"},
+		ExcludeCodes:       []string{"A002"},
+		ExcludeNamePattern: `(?i)\bsample\b`,
+	})
+	if err != nil {
+		t.Fatalf("NewItemFilter failed: %v", err)
+	}
+
+	tests := []struct {
+		item models.ExternalItem
+		want bool
+	}{
+		{models.ExternalItem{ItemCode: "A001", ItemName: "Widget"}, true},
+		{models.ExternalItem{ItemCode: "B001", ItemName: "Gadget"}, true},
+		{models.ExternalItem{ItemCode: "B002", ItemName: "Gadget"}, false},
+		{models.ExternalItem{ItemCode: "A002", ItemName: "Widget"}, false},
+		{models.ExternalItem{ItemCode: "A003", ItemName: "Widget Sample"}, false},
+	}
+	for _, tt := range tests {
+		if got := filter.Allows(tt.item); got != tt.want {
+			t.Errorf("Allows(%s %q) = %v, want %v", tt.item.ItemCode, tt.item.ItemName, got, tt.want)
+		}
+	}
+}
+
+// Test_ItemFilter_ExcludeOnly tests that without include rules every item not
+// excluded is allowed
+func Test_ItemFilter_ExcludeOnly(t *testing.T) {
+	filter, err := NewItemFilter(models.ItemRules{ExcludePrefixes: []string{"TMP-"}})
+	if err != nil {
+		t.Fatalf("NewItemFilter failed: %v", err)
+	}
+	kept, skipped := filter.Filter([]models.ExternalItem{{ItemCode: "A001"}, {ItemCode: "TMP-1"}, {ItemCode: "B001"}})
+	if skipped != 1 || len(kept) != 2 || kept[0].ItemCode != "A001" || kept[1].ItemCode != "B001" {
+		t.Errorf("Expected A001 and B001 kept and 1 skipped, got %+v and %d", kept, skipped)
+	}
+}
+
+// Test_NewItemFilter_InvalidPattern tests that a bad name pattern is rejected
+func Test_NewItemFilter_InvalidPattern(t *testing.T) {
+	if _, err := NewItemFilter(models.ItemRules{IncludeNamePattern: "("}); err == nil {
+		t.Error("Expected an invalid pattern to fail")
+	}
+}
+
+// Test_SyncService_CompareAndSync_ItemFilter tests that skipped items are
+// counted and not written
+func Test_SyncService_CompareAndSync_ItemFilter(t *testing.T) {
+	var created []string
+	mockRepo := &MockProductRepository{
+		GetAllProductsFunc: func(ctx context.Context) ([]models.Product, error) {
+			return nil, nil
+		},
+		CreateProductsBatchFunc: func(ctx context.Context, products []struct{ Title, Handle string }) error {
+			for _, p := range products {
+				created = append(created, p.Title)
+			}
+			return nil
+		},
+	}
+	filter, err := NewItemFilter(models.ItemRules{ExcludeCodes: []string{"B001"}})
+	if err != nil {
+		t.Fatalf("NewItemFilter failed: %v", err)
+	}
+	syncService := NewSyncService(mockRepo)
+	syncService.SetItemFilter(filter)
+
+	result, err := syncService.CompareAndSync(context.Background(), []models.ExternalItem{
+		{ItemName: "Product A", ItemCode: "A001"},
+		{ItemName: "Product B", ItemCode: "B001"},
+	})
+	if err != nil {
+		t.Fatalf("CompareAndSync failed: %v", err)
+	}
+	if result.Skipped != 1 || result.Created != 1 {
+		t.Errorf("Expected 1 item skipped and 1 created, got %d and %d", result.Skipped, result.Created)
+	}
+	if len(created) != 1 || created[0] != "Product A" {
+		t.Errorf("Expected only Product A to be created, got %v", created)
+	}
+}
@@ -0,0 +1,240 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-cron/models"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrJobNotClaimable is returned by ClaimJob when the job is finished or
+// another invocation is running it
+var ErrJobNotClaimable = errors.New("job is not claimable")
+
+// JobRepository persists async sync jobs, so the invocation that enqueued a
+// job, the one running it and the ones polling it need not be the same
+type JobRepository struct {
+	db  *sql.DB
+	now func() time.Time
+}
+
+// NewJobRepository creates a new job repository
+func NewJobRepository(db *sql.DB) *JobRepository {
+	return &JobRepository{db: db, now: time.Now}
+}
+
+// SetClock replaces the time source of job timestamps
+func (r *JobRepository) SetClock(now func() time.Time) {
+	r.now = now
+}
+
+// EnqueueJob inserts a queued job with opts and returns it
+func (r *JobRepository) EnqueueJob(ctx context.Context, opts models.JobOptions) (*models.SyncJob, error) {
+	encoded, err := json.Marshal(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode job options: %w", err)
+	}
+
+	job := &models.SyncJob{Status: models.JobStatusQueued, Options: opts, CreatedAt: r.now().UTC()}
+	err = r.db.QueryRowContext(ctx, `
+		INSERT INTO sync_jobs (status, options, attempts, created_at)
+		VALUES ($1, $2, 0, $3)
+		RETURNING id`, job.Status, encoded, job.CreatedAt).Scan(&job.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to enqueue sync job: %w", err)
+	}
+	return job, nil
+}
+
+// jobColumns are the sync_jobs columns read by scanJob
+const jobColumns = `id, status, options, COALESCE(run_id, 0), progress, result, COALESCE(error, ''),
+	attempts, created_at, started_at, finished_at, heartbeat_at`
+
+// GetJob returns the job with id, or nil when it does not exist
+func (r *JobRepository) GetJob(ctx context.Context, id int) (*models.SyncJob, error) {
+	job, err := scanJob(r.db.QueryRowContext(ctx, `SELECT `+jobColumns+` FROM sync_jobs WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return job, err
+}
+
+// ClaimJob marks the job as running for the caller and returns it. A queued
+// job can be claimed, and so can a running one that sent no heartbeat within
+// staleAfter, presumed dead with its invocation. Otherwise ClaimJob returns
+// ErrJobNotClaimable, or nil when the job does not exist.
+func (r *JobRepository) ClaimJob(ctx context.Context, id int, staleAfter time.Duration) (*models.SyncJob, error) {
+	now := r.now().UTC()
+	job, err := scanJob(r.db.QueryRowContext(ctx, `
+		UPDATE sync_jobs
+		SET status = $2, started_at = $3, heartbeat_at = $3, attempts = attempts + 1
+		WHERE id = $1
+		  AND (status = $4 OR (status = $2 AND heartbeat_at < $5))
+		RETURNING `+jobColumns,
+		id, models.JobStatusRunning, now, models.JobStatusQueued, now.Add(-staleAfter)))
+	if !errors.Is(err, sql.ErrNoRows) {
+		return job, err
+	}
+
+	existing, err := r.GetJob(ctx, id)
+	if err != nil || existing == nil {
+		return nil, err
+	}
+	return nil, ErrJobNotClaimable
+}
+
+// SetJobRun links the job to the sync run executing it
+func (r *JobRepository) SetJobRun(ctx context.Context, id, runID int) error {
+	if _, err := r.db.ExecContext(ctx, `UPDATE sync_jobs SET run_id = $2 WHERE id = $1`, id, runID); err != nil {
+		return fmt.Errorf("failed to link sync job to its run: %w", err)
+	}
+	return nil
+}
+
+// ReportProgress stores the progress of a running job, which doubles as its
+// heartbeat; a nil progress only sends the heartbeat
+func (r *JobRepository) ReportProgress(ctx context.Context, id int, progress *models.JobProgress) error {
+	var encoded []byte
+	if progress != nil {
+		var err error
+		if encoded, err = json.Marshal(progress); err != nil {
+			return fmt.Errorf("failed to encode job progress: %w", err)
+		}
+	}
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE sync_jobs SET progress = COALESCE($2, progress), heartbeat_at = $3
+		WHERE id = $1 AND status = $4`, id, encoded, r.now().UTC(), models.JobStatusRunning)
+	if err != nil {
+		return fmt.Errorf("failed to report job progress: %w", err)
+	}
+	return nil
+}
+
+// FinishJob stores the final status, result and error of a job
+func (r *JobRepository) FinishJob(ctx context.Context, job *models.SyncJob) error {
+	var result []byte
+	if job.Result != nil {
+		var err error
+		if result, err = json.Marshal(job.Result); err != nil {
+			return fmt.Errorf("failed to encode sync result: %w", err)
+		}
+	}
+
+	finishedAt := r.now().UTC()
+	job.FinishedAt = &finishedAt
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE sync_jobs
+		SET status = $2, result = $3, error = $4, finished_at = $5, heartbeat_at = $5
+		WHERE id = $1`, job.ID, job.Status, result, job.Error, finishedAt)
+	if err != nil {
+		return fmt.Errorf("failed to finish sync job: %w", err)
+	}
+	return nil
+}
+
+// scanJob reads the jobColumns of a row into a job
+func scanJob(row interface {
+	Scan(dest ...interface{}) error
+}) (*models.SyncJob, error) {
+	var job models.SyncJob
+	var options, progress, result []byte
+	var startedAt, finishedAt, heartbeatAt sql.NullTime
+	err := row.Scan(&job.ID, &job.Status, &options, &job.RunID, &progress, &result, &job.Error,
+		&job.Attempts, &job.CreatedAt, &startedAt, &finishedAt, &heartbeatAt)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan sync job: %w", err)
+	}
+
+	job.CreatedAt = job.CreatedAt.UTC()
+	job.StartedAt, job.FinishedAt, job.HeartbeatAt = nullTime(startedAt), nullTime(finishedAt), nullTime(heartbeatAt)
+	if len(options) > 0 {
+		if err := json.Unmarshal(options, &job.Options); err != nil {
+			return nil, fmt.Errorf("failed to decode job options: %w", err)
+		}
+	}
+	if len(progress) > 0 {
+		job.Progress = &models.JobProgress{}
+		if err := json.Unmarshal(progress, job.Progress); err != nil {
+			return nil, fmt.Errorf("failed to decode job progress: %w", err)
+		}
+	}
+	if len(result) > 0 {
+		job.Result = &models.SyncResult{}
+		if err := json.Unmarshal(result, job.Result); err != nil {
+			return nil, fmt.Errorf("failed to decode sync result: %w", err)
+		}
+	}
+	return &job, nil
+}
+
+// nullTime returns the UTC time of t, or nil when it is NULL
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	utc := t.Time.UTC()
+	return &utc
+}
+
+// Heartbeat reports the progress of the running job every interval until the
+// returned stop function is called, and once more then. The ProgressFunc
+// only records the latest phase, so it never blocks the writers; reports are
+// sent even without new progress so a long fetch keeps the job alive.
+func (r *JobRepository) Heartbeat(ctx context.Context, id int, interval time.Duration) (ProgressFunc, func()) {
+	return pumpProgress(interval, func(progress *models.JobProgress) {
+		if err := r.ReportProgress(ctx, id, progress); err != nil {
+			log.Printf("Job %d heartbeat failed: %v\n", id, err)
+		}
+	})
+}
+
+// pumpProgress calls report with the latest progress, nil before the first
+// one, every interval and once more when stopped
+func pumpProgress(interval time.Duration, report func(*models.JobProgress)) (ProgressFunc, func()) {
+	var mu sync.Mutex
+	var latest *models.JobProgress
+	snapshot := func() *models.JobProgress {
+		mu.Lock()
+		defer mu.Unlock()
+		return latest
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				report(snapshot())
+				return
+			case <-ticker.C:
+				report(snapshot())
+			}
+		}
+	}()
+
+	progress := func(phase string, n, total int) {
+		mu.Lock()
+		latest = &models.JobProgress{Phase: phase, Done: n, Total: total}
+		mu.Unlock()
+	}
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			close(done)
+			<-stopped
+		})
+	}
+	return progress, stop
+}
@@ -0,0 +1,39 @@
+package repo
+
+import (
+	"go-cron/models"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Test_pumpProgress tests that heartbeats carry the latest progress and a final report is sent on stop
+func Test_pumpProgress(t *testing.T) {
+	var mu sync.Mutex
+	var reports []*models.JobProgress
+	progress, stop := pumpProgress(time.Millisecond, func(p *models.JobProgress) {
+		mu.Lock()
+		reports = append(reports, p)
+		mu.Unlock()
+	})
+
+	// Heartbeats flow before any progress is reported
+	time.Sleep(10 * time.Millisecond)
+	progress(PhaseUpdate, 10, 100)
+	progress(PhaseUpdate, 20, 100)
+	stop()
+	stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(reports) < 2 {
+		t.Fatalf("Expected heartbeats and a final report, got %d reports", len(reports))
+	}
+	if reports[0] != nil {
+		t.Errorf("Expected no progress before the first phase, got %+v", reports[0])
+	}
+	last := reports[len(reports)-1]
+	if last == nil || *last != (models.JobProgress{Phase: PhaseUpdate, Done: 20, Total: 100}) {
+		t.Errorf("Expected the final report to carry the latest progress, got %+v", last)
+	}
+}
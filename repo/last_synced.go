@@ -0,0 +1,71 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"go-cron/models"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// SyncMarker is implemented by repositories that record when a sync last
+// found the item of a product in the feed
+type SyncMarker interface {
+	MarkSynced(ctx context.Context, handles []string) error
+}
+
+// MarkSynced sets the last_synced_at of the products identified by handles to now
+func (r *ProductRepository) MarkSynced(ctx context.Context, handles []string) error {
+	if len(handles) == 0 {
+		return nil
+	}
+	ctx, span := startSpan(ctx, "mark_synced", len(handles))
+	defer span.End()
+	ctx, cancel := r.batchContext(ctx, len(handles))
+	defer cancel()
+
+	if _, err := r.db.ExecContext(ctx, r.table.sql(`UPDATE products SET last_synced_at = NOW() WHERE handle = ANY($1)`), pq.Array(handles)); err != nil {
+		return fmt.Errorf("failed to mark products synced: %w", err)
+	}
+	return nil
+}
+
+// MarkSynced sets the last_synced_at of the products identified by handles to now
+func (r *SQLProductRepository) MarkSynced(ctx context.Context, handles []string) error {
+	if len(handles) == 0 {
+		return nil
+	}
+	_, err := r.execEach(ctx, `UPDATE products SET last_synced_at = CURRENT_TIMESTAMP WHERE handle = ?`, len(handles), func(i int) (string, []interface{}) {
+		return handles[i], []interface{}{handles[i]}
+	})
+	return err
+}
+
+// MarkSynced marks products synced through the wrapped repository, when it
+// can, and drops the cached catalog
+func (r *CachingProductRepository) MarkSynced(ctx context.Context, handles []string) error {
+	marker, ok := r.ProductRepositoryInterface.(SyncMarker)
+	if !ok {
+		return nil
+	}
+	defer r.cache.invalidate(r.key)
+	return marker.MarkSynced(ctx, handles)
+}
+
+var (
+	_ SyncMarker = (*ProductRepository)(nil)
+	_ SyncMarker = (*SQLProductRepository)(nil)
+	_ SyncMarker = (*CachingProductRepository)(nil)
+)
+
+// syncedSince reports whether product was last synced after item was last
+// updated. SAP's UpdateDate has no time of day, so the product must have been
+// synced after the whole day of the update, with the overlap of incremental
+// syncs for the timezone of the server.
+func syncedSince(product *models.Product, item models.ExternalItem) bool {
+	if product.LastSyncedAt == nil || item.UpdateDate.IsZero() {
+		return false
+	}
+	return product.LastSyncedAt.After(item.UpdateDate.Add(24*time.Hour + incrementalOverlap))
+}
@@ -0,0 +1,67 @@
+package repo
+
+import (
+	"context"
+	"go-cron/models"
+	"testing"
+	"time"
+)
+
+// markingProductRepository records the handles marked as synced
+type markingProductRepository struct {
+	*MockProductRepository
+	marked []string
+}
+
+func (m *markingProductRepository) MarkSynced(ctx context.Context, handles []string) error {
+	m.marked = append(m.marked, handles...)
+	return nil
+}
+
+// Test_SyncService_CompareAndSync_SkipSynced tests that items not updated
+// since their product was last synced are skipped, and that the found
+// products are marked as synced
+func Test_SyncService_CompareAndSync_SkipSynced(t *testing.T) {
+	lastSynced := time.Date(2024, 1, 20, 8, 0, 0, 0, time.UTC)
+	var updated []string
+	mockRepo := &markingProductRepository{MockProductRepository: &MockProductRepository{
+		GetAllProductsFunc: func(ctx context.Context) ([]models.Product, error) {
+			return []models.Product{
+				{ID: 1, Title: "Old Tea", Handle: "tea", Status: models.ProductStatusActive, LastSyncedAt: &lastSynced},
+				{ID: 2, Title: "Old Mug", Handle: "mug", Status: models.ProductStatusActive, LastSyncedAt: &lastSynced},
+			}, nil
+		},
+		UpdateProductsBatchFunc: func(ctx context.Context, updates []struct {
+			ID      int
+			Title   string
+			Handle  string
+			Fields  ProductFields
+			Version int
+		}) error {
+			for _, u := range updates {
+				updated = append(updated, u.Handle)
+			}
+			return nil
+		},
+	}}
+	items := []models.ExternalItem{
+		// Updated days before the last sync: already synced
+		{ItemCode: "A", ItemName: "OLD TEA", UpdateDate: time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)},
+		// Updated the day before: may have changed after the sync, in the server's timezone
+		{ItemCode: "B", ItemName: "OLD MUG", UpdateDate: time.Date(2024, 1, 19, 0, 0, 0, 0, time.UTC)},
+	}
+
+	opts := DefaultSyncOptions()
+	opts.UpdateHandles = false
+	opts.SkipSynced = true
+	result, err := NewSyncService(mockRepo).CompareAndSyncWith(context.Background(), items, opts)
+	if err != nil {
+		t.Fatalf("CompareAndSync failed: %v", err)
+	}
+	if len(updated) != 1 || updated[0] != "mug" || result.Unchanged != 1 {
+		t.Errorf("Expected only the mug to be updated and the tea skipped, got %v and %d unchanged", updated, result.Unchanged)
+	}
+	if len(mockRepo.marked) != 1 || mockRepo.marked[0] != "mug" {
+		t.Errorf("Expected the mug to be marked as synced, got %v", mockRepo.marked)
+	}
+}
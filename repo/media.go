@@ -0,0 +1,116 @@
+package repo
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"go-cron/models"
+
+	"github.com/lib/pq"
+)
+
+// saveImageURLSQL stores the picture URL $2 of the product with ID $1, an
+// empty URL clearing it
+const saveImageURLSQL = `
+		UPDATE products SET image_url = NULLIF($2, ''), updated_at = NOW(), version = version + 1
+		WHERE id = $1 AND COALESCE(image_url, '') <> $2`
+
+// saveImageSQL stores a downloaded picture, replacing the previous one of the product
+const saveImageSQL = `
+		INSERT INTO product_images (product_id, handle, url, content_type, data, sha256, fetched_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+		ON CONFLICT (product_id) DO UPDATE SET handle = EXCLUDED.handle, url = EXCLUDED.url,
+			content_type = EXCLUDED.content_type, data = EXCLUDED.data, sha256 = EXCLUDED.sha256,
+			fetched_at = EXCLUDED.fetched_at`
+
+// MediaRepository stores the pictures of products: their URL on the product
+// and, when downloaded, the picture itself in product_images
+type MediaRepository struct {
+	db    *sql.DB
+	table productsTable
+}
+
+// NewMediaRepository creates a new media repository
+func NewMediaRepository(db *sql.DB) *MediaRepository {
+	return &MediaRepository{db: db}
+}
+
+// SaveImageURLs stores the picture URLs of the products identified by ID (map
+// of product ID to URL) and returns the IDs whose URL changed
+func (r *MediaRepository) SaveImageURLs(ctx context.Context, urls map[int]string) ([]int, error) {
+	if len(urls) == 0 {
+		return nil, nil
+	}
+
+	ctx, span := startSpan(ctx, "save_image_urls", len(urls))
+	defer span.End()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, r.table.sql(saveImageURLSQL))
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	var changed []int
+	for id, url := range urls {
+		res, err := stmt.ExecContext(ctx, id, url)
+		if err != nil {
+			return nil, fmt.Errorf("failed to save picture URL of product %d: %w", id, err)
+		}
+		if n, err := res.RowsAffected(); err == nil && n > 0 {
+			changed = append(changed, id)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return changed, nil
+}
+
+// SaveImage stores a downloaded picture, computing its digest
+func (r *MediaRepository) SaveImage(ctx context.Context, image models.ProductImage) error {
+	sum := sha256.Sum256(image.Data)
+	image.SHA256 = hex.EncodeToString(sum[:])
+	if _, err := r.db.ExecContext(ctx, saveImageSQL, image.ProductID, image.Handle, image.URL, image.ContentType, image.Data, image.SHA256); err != nil {
+		return fmt.Errorf("failed to save picture of %s: %w", image.Handle, err)
+	}
+	return nil
+}
+
+// GetImage returns the stored picture of the product with ID productID, or nil
+func (r *MediaRepository) GetImage(ctx context.Context, productID int) (*models.ProductImage, error) {
+	image := models.ProductImage{ProductID: productID}
+	err := r.db.QueryRowContext(ctx, `SELECT handle, url, content_type, data, sha256 FROM product_images WHERE product_id = $1`, productID).
+		Scan(&image.Handle, &image.URL, &image.ContentType, &image.Data, &image.SHA256)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get picture of product %d: %w", productID, err)
+	}
+	return &image, nil
+}
+
+// DeleteImages removes the stored pictures of the products with IDs ids and
+// returns how many were removed
+func (r *MediaRepository) DeleteImages(ctx context.Context, ids []int) (int, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	res, err := r.db.ExecContext(ctx, `DELETE FROM product_images WHERE product_id = ANY($1)`, pq.Array(ids))
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete pictures: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
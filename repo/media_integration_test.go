@@ -0,0 +1,45 @@
+package repo
+
+import (
+	"context"
+	"go-cron/models"
+	"testing"
+)
+
+// Test_MediaRepository tests storing picture URLs on products and the
+// downloaded pictures next to them
+func Test_MediaRepository(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+	ids := seedProducts(t, db, productCreate{Title: "Oak Chair", Handle: "oak-chair"})
+	r := NewMediaRepository(db)
+
+	changed, err := r.SaveImageURLs(ctx, map[int]string{ids[0]: "https://img.example.com/oak.jpg"})
+	if err != nil || len(changed) != 1 {
+		t.Fatalf("Expected the new URL to be reported, got %v (%v)", changed, err)
+	}
+	if changed, err = r.SaveImageURLs(ctx, map[int]string{ids[0]: "https://img.example.com/oak.jpg"}); err != nil || len(changed) != 0 {
+		t.Errorf("Expected an unchanged URL not to be reported, got %v (%v)", changed, err)
+	}
+	p, err := NewProductRepository(db).GetProductByTitle(ctx, "Oak Chair")
+	if err != nil || p.Image != "https://img.example.com/oak.jpg" {
+		t.Fatalf("Expected the stored URL, got %+v (%v)", p, err)
+	}
+
+	for _, data := range []string{"first", "second"} {
+		if err := r.SaveImage(ctx, models.ProductImage{ProductID: ids[0], Handle: "oak-chair", URL: p.Image, ContentType: "image/jpeg", Data: []byte(data)}); err != nil {
+			t.Fatalf("SaveImage failed: %v", err)
+		}
+	}
+	image, err := r.GetImage(ctx, ids[0])
+	if err != nil || image == nil || string(image.Data) != "second" || image.Handle != "oak-chair" || len(image.SHA256) != 64 {
+		t.Fatalf("Expected the replaced picture, got %+v (%v)", image, err)
+	}
+
+	if n, err := r.DeleteImages(ctx, []int{ids[0], ids[0] + 1}); err != nil || n != 1 {
+		t.Errorf("Expected one picture to be deleted, got %d (%v)", n, err)
+	}
+	if image, err := r.GetImage(ctx, ids[0]); err != nil || image != nil {
+		t.Errorf("Expected no picture after deleting, got %+v (%v)", image, err)
+	}
+}
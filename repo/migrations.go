@@ -0,0 +1,305 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// migration is a versioned change of the Postgres schema. Its statements are
+// idempotent, so a database whose tables were created by hand, or by a
+// release from before the migrations, is brought up to date without errors.
+type migration struct {
+	version int
+	name    string
+	ddl     []string
+}
+
+// migrationsLock is the advisory lock serializing the migrations of
+// instances starting at the same time
+const migrationsLock = 7215017
+
+// migrationsTable records the migrations applied. The versions are kept per
+// products table, as deployments sharing a database may each have their own.
+const migrationsTable = `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		products_table TEXT NOT NULL,
+		version        INTEGER NOT NULL,
+		name           TEXT NOT NULL,
+		applied_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		PRIMARY KEY (products_table, version)
+	)`
+
+// migrations are the changes of the schema, in the order they are applied.
+// Append new ones; a released migration must never change. The unique handle
+// identifies the product of an item, the title_key index serves the lookups
+// by normalized title and the GIN index the product search. search_vector
+// stays NULL on existing products until they are reindexed with gocron
+// reindex-search; title_key is filled by the first lookup.
+var migrations = []migration{
+	{1, "products", []string{`
+		CREATE TABLE IF NOT EXISTS products (
+			id             SERIAL PRIMARY KEY,
+			title          TEXT NOT NULL,
+			handle         TEXT,
+			status         TEXT NOT NULL DEFAULT 'active',
+			archived_at    TIMESTAMPTZ,
+			category       TEXT,
+			raw_title      TEXT,
+			price          NUMERIC(19, 6),
+			currency       TEXT,
+			image_url      TEXT,
+			search_vector  TSVECTOR,
+			created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			updated_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			last_synced_at TIMESTAMPTZ,
+			version        INTEGER NOT NULL DEFAULT 1,
+			locked         BOOLEAN NOT NULL DEFAULT FALSE,
+			missing_since  TIMESTAMPTZ,
+			missing_runs   INTEGER NOT NULL DEFAULT 0
+		)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS products_handle_key ON products (handle)`,
+		`CREATE INDEX IF NOT EXISTS products_title_key ON products (LOWER(TRIM(title)))`,
+	}},
+	{2, "products columns", []string{
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'active'`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS archived_at TIMESTAMPTZ`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS category TEXT`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS raw_title TEXT`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS price NUMERIC(19, 6)`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS currency TEXT`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS image_url TEXT`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS search_vector TSVECTOR`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS last_synced_at TIMESTAMPTZ`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS locked BOOLEAN NOT NULL DEFAULT FALSE`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS missing_since TIMESTAMPTZ`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS missing_runs INTEGER NOT NULL DEFAULT 0`,
+		`CREATE INDEX IF NOT EXISTS products_search_vector ON products USING GIN (search_vector)`,
+	}},
+	{3, "product media and changes", []string{`
+		CREATE TABLE IF NOT EXISTS product_images (
+			handle       TEXT PRIMARY KEY,
+			url          TEXT NOT NULL,
+			content_type TEXT NOT NULL,
+			data         BYTEA NOT NULL,
+			sha256       TEXT NOT NULL,
+			fetched_at   TIMESTAMPTZ NOT NULL
+		)`, `
+		CREATE TABLE IF NOT EXISTS product_changes (
+			id         SERIAL PRIMARY KEY,
+			run_id     INTEGER,
+			product_id INTEGER,
+			action     TEXT NOT NULL,
+			old_title  TEXT,
+			old_handle TEXT,
+			new_title  TEXT,
+			new_handle TEXT,
+			changed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)`,
+		`CREATE INDEX IF NOT EXISTS product_changes_product_id ON product_changes (product_id)`,
+		`CREATE INDEX IF NOT EXISTS product_changes_run_id ON product_changes (run_id)`,
+	}},
+	{4, "sync runs", []string{`
+		CREATE TABLE IF NOT EXISTS sync_runs (
+			id          SERIAL PRIMARY KEY,
+			entity      TEXT NOT NULL,
+			trigger     TEXT NOT NULL,
+			status      TEXT NOT NULL,
+			started_at  TIMESTAMPTZ NOT NULL,
+			finished_at TIMESTAMPTZ,
+			result      JSONB,
+			error       TEXT
+		)`,
+		`CREATE INDEX IF NOT EXISTS sync_runs_started_at ON sync_runs (started_at)`, `
+		CREATE TABLE IF NOT EXISTS sync_watermarks (
+			entity            TEXT PRIMARY KEY,
+			last_sync_at      TIMESTAMPTZ NOT NULL,
+			last_full_sync_at TIMESTAMPTZ
+		)`, `
+		CREATE TABLE IF NOT EXISTS sync_backoff (
+			source          TEXT PRIMARY KEY,
+			failures        INTEGER NOT NULL,
+			next_attempt_at TIMESTAMPTZ NOT NULL,
+			last_error      TEXT
+		)`, `
+		CREATE TABLE IF NOT EXISTS sync_jobs (
+			id           SERIAL PRIMARY KEY,
+			status       TEXT NOT NULL,
+			options      JSONB,
+			run_id       INTEGER,
+			progress     JSONB,
+			result       JSONB,
+			error        TEXT,
+			attempts     INTEGER NOT NULL DEFAULT 0,
+			created_at   TIMESTAMPTZ NOT NULL,
+			started_at   TIMESTAMPTZ,
+			finished_at  TIMESTAMPTZ,
+			heartbeat_at TIMESTAMPTZ
+		)`, `
+		CREATE TABLE IF NOT EXISTS sync_shard_cycles (
+			id           SERIAL PRIMARY KEY,
+			shards       INTEGER NOT NULL,
+			started_at   TIMESTAMPTZ NOT NULL,
+			completed_at TIMESTAMPTZ,
+			report       JSONB
+		)`, `
+		CREATE TABLE IF NOT EXISTS sync_shards (
+			cycle_id    INTEGER NOT NULL REFERENCES sync_shard_cycles (id) ON DELETE CASCADE,
+			shard       INTEGER NOT NULL,
+			status      TEXT NOT NULL,
+			run_id      INTEGER,
+			started_at  TIMESTAMPTZ NOT NULL,
+			finished_at TIMESTAMPTZ,
+			result      JSONB,
+			PRIMARY KEY (cycle_id, shard)
+		)`, `
+		CREATE TABLE IF NOT EXISTS idempotency_keys (
+			key         TEXT PRIMARY KEY,
+			created_at  TIMESTAMPTZ NOT NULL,
+			status_code INTEGER,
+			response    BYTEA
+		)`, `
+		CREATE TABLE IF NOT EXISTS priority_items (
+			item_code TEXT PRIMARY KEY,
+			rank      INTEGER NOT NULL DEFAULT 0
+		)`,
+	}},
+	{5, "outbox and notifications", []string{`
+		CREATE TABLE IF NOT EXISTS outbox (
+			id         BIGSERIAL PRIMARY KEY,
+			action     TEXT NOT NULL,
+			product_id INTEGER,
+			title      TEXT,
+			handle     TEXT,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)`, `
+		CREATE TABLE IF NOT EXISTS outbox_deliveries (
+			change_id    BIGINT NOT NULL REFERENCES outbox (id) ON DELETE CASCADE,
+			sink         TEXT NOT NULL,
+			status       TEXT NOT NULL DEFAULT 'pending',
+			attempts     INTEGER NOT NULL DEFAULT 0,
+			last_error   TEXT,
+			delivered_at TIMESTAMPTZ,
+			PRIMARY KEY (change_id, sink)
+		)`,
+		`CREATE INDEX IF NOT EXISTS outbox_deliveries_pending ON outbox_deliveries (sink, status)`, `
+		CREATE TABLE IF NOT EXISTS notification_digests (
+			route        TEXT PRIMARY KEY,
+			last_sent_at TIMESTAMPTZ NOT NULL
+		)`, `
+		CREATE TABLE IF NOT EXISTS notification_templates (
+			channel TEXT PRIMARY KEY,
+			body    TEXT NOT NULL
+		)`,
+	}},
+	{6, "sync profiles", []string{`
+		CREATE TABLE IF NOT EXISTS sync_profiles (
+			id          SERIAL PRIMARY KEY,
+			version     INTEGER NOT NULL,
+			profile     JSONB NOT NULL,
+			imported_at TIMESTAMPTZ NOT NULL
+		)`,
+	}},
+	{7, "item group categories", []string{`
+		CREATE TABLE IF NOT EXISTS item_group_categories (
+			group_code INTEGER PRIMARY KEY,
+			category   TEXT NOT NULL
+		)`,
+	}},
+	{8, "sink mappings", []string{`
+		CREATE TABLE IF NOT EXISTS sink_mappings (
+			product_id  INTEGER NOT NULL,
+			sink        TEXT NOT NULL,
+			external_id TEXT NOT NULL,
+			PRIMARY KEY (product_id, sink)
+		)`,
+		`ALTER TABLE outbox ADD COLUMN IF NOT EXISTS old_handle TEXT`,
+	}},
+	{9, "sync plans", []string{`
+		CREATE TABLE IF NOT EXISTS sync_plans (
+			id          SERIAL PRIMARY KEY,
+			status      TEXT NOT NULL,
+			plan        JSONB NOT NULL,
+			result      JSONB,
+			created_at  TIMESTAMPTZ NOT NULL,
+			decided_at  TIMESTAMPTZ,
+			finished_at TIMESTAMPTZ
+		)`,
+	}},
+	{10, "title keys", []string{
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS title_key TEXT`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS title_rules TEXT`,
+		`CREATE INDEX IF NOT EXISTS products_title_lookup ON products (title_key)`,
+	}},
+	{11, "change marker indexes", []string{
+		`CREATE INDEX IF NOT EXISTS products_updated_at ON products (updated_at)`,
+		`CREATE INDEX IF NOT EXISTS products_last_synced_at ON products (last_synced_at)`,
+	}},
+	{12, "picture product ids", []string{
+		`ALTER TABLE product_images ADD COLUMN IF NOT EXISTS product_id INTEGER`, `
+		UPDATE product_images i SET product_id = p.id
+		FROM products p WHERE p.handle = i.handle AND i.product_id IS NULL`,
+		`ALTER TABLE product_images DROP CONSTRAINT IF EXISTS product_images_pkey`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS product_images_product_id ON product_images (product_id)`,
+	}},
+}
+
+// EnsureSchema brings the products table, in a schema of its own when one is
+// configured, and the other tables of go-cron up to date by applying the
+// migrations the database is missing. An existing table is only extended, so
+// a table created by hand keeps its own constraint names.
+func (r *ProductRepository) EnsureSchema(ctx context.Context) error {
+	if r.table.schema != "" {
+		if _, err := r.db.ExecContext(ctx, "CREATE SCHEMA IF NOT EXISTS "+pq.QuoteIdentifier(r.table.schema)); err != nil {
+			return fmt.Errorf("failed to create the schema of the products table: %w", err)
+		}
+	}
+	if _, err := r.db.ExecContext(ctx, migrationsTable); err != nil {
+		return fmt.Errorf("failed to create the migrations table: %w", err)
+	}
+	for _, m := range migrations {
+		if err := r.migrate(ctx, m); err != nil {
+			return fmt.Errorf("failed to apply migration %d (%s): %w", m.version, m.name, err)
+		}
+	}
+	return nil
+}
+
+// migrate applies m in a transaction unless it was applied already
+func (r *ProductRepository) migrate(ctx context.Context, m migration) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationsLock); err != nil {
+		return err
+	}
+	var applied int
+	err = tx.QueryRowContext(ctx, `SELECT version FROM schema_migrations WHERE products_table = $1 AND version = $2`,
+		r.table.String(), m.version).Scan(&applied)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	for _, ddl := range m.ddl {
+		if _, err := tx.ExecContext(ctx, r.table.sql(ddl)); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (products_table, version, name) VALUES ($1, $2, $3)`,
+		r.table.String(), m.version, m.name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,93 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// Test_ProductRepository_EnsureSchema tests that the bootstrap applies every
+// migration in order, each statement leaving existing objects alone and each
+// backfill filling only the rows it has not filled yet
+func Test_ProductRepository_EnsureSchema(t *testing.T) {
+	db, err := sql.Open("recording", "")
+	if err != nil {
+		t.Fatalf("failed to open the recording driver: %v", err)
+	}
+	defer db.Close()
+
+	recorder.execs = nil
+	if err := NewProductRepository(db).EnsureSchema(context.Background()); err != nil {
+		t.Fatalf("EnsureSchema failed: %v", err)
+	}
+	var ddl, versions []string
+	for _, exec := range recorder.execs[1:] {
+		switch query := strings.TrimSpace(exec.query); {
+		case strings.HasPrefix(query, "INSERT INTO schema_migrations"):
+			versions = append(versions, fmt.Sprint(exec.args[1]))
+		case !strings.HasPrefix(query, "SELECT pg_advisory_xact_lock"):
+			ddl = append(ddl, query)
+		}
+	}
+	var want []string
+	for i, m := range migrations {
+		if m.version != i+1 {
+			t.Errorf("Expected migration %d to have version %d, got %d", i, i+1, m.version)
+		}
+		want = append(want, fmt.Sprint(m.version))
+		for _, statement := range m.ddl {
+			if !strings.Contains(statement, "IF NOT EXISTS") && !strings.Contains(statement, "IF EXISTS") &&
+				!(strings.HasPrefix(strings.TrimSpace(statement), "UPDATE") && strings.HasSuffix(statement, "IS NULL")) {
+				t.Errorf("Expected every statement to leave existing objects alone, got %q", statement)
+			}
+		}
+	}
+	if !reflect.DeepEqual(versions, want) {
+		t.Errorf("Expected the migrations %v to be recorded, got %v", want, versions)
+	}
+	if !strings.Contains(ddl[1], "UNIQUE INDEX IF NOT EXISTS products_handle_key") {
+		t.Errorf("Expected the unique handle index, got %q", ddl[1])
+	}
+}
+
+// Test_Migrations_Columns tests that the migrations add every column of the
+// products table to tables created before it
+func Test_Migrations_Columns(t *testing.T) {
+	added := map[string]bool{"id": true, "title": true, "handle": true}
+	for _, m := range migrations[1:] {
+		for _, statement := range m.ddl {
+			if match := regexp.MustCompile(`ALTER TABLE products ADD COLUMN IF NOT EXISTS (\w+)`).FindStringSubmatch(statement); match != nil {
+				added[match[1]] = true
+			}
+		}
+	}
+	for _, line := range strings.Split(migrations[0].ddl[0], "\n")[2:] {
+		if column := strings.Fields(line); len(column) > 1 && !added[column[0]] {
+			t.Errorf("Expected a migration adding the %s column", column[0])
+		}
+	}
+}
+
+// Test_ProductsSchema_Columns tests that the tables created in every
+// database have the columns the repositories read
+func Test_ProductsSchema_Columns(t *testing.T) {
+	// The source columns of productColumns, without their COALESCE defaults
+	columns := regexp.MustCompile(`COALESCE\((\w+), [^)]*\) as \w+`).ReplaceAllString(productColumns, "$1")
+	schemas := map[string]string{
+		"postgres":            migrations[0].ddl[0],
+		string(DialectMySQL):  DialectMySQL.productsSchema()[0],
+		string(DialectSQLite): DialectSQLite.productsSchema()[0],
+	}
+	for name, ddl := range schemas {
+		for _, column := range strings.Split(columns, ",") {
+			column = strings.TrimSpace(column)
+			if !regexp.MustCompile(`(?m)^\s*` + column + `\s`).MatchString(ddl) {
+				t.Errorf("Expected the %s products table to have the %s column", name, column)
+			}
+		}
+	}
+}
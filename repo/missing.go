@@ -0,0 +1,189 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/lib/pq"
+)
+
+// MissingTracker is implemented by repositories that count, in the
+// missing_since and missing_runs columns, the consecutive runs whose feed
+// left a product out, so a product is only deleted once it stayed missing
+type MissingTracker interface {
+	// TrackMissing counts one more run missing the products of ids and
+	// clears the count of the other products, back in the feed
+	TrackMissing(ctx context.Context, ids []int) error
+	// MissingRuns returns the consecutive runs missing each product of ids
+	MissingRuns(ctx context.Context, ids []int) (map[int]int, error)
+	// DeleteProductsBatch deletes the products of ids missing from at least
+	// runs consecutive runs and returns the IDs of those deleted
+	DeleteProductsBatch(ctx context.Context, ids []int, runs int) ([]int, error)
+}
+
+// TrackMissing counts one more run missing the products of ids and clears the
+// count of the other products
+func (r *ProductRepository) TrackMissing(ctx context.Context, ids []int) error {
+	ctx, span := startSpan(ctx, "track_missing", len(ids))
+	defer span.End()
+
+	if _, err := r.db.ExecContext(ctx, r.table.sql(`
+		UPDATE products SET
+			missing_since = CASE WHEN id = ANY($1) THEN COALESCE(missing_since, NOW()) END,
+			missing_runs = CASE WHEN id = ANY($1) THEN missing_runs + 1 ELSE 0 END
+		WHERE id = ANY($1) OR missing_runs > 0`), pq.Array(ids)); err != nil {
+		return fmt.Errorf("failed to track missing products: %w", err)
+	}
+	return nil
+}
+
+// MissingRuns returns the consecutive runs missing each product of ids
+func (r *ProductRepository) MissingRuns(ctx context.Context, ids []int) (map[int]int, error) {
+	rows, err := r.db.QueryContext(ctx, r.table.sql(`SELECT id, missing_runs FROM products WHERE id = ANY($1)`), pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read missing products: %w", err)
+	}
+	defer rows.Close()
+	return scanVersions(rows)
+}
+
+// DeleteProductsBatch deletes the products of ids missing from at least runs
+// consecutive runs. The condition is checked again in the database, so a
+// product found by a run that finished in between is kept and left out of
+// the returned IDs.
+func (r *ProductRepository) DeleteProductsBatch(ctx context.Context, ids []int, runs int) ([]int, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	ctx, span := startSpan(ctx, "delete_products", len(ids))
+	defer span.End()
+
+	rows, err := r.db.QueryContext(ctx, r.table.sql(`DELETE FROM products WHERE id = ANY($1) AND missing_runs >= $2 RETURNING id`), pq.Array(ids), runs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete products: %w", err)
+	}
+	defer rows.Close()
+	var deleted []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to read deleted products: %w", err)
+		}
+		deleted = append(deleted, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to delete products: %w", err)
+	}
+	return deleted, nil
+}
+
+// TrackMissing counts one more run missing the products of ids and clears the
+// count of the other products. The marked products are read first, as a NOT
+// IN list of every missing product may not fit in one statement.
+func (r *SQLProductRepository) TrackMissing(ctx context.Context, ids []int) error {
+	rows, err := r.db.QueryContext(ctx, `SELECT id, missing_runs FROM products WHERE missing_runs > 0`)
+	if err != nil {
+		return fmt.Errorf("failed to read missing products: %w", err)
+	}
+	marked, err := scanVersions(rows)
+	rows.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read missing products: %w", err)
+	}
+
+	missing := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		missing[id] = true
+	}
+	var found []int
+	for id := range marked {
+		if !missing[id] {
+			found = append(found, id)
+		}
+	}
+	if _, err := r.byIDs(ctx, found, `UPDATE products SET missing_since = NULL, missing_runs = 0 WHERE id IN `); err != nil {
+		return err
+	}
+	_, err = r.byIDs(ctx, ids, `UPDATE products SET missing_since = COALESCE(missing_since, CURRENT_TIMESTAMP), missing_runs = missing_runs + 1 WHERE id IN `)
+	return err
+}
+
+// MissingRuns returns the consecutive runs missing each product of ids
+func (r *SQLProductRepository) MissingRuns(ctx context.Context, ids []int) (map[int]int, error) {
+	runs := make(map[int]int, len(ids))
+	for _, chunk := range idChunks(ids) {
+		list, args := inList(chunk)
+		rows, err := r.db.QueryContext(ctx, `SELECT id, missing_runs FROM products WHERE id IN `+list, args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read missing products: %w", err)
+		}
+		chunkRuns, err := scanVersions(rows)
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+		for id, n := range chunkRuns {
+			runs[id] = n
+		}
+	}
+	return runs, nil
+}
+
+// DeleteProductsBatch deletes the products of ids missing from at least runs
+// consecutive runs and returns the IDs of those deleted. MySQL has no
+// RETURNING, so each product is deleted by its own statement of one
+// transaction, telling which ones the condition kept.
+func (r *SQLProductRepository) DeleteProductsBatch(ctx context.Context, ids []int, runs int) ([]int, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	indexes, err := r.execEach(ctx, `DELETE FROM products WHERE id = ? AND missing_runs >= ?`, len(ids), func(i int) (string, []interface{}) {
+		return strconv.Itoa(ids[i]), []interface{}{ids[i], runs}
+	})
+	if err != nil {
+		return nil, err
+	}
+	deleted := make([]int, len(indexes))
+	for i, index := range indexes {
+		deleted[i] = ids[index]
+	}
+	return deleted, nil
+}
+
+// TrackMissing tracks the missing products through the wrapped repository and
+// drops the cached catalog
+func (r *CachingProductRepository) TrackMissing(ctx context.Context, ids []int) error {
+	tracker, ok := r.ProductRepositoryInterface.(MissingTracker)
+	if !ok {
+		return fmt.Errorf("the repository cannot track missing products")
+	}
+	defer r.cache.invalidate(r.key)
+	return tracker.TrackMissing(ctx, ids)
+}
+
+// MissingRuns returns the missing runs of the wrapped repository
+func (r *CachingProductRepository) MissingRuns(ctx context.Context, ids []int) (map[int]int, error) {
+	tracker, ok := r.ProductRepositoryInterface.(MissingTracker)
+	if !ok {
+		return nil, fmt.Errorf("the repository cannot track missing products")
+	}
+	return tracker.MissingRuns(ctx, ids)
+}
+
+// DeleteProductsBatch deletes the missing products through the wrapped
+// repository and drops the cached catalog
+func (r *CachingProductRepository) DeleteProductsBatch(ctx context.Context, ids []int, runs int) ([]int, error) {
+	tracker, ok := r.ProductRepositoryInterface.(MissingTracker)
+	if !ok {
+		return nil, fmt.Errorf("the repository cannot track missing products")
+	}
+	defer r.cache.invalidate(r.key)
+	return tracker.DeleteProductsBatch(ctx, ids, runs)
+}
+
+var (
+	_ MissingTracker = (*ProductRepository)(nil)
+	_ MissingTracker = (*SQLProductRepository)(nil)
+	_ MissingTracker = (*CachingProductRepository)(nil)
+)
@@ -0,0 +1,127 @@
+package repo
+
+import (
+	"context"
+	"go-cron/models"
+	"reflect"
+	"testing"
+)
+
+// trackingProductRepository counts the runs missing each product in memory
+type trackingProductRepository struct {
+	*MockProductRepository
+	runs    map[int]int
+	deleted []int
+	// kept are the products a concurrent run found back in its feed, which
+	// the delete leaves alone
+	kept map[int]bool
+}
+
+func (m *trackingProductRepository) TrackMissing(ctx context.Context, ids []int) error {
+	missing := make(map[int]int, len(ids))
+	for _, id := range ids {
+		missing[id] = m.runs[id] + 1
+	}
+	m.runs = missing
+	return nil
+}
+
+func (m *trackingProductRepository) MissingRuns(ctx context.Context, ids []int) (map[int]int, error) {
+	runs := make(map[int]int, len(ids))
+	for _, id := range ids {
+		runs[id] = m.runs[id]
+	}
+	return runs, nil
+}
+
+func (m *trackingProductRepository) DeleteProductsBatch(ctx context.Context, ids []int, runs int) ([]int, error) {
+	var deleted []int
+	for _, id := range ids {
+		if m.runs[id] >= runs && !m.kept[id] {
+			deleted = append(deleted, id)
+		}
+	}
+	m.deleted = append(m.deleted, deleted...)
+	return deleted, nil
+}
+
+// Test_SyncService_ArchiveMissing_DeleteAfterRuns tests that products are
+// deleted only once missing from consecutive feeds, and that a product back
+// in the feed starts counting again
+func Test_SyncService_ArchiveMissing_DeleteAfterRuns(t *testing.T) {
+	archived := false
+	mockRepo := &trackingProductRepository{MockProductRepository: &MockProductRepository{
+		GetAllProductsFunc: func(ctx context.Context) ([]models.Product, error) {
+			return []models.Product{
+				{ID: 1, Title: "Kept", Handle: "kept", Status: models.ProductStatusActive},
+				{ID: 2, Title: "Gone", Handle: "gone", Status: models.ProductStatusActive},
+			}, nil
+		},
+		ArchiveProductsBatchFunc: func(ctx context.Context, ids []int) ([]int, error) {
+			archived = true
+			return ids, nil
+		},
+	}}
+	without := []models.ExternalItem{{ItemCode: "K", ItemName: "kept"}}
+	with := []models.ExternalItem{{ItemCode: "K", ItemName: "kept"}, {ItemCode: "G", ItemName: "gone"}}
+
+	syncService := NewSyncServiceWithOptions(mockRepo, SyncOptions{DeleteMissing: true, DeleteAfterRuns: 2})
+	for i, feed := range [][]models.ExternalItem{without, with, without} {
+		result := &models.SyncResult{}
+		syncService.ArchiveMissing(context.Background(), feed, result)
+		if result.Deleted != 0 || mockRepo.deleted != nil {
+			t.Fatalf("Expected nothing deleted by run %d, got %v", i+1, mockRepo.deleted)
+		}
+	}
+	if mockRepo.runs[2] != 1 {
+		t.Errorf("Expected the product back in the feed to count again, got %d runs", mockRepo.runs[2])
+	}
+
+	syncService.SetDryRun(true)
+	result := &models.SyncResult{}
+	syncService.ArchiveMissing(context.Background(), without, result)
+	if result.Deleted != 1 || mockRepo.deleted != nil || mockRepo.runs[2] != 1 {
+		t.Errorf("Expected a dry run to count the deletion only, got %d (%v)", result.Deleted, mockRepo.deleted)
+	}
+
+	syncService.SetDryRun(false)
+	result = &models.SyncResult{}
+	syncService.ArchiveMissing(context.Background(), without, result)
+	if !reflect.DeepEqual(mockRepo.deleted, []int{2}) || result.Deleted != 1 {
+		t.Errorf("Expected product 2 to be deleted, got %v (%d)", mockRepo.deleted, result.Deleted)
+	}
+	if !reflect.DeepEqual(result.Handles.Deleted, []string{"gone"}) {
+		t.Errorf("Expected the deleted handle, got %v", result.Handles.Deleted)
+	}
+	if archived {
+		t.Error("Expected no product to be archived")
+	}
+}
+
+// Test_SyncService_ArchiveMissing_KeptByOtherRun tests that a due product the
+// database kept, found again by a concurrent run, is neither counted nor
+// reported as deleted
+func Test_SyncService_ArchiveMissing_KeptByOtherRun(t *testing.T) {
+	mockRepo := &trackingProductRepository{
+		MockProductRepository: &MockProductRepository{
+			GetAllProductsFunc: func(ctx context.Context) ([]models.Product, error) {
+				return []models.Product{
+					{ID: 1, Title: "Kept", Handle: "kept", Status: models.ProductStatusActive},
+					{ID: 2, Title: "Gone", Handle: "gone", Status: models.ProductStatusActive},
+					{ID: 3, Title: "Back", Handle: "back", Status: models.ProductStatusActive},
+				}, nil
+			},
+		},
+		kept: map[int]bool{3: true},
+	}
+
+	syncService := NewSyncServiceWithOptions(mockRepo, SyncOptions{DeleteMissing: true, DeleteAfterRuns: 1})
+	result := &models.SyncResult{}
+	syncService.ArchiveMissing(context.Background(), []models.ExternalItem{{ItemCode: "K", ItemName: "kept"}}, result)
+	if !reflect.DeepEqual(mockRepo.deleted, []int{2}) || result.Deleted != 1 {
+		t.Errorf("Expected only product 2 to be deleted, got %v (%d)", mockRepo.deleted, result.Deleted)
+	}
+	if !reflect.DeepEqual(result.Handles.Deleted, []string{"gone"}) {
+		t.Errorf("Expected only the deleted handle, got %v", result.Handles.Deleted)
+	}
+}
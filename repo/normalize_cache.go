@@ -0,0 +1,57 @@
+package repo
+
+import "go-cron/models"
+
+// normalizeCache memoizes title keys and generateHandle for the duration
+// of a run. SAP feeds repeat the same names across variants, and every product
+// title is normalized again when it is matched, so most lookups are hits that
+// cost a map read instead of fresh strings. It is not safe for concurrent use.
+type normalizeCache struct {
+	keys    *Normalizer
+	titles  map[string]string
+	handles map[string]string
+	hits    int
+	misses  int
+}
+
+// newNormalizeCache creates a cache of the keys of normalizer sized for about n distinct names
+func newNormalizeCache(normalizer *Normalizer, n int) *normalizeCache {
+	return &normalizeCache{
+		keys:    normalizer,
+		titles:  make(map[string]string, n),
+		handles: make(map[string]string, n),
+	}
+}
+
+// title returns the key of raw
+func (c *normalizeCache) title(raw string) string {
+	if v, ok := c.titles[raw]; ok {
+		c.hits++
+		return v
+	}
+	c.misses++
+	v := c.keys.Normalize(raw)
+	c.titles[raw] = v
+	return v
+}
+
+// handle returns the handle generated from raw
+func (c *normalizeCache) handle(raw string) string {
+	if v, ok := c.handles[raw]; ok {
+		c.hits++
+		return v
+	}
+	c.misses++
+	v := generateHandle(raw)
+	c.handles[raw] = v
+	return v
+}
+
+// report adds the cache hit metrics to the run's performance breakdown
+func (c *normalizeCache) report(result *models.SyncResult) {
+	if result.Performance == nil {
+		result.Performance = &models.SyncPerformance{}
+	}
+	result.Performance.NormalizeCacheHits += c.hits
+	result.Performance.NormalizeCacheMisses += c.misses
+}
@@ -0,0 +1,119 @@
+package repo
+
+import (
+	"fmt"
+	"go-cron/models"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// titleRule is a normalization step
+type titleRule struct {
+	// name identifies the step in the signature of the normalizer
+	name  string
+	apply func(string) string
+	// folds marks the lowercasing rules
+	folds bool
+}
+
+// Normalizer turns titles into the keys items and products are matched by,
+// applying a chain of rules in order. The default chain trims and lowercases.
+// The keys are only computed in Go: the Postgres repository stores them next
+// to the titles, as SQL string functions fold non-ASCII text differently.
+type Normalizer struct {
+	rules []titleRule
+}
+
+// defaultNormalizer trims and lowercases titles
+var defaultNormalizer = mustNormalizer(NewNormalizer([]string{models.TitleRuleTrim, models.TitleRuleLower}, nil))
+
+// NewNormalizer creates a normalizer applying rules in order; see the
+// models.TitleRule constants. The strip_prefixes rule removes the first of
+// prefixes the title starts with, ignoring case, and the whitespace after it.
+func NewNormalizer(rules, prefixes []string) (*Normalizer, error) {
+	n := &Normalizer{}
+	for _, name := range rules {
+		switch name {
+		case models.TitleRuleTrim:
+			n.rules = append(n.rules, titleRule{name: name, apply: strings.TrimSpace})
+		case models.TitleRuleLower:
+			n.rules = append(n.rules, titleRule{name: name, apply: strings.ToLower, folds: true})
+		case models.TitleRuleLowerTurkish:
+			n.rules = append(n.rules, titleRule{
+				name:  name,
+				apply: func(s string) string { return strings.ToLowerSpecial(unicode.TurkishCase, s) },
+				folds: true,
+			})
+		case models.TitleRuleCollapseSpace:
+			re := regexp.MustCompile(`\s+`)
+			n.rules = append(n.rules, titleRule{name: name, apply: func(s string) string { return re.ReplaceAllString(s, " ") }})
+		case models.TitleRuleStripPunct:
+			n.rules = append(n.rules, titleRule{name: name, apply: stripPunct})
+		case models.TitleRuleStripPrefixes:
+			if len(prefixes) == 0 {
+				return nil, fmt.Errorf("the %s rule needs vendor prefixes", name)
+			}
+			quoted := make([]string, len(prefixes))
+			for i, p := range prefixes {
+				quoted[i] = regexp.QuoteMeta(p)
+			}
+			re := regexp.MustCompile(`(?i)^(?:` + strings.Join(quoted, "|") + `)\s*`)
+			n.rules = append(n.rules, titleRule{
+				name:  name + "(" + strings.Join(prefixes, "|") + ")",
+				apply: func(s string) string { return re.ReplaceAllString(s, "") },
+			})
+		default:
+			return nil, fmt.Errorf("unknown title rule %q", name)
+		}
+	}
+	return n, nil
+}
+
+// mustNormalizer panics on the error of a normalizer built from constant rules
+func mustNormalizer(n *Normalizer, err error) *Normalizer {
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+// Normalize returns the key of title
+func (n *Normalizer) Normalize(title string) string {
+	for _, r := range n.rules {
+		title = r.apply(title)
+	}
+	return title
+}
+
+// CaseSensitive returns the normalizer without its lowercasing rules, so
+// titles differing in case get different keys
+func (n *Normalizer) CaseSensitive() *Normalizer {
+	cs := &Normalizer{}
+	for _, r := range n.rules {
+		if !r.folds {
+			cs.rules = append(cs.rules, r)
+		}
+	}
+	return cs
+}
+
+// Signature identifies the rules of the normalizer, so keys stored by a
+// normalizer with other rules can be told apart and computed again
+func (n *Normalizer) Signature() string {
+	names := make([]string, len(n.rules))
+	for i, r := range n.rules {
+		names[i] = r.name
+	}
+	return strings.Join(names, ",")
+}
+
+// stripPunct removes every character that is neither a letter, a digit nor whitespace
+func stripPunct(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsSpace(r) {
+			return r
+		}
+		return -1
+	}, s)
+}
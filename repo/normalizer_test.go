@@ -0,0 +1,72 @@
+package repo
+
+import (
+	"go-cron/models"
+	"testing"
+)
+
+// Test_Normalizer tests the keys and signatures of rule chains
+func Test_Normalizer(t *testing.T) {
+	tests := []struct {
+		name     string
+		rules    []string
+		prefixes []string
+		title    string
+		key      string
+		sig      string
+	}{
+		{
+			name:  "default",
+			rules: []string{models.TitleRuleTrim, models.TitleRuleLower},
+			title: "  Blue Shirt ",
+			key:   "blue shirt",
+			sig:   "trim,lower",
+		},
+		{
+			name:  "turkish lowercase",
+			rules: []string{models.TitleRuleLowerTurkish},
+			title: "IŞIK İnce",
+			key:   "ışık ince",
+			sig:   "lower_tr",
+		},
+		{
+			name:  "collapsed spaces and punctuation",
+			rules: []string{models.TitleRuleStripPunct, models.TitleRuleCollapseSpace, models.TitleRuleTrim},
+			title: "Shirt - Blue,  XL!",
+			key:   "Shirt Blue XL",
+		},
+		{
+			name:     "vendor prefix",
+			rules:    []string{models.TitleRuleStripPrefixes, models.TitleRuleLower},
+			prefixes: []string{"ACME", "O'Neil"},
+			title:    "acme  Blue Shirt",
+			key:      "blue shirt",
+			sig:      "strip_prefixes(ACME|O'Neil),lower",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := NewNormalizer(tt.rules, tt.prefixes)
+			if err != nil {
+				t.Fatalf("NewNormalizer failed: %v", err)
+			}
+			if key := n.Normalize(tt.title); key != tt.key {
+				t.Errorf("Expected key %q, got %q", tt.key, key)
+			}
+			if tt.sig != "" && n.Signature() != tt.sig {
+				t.Errorf("Expected signature %q, got %q", tt.sig, n.Signature())
+			}
+		})
+	}
+}
+
+// Test_NewNormalizer_Errors tests that unknown rules and prefix rules without prefixes are rejected
+func Test_NewNormalizer_Errors(t *testing.T) {
+	if _, err := NewNormalizer([]string{"upper"}, nil); err == nil {
+		t.Error("Expected an error for an unknown rule")
+	}
+	if _, err := NewNormalizer([]string{models.TitleRuleStripPrefixes}, nil); err == nil {
+		t.Error("Expected an error for strip_prefixes without prefixes")
+	}
+}
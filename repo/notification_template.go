@@ -0,0 +1,41 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// NotificationTemplateRepository handles database operations for notification templates
+type NotificationTemplateRepository struct {
+	db *sql.DB
+}
+
+// NewNotificationTemplateRepository creates a new notification template repository
+func NewNotificationTemplateRepository(db *sql.DB) *NotificationTemplateRepository {
+	return &NotificationTemplateRepository{db: db}
+}
+
+// GetNotificationTemplates returns the stored template bodies keyed by channel
+func (r *NotificationTemplateRepository) GetNotificationTemplates(ctx context.Context) (map[string]string, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT channel, body FROM notification_templates`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query notification templates: %w", err)
+	}
+	defer rows.Close()
+
+	templates := make(map[string]string)
+	for rows.Next() {
+		var channel, body string
+		if err := rows.Scan(&channel, &body); err != nil {
+			return nil, fmt.Errorf("failed to scan notification template: %w", err)
+		}
+		templates[channel] = body
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating notification templates: %w", err)
+	}
+
+	return templates, nil
+}
@@ -0,0 +1,184 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"go-cron/models"
+)
+
+// OutboxRepository handles database operations for the change outbox and its per-sink deliveries
+type OutboxRepository struct {
+	db *sql.DB
+}
+
+// NewOutboxRepository creates a new outbox repository
+func NewOutboxRepository(db *sql.DB) *OutboxRepository {
+	return &OutboxRepository{db: db}
+}
+
+// EnqueueChanges stores changes in the outbox with a pending delivery for
+// every sink and sets their IDs
+func (r *OutboxRepository) EnqueueChanges(ctx context.Context, changes []models.Change, sinks []string) error {
+	if len(changes) == 0 || len(sinks) == 0 {
+		return nil
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	changeStmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO outbox (action, product_id, title, handle, old_handle)
+		VALUES ($1, NULLIF($2, 0), $3, $4, NULLIF($5, ''))
+		RETURNING id`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer changeStmt.Close()
+
+	deliveryStmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO outbox_deliveries (change_id, sink, status)
+		VALUES ($1, $2, 'pending')`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer deliveryStmt.Close()
+
+	progress := newBatchProgress("outbox", len(changes), nil)
+	for i, c := range changes {
+		var changeID int64
+		if err := changeStmt.QueryRowContext(ctx, c.Action, c.ProductID, c.Title, c.Handle, c.OldHandle).Scan(&changeID); err != nil {
+			return fmt.Errorf("failed to enqueue change for %s: %w", c.Handle, err)
+		}
+		for _, sink := range sinks {
+			if _, err := deliveryStmt.ExecContext(ctx, changeID, sink); err != nil {
+				return fmt.Errorf("failed to enqueue delivery to %s: %w", sink, err)
+			}
+		}
+		changes[i].ID = changeID
+		if err := progress.row(ctx); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// PendingDeliveries returns up to limit pending deliveries for a sink, oldest first
+func (r *OutboxRepository) PendingDeliveries(ctx context.Context, sink string, limit int) ([]models.Delivery, error) {
+	query := `
+		SELECT o.id, o.action, COALESCE(o.product_id, 0), o.title, o.handle, COALESCE(o.old_handle, ''), o.created_at,
+		       d.sink, d.status, d.attempts, COALESCE(d.last_error, '')
+		FROM outbox_deliveries d
+		JOIN outbox o ON o.id = d.change_id
+		WHERE d.sink = $1 AND d.status = 'pending'
+		ORDER BY o.id
+		LIMIT $2`
+
+	rows, err := r.db.QueryContext(ctx, query, sink, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pending deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []models.Delivery
+	for rows.Next() {
+		var d models.Delivery
+		if err := rows.Scan(&d.Change.ID, &d.Change.Action, &d.Change.ProductID, &d.Change.Title,
+			&d.Change.Handle, &d.Change.OldHandle, &d.Change.CreatedAt, &d.Sink, &d.Status, &d.Attempts, &d.LastError); err != nil {
+			return nil, fmt.Errorf("failed to scan delivery: %w", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating deliveries: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+// MarkDelivered marks the delivery of a change to a sink as successful
+func (r *OutboxRepository) MarkDelivered(ctx context.Context, changeID int64, sink string) error {
+	query := `
+		UPDATE outbox_deliveries
+		SET status = 'delivered', attempts = attempts + 1, last_error = NULL, delivered_at = NOW()
+		WHERE change_id = $1 AND sink = $2`
+
+	if _, err := r.db.ExecContext(ctx, query, changeID, sink); err != nil {
+		return fmt.Errorf("failed to mark delivery as delivered: %w", err)
+	}
+
+	return nil
+}
+
+// MarkFailed records a failed delivery attempt of a change to a sink
+func (r *OutboxRepository) MarkFailed(ctx context.Context, changeID int64, sink string, reason string) error {
+	query := `
+		UPDATE outbox_deliveries
+		SET status = 'failed', attempts = attempts + 1, last_error = $3
+		WHERE change_id = $1 AND sink = $2`
+
+	if _, err := r.db.ExecContext(ctx, query, changeID, sink, reason); err != nil {
+		return fmt.Errorf("failed to mark delivery as failed: %w", err)
+	}
+
+	return nil
+}
+
+// ResetFailed moves every failed delivery of a sink back to pending and returns how many were reset
+func (r *OutboxRepository) ResetFailed(ctx context.Context, sink string) (int, error) {
+	result, err := r.db.ExecContext(ctx,
+		`UPDATE outbox_deliveries SET status = 'pending' WHERE sink = $1 AND status = 'failed'`, sink)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reset failed deliveries: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return int(rowsAffected), nil
+}
+
+// SinkLag returns the pending/failed backlog and the age of the oldest pending change per sink
+func (r *OutboxRepository) SinkLag(ctx context.Context) ([]models.SinkLag, error) {
+	query := `
+		SELECT d.sink,
+		       COUNT(*) FILTER (WHERE d.status = 'pending'),
+		       COUNT(*) FILTER (WHERE d.status = 'failed'),
+		       COALESCE(EXTRACT(EPOCH FROM NOW() - MIN(o.created_at) FILTER (WHERE d.status = 'pending')), 0)
+		FROM outbox_deliveries d
+		JOIN outbox o ON o.id = d.change_id
+		GROUP BY d.sink
+		ORDER BY d.sink`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sink lag: %w", err)
+	}
+	defer rows.Close()
+
+	var lags []models.SinkLag
+	for rows.Next() {
+		var l models.SinkLag
+		if err := rows.Scan(&l.Sink, &l.Pending, &l.Failed, &l.OldestPendingSecs); err != nil {
+			return nil, fmt.Errorf("failed to scan sink lag: %w", err)
+		}
+		lags = append(lags, l)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating sink lag: %w", err)
+	}
+
+	return lags, nil
+}
@@ -0,0 +1,73 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"go-cron/models"
+	"log"
+)
+
+// SyncPlan holds the writes decided by Plan for Apply to carry out. Between
+// the two it can be inspected, stored as JSON or held for approval; the
+// products it was computed from may change meanwhile, which the versions of
+// its updates detect.
+type SyncPlan struct {
+	// Creates lists the products to create
+	Creates []struct{ Title, Handle string } `json:"creates,omitempty"`
+	// Updates lists the products whose synced fields changed
+	Updates []productUpdate `json:"updates,omitempty"`
+	// Reactivations lists the archived products that reappeared in the feed
+	Reactivations []*models.Product `json:"reactivations,omitempty"`
+	// Archives lists the duplicates of a title archived by the merge policy
+	Archives []*models.Product `json:"archives,omitempty"`
+	// Missing lists the products archived because the feed no longer has
+	// them; only the plans of ArchiveMissing held for approval have them
+	Missing []*models.Product `json:"missing,omitempty"`
+	// Categories, Prices, Images and RawTitles hold the values to store, by
+	// handle, for the products whose value is new or changed
+	Categories map[string]string              `json:"categories,omitempty"`
+	Prices     map[string]models.ProductPrice `json:"prices,omitempty"`
+	Images     map[string]string              `json:"images,omitempty"`
+	RawTitles  map[string]string              `json:"rawTitles,omitempty"`
+	// IDs holds the IDs of the matched products by handle; categories, prices,
+	// pictures and raw titles are written by ID, the created products being
+	// looked up
+	IDs map[string]int `json:"ids,omitempty"`
+	// Synced lists the handles of the products whose item was found
+	Synced []string `json:"synced,omitempty"`
+	// Previous holds the updated products as they were read, by ID, for the audit log
+	Previous map[int]*models.Product `json:"previous,omitempty"`
+	// CatalogSize is the number of products before the sync
+	CatalogSize int `json:"catalogSize"`
+	// Result holds what planning found, such as unchanged and rejected items
+	// and warnings; Apply completes it
+	Result *models.SyncResult `json:"result"`
+}
+
+// Empty reports whether the plan writes nothing
+func (p *SyncPlan) Empty() bool {
+	return len(p.Creates) == 0 && len(p.Updates) == 0 && len(p.Reactivations) == 0 && len(p.Archives) == 0 && len(p.Missing) == 0 &&
+		len(p.Categories) == 0 && len(p.Prices) == 0 && len(p.Images) == 0
+}
+
+// Approve confirms the changes of a plan held by the change guard
+func (p *SyncPlan) Approve() {
+	if p.Result.Guard != nil {
+		p.Result.Guard.Confirmed = true
+	}
+}
+
+// holdForApproval stores plan, whose changes tripped the change guard, for
+// approval and records its ID on the guard; without approvals it does nothing
+func (s *SyncService) holdForApproval(ctx context.Context, plan *SyncPlan) {
+	if s.approvals == nil {
+		return
+	}
+	id, err := s.approvals.SavePlan(ctx, plan)
+	if err != nil {
+		plan.Result.Errors = append(plan.Result.Errors, fmt.Sprintf("failed to hold the changes for approval: %v", err))
+		return
+	}
+	plan.Result.Guard.PlanID = id
+	log.Printf("Held the changes for approval as sync plan %d", id)
+}
@@ -0,0 +1,63 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"go-cron/models"
+	"testing"
+	"time"
+)
+
+// Test_PlanRepository tests approving a held plan once, rejecting one,
+// expiring one held too long and approving again one whose apply died
+func Test_PlanRepository(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	r := NewPlanRepository(db)
+	r.SetClock(func() time.Time { return now })
+
+	save := func() int {
+		t.Helper()
+		id, err := r.SavePlan(ctx, &SyncPlan{Creates: []struct{ Title, Handle string }{{"Tea", "tea"}}})
+		if err != nil {
+			t.Fatalf("SavePlan failed: %v", err)
+		}
+		return id
+	}
+	approved, rejected, expired := save(), save(), save()
+
+	if stored, err := r.ApprovePlan(ctx, approved, time.Hour, 5*time.Minute); err != nil || stored == nil || stored.Status != models.PlanStatusApproved {
+		t.Fatalf("Expected the plan to be approved, got %+v (%v)", stored, err)
+	}
+	if _, err := r.ApprovePlan(ctx, approved, time.Hour, 5*time.Minute); !errors.Is(err, ErrPlanNotPending) {
+		t.Errorf("Expected a running plan not to be approved twice, got %v", err)
+	}
+
+	if stored, err := r.RejectPlan(ctx, rejected); err != nil || stored == nil || stored.Status != models.PlanStatusRejected {
+		t.Fatalf("Expected the plan to be rejected, got %+v (%v)", stored, err)
+	}
+	if _, err := r.ApprovePlan(ctx, rejected, time.Hour, 5*time.Minute); !errors.Is(err, ErrPlanNotPending) {
+		t.Errorf("Expected a rejected plan not to be approved, got %v", err)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if _, err := r.ApprovePlan(ctx, expired, time.Hour, 5*time.Minute); !errors.Is(err, ErrPlanExpired) {
+		t.Errorf("Expected the plan held too long to expire, got %v", err)
+	}
+	if stored, err := r.GetPlan(ctx, expired); err != nil || stored.Status != models.PlanStatusExpired {
+		t.Errorf("Expected the plan to be marked expired, got %+v (%v)", stored, err)
+	}
+
+	// The approved plan never finished: its apply is presumed dead
+	if stored, err := r.ApprovePlan(ctx, approved, time.Hour, 5*time.Minute); err != nil || stored == nil {
+		t.Fatalf("Expected the unfinished plan to be approved again, got %+v (%v)", stored, err)
+	}
+	if err := r.FinishPlan(ctx, approved, models.PlanStatusApplied, &models.SyncResult{Created: 1}); err != nil {
+		t.Fatalf("FinishPlan failed: %v", err)
+	}
+	now = now.Add(time.Hour)
+	if _, err := r.ApprovePlan(ctx, approved, time.Hour, 5*time.Minute); !errors.Is(err, ErrPlanNotPending) {
+		t.Errorf("Expected an applied plan not to be approved again, got %v", err)
+	}
+}
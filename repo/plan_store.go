@@ -0,0 +1,184 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-cron/models"
+	"time"
+)
+
+// ErrPlanNotPending is returned by ApprovePlan and RejectPlan when the plan
+// was already decided
+var ErrPlanNotPending = errors.New("plan is not pending")
+
+// ErrPlanExpired is returned by ApprovePlan when the plan was held for longer
+// than it may be approved; the plan is marked expired
+var ErrPlanExpired = errors.New("plan expired")
+
+// StoredPlan is a sync plan held for approval, with its outcome once applied
+type StoredPlan struct {
+	ID     int       `json:"id"`
+	Status string    `json:"status"`
+	Plan   *SyncPlan `json:"plan"`
+	// Result is the outcome of the applied plan
+	Result    *models.SyncResult `json:"result,omitempty"`
+	CreatedAt time.Time          `json:"createdAt"`
+	// DecidedAt is when the plan was approved, rejected or expired
+	DecidedAt  *time.Time `json:"decidedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+// PlanRepository persists the sync plans held for approval in sync_plans, so
+// the run that planned the changes and the call approving them need not be
+// the same invocation
+type PlanRepository struct {
+	db  *sql.DB
+	now func() time.Time
+}
+
+// NewPlanRepository creates a new plan repository
+func NewPlanRepository(db *sql.DB) *PlanRepository {
+	return &PlanRepository{db: db, now: time.Now}
+}
+
+// SetClock replaces the time source of plan timestamps
+func (r *PlanRepository) SetClock(now func() time.Time) {
+	r.now = now
+}
+
+// SavePlan stores plan as pending and returns its ID
+func (r *PlanRepository) SavePlan(ctx context.Context, plan *SyncPlan) (int, error) {
+	encoded, err := json.Marshal(plan)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode sync plan: %w", err)
+	}
+	var id int
+	err = r.db.QueryRowContext(ctx, `
+		INSERT INTO sync_plans (status, plan, created_at)
+		VALUES ($1, $2, $3)
+		RETURNING id`, models.PlanStatusPending, encoded, r.now().UTC()).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to save sync plan: %w", err)
+	}
+	return id, nil
+}
+
+// planColumns are the sync_plans columns read by scanPlan
+const planColumns = `id, status, plan, result, created_at, decided_at, finished_at`
+
+// GetPlan returns the plan with id, or nil when it does not exist
+func (r *PlanRepository) GetPlan(ctx context.Context, id int) (*StoredPlan, error) {
+	plan, err := scanPlan(r.db.QueryRowContext(ctx, `SELECT `+planColumns+` FROM sync_plans WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return plan, err
+}
+
+// ApprovePlan marks a pending plan as approved for the caller to apply it and
+// returns it. A plan held for longer than ttl is marked expired instead and
+// ErrPlanExpired returned. An approved plan not finished within staleAfter,
+// its apply presumed dead with its invocation, can be approved again; the
+// versions of its updates and the unique handles keep it from writing twice.
+// Otherwise ApprovePlan returns ErrPlanNotPending, so a plan is applied once,
+// or nil when it does not exist.
+func (r *PlanRepository) ApprovePlan(ctx context.Context, id int, ttl, staleAfter time.Duration) (*StoredPlan, error) {
+	now := r.now().UTC()
+	plan, err := scanPlan(r.db.QueryRowContext(ctx, `
+		UPDATE sync_plans SET status = $2, decided_at = $3
+		WHERE id = $1
+		  AND ((status = $4 AND created_at >= $5) OR (status = $2 AND finished_at IS NULL AND decided_at < $6))
+		RETURNING `+planColumns,
+		id, models.PlanStatusApproved, now, models.PlanStatusPending, now.Add(-ttl), now.Add(-staleAfter)))
+	if !errors.Is(err, sql.ErrNoRows) {
+		return plan, err
+	}
+
+	existing, err := r.GetPlan(ctx, id)
+	if err != nil || existing == nil {
+		return nil, err
+	}
+	if existing.Status != models.PlanStatusPending {
+		return nil, ErrPlanNotPending
+	}
+	if _, err := r.decide(ctx, id, models.PlanStatusExpired); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	return nil, ErrPlanExpired
+}
+
+// RejectPlan marks a pending plan as rejected, so it is never applied, and
+// returns it. It returns ErrPlanNotPending when the plan was already decided,
+// or nil when it does not exist.
+func (r *PlanRepository) RejectPlan(ctx context.Context, id int) (*StoredPlan, error) {
+	plan, err := r.decide(ctx, id, models.PlanStatusRejected)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return plan, err
+	}
+
+	existing, err := r.GetPlan(ctx, id)
+	if err != nil || existing == nil {
+		return nil, err
+	}
+	return nil, ErrPlanNotPending
+}
+
+// decide moves a pending plan to status and returns it, or sql.ErrNoRows when
+// it is not pending
+func (r *PlanRepository) decide(ctx context.Context, id int, status string) (*StoredPlan, error) {
+	return scanPlan(r.db.QueryRowContext(ctx, `
+		UPDATE sync_plans SET status = $2, decided_at = $3
+		WHERE id = $1 AND status = $4
+		RETURNING `+planColumns,
+		id, status, r.now().UTC(), models.PlanStatusPending))
+}
+
+// FinishPlan stores the final status and result of an approved plan
+func (r *PlanRepository) FinishPlan(ctx context.Context, id int, status string, result *models.SyncResult) error {
+	var encoded []byte
+	if result != nil {
+		var err error
+		if encoded, err = json.Marshal(result); err != nil {
+			return fmt.Errorf("failed to encode sync result: %w", err)
+		}
+	}
+	_, err := r.db.ExecContext(ctx, `UPDATE sync_plans SET status = $2, result = $3, finished_at = $4 WHERE id = $1`,
+		id, status, encoded, r.now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to finish sync plan: %w", err)
+	}
+	return nil
+}
+
+// scanPlan reads the planColumns of a row into a stored plan
+func scanPlan(row interface {
+	Scan(dest ...interface{}) error
+}) (*StoredPlan, error) {
+	var stored StoredPlan
+	var plan, result []byte
+	var decidedAt, finishedAt sql.NullTime
+	err := row.Scan(&stored.ID, &stored.Status, &plan, &result, &stored.CreatedAt, &decidedAt, &finishedAt)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan sync plan: %w", err)
+	}
+
+	stored.CreatedAt = stored.CreatedAt.UTC()
+	stored.DecidedAt, stored.FinishedAt = nullTime(decidedAt), nullTime(finishedAt)
+	stored.Plan = &SyncPlan{}
+	if err := json.Unmarshal(plan, stored.Plan); err != nil {
+		return nil, fmt.Errorf("failed to decode sync plan: %w", err)
+	}
+	if len(result) > 0 {
+		stored.Result = &models.SyncResult{}
+		if err := json.Unmarshal(result, stored.Result); err != nil {
+			return nil, fmt.Errorf("failed to decode sync result: %w", err)
+		}
+	}
+	return &stored, nil
+}
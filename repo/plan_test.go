@@ -0,0 +1,161 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"go-cron/models"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Test_SyncService_Plan tests that planning decides the writes without
+// making them and that applying the plan makes them
+func Test_SyncService_Plan(t *testing.T) {
+	var created, updated int
+	mockRepo := &MockProductRepository{
+		GetAllProductsFunc: func(ctx context.Context) ([]models.Product, error) {
+			return []models.Product{
+				{ID: 1, Title: "Product A", Handle: "product-a", Version: 2},
+				{ID: 2, Title: "Product B", Handle: "product-b"},
+			}, nil
+		},
+		CreateProductsBatchFunc: func(ctx context.Context, products []struct{ Title, Handle string }) error {
+			created += len(products)
+			return nil
+		},
+		UpdateProductsBatchFunc: func(ctx context.Context, updates []struct {
+			ID      int
+			Title   string
+			Handle  string
+			Fields  ProductFields
+			Version int
+		}) error {
+			updated += len(updates)
+			return nil
+		},
+	}
+	syncService := NewSyncService(mockRepo)
+
+	plan, err := syncService.Plan(context.Background(), []models.ExternalItem{
+		{ItemCode: "A001", ItemName: "PRODUCT A"},
+		{ItemCode: "B001", ItemName: "Product B"},
+		{ItemCode: "C001", ItemName: "Product C"},
+	})
+	if err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+	if created != 0 || updated != 0 {
+		t.Fatalf("Expected planning not to write, got %d creates and %d updates", created, updated)
+	}
+	if len(plan.Creates) != 1 || plan.Creates[0].Handle != "product-c" {
+		t.Errorf("Expected Product C to be planned for creation, got %+v", plan.Creates)
+	}
+	if len(plan.Updates) != 1 || plan.Updates[0].ID != 1 || plan.Updates[0].Version != 2 || plan.Updates[0].Fields != UpdateTitle {
+		t.Errorf("Expected the title of Product A to be planned for update, got %+v", plan.Updates)
+	}
+	if plan.Result.Unchanged != 1 || plan.Empty() {
+		t.Errorf("Expected Product B unchanged and a plan with writes, got %+v", plan.Result)
+	}
+
+	result, err := syncService.Apply(context.Background(), plan)
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if created != 1 || updated != 1 || result.Created != 1 || result.Updated != 1 || result.Unchanged != 1 {
+		t.Errorf("Expected the plan to be applied, got %+v", result)
+	}
+}
+
+// Test_SyncService_Apply_Failed tests that a plan stopped by the change
+// guard is not applied
+func Test_SyncService_Apply_Failed(t *testing.T) {
+	mockRepo := &MockProductRepository{
+		CreateProductsBatchFunc: func(ctx context.Context, products []struct{ Title, Handle string }) error {
+			t.Error("Expected no write")
+			return nil
+		},
+	}
+	plan := &SyncPlan{
+		Creates: []struct{ Title, Handle string }{{Title: "Product A", Handle: "product-a"}},
+		Result:  &models.SyncResult{Status: models.SyncStatusFailed},
+	}
+	result, err := NewSyncService(mockRepo).Apply(context.Background(), plan)
+	if err != nil || result.Status != models.SyncStatusFailed || result.Created != 0 {
+		t.Errorf("Expected the failed result back, got %+v (%v)", result, err)
+	}
+}
+
+// memoryPlans is a PlanRepositoryInterface keeping the plans in memory, as JSON
+type memoryPlans struct {
+	saved [][]byte
+}
+
+func (m *memoryPlans) SavePlan(ctx context.Context, plan *SyncPlan) (int, error) {
+	encoded, err := json.Marshal(plan)
+	m.saved = append(m.saved, encoded)
+	return len(m.saved), err
+}
+
+func (m *memoryPlans) GetPlan(ctx context.Context, id int) (*StoredPlan, error) {
+	plan := &SyncPlan{}
+	if err := json.Unmarshal(m.saved[id-1], plan); err != nil {
+		return nil, err
+	}
+	return &StoredPlan{ID: id, Status: models.PlanStatusPending, Plan: plan}, nil
+}
+
+func (m *memoryPlans) ApprovePlan(ctx context.Context, id int, ttl, staleAfter time.Duration) (*StoredPlan, error) {
+	return m.GetPlan(ctx, id)
+}
+
+func (m *memoryPlans) RejectPlan(ctx context.Context, id int) (*StoredPlan, error) {
+	return m.GetPlan(ctx, id)
+}
+
+func (m *memoryPlans) FinishPlan(ctx context.Context, id int, status string, result *models.SyncResult) error {
+	return nil
+}
+
+// Test_SyncService_HoldForApproval tests that changes tripping the guard are
+// stored for approval and applied from the stored plan once approved
+func Test_SyncService_HoldForApproval(t *testing.T) {
+	var created []string
+	mockRepo := &MockProductRepository{
+		GetAllProductsFunc: func(ctx context.Context) ([]models.Product, error) {
+			return []models.Product{{ID: 1, Title: "A", Handle: "a"}}, nil
+		},
+		CreateProductsBatchFunc: func(ctx context.Context, products []struct{ Title, Handle string }) error {
+			for _, p := range products {
+				created = append(created, p.Handle)
+			}
+			return nil
+		},
+	}
+	plans := &memoryPlans{}
+	syncService := NewSyncServiceWithOptions(mockRepo, SyncOptions{MaxChangeRatio: 0.5})
+	syncService.SetApprovals(plans)
+
+	result, err := syncService.CompareAndSync(context.Background(), []models.ExternalItem{
+		{ItemCode: "A", ItemName: "A"}, {ItemCode: "B", ItemName: "B"}, {ItemCode: "C", ItemName: "C"},
+	})
+	if err != nil {
+		t.Fatalf("CompareAndSync failed: %v", err)
+	}
+	if result.Status != models.SyncStatusFailed || result.Guard == nil || result.Guard.PlanID != 1 || len(created) != 0 {
+		t.Fatalf("Expected the changes to be held as plan 1, got %+v and creates %v", result, created)
+	}
+
+	stored, err := plans.ApprovePlan(context.Background(), 1, time.Hour, time.Minute)
+	if err != nil {
+		t.Fatalf("ApprovePlan failed: %v", err)
+	}
+	stored.Plan.Approve()
+	result, err = syncService.Apply(context.Background(), stored.Plan)
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if result.Status != models.SyncStatusOK || !result.Guard.Confirmed || result.Created != 2 || !reflect.DeepEqual(created, []string{"b", "c"}) {
+		t.Errorf("Expected the approved plan to create b and c, got %+v and creates %v", result, created)
+	}
+}
@@ -0,0 +1,72 @@
+package repo
+
+import (
+	"context"
+	"go-cron/models"
+	"reflect"
+	"testing"
+)
+
+// Test_SyncService_CompareAndSync_Prices tests that prices of the synced
+// price list are diffed like other fields and stored by product ID
+func Test_SyncService_CompareAndSync_Prices(t *testing.T) {
+	price := func(f float64) *float64 { return &f }
+	var saved map[int]models.ProductPrice
+	mockRepo := &MockProductRepository{
+		GetAllProductsFunc: func(ctx context.Context) ([]models.Product, error) {
+			return []models.Product{
+				{ID: 1, Title: "Green Tea", Handle: "green-tea", Status: models.ProductStatusActive, Price: price(4.5), Currency: "EUR"},
+				{ID: 2, Title: "Cola", Handle: "cola", Status: models.ProductStatusActive, Price: price(2), Currency: "EUR"},
+				{ID: 3, Title: "Mug", Handle: "mug", Status: models.ProductStatusActive, Price: price(8), Currency: "EUR"},
+			}, nil
+		},
+		GetProductsByTitlesFunc: func(ctx context.Context, titles []string) ([]models.Product, error) {
+			return []models.Product{{ID: 4, Title: "Black Tea", Handle: "black-tea", Status: models.ProductStatusActive}}, nil
+		},
+		SavePricesFunc: func(ctx context.Context, prices map[int]models.ProductPrice) ([]int, error) {
+			saved = prices
+			var changed []int
+			for id := range prices {
+				changed = append(changed, id)
+			}
+			return changed, nil
+		},
+	}
+	syncService := NewSyncService(mockRepo)
+	syncService.SetPriceList(2)
+
+	items := []models.ExternalItem{
+		{ItemCode: "T1", ItemName: "Green Tea", ItemPrices: []models.ItemPrice{{PriceList: 1, Price: price(3), Currency: "EUR"}, {PriceList: 2, Price: price(4.95), Currency: "EUR"}}},
+		{ItemCode: "C1", ItemName: "Cola", ItemPrices: []models.ItemPrice{{PriceList: 2, Price: price(2), Currency: "EUR"}}},
+		// A price never set in the list clears the stored one
+		{ItemCode: "M1", ItemName: "Mug", ItemPrices: []models.ItemPrice{{PriceList: 2, Price: price(0)}}},
+		{ItemCode: "B1", ItemName: "Black Tea", ItemPrices: []models.ItemPrice{{PriceList: 2, Price: price(5), Currency: "USD"}}},
+	}
+	result, err := syncService.CompareAndSync(context.Background(), items)
+	if err != nil {
+		t.Fatalf("CompareAndSync failed: %v", err)
+	}
+
+	expected := map[int]models.ProductPrice{
+		1: {Amount: price(4.95), Currency: "EUR"},
+		3: {},
+		4: {Amount: price(5), Currency: "USD"},
+	}
+	if !reflect.DeepEqual(saved, expected) {
+		t.Errorf("Expected prices %v, got %v", expected, saved)
+	}
+	if result.Updated != 2 || result.Unchanged != 1 || result.Created != 1 {
+		t.Errorf("Expected 2 repriced, 1 unchanged and 1 created products, got %+v", result)
+	}
+
+	// Dry runs report the price change
+	syncService.SetDryRun(true)
+	result, err = syncService.CompareAndSync(context.Background(), items[:1])
+	if err != nil {
+		t.Fatalf("CompareAndSync failed: %v", err)
+	}
+	want := []models.FieldChange{{Field: models.FieldPrice, Old: "4.5 EUR", New: "4.95 EUR"}}
+	if len(result.Diffs) != 1 || result.Diffs[0].Action != models.ChangeActionUpdate || !reflect.DeepEqual(result.Diffs[0].Fields, want) {
+		t.Errorf("Expected a price update, got %+v", result.Diffs)
+	}
+}
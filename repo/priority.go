@@ -0,0 +1,60 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"go-cron/models"
+)
+
+// PriorityRepository reads the ranked list of item codes (e.g. top sellers)
+// that are synced ahead of the rest of the catalog
+type PriorityRepository struct {
+	db *sql.DB
+}
+
+// NewPriorityRepository creates a new priority repository
+func NewPriorityRepository(db *sql.DB) *PriorityRepository {
+	return &PriorityRepository{db: db}
+}
+
+// ListPriorityItemCodes returns up to limit item codes, most important first
+func (r *PriorityRepository) ListPriorityItemCodes(ctx context.Context, limit int) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT item_code FROM priority_items ORDER BY rank, item_code LIMIT $1`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query priority items: %w", err)
+	}
+	defer rows.Close()
+
+	var codes []string
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			return nil, fmt.Errorf("failed to scan priority item: %w", err)
+		}
+		codes = append(codes, code)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating priority items: %w", err)
+	}
+	return codes, nil
+}
+
+// ExcludeSynced returns the items whose ItemCode is not among the already
+// synced ones, e.g. the rest of the catalog once the priority items were synced
+func ExcludeSynced(items, synced []models.ExternalItem) []models.ExternalItem {
+	if len(synced) == 0 {
+		return items
+	}
+	done := make(map[string]bool, len(synced))
+	for _, item := range synced {
+		done[item.ItemCode] = true
+	}
+	var rest []models.ExternalItem
+	for _, item := range items {
+		if !done[item.ItemCode] {
+			rest = append(rest, item)
+		}
+	}
+	return rest
+}
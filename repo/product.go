@@ -5,35 +5,354 @@ import (
 	"database/sql"
 	"fmt"
 	"go-cron/models"
+	"go-cron/tracing"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lib/pq"
 )
 
+// searchLanguage is the text search configuration of products.search_vector.
+// "simple" only lowercases, which suits product names mixing languages and codes.
+const searchLanguage = "simple"
+
+// searchVector is the search_vector expression for a product whose title is $1
+const searchVector = `to_tsvector('` + searchLanguage + `', $1)`
+
+// updateProductSQL returns the statement updating the columns of u, skipping
+// rows a concurrent writer already brought up to date and, when u has a
+// Version, rows changed since it was read, and its arguments: the title, when
+// written, comes first so searchVector can refer to it as $1, followed by its
+// key and the signature of titles
+func updateProductSQL(u productUpdate, titles *Normalizer) (string, []interface{}) {
+	var sets, changed []string
+	var args []interface{}
+	fields := u.Fields.columns()
+	if fields&UpdateTitle != 0 {
+		args = append(args, u.Title, titles.Normalize(u.Title), titles.Signature())
+		sets = append(sets, "title = $1", "title_key = $2", "title_rules = $3", "search_vector = "+searchVector)
+		changed = append(changed, "title IS DISTINCT FROM $1")
+	}
+	if fields&UpdateHandle != 0 {
+		args = append(args, u.Handle)
+		n := strconv.Itoa(len(args))
+		sets = append(sets, "handle = $"+n)
+		changed = append(changed, "handle IS DISTINCT FROM $"+n)
+	}
+	args = append(args, u.ID)
+	sets = append(sets, "updated_at = NOW()", "version = version + 1")
+	where := "id = $" + strconv.Itoa(len(args))
+	if u.Version > 0 {
+		args = append(args, u.Version)
+		where += " AND version = $" + strconv.Itoa(len(args))
+	}
+	return fmt.Sprintf("UPDATE products SET %s WHERE %s AND (%s)",
+		strings.Join(sets, ", "), where, strings.Join(changed, " OR ")), args
+}
+
+// saveRawTitleSQL stores the raw title $2 of the product with ID $1
+const saveRawTitleSQL = `
+		UPDATE products SET raw_title = $2
+		WHERE id = $1 AND raw_title IS DISTINCT FROM $2`
+
+// saveCategorySQL stores the category $2 of the product with ID $1, an empty
+// category clearing it
+const saveCategorySQL = `
+		UPDATE products SET category = NULLIF($2, ''), updated_at = NOW(), version = version + 1
+		WHERE id = $1 AND COALESCE(category, '') <> $2`
+
+// savePriceSQL stores the price $2 in currency $3 of the product with ID $1,
+// a NULL price and an empty currency clearing them
+const savePriceSQL = `
+		UPDATE products SET price = $2::numeric, currency = NULLIF($3, ''), updated_at = NOW(), version = version + 1
+		WHERE id = $1 AND (price IS DISTINCT FROM $2::numeric OR COALESCE(currency, '') <> $3)`
+
 // ProductRepository handles database operations for products
 type ProductRepository struct {
-	db *sql.DB
+	db              *sql.DB
+	updateChunkSize int
+	updateWorkers   int
+	createChunkSize int
+	isolateFailed   bool
+	progress        ProgressFunc
+	batchTimeout    time.Duration
+	deadlockRetries atomic.Int64
+	titles          *Normalizer
+	keyed           bool
+	keyMu           sync.Mutex
+	table           productsTable
 }
 
 // NewProductRepository creates a new product repository
 func NewProductRepository(db *sql.DB) *ProductRepository {
-	return &ProductRepository{db: db}
+	return &ProductRepository{db: db, titles: defaultNormalizer}
+}
+
+// SetNormalizer makes the title lookups match products by the keys of n; it
+// must be the normalizer of the SyncService using the repository. The keys
+// stored by other rules are computed again before the first lookup.
+func (r *ProductRepository) SetNormalizer(n *Normalizer) {
+	r.keyMu.Lock()
+	defer r.keyMu.Unlock()
+	r.titles = n
+	r.keyed = false
+}
+
+// rekeyBatch is the number of products whose title key is computed again per statement
+const rekeyBatch = 1000
+
+// ensureTitleKeys stores the key of the normalizer in title_key for the
+// products written by another normalizer, or before the keys were stored,
+// once per repository
+func (r *ProductRepository) ensureTitleKeys(ctx context.Context) error {
+	r.keyMu.Lock()
+	defer r.keyMu.Unlock()
+	if r.keyed {
+		return nil
+	}
+
+	signature := r.titles.Signature()
+	for last := 0; ; {
+		rows, err := r.db.QueryContext(ctx, r.table.sql(`
+			SELECT id, title FROM products
+			WHERE id > $1 AND title_rules IS DISTINCT FROM $2
+			ORDER BY id LIMIT $3`), last, signature, rekeyBatch)
+		if err != nil {
+			return fmt.Errorf("failed to query products to key: %w", err)
+		}
+		var ids []int
+		var keys []string
+		for rows.Next() {
+			var title string
+			if err := rows.Scan(&last, &title); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan product to key: %w", err)
+			}
+			ids, keys = append(ids, last), append(keys, r.titles.Normalize(title))
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error iterating products to key: %w", err)
+		}
+		if len(ids) == 0 {
+			break
+		}
+
+		query := `UPDATE products p SET title_key = k.key, title_rules = $3
+			FROM unnest($1::int[], $2::text[]) AS k(id, key) WHERE p.id = k.id`
+		if _, err := r.db.ExecContext(ctx, r.table.sql(query), pq.Array(ids), pq.Array(keys), signature); err != nil {
+			return fmt.Errorf("failed to store title keys: %w", err)
+		}
+		if len(ids) < rekeyBatch {
+			break
+		}
+	}
+	r.keyed = true
+	return nil
+}
+
+// SetUpdateParallelism makes UpdateProductsBatch apply at most chunkSize
+// updates per transaction, running up to workers transactions at once.
+// A chunk size of zero applies every update in a single transaction.
+func (r *ProductRepository) SetUpdateParallelism(chunkSize, workers int) {
+	r.updateChunkSize = chunkSize
+	r.updateWorkers = workers
+}
+
+// SetCreateChunks makes CreateProductsBatch commit at most chunkSize inserts
+// per transaction, so a bad row only loses its own chunk. With isolate, the
+// rows of a failed chunk are retried one by one to pin down the offending
+// ones. A chunk size of zero inserts everything in a single transaction.
+func (r *ProductRepository) SetCreateChunks(chunkSize int, isolate bool) {
+	r.createChunkSize = chunkSize
+	r.isolateFailed = isolate
+}
+
+// SetProgress makes the batch writes report their progress to fn every few
+// hundred rows; nil disables the reports
+func (r *ProductRepository) SetProgress(fn ProgressFunc) {
+	r.progress = fn
+}
+
+// SetBatchTimeout bounds every batch statement (title lookup, insert batch,
+// update chunk, raw title batch) by d per batchTimeoutRows rows, so one slow
+// batch fails on its own instead of silently eating the rest of the sync
+// budget, while an unchunked batch gets the time of the chunks it replaces.
+// Zero disables it.
+func (r *ProductRepository) SetBatchTimeout(d time.Duration) {
+	r.batchTimeout = d
+}
+
+// batchTimeoutRows is the number of rows a batch timeout is granted for, the
+// default chunk size of the inserts and updates
+const batchTimeoutRows = 500
+
+// batchContext derives the context of one batch of rows rows from ctx
+func (r *ProductRepository) batchContext(ctx context.Context, rows int) (context.Context, context.CancelFunc) {
+	if r.batchTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	chunks := (rows + batchTimeoutRows - 1) / batchTimeoutRows
+	return context.WithTimeout(ctx, r.batchTimeout*time.Duration(max(chunks, 1)))
+}
+
+// DeadlockRetries returns how many chunk transactions were retried after losing a deadlock
+func (r *ProductRepository) DeadlockRetries() int64 {
+	return r.deadlockRetries.Load()
 }
 
 // GetAllProducts fetches all products from the database
 func (r *ProductRepository) GetAllProducts(ctx context.Context) ([]models.Product, error) {
-	query := `SELECT id, title, COALESCE(handle, '') as handle FROM products ORDER BY id`
+	query := `SELECT ` + productColumns + ` FROM products ORDER BY id`
+
+	ctx, span := startSpan(ctx, "get_all_products", 0)
+	defer span.End()
+
+	rows, err := r.db.QueryContext(ctx, r.table.sql(query))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query products: %w", err)
+	}
+	defer rows.Close()
+
+	return scanProducts(rows)
+}
+
+// GetProductsPaged fetches a page of products ordered by ID
+func (r *ProductRepository) GetProductsPaged(ctx context.Context, offset, limit int) ([]models.Product, error) {
+	query := `SELECT ` + productColumns + ` FROM products ORDER BY id LIMIT $1 OFFSET $2`
+
+	rows, err := r.db.QueryContext(ctx, r.table.sql(query), limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query products page: %w", err)
+	}
+	defer rows.Close()
+
+	return scanProducts(rows)
+}
+
+// productFilterClause matches products against a models.ProductFilter passed as $1 (title) and $2 (handle)
+const productFilterClause = `($1 = '' OR title ILIKE '%' || $1 || '%' ESCAPE '\') AND ($2 = '' OR handle = $2)`
+
+// FindProducts returns a page of products matching filter, ordered by ID
+func (r *ProductRepository) FindProducts(ctx context.Context, filter models.ProductFilter, offset, limit int) ([]models.Product, error) {
+	query := `SELECT ` + productColumns + ` FROM products
+		WHERE ` + productFilterClause + ` ORDER BY id LIMIT $3 OFFSET $4`
 
-	rows, err := r.db.QueryContext(ctx, query)
+	rows, err := r.db.QueryContext(ctx, r.table.sql(query), escapeLike(filter.Title), filter.Handle, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query products: %w", err)
 	}
 	defer rows.Close()
 
+	return scanProducts(rows)
+}
+
+// CountMatchingProducts returns the number of products matching filter
+func (r *ProductRepository) CountMatchingProducts(ctx context.Context, filter models.ProductFilter) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM products WHERE ` + productFilterClause
+	if err := r.db.QueryRowContext(ctx, r.table.sql(query), escapeLike(filter.Title), filter.Handle).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count products: %w", err)
+	}
+	return count, nil
+}
+
+// escapeLike escapes the LIKE wildcards in s so it matches literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// GetProductsByTitles fetches the products whose title key, as computed by the normalizer, is in titles
+func (r *ProductRepository) GetProductsByTitles(ctx context.Context, titles []string) ([]models.Product, error) {
+	if len(titles) == 0 {
+		return nil, nil
+	}
+	if err := r.ensureTitleKeys(ctx); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT ` + productColumns + ` FROM products WHERE title_key = ANY($1) ORDER BY id`
+
+	ctx, span := startSpan(ctx, "get_products_by_titles", len(titles))
+	defer span.End()
+	ctx, cancel := r.batchContext(ctx, len(titles))
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, r.table.sql(query), pq.Array(titles))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query products by titles: %w", err)
+	}
+	defer rows.Close()
+
+	return scanProducts(rows)
+}
+
+// CountProducts returns the number of products in the database, archived ones included
+func (r *ProductRepository) CountProducts(ctx context.Context) (int, error) {
+	ctx, span := startSpan(ctx, "count_products", 0)
+	defer span.End()
+
+	var count int
+	if err := r.db.QueryRowContext(ctx, r.table.sql(`SELECT COUNT(*) FROM products`)).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count products: %w", err)
+	}
+	return count, nil
+}
+
+// CountActiveProducts returns the number of products that are not archived
+func (r *ProductRepository) CountActiveProducts(ctx context.Context) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM products WHERE status IS DISTINCT FROM 'archived'`
+	if err := r.db.QueryRowContext(ctx, r.table.sql(query)).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count active products: %w", err)
+	}
+	return count, nil
+}
+
+// productColumns are the products columns read by scanProduct
+const productColumns = `id, title, COALESCE(handle, '') as handle, COALESCE(status, 'active') as status, archived_at,
+	COALESCE(category, '') as category, price, COALESCE(currency, '') as currency, COALESCE(image_url, '') as image_url,
+	created_at, updated_at, last_synced_at, version, locked`
+
+// scanProduct reads the productColumns of a row into a product
+func scanProduct(row interface {
+	Scan(dest ...interface{}) error
+}) (*models.Product, error) {
+	var p models.Product
+	var archivedAt, createdAt, updatedAt, lastSyncedAt sql.NullTime
+	var price sql.NullFloat64
+	if err := row.Scan(&p.ID, &p.Title, &p.Handle, &p.Status, &archivedAt, &p.Category, &price, &p.Currency, &p.Image,
+		&createdAt, &updatedAt, &lastSyncedAt, &p.Version, &p.Locked); err != nil {
+		return nil, err
+	}
+	p.ArchivedAt, p.CreatedAt, p.UpdatedAt, p.LastSyncedAt = utcTime(archivedAt), utcTime(createdAt), utcTime(updatedAt), utcTime(lastSyncedAt)
+	if price.Valid {
+		p.Price = &price.Float64
+	}
+	return &p, nil
+}
+
+// utcTime returns the UTC time of t, or nil when it is NULL
+func utcTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	at := t.Time.UTC()
+	return &at
+}
+
+// scanProducts reads the productColumns of every row into products
+func scanProducts(rows *sql.Rows) ([]models.Product, error) {
 	var products []models.Product
 	for rows.Next() {
-		var p models.Product
-		if err := rows.Scan(&p.ID, &p.Title, &p.Handle); err != nil {
+		p, err := scanProduct(rows)
+		if err != nil {
 			return nil, fmt.Errorf("failed to scan product: %w", err)
 		}
-		products = append(products, p)
+		products = append(products, *p)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -43,12 +362,14 @@ func (r *ProductRepository) GetAllProducts(ctx context.Context) ([]models.Produc
 	return products, nil
 }
 
-// GetProductByTitle finds a product by its title (case-insensitive)
+// GetProductByTitle finds a product by its title, comparing the keys of the normalizer
 func (r *ProductRepository) GetProductByTitle(ctx context.Context, title string) (*models.Product, error) {
-	query := `SELECT id, title, COALESCE(handle, '') as handle FROM products WHERE LOWER(title) = LOWER($1)`
+	if err := r.ensureTitleKeys(ctx); err != nil {
+		return nil, err
+	}
+	query := `SELECT ` + productColumns + ` FROM products WHERE title_key = $1 ORDER BY id LIMIT 1`
 
-	var p models.Product
-	err := r.db.QueryRowContext(ctx, query, title).Scan(&p.ID, &p.Title, &p.Handle)
+	p, err := scanProduct(r.db.QueryRowContext(ctx, r.table.sql(query), r.titles.Normalize(title)))
 	if err == sql.ErrNoRows {
 		return nil, nil // Not found
 	}
@@ -56,20 +377,20 @@ func (r *ProductRepository) GetProductByTitle(ctx context.Context, title string)
 		return nil, fmt.Errorf("failed to query product by title: %w", err)
 	}
 
-	return &p, nil
+	return p, nil
 }
 
 // CreateProduct inserts a new product into the database
 // If a duplicate handle exists, it will be skipped gracefully
 func (r *ProductRepository) CreateProduct(ctx context.Context, title, handle string) (int, error) {
 	query := `
-		INSERT INTO products (title, handle) 
-		VALUES ($1, $2) 
+		INSERT INTO products (title, handle, search_vector, title_key, title_rules) 
+		VALUES ($1, $2, ` + searchVector + `, $3, $4) 
 		ON CONFLICT (handle) DO NOTHING
 		RETURNING id`
 
 	var newID int
-	err := r.db.QueryRowContext(ctx, query, title, handle).Scan(&newID)
+	err := r.db.QueryRowContext(ctx, r.table.sql(query), title, handle, r.titles.Normalize(title), r.titles.Signature()).Scan(&newID)
 	if err == sql.ErrNoRows {
 		// Duplicate was skipped, return 0 to indicate no insertion
 		return 0, nil
@@ -83,9 +404,10 @@ func (r *ProductRepository) CreateProduct(ctx context.Context, title, handle str
 
 // UpdateProduct updates an existing product
 func (r *ProductRepository) UpdateProduct(ctx context.Context, id int, title, handle string) error {
-	query := `UPDATE products SET title = $1, handle = $2 WHERE id = $3`
+	query := `UPDATE products SET title = $1, handle = $2, search_vector = ` + searchVector + `, title_key = $4, title_rules = $5,
+		updated_at = NOW(), version = version + 1 WHERE id = $3`
 
-	result, err := r.db.ExecContext(ctx, query, title, handle, id)
+	result, err := r.db.ExecContext(ctx, r.table.sql(query), title, handle, id, r.titles.Normalize(title), r.titles.Signature())
 	if err != nil {
 		return fmt.Errorf("failed to update product: %w", err)
 	}
@@ -102,13 +424,27 @@ func (r *ProductRepository) UpdateProduct(ctx context.Context, id int, title, ha
 	return nil
 }
 
-// CreateProductsBatch creates multiple products in a single transaction for better performance
-// Duplicates (based on handle) are automatically skipped without errors
+// CreateProductsBatch creates multiple products in chunked transactions (see
+// SetCreateChunks). Duplicates (based on handle) are automatically skipped
+// without errors. A failed chunk does not stop the following ones; the rows
+// that were not written are reported in a *CreateBatchError.
 func (r *ProductRepository) CreateProductsBatch(ctx context.Context, products []struct{ Title, Handle string }) error {
 	if len(products) == 0 {
 		return nil
 	}
 
+	progress := newBatchProgress(PhaseCreate, len(products), r.progress)
+	insert := func(ctx context.Context, chunk []productCreate) error {
+		return r.createChunk(ctx, chunk, progress)
+	}
+	return r.createChunks(ctx, products, insert, r.createRow)
+}
+
+// createChunk inserts one chunk of products in a single transaction
+func (r *ProductRepository) createChunk(ctx context.Context, products []productCreate, progress *batchProgress) error {
+	ctx, cancel := r.batchContext(ctx, len(products))
+	defer cancel()
+
 	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
@@ -116,19 +452,22 @@ func (r *ProductRepository) CreateProductsBatch(ctx context.Context, products []
 	defer tx.Rollback()
 
 	// Use ON CONFLICT to skip duplicates gracefully
-	stmt, err := tx.PrepareContext(ctx, `
-		INSERT INTO products (title, handle) 
-		VALUES ($1, $2) 
-		ON CONFLICT (handle) DO NOTHING`)
+	stmt, err := tx.PrepareContext(ctx, r.table.sql(`
+		INSERT INTO products (title, handle, search_vector, title_key, title_rules) 
+		VALUES ($1, $2, `+searchVector+`, $3, $4) 
+		ON CONFLICT (handle) DO NOTHING`))
 	if err != nil {
 		return fmt.Errorf("failed to prepare statement: %w", err)
 	}
 	defer stmt.Close()
 
 	for _, p := range products {
-		if _, err := stmt.ExecContext(ctx, p.Title, p.Handle); err != nil {
+		if _, err := stmt.ExecContext(ctx, p.Title, p.Handle, r.titles.Normalize(p.Title), r.titles.Signature()); err != nil {
 			return fmt.Errorf("failed to insert product %s: %w", p.Title, err)
 		}
+		if err := progress.row(ctx); err != nil {
+			return err
+		}
 	}
 
 	if err := tx.Commit(); err != nil {
@@ -138,31 +477,128 @@ func (r *ProductRepository) CreateProductsBatch(ctx context.Context, products []
 	return nil
 }
 
-// UpdateProductsBatch updates multiple products in a single transaction
+// createRow inserts a single product in its own transaction
+func (r *ProductRepository) createRow(ctx context.Context, p productCreate) error {
+	ctx, cancel := r.batchContext(ctx, 1)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, r.table.sql(`
+		INSERT INTO products (title, handle, search_vector, title_key, title_rules)
+		VALUES ($1, $2, `+searchVector+`, $3, $4)
+		ON CONFLICT (handle) DO NOTHING`), p.Title, p.Handle, r.titles.Normalize(p.Title), r.titles.Signature())
+	if err != nil {
+		return fmt.Errorf("failed to insert product %s: %w", p.Title, err)
+	}
+	return nil
+}
+
+// UpdateProductsBatch updates multiple products and returns the IDs of the rows
+// that actually changed; rows already holding the new values are left untouched,
+// and only the columns selected by the Fields of a row are written.
+// Updates are sorted by ID and split into contiguous ID ranges applied in
+// parallel transactions, so no two chunks touch the same rows and every chunk
+// locks its rows in the same order. A chunk that still loses a deadlock (e.g.
+// on the handle index) is retried.
 func (r *ProductRepository) UpdateProductsBatch(ctx context.Context, updates []struct {
-	ID     int
-	Title  string
-	Handle string
-}) error {
+	ID      int
+	Title   string
+	Handle  string
+	Fields  ProductFields
+	Version int
+}) ([]int, error) {
 	if len(updates) == 0 {
+		return nil, nil
+	}
+
+	progress := newBatchProgress(PhaseUpdate, len(updates), r.progress)
+	changed, err := r.applyChunks(ctx, shardUpdates(updates, r.updateChunkSize), func(ctx context.Context, chunk []productUpdate) ([]int, error) {
+		return r.updateChunk(ctx, chunk, progress)
+	})
+	if err != nil {
+		return changed, err
+	}
+	return changed, staleUpdates(ctx, updates, changed, r.productVersions)
+}
+
+// updateChunk updates one chunk of products in a single transaction and returns the IDs that changed
+func (r *ProductRepository) updateChunk(ctx context.Context, updates []productUpdate, progress *batchProgress) ([]int, error) {
+	ctx, cancel := r.batchContext(ctx, len(updates))
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// One statement per combination of columns, prepared when first needed
+	stmts := make(map[string]*sql.Stmt)
+	defer func() {
+		for _, stmt := range stmts {
+			stmt.Close()
+		}
+	}()
+
+	var changed []int
+	for _, u := range updates {
+		query, args := updateProductSQL(u, r.titles)
+		stmt := stmts[query]
+		if stmt == nil {
+			if stmt, err = tx.PrepareContext(ctx, r.table.sql(query)); err != nil {
+				return nil, fmt.Errorf("failed to prepare statement: %w", err)
+			}
+			stmts[query] = stmt
+		}
+		res, err := stmt.ExecContext(ctx, args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update product %d: %w", u.ID, err)
+		}
+		if n, err := res.RowsAffected(); err == nil && n > 0 {
+			changed = append(changed, u.ID)
+		}
+		if err := progress.row(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return changed, nil
+}
+
+// SaveRawTitles stores the unsanitized title received from the external API
+// next to the products identified by ID (map of product ID to raw title)
+func (r *ProductRepository) SaveRawTitles(ctx context.Context, rawTitles map[int]string) error {
+	if len(rawTitles) == 0 {
 		return nil
 	}
 
+	ctx, span := startSpan(ctx, "save_raw_titles", len(rawTitles))
+	defer span.End()
+	ctx, cancel := r.batchContext(ctx, len(rawTitles))
+	defer cancel()
+
 	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback()
 
-	stmt, err := tx.PrepareContext(ctx, `UPDATE products SET title = $1, handle = $2 WHERE id = $3`)
+	stmt, err := tx.PrepareContext(ctx, r.table.sql(saveRawTitleSQL))
 	if err != nil {
 		return fmt.Errorf("failed to prepare statement: %w", err)
 	}
 	defer stmt.Close()
 
-	for _, u := range updates {
-		if _, err := stmt.ExecContext(ctx, u.Title, u.Handle, u.ID); err != nil {
-			return fmt.Errorf("failed to update product %d: %w", u.ID, err)
+	progress := newBatchProgress(PhaseRawTitles, len(rawTitles), r.progress)
+	for id, raw := range rawTitles {
+		if _, err := stmt.ExecContext(ctx, id, raw); err != nil {
+			return fmt.Errorf("failed to save raw title of product %d: %w", id, err)
+		}
+		if err := progress.row(ctx); err != nil {
+			return err
 		}
 	}
 
@@ -172,3 +608,225 @@ func (r *ProductRepository) UpdateProductsBatch(ctx context.Context, updates []s
 
 	return nil
 }
+
+// SaveCategories stores the categories of the products identified by ID (map
+// of product ID to category) and returns the IDs whose category changed
+func (r *ProductRepository) SaveCategories(ctx context.Context, categories map[int]string) ([]int, error) {
+	if len(categories) == 0 {
+		return nil, nil
+	}
+
+	ctx, span := startSpan(ctx, "save_categories", len(categories))
+	defer span.End()
+	ctx, cancel := r.batchContext(ctx, len(categories))
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, r.table.sql(saveCategorySQL))
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	var changed []int
+	progress := newBatchProgress(PhaseCategory, len(categories), r.progress)
+	for id, category := range categories {
+		res, err := stmt.ExecContext(ctx, id, category)
+		if err != nil {
+			return nil, fmt.Errorf("failed to save category of product %d: %w", id, err)
+		}
+		if n, err := res.RowsAffected(); err == nil && n > 0 {
+			changed = append(changed, id)
+		}
+		if err := progress.row(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return changed, nil
+}
+
+// SavePrices stores the prices of the products identified by ID (map of
+// product ID to price) and returns the IDs whose price changed
+func (r *ProductRepository) SavePrices(ctx context.Context, prices map[int]models.ProductPrice) ([]int, error) {
+	if len(prices) == 0 {
+		return nil, nil
+	}
+
+	ctx, span := startSpan(ctx, "save_prices", len(prices))
+	defer span.End()
+	ctx, cancel := r.batchContext(ctx, len(prices))
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, r.table.sql(savePriceSQL))
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	var changed []int
+	progress := newBatchProgress(PhasePrice, len(prices), r.progress)
+	for id, price := range prices {
+		res, err := stmt.ExecContext(ctx, id, price.Amount, price.Currency)
+		if err != nil {
+			return nil, fmt.Errorf("failed to save price of product %d: %w", id, err)
+		}
+		if n, err := res.RowsAffected(); err == nil && n > 0 {
+			changed = append(changed, id)
+		}
+		if err := progress.row(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return changed, nil
+}
+
+// SearchProducts returns up to limit active products matching a web-search style query
+// ("blue shirt", "shirt -red", "\"exact phrase\"", "a or b"), best matches first
+func (r *ProductRepository) SearchProducts(ctx context.Context, query string, limit int) ([]models.Product, error) {
+	sqlQuery := `
+		SELECT ` + productColumns + `
+		FROM products, websearch_to_tsquery('` + searchLanguage + `', $1) q
+		WHERE search_vector @@ q AND status IS DISTINCT FROM 'archived'
+		ORDER BY ts_rank(search_vector, q) DESC, id
+		LIMIT $2`
+
+	rows, err := r.db.QueryContext(ctx, r.table.sql(sqlQuery), query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search products: %w", err)
+	}
+	defer rows.Close()
+
+	return scanProducts(rows)
+}
+
+// RefreshSearchVectors recomputes the search vector of products written before
+// it was maintained (or of every product with all set) and returns the number updated
+func (r *ProductRepository) RefreshSearchVectors(ctx context.Context, all bool) (int, error) {
+	query := `UPDATE products SET search_vector = to_tsvector('` + searchLanguage + `', title)`
+	if !all {
+		query += ` WHERE search_vector IS NULL`
+	}
+
+	result, err := r.db.ExecContext(ctx, r.table.sql(query))
+	if err != nil {
+		return 0, fmt.Errorf("failed to refresh search vectors: %w", err)
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return int(updated), nil
+}
+
+// CheckIntegrity runs cheap data integrity assertions against the products
+// table. Archived products don't count as duplicates, so merged duplicates
+// stop being reported.
+func (r *ProductRepository) CheckIntegrity(ctx context.Context) (*models.IntegrityReport, error) {
+	if err := r.ensureTitleKeys(ctx); err != nil {
+		return nil, err
+	}
+	query := `
+		SELECT
+			(SELECT COUNT(*) FROM products),
+			(SELECT COUNT(*) FROM products WHERE handle IS NULL OR handle = ''),
+			(SELECT COUNT(*) FROM (
+				SELECT 1 FROM products WHERE status IS DISTINCT FROM 'archived'
+				GROUP BY title_key HAVING COUNT(*) > 1
+			) d)`
+
+	var report models.IntegrityReport
+	err := r.db.QueryRowContext(ctx, r.table.sql(query)).Scan(&report.TotalProducts, &report.EmptyHandles, &report.DuplicateTitles)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check integrity: %w", err)
+	}
+
+	return &report, nil
+}
+
+// ArchiveProductsBatch marks the products with the given IDs as archived,
+// keeping their rows so consumers can tell a product that is gone from one
+// that never existed, and returns the IDs of those archived
+func (r *ProductRepository) ArchiveProductsBatch(ctx context.Context, ids []int) ([]int, error) {
+	return r.setStatus(ctx, ids, models.ProductStatusArchived, `now()`)
+}
+
+// ReactivateProductsBatch marks archived products with the given IDs as active
+// again and returns how many were reactivated
+func (r *ProductRepository) ReactivateProductsBatch(ctx context.Context, ids []int) (int, error) {
+	reactivated, err := r.setStatus(ctx, ids, models.ProductStatusActive, `NULL`)
+	return len(reactivated), err
+}
+
+// setStatus moves the products with the given IDs to status, setting
+// archived_at to archivedAt, and returns the IDs of the products it moved
+func (r *ProductRepository) setStatus(ctx context.Context, ids []int, status, archivedAt string) ([]int, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	ctx, span := startSpan(ctx, "set_status", len(ids))
+	defer span.End()
+	span.SetAttributes(tracing.String("product.status", status))
+	ctx, cancel := r.batchContext(ctx, len(ids))
+	defer cancel()
+
+	query := `UPDATE products SET status = $2, archived_at = ` + archivedAt + `, updated_at = NOW(), version = version + 1
+		WHERE id = ANY($1) AND COALESCE(status, 'active') <> $2 RETURNING id`
+	rows, err := r.db.QueryContext(ctx, r.table.sql(query), pq.Array(ids), status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set products %s: %w", status, err)
+	}
+	defer rows.Close()
+	var moved []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to read %s products: %w", status, err)
+		}
+		moved = append(moved, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to set products %s: %w", status, err)
+	}
+	return moved, nil
+}
+
+// DeleteProducts removes the products with the given IDs and returns how many were deleted
+func (r *ProductRepository) DeleteProducts(ctx context.Context, ids []int) (int, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	result, err := r.db.ExecContext(ctx, r.table.sql(`DELETE FROM products WHERE id = ANY($1)`), pq.Array(ids))
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete products: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return int(rowsAffected), nil
+}
@@ -0,0 +1,199 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"go-cron/models"
+	"sync"
+	"time"
+)
+
+// ProductChecksummer is implemented by repositories that can fingerprint the
+// products table with a cheap aggregate query
+type ProductChecksummer interface {
+	ProductsChecksum(ctx context.Context) (string, error)
+}
+
+// ProductsChecksum returns a change marker of the products table: the row
+// count and the latest updated_at and last_synced_at, which every write of
+// the columns read by GetAllProducts moves. The indexes on both timestamps
+// make it an index lookup instead of a scan of the rows.
+func (r *ProductRepository) ProductsChecksum(ctx context.Context) (string, error) {
+	var count int64
+	var updated, synced sql.NullTime
+	err := r.db.QueryRowContext(ctx, r.table.sql(`SELECT COUNT(*), MAX(updated_at), MAX(last_synced_at) FROM products`)).Scan(&count, &updated, &synced)
+	if err != nil {
+		return "", fmt.Errorf("failed to checksum products: %w", err)
+	}
+	return fmt.Sprintf("%d:%d:%d", count, updated.Time.UnixMicro(), synced.Time.UnixMicro()), nil
+}
+
+// ProductCache keeps the catalogs read by GetAllProducts between the runs of
+// a warm instance, by database. It is safe for concurrent use.
+type ProductCache struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	entries map[string]*productCacheEntry
+}
+
+// productCacheEntry is the catalog of one database
+type productCacheEntry struct {
+	products []models.Product
+	checksum string
+	loadedAt time.Time
+}
+
+// NewProductCache creates an empty product cache
+func NewProductCache() *ProductCache {
+	return &ProductCache{now: time.Now, entries: make(map[string]*productCacheEntry)}
+}
+
+// SetClock replaces the time source of expirations
+func (c *ProductCache) SetClock(now func() time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
+
+// get returns a copy of the catalog of key if it was loaded within ttl
+func (c *ProductCache) get(key string, ttl time.Duration) ([]models.Product, string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := c.entries[key]
+	if entry == nil || c.now().Sub(entry.loadedAt) >= ttl {
+		delete(c.entries, key)
+		return nil, "", false
+	}
+	return append([]models.Product(nil), entry.products...), entry.checksum, true
+}
+
+// put caches a copy of the catalog of key
+func (c *ProductCache) put(key string, products []models.Product, checksum string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = &productCacheEntry{products: append([]models.Product(nil), products...), checksum: checksum, loadedAt: c.now()}
+}
+
+// invalidate drops the catalog of key
+func (c *ProductCache) invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+// CachingProductRepository serves GetAllProducts from a ProductCache. Writes
+// through it drop the cached catalog. When the repository it wraps is a
+// ProductChecksummer, every hit is checked against the checksum of the table,
+// so writes made elsewhere (other instances, the admin endpoints, picture
+// URLs) reload the catalog too; a hit then costs one indexed aggregate query
+// instead of reading every row. A write of a transaction that started before
+// the cached read can keep the checksum unchanged and is seen once the TTL
+// expires. Without a checksum a hit is trusted until the TTL.
+type CachingProductRepository struct {
+	ProductRepositoryInterface
+	cache *ProductCache
+	key   string
+	ttl   time.Duration
+}
+
+var _ ProductRepositoryInterface = (*CachingProductRepository)(nil)
+
+// NewCachingProductRepository creates a repository caching the catalog of
+// next in cache for ttl, under key, which identifies its database
+func NewCachingProductRepository(next ProductRepositoryInterface, cache *ProductCache, key string, ttl time.Duration) *CachingProductRepository {
+	return &CachingProductRepository{ProductRepositoryInterface: next, cache: cache, key: key, ttl: ttl}
+}
+
+// GetAllProducts returns the cached catalog while it is fresh and unchanged,
+// reading and caching it otherwise
+func (r *CachingProductRepository) GetAllProducts(ctx context.Context) ([]models.Product, error) {
+	checksummer, verifies := r.ProductRepositoryInterface.(ProductChecksummer)
+	var checksum string
+	if verifies {
+		var err error
+		if checksum, err = checksummer.ProductsChecksum(ctx); err != nil {
+			// Without a checksum the cache cannot be trusted, but the catalog can still be read
+			r.cache.invalidate(r.key)
+			return r.ProductRepositoryInterface.GetAllProducts(ctx)
+		}
+	}
+
+	if products, cached, ok := r.cache.get(r.key, r.ttl); ok && (!verifies || cached == checksum) {
+		return products, nil
+	}
+
+	products, err := r.ProductRepositoryInterface.GetAllProducts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Taken before the read, a checksum of rows changed meanwhile mismatches on the next hit
+	r.cache.put(r.key, products, checksum)
+	return products, nil
+}
+
+// CreateProduct creates a product and drops the cached catalog
+func (r *CachingProductRepository) CreateProduct(ctx context.Context, title, handle string) (int, error) {
+	defer r.cache.invalidate(r.key)
+	return r.ProductRepositoryInterface.CreateProduct(ctx, title, handle)
+}
+
+// UpdateProduct updates a product and drops the cached catalog
+func (r *CachingProductRepository) UpdateProduct(ctx context.Context, id int, title, handle string) error {
+	defer r.cache.invalidate(r.key)
+	return r.ProductRepositoryInterface.UpdateProduct(ctx, id, title, handle)
+}
+
+// CreateProductsBatch creates products and drops the cached catalog
+func (r *CachingProductRepository) CreateProductsBatch(ctx context.Context, products []struct{ Title, Handle string }) error {
+	defer r.cache.invalidate(r.key)
+	return r.ProductRepositoryInterface.CreateProductsBatch(ctx, products)
+}
+
+// UpdateProductsBatch updates products and drops the cached catalog
+func (r *CachingProductRepository) UpdateProductsBatch(ctx context.Context, updates []struct {
+	ID      int
+	Title   string
+	Handle  string
+	Fields  ProductFields
+	Version int
+}) ([]int, error) {
+	defer r.cache.invalidate(r.key)
+	return r.ProductRepositoryInterface.UpdateProductsBatch(ctx, updates)
+}
+
+// SaveRawTitles stores raw titles and drops the cached catalog
+func (r *CachingProductRepository) SaveRawTitles(ctx context.Context, rawTitles map[int]string) error {
+	defer r.cache.invalidate(r.key)
+	return r.ProductRepositoryInterface.SaveRawTitles(ctx, rawTitles)
+}
+
+// SaveCategories stores categories and drops the cached catalog
+func (r *CachingProductRepository) SaveCategories(ctx context.Context, categories map[int]string) ([]int, error) {
+	defer r.cache.invalidate(r.key)
+	return r.ProductRepositoryInterface.SaveCategories(ctx, categories)
+}
+
+// SavePrices stores prices and drops the cached catalog
+func (r *CachingProductRepository) SavePrices(ctx context.Context, prices map[int]models.ProductPrice) ([]int, error) {
+	defer r.cache.invalidate(r.key)
+	return r.ProductRepositoryInterface.SavePrices(ctx, prices)
+}
+
+// ArchiveProductsBatch archives products and drops the cached catalog
+func (r *CachingProductRepository) ArchiveProductsBatch(ctx context.Context, ids []int) ([]int, error) {
+	defer r.cache.invalidate(r.key)
+	return r.ProductRepositoryInterface.ArchiveProductsBatch(ctx, ids)
+}
+
+// ReactivateProductsBatch reactivates products and drops the cached catalog
+func (r *CachingProductRepository) ReactivateProductsBatch(ctx context.Context, ids []int) (int, error) {
+	defer r.cache.invalidate(r.key)
+	return r.ProductRepositoryInterface.ReactivateProductsBatch(ctx, ids)
+}
+
+// DeleteProducts deletes products and drops the cached catalog
+func (r *CachingProductRepository) DeleteProducts(ctx context.Context, ids []int) (int, error) {
+	defer r.cache.invalidate(r.key)
+	return r.ProductRepositoryInterface.DeleteProducts(ctx, ids)
+}
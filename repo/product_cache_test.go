@@ -0,0 +1,88 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"go-cron/models"
+	"testing"
+	"time"
+)
+
+// checksummedProductRepository is a mock repository with a table checksum
+type checksummedProductRepository struct {
+	*MockProductRepository
+	checksum    string
+	checksumErr error
+}
+
+func (m *checksummedProductRepository) ProductsChecksum(ctx context.Context) (string, error) {
+	return m.checksum, m.checksumErr
+}
+
+// Test_CachingProductRepository tests that the catalog is served from the
+// cache until it expires, a write goes through it or its checksum changes
+func Test_CachingProductRepository(t *testing.T) {
+	reads := 0
+	next := &checksummedProductRepository{checksum: "1:42", MockProductRepository: &MockProductRepository{
+		GetAllProductsFunc: func(ctx context.Context) ([]models.Product, error) {
+			reads++
+			return []models.Product{{ID: 1, Title: "Green tea"}}, nil
+		},
+		UpdateProductFunc: func(ctx context.Context, id int, title, handle string) error { return nil },
+	}}
+	now := time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC)
+	cache := NewProductCache()
+	cache.SetClock(func() time.Time { return now })
+	r := NewCachingProductRepository(next, cache, "db", time.Minute)
+	ctx := context.Background()
+
+	load := func(wantReads int, step string) {
+		t.Helper()
+		products, err := r.GetAllProducts(ctx)
+		if err != nil {
+			t.Fatalf("%s: GetAllProducts failed: %v", step, err)
+		}
+		if len(products) != 1 || reads != wantReads {
+			t.Errorf("%s: expected 1 product after %d reads, got %+v after %d", step, wantReads, products, reads)
+		}
+		// Callers may modify what they get
+		products[0].Title = "changed"
+	}
+
+	load(1, "first load")
+	load(1, "hit")
+
+	now = now.Add(time.Minute)
+	load(2, "expired")
+
+	if err := r.UpdateProduct(ctx, 1, "Green tea", "green-tea"); err != nil {
+		t.Fatalf("UpdateProduct failed: %v", err)
+	}
+	load(3, "after a write")
+
+	next.checksum = "1:43"
+	load(4, "changed elsewhere")
+
+	next.checksumErr = errors.New("connection reset")
+	load(5, "no checksum")
+	next.checksumErr = nil
+	load(6, "cache dropped without checksum")
+}
+
+// Test_CachingProductRepository_Keys tests that databases don't share catalogs
+func Test_CachingProductRepository_Keys(t *testing.T) {
+	cache := NewProductCache()
+	catalog := func(title string) *MockProductRepository {
+		return &MockProductRepository{GetAllProductsFunc: func(ctx context.Context) ([]models.Product, error) {
+			return []models.Product{{Title: title}}, nil
+		}}
+	}
+	a := NewCachingProductRepository(catalog("a"), cache, "a", time.Minute)
+	b := NewCachingProductRepository(catalog("b"), cache, "b", time.Minute)
+	for _, r := range []*CachingProductRepository{a, b, a, b} {
+		products, _ := r.GetAllProducts(context.Background())
+		if products[0].Title != r.key {
+			t.Errorf("Expected the catalog of %s, got %+v", r.key, products)
+		}
+	}
+}
@@ -0,0 +1,332 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"go-cron/internal/recovery"
+	"go-cron/tracing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/lib/pq"
+)
+
+// ProductFields selects the columns UpdateProductsBatch writes for a row.
+// Zero writes all of them.
+type ProductFields uint8
+
+// Columns of UpdateProductsBatch
+const (
+	UpdateTitle ProductFields = 1 << iota
+	UpdateHandle
+	// UpdateAll writes the title and the handle
+	UpdateAll = UpdateTitle | UpdateHandle
+)
+
+// columns returns the columns written, all of them for zero
+func (f ProductFields) columns() ProductFields {
+	if f == 0 {
+		return UpdateAll
+	}
+	return f
+}
+
+// productUpdate is a single row of UpdateProductsBatch
+type productUpdate = struct {
+	ID     int
+	Title  string
+	Handle string
+	Fields ProductFields
+	// Version, when set, skips the row unless it still has this version
+	Version int
+}
+
+// productCreate is a single row of CreateProductsBatch
+type productCreate = struct{ Title, Handle string }
+
+// FailedCreate is a product CreateProductsBatch could not write
+type FailedCreate struct {
+	Title  string
+	Handle string
+	Err    error
+}
+
+// CreateBatchError reports the products of a batch that were not written;
+// every other product of the batch was committed
+type CreateBatchError struct {
+	Total  int
+	Failed []FailedCreate
+}
+
+func (e *CreateBatchError) Error() string {
+	return fmt.Sprintf("%d of %d products were not created: %v", len(e.Failed), e.Total, e.Failed[0].Err)
+}
+
+// Unwrap returns the error of the first failed product
+func (e *CreateBatchError) Unwrap() error {
+	return e.Failed[0].Err
+}
+
+// FailedHandles returns the set of handles that were not written
+func (e *CreateBatchError) FailedHandles() map[string]bool {
+	handles := make(map[string]bool, len(e.Failed))
+	for _, f := range e.Failed {
+		handles[f.Handle] = true
+	}
+	return handles
+}
+
+// UpdateConflictError reports the updates of a batch skipped because their
+// product was written by someone else since it was read; every other update
+// of the batch was applied
+type UpdateConflictError struct {
+	IDs []int
+}
+
+func (e *UpdateConflictError) Error() string {
+	return fmt.Sprintf("%d products changed since they were read and were not updated", len(e.IDs))
+}
+
+// staleUpdates returns an *UpdateConflictError for the versioned updates that
+// changed no row because their product no longer has the version they were
+// computed from, or was deleted. versions returns the current version of the
+// products of ids.
+func staleUpdates(ctx context.Context, updates []productUpdate, changed []int, versions func(ctx context.Context, ids []int) (map[int]int, error)) error {
+	applied := make(map[int]bool, len(changed))
+	for _, id := range changed {
+		applied[id] = true
+	}
+	var missed []productUpdate
+	var ids []int
+	for _, u := range updates {
+		if u.Version > 0 && !applied[u.ID] {
+			missed = append(missed, u)
+			ids = append(ids, u.ID)
+		}
+	}
+	if len(missed) == 0 {
+		return nil
+	}
+
+	current, err := versions(ctx, ids)
+	if err != nil {
+		return fmt.Errorf("failed to check product versions: %w", err)
+	}
+	conflict := &UpdateConflictError{}
+	for _, u := range missed {
+		if version, ok := current[u.ID]; !ok || version != u.Version {
+			conflict.IDs = append(conflict.IDs, u.ID)
+		}
+	}
+	if len(conflict.IDs) == 0 {
+		return nil
+	}
+	return conflict
+}
+
+// productVersions returns the current version of the products of ids
+func (r *ProductRepository) productVersions(ctx context.Context, ids []int) (map[int]int, error) {
+	rows, err := r.db.QueryContext(ctx, r.table.sql(`SELECT id, version FROM products WHERE id = ANY($1)`), pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanVersions(rows)
+}
+
+// scanVersions reads rows of IDs and versions
+func scanVersions(rows *sql.Rows) (map[int]int, error) {
+	versions := make(map[int]int)
+	for rows.Next() {
+		var id, version int
+		if err := rows.Scan(&id, &version); err != nil {
+			return nil, err
+		}
+		versions[id] = version
+	}
+	return versions, rows.Err()
+}
+
+// createChunks inserts products in chunks of createChunkSize, each in its own
+// transaction, carrying on after a failed chunk. With isolateFailed, the rows
+// of a failed chunk are retried one at a time so that only the offending rows
+// are lost. It returns a *CreateBatchError when any row was not written.
+func (r *ProductRepository) createChunks(ctx context.Context, products []productCreate, insert func(context.Context, []productCreate) error, insertRow func(context.Context, productCreate) error) error {
+	size := r.createChunkSize
+	if size <= 0 || size > len(products) {
+		size = len(products)
+	}
+
+	batchErr := &CreateBatchError{Total: len(products)}
+	for start := 0; start < len(products); start += size {
+		end := start + size
+		if end > len(products) {
+			end = len(products)
+		}
+		chunk := products[start:end]
+
+		chunkCtx, span := startSpan(ctx, "create_chunk", len(chunk))
+		err := insert(chunkCtx, chunk)
+		span.RecordError(err)
+		span.End()
+		if err == nil {
+			continue
+		}
+		log.Printf("Insert chunk %d-%d failed: %v", start, end-1, err)
+
+		for _, p := range chunk {
+			rowErr := err
+			if r.isolateFailed && ctx.Err() == nil {
+				rowErr = insertRow(ctx, p)
+			}
+			if rowErr != nil {
+				batchErr.Failed = append(batchErr.Failed, FailedCreate{Title: p.Title, Handle: p.Handle, Err: rowErr})
+			}
+		}
+	}
+
+	if len(batchErr.Failed) > 0 {
+		return batchErr
+	}
+	return nil
+}
+
+// maxDeadlockAttempts bounds how often a chunk is tried when it keeps losing deadlocks
+const maxDeadlockAttempts = 3
+
+// deadlockDetected is the Postgres SQLSTATE for a transaction aborted to break a deadlock
+const deadlockDetected = "40P01"
+
+// shardUpdates sorts updates by ID and splits them into contiguous chunks of at
+// most size updates. The result only depends on the set of IDs, never on the
+// input order, so concurrent syncs shard the same rows the same way.
+func shardUpdates(updates []productUpdate, size int) [][]productUpdate {
+	sorted := make([]productUpdate, len(updates))
+	copy(sorted, updates)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+
+	if size <= 0 || size >= len(sorted) {
+		return [][]productUpdate{sorted}
+	}
+
+	chunks := make([][]productUpdate, 0, (len(sorted)+size-1)/size)
+	for start := 0; start < len(sorted); start += size {
+		end := start + size
+		if end > len(sorted) {
+			end = len(sorted)
+		}
+		chunks = append(chunks, sorted[start:end])
+	}
+	return chunks
+}
+
+// applyChunks runs apply for every chunk on up to updateWorkers goroutines,
+// retrying chunks that were aborted by a deadlock. It returns the IDs changed
+// by the chunks that committed and the first error.
+func (r *ProductRepository) applyChunks(ctx context.Context, chunks [][]productUpdate, apply func(context.Context, []productUpdate) ([]int, error)) ([]int, error) {
+	workers := r.updateWorkers
+	if workers <= 0 {
+		workers = 1
+	}
+	if workers > len(chunks) {
+		workers = len(chunks)
+	}
+
+	jobs := make(chan []productUpdate)
+	errChan := make(chan error, len(chunks))
+	var mu sync.Mutex
+	var changed []int
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chunk := range jobs {
+				var ids []int
+				chunkCtx, span := startSpan(ctx, "update_chunk", len(chunk))
+				err := r.retryOnDeadlock(chunkCtx, func() (err error) {
+					// A panicking chunk fails like any other
+					defer func() {
+						if p := recovery.Error(recover()); p != nil {
+							err = p
+						}
+					}()
+					ids, err = apply(chunkCtx, chunk)
+					return err
+				})
+				span.SetAttributes(tracing.Int("db.rows_changed", len(ids)))
+				span.RecordError(err)
+				span.End()
+				if err != nil {
+					errChan <- err
+					continue
+				}
+				mu.Lock()
+				changed = append(changed, ids...)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, chunk := range chunks {
+		jobs <- chunk
+	}
+	close(jobs)
+	wg.Wait()
+	close(errChan)
+
+	var errs []error
+	for err := range errChan {
+		errs = append(errs, err)
+	}
+	sort.Ints(changed)
+	if len(errs) > 0 {
+		return changed, fmt.Errorf("%d of %d update chunks failed: %w", len(errs), len(chunks), errs[0])
+	}
+	return changed, nil
+}
+
+// retryOnDeadlock runs fn, running it again with a short backoff while it fails with a deadlock
+func (r *ProductRepository) retryOnDeadlock(ctx context.Context, fn func() error) error {
+	var err error
+	for attempt := 1; attempt <= maxDeadlockAttempts; attempt++ {
+		if err = fn(); err == nil || !isDeadlock(err) || attempt == maxDeadlockAttempts {
+			return err
+		}
+
+		retries := r.deadlockRetries.Add(1)
+		log.Printf("Update chunk lost a deadlock (attempt %d, %d retries so far), retrying", attempt, retries)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt) * 50 * time.Millisecond):
+		}
+	}
+	return err
+}
+
+// isDeadlock reports whether err is a Postgres deadlock abort, from either driver
+func isDeadlock(err error) bool {
+	return sqlState(err) == deadlockDetected
+}
+
+// sqlState returns the Postgres SQLSTATE of err, from either driver, or ""
+// when err did not come from Postgres
+func sqlState(err error) string {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return string(pqErr.Code)
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code
+	}
+	return ""
+}
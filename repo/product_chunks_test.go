@@ -0,0 +1,246 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/lib/pq"
+)
+
+func Test_shardUpdates(t *testing.T) {
+	updates := []productUpdate{{ID: 5}, {ID: 1}, {ID: 4}, {ID: 2}, {ID: 3}}
+	reversed := []productUpdate{{ID: 3}, {ID: 2}, {ID: 4}, {ID: 1}, {ID: 5}}
+
+	chunks := shardUpdates(updates, 2)
+	if len(chunks) != 3 {
+		t.Fatalf("Expected 3 chunks, got %d", len(chunks))
+	}
+
+	want := [][]int{{1, 2}, {3, 4}, {5}}
+	for i, chunk := range chunks {
+		for j, u := range chunk {
+			if u.ID != want[i][j] {
+				t.Errorf("chunk %d[%d] = %d, want %d", i, j, u.ID, want[i][j])
+			}
+		}
+	}
+
+	// The same IDs always land in the same chunks, whatever the input order
+	for i, chunk := range shardUpdates(reversed, 2) {
+		for j, u := range chunk {
+			if u.ID != chunks[i][j].ID {
+				t.Errorf("Sharding depends on input order: chunk %d[%d] = %d, want %d", i, j, u.ID, chunks[i][j].ID)
+			}
+		}
+	}
+
+	if updates[0].ID != 5 {
+		t.Error("shardUpdates must not reorder its input")
+	}
+	if got := shardUpdates(updates, 0); len(got) != 1 || len(got[0]) != 5 {
+		t.Errorf("Expected a single chunk when size is 0, got %d", len(got))
+	}
+}
+
+// Test_applyChunks_RetriesDeadlocks simulates chunks contending for the same
+// locks, where Postgres aborts one transaction of each conflicting pair
+func Test_applyChunks_RetriesDeadlocks(t *testing.T) {
+	r := &ProductRepository{}
+	r.SetUpdateParallelism(2, 4)
+
+	var mu sync.Mutex
+	attempts := make(map[int]int)
+	var applied atomic.Int64
+
+	chunks := shardUpdates([]productUpdate{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}, {ID: 5}, {ID: 6}}, 2)
+	changed, err := r.applyChunks(context.Background(), chunks, func(ctx context.Context, chunk []productUpdate) ([]int, error) {
+		mu.Lock()
+		attempts[chunk[0].ID]++
+		n := attempts[chunk[0].ID]
+		mu.Unlock()
+
+		// Every other chunk loses its first attempt
+		if chunk[0].ID%4 == 1 && n == 1 {
+			return nil, &pq.Error{Code: deadlockDetected}
+		}
+		applied.Add(int64(len(chunk)))
+		return []int{chunk[0].ID}, nil
+	})
+	if err != nil {
+		t.Fatalf("Expected deadlocked chunks to succeed on retry, got %v", err)
+	}
+	if applied.Load() != 6 {
+		t.Errorf("Expected 6 updates applied, got %d", applied.Load())
+	}
+	if len(changed) != 3 || changed[0] != 1 || changed[2] != 5 {
+		t.Errorf("Expected the changed IDs of every chunk in order, got %v", changed)
+	}
+	if r.DeadlockRetries() != 2 {
+		t.Errorf("Expected 2 deadlock retries, got %d", r.DeadlockRetries())
+	}
+}
+
+func Test_applyChunks_GivesUp(t *testing.T) {
+	r := &ProductRepository{}
+	r.SetUpdateParallelism(1, 2)
+
+	calls := 0
+	var mu sync.Mutex
+	_, err := r.applyChunks(context.Background(), shardUpdates([]productUpdate{{ID: 1}}, 1), func(ctx context.Context, chunk []productUpdate) ([]int, error) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		return nil, &pq.Error{Code: deadlockDetected}
+	})
+	if err == nil {
+		t.Fatal("Expected an error after repeated deadlocks")
+	}
+	if calls != maxDeadlockAttempts {
+		t.Errorf("Expected %d attempts, got %d", maxDeadlockAttempts, calls)
+	}
+}
+
+func Test_applyChunks_DoesNotRetryOtherErrors(t *testing.T) {
+	r := &ProductRepository{}
+
+	calls := 0
+	boom := errors.New("constraint violation")
+	_, err := r.applyChunks(context.Background(), shardUpdates([]productUpdate{{ID: 1}}, 0), func(ctx context.Context, chunk []productUpdate) ([]int, error) {
+		calls++
+		return nil, boom
+	})
+	if !errors.Is(err, boom) {
+		t.Errorf("Expected the chunk error, got %v", err)
+	}
+	if calls != 1 || r.DeadlockRetries() != 0 {
+		t.Errorf("Expected a single attempt without retries, got %d attempts and %d retries", calls, r.DeadlockRetries())
+	}
+}
+
+// Test_createChunks_ContinuesAfterFailedChunk tests that a bad row only loses its own chunk
+func Test_createChunks_ContinuesAfterFailedChunk(t *testing.T) {
+	products := []productCreate{{Handle: "a"}, {Handle: "b"}, {Handle: "bad"}, {Handle: "c"}, {Handle: "d"}}
+	boom := errors.New("value too long")
+	insert := func(ctx context.Context, chunk []productCreate) error {
+		for _, p := range chunk {
+			if p.Handle == "bad" {
+				return boom
+			}
+		}
+		return nil
+	}
+	insertRow := func(ctx context.Context, p productCreate) error {
+		if p.Handle == "bad" {
+			return boom
+		}
+		return nil
+	}
+
+	r := &ProductRepository{}
+	r.SetCreateChunks(2, false)
+	var batchErr *CreateBatchError
+	if err := r.createChunks(context.Background(), products, insert, insertRow); !errors.As(err, &batchErr) {
+		t.Fatalf("Expected a CreateBatchError, got %v", err)
+	}
+	failed := batchErr.FailedHandles()
+	if len(failed) != 2 || !failed["bad"] || !failed["c"] {
+		t.Errorf("Expected the chunk of the bad row to fail, got %v", failed)
+	}
+	if !errors.Is(batchErr, boom) {
+		t.Errorf("Expected the error to wrap the row error, got %v", batchErr)
+	}
+
+	// Isolating the failed chunk only loses the offending row
+	r.SetCreateChunks(2, true)
+	batchErr = nil
+	if err := r.createChunks(context.Background(), products, insert, insertRow); !errors.As(err, &batchErr) {
+		t.Fatalf("Expected a CreateBatchError, got %v", err)
+	}
+	if failed := batchErr.FailedHandles(); len(failed) != 1 || !failed["bad"] {
+		t.Errorf("Expected only the bad row to fail, got %v", failed)
+	}
+}
+
+func Test_isDeadlock(t *testing.T) {
+	if !isDeadlock(&pq.Error{Code: deadlockDetected}) {
+		t.Error("Expected a pq deadlock to be detected")
+	}
+	if !isDeadlock(fmt.Errorf("chunk: %w", &pgconn.PgError{Code: deadlockDetected})) {
+		t.Error("Expected a wrapped pgx deadlock to be detected")
+	}
+	if isDeadlock(&pgconn.PgError{Code: "23505"}) || isDeadlock(errors.New("deadlock")) {
+		t.Error("Expected other errors not to be deadlocks")
+	}
+}
+
+// Test_updateProductSQL tests that the Postgres update only writes its columns
+// and keeps the title as $1 for the search vector, followed by its key
+func Test_updateProductSQL(t *testing.T) {
+	query, args := updateProductSQL(productUpdate{ID: 7, Title: "Tea", Handle: "tea", Fields: UpdateHandle, Version: 2}, defaultNormalizer)
+	if want := "UPDATE products SET handle = $1, updated_at = NOW(), version = version + 1 WHERE id = $2 AND version = $3 AND (handle IS DISTINCT FROM $1)"; query != want {
+		t.Errorf("Expected %q, got %q", want, query)
+	}
+	if len(args) != 3 || args[0] != "tea" || args[1] != 7 || args[2] != 2 {
+		t.Errorf("Unexpected arguments %v", args)
+	}
+
+	query, args = updateProductSQL(productUpdate{ID: 7, Title: " Tea ", Handle: "tea"}, defaultNormalizer)
+	if !strings.Contains(query, "title = $1, title_key = $2, title_rules = $3, search_vector = "+searchVector+", handle = $4, updated_at = NOW(), version = version + 1 WHERE id = $5 AND (") || len(args) != 5 {
+		t.Errorf("Expected every column without fields, got %q %v", query, args)
+	}
+	if args[1] != "tea" || args[2] != "trim,lower" {
+		t.Errorf("Expected the key of the title and the rules, got %v", args)
+	}
+}
+
+// Test_staleUpdates tests that only the versioned updates whose product moved
+// on or disappeared are conflicts
+func Test_staleUpdates(t *testing.T) {
+	updates := []productUpdate{
+		{ID: 1, Version: 2}, // applied
+		{ID: 2, Version: 2}, // already up to date
+		{ID: 3, Version: 2}, // edited since
+		{ID: 4, Version: 2}, // deleted since
+		{ID: 5},             // unversioned
+	}
+	var asked []int
+	err := staleUpdates(context.Background(), updates, []int{1}, func(ctx context.Context, ids []int) (map[int]int, error) {
+		asked = ids
+		return map[int]int{2: 2, 3: 3}, nil
+	})
+	var conflict *UpdateConflictError
+	if !errors.As(err, &conflict) || fmt.Sprint(conflict.IDs) != "[3 4]" {
+		t.Fatalf("Expected products 3 and 4 to conflict, got %v", err)
+	}
+	if fmt.Sprint(asked) != "[2 3 4]" {
+		t.Errorf("Expected only the missed versioned updates to be checked, got %v", asked)
+	}
+	if err := staleUpdates(context.Background(), updates[:1], []int{1}, nil); err != nil {
+		t.Errorf("Expected no check when every update applied, got %v", err)
+	}
+}
+
+// Test_batchContext tests that the batch timeout is granted per
+// batchTimeoutRows rows, so an unchunked batch is not cut short
+func Test_batchContext(t *testing.T) {
+	r := NewProductRepository(nil)
+	r.SetBatchTimeout(time.Minute)
+	for _, tt := range []struct {
+		rows int
+		want time.Duration
+	}{{0, time.Minute}, {1, time.Minute}, {batchTimeoutRows, time.Minute}, {4*batchTimeoutRows + 1, 5 * time.Minute}} {
+		ctx, cancel := r.batchContext(context.Background(), tt.rows)
+		deadline, _ := ctx.Deadline()
+		cancel()
+		if left := time.Until(deadline); left > tt.want || left < tt.want-time.Second {
+			t.Errorf("Expected %d rows to get %s, got %s", tt.rows, tt.want, left)
+		}
+	}
+}
@@ -0,0 +1,477 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"go-cron/internal/pgtest"
+	"go-cron/models"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	pgtest.Main(m)
+}
+
+// openDB returns a scratch Postgres database migrated to the current schema
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db := pgtest.Open(t)
+	if err := NewProductRepository(db).EnsureSchema(context.Background()); err != nil {
+		t.Fatalf("Failed to migrate the database: %v", err)
+	}
+	return db
+}
+
+// seedProducts inserts products with the given titles and handles, in order, and returns their IDs
+func seedProducts(t *testing.T, db *sql.DB, products ...productCreate) []int {
+	t.Helper()
+	ids := make([]int, len(products))
+	for i, p := range products {
+		err := db.QueryRow(`INSERT INTO products (title, handle, search_vector) VALUES ($1, $2, `+searchVector+`) RETURNING id`,
+			p.Title, p.Handle).Scan(&ids[i])
+		if err != nil {
+			t.Fatalf("Failed to seed %q: %v", p.Title, err)
+		}
+	}
+	return ids
+}
+
+// handlesOf returns the handles of products in order
+func handlesOf(products []models.Product) []string {
+	handles := make([]string, len(products))
+	for i, p := range products {
+		handles[i] = p.Handle
+	}
+	return handles
+}
+
+// Test_ProductRepository_CreateProductsBatch tests that existing handles are
+// skipped by ON CONFLICT and that a bad row only loses itself
+func Test_ProductRepository_CreateProductsBatch(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+	seedProducts(t, db, productCreate{Title: "Oak Chair", Handle: "oak-chair"})
+	if _, err := db.Exec(`ALTER TABLE products ADD CONSTRAINT title_length CHECK (length(title) <= 20)`); err != nil {
+		t.Fatalf("Failed to add constraint: %v", err)
+	}
+
+	r := NewProductRepository(db)
+	r.SetCreateChunks(2, true)
+	err := r.CreateProductsBatch(ctx, []productCreate{
+		{Title: "Oak Chair Renamed", Handle: "oak-chair"},
+		{Title: "Pine Desk", Handle: "pine-desk"},
+		{Title: "A title far too long for the check", Handle: "too-long"},
+		{Title: "Birch Shelf", Handle: "birch-shelf"},
+	})
+	var batchErr *CreateBatchError
+	if !errors.As(err, &batchErr) || len(batchErr.Failed) != 1 || batchErr.Failed[0].Handle != "too-long" {
+		t.Fatalf("Expected only too-long to fail, got %v", err)
+	}
+
+	products, err := r.GetAllProducts(ctx)
+	if err != nil {
+		t.Fatalf("GetAllProducts failed: %v", err)
+	}
+	if got := handlesOf(products); !reflect.DeepEqual(got, []string{"oak-chair", "pine-desk", "birch-shelf"}) {
+		t.Errorf("Expected the valid rows of both chunks, got %v", got)
+	}
+	if products[0].Title != "Oak Chair" {
+		t.Errorf("Expected the conflicting create to leave %q alone, got %q", "Oak Chair", products[0].Title)
+	}
+}
+
+// Test_ProductRepository_UpdateProductsBatch tests that only changed rows are
+// reported and that a failing chunk rolls back all of its rows
+func Test_ProductRepository_UpdateProductsBatch(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+	ids := seedProducts(t, db,
+		productCreate{Title: "Oak Chair", Handle: "oak-chair"},
+		productCreate{Title: "Pine Desk", Handle: "pine-desk"},
+		productCreate{Title: "Birch Shelf", Handle: "birch-shelf"},
+		productCreate{Title: "Elm Table", Handle: "elm-table"},
+	)
+
+	r := NewProductRepository(db)
+	r.SetUpdateParallelism(2, 2)
+	changed, err := r.UpdateProductsBatch(ctx, []productUpdate{
+		{ID: ids[0], Title: "Oak Armchair", Handle: "oak-armchair"},
+		{ID: ids[1], Title: "Pine Desk", Handle: "pine-desk"},
+		// The second chunk fails on the unique handle and rolls back Birch Shelf too
+		{ID: ids[2], Title: "Birch Bookshelf", Handle: "birch-bookshelf"},
+		{ID: ids[3], Title: "Elm Table", Handle: "pine-desk"},
+	})
+	if err == nil {
+		t.Fatal("Expected the duplicate handle to fail its chunk")
+	}
+	if !reflect.DeepEqual(changed, []int{ids[0]}) {
+		t.Errorf("Expected only product %d to change, got %v", ids[0], changed)
+	}
+
+	products, err := r.GetAllProducts(ctx)
+	if err != nil {
+		t.Fatalf("GetAllProducts failed: %v", err)
+	}
+	if got := handlesOf(products); !reflect.DeepEqual(got, []string{"oak-armchair", "pine-desk", "birch-shelf", "elm-table"}) {
+		t.Errorf("Expected the first chunk applied and the second rolled back, got %v", got)
+	}
+	found, err := r.SearchProducts(ctx, "armchair", 10)
+	if err != nil || len(found) != 1 || found[0].ID != ids[0] {
+		t.Errorf("Expected the search vector to follow the new title, got %+v (%v)", found, err)
+	}
+}
+
+// Test_ProductRepository_TitleKeys tests that the products seeded without a
+// key are keyed by the Go normalizer, non-ASCII titles included, and keyed
+// again when the rules change
+func Test_ProductRepository_TitleKeys(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+	ids := seedProducts(t, db,
+		productCreate{Title: "\u00a0ÉCLAIR Café", Handle: "eclair-cafe"},
+		productCreate{Title: "ACME Straße", Handle: "strasse"},
+	)
+
+	r := NewProductRepository(db)
+	products, err := r.GetProductsByTitles(ctx, []string{defaultNormalizer.Normalize("Éclair CAFÉ")})
+	if err != nil || len(products) != 1 || products[0].ID != ids[0] {
+		t.Fatalf("Expected the non-ASCII title to match its Go key, got %+v (%v)", products, err)
+	}
+
+	prefixes, err := NewNormalizer([]string{models.TitleRuleStripPrefixes, models.TitleRuleLower}, []string{"ACME"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SetNormalizer(prefixes)
+	if p, err := r.GetProductByTitle(ctx, "straße"); err != nil || p == nil || p.ID != ids[1] {
+		t.Errorf("Expected the product keyed again by the new rules, got %+v (%v)", p, err)
+	}
+}
+
+// Test_ProductRepository_ProductsChecksum tests that the change marker moves
+// with updates, sync marks and deletes of the products
+func Test_ProductRepository_ProductsChecksum(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+	ids := seedProducts(t, db, productCreate{Title: "Oak Chair", Handle: "oak-chair"}, productCreate{Title: "Pine Desk", Handle: "pine-desk"})
+	r := NewProductRepository(db)
+
+	checksum := func() string {
+		t.Helper()
+		sum, err := r.ProductsChecksum(ctx)
+		if err != nil {
+			t.Fatalf("ProductsChecksum failed: %v", err)
+		}
+		return sum
+	}
+	previous := checksum()
+	for _, write := range []struct {
+		name string
+		run  func() error
+	}{
+		{"update", func() error { return r.UpdateProduct(ctx, ids[0], "Oak Armchair", "oak-armchair") }},
+		{"sync mark", func() error { return r.MarkSynced(ctx, []string{"pine-desk"}) }},
+		{"delete", func() error { _, err := r.DeleteProducts(ctx, ids[1:]); return err }},
+	} {
+		if err := write.run(); err != nil {
+			t.Fatalf("%s failed: %v", write.name, err)
+		}
+		if current := checksum(); current == previous {
+			t.Errorf("Expected the %s to change the checksum %s", write.name, current)
+		} else {
+			previous = current
+		}
+	}
+}
+
+// Test_ProductRepository_SaveCategories tests the COALESCE comparison that
+// reports only changed categories and clears empty ones
+func Test_ProductRepository_SaveCategories(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+	ids := seedProducts(t, db, productCreate{Title: "Oak Chair", Handle: "oak-chair"}, productCreate{Title: "Pine Desk", Handle: "pine-desk"})
+	r := NewProductRepository(db)
+
+	changed, err := r.SaveCategories(ctx, map[int]string{ids[0]: "Chairs", ids[1]: ""})
+	if err != nil || !reflect.DeepEqual(changed, []int{ids[0]}) {
+		t.Fatalf("Expected only oak-chair to change, got %v (%v)", changed, err)
+	}
+	if changed, err = r.SaveCategories(ctx, map[int]string{ids[0]: "Chairs"}); err != nil || len(changed) != 0 {
+		t.Errorf("Expected an unchanged category not to be reported, got %v (%v)", changed, err)
+	}
+	if changed, err = r.SaveCategories(ctx, map[int]string{ids[0]: ""}); err != nil || len(changed) != 1 {
+		t.Errorf("Expected clearing the category to be reported, got %v (%v)", changed, err)
+	}
+	var category sql.NullString
+	if err := db.QueryRow(`SELECT category FROM products WHERE handle = 'oak-chair'`).Scan(&category); err != nil || category.Valid {
+		t.Errorf("Expected the cleared category to be NULL, got %v (%v)", category, err)
+	}
+}
+
+// Test_ProductRepository_SavePrices tests that prices are stored with their
+// currency, reported only when changed and read back by the product queries
+func Test_ProductRepository_SavePrices(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+	ids := seedProducts(t, db, productCreate{Title: "Oak Chair", Handle: "oak-chair"})
+	r := NewProductRepository(db)
+	price := 129.9
+
+	changed, err := r.SavePrices(ctx, map[int]models.ProductPrice{ids[0]: {Amount: &price, Currency: "EUR"}})
+	if err != nil || len(changed) != 1 {
+		t.Fatalf("Expected the new price to be reported, got %v (%v)", changed, err)
+	}
+	if changed, err = r.SavePrices(ctx, map[int]models.ProductPrice{ids[0]: {Amount: &price, Currency: "EUR"}}); err != nil || len(changed) != 0 {
+		t.Errorf("Expected an unchanged price not to be reported, got %v (%v)", changed, err)
+	}
+	p, err := r.GetProductByTitle(ctx, "Oak Chair")
+	if err != nil || p.Price == nil || *p.Price != price || p.Currency != "EUR" {
+		t.Fatalf("Expected the stored price, got %+v (%v)", p, err)
+	}
+
+	if changed, err = r.SavePrices(ctx, map[int]models.ProductPrice{ids[0]: {}}); err != nil || len(changed) != 1 {
+		t.Errorf("Expected clearing the price to be reported, got %v (%v)", changed, err)
+	}
+	if p, err = r.GetProductByTitle(ctx, "Oak Chair"); err != nil || p.Price != nil || p.Currency != "" {
+		t.Errorf("Expected the price to be cleared, got %+v (%v)", p, err)
+	}
+}
+
+// Test_ProductRepository_Paging tests paging, filtering with LIKE wildcards and title lookups
+func Test_ProductRepository_Paging(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+	seedProducts(t, db,
+		productCreate{Title: "Oak Chair", Handle: "oak-chair"},
+		productCreate{Title: "Chair 50% off", Handle: "chair-50-off"},
+		productCreate{Title: "Chair 500", Handle: "chair-500"},
+		productCreate{Title: "Pine Desk", Handle: "pine-desk"},
+	)
+	r := NewProductRepository(db)
+
+	page, err := r.GetProductsPaged(ctx, 1, 2)
+	if err != nil || !reflect.DeepEqual(handlesOf(page), []string{"chair-50-off", "chair-500"}) {
+		t.Errorf("Expected the second and third products, got %v (%v)", handlesOf(page), err)
+	}
+	filter := models.ProductFilter{Title: "50%"}
+	found, err := r.FindProducts(ctx, filter, 0, 10)
+	if err != nil || !reflect.DeepEqual(handlesOf(found), []string{"chair-50-off"}) {
+		t.Errorf("Expected %% to match literally, got %v (%v)", handlesOf(found), err)
+	}
+	if count, err := r.CountMatchingProducts(ctx, models.ProductFilter{Title: "chair"}); err != nil || count != 3 {
+		t.Errorf("Expected 3 chairs, got %d (%v)", count, err)
+	}
+	byTitle, err := r.GetProductsByTitles(ctx, []string{"pine desk", "oak chair", "missing"})
+	if err != nil || !reflect.DeepEqual(handlesOf(byTitle), []string{"oak-chair", "pine-desk"}) {
+		t.Errorf("Expected the products of the normalized titles, got %v (%v)", handlesOf(byTitle), err)
+	}
+}
+
+// Test_ProductRepository_Status tests archiving and reactivating products
+func Test_ProductRepository_Status(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+	ids := seedProducts(t, db, productCreate{Title: "Oak Chair", Handle: "oak-chair"}, productCreate{Title: "Pine Desk", Handle: "pine-desk"})
+	r := NewProductRepository(db)
+
+	if archived, err := r.ArchiveProductsBatch(ctx, ids); err != nil || len(archived) != 2 {
+		t.Fatalf("Expected 2 archived products, got %v (%v)", archived, err)
+	}
+	if archived, err := r.ArchiveProductsBatch(ctx, ids); err != nil || len(archived) != 0 {
+		t.Errorf("Expected archived products to be skipped, got %v (%v)", archived, err)
+	}
+	if active, err := r.CountActiveProducts(ctx); err != nil || active != 0 {
+		t.Errorf("Expected no active products, got %d (%v)", active, err)
+	}
+	if reactivated, err := r.ReactivateProductsBatch(ctx, ids[:1]); err != nil || reactivated != 1 {
+		t.Errorf("Expected 1 reactivated product, got %d (%v)", reactivated, err)
+	}
+
+	products, err := r.GetAllProducts(ctx)
+	if err != nil {
+		t.Fatalf("GetAllProducts failed: %v", err)
+	}
+	if products[0].Archived() || products[0].ArchivedAt != nil {
+		t.Errorf("Expected oak-chair to be active again, got %+v", products[0])
+	}
+	if !products[1].Archived() || products[1].ArchivedAt == nil {
+		t.Errorf("Expected pine-desk to stay archived with a date, got %+v", products[1])
+	}
+	report, err := r.CheckIntegrity(ctx)
+	if err != nil || report.TotalProducts != 2 || report.DuplicateTitles != 0 {
+		t.Errorf("Expected a clean integrity report, got %+v (%v)", report, err)
+	}
+}
+
+// Test_ProductRepository_SaveHandles tests that handles are replaced and that
+// a downloaded picture follows the handle of its product
+func Test_ProductRepository_SaveHandles(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+	ids := seedProducts(t, db, productCreate{Title: "Oak Chair", Handle: "oak_chair"}, productCreate{Title: "Pine Desk", Handle: "pine-desk"})
+	if _, err := db.Exec(`INSERT INTO product_images (product_id, handle, url, content_type, data, sha256, fetched_at)
+		VALUES ($1, 'oak_chair', 'https://img.example.com/oak.jpg', 'image/jpeg', 'x', 'h', NOW())`, ids[0]); err != nil {
+		t.Fatalf("Failed to seed picture: %v", err)
+	}
+	r := NewProductRepository(db)
+
+	changed, err := r.SaveHandles(ctx, map[int]string{ids[0]: "oak-chair", ids[1]: "pine-desk"})
+	if err != nil || changed != 1 {
+		t.Fatalf("Expected one handle to change, got %d (%v)", changed, err)
+	}
+	products, err := r.GetAllProducts(ctx)
+	if err != nil {
+		t.Fatalf("GetAllProducts failed: %v", err)
+	}
+	if got := handlesOf(products); !reflect.DeepEqual(got, []string{"oak-chair", "pine-desk"}) {
+		t.Errorf("Expected the new handle, got %v", got)
+	}
+	image, err := NewMediaRepository(db).GetImage(ctx, ids[0])
+	if err != nil || image == nil || image.Handle != "oak-chair" {
+		t.Errorf("Expected the picture to follow the handle, got %+v (%v)", image, err)
+	}
+	if err := r.EnsureHandleIndex(ctx); err != nil {
+		t.Errorf("EnsureHandleIndex failed: %v", err)
+	}
+}
+
+// Test_BenchmarkBatchSizes tests that every size is measured and that the
+// synthetic products are removed
+func Test_BenchmarkBatchSizes(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+	seedProducts(t, db, productCreate{Title: "Oak Chair", Handle: "oak-chair"})
+	r := NewProductRepository(db)
+
+	results, err := BenchmarkBatchSizes(ctx, r, r, BenchOptions{Sizes: []int{2, 5}, Rows: 10, Workers: 2})
+	if err != nil {
+		t.Fatalf("BenchmarkBatchSizes failed: %v", err)
+	}
+	if len(results) != 2 || results[0].BatchSize != 2 || results[1].Rows != 10 {
+		t.Errorf("Expected a result per size, got %+v", results)
+	}
+	if count, err := r.CountProducts(ctx); err != nil || count != 1 {
+		t.Errorf("Expected only the seeded product to remain, got %d (%v)", count, err)
+	}
+}
+
+// Test_ProductRepository_Export tests the export filters and its paging cursor
+func Test_ProductRepository_Export(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+	ids := seedProducts(t, db,
+		productCreate{Title: "Oak Chair", Handle: "oak-chair"},
+		productCreate{Title: "Pine Desk", Handle: "pine-desk"},
+		productCreate{Title: "Birch Stool", Handle: "birch-stool"},
+		productCreate{Title: "Elm Shelf", Handle: "elm-shelf"})
+	r := NewProductRepository(db)
+	if _, err := r.SaveCategories(ctx, map[int]string{ids[0]: "Seating", ids[2]: "Seating", ids[3]: "Seating"}); err != nil {
+		t.Fatalf("SaveCategories failed: %v", err)
+	}
+	if _, err := r.ArchiveProductsBatch(ctx, ids[3:]); err != nil {
+		t.Fatalf("ArchiveProductsBatch failed: %v", err)
+	}
+
+	export := func(filter models.ExportFilter, after, limit int) []string {
+		t.Helper()
+		var handles []string
+		err := r.ExportProducts(ctx, filter, after, limit, func(p models.Product) error {
+			handles = append(handles, p.Handle)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("ExportProducts failed: %v", err)
+		}
+		return handles
+	}
+
+	seating := models.ExportFilter{Category: "Seating"}
+	if got := export(seating, 0, 10); !reflect.DeepEqual(got, []string{"oak-chair", "birch-stool"}) {
+		t.Errorf("Expected the active seating, got %v", got)
+	}
+	seating.IncludeArchived = true
+	next, err := r.NextExportCursor(ctx, seating, 0, 2)
+	if err != nil || next != ids[2] {
+		t.Fatalf("Expected the next page after %d, got %d (%v)", ids[2], next, err)
+	}
+	if got := export(seating, next, 2); !reflect.DeepEqual(got, []string{"elm-shelf"}) {
+		t.Errorf("Expected the archived shelf on the last page, got %v", got)
+	}
+	if next, err := r.NextExportCursor(ctx, seating, next, 2); err != nil || next != 0 {
+		t.Errorf("Expected no page after the last one, got %d (%v)", next, err)
+	}
+
+	if err := NewAuditRepository(db).RecordChanges(ctx, []models.ProductChange{{ProductID: ids[1], Action: models.ChangeActionUpdate}}); err != nil {
+		t.Fatalf("RecordChanges failed: %v", err)
+	}
+	recent := models.ExportFilter{UpdatedSince: time.Now().Add(-time.Hour)}
+	if got := export(recent, 0, 10); !reflect.DeepEqual(got, []string{"pine-desk"}) {
+		t.Errorf("Expected the recently changed desk, got %v", got)
+	}
+}
+
+// Test_ProductRepository_Timestamps tests that writes move updated_at and
+// that marked products get a last_synced_at
+func Test_ProductRepository_Timestamps(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+	ids := seedProducts(t, db, productCreate{Title: "Oak Chair", Handle: "oak-chair"}, productCreate{Title: "Pine Desk", Handle: "pine-desk"})
+	if _, err := db.Exec(`UPDATE products SET created_at = NOW() - INTERVAL '1 day', updated_at = NOW() - INTERVAL '1 day'`); err != nil {
+		t.Fatalf("Failed to age products: %v", err)
+	}
+	r := NewProductRepository(db)
+	if _, err := r.UpdateProductsBatch(ctx, []productUpdate{{ID: ids[0], Title: "Oak Chair XL", Fields: UpdateTitle}}); err != nil {
+		t.Fatalf("UpdateProductsBatch failed: %v", err)
+	}
+	if err := r.MarkSynced(ctx, []string{"pine-desk"}); err != nil {
+		t.Fatalf("MarkSynced failed: %v", err)
+	}
+
+	products, err := r.GetAllProducts(ctx)
+	if err != nil || len(products) != 2 {
+		t.Fatalf("Expected 2 products, got %d (%v)", len(products), err)
+	}
+	chair, desk := products[0], products[1]
+	if chair.UpdatedAt == nil || !chair.UpdatedAt.After(*chair.CreatedAt) || chair.LastSyncedAt != nil {
+		t.Errorf("Expected the chair to be updated and never synced, got %+v", chair)
+	}
+	if desk.UpdatedAt == nil || desk.UpdatedAt.After(*desk.CreatedAt) || desk.LastSyncedAt == nil {
+		t.Errorf("Expected the desk to be synced but not updated, got %+v", desk)
+	}
+}
+
+// Test_ProductRepository_UpdateConflicts tests that an update computed from a
+// stale version leaves the product edited meanwhile alone and is reported
+func Test_ProductRepository_UpdateConflicts(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+	ids := seedProducts(t, db, productCreate{Title: "Oak Chair", Handle: "oak-chair"}, productCreate{Title: "Pine Desk", Handle: "pine-desk"})
+	r := NewProductRepository(db)
+	read, err := r.GetAllProducts(ctx)
+	if err != nil {
+		t.Fatalf("GetAllProducts failed: %v", err)
+	}
+	// An admin edits the chair after the sync read it
+	if err := r.UpdateProduct(ctx, ids[0], "Oak Armchair", "oak-armchair"); err != nil {
+		t.Fatalf("UpdateProduct failed: %v", err)
+	}
+
+	changed, err := r.UpdateProductsBatch(ctx, []productUpdate{
+		{ID: ids[0], Title: "Oak Chair XL", Fields: UpdateTitle, Version: read[0].Version},
+		{ID: ids[1], Title: "Pine Desk XL", Fields: UpdateTitle, Version: read[1].Version},
+	})
+	var conflict *UpdateConflictError
+	if !errors.As(err, &conflict) || !reflect.DeepEqual(conflict.IDs, ids[:1]) {
+		t.Fatalf("Expected the chair to conflict, got %v", err)
+	}
+	if !reflect.DeepEqual(changed, ids[1:]) {
+		t.Errorf("Expected the desk to be updated, got %v", changed)
+	}
+	chair, err := r.GetProductByTitle(ctx, "Oak Armchair")
+	if err != nil || chair == nil || chair.Version != read[0].Version+1 {
+		t.Errorf("Expected the admin edit to be kept, got %+v (%v)", chair, err)
+	}
+}
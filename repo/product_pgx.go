@@ -0,0 +1,311 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+
+	"go-cron/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PgxProductRepository is a ProductRepository whose bulk writes go through a
+// pgx pool: new products are streamed with COPY and updates are pipelined in
+// a single round trip per chunk instead of one prepared statement execution
+// per row. Reads and single-row writes are served by the embedded
+// database/sql repository, whose chunking, parallelism, timeout and progress
+// settings also apply to the bulk writes.
+type PgxProductRepository struct {
+	*ProductRepository
+	pool *pgxpool.Pool
+}
+
+var _ ProductRepositoryInterface = (*PgxProductRepository)(nil)
+
+// NewPgxProductRepository creates a product repository writing batches
+// through pool and everything else through products
+func NewPgxProductRepository(products *ProductRepository, pool *pgxpool.Pool) *PgxProductRepository {
+	return &PgxProductRepository{ProductRepository: products, pool: pool}
+}
+
+// createStagingSQL creates the table new products are copied into before
+// being inserted, so duplicates can still be skipped with ON CONFLICT
+const createStagingSQL = `CREATE TEMP TABLE products_staging (title text, handle text, title_key text) ON COMMIT DROP`
+
+// insertStagedSQL moves the staged products into the products table, their
+// keys computed by the normalizer of signature $1
+const insertStagedSQL = `
+		INSERT INTO products (title, handle, search_vector, title_key, title_rules)
+		SELECT title, handle, to_tsvector('` + searchLanguage + `', title), title_key, $1 FROM products_staging
+		ON CONFLICT (handle) DO NOTHING`
+
+// CreateProductsBatch creates multiple products like
+// ProductRepository.CreateProductsBatch, copying every chunk into a staging
+// table in one COPY. Rows of a failed chunk are isolated with single inserts.
+func (r *PgxProductRepository) CreateProductsBatch(ctx context.Context, products []struct{ Title, Handle string }) error {
+	if len(products) == 0 {
+		return nil
+	}
+
+	progress := newBatchProgress(PhaseCreate, len(products), r.progress)
+	insert := func(ctx context.Context, chunk []productCreate) error {
+		return r.copyChunk(ctx, chunk, progress)
+	}
+	return r.createChunks(ctx, products, insert, r.createRow)
+}
+
+// copyChunk inserts one chunk of products in a single transaction
+func (r *PgxProductRepository) copyChunk(ctx context.Context, products []productCreate, progress *batchProgress) error {
+	ctx, cancel := r.batchContext(ctx, len(products))
+	defer cancel()
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, createStagingSQL); err != nil {
+		return fmt.Errorf("failed to create staging table: %w", err)
+	}
+	rows := pgx.CopyFromSlice(len(products), func(i int) ([]any, error) {
+		return []any{products[i].Title, products[i].Handle, r.titles.Normalize(products[i].Title)}, nil
+	})
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"products_staging"}, []string{"title", "handle", "title_key"}, rows); err != nil {
+		return fmt.Errorf("failed to copy products: %w", err)
+	}
+	if _, err := tx.Exec(ctx, r.table.sql(insertStagedSQL), r.titles.Signature()); err != nil {
+		return fmt.Errorf("failed to insert products: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return progress.rows(ctx, len(products))
+}
+
+// UpdateProductsBatch updates multiple products like
+// ProductRepository.UpdateProductsBatch, sending every chunk as one pgx batch
+func (r *PgxProductRepository) UpdateProductsBatch(ctx context.Context, updates []struct {
+	ID      int
+	Title   string
+	Handle  string
+	Fields  ProductFields
+	Version int
+}) ([]int, error) {
+	if len(updates) == 0 {
+		return nil, nil
+	}
+
+	progress := newBatchProgress(PhaseUpdate, len(updates), r.progress)
+	changed, err := r.applyChunks(ctx, shardUpdates(updates, r.updateChunkSize), func(ctx context.Context, chunk []productUpdate) ([]int, error) {
+		return r.updateChunk(ctx, chunk, progress)
+	})
+	if err != nil {
+		return changed, err
+	}
+	return changed, staleUpdates(ctx, updates, changed, r.productVersions)
+}
+
+// updateChunk updates one chunk of products in a single transaction and returns the IDs that changed
+func (r *PgxProductRepository) updateChunk(ctx context.Context, updates []productUpdate, progress *batchProgress) ([]int, error) {
+	ctx, cancel := r.batchContext(ctx, len(updates))
+	defer cancel()
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	batch := &pgx.Batch{}
+	for _, u := range updates {
+		query, args := updateProductSQL(u, r.titles)
+		batch.Queue(r.table.sql(query), args...)
+	}
+	changed, err := func() ([]int, error) {
+		results := tx.SendBatch(ctx, batch)
+		defer results.Close()
+
+		var changed []int
+		for _, u := range updates {
+			tag, err := results.Exec()
+			if err != nil {
+				return nil, fmt.Errorf("failed to update product %d: %w", u.ID, err)
+			}
+			if tag.RowsAffected() > 0 {
+				changed = append(changed, u.ID)
+			}
+			if err := progress.row(ctx); err != nil {
+				return nil, err
+			}
+		}
+		return changed, results.Close()
+	}()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return changed, nil
+}
+
+// SaveRawTitles stores the unsanitized titles like
+// ProductRepository.SaveRawTitles, sending them as one pgx batch
+func (r *PgxProductRepository) SaveRawTitles(ctx context.Context, rawTitles map[int]string) error {
+	if len(rawTitles) == 0 {
+		return nil
+	}
+
+	ctx, span := startSpan(ctx, "save_raw_titles", len(rawTitles))
+	defer span.End()
+	ctx, cancel := r.batchContext(ctx, len(rawTitles))
+	defer cancel()
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	batch := &pgx.Batch{}
+	ids := make([]int, 0, len(rawTitles))
+	for id, raw := range rawTitles {
+		batch.Queue(r.table.sql(saveRawTitleSQL), id, raw)
+		ids = append(ids, id)
+	}
+	err = func() error {
+		results := tx.SendBatch(ctx, batch)
+		defer results.Close()
+
+		progress := newBatchProgress(PhaseRawTitles, len(rawTitles), r.progress)
+		for _, id := range ids {
+			if _, err := results.Exec(); err != nil {
+				return fmt.Errorf("failed to save raw title of product %d: %w", id, err)
+			}
+			if err := progress.row(ctx); err != nil {
+				return err
+			}
+		}
+		return results.Close()
+	}()
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// SaveCategories stores the categories like
+// ProductRepository.SaveCategories, sending them as one pgx batch
+func (r *PgxProductRepository) SaveCategories(ctx context.Context, categories map[int]string) ([]int, error) {
+	if len(categories) == 0 {
+		return nil, nil
+	}
+
+	ctx, span := startSpan(ctx, "save_categories", len(categories))
+	defer span.End()
+	ctx, cancel := r.batchContext(ctx, len(categories))
+	defer cancel()
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	batch := &pgx.Batch{}
+	ids := make([]int, 0, len(categories))
+	for id, category := range categories {
+		batch.Queue(r.table.sql(saveCategorySQL), id, category)
+		ids = append(ids, id)
+	}
+	var changed []int
+	err = func() error {
+		results := tx.SendBatch(ctx, batch)
+		defer results.Close()
+
+		progress := newBatchProgress(PhaseCategory, len(categories), r.progress)
+		for _, id := range ids {
+			tag, err := results.Exec()
+			if err != nil {
+				return fmt.Errorf("failed to save category of product %d: %w", id, err)
+			}
+			if tag.RowsAffected() > 0 {
+				changed = append(changed, id)
+			}
+			if err := progress.row(ctx); err != nil {
+				return err
+			}
+		}
+		return results.Close()
+	}()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return changed, nil
+}
+
+// SavePrices stores the prices like ProductRepository.SavePrices, sending
+// them as one pgx batch
+func (r *PgxProductRepository) SavePrices(ctx context.Context, prices map[int]models.ProductPrice) ([]int, error) {
+	if len(prices) == 0 {
+		return nil, nil
+	}
+
+	ctx, span := startSpan(ctx, "save_prices", len(prices))
+	defer span.End()
+	ctx, cancel := r.batchContext(ctx, len(prices))
+	defer cancel()
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	batch := &pgx.Batch{}
+	ids := make([]int, 0, len(prices))
+	for id, price := range prices {
+		batch.Queue(r.table.sql(savePriceSQL), id, price.Amount, price.Currency)
+		ids = append(ids, id)
+	}
+	var changed []int
+	err = func() error {
+		results := tx.SendBatch(ctx, batch)
+		defer results.Close()
+
+		progress := newBatchProgress(PhasePrice, len(prices), r.progress)
+		for _, id := range ids {
+			tag, err := results.Exec()
+			if err != nil {
+				return fmt.Errorf("failed to save price of product %d: %w", id, err)
+			}
+			if tag.RowsAffected() > 0 {
+				changed = append(changed, id)
+			}
+			if err := progress.row(ctx); err != nil {
+				return err
+			}
+		}
+		return results.Close()
+	}()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return changed, nil
+}
@@ -0,0 +1,217 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"go-cron/internal/pgtest"
+	"go-cron/models"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// openPgx returns a pgx product repository over a scratch Postgres database
+// migrated to the current schema, and the database/sql connection to it
+func openPgx(t *testing.T) (*PgxProductRepository, *sql.DB) {
+	t.Helper()
+	db, pool := pgtest.OpenPool(t)
+	products := NewProductRepository(db)
+	if err := products.EnsureSchema(context.Background()); err != nil {
+		t.Fatalf("Failed to migrate the database: %v", err)
+	}
+	return NewPgxProductRepository(products, pool), db
+}
+
+// Test_PgxProductRepository_CreateProductsBatch tests that the copied rows
+// skip existing handles and that a bad row only loses itself
+func Test_PgxProductRepository_CreateProductsBatch(t *testing.T) {
+	r, db := openPgx(t)
+	ctx := context.Background()
+	seedProducts(t, db, productCreate{Title: "Oak Chair", Handle: "oak-chair"})
+	if _, err := db.Exec(`ALTER TABLE products ADD CONSTRAINT title_length CHECK (length(title) <= 20)`); err != nil {
+		t.Fatalf("Failed to add constraint: %v", err)
+	}
+
+	r.SetCreateChunks(2, true)
+	err := r.CreateProductsBatch(ctx, []productCreate{
+		{Title: "Oak Chair Renamed", Handle: "oak-chair"},
+		{Title: "Pine Desk", Handle: "pine-desk"},
+		{Title: "A title far too long for the check", Handle: "too-long"},
+		{Title: "Birch Shelf", Handle: "birch-shelf"},
+	})
+	var batchErr *CreateBatchError
+	if !errors.As(err, &batchErr) || len(batchErr.Failed) != 1 || batchErr.Failed[0].Handle != "too-long" {
+		t.Fatalf("Expected only too-long to fail, got %v", err)
+	}
+
+	products, err := r.GetAllProducts(ctx)
+	if err != nil {
+		t.Fatalf("GetAllProducts failed: %v", err)
+	}
+	if got := handlesOf(products); !reflect.DeepEqual(got, []string{"oak-chair", "pine-desk", "birch-shelf"}) {
+		t.Errorf("Expected the valid rows of both chunks, got %v", got)
+	}
+	if products[0].Title != "Oak Chair" {
+		t.Errorf("Expected the conflicting create to leave %q alone, got %q", "Oak Chair", products[0].Title)
+	}
+	found, err := r.SearchProducts(ctx, "pine", 10)
+	if err != nil || len(found) != 1 || found[0].Handle != "pine-desk" {
+		t.Errorf("Expected the copied row to be searchable, got %+v (%v)", found, err)
+	}
+	if p, err := r.GetProductByTitle(ctx, " birch shelf"); err != nil || p == nil || p.Handle != "birch-shelf" {
+		t.Errorf("Expected the copied row to be keyed by its title, got %+v (%v)", p, err)
+	}
+}
+
+// Test_PgxProductRepository_UpdateProductsBatch tests that only changed rows
+// are reported and that a failing pipelined chunk rolls back all of its rows
+func Test_PgxProductRepository_UpdateProductsBatch(t *testing.T) {
+	r, db := openPgx(t)
+	ctx := context.Background()
+	ids := seedProducts(t, db,
+		productCreate{Title: "Oak Chair", Handle: "oak-chair"},
+		productCreate{Title: "Pine Desk", Handle: "pine-desk"},
+		productCreate{Title: "Birch Shelf", Handle: "birch-shelf"},
+		productCreate{Title: "Elm Table", Handle: "elm-table"},
+	)
+
+	r.SetUpdateParallelism(2, 2)
+	changed, err := r.UpdateProductsBatch(ctx, []productUpdate{
+		{ID: ids[0], Title: "Oak Armchair", Handle: "oak-armchair"},
+		{ID: ids[1], Title: "Pine Desk", Handle: "pine-desk"},
+		// The second chunk fails on the unique handle and rolls back Birch Shelf too
+		{ID: ids[2], Title: "Birch Bookshelf", Handle: "birch-bookshelf"},
+		{ID: ids[3], Title: "Elm Table", Handle: "pine-desk"},
+	})
+	if err == nil {
+		t.Fatal("Expected the duplicate handle to fail its chunk")
+	}
+	if !reflect.DeepEqual(changed, []int{ids[0]}) {
+		t.Errorf("Expected only product %d to change, got %v", ids[0], changed)
+	}
+
+	products, err := r.GetAllProducts(ctx)
+	if err != nil {
+		t.Fatalf("GetAllProducts failed: %v", err)
+	}
+	if got := handlesOf(products); !reflect.DeepEqual(got, []string{"oak-armchair", "pine-desk", "birch-shelf", "elm-table"}) {
+		t.Errorf("Expected the first chunk applied and the second rolled back, got %v", got)
+	}
+	found, err := r.SearchProducts(ctx, "armchair", 10)
+	if err != nil || len(found) != 1 || found[0].ID != ids[0] {
+		t.Errorf("Expected the search vector to follow the new title, got %+v (%v)", found, err)
+	}
+	if p, err := r.GetProductByTitle(ctx, "OAK ARMCHAIR"); err != nil || p == nil || p.ID != ids[0] {
+		t.Errorf("Expected the title key to follow the new title, got %+v (%v)", p, err)
+	}
+}
+
+// Test_PgxProductRepository_UpdateConflicts tests that a pipelined update
+// computed from a stale version leaves the product edited meanwhile alone
+func Test_PgxProductRepository_UpdateConflicts(t *testing.T) {
+	r, db := openPgx(t)
+	ctx := context.Background()
+	ids := seedProducts(t, db, productCreate{Title: "Oak Chair", Handle: "oak-chair"}, productCreate{Title: "Pine Desk", Handle: "pine-desk"})
+	read, err := r.GetAllProducts(ctx)
+	if err != nil {
+		t.Fatalf("GetAllProducts failed: %v", err)
+	}
+	if err := r.UpdateProduct(ctx, ids[0], "Oak Armchair", "oak-armchair"); err != nil {
+		t.Fatalf("UpdateProduct failed: %v", err)
+	}
+
+	changed, err := r.UpdateProductsBatch(ctx, []productUpdate{
+		{ID: ids[0], Title: "Oak Chair XL", Fields: UpdateTitle, Version: read[0].Version},
+		{ID: ids[1], Title: "Pine Desk XL", Fields: UpdateTitle, Version: read[1].Version},
+	})
+	var conflict *UpdateConflictError
+	if !errors.As(err, &conflict) || !reflect.DeepEqual(conflict.IDs, ids[:1]) {
+		t.Fatalf("Expected the chair to conflict, got %v", err)
+	}
+	if !reflect.DeepEqual(changed, ids[1:]) {
+		t.Errorf("Expected the desk to be updated, got %v", changed)
+	}
+	if chair, err := r.GetProductByTitle(ctx, "Oak Armchair"); err != nil || chair == nil || chair.ID != ids[0] {
+		t.Errorf("Expected the edit to be kept, got %+v (%v)", chair, err)
+	}
+}
+
+// Test_PgxProductRepository_SaveRawTitles tests that the pipelined raw titles
+// are stored next to their products
+func Test_PgxProductRepository_SaveRawTitles(t *testing.T) {
+	r, db := openPgx(t)
+	ctx := context.Background()
+	ids := seedProducts(t, db, productCreate{Title: "Oak Chair", Handle: "oak-chair"}, productCreate{Title: "Pine Desk", Handle: "pine-desk"})
+
+	if err := r.SaveRawTitles(ctx, map[int]string{ids[0]: "OAK-CHAIR!!", ids[1]: "pine desk"}); err != nil {
+		t.Fatalf("SaveRawTitles failed: %v", err)
+	}
+	rows, err := db.Query(`SELECT raw_title FROM products ORDER BY id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var raw []string
+	for rows.Next() {
+		var title string
+		if err := rows.Scan(&title); err != nil {
+			t.Fatal(err)
+		}
+		raw = append(raw, title)
+	}
+	if !reflect.DeepEqual(raw, []string{"OAK-CHAIR!!", "pine desk"}) {
+		t.Errorf("Expected the raw titles to be stored, got %v", raw)
+	}
+}
+
+// Test_PgxProductRepository_SaveCategories tests that only changed categories
+// are reported and empty ones are cleared
+func Test_PgxProductRepository_SaveCategories(t *testing.T) {
+	r, db := openPgx(t)
+	ctx := context.Background()
+	ids := seedProducts(t, db, productCreate{Title: "Oak Chair", Handle: "oak-chair"}, productCreate{Title: "Pine Desk", Handle: "pine-desk"})
+
+	changed, err := r.SaveCategories(ctx, map[int]string{ids[0]: "Chairs", ids[1]: ""})
+	if err != nil || !reflect.DeepEqual(changed, []int{ids[0]}) {
+		t.Fatalf("Expected only oak-chair to change, got %v (%v)", changed, err)
+	}
+	if changed, err = r.SaveCategories(ctx, map[int]string{ids[0]: "Chairs"}); err != nil || len(changed) != 0 {
+		t.Errorf("Expected an unchanged category not to be reported, got %v (%v)", changed, err)
+	}
+	if changed, err = r.SaveCategories(ctx, map[int]string{ids[0]: ""}); err != nil || len(changed) != 1 {
+		t.Errorf("Expected clearing the category to be reported, got %v (%v)", changed, err)
+	}
+	var category sql.NullString
+	if err := db.QueryRow(`SELECT category FROM products WHERE handle = 'oak-chair'`).Scan(&category); err != nil || category.Valid {
+		t.Errorf("Expected the cleared category to be NULL, got %v (%v)", category, err)
+	}
+}
+
+// Test_PgxProductRepository_SavePrices tests that prices are stored with
+// their currency and reported only when changed
+func Test_PgxProductRepository_SavePrices(t *testing.T) {
+	r, db := openPgx(t)
+	ctx := context.Background()
+	ids := seedProducts(t, db, productCreate{Title: "Oak Chair", Handle: "oak-chair"}, productCreate{Title: "Pine Desk", Handle: "pine-desk"})
+	price := 129.9
+
+	changed, err := r.SavePrices(ctx, map[int]models.ProductPrice{
+		ids[0]: {Amount: &price, Currency: "EUR"},
+		ids[1]: {Amount: &price, Currency: "EUR"},
+	})
+	sort.Ints(changed)
+	if err != nil || !reflect.DeepEqual(changed, ids) {
+		t.Fatalf("Expected the new prices to be reported, got %v (%v)", changed, err)
+	}
+	if changed, err = r.SavePrices(ctx, map[int]models.ProductPrice{ids[0]: {Amount: &price, Currency: "EUR"}}); err != nil || len(changed) != 0 {
+		t.Errorf("Expected an unchanged price not to be reported, got %v (%v)", changed, err)
+	}
+	if changed, err = r.SavePrices(ctx, map[int]models.ProductPrice{ids[0]: {}}); err != nil || len(changed) != 1 {
+		t.Errorf("Expected clearing the price to be reported, got %v (%v)", changed, err)
+	}
+	p, err := r.GetProductByTitle(ctx, "Oak Chair")
+	if err != nil || p.Price != nil || p.Currency != "" {
+		t.Errorf("Expected the price to be cleared, got %+v (%v)", p, err)
+	}
+}
@@ -0,0 +1,487 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"go-cron/models"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SQLProductRepository stores products in MySQL or SQLite through database/sql.
+// It is a plain port of ProductRepository: writes go one prepared statement
+// per row in a single transaction, searches match every word of the query
+// with LIKE instead of a full-text index, and title lookups compute the keys
+// of the normalizer in Go, reading the whole catalog, instead of storing them
+// in title_key. That suits local development and tests.
+type SQLProductRepository struct {
+	db      *sql.DB
+	dialect Dialect
+	titles  *Normalizer
+}
+
+var _ ProductRepositoryInterface = (*SQLProductRepository)(nil)
+
+// NewSQLProductRepository creates a product repository writing SQL of dialect
+func NewSQLProductRepository(db *sql.DB, dialect Dialect) *SQLProductRepository {
+	return &SQLProductRepository{db: db, dialect: dialect, titles: defaultNormalizer}
+}
+
+// SetNormalizer makes the title lookups match products by the keys of n; it
+// must be the normalizer of the SyncService using the repository
+func (r *SQLProductRepository) SetNormalizer(n *Normalizer) {
+	r.titles = n
+}
+
+// EnsureSchema creates the products table when it does not exist
+func (r *SQLProductRepository) EnsureSchema(ctx context.Context) error {
+	for _, ddl := range r.dialect.productsSchema() {
+		if _, err := r.db.ExecContext(ctx, ddl); err != nil {
+			return fmt.Errorf("failed to create the products table: %w", err)
+		}
+	}
+	return nil
+}
+
+// query reads the products selected by the clauses following FROM products
+func (r *SQLProductRepository) query(ctx context.Context, clauses string, args ...interface{}) ([]models.Product, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+productColumns+` FROM products `+clauses, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query products: %w", err)
+	}
+	defer rows.Close()
+
+	return scanProducts(rows)
+}
+
+// count runs a COUNT(*) query
+func (r *SQLProductRepository) count(ctx context.Context, query string, args ...interface{}) (int, error) {
+	var count int
+	if err := r.db.QueryRowContext(ctx, query, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count products: %w", err)
+	}
+	return count, nil
+}
+
+// GetAllProducts fetches all products from the database
+func (r *SQLProductRepository) GetAllProducts(ctx context.Context) ([]models.Product, error) {
+	return r.query(ctx, `ORDER BY id`)
+}
+
+// GetProductsPaged fetches a page of products ordered by ID
+func (r *SQLProductRepository) GetProductsPaged(ctx context.Context, offset, limit int) ([]models.Product, error) {
+	return r.query(ctx, `ORDER BY id LIMIT ? OFFSET ?`, limit, offset)
+}
+
+// sqlFilterClause matches products against a models.ProductFilter; see filterArgs
+const sqlFilterClause = `(? = '' OR LOWER(title) LIKE ? ESCAPE '!') AND (? = '' OR handle = ?)`
+
+// filterArgs returns the arguments of sqlFilterClause
+func filterArgs(filter models.ProductFilter) []interface{} {
+	pattern := "%" + escapeLikeBang(strings.ToLower(filter.Title)) + "%"
+	return []interface{}{filter.Title, pattern, filter.Handle, filter.Handle}
+}
+
+// FindProducts returns a page of products matching filter, ordered by ID
+func (r *SQLProductRepository) FindProducts(ctx context.Context, filter models.ProductFilter, offset, limit int) ([]models.Product, error) {
+	args := append(filterArgs(filter), limit, offset)
+	return r.query(ctx, `WHERE `+sqlFilterClause+` ORDER BY id LIMIT ? OFFSET ?`, args...)
+}
+
+// CountMatchingProducts returns the number of products matching filter
+func (r *SQLProductRepository) CountMatchingProducts(ctx context.Context, filter models.ProductFilter) (int, error) {
+	return r.count(ctx, `SELECT COUNT(*) FROM products WHERE `+sqlFilterClause, filterArgs(filter)...)
+}
+
+// SearchProducts returns up to limit active products whose title contains
+// every word of query, ordered by ID
+func (r *SQLProductRepository) SearchProducts(ctx context.Context, query string, limit int) ([]models.Product, error) {
+	clauses := []string{`COALESCE(status, 'active') <> 'archived'`}
+	var args []interface{}
+	for _, word := range strings.Fields(strings.ToLower(query)) {
+		clauses = append(clauses, `LOWER(title) LIKE ? ESCAPE '!'`)
+		args = append(args, "%"+escapeLikeBang(word)+"%")
+	}
+	args = append(args, limit)
+	return r.query(ctx, `WHERE `+strings.Join(clauses, ` AND `)+` ORDER BY id LIMIT ?`, args...)
+}
+
+// GetProductsByTitles fetches the products whose title key, as computed by the normalizer, is in titles
+func (r *SQLProductRepository) GetProductsByTitles(ctx context.Context, titles []string) ([]models.Product, error) {
+	if len(titles) == 0 {
+		return nil, nil
+	}
+	wanted := make(map[string]bool, len(titles))
+	for _, title := range titles {
+		wanted[title] = true
+	}
+
+	all, err := r.GetAllProducts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var products []models.Product
+	for _, p := range all {
+		if wanted[r.titles.Normalize(p.Title)] {
+			products = append(products, p)
+		}
+	}
+	return products, nil
+}
+
+// CountProducts returns the number of products in the database, archived ones included
+func (r *SQLProductRepository) CountProducts(ctx context.Context) (int, error) {
+	return r.count(ctx, `SELECT COUNT(*) FROM products`)
+}
+
+// CountActiveProducts returns the number of products that are not archived
+func (r *SQLProductRepository) CountActiveProducts(ctx context.Context) (int, error) {
+	return r.count(ctx, `SELECT COUNT(*) FROM products WHERE COALESCE(status, 'active') <> 'archived'`)
+}
+
+// GetProductByTitle finds a product by its title, comparing the keys of the normalizer
+func (r *SQLProductRepository) GetProductByTitle(ctx context.Context, title string) (*models.Product, error) {
+	products, err := r.GetProductsByTitles(ctx, []string{r.titles.Normalize(title)})
+	if err != nil || len(products) == 0 {
+		return nil, err
+	}
+	return &products[0], nil
+}
+
+// CreateProduct inserts a new product into the database
+// If a duplicate handle exists, it will be skipped gracefully
+func (r *SQLProductRepository) CreateProduct(ctx context.Context, title, handle string) (int, error) {
+	result, err := r.db.ExecContext(ctx, r.dialect.insertIgnore()+` products (title, handle) VALUES (?, ?)`, title, handle)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create product: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		// Duplicate was skipped, return 0 to indicate no insertion
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get the product ID: %w", err)
+	}
+	return int(id), nil
+}
+
+// UpdateProduct updates an existing product
+func (r *SQLProductRepository) UpdateProduct(ctx context.Context, id int, title, handle string) error {
+	result, err := r.db.ExecContext(ctx, `UPDATE products SET title = ?, handle = ?, updated_at = CURRENT_TIMESTAMP, version = version + 1 WHERE id = ?`, title, handle, id)
+	if err != nil {
+		return fmt.Errorf("failed to update product: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n > 0 {
+		return nil
+	}
+
+	// MySQL counts the rows changed, not the rows matched
+	exists, err := r.count(ctx, `SELECT COUNT(*) FROM products WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if exists == 0 {
+		return fmt.Errorf("no product found with id %d", id)
+	}
+	return nil
+}
+
+// CreateProductsBatch creates multiple products in a single transaction.
+// Duplicates (based on handle) are automatically skipped without errors.
+func (r *SQLProductRepository) CreateProductsBatch(ctx context.Context, products []struct{ Title, Handle string }) error {
+	if len(products) == 0 {
+		return nil
+	}
+	_, err := r.execEach(ctx, r.dialect.insertIgnore()+` products (title, handle) VALUES (?, ?)`, len(products), func(i int) (string, []interface{}) {
+		return products[i].Title, []interface{}{products[i].Title, products[i].Handle}
+	})
+	return err
+}
+
+// UpdateProductsBatch updates the columns selected by the Fields of multiple
+// products in a single transaction and returns the IDs of the rows that
+// actually changed
+func (r *SQLProductRepository) UpdateProductsBatch(ctx context.Context, updates []struct {
+	ID      int
+	Title   string
+	Handle  string
+	Fields  ProductFields
+	Version int
+}) ([]int, error) {
+	if len(updates) == 0 {
+		return nil, nil
+	}
+	changed, err := r.execQueries(ctx, len(updates), func(i int) (string, string, []interface{}) {
+		query, args := r.updateProductSQL(updates[i])
+		return fmt.Sprint(updates[i].ID), query, args
+	})
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int, len(changed))
+	for i, n := range changed {
+		ids[i] = updates[n].ID
+	}
+	return ids, staleUpdates(ctx, updates, ids, r.productVersions)
+}
+
+// productVersions returns the current version of the products of ids
+func (r *SQLProductRepository) productVersions(ctx context.Context, ids []int) (map[int]int, error) {
+	versions := make(map[int]int, len(ids))
+	for _, chunk := range idChunks(ids) {
+		list, args := inList(chunk)
+		rows, err := r.db.QueryContext(ctx, `SELECT id, version FROM products WHERE id IN `+list, args...)
+		if err != nil {
+			return nil, err
+		}
+		chunkVersions, err := scanVersions(rows)
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+		for id, version := range chunkVersions {
+			versions[id] = version
+		}
+	}
+	return versions, nil
+}
+
+// SaveRawTitles stores the unsanitized title received from the external API
+// next to the products identified by ID (map of product ID to raw title)
+func (r *SQLProductRepository) SaveRawTitles(ctx context.Context, rawTitles map[int]string) error {
+	query := `UPDATE products SET raw_title = ? WHERE id = ? AND ` + r.dialect.distinct("raw_title", "?")
+	_, err := r.saveByID(ctx, query, rawTitles)
+	return err
+}
+
+// SaveCategories stores the categories of the products identified by ID (map
+// of product ID to category) and returns the IDs whose category changed
+func (r *SQLProductRepository) SaveCategories(ctx context.Context, categories map[int]string) ([]int, error) {
+	query := `UPDATE products SET category = NULLIF(?, ''), updated_at = CURRENT_TIMESTAMP, version = version + 1 WHERE id = ? AND COALESCE(category, '') <> ?`
+	return r.saveByID(ctx, query, categories)
+}
+
+// SavePrices stores the prices of the products identified by ID (map of
+// product ID to price) and returns the IDs whose price changed
+func (r *SQLProductRepository) SavePrices(ctx context.Context, prices map[int]models.ProductPrice) ([]int, error) {
+	query := `UPDATE products SET price = ?, currency = NULLIF(?, ''), updated_at = CURRENT_TIMESTAMP, version = version + 1
+		WHERE id = ? AND (` + r.dialect.distinct("price", "?") + ` OR COALESCE(currency, '') <> ?)`
+	if len(prices) == 0 {
+		return nil, nil
+	}
+	ids := make([]int, 0, len(prices))
+	for id := range prices {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	changed, err := r.execEach(ctx, query, len(ids), func(i int) (string, []interface{}) {
+		price := prices[ids[i]]
+		var amount interface{}
+		if price.Amount != nil {
+			amount = *price.Amount
+		}
+		return strconv.Itoa(ids[i]), []interface{}{amount, price.Currency, ids[i], amount, price.Currency}
+	})
+	if err != nil {
+		return nil, err
+	}
+	written := make([]int, len(changed))
+	for i, row := range changed {
+		written[i] = ids[row]
+	}
+	return written, nil
+}
+
+// saveByID runs query, whose arguments are the value, the product ID and the
+// value again, for every entry of values and returns the IDs of the rows it
+// changed
+func (r *SQLProductRepository) saveByID(ctx context.Context, query string, values map[int]string) ([]int, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	ids := make([]int, 0, len(values))
+	for id := range values {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	changed, err := r.execEach(ctx, query, len(ids), func(i int) (string, []interface{}) {
+		value := values[ids[i]]
+		return strconv.Itoa(ids[i]), []interface{}{value, ids[i], value}
+	})
+	if err != nil {
+		return nil, err
+	}
+	written := make([]int, len(changed))
+	for i, row := range changed {
+		written[i] = ids[row]
+	}
+	return written, nil
+}
+
+// updateProductSQL returns the statement updating the columns of u, skipping
+// rows already up to date, and its arguments
+func (r *SQLProductRepository) updateProductSQL(u productUpdate) (string, []interface{}) {
+	var sets, changed []string
+	var args []interface{}
+	fields := u.Fields.columns()
+	if fields&UpdateTitle != 0 {
+		sets, changed = append(sets, "title = ?"), append(changed, r.dialect.distinct("title", "?"))
+		args = append(args, u.Title)
+	}
+	if fields&UpdateHandle != 0 {
+		sets, changed = append(sets, "handle = ?"), append(changed, r.dialect.distinct("handle", "?"))
+		args = append(args, u.Handle)
+	}
+	sets = append(sets, "updated_at = CURRENT_TIMESTAMP", "version = version + 1")
+	// The SET values, the ID and version, then the same values again for the comparisons
+	where, values := "id = ?", args
+	args = append(append([]interface{}{}, values...), u.ID)
+	if u.Version > 0 {
+		where += " AND version = ?"
+		args = append(args, u.Version)
+	}
+	args = append(args, values...)
+	return "UPDATE products SET " + strings.Join(sets, ", ") + " WHERE " + where + " AND (" + strings.Join(changed, " OR ") + ")", args
+}
+
+// execEach runs the prepared query for the arguments of n rows in a single
+// transaction and returns the indexes of the rows that changed; row returns
+// the name of a row for errors and its arguments
+func (r *SQLProductRepository) execEach(ctx context.Context, query string, n int, row func(i int) (string, []interface{})) ([]int, error) {
+	return r.execQueries(ctx, n, func(i int) (string, string, []interface{}) {
+		name, args := row(i)
+		return name, query, args
+	})
+}
+
+// execQueries is execEach for rows that may each need a different query;
+// every distinct query is prepared once
+func (r *SQLProductRepository) execQueries(ctx context.Context, n int, row func(i int) (name, query string, args []interface{})) ([]int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmts := make(map[string]*sql.Stmt)
+	defer func() {
+		for _, stmt := range stmts {
+			stmt.Close()
+		}
+	}()
+
+	var changed []int
+	for i := 0; i < n; i++ {
+		name, query, args := row(i)
+		stmt := stmts[query]
+		if stmt == nil {
+			if stmt, err = tx.PrepareContext(ctx, query); err != nil {
+				return nil, fmt.Errorf("failed to prepare statement: %w", err)
+			}
+			stmts[query] = stmt
+		}
+		res, err := stmt.ExecContext(ctx, args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to write product %s: %w", name, err)
+		}
+		if affected, err := res.RowsAffected(); err == nil && affected > 0 {
+			changed = append(changed, i)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return changed, nil
+}
+
+// CheckIntegrity runs the integrity assertions of ProductRepository, counting
+// duplicate titles by the keys of the normalizer
+func (r *SQLProductRepository) CheckIntegrity(ctx context.Context) (*models.IntegrityReport, error) {
+	products, err := r.GetAllProducts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check integrity: %w", err)
+	}
+
+	report := &models.IntegrityReport{TotalProducts: len(products)}
+	keys := make(map[string]int)
+	for _, p := range products {
+		if p.Handle == "" {
+			report.EmptyHandles++
+		}
+		if p.Status != models.ProductStatusArchived {
+			keys[r.titles.Normalize(p.Title)]++
+		}
+	}
+	for _, n := range keys {
+		if n > 1 {
+			report.DuplicateTitles++
+		}
+	}
+	return report, nil
+}
+
+// ArchiveProductsBatch marks the products with the given IDs as archived and
+// returns the IDs of those archived. Every product is archived by its own
+// statement, the dialects having no RETURNING clause in common.
+func (r *SQLProductRepository) ArchiveProductsBatch(ctx context.Context, ids []int) ([]int, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	indexes, err := r.execEach(ctx, `UPDATE products SET status = ?, archived_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP, version = version + 1
+		WHERE id = ? AND COALESCE(status, 'active') <> ?`, len(ids), func(i int) (string, []interface{}) {
+		return strconv.Itoa(ids[i]), []interface{}{models.ProductStatusArchived, ids[i], models.ProductStatusArchived}
+	})
+	if err != nil {
+		return nil, err
+	}
+	archived := make([]int, len(indexes))
+	for i, index := range indexes {
+		archived[i] = ids[index]
+	}
+	return archived, nil
+}
+
+// ReactivateProductsBatch marks archived products with the given IDs as active
+// again and returns how many were reactivated
+func (r *SQLProductRepository) ReactivateProductsBatch(ctx context.Context, ids []int) (int, error) {
+	return r.byIDs(ctx, ids, `UPDATE products SET status = ?, archived_at = NULL, updated_at = CURRENT_TIMESTAMP, version = version + 1
+		WHERE COALESCE(status, 'active') <> ? AND id IN `, models.ProductStatusActive, models.ProductStatusActive)
+}
+
+// DeleteProducts removes the products with the given IDs and returns how many were deleted
+func (r *SQLProductRepository) DeleteProducts(ctx context.Context, ids []int) (int, error) {
+	return r.byIDs(ctx, ids, `DELETE FROM products WHERE id IN `)
+}
+
+// byIDs runs prefix, completed by an IN list, with args for chunks of ids and
+// returns the number of rows affected
+func (r *SQLProductRepository) byIDs(ctx context.Context, ids []int, prefix string, args ...interface{}) (int, error) {
+	total := 0
+	for _, chunk := range idChunks(ids) {
+		list, idArgs := inList(chunk)
+		result, err := r.db.ExecContext(ctx, prefix+list, append(append([]interface{}{}, args...), idArgs...)...)
+		if err != nil {
+			return total, fmt.Errorf("failed to write products: %w", err)
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return total, fmt.Errorf("failed to get rows affected: %w", err)
+		}
+		total += int(n)
+	}
+	return total, nil
+}
+
+// sortedKeys returns the keys of m in order, so batches write their rows in a stable order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,63 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"go-cron/models"
+	"time"
+)
+
+// ProfileRepository stores the sync profiles imported into the environment.
+// Every import is kept, so the history of promoted settings can be audited;
+// the latest one is active.
+type ProfileRepository struct {
+	db *sql.DB
+}
+
+// NewProfileRepository creates a new profile repository
+func NewProfileRepository(db *sql.DB) *ProfileRepository {
+	return &ProfileRepository{db: db}
+}
+
+// SaveProfile records an imported profile and makes it the active one
+func (r *ProfileRepository) SaveProfile(ctx context.Context, profile models.SyncProfile, importedAt time.Time) (*models.StoredSyncProfile, error) {
+	encoded, err := json.Marshal(profile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode sync profile: %w", err)
+	}
+
+	stored := &models.StoredSyncProfile{Profile: profile, ImportedAt: importedAt.UTC()}
+	err = r.db.QueryRowContext(ctx,
+		`INSERT INTO sync_profiles (version, profile, imported_at) VALUES ($1, $2, $3) RETURNING id`,
+		profile.Version, encoded, stored.ImportedAt).Scan(&stored.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save sync profile: %w", err)
+	}
+	return stored, nil
+}
+
+// undefinedTable is the Postgres SQLSTATE for a query on a missing table
+const undefinedTable = "42P01"
+
+// GetActiveProfile returns the latest imported profile, or nil when none was
+// imported, including in a database migrated before the sync_profiles table
+func (r *ProfileRepository) GetActiveProfile(ctx context.Context) (*models.StoredSyncProfile, error) {
+	var stored models.StoredSyncProfile
+	var encoded []byte
+	err := r.db.QueryRowContext(ctx,
+		`SELECT id, profile, imported_at FROM sync_profiles ORDER BY id DESC LIMIT 1`).
+		Scan(&stored.ID, &encoded, &stored.ImportedAt)
+	if err == sql.ErrNoRows || sqlState(err) == undefinedTable {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sync profile: %w", err)
+	}
+	if err := json.Unmarshal(encoded, &stored.Profile); err != nil {
+		return nil, fmt.Errorf("failed to decode sync profile %d: %w", stored.ID, err)
+	}
+	stored.ImportedAt = stored.ImportedAt.UTC()
+	return &stored, nil
+}
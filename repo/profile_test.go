@@ -0,0 +1,32 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+// Test_ProfileRepository_GetActiveProfile_UndefinedTable tests that a
+// database without the sync_profiles table has no profile, while other
+// errors are reported
+func Test_ProfileRepository_GetActiveProfile_UndefinedTable(t *testing.T) {
+	db, err := sql.Open("recording", "")
+	if err != nil {
+		t.Fatalf("failed to open the recording driver: %v", err)
+	}
+	defer db.Close()
+	defer func() { recorder.queryErr = nil }()
+	r := NewProfileRepository(db)
+
+	recorder.queryErr = &pq.Error{Code: undefinedTable}
+	if stored, err := r.GetActiveProfile(context.Background()); stored != nil || err != nil {
+		t.Errorf("Expected no profile without the table, got %v (%v)", stored, err)
+	}
+
+	recorder.queryErr = &pq.Error{Code: "42501"}
+	if _, err := r.GetActiveProfile(context.Background()); err == nil {
+		t.Error("Expected a denied query to fail")
+	}
+}
@@ -0,0 +1,63 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+// progressInterval is how many rows a batch loop writes between cancellation
+// checks and progress reports
+const progressInterval = 100
+
+// Write phases reported to a ProgressFunc
+const (
+	PhaseCreate    = "create"
+	PhaseUpdate    = "update"
+	PhaseRawTitles = "raw_titles"
+	PhaseCategory  = "category"
+	PhasePrice     = "price"
+)
+
+// ProgressFunc observes a write phase, receiving the rows written so far out
+// of its total. It is called from the goroutines writing the rows and must
+// not block.
+type ProgressFunc func(phase string, done, total int)
+
+// batchProgress counts the rows written by the loops of one batch, which may
+// run in parallel chunks
+type batchProgress struct {
+	phase  string
+	total  int
+	done   atomic.Int64
+	report ProgressFunc
+}
+
+// newBatchProgress starts counting a batch of total rows; report may be nil
+func newBatchProgress(phase string, total int, report ProgressFunc) *batchProgress {
+	return &batchProgress{phase: phase, total: total, report: report}
+}
+
+// row counts a written row. Every progressInterval rows, and after the last
+// one, it reports progress and fails once ctx is done so a canceled batch
+// stops between statements instead of running to the end.
+func (p *batchProgress) row(ctx context.Context) error {
+	return p.rows(ctx, 1)
+}
+
+// rows counts n rows written at once, e.g. by a COPY, reporting like row
+// when they cross a multiple of progressInterval or reach the total
+func (p *batchProgress) rows(ctx context.Context, n int) error {
+	done := int(p.done.Add(int64(n)))
+	if done/progressInterval == (done-n)/progressInterval && done != p.total {
+		return nil
+	}
+	if p.report != nil {
+		// Rows of a chunk retried after a deadlock are counted again
+		p.report(p.phase, min(done, p.total), p.total)
+	}
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s batch canceled after %d of %d rows: %w", p.phase, min(done, p.total), p.total, err)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// Test_batchProgress tests the progress reports and cancellation checks of a batch loop
+func Test_batchProgress(t *testing.T) {
+	var reports []int
+	progress := newBatchProgress(PhaseUpdate, 250, func(phase string, done, total int) {
+		if phase != PhaseUpdate || total != 250 {
+			t.Errorf("Unexpected report %s %d/%d", phase, done, total)
+		}
+		reports = append(reports, done)
+	})
+
+	ctx := context.Background()
+	for i := 0; i < 250; i++ {
+		if err := progress.row(ctx); err != nil {
+			t.Fatalf("Unexpected error at row %d: %v", i, err)
+		}
+	}
+	if len(reports) != 3 || reports[0] != 100 || reports[1] != 200 || reports[2] != 250 {
+		t.Errorf("Expected reports at 100, 200 and 250 rows, got %v", reports)
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	progress = newBatchProgress(PhaseCreate, 1000, nil)
+	var err error
+	rows := 0
+	for err == nil && rows < 1000 {
+		rows++
+		err = progress.row(canceled)
+	}
+	if !errors.Is(err, context.Canceled) || rows != progressInterval {
+		t.Errorf("Expected the batch to stop at the first check, stopped after %d rows with %v", rows, err)
+	}
+}
+
+// Test_batchProgress_Rows tests the reports of rows counted in bulk, e.g. by a COPY
+func Test_batchProgress_Rows(t *testing.T) {
+	var reports []int
+	progress := newBatchProgress(PhaseCreate, 450, func(phase string, done, total int) {
+		reports = append(reports, done)
+	})
+
+	ctx := context.Background()
+	for _, n := range []int{150, 30, 20, 250} {
+		if err := progress.rows(ctx, n); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if len(reports) != 3 || reports[0] != 150 || reports[1] != 200 || reports[2] != 450 {
+		t.Errorf("Expected reports at 150, 200 and 450 rows, got %v", reports)
+	}
+}
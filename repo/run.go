@@ -0,0 +1,171 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-cron/models"
+	"time"
+)
+
+// RunRepository handles database operations for sync run records
+type RunRepository struct {
+	db  *sql.DB
+	now func() time.Time
+}
+
+// NewRunRepository creates a new run repository
+func NewRunRepository(db *sql.DB) *RunRepository {
+	return &RunRepository{db: db, now: time.Now}
+}
+
+// SetClock replaces the time source of the cached last finished run
+func (r *RunRepository) SetClock(now func() time.Time) {
+	r.now = now
+}
+
+// StartRun inserts a sync run in the running state and sets its ID
+func (r *RunRepository) StartRun(ctx context.Context, run *models.SyncRun) (int, error) {
+	query := `
+		INSERT INTO sync_runs (entity, trigger, status, started_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id`
+
+	run.Status = models.SyncStatusRunning
+	err := r.db.QueryRowContext(ctx, query, run.Entity, run.Trigger, run.Status, run.StartedAt.UTC()).Scan(&run.ID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to start sync run: %w", err)
+	}
+
+	return run.ID, nil
+}
+
+// FinishRun stores the outcome of a started sync run
+func (r *RunRepository) FinishRun(ctx context.Context, run *models.SyncRun) error {
+	query := `
+		UPDATE sync_runs
+		SET status = $2, finished_at = $3, result = $4, error = $5
+		WHERE id = $1`
+
+	var result []byte
+	if run.Result != nil {
+		var err error
+		if result, err = json.Marshal(run.Result); err != nil {
+			return fmt.Errorf("failed to encode sync result: %w", err)
+		}
+	}
+
+	_, err := r.db.ExecContext(ctx, query, run.ID, run.Status, run.FinishedAt.UTC(), result, run.Error)
+	if err != nil {
+		return fmt.Errorf("failed to finish sync run: %w", err)
+	}
+
+	lastFinished.remember(run, r.now())
+	return nil
+}
+
+// runColumns are the sync_runs columns read by scanRun
+const runColumns = `id, entity, trigger, status, started_at, finished_at, result, COALESCE(error, '')`
+
+// GetLastRun returns the most recently started sync run, or nil if none exist
+func (r *RunRepository) GetLastRun(ctx context.Context) (*models.SyncRun, error) {
+	return r.getLatestRun(ctx, `SELECT `+runColumns+`
+		FROM sync_runs
+		ORDER BY started_at DESC
+		LIMIT 1`)
+}
+
+// GetLastSuccessfulRun returns the most recent run that finished with an OK status, or nil if none exist
+func (r *RunRepository) GetLastSuccessfulRun(ctx context.Context) (*models.SyncRun, error) {
+	return r.getLatestRun(ctx, `SELECT `+runColumns+`
+		FROM sync_runs
+		WHERE status = 'ok'
+		ORDER BY started_at DESC
+		LIMIT 1`)
+}
+
+// GetLastSuccessfulCatalogRun returns the most recent run over the whole
+// catalog that finished with an OK status, leaving out the runs of a single
+// shard, or nil if none exist
+func (r *RunRepository) GetLastSuccessfulCatalogRun(ctx context.Context) (*models.SyncRun, error) {
+	return r.getLatestRun(ctx, `SELECT `+runColumns+`
+		FROM sync_runs
+		WHERE status = 'ok'
+		  AND NOT EXISTS (SELECT 1 FROM sync_shards WHERE sync_shards.run_id = sync_runs.id)
+		ORDER BY started_at DESC
+		LIMIT 1`)
+}
+
+// ListRuns returns the most recent runs, newest first
+func (r *RunRepository) ListRuns(ctx context.Context, limit int) ([]models.SyncRun, error) {
+	query := `SELECT ` + runColumns + ` FROM sync_runs ORDER BY started_at DESC LIMIT $1`
+	return r.listRuns(ctx, query, limit)
+}
+
+// ListRunsSince returns the runs started at or after since, oldest first
+func (r *RunRepository) ListRunsSince(ctx context.Context, since time.Time) ([]models.SyncRun, error) {
+	query := `SELECT ` + runColumns + ` FROM sync_runs WHERE started_at >= $1 ORDER BY started_at`
+	return r.listRuns(ctx, query, since.UTC())
+}
+
+// listRuns scans every run returned by query
+func (r *RunRepository) listRuns(ctx context.Context, query string, args ...interface{}) ([]models.SyncRun, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sync runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []models.SyncRun
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, *run)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating sync runs: %w", err)
+	}
+
+	return runs, nil
+}
+
+// getLatestRun scans the single run returned by query
+func (r *RunRepository) getLatestRun(ctx context.Context, query string, args ...interface{}) (*models.SyncRun, error) {
+	run, err := scanRun(r.db.QueryRowContext(ctx, query, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil // No runs yet
+	}
+	return run, err
+}
+
+// scanRun reads the runColumns of a row into a run
+func scanRun(row interface {
+	Scan(dest ...interface{}) error
+}) (*models.SyncRun, error) {
+	var run models.SyncRun
+	var finishedAt sql.NullTime
+	var result []byte
+	err := row.Scan(&run.ID, &run.Entity, &run.Trigger, &run.Status, &run.StartedAt, &finishedAt, &result, &run.Error)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan sync run: %w", err)
+	}
+
+	run.StartedAt, run.FinishedAt = run.StartedAt.UTC(), finishedAt.Time.UTC()
+
+	if len(result) > 0 {
+		run.Result = &models.SyncResult{}
+		if err := json.Unmarshal(result, run.Result); err != nil {
+			return nil, fmt.Errorf("failed to decode sync result: %w", err)
+		}
+	}
+
+	return &run, nil
+}
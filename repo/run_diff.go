@@ -0,0 +1,51 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"go-cron/models"
+	"log"
+)
+
+// DetectRunAnomalies compares the result of a run over the whole catalog with
+// the previous successful one and records unusual deltas in result.Anomalies.
+// Shard runs are compared with the same shard instead (see LastShardResult).
+func DetectRunAnomalies(ctx context.Context, runs RunRepositoryInterface, result *models.SyncResult, thresholds models.AnomalyConfig) error {
+	previous, err := runs.GetLastSuccessfulCatalogRun(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch previous successful run: %w", err)
+	}
+	if previous == nil || previous.Result == nil {
+		return nil // Nothing to compare against yet
+	}
+
+	result.Anomalies = CompareRunResults(result, previous.Result, thresholds)
+	if len(result.Anomalies) > 0 {
+		log.Printf("Unusual deltas compared to run %d: %v", previous.ID, result.Anomalies)
+	}
+	return nil
+}
+
+// CompareRunResults flags counters that grew by more than the configured
+// factor and by at least the configured minimum delta
+func CompareRunResults(current, previous *models.SyncResult, thresholds models.AnomalyConfig) []string {
+	counters := []struct {
+		name              string
+		current, previous int
+	}{
+		{"creates", current.Created, previous.Created},
+		{"updates", current.Updated, previous.Updated},
+		{"errors", len(current.Errors), len(previous.Errors)},
+	}
+
+	var anomalies []string
+	for _, c := range counters {
+		if c.current-c.previous < thresholds.MinDelta {
+			continue
+		}
+		if float64(c.current) > float64(c.previous)*thresholds.Factor {
+			anomalies = append(anomalies, fmt.Sprintf("%d %s vs %d in the previous successful run", c.current, c.name, c.previous))
+		}
+	}
+	return anomalies
+}
@@ -0,0 +1,33 @@
+package repo
+
+import (
+	"go-cron/models"
+	"testing"
+)
+
+// Test_CompareRunResults tests flagging of unusual deltas between runs
+func Test_CompareRunResults(t *testing.T) {
+	thresholds := models.AnomalyConfig{Factor: 10, MinDelta: 50}
+	previous := &models.SyncResult{Created: 5, Updated: 20}
+
+	tests := []struct {
+		name     string
+		current  *models.SyncResult
+		expected int
+	}{
+		{"typical run", &models.SyncResult{Created: 6, Updated: 25}, 0},
+		{"creates spike", &models.SyncResult{Created: 500, Updated: 20}, 1},
+		{"large factor but small delta", &models.SyncResult{Created: 40, Updated: 20}, 0},
+		{"errors appear", &models.SyncResult{Errors: make([]string, 60)}, 1},
+		{"everything spikes", &models.SyncResult{Created: 500, Updated: 1000}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			anomalies := CompareRunResults(tt.current, previous, thresholds)
+			if len(anomalies) != tt.expected {
+				t.Errorf("Expected %d anomalies, got %d: %v", tt.expected, len(anomalies), anomalies)
+			}
+		})
+	}
+}
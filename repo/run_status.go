@@ -0,0 +1,74 @@
+package repo
+
+import (
+	"context"
+	"go-cron/models"
+	"sync"
+	"time"
+)
+
+// finishedRunCache keeps the last finished run of the instance, so the status
+// endpoint can answer without a query
+type finishedRunCache struct {
+	mu  sync.Mutex
+	run *models.SyncRun
+	// at is when the run was cached, by this instance finishing it or reading it
+	at time.Time
+}
+
+// lastFinished is shared by the run repositories of the instance
+var lastFinished finishedRunCache
+
+// remember caches run unless an older run is finished after it
+func (c *finishedRunCache) remember(run *models.SyncRun, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.run != nil && c.run.StartedAt.After(run.StartedAt) {
+		c.at = now
+		return
+	}
+	cached := *run
+	c.run, c.at = &cached, now
+}
+
+// get returns a copy of the cached run if it was cached within maxAge
+func (c *finishedRunCache) get(maxAge time.Duration, now time.Time) *models.SyncRun {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.run == nil || now.Sub(c.at) > maxAge {
+		return nil
+	}
+	cached := *c.run
+	return &cached
+}
+
+// GetLastFinishedRun returns the most recently started run that finished, or
+// nil if none did. A run finished or read by this instance within maxAge is
+// served from memory; runs finished by other instances since then are only
+// seen once it expires.
+func (r *RunRepository) GetLastFinishedRun(ctx context.Context, maxAge time.Duration) (*models.SyncRun, error) {
+	if run := lastFinished.get(maxAge, r.now()); run != nil {
+		return run, nil
+	}
+	run, err := r.getLatestRun(ctx, `SELECT `+runColumns+`
+		FROM sync_runs
+		WHERE status <> 'running'
+		ORDER BY started_at DESC
+		LIMIT 1`)
+	if err != nil || run == nil {
+		return nil, err
+	}
+	lastFinished.remember(run, r.now())
+	return run, nil
+}
+
+// GetRunningRun returns the most recent run still running that started at or
+// after since, or nil if none is. Runs of crashed instances stay running
+// forever, so since should exclude runs older than the longest sync.
+func (r *RunRepository) GetRunningRun(ctx context.Context, since time.Time) (*models.SyncRun, error) {
+	return r.getLatestRun(ctx, `SELECT `+runColumns+`
+		FROM sync_runs
+		WHERE status = 'running' AND started_at >= $1
+		ORDER BY started_at DESC
+		LIMIT 1`, since.UTC())
+}
@@ -0,0 +1,28 @@
+package repo
+
+import (
+	"go-cron/models"
+	"testing"
+	"time"
+)
+
+// Test_finishedRunCache tests that the cached run expires and is never
+// replaced by a run started before it
+func Test_finishedRunCache(t *testing.T) {
+	var cache finishedRunCache
+	now := time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC)
+	newer := &models.SyncRun{ID: 2, Status: models.SyncStatusOK, StartedAt: now.Add(-time.Minute)}
+	older := &models.SyncRun{ID: 1, Status: models.SyncStatusFailed, StartedAt: now.Add(-time.Hour)}
+
+	if cache.get(time.Minute, now) != nil {
+		t.Fatal("Expected an empty cache")
+	}
+	cache.remember(newer, now)
+	cache.remember(older, now)
+	if run := cache.get(time.Minute, now.Add(30*time.Second)); run == nil || run.ID != 2 {
+		t.Errorf("Expected the newer run to stay cached, got %+v", run)
+	}
+	if run := cache.get(time.Minute, now.Add(2*time.Minute)); run != nil {
+		t.Errorf("Expected the cached run to expire, got %+v", run)
+	}
+}
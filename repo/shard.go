@@ -0,0 +1,295 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-cron/models"
+	"hash/fnv"
+	"strings"
+	"time"
+)
+
+// ErrNoShardAvailable is returned when every shard of the open cycle is done or still running
+var ErrNoShardAvailable = errors.New("no shard available")
+
+// ShardRange returns the ItemCode range of shard out of shards, the codes from
+// from up to but excluding to, splitting models.ShardKeys into runs of first
+// characters. The first shard has no lower bound and the last no upper one,
+// so codes starting with other characters land in one of them too.
+func ShardRange(shard, shards int) (from, to string) {
+	keys := models.ShardKeys
+	if shard > 0 {
+		from = string(keys[shard*len(keys)/shards])
+	}
+	if shard < shards-1 {
+		to = string(keys[(shard+1)*len(keys)/shards])
+	}
+	return from, to
+}
+
+// ShardOf returns the shard of an item: the one whose ItemCode range holds its
+// code, in upper case, so that an item always lands in the same shard for a
+// given shard count. Items without an ItemCode are ranged by name.
+func ShardOf(item models.ExternalItem, shards int) int {
+	key := item.ItemCode
+	if key == "" {
+		key = item.ItemName
+	}
+	key = strings.ToUpper(key)
+	for shard := 0; shard < shards-1; shard++ {
+		if _, to := ShardRange(shard, shards); key < to {
+			return shard
+		}
+	}
+	return max(shards-1, 0)
+}
+
+// itemHash returns the hash of the ItemCode of item, or its name without
+// one, salted so that different uses of the hash pick unrelated items
+func itemHash(item models.ExternalItem, salt string) uint32 {
+	key := item.ItemCode
+	if key == "" {
+		key = item.ItemName
+	}
+	h := fnv.New32a()
+	h.Write([]byte(salt + key))
+	return h.Sum32()
+}
+
+// SampleItems returns the fraction of items picked by a hash of their
+// ItemCode, in order. The same items are picked by every run, and a larger
+// fraction includes those of a smaller one, so a staged rollout grows its
+// sample instead of reshuffling it. A fraction of 0 or 1 keeps every item.
+func SampleItems(items []models.ExternalItem, fraction float64) []models.ExternalItem {
+	if fraction <= 0 || fraction >= 1 {
+		return items
+	}
+	threshold := uint32(fraction * (1 << 32))
+	var sampled []models.ExternalItem
+	for _, item := range items {
+		if itemHash(item, "sample:") < threshold {
+			sampled = append(sampled, item)
+		}
+	}
+	return sampled
+}
+
+// FilterRange returns the items whose ItemCode lies in the range from up to
+// but excluding to, an empty bound leaving that side open. Codes are compared
+// as they are, like the Service Layer compares them for
+// external.WithItemCodeRange, so that items fetched by code land in the same
+// shard as the items of a fetch narrowed to the range.
+func FilterRange(items []models.ExternalItem, from, to string) []models.ExternalItem {
+	var filtered []models.ExternalItem
+	for _, item := range items {
+		if item.ItemCode >= from && (to == "" || item.ItemCode < to) {
+			filtered = append(filtered, item)
+		}
+	}
+	return filtered
+}
+
+// FilterShard returns the items that belong to shard out of shards
+func FilterShard(items []models.ExternalItem, shard, shards int) []models.ExternalItem {
+	var filtered []models.ExternalItem
+	for _, item := range items {
+		if ShardOf(item, shards) == shard {
+			filtered = append(filtered, item)
+		}
+	}
+	return filtered
+}
+
+// ShardRepository keeps track of which shards of a sharded sync have run. A
+// cycle covers every shard once; it completes when all of them succeeded.
+type ShardRepository struct {
+	db  *sql.DB
+	now func() time.Time
+}
+
+// NewShardRepository creates a new shard repository
+func NewShardRepository(db *sql.DB) *ShardRepository {
+	return &ShardRepository{db: db, now: time.Now}
+}
+
+// SetClock replaces the time source of claims and cycle timestamps
+func (r *ShardRepository) SetClock(now func() time.Time) {
+	r.now = now
+}
+
+// ClaimShard opens a cycle of shards if none is open and marks one of its
+// shards as running. A negative requested shard picks the lowest one that has
+// neither succeeded nor started within staleAfter; shards running for longer
+// are presumed dead and handed out again. Changing the shard count abandons
+// the open cycle.
+func (r *ShardRepository) ClaimShard(ctx context.Context, shards, requested int, staleAfter time.Duration) (*models.ShardAssignment, error) {
+	if requested >= shards {
+		return nil, fmt.Errorf("shard %d out of range for %d shards", requested, shards)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	a := &models.ShardAssignment{Shards: shards}
+	err = tx.QueryRowContext(ctx, `
+		SELECT id FROM sync_shard_cycles
+		WHERE completed_at IS NULL AND shards = $1
+		ORDER BY id DESC
+		LIMIT 1
+		FOR UPDATE`, shards).Scan(&a.CycleID)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO sync_shard_cycles (shards, started_at)
+			VALUES ($1, $2)
+			RETURNING id`, shards, r.now().UTC()).Scan(&a.CycleID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open shard cycle: %w", err)
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		SELECT s FROM generate_series(0, $2 - 1) AS s
+		WHERE ($4 < 0 OR s = $4)
+		  AND NOT EXISTS (
+			SELECT 1 FROM sync_shards
+			WHERE cycle_id = $1 AND shard = s
+			  AND (status IN ('ok', 'degraded') OR (status = 'running' AND started_at > $3)))
+		ORDER BY s
+		LIMIT 1`, a.CycleID, shards, r.now().UTC().Add(-staleAfter), requested).Scan(&a.Shard)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoShardAvailable
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to pick shard: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO sync_shards (cycle_id, shard, status, started_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (cycle_id, shard) DO UPDATE
+		SET status = EXCLUDED.status, started_at = EXCLUDED.started_at, finished_at = NULL, run_id = NULL, result = NULL`,
+		a.CycleID, a.Shard, models.SyncStatusRunning, r.now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim shard %d: %w", a.Shard, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return a, nil
+}
+
+// FinishShard records the outcome of a claimed shard. Once every shard of the
+// cycle succeeded, the cycle is completed with the combined report of all of
+// them, which is returned in the progress.
+func (r *ShardRepository) FinishShard(ctx context.Context, a models.ShardAssignment, runID int, status string, result *models.SyncResult) (*models.ShardProgress, error) {
+	var encoded []byte
+	if result != nil {
+		var err error
+		if encoded, err = json.Marshal(result); err != nil {
+			return nil, fmt.Errorf("failed to encode shard result: %w", err)
+		}
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Serialize finishing shards so exactly one of them completes the cycle
+	var completed sql.NullTime
+	err = tx.QueryRowContext(ctx, `SELECT completed_at FROM sync_shard_cycles WHERE id = $1 FOR UPDATE`, a.CycleID).Scan(&completed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock shard cycle %d: %w", a.CycleID, err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE sync_shards
+		SET status = $3, run_id = NULLIF($4, 0), finished_at = $5, result = $6
+		WHERE cycle_id = $1 AND shard = $2`,
+		a.CycleID, a.Shard, status, runID, r.now().UTC(), encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to finish shard %d: %w", a.Shard, err)
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT result FROM sync_shards
+		WHERE cycle_id = $1 AND status IN ('ok', 'degraded')
+		ORDER BY shard`, a.CycleID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query shards: %w", err)
+	}
+	defer rows.Close()
+
+	progress := &models.ShardProgress{ShardAssignment: a}
+	report := &models.SyncResult{Status: models.SyncStatusOK}
+	for rows.Next() {
+		var raw []byte
+		if err := rows.Scan(&raw); err != nil {
+			return nil, fmt.Errorf("failed to scan shard: %w", err)
+		}
+		progress.Done++
+		if len(raw) == 0 {
+			continue
+		}
+		var shardResult models.SyncResult
+		if err := json.Unmarshal(raw, &shardResult); err != nil {
+			return nil, fmt.Errorf("failed to decode shard result: %w", err)
+		}
+		report.Add(&shardResult)
+		report.Status = models.WorseStatus(report.Status, shardResult.Status)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating shards: %w", err)
+	}
+
+	if progress.Done >= a.Shards && !completed.Valid {
+		encodedReport, err := json.Marshal(report)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode cycle report: %w", err)
+		}
+		_, err = tx.ExecContext(ctx, `
+			UPDATE sync_shard_cycles SET completed_at = $2, report = $3 WHERE id = $1`,
+			a.CycleID, r.now().UTC(), encodedReport)
+		if err != nil {
+			return nil, fmt.Errorf("failed to complete shard cycle %d: %w", a.CycleID, err)
+		}
+		progress.Complete, progress.Report = true, report
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return progress, nil
+}
+
+// LastShardResult returns the result of the last successful run of the same
+// shard of an earlier cycle with as many shards, or nil before the first one
+func (r *ShardRepository) LastShardResult(ctx context.Context, a models.ShardAssignment) (*models.SyncResult, error) {
+	var raw []byte
+	err := r.db.QueryRowContext(ctx, `
+		SELECT s.result FROM sync_shards s
+		JOIN sync_shard_cycles c ON c.id = s.cycle_id
+		WHERE c.shards = $1 AND s.shard = $2 AND s.cycle_id <> $3
+		  AND s.status IN ('ok', 'degraded') AND s.result IS NOT NULL
+		ORDER BY s.finished_at DESC
+		LIMIT 1`, a.Shards, a.Shard, a.CycleID).Scan(&raw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query shard %d: %w", a.Shard, err)
+	}
+	var result models.SyncResult
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode shard result: %w", err)
+	}
+	return &result, nil
+}
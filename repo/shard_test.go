@@ -0,0 +1,111 @@
+package repo
+
+import (
+	"fmt"
+	"go-cron/models"
+	"reflect"
+	"testing"
+)
+
+// Test_FilterShard tests that shards are deterministic and partition the items
+func Test_FilterShard(t *testing.T) {
+	var items []models.ExternalItem
+	for i := 0; i < 1000; i++ {
+		key := models.ShardKeys[i%len(models.ShardKeys)]
+		items = append(items, models.ExternalItem{ItemCode: fmt.Sprintf("%c%05d", key, i), ItemName: fmt.Sprintf("Item %d", i)})
+	}
+
+	const shards = 4
+	seen := make(map[string]int)
+	for shard := 0; shard < shards; shard++ {
+		filtered := FilterShard(items, shard, shards)
+		if len(filtered) == 0 {
+			t.Errorf("shard %d is empty", shard)
+		}
+		for _, item := range filtered {
+			if prev, ok := seen[item.ItemCode]; ok {
+				t.Fatalf("item %s in shards %d and %d", item.ItemCode, prev, shard)
+			}
+			seen[item.ItemCode] = shard
+		}
+	}
+	if len(seen) != len(items) {
+		t.Errorf("shards cover %d items, want %d", len(seen), len(items))
+	}
+
+	// Renaming an item must not move it to another shard
+	renamed := models.ExternalItem{ItemCode: items[42].ItemCode, ItemName: "Renamed"}
+	if got := ShardOf(renamed, shards); got != seen[renamed.ItemCode] {
+		t.Errorf("renamed item moved from shard %d to %d", seen[renamed.ItemCode], got)
+	}
+	if got := ShardOf(items[0], 1); got != 0 {
+		t.Errorf("single shard: got %d, want 0", got)
+	}
+}
+
+// Test_ShardRange tests that the ItemCode ranges of the shards follow each
+// other and hold the items of their shard
+func Test_ShardRange(t *testing.T) {
+	const shards = 5
+	previous := ""
+	for shard := 0; shard < shards; shard++ {
+		from, to := ShardRange(shard, shards)
+		if from != previous {
+			t.Errorf("shard %d starts at %q, want %q", shard, from, previous)
+		}
+		if (to == "") != (shard == shards-1) {
+			t.Errorf("shard %d ends at %q", shard, to)
+		}
+		previous = to
+	}
+	for code, want := range map[string]int{"-1": 0, "0001": 0, "A100": 1, "a100": 1, "Z9": 4, "~x": 4} {
+		if got := ShardOf(models.ExternalItem{ItemCode: code}, shards); got != want {
+			t.Errorf("ShardOf(%q) = %d, want %d", code, got, want)
+		}
+	}
+}
+
+// Test_FilterRange tests that items are ranged by their code as it is, like
+// the Service Layer ranges a fetch
+func Test_FilterRange(t *testing.T) {
+	items := []models.ExternalItem{{ItemCode: "0001"}, {ItemCode: "A100"}, {ItemCode: "a100"}, {ItemCode: "I1"}}
+	var got []string
+	for _, item := range FilterRange(items, "A", "I") {
+		got = append(got, item.ItemCode)
+	}
+	if !reflect.DeepEqual(got, []string{"A100"}) {
+		t.Errorf("Expected only A100 in [A, I), got %v", got)
+	}
+	if last := FilterRange(items, "I", ""); len(last) != 2 || last[1].ItemCode != "I1" {
+		t.Errorf("Expected a100 and I1 past I, got %+v", last)
+	}
+}
+
+// Test_SampleItems tests that samples are stable, roughly sized and grow
+// with the fraction
+func Test_SampleItems(t *testing.T) {
+	var items []models.ExternalItem
+	for i := 0; i < 1000; i++ {
+		items = append(items, models.ExternalItem{ItemCode: fmt.Sprintf("A%05d", i)})
+	}
+
+	small, large := SampleItems(items, 0.1), SampleItems(items, 0.5)
+	if len(small) < 50 || len(small) > 150 {
+		t.Errorf("Expected about 100 items in a 10%% sample, got %d", len(small))
+	}
+	if again := SampleItems(items, 0.1); len(again) != len(small) || again[0].ItemCode != small[0].ItemCode {
+		t.Error("Expected every run to pick the same sample")
+	}
+	inLarge := make(map[string]bool, len(large))
+	for _, item := range large {
+		inLarge[item.ItemCode] = true
+	}
+	for _, item := range small {
+		if !inLarge[item.ItemCode] {
+			t.Fatalf("Expected the 50%% sample to include %s of the 10%% sample", item.ItemCode)
+		}
+	}
+	if got := SampleItems(items, 1); len(got) != len(items) {
+		t.Errorf("Expected a full sample to keep every item, got %d", len(got))
+	}
+}
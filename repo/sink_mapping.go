@@ -0,0 +1,59 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"go-cron/models"
+)
+
+// SinkMappingRepository handles database operations for product ↔ sink ID mappings
+type SinkMappingRepository struct {
+	db *sql.DB
+}
+
+// NewSinkMappingRepository creates a new sink mapping repository
+func NewSinkMappingRepository(db *sql.DB) *SinkMappingRepository {
+	return &SinkMappingRepository{db: db}
+}
+
+// GetSinkMapping finds the external ID of a product in the given sink
+func (r *SinkMappingRepository) GetSinkMapping(ctx context.Context, sink string, productID int) (*models.SinkMapping, error) {
+	query := `SELECT product_id, sink, external_id FROM sink_mappings WHERE sink = $1 AND product_id = $2`
+
+	var m models.SinkMapping
+	err := r.db.QueryRowContext(ctx, query, sink, productID).Scan(&m.ProductID, &m.Sink, &m.ExternalID)
+	if err == sql.ErrNoRows {
+		return nil, nil // Not found
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sink mapping: %w", err)
+	}
+
+	return &m, nil
+}
+
+// SaveSinkMapping inserts or replaces the external ID of a product in the given sink
+func (r *SinkMappingRepository) SaveSinkMapping(ctx context.Context, m models.SinkMapping) error {
+	query := `
+		INSERT INTO sink_mappings (product_id, sink, external_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (product_id, sink) DO UPDATE SET external_id = EXCLUDED.external_id`
+
+	if _, err := r.db.ExecContext(ctx, query, m.ProductID, m.Sink, m.ExternalID); err != nil {
+		return fmt.Errorf("failed to save sink mapping: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteSinkMapping removes the mapping of a product in the given sink
+func (r *SinkMappingRepository) DeleteSinkMapping(ctx context.Context, sink string, productID int) error {
+	query := `DELETE FROM sink_mappings WHERE sink = $1 AND product_id = $2`
+
+	if _, err := r.db.ExecContext(ctx, query, sink, productID); err != nil {
+		return fmt.Errorf("failed to delete sink mapping: %w", err)
+	}
+
+	return nil
+}
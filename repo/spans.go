@@ -0,0 +1,12 @@
+package repo
+
+import (
+	"context"
+
+	"go-cron/tracing"
+)
+
+// startSpan starts the span of a database operation over rows rows or items
+func startSpan(ctx context.Context, op string, rows int) (context.Context, *tracing.Span) {
+	return tracing.Start(ctx, "db."+op, tracing.String("db.system", "postgresql"), tracing.Int("db.rows", rows))
+}
@@ -2,73 +2,309 @@ package repo
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"go-cron/internal/recovery"
 	"go-cron/models"
+	"go-cron/tracing"
 	"log"
 	"strings"
 	"sync"
+	"time"
 )
 
 // SyncService handles synchronization between external API and database
 type SyncService struct {
-	repo ProductRepositoryInterface
+	repo          ProductRepositoryInterface
+	dryRun        bool
+	outbox        OutboxRepositoryInterface
+	sinks         []string
+	options       SyncOptions
+	audit         AuditRepositoryInterface
+	runID         int
+	differ        *Differ
+	titles        *Normalizer
+	duplicates    string
+	categories    map[int]string
+	priceList     int
+	media         MediaRepositoryInterface
+	images        models.ImagesConfig
+	imageFetcher  ImageFetcher
+	skipIntegrity bool
+	items         *ItemFilter
+	approvals     PlanRepositoryInterface
 }
 
 // NewSyncService creates a new sync service
 func NewSyncService(repo ProductRepositoryInterface) *SyncService {
-	return &SyncService{repo: repo}
+	return &SyncService{repo: repo, differ: NewDiffer(), titles: defaultNormalizer, duplicates: models.DuplicatesReport, options: DefaultSyncOptions()}
+}
+
+// SetDuplicates sets what the sync does with products sharing a title key or
+// a handle, one of the models.Duplicates policies. Every policy reports them.
+func (s *SyncService) SetDuplicates(policy string) {
+	s.duplicates = policy
+}
+
+// SetNormalizer matches items and products by the title keys of n; the
+// product repository must use the same normalizer
+func (s *SyncService) SetNormalizer(n *Normalizer) {
+	s.titles = n
+}
+
+// SetCategories stores on every product the category its item group maps to,
+// comparing categories like the other synced fields. An empty mapping leaves
+// categories alone.
+func (s *SyncService) SetCategories(categories map[int]string) {
+	if len(categories) == 0 {
+		return
+	}
+	if s.categories == nil {
+		s.differ.track(categoryField)
+	}
+	s.categories = categories
+}
+
+// SetPriceList stores on every product its price in price list list,
+// comparing prices like the other synced fields. Zero leaves prices alone.
+func (s *SyncService) SetPriceList(list int) {
+	if list <= 0 {
+		return
+	}
+	if s.priceList == 0 {
+		s.differ.track(priceField)
+	}
+	s.priceList = list
+}
+
+// SetImages stores on every product the URL of its picture, comparing URLs
+// like the other synced fields, and downloads new pictures with fetcher into
+// media. A nil fetcher stores the URLs only; disabled images are left alone.
+func (s *SyncService) SetImages(media MediaRepositoryInterface, fetcher ImageFetcher, images models.ImagesConfig) {
+	if !images.Enabled || media == nil {
+		return
+	}
+	if s.media == nil {
+		s.differ.track(imageField)
+	}
+	s.media, s.imageFetcher, s.images = media, fetcher, images
+}
+
+// SetIntegrityCheck toggles the integrity assertions run after the writes of
+// CompareAndSync. Callers running several syncs at once disable them and call
+// VerifyIntegrity once all are done, since the product count assertion only
+// holds for the writes of a single sync.
+func (s *SyncService) SetIntegrityCheck(enabled bool) {
+	s.skipIntegrity = !enabled
+}
+
+// SetDryRun toggles dry-run mode, in which changes are computed but not written
+func (s *SyncService) SetDryRun(dryRun bool) {
+	s.dryRun = dryRun
+}
+
+// SetLookupBatchSize makes the service look up only the products whose title
+// appears in the external items, querying at most n titles at a time.
+// Zero loads the whole catalog instead.
+func (s *SyncService) SetLookupBatchSize(n int) {
+	s.options.LookupBatchSize = n
+}
+
+// SetItemFilter syncs only the items allowed by f, counting the others as
+// skipped. The products of skipped items are neither updated nor archived.
+func (s *SyncService) SetItemFilter(f *ItemFilter) {
+	s.items = f
+}
+
+// SetApprovals holds the changes tripping the change guard in plans for
+// approval instead of dropping them
+func (s *SyncService) SetApprovals(plans PlanRepositoryInterface) {
+	s.approvals = plans
 }
 
 // CompareAndSync compares external items with database products and performs sync
-func (s *SyncService) CompareAndSync(ctx context.Context, externalItems []map[string]interface{}) (*models.SyncResult, error) {
-	result := &models.SyncResult{}
+func (s *SyncService) CompareAndSync(ctx context.Context, externalItems []models.ExternalItem) (*models.SyncResult, error) {
+	ctx, span := tracing.Start(ctx, "sync.compare_and_sync", tracing.Int("sync.items", len(externalItems)), tracing.Bool("sync.dry_run", s.dryRun))
+	defer span.End()
 
-	// Fetch all products from database
-	dbProducts, err := s.repo.GetAllProducts(ctx)
+	result, err := s.compareAndSync(ctx, externalItems)
+	if result != nil {
+		span.SetAttributes(tracing.String("sync.status", result.Status), tracing.Int("sync.created", result.Created),
+			tracing.Int("sync.updated", result.Updated), tracing.Int("sync.unchanged", result.Unchanged))
+	}
+	span.RecordError(err)
+	return result, err
+}
+
+// compareAndSync runs CompareAndSync within its span, timing the plan as the
+// diff and its application as the writes
+func (s *SyncService) compareAndSync(ctx context.Context, externalItems []models.ExternalItem) (*models.SyncResult, error) {
+	start := time.Now()
+	plan, err := s.Plan(ctx, externalItems)
 	if err != nil {
+		return nil, err
+	}
+	planned := time.Now()
+	result, err := s.Apply(ctx, plan)
+	if result != nil {
+		result.AddTimings(planned.Sub(start), time.Since(planned))
+	}
+	return result, err
+}
+
+// Plan compares external items with database products and returns the
+// writes that would bring the products in line, without writing anything.
+// A plan whose Result failed or timed out is applied as a no-op.
+func (s *SyncService) Plan(ctx context.Context, externalItems []models.ExternalItem) (*SyncPlan, error) {
+	result := &models.SyncResult{Status: models.SyncStatusOK}
+	if s.items != nil {
+		externalItems, result.Skipped = s.items.Filter(externalItems)
+	}
+	names := newNormalizeCache(s.normalizer(), len(externalItems))
+	defer names.report(result)
+
+	// Fetch the relevant products from database
+	dbProducts, productsBefore, err := s.loadProducts(ctx, externalItems, names)
+	if err != nil {
+		if ctx.Err() != nil {
+			return &SyncPlan{Result: timedOut(result, fmt.Errorf("failed to fetch database products: %w", err))}, nil
+		}
 		return nil, fmt.Errorf("failed to fetch database products: %w", err)
 	}
 
 	// Create a map of existing products by normalized title for O(1) lookup
 	dbProductMap := make(map[string]*models.Product)
+	titleKeys := make([]string, len(dbProducts))
 	for i := range dbProducts {
-		normalizedTitle := normalizeTitle(dbProducts[i].Title)
+		normalizedTitle := names.title(dbProducts[i].Title)
 		dbProductMap[normalizedTitle] = &dbProducts[i]
+		titleKeys[i] = normalizedTitle
 	}
+	// Duplicated titles are matched with a single product rather than the last one loaded
+	duplicates := s.checkDuplicates(dbProducts, titleKeys, dbProductMap, result)
 
-	// Separate items into creates and updates
+	// Separate items into creates and updates, remembering the previous values for the audit log
+	previous := make(map[int]*models.Product)
 	var itemsToCreate []struct{ Title, Handle string }
 	var itemsToUpdate []struct {
-		ID     int
-		Title  string
-		Handle string
+		ID      int
+		Title   string
+		Handle  string
+		Fields  ProductFields
+		Version int
 	}
+	// Archived products that reappeared in the feed, with their current values
+	var itemsToReactivate []*models.Product
+	// Categories to store, by handle, for the products whose category is new or changed
+	categories := make(map[string]string)
+	// Prices to store, by handle, for the products whose price is new or changed
+	prices := make(map[string]models.ProductPrice)
+	// Picture URLs to store, by handle, for the products whose picture is new or changed
+	imageURLs := make(map[string]string)
+	// Unsanitized titles, by handle, when the fetcher kept them
+	rawTitles := make(map[string]string)
+	// IDs of the matched products, by handle
+	ids := make(map[string]int)
+	// Handles of the products whose item was found, to be marked as synced
+	var synced []string
 
 	// Process external items
 	for _, item := range externalItems {
-		itemName, ok := item["ItemName"].(string)
-		if !ok || itemName == "" {
+		itemName := item.ItemName
+		if itemName == "" {
 			result.Errors = append(result.Errors, "Invalid or missing ItemName in external item")
 			continue
 		}
 
 		// Generate handle from ItemName (lowercase, replace spaces with hyphens)
-		handle := generateHandle(itemName)
-		normalizedTitle := normalizeTitle(itemName)
+		handle := names.handle(itemName)
+		normalizedTitle := names.title(itemName)
+
+		// Compare the matching product, if any, field by field
+		existingProduct := dbProductMap[normalizedTitle]
+		if s.options.SkipSynced && existingProduct != nil && !existingProduct.Archived() && syncedSince(existingProduct, item) {
+			result.Unchanged++
+			continue
+		}
+		// A handle suffixed by the handle repair is kept, its base being taken
+		if existingProduct != nil && existingProduct.Handle != "" &&
+			(!s.options.UpdateHandles || conformingHandle(existingProduct.Handle, handle)) {
+			handle = existingProduct.Handle
+		}
+		// Locked products keep the title and handle they were given by hand
+		locked := false
+		if existingProduct != nil && existingProduct.Locked && existingProduct.Handle != "" {
+			locked = handle != existingProduct.Handle
+			handle = existingProduct.Handle
+		}
+		desired := models.Product{Title: itemName, Handle: handle, Status: models.ProductStatusActive}
+		synced = append(synced, handle)
+		if item.RawItemName != "" {
+			rawTitles[handle] = item.RawItemName
+		}
+		if existingProduct != nil {
+			ids[handle] = existingProduct.ID
+		}
+		if s.categories != nil {
+			desired.Category = itemCategory(s.categories, item)
+		}
+		if s.priceList > 0 {
+			if price := item.PriceIn(s.priceList); price != nil {
+				desired.Price, desired.Currency = price.Price, price.Currency
+			}
+		}
+		if s.media != nil {
+			desired.Image = s.images.URL(item.Picture)
+		}
+		diff := s.differ.DiffItem(item, existingProduct, desired)
+		if existingProduct != nil && existingProduct.Locked {
+			if dropTitleChange(&diff) {
+				locked = true
+			}
+			if diff.Action == models.ChangeActionUpdate && !s.differ.NeedsUpdate(diff.Fields) {
+				diff.Action = models.ItemActionUnchanged
+			}
+		}
+		if locked {
+			result.Locked = append(result.Locked, handle)
+		}
+		if s.dryRun && diff.Action != models.ItemActionUnchanged {
+			reportDiff(result, diff)
+		}
+		for _, change := range diff.Fields {
+			switch change.Field {
+			case models.FieldCategory:
+				categories[handle] = desired.Category
+			case models.FieldPrice:
+				prices[handle] = models.ProductPrice{Amount: desired.Price, Currency: desired.Currency}
+			case models.FieldImage:
+				imageURLs[handle] = desired.Image
+			}
+		}
 
-		// Check if product exists in database
-		if existingProduct, exists := dbProductMap[normalizedTitle]; exists {
-			// Check if update is needed (title or handle changed)
-			if existingProduct.Title != itemName || existingProduct.Handle != handle {
+		if existingProduct != nil {
+			if existingProduct.Archived() {
+				itemsToReactivate = append(itemsToReactivate, existingProduct)
+			}
+			if s.differ.NeedsUpdate(diff.Fields) {
 				itemsToUpdate = append(itemsToUpdate, struct {
-					ID     int
-					Title  string
-					Handle string
+					ID      int
+					Title   string
+					Handle  string
+					Fields  ProductFields
+					Version int
 				}{
-					ID:     existingProduct.ID,
-					Title:  itemName,
-					Handle: handle,
+					ID:      existingProduct.ID,
+					Title:   itemName,
+					Handle:  handle,
+					Fields:  changedColumns(diff.Fields),
+					Version: existingProduct.Version,
 				})
+				previous[existingProduct.ID] = existingProduct
+			} else if existingProduct.Archived() {
+				// Counted once reactivated
+			} else if locked {
+				result.Skipped++
 			} else {
 				result.Unchanged++
 			}
@@ -81,35 +317,156 @@ func (s *SyncService) CompareAndSync(ctx context.Context, externalItems []map[st
 		}
 	}
 
+	// Too many rejected items point at a broken feed rather than a few bad items
+	if s.options.MaxErrors > 0 && len(result.Errors) > s.options.MaxErrors {
+		return nil, fmt.Errorf("aborting sync: %d items were rejected, more than the %d allowed", len(result.Errors), s.options.MaxErrors)
+	}
+
+	plan := &SyncPlan{
+		Creates:       itemsToCreate,
+		Updates:       itemsToUpdate,
+		Reactivations: itemsToReactivate,
+		Archives:      duplicates,
+		Categories:    categories,
+		Prices:        prices,
+		Images:        imageURLs,
+		RawTitles:     rawTitles,
+		IDs:           ids,
+		Synced:        synced,
+		Previous:      previous,
+		CatalogSize:   productsBefore,
+		Result:        result,
+	}
+
+	// Changes out of proportion with the catalog point at a broken feed or
+	// filter; they are held for approval or dropped
+	if guard := s.guardChanges(len(itemsToCreate), len(duplicates), len(itemsToUpdate), productsBefore); guard != nil {
+		result.Guard = guard
+		if !guard.Confirmed && !s.dryRun {
+			s.holdForApproval(ctx, plan)
+			result.Status = models.SyncStatusFailed
+			result.Errors = append(result.Errors, guard.String())
+		}
+	}
+	return plan, nil
+}
+
+// Apply carries out the writes of plan and completes its Result. In dry-run
+// mode the plan is reported without writing anything.
+func (s *SyncService) Apply(ctx context.Context, plan *SyncPlan) (*models.SyncResult, error) {
+	result := plan.Result
+	if result.Status == models.SyncStatusFailed || result.Status == models.SyncStatusTimedOut {
+		return result, nil
+	}
+
+	// In dry-run mode, report the planned changes without writing anything
+	if s.dryRun {
+		result.DryRun = true
+		result.Created = len(plan.Creates)
+		result.Updated = len(plan.Updates)
+		result.Reactivated = len(plan.Reactivations)
+		for _, p := range plan.Creates {
+			result.Handles.Created = append(result.Handles.Created, p.Handle)
+		}
+		for _, u := range plan.Updates {
+			result.Handles.Updated = append(result.Handles.Updated, u.Handle)
+		}
+		for _, p := range plan.Reactivations {
+			result.Handles.Reactivated = append(result.Handles.Reactivated, p.Handle)
+		}
+		return result, nil
+	}
+
+	// Don't start writes the deadline can no longer accommodate
+	if ctx.Err() != nil {
+		return timedOut(result, ctx.Err()), nil
+	}
+
+	if len(plan.Archives) > 0 {
+		s.mergeDuplicates(ctx, plan.Archives, result)
+	}
+	if len(plan.Missing) > 0 {
+		s.archiveMissing(ctx, plan.Missing, result)
+	}
+
 	// Execute batch operations with concurrency
 	var wg sync.WaitGroup
-	errChan := make(chan error, 2)
+	// Each operation reports at most its error and a panic
+	errChan := make(chan error, 6)
 
-	// Create new products in batch
-	if len(itemsToCreate) > 0 {
+	// Create new products in batch, keeping the ones whose chunk committed
+	var created []struct{ Title, Handle string }
+	if len(plan.Creates) > 0 {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			// if err := s.repo.CreateProductsBatch(ctx, itemsToCreate); err != nil {
-			// 	errChan <- fmt.Errorf("batch create failed: %w", err)
-			// } else {
-				result.Created = len(itemsToCreate)
-				log.Printf("Created %d new products", len(itemsToCreate))
-			// }
+			defer recoverInto(errChan, "create")
+			err := s.repo.CreateProductsBatch(ctx, plan.Creates)
+			var batchErr *CreateBatchError
+			switch {
+			case err == nil:
+				created = plan.Creates
+			case errors.As(err, &batchErr):
+				failed := batchErr.FailedHandles()
+				for _, p := range plan.Creates {
+					if !failed[p.Handle] {
+						created = append(created, p)
+					}
+				}
+				errChan <- fmt.Errorf("batch create failed: %w", err)
+			default:
+				errChan <- fmt.Errorf("batch create failed: %w", err)
+			}
+			result.Created = len(created)
+			log.Printf("Created %d of %d new products", len(created), len(plan.Creates))
 		}()
 	}
 
-	// Update existing products in batch
-	if len(itemsToUpdate) > 0 {
+	// Update existing products in batch, keeping track of the rows that actually changed
+	updatedIDs := make(map[int]bool, len(plan.Updates))
+	if len(plan.Updates) > 0 {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			// if err := s.repo.UpdateProductsBatch(ctx, itemsToUpdate); err != nil {
-			// 	errChan <- fmt.Errorf("batch update failed: %w", err)
-			// } else {
-			// 	result.Updated = len(itemsToUpdate)
-				log.Printf("Updated %d products", len(itemsToUpdate))
-			// }
+			defer recoverInto(errChan, "update")
+			// Chunks that committed stay applied even when another chunk fails
+			changed, err := s.writeColumns(ctx, plan.Updates)
+			// Products edited elsewhere since they were read keep their edits
+			var conflict *UpdateConflictError
+			if errors.As(err, &conflict) {
+				result.Conflicts = conflictHandles(conflict.IDs, plan.Updates)
+				log.Printf("Skipped %d products edited during the sync", len(conflict.IDs))
+				err = nil
+			}
+			if err != nil {
+				errChan <- fmt.Errorf("batch update failed: %w", err)
+			}
+			for _, id := range changed {
+				updatedIDs[id] = true
+			}
+			result.Updated = len(changed)
+			result.UpdatesAttempted = len(plan.Updates)
+			log.Printf("Updated %d of %d products", len(changed), len(plan.Updates))
+		}()
+	}
+
+	// Bring back archived products that reappeared
+	if len(plan.Reactivations) > 0 {
+		ids := make([]int, len(plan.Reactivations))
+		for i, p := range plan.Reactivations {
+			ids[i] = p.ID
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer recoverInto(errChan, "reactivate")
+			reactivated, err := s.repo.ReactivateProductsBatch(ctx, ids)
+			if err != nil {
+				errChan <- fmt.Errorf("batch reactivate failed: %w", err)
+				return
+			}
+			result.Reactivated = reactivated
+			log.Printf("Reactivated %d archived products", reactivated)
 		}()
 	}
 
@@ -124,9 +481,381 @@ func (s *SyncService) CompareAndSync(ctx context.Context, externalItems []map[st
 		}
 	}
 
+	// Batches that committed before the deadline stay applied; report them as a partial result
+	expired := ctx.Err() != nil
+	if expired {
+		timedOut(result, ctx.Err())
+
+		// Still queue what was applied so sinks don't miss committed changes
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+		defer cancel()
+	}
+
+	// Store the categories, prices and pictures once the products exist under
+	// their new handles; an item whose category, price or picture alone changed
+	// counts as updated
+	if len(plan.Categories) > 0 {
+		ids, err := s.productIDs(ctx, plan, created, sortedKeys(plan.Categories))
+		var changedCategories []int
+		if err == nil {
+			changedCategories, err = s.repo.SaveCategories(ctx, byID(plan.Categories, ids))
+		}
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("failed to save categories: %v", err))
+		}
+		countUpdated(handlesOfIDs(changedCategories, ids), plan.Updates, updatedIDs, result)
+	}
+	if len(plan.Prices) > 0 {
+		ids, err := s.productIDs(ctx, plan, created, sortedKeys(plan.Prices))
+		var changedPrices []int
+		if err == nil {
+			changedPrices, err = s.repo.SavePrices(ctx, byID(plan.Prices, ids))
+		}
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("failed to save prices: %v", err))
+		}
+		countUpdated(handlesOfIDs(changedPrices, ids), plan.Updates, updatedIDs, result)
+	}
+	if len(plan.Images) > 0 {
+		ids, err := s.productIDs(ctx, plan, created, sortedKeys(plan.Images))
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("failed to save picture URLs: %v", err))
+		} else {
+			countUpdated(s.syncImages(ctx, plan.Images, ids, result), plan.Updates, updatedIDs, result)
+		}
+	}
+
+	// List the changed products behind the counters
+	for _, p := range created {
+		result.Handles.Created = append(result.Handles.Created, p.Handle)
+	}
+	for _, u := range plan.Updates {
+		if updatedIDs[u.ID] {
+			result.Handles.Updated = append(result.Handles.Updated, u.Handle)
+		}
+	}
+	if result.Reactivated > 0 {
+		for _, p := range plan.Reactivations {
+			result.Handles.Reactivated = append(result.Handles.Reactivated, p.Handle)
+		}
+	}
+
+	// Queue applied changes for downstream sinks
+	if s.outbox != nil && len(s.sinks) > 0 {
+		var changes []models.Change
+		for _, p := range created {
+			changes = append(changes, models.Change{Action: models.ChangeActionCreate, Title: p.Title, Handle: p.Handle})
+		}
+		for _, u := range plan.Updates {
+			if updatedIDs[u.ID] {
+				change := models.Change{Action: models.ChangeActionUpdate, ProductID: u.ID, Title: u.Title, Handle: u.Handle}
+				if old := plan.Previous[u.ID]; old != nil && old.Handle != u.Handle {
+					change.OldHandle = old.Handle
+				}
+				changes = append(changes, change)
+			}
+		}
+		if result.Reactivated > 0 {
+			for _, p := range plan.Reactivations {
+				changes = append(changes, models.Change{Action: models.ChangeActionReactivate, ProductID: p.ID, Title: p.Title, Handle: p.Handle})
+			}
+		}
+		if err := s.outbox.EnqueueChanges(ctx, changes, s.sinks); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("failed to enqueue changes: %v", err))
+		} else {
+			result.Changes = append(result.Changes, changeIDs(changes)...)
+		}
+	}
+
+	// Keep the unsanitized titles next to the stored ones when the fetcher kept them
+	rawTitleIDs, err := s.productIDs(ctx, plan, created, sortedKeys(plan.RawTitles))
+	if err == nil {
+		err = s.repo.SaveRawTitles(ctx, byID(plan.RawTitles, rawTitleIDs))
+	}
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("failed to save raw titles: %v", err))
+	}
+
+	// Remember which products the feed still had, for the next incremental syncs
+	if marker, ok := s.repo.(SyncMarker); ok {
+		if err := marker.MarkSynced(ctx, plan.Synced); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("failed to mark products synced: %v", err))
+		}
+	}
+
+	// Record every applied change in the audit log
+	if s.audit != nil {
+		var changes []models.ProductChange
+		for _, p := range created {
+			changes = append(changes, models.ProductChange{RunID: s.runID, Action: models.ChangeActionCreate, NewTitle: p.Title, NewHandle: p.Handle})
+		}
+		for _, u := range plan.Updates {
+			if updatedIDs[u.ID] {
+				old := plan.Previous[u.ID]
+				changes = append(changes, models.ProductChange{RunID: s.runID, ProductID: u.ID, Action: models.ChangeActionUpdate,
+					OldTitle: old.Title, OldHandle: old.Handle, NewTitle: u.Title, NewHandle: u.Handle})
+			}
+		}
+		if result.Reactivated > 0 {
+			for _, p := range plan.Reactivations {
+				changes = append(changes, models.ProductChange{RunID: s.runID, ProductID: p.ID, Action: models.ChangeActionReactivate,
+					OldTitle: p.Title, OldHandle: p.Handle, NewTitle: p.Title, NewHandle: p.Handle})
+			}
+		}
+		if err := s.audit.RecordChanges(ctx, changes); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("failed to record audit log: %v", err))
+		}
+	}
+
+	// Read back what was written to catch rows the database skipped or rewrote
+	if !expired && s.options.VerifyWrites {
+		var written []models.Product
+		for _, p := range created {
+			written = append(written, models.Product{Title: p.Title, Handle: p.Handle, Status: models.ProductStatusActive, Category: plan.Categories[p.Handle],
+				Price: plan.Prices[p.Handle].Amount, Currency: plan.Prices[p.Handle].Currency})
+		}
+		for _, u := range plan.Updates {
+			if updatedIDs[u.ID] {
+				written = append(written, models.Product{ID: u.ID, Title: u.Title, Handle: u.Handle, Status: models.ProductStatusActive, Category: plan.Categories[u.Handle],
+					Price: plan.Prices[u.Handle].Amount, Currency: plan.Prices[u.Handle].Currency})
+			}
+		}
+		if result.Reactivated > 0 {
+			for _, p := range plan.Reactivations {
+				if !updatedIDs[p.ID] {
+					written = append(written, models.Product{ID: p.ID, Title: p.Title, Handle: p.Handle, Status: models.ProductStatusActive})
+				}
+			}
+		}
+		names := newNormalizeCache(s.normalizer(), len(written))
+		s.verifyWrites(ctx, written, names, result)
+		names.report(result)
+	}
+
+	// Run cheap post-apply assertions as a safety net for bugs in the diff logic
+	if !expired && !s.skipIntegrity {
+		s.VerifyIntegrity(ctx, plan.CatalogSize, result)
+	}
+
 	return result, nil
 }
 
+// changedColumns returns the columns of UpdateProductsBatch among changes
+func changedColumns(changes []models.FieldChange) ProductFields {
+	var fields ProductFields
+	for _, c := range changes {
+		switch c.Field {
+		case models.FieldTitle:
+			fields |= UpdateTitle
+		case models.FieldHandle:
+			fields |= UpdateHandle
+		}
+	}
+	return fields
+}
+
+// dropTitleChange removes the change of the title from diff and reports
+// whether it had one
+func dropTitleChange(diff *models.ItemDiff) bool {
+	for i, c := range diff.Fields {
+		if c.Field == models.FieldTitle {
+			diff.Fields = append(diff.Fields[:i:i], diff.Fields[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// writeColumns writes the changed titles and handles of updates, leaving out
+// the updates of other fields only, and returns the IDs of the rows that changed
+func (s *SyncService) writeColumns(ctx context.Context, updates []productUpdate) ([]int, error) {
+	writes := make([]productUpdate, 0, len(updates))
+	for _, u := range updates {
+		// Zero would write every column
+		if u.Fields != 0 {
+			writes = append(writes, u)
+		}
+	}
+	if len(writes) == 0 {
+		return nil, nil
+	}
+	return s.repo.UpdateProductsBatch(ctx, writes)
+}
+
+// conflictHandles returns the handles of the updates of ids
+func conflictHandles(ids []int, updates []productUpdate) []string {
+	conflicted := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		conflicted[id] = true
+	}
+	var handles []string
+	for _, u := range updates {
+		if conflicted[u.ID] {
+			handles = append(handles, u.Handle)
+		}
+	}
+	return handles
+}
+
+// countUpdated counts the planned updates whose handle is among the changed
+// ones as updated, unless their row was already updated
+func countUpdated(changed []string, itemsToUpdate []struct {
+	ID      int
+	Title   string
+	Handle  string
+	Fields  ProductFields
+	Version int
+}, updatedIDs map[int]bool, result *models.SyncResult) {
+	handles := make(map[string]bool, len(changed))
+	for _, handle := range changed {
+		handles[handle] = true
+	}
+	for _, u := range itemsToUpdate {
+		if handles[u.Handle] && !updatedIDs[u.ID] {
+			updatedIDs[u.ID] = true
+			result.Updated++
+		}
+	}
+}
+
+// timedOut marks a result as cut short by the context deadline
+func timedOut(result *models.SyncResult, err error) *models.SyncResult {
+	result.Status = models.SyncStatusTimedOut
+	result.Errors = append(result.Errors, fmt.Sprintf("sync timed out: %v", err))
+	log.Printf("Sync timed out: %v", err)
+	return result
+}
+
+// recoverInto reports the panic of a write goroutine on errs instead of
+// crashing the function; defer it in the goroutine
+func recoverInto(errs chan<- error, op string) {
+	if err := recovery.Error(recover()); err != nil {
+		errs <- fmt.Errorf("batch %s failed: %w", op, err)
+	}
+}
+
+// loadProducts returns the database products to compare against and the total
+// number of products in the database before the sync
+func (s *SyncService) loadProducts(ctx context.Context, externalItems []models.ExternalItem, names *normalizeCache) ([]models.Product, int, error) {
+	if s.options.LookupBatchSize <= 0 {
+		products, err := s.repo.GetAllProducts(ctx)
+		return products, len(products), err
+	}
+
+	total, err := s.repo.CountProducts(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Collect the distinct normalized titles of the batch
+	seen := make(map[string]bool, len(externalItems))
+	titles := make([]string, 0, len(externalItems))
+	for _, item := range externalItems {
+		if title := names.title(item.ItemName); title != "" && !seen[title] {
+			seen[title] = true
+			titles = append(titles, title)
+		}
+	}
+
+	var products []models.Product
+	for start := 0; start < len(titles); start += s.options.LookupBatchSize {
+		end := start + s.options.LookupBatchSize
+		if end > len(titles) {
+			end = len(titles)
+		}
+		chunk, err := s.repo.GetProductsByTitles(ctx, titles[start:end])
+		if err != nil {
+			return nil, 0, err
+		}
+		products = append(products, chunk...)
+	}
+
+	return products, total, nil
+}
+
+// VerifyIntegrity checks the database state after apply and marks the result
+// as degraded with details if any assertion fails. productsBefore is the
+// number of products before the writes of the result.
+func (s *SyncService) VerifyIntegrity(ctx context.Context, productsBefore int, result *models.SyncResult) {
+	report, err := s.repo.CheckIntegrity(ctx)
+	if err != nil {
+		result.Status = models.SyncStatusDegraded
+		result.IntegrityIssues = append(result.IntegrityIssues, fmt.Sprintf("integrity check failed: %v", err))
+		return
+	}
+	if report == nil {
+		return
+	}
+
+	if report.EmptyHandles > 0 {
+		result.IntegrityIssues = append(result.IntegrityIssues,
+			fmt.Sprintf("%d products have a NULL or empty handle", report.EmptyHandles))
+	}
+	if report.DuplicateTitles > 0 {
+		result.IntegrityIssues = append(result.IntegrityIssues,
+			fmt.Sprintf("%d titles are duplicated among active products", report.DuplicateTitles))
+	}
+	if expected := productsBefore + result.Created; report.TotalProducts != expected {
+		result.IntegrityIssues = append(result.IntegrityIssues,
+			fmt.Sprintf("expected %d products after sync, found %d", expected, report.TotalProducts))
+	}
+
+	if len(result.IntegrityIssues) > 0 {
+		result.Status = models.SyncStatusDegraded
+		log.Printf("Integrity assertions failed: %v", result.IntegrityIssues)
+	}
+}
+
+// SetOutbox enables queueing of applied changes in the outbox for the given sinks
+func (s *SyncService) SetOutbox(outbox OutboxRepositoryInterface, sinks []string) {
+	s.outbox = outbox
+	s.sinks = sinks
+}
+
+// SetAudit enables recording of every applied change in the audit log,
+// attributed to runID. A zero runID, of a run that could not be recorded,
+// leaves it disabled rather than logging changes no run owns.
+func (s *SyncService) SetAudit(audit AuditRepositoryInterface, runID int) {
+	if runID == 0 {
+		s.audit, s.runID = nil, 0
+		return
+	}
+	s.audit = audit
+	s.runID = runID
+}
+
+// FindStale returns active database products whose title no longer appears in the external items
+func (s *SyncService) FindStale(ctx context.Context, externalItems []models.ExternalItem) ([]models.Product, error) {
+	stale, _, err := s.findStale(ctx, externalItems)
+	return stale, err
+}
+
+// findStale returns the stale products and the number of database products
+func (s *SyncService) findStale(ctx context.Context, externalItems []models.ExternalItem) ([]models.Product, int, error) {
+	dbProducts, err := s.repo.GetAllProducts(ctx)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch database products: %w", err)
+	}
+
+	titles := s.normalizer()
+	externalTitles := make(map[string]bool, len(externalItems))
+	for _, item := range externalItems {
+		if item.ItemName != "" {
+			externalTitles[titles.Normalize(item.ItemName)] = true
+		}
+	}
+
+	var stale []models.Product
+	for _, p := range dbProducts {
+		if !p.Archived() && !externalTitles[titles.Normalize(p.Title)] {
+			stale = append(stale, p)
+		}
+	}
+
+	return stale, len(dbProducts), nil
+}
+
 // generateHandle creates a URL-friendly handle from a title
 func generateHandle(title string) string {
 	handle := strings.ToLower(title)
@@ -142,7 +871,79 @@ func generateHandle(title string) string {
 	return builder.String()
 }
 
-// normalizeTitle normalizes a title for comparison
+// normalizeTitle normalizes a title for comparison with the default rules
 func normalizeTitle(title string) string {
-	return strings.ToLower(strings.TrimSpace(title))
+	return defaultNormalizer.Normalize(title)
+}
+
+// productIDs returns the IDs of the products of plan with the handles: those of the matched products, and those of the created
+// ones, looked up by title. Values are written by ID rather than handle, as a
+// product created with the handle of a product of another item, which keeps
+// it, must not overwrite that product's values; a created product is thus
+// only taken for the one of its handle when it also has its title.
+func (s *SyncService) productIDs(ctx context.Context, plan *SyncPlan, created []struct{ Title, Handle string }, handles []string) (map[string]int, error) {
+	ids := make(map[string]int, len(handles))
+	wanted := make(map[string]bool, len(handles))
+	for _, handle := range handles {
+		wanted[handle] = true
+		if id, ok := plan.IDs[handle]; ok {
+			ids[handle] = id
+		}
+	}
+
+	createdTitles := make(map[string]string)
+	var titles []string
+	for _, p := range created {
+		if wanted[p.Handle] {
+			createdTitles[p.Handle] = p.Title
+			titles = append(titles, s.normalizer().Normalize(p.Title))
+		}
+	}
+	if len(titles) == 0 {
+		return ids, nil
+	}
+	products, err := s.repo.GetProductsByTitles(ctx, titles)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up the created products: %w", err)
+	}
+	for _, p := range products {
+		if title, ok := createdTitles[p.Handle]; ok && p.Title == title {
+			ids[p.Handle] = p.ID
+		}
+	}
+	return ids, nil
+}
+
+// byID returns values, keyed by handle, keyed by the product IDs of ids,
+// leaving out the handles without one
+func byID[V any](values map[string]V, ids map[string]int) map[int]V {
+	keyed := make(map[int]V, len(values))
+	for handle, value := range values {
+		if id, ok := ids[handle]; ok {
+			keyed[id] = value
+		}
+	}
+	return keyed
+}
+
+// handlesOfIDs returns the handles of the product IDs changed, from ids
+func handlesOfIDs(changed []int, ids map[string]int) []string {
+	handles := make(map[int]string, len(ids))
+	for handle, id := range ids {
+		handles[id] = handle
+	}
+	list := make([]string, 0, len(changed))
+	for _, id := range changed {
+		list = append(list, handles[id])
+	}
+	return list
+}
+
+// changeIDs returns the outbox IDs of the queued changes
+func changeIDs(changes []models.Change) []int64 {
+	ids := make([]int64, len(changes))
+	for i, c := range changes {
+		ids[i] = c.ID
+	}
+	return ids
 }
@@ -20,9 +20,11 @@ func ExampleSyncService() {
 			return nil
 		},
 		UpdateProductsBatchFunc: func(ctx context.Context, updates []struct {
-			ID     int
-			Title  string
-			Handle string
+			ID      int
+			Title   string
+			Handle  string
+			Fields  ProductFields
+			Version int
 		}) error {
 			return nil
 		},
@@ -136,9 +138,11 @@ func Test_SyncService_ConcurrencyStressTest(t *testing.T) {
 			return nil
 		},
 		UpdateProductsBatchFunc: func(ctx context.Context, updates []struct {
-			ID     int
-			Title  string
-			Handle string
+			ID      int
+			Title   string
+			Handle  string
+			Fields  ProductFields
+			Version int
 		}) error {
 			updateCalled = true
 			// Simulate some work
@@ -149,10 +153,10 @@ func Test_SyncService_ConcurrencyStressTest(t *testing.T) {
 	syncService := NewSyncService(mockRepo)
 
 	// Create items that will trigger both create and update operations
-	externalItems := []map[string]interface{}{
-		{"ItemName": "Existing Product", "ItemCode": "E001"}, // Will update
-		{"ItemName": "New Product 1", "ItemCode": "N001"},    // Will create
-		{"ItemName": "New Product 2", "ItemCode": "N002"},    // Will create
+	externalItems := []models.ExternalItem{
+		{ItemName: "Existing Product", ItemCode: "E001"}, // Will update
+		{ItemName: "New Product 1", ItemCode: "N001"},    // Will create
+		{ItemName: "New Product 2", ItemCode: "N002"},    // Will create
 	}
 
 	result, err := syncService.CompareAndSync(ctx, externalItems)
@@ -190,9 +194,11 @@ func Benchmark_CompareAndSync(b *testing.B) {
 			return nil
 		},
 		UpdateProductsBatchFunc: func(ctx context.Context, updates []struct {
-			ID     int
-			Title  string
-			Handle string
+			ID      int
+			Title   string
+			Handle  string
+			Fields  ProductFields
+			Version int
 		}) error {
 			return nil
 		},
@@ -0,0 +1,68 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"go-cron/models"
+)
+
+// SyncItem syncs a single external item and reports the product it produced
+// along with the fields that changed. Only the product with the item's title
+// is looked up, whatever the lookup batch size.
+func (s *SyncService) SyncItem(ctx context.Context, item models.ExternalItem) (*models.ItemSyncResult, error) {
+	single := *s
+	single.options.LookupBatchSize = 1
+
+	before, err := single.findItemProduct(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+	result, err := single.CompareAndSync(ctx, []models.ExternalItem{item})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.ItemSyncResult{ItemCode: item.ItemCode, Action: models.ItemActionUnchanged, Result: result}
+	after := before
+	if !s.dryRun {
+		if after, err = single.findItemProduct(ctx, item); err != nil {
+			return nil, err
+		}
+	}
+	report.Product = after
+
+	// A dry run reports the planned diff, a real one the fields it wrote
+	if s.dryRun {
+		if len(result.Diffs) > 0 {
+			report.Action, report.Fields = result.Diffs[0].Action, result.Diffs[0].Fields
+		}
+		return report, nil
+	}
+	if after == nil {
+		return report, nil
+	}
+	switch {
+	case result.Created > 0:
+		report.Action = models.ChangeActionCreate
+		report.Fields = single.differ.Diff(nil, *after)
+	case result.Reactivated > 0:
+		report.Action = models.ChangeActionReactivate
+		report.Fields = single.differ.Diff(before, *after)
+	case result.Updated > 0:
+		report.Action = models.ChangeActionUpdate
+		report.Fields = single.differ.Diff(before, *after)
+	}
+	return report, nil
+}
+
+// findItemProduct returns the product matching the item's title, if any
+func (s *SyncService) findItemProduct(ctx context.Context, item models.ExternalItem) (*models.Product, error) {
+	products, err := s.repo.GetProductsByTitles(ctx, []string{s.normalizer().Normalize(item.ItemName)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up product: %w", err)
+	}
+	if len(products) == 0 {
+		return nil, nil
+	}
+	return &products[0], nil
+}
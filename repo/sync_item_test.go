@@ -0,0 +1,45 @@
+package repo
+
+import (
+	"context"
+	"testing"
+
+	"go-cron/models"
+)
+
+// Test_SyncService_SyncItem tests that a single-item sync reports the changed fields
+func Test_SyncService_SyncItem(t *testing.T) {
+	lookups := 0
+	mockRepo := &MockProductRepository{
+		GetProductsByTitlesFunc: func(ctx context.Context, titles []string) ([]models.Product, error) {
+			if len(titles) != 1 || titles[0] != "blue shirt" {
+				t.Errorf("Expected a lookup of the item title only, got %v", titles)
+			}
+			lookups++
+			// Before the sync and during the diff, then once more to read back the result
+			if lookups <= 2 {
+				return []models.Product{{ID: 3, Title: "Blue shirt", Handle: "blue-shirt-old"}}, nil
+			}
+			return []models.Product{{ID: 3, Title: "Blue Shirt", Handle: "blue-shirt"}}, nil
+		},
+		GetAllProductsFunc: func(ctx context.Context) ([]models.Product, error) {
+			t.Error("A single-item sync must not load the whole catalog")
+			return nil, nil
+		},
+	}
+
+	result, err := NewSyncService(mockRepo).SyncItem(context.Background(), models.ExternalItem{ItemCode: "S1", ItemName: "Blue Shirt"})
+	if err != nil {
+		t.Fatalf("SyncItem failed: %v", err)
+	}
+
+	if result.Action != models.ChangeActionUpdate || result.ItemCode != "S1" {
+		t.Errorf("Expected an update of S1, got %s of %s", result.Action, result.ItemCode)
+	}
+	if result.Product == nil || result.Product.Handle != "blue-shirt" {
+		t.Errorf("Expected the updated product, got %+v", result.Product)
+	}
+	if len(result.Fields) != 2 || result.Fields[0].Field != "title" || result.Fields[1].Old != "blue-shirt-old" {
+		t.Errorf("Expected title and handle changes, got %+v", result.Fields)
+	}
+}
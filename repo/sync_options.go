@@ -0,0 +1,259 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"go-cron/models"
+	"log"
+)
+
+// SyncOptions tunes how a SyncService matches items with products and what it
+// writes. Start from DefaultSyncOptions: the zero value keeps existing handles.
+type SyncOptions struct {
+	// CaseSensitive matches titles differing in case with different products by
+	// dropping the lowercasing rules of the normalizer. The product repository
+	// must use the same normalizer (see Normalizer.CaseSensitive).
+	CaseSensitive bool
+	// UpdateHandles regenerates the handle of matched products from their
+	// title; otherwise products keep the handle they were created with
+	UpdateHandles bool
+	// DeleteMissing makes ArchiveMissing archive the active products missing
+	// from the feed
+	DeleteMissing bool
+	// DeleteAfterRuns makes ArchiveMissing delete the products instead, once
+	// they were missing from this many consecutive feeds
+	DeleteAfterRuns int
+	// MaxErrors aborts CompareAndSync before any write once more items than
+	// this were rejected; zero never aborts
+	MaxErrors int
+	// MaxChangeRatio aborts the writes of a sync whose creates and archives
+	// exceed this fraction of the catalog; zero disables the guard
+	MaxChangeRatio float64
+	// MaxUpdateRatio aborts the writes of a sync whose updates exceed this
+	// fraction of the catalog; zero disables it
+	MaxUpdateRatio float64
+	// Confirmed applies the changes even when they trip the guard
+	Confirmed bool
+	// VerifyWrites reads back the written products after the writes and
+	// reports the ones not stored with the intended values
+	VerifyWrites bool
+	// VerifySample is the number of written products read back; zero reads
+	// back all of them
+	VerifySample int
+	// LookupBatchSize is the number of titles looked up per query; zero loads
+	// the whole catalog (see SetLookupBatchSize)
+	LookupBatchSize int
+	// SkipSynced skips, as unchanged, the items whose product was last synced
+	// after the item's UpdateDate; incremental syncs set it
+	SkipSynced bool
+}
+
+// DefaultSyncOptions returns the options of NewSyncService
+func DefaultSyncOptions() SyncOptions {
+	return SyncOptions{UpdateHandles: true}
+}
+
+// NewSyncServiceWithOptions creates a new sync service tuned by opts
+func NewSyncServiceWithOptions(repo ProductRepositoryInterface, opts SyncOptions) *SyncService {
+	s := NewSyncService(repo)
+	s.options = opts
+	return s
+}
+
+// Options returns the options of the service
+func (s *SyncService) Options() SyncOptions {
+	return s.options
+}
+
+// SetOptions replaces the options of the service
+func (s *SyncService) SetOptions(opts SyncOptions) {
+	s.options = opts
+}
+
+// CompareAndSyncWith runs CompareAndSync with opts instead of the options of
+// the service, leaving them untouched
+func (s *SyncService) CompareAndSyncWith(ctx context.Context, externalItems []models.ExternalItem, opts SyncOptions) (*models.SyncResult, error) {
+	single := *s
+	single.options = opts
+	return single.CompareAndSync(ctx, externalItems)
+}
+
+// normalizer returns the normalizer items and products are matched by
+func (s *SyncService) normalizer() *Normalizer {
+	if s.options.CaseSensitive {
+		return s.titles.CaseSensitive()
+	}
+	return s.titles
+}
+
+// guardChanges returns the trip of the change guard when creates and archives,
+// or updates, exceed the allowed fraction of the catalog, or nil. An empty
+// catalog is a first import and never trips it.
+func (s *SyncService) guardChanges(creates, archives, updates, catalog int) *models.ChangeGuard {
+	if catalog == 0 {
+		return nil
+	}
+	changed := s.options.MaxChangeRatio > 0 && float64(creates+archives) > s.options.MaxChangeRatio*float64(catalog)
+	updated := s.options.MaxUpdateRatio > 0 && float64(updates) > s.options.MaxUpdateRatio*float64(catalog)
+	if !changed && !updated {
+		return nil
+	}
+	guard := &models.ChangeGuard{Creates: creates, Archives: archives, Updates: updates, Catalog: catalog,
+		MaxRatio: s.options.MaxChangeRatio, MaxUpdateRatio: s.options.MaxUpdateRatio, Confirmed: s.options.Confirmed}
+	log.Printf("%s (confirmed: %v)", guard, guard.Confirmed)
+	return guard
+}
+
+// ArchiveMissing archives the active products whose title is missing from
+// the feed when the DeleteMissing option is set, counting them in
+// result.Archived, or deletes them once missing from DeleteAfterRuns
+// consecutive feeds when that option is set too. feed must hold every item of
+// the catalog: products of the items left out of it are archived too. Dry
+// runs count without archiving.
+func (s *SyncService) ArchiveMissing(ctx context.Context, feed []models.ExternalItem, result *models.SyncResult) {
+	if !s.options.DeleteMissing {
+		return
+	}
+	// An empty feed is an outage rather than an empty catalog
+	if len(feed) == 0 {
+		return
+	}
+	stale, catalog, err := s.findStale(ctx, feed)
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("failed to find missing products: %v", err))
+		return
+	}
+	if s.options.DeleteAfterRuns > 0 {
+		s.deleteMissing(ctx, stale, catalog, result)
+		return
+	}
+	if len(stale) == 0 {
+		return
+	}
+	missing := make([]*models.Product, len(stale))
+	for i := range stale {
+		missing[i] = &stale[i]
+	}
+	if guard := s.guardChanges(result.Created, len(stale), 0, catalog); guard != nil {
+		result.Guard = guard
+		if !guard.Confirmed && !s.dryRun {
+			// The sync itself was applied; only the archives are held back
+			s.holdForApproval(ctx, &SyncPlan{Missing: missing, CatalogSize: catalog,
+				Result: &models.SyncResult{Status: models.SyncStatusOK, Guard: guard}})
+			result.Status = models.WorseStatus(result.Status, models.SyncStatusDegraded)
+			result.Errors = append(result.Errors, guard.String())
+			return
+		}
+	}
+	if s.dryRun {
+		result.Archived += len(stale)
+		for _, p := range stale {
+			result.Handles.Archived = append(result.Handles.Archived, p.Handle)
+		}
+		return
+	}
+	s.archiveMissing(ctx, missing, result)
+}
+
+// archiveMissing archives the products missing from the feed, counting them
+// in result.Archived
+func (s *SyncService) archiveMissing(ctx context.Context, missing []*models.Product, result *models.SyncResult) {
+	archived, err := s.archive(ctx, missing, result)
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("failed to archive missing products: %v", err))
+		return
+	}
+	result.Archived += len(archived)
+	for _, p := range archived {
+		result.Handles.Archived = append(result.Handles.Archived, p.Handle)
+	}
+	log.Printf("Archived %d products missing from the feed", len(archived))
+}
+
+// deleteMissing counts one more run missing the stale products and deletes
+// those missing from DeleteAfterRuns consecutive runs, counting and recording
+// only the products the database actually deleted in result.Deleted. The
+// others wait for the next runs, which clear the count of the products back
+// in their feed.
+func (s *SyncService) deleteMissing(ctx context.Context, stale []models.Product, catalog int, result *models.SyncResult) {
+	tracker, ok := s.repo.(MissingTracker)
+	if !ok {
+		result.Errors = append(result.Errors, "the repository cannot track missing products; none were deleted")
+		return
+	}
+	ids := make([]int, len(stale))
+	for i, p := range stale {
+		ids[i] = p.ID
+	}
+	if !s.dryRun {
+		if err := tracker.TrackMissing(ctx, ids); err != nil {
+			result.Errors = append(result.Errors, err.Error())
+			return
+		}
+	}
+	if len(stale) == 0 {
+		return
+	}
+	runs, err := tracker.MissingRuns(ctx, ids)
+	if err != nil {
+		result.Errors = append(result.Errors, err.Error())
+		return
+	}
+
+	var due []*models.Product
+	var dueIDs []int
+	for i, p := range stale {
+		missed := runs[p.ID]
+		if s.dryRun {
+			// The run a dry run stands for would count one more miss
+			missed++
+		}
+		if missed >= s.options.DeleteAfterRuns {
+			due = append(due, &stale[i])
+			dueIDs = append(dueIDs, p.ID)
+		}
+	}
+	if waiting := len(stale) - len(due); waiting > 0 {
+		log.Printf("Keeping %d products missing from the feed until they miss %d runs", waiting, s.options.DeleteAfterRuns)
+	}
+	if len(due) == 0 {
+		return
+	}
+
+	if guard := s.guardChanges(result.Created, len(due), 0, catalog); guard != nil {
+		result.Guard = guard
+		if !guard.Confirmed && !s.dryRun {
+			// The products stay counted as missing; a confirmed run deletes them
+			result.Status = models.WorseStatus(result.Status, models.SyncStatusDegraded)
+			result.Errors = append(result.Errors, guard.String())
+			return
+		}
+	}
+	if s.dryRun {
+		result.Deleted += len(due)
+		for _, p := range due {
+			result.Handles.Deleted = append(result.Handles.Deleted, p.Handle)
+		}
+		return
+	}
+
+	deletedIDs, err := tracker.DeleteProductsBatch(ctx, dueIDs, s.options.DeleteAfterRuns)
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("failed to delete missing products: %v", err))
+		return
+	}
+	// A run that found some of them back in its feed meanwhile kept them
+	deleted := withIDs(due, deletedIDs)
+	if kept := len(due) - len(deleted); kept > 0 {
+		log.Printf("Kept %d missing products found again by another run", kept)
+	}
+	if len(deleted) == 0 {
+		return
+	}
+	s.recordRemovals(ctx, deleted, models.ChangeActionDelete, result)
+	result.Deleted += len(deleted)
+	for _, p := range deleted {
+		result.Handles.Deleted = append(result.Handles.Deleted, p.Handle)
+	}
+	log.Printf("Deleted %d products missing from %d consecutive feeds", len(deleted), s.options.DeleteAfterRuns)
+}
@@ -0,0 +1,226 @@
+package repo
+
+import (
+	"context"
+	"go-cron/models"
+	"reflect"
+	"testing"
+)
+
+// Test_SyncService_Options tests case-sensitive matching, kept handles and the error threshold
+func Test_SyncService_Options(t *testing.T) {
+	var created []string
+	var updated []string
+	var fields []ProductFields
+	mockRepo := &MockProductRepository{
+		GetAllProductsFunc: func(ctx context.Context) ([]models.Product, error) {
+			return []models.Product{
+				{ID: 1, Title: "iPhone Case", Handle: "custom-case", Status: models.ProductStatusActive},
+			}, nil
+		},
+		CreateProductsBatchFunc: func(ctx context.Context, products []struct{ Title, Handle string }) error {
+			for _, p := range products {
+				created = append(created, p.Title)
+			}
+			return nil
+		},
+		UpdateProductsBatchFunc: func(ctx context.Context, updates []struct {
+			ID      int
+			Title   string
+			Handle  string
+			Fields  ProductFields
+			Version int
+		}) error {
+			for _, u := range updates {
+				updated = append(updated, u.Handle)
+				fields = append(fields, u.Fields)
+			}
+			return nil
+		},
+	}
+	syncService := NewSyncService(mockRepo)
+	items := []models.ExternalItem{{ItemCode: "A", ItemName: "IPHONE CASE"}}
+
+	// By default titles match ignoring case and the handle is regenerated
+	if _, err := syncService.CompareAndSync(context.Background(), items); err != nil {
+		t.Fatalf("CompareAndSync failed: %v", err)
+	}
+	if !reflect.DeepEqual(updated, []string{"iphone-case"}) || created != nil {
+		t.Errorf("Expected a handle update, got updates %v and creates %v", updated, created)
+	}
+
+	// Kept handles only update the title
+	updated, fields = nil, nil
+	opts := DefaultSyncOptions()
+	opts.UpdateHandles = false
+	if _, err := syncService.CompareAndSyncWith(context.Background(), items, opts); err != nil {
+		t.Fatalf("CompareAndSync failed: %v", err)
+	}
+	if !reflect.DeepEqual(updated, []string{"custom-case"}) {
+		t.Errorf("Expected the handle to be kept, got %v", updated)
+	}
+	if !reflect.DeepEqual(fields, []ProductFields{UpdateTitle}) {
+		t.Errorf("Expected only the title to be written, got %v", fields)
+	}
+
+	// Case-sensitive titles are different products
+	updated = nil
+	opts = DefaultSyncOptions()
+	opts.CaseSensitive = true
+	if _, err := syncService.CompareAndSyncWith(context.Background(), items, opts); err != nil {
+		t.Fatalf("CompareAndSync failed: %v", err)
+	}
+	if updated != nil || !reflect.DeepEqual(created, []string{"IPHONE CASE"}) {
+		t.Errorf("Expected a new product, got updates %v and creates %v", updated, created)
+	}
+	if syncService.Options() != DefaultSyncOptions() {
+		t.Errorf("Expected per-call options to leave the service alone, got %+v", syncService.Options())
+	}
+
+	// Too many rejected items abort before any write
+	created = nil
+	syncService.SetOptions(SyncOptions{UpdateHandles: true, MaxErrors: 1})
+	bad := []models.ExternalItem{{ItemCode: "X"}, {ItemCode: "Y"}, {ItemCode: "Z", ItemName: "New"}}
+	if _, err := syncService.CompareAndSync(context.Background(), bad); err == nil {
+		t.Error("Expected the sync to abort")
+	}
+	if created != nil {
+		t.Errorf("Expected no writes, got creates %v", created)
+	}
+}
+
+// Test_SyncService_ArchiveMissing tests that products missing from the feed are archived only when enabled
+func Test_SyncService_ArchiveMissing(t *testing.T) {
+	var archived []int
+	mockRepo := &MockProductRepository{
+		GetAllProductsFunc: func(ctx context.Context) ([]models.Product, error) {
+			return []models.Product{
+				{ID: 1, Title: "Kept", Handle: "kept", Status: models.ProductStatusActive},
+				{ID: 2, Title: "Gone", Handle: "gone", Status: models.ProductStatusActive},
+				{ID: 3, Title: "Old", Handle: "old", Status: models.ProductStatusArchived},
+			}, nil
+		},
+		ArchiveProductsBatchFunc: func(ctx context.Context, ids []int) ([]int, error) {
+			archived = ids
+			return ids, nil
+		},
+	}
+	feed := []models.ExternalItem{{ItemCode: "K", ItemName: "kept"}}
+
+	syncService := NewSyncService(mockRepo)
+	result := &models.SyncResult{}
+	syncService.ArchiveMissing(context.Background(), feed, result)
+	if archived != nil || result.Archived != 0 {
+		t.Errorf("Expected nothing archived by default, got %v", archived)
+	}
+
+	syncService.SetOptions(SyncOptions{DeleteMissing: true})
+	syncService.ArchiveMissing(context.Background(), nil, result)
+	if archived != nil {
+		t.Errorf("Expected an empty feed to archive nothing, got %v", archived)
+	}
+	syncService.ArchiveMissing(context.Background(), feed, result)
+	if !reflect.DeepEqual(archived, []int{2}) || result.Archived != 1 {
+		t.Errorf("Expected product 2 to be archived, got %v (%d)", archived, result.Archived)
+	}
+}
+
+// Test_SyncService_ArchiveMissing_ArchivedByOtherRun tests that a product
+// archived by a concurrent run is neither counted nor audited again
+func Test_SyncService_ArchiveMissing_ArchivedByOtherRun(t *testing.T) {
+	mockRepo := &MockProductRepository{
+		GetAllProductsFunc: func(ctx context.Context) ([]models.Product, error) {
+			return []models.Product{
+				{ID: 1, Title: "Kept", Handle: "kept", Status: models.ProductStatusActive},
+				{ID: 2, Title: "Gone", Handle: "gone", Status: models.ProductStatusActive},
+				{ID: 3, Title: "Taken", Handle: "taken", Status: models.ProductStatusActive},
+			}, nil
+		},
+		ArchiveProductsBatchFunc: func(ctx context.Context, ids []int) ([]int, error) {
+			return []int{2}, nil
+		},
+	}
+	audit := &MockAuditRepository{}
+
+	syncService := NewSyncServiceWithOptions(mockRepo, SyncOptions{DeleteMissing: true})
+	syncService.SetAudit(audit, 1)
+	result := &models.SyncResult{}
+	syncService.ArchiveMissing(context.Background(), []models.ExternalItem{{ItemCode: "K", ItemName: "kept"}}, result)
+	if result.Archived != 1 || !reflect.DeepEqual(result.Handles.Archived, []string{"gone"}) {
+		t.Errorf("Expected only product 2 to be archived, got %d %v", result.Archived, result.Handles.Archived)
+	}
+	if len(audit.Changes) != 1 || audit.Changes[0].ProductID != 2 {
+		t.Errorf("Expected only the archive of product 2 to be audited, got %+v", audit.Changes)
+	}
+}
+
+// Test_SyncService_ChangeGuard tests that creates out of proportion with the catalog are held back unless confirmed
+func Test_SyncService_ChangeGuard(t *testing.T) {
+	var created int
+	mockRepo := &MockProductRepository{
+		GetAllProductsFunc: func(ctx context.Context) ([]models.Product, error) {
+			return []models.Product{
+				{ID: 1, Title: "A", Handle: "a", Status: models.ProductStatusActive},
+				{ID: 2, Title: "B", Handle: "b", Status: models.ProductStatusActive},
+			}, nil
+		},
+		CreateProductsBatchFunc: func(ctx context.Context, products []struct{ Title, Handle string }) error {
+			created += len(products)
+			return nil
+		},
+	}
+	items := []models.ExternalItem{{ItemCode: "A", ItemName: "A"}, {ItemCode: "C", ItemName: "C"}, {ItemCode: "D", ItemName: "D"}}
+
+	syncService := NewSyncServiceWithOptions(mockRepo, SyncOptions{UpdateHandles: true, MaxChangeRatio: 0.5})
+	result, err := syncService.CompareAndSync(context.Background(), items)
+	if err != nil {
+		t.Fatalf("CompareAndSync failed: %v", err)
+	}
+	want := &models.ChangeGuard{Creates: 2, Catalog: 2, MaxRatio: 0.5}
+	if result.Status != models.SyncStatusFailed || !reflect.DeepEqual(result.Guard, want) || created != 0 {
+		t.Errorf("Expected the guard to hold back 2 creates, got %+v and %d creates", result, created)
+	}
+
+	// Within the ratio the guard stays quiet
+	result, err = syncService.CompareAndSync(context.Background(), items[:2])
+	if err != nil {
+		t.Fatalf("CompareAndSync failed: %v", err)
+	}
+	if result.Guard != nil || created != 1 {
+		t.Errorf("Expected 1 create without a guard trip, got %+v and %d creates", result.Guard, created)
+	}
+
+	created = 0
+	opts := syncService.Options()
+	opts.Confirmed = true
+	result, err = syncService.CompareAndSyncWith(context.Background(), items, opts)
+	if err != nil {
+		t.Fatalf("CompareAndSync failed: %v", err)
+	}
+	if result.Status != models.SyncStatusOK || result.Guard == nil || !result.Guard.Confirmed || created != 2 {
+		t.Errorf("Expected a confirmed run to apply 2 creates, got %+v and %d creates", result, created)
+	}
+}
+
+// Test_SyncService_ChangeGuard_Updates tests that updates out of proportion
+// with the catalog trip the guard too
+func Test_SyncService_ChangeGuard_Updates(t *testing.T) {
+	mockRepo := &MockProductRepository{
+		GetAllProductsFunc: func(ctx context.Context) ([]models.Product, error) {
+			return []models.Product{{ID: 1, Title: "A", Handle: "a"}, {ID: 2, Title: "B", Handle: "b"}}, nil
+		},
+	}
+	items := []models.ExternalItem{{ItemCode: "A", ItemName: "a"}, {ItemCode: "B", ItemName: "b"}}
+
+	result, err := NewSyncServiceWithOptions(mockRepo, SyncOptions{MaxUpdateRatio: 0.5}).CompareAndSync(context.Background(), items)
+	if err != nil {
+		t.Fatalf("CompareAndSync failed: %v", err)
+	}
+	want := &models.ChangeGuard{Updates: 2, Catalog: 2, MaxUpdateRatio: 0.5}
+	if result.Status != models.SyncStatusFailed || !reflect.DeepEqual(result.Guard, want) || result.Updated != 0 {
+		t.Errorf("Expected the guard to hold back 2 updates, got %+v", result)
+	}
+	if got := want.String(); got != "change guard tripped: 2 updates exceed 50% of the 2 products" {
+		t.Errorf("Unexpected guard description %q", got)
+	}
+}
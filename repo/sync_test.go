@@ -2,22 +2,43 @@ package repo
 
 import (
 	"context"
+	"errors"
 	"go-cron/models"
+	"reflect"
+	"strings"
 	"testing"
 )
 
 // MockProductRepository is a mock implementation of ProductRepositoryInterface for testing
 type MockProductRepository struct {
-	GetAllProductsFunc      func(ctx context.Context) ([]models.Product, error)
-	GetProductByTitleFunc   func(ctx context.Context, title string) (*models.Product, error)
-	CreateProductFunc       func(ctx context.Context, title, handle string) (int, error)
-	UpdateProductFunc       func(ctx context.Context, id int, title, handle string) error
-	CreateProductsBatchFunc func(ctx context.Context, products []struct{ Title, Handle string }) error
-	UpdateProductsBatchFunc func(ctx context.Context, updates []struct {
-		ID     int
-		Title  string
-		Handle string
+	GetAllProductsFunc        func(ctx context.Context) ([]models.Product, error)
+	GetProductsPagedFunc      func(ctx context.Context, offset, limit int) ([]models.Product, error)
+	FindProductsFunc          func(ctx context.Context, filter models.ProductFilter, offset, limit int) ([]models.Product, error)
+	CountMatchingProductsFunc func(ctx context.Context, filter models.ProductFilter) (int, error)
+	SearchProductsFunc        func(ctx context.Context, query string, limit int) ([]models.Product, error)
+	GetProductsByTitlesFunc   func(ctx context.Context, titles []string) ([]models.Product, error)
+	CountProductsFunc         func(ctx context.Context) (int, error)
+	CountActiveProductsFunc   func(ctx context.Context) (int, error)
+	GetProductByTitleFunc     func(ctx context.Context, title string) (*models.Product, error)
+	CreateProductFunc         func(ctx context.Context, title, handle string) (int, error)
+	UpdateProductFunc         func(ctx context.Context, id int, title, handle string) error
+	CreateProductsBatchFunc   func(ctx context.Context, products []struct{ Title, Handle string }) error
+	UpdateProductsBatchFunc   func(ctx context.Context, updates []struct {
+		ID      int
+		Title   string
+		Handle  string
+		Fields  ProductFields
+		Version int
 	}) error
+	SaveRawTitlesFunc           func(ctx context.Context, rawTitles map[int]string) error
+	SaveCategoriesFunc          func(ctx context.Context, categories map[int]string) ([]int, error)
+	SavePricesFunc              func(ctx context.Context, prices map[int]models.ProductPrice) ([]int, error)
+	CheckIntegrityFunc          func(ctx context.Context) (*models.IntegrityReport, error)
+	DeleteProductsFunc          func(ctx context.Context, ids []int) (int, error)
+	ArchiveProductsBatchFunc    func(ctx context.Context, ids []int) ([]int, error)
+	ReactivateProductsBatchFunc func(ctx context.Context, ids []int) (int, error)
+	// NoOpUpdateIDs are products whose stored values already match the update
+	NoOpUpdateIDs map[int]bool
 }
 
 func (m *MockProductRepository) GetAllProducts(ctx context.Context) ([]models.Product, error) {
@@ -27,6 +48,69 @@ func (m *MockProductRepository) GetAllProducts(ctx context.Context) ([]models.Pr
 	return []models.Product{}, nil
 }
 
+func (m *MockProductRepository) GetProductsPaged(ctx context.Context, offset, limit int) ([]models.Product, error) {
+	if m.GetProductsPagedFunc != nil {
+		return m.GetProductsPagedFunc(ctx, offset, limit)
+	}
+	return []models.Product{}, nil
+}
+
+func (m *MockProductRepository) FindProducts(ctx context.Context, filter models.ProductFilter, offset, limit int) ([]models.Product, error) {
+	if m.FindProductsFunc != nil {
+		return m.FindProductsFunc(ctx, filter, offset, limit)
+	}
+	return []models.Product{}, nil
+}
+
+func (m *MockProductRepository) CountMatchingProducts(ctx context.Context, filter models.ProductFilter) (int, error) {
+	if m.CountMatchingProductsFunc != nil {
+		return m.CountMatchingProductsFunc(ctx, filter)
+	}
+	return 0, nil
+}
+
+func (m *MockProductRepository) SearchProducts(ctx context.Context, query string, limit int) ([]models.Product, error) {
+	if m.SearchProductsFunc != nil {
+		return m.SearchProductsFunc(ctx, query, limit)
+	}
+	return []models.Product{}, nil
+}
+
+func (m *MockProductRepository) GetProductsByTitles(ctx context.Context, titles []string) ([]models.Product, error) {
+	if m.GetProductsByTitlesFunc != nil {
+		return m.GetProductsByTitlesFunc(ctx, titles)
+	}
+	return []models.Product{}, nil
+}
+
+func (m *MockProductRepository) CountProducts(ctx context.Context) (int, error) {
+	if m.CountProductsFunc != nil {
+		return m.CountProductsFunc(ctx)
+	}
+	return 0, nil
+}
+
+func (m *MockProductRepository) CountActiveProducts(ctx context.Context) (int, error) {
+	if m.CountActiveProductsFunc != nil {
+		return m.CountActiveProductsFunc(ctx)
+	}
+	return 0, nil
+}
+
+func (m *MockProductRepository) ArchiveProductsBatch(ctx context.Context, ids []int) ([]int, error) {
+	if m.ArchiveProductsBatchFunc != nil {
+		return m.ArchiveProductsBatchFunc(ctx, ids)
+	}
+	return ids, nil
+}
+
+func (m *MockProductRepository) ReactivateProductsBatch(ctx context.Context, ids []int) (int, error) {
+	if m.ReactivateProductsBatchFunc != nil {
+		return m.ReactivateProductsBatchFunc(ctx, ids)
+	}
+	return len(ids), nil
+}
+
 func (m *MockProductRepository) GetProductByTitle(ctx context.Context, title string) (*models.Product, error) {
 	if m.GetProductByTitleFunc != nil {
 		return m.GetProductByTitleFunc(ctx, title)
@@ -56,16 +140,61 @@ func (m *MockProductRepository) CreateProductsBatch(ctx context.Context, product
 }
 
 func (m *MockProductRepository) UpdateProductsBatch(ctx context.Context, updates []struct {
-	ID     int
-	Title  string
-	Handle string
-}) error {
+	ID      int
+	Title   string
+	Handle  string
+	Fields  ProductFields
+	Version int
+}) ([]int, error) {
 	if m.UpdateProductsBatchFunc != nil {
-		return m.UpdateProductsBatchFunc(ctx, updates)
+		if err := m.UpdateProductsBatchFunc(ctx, updates); err != nil {
+			return nil, err
+		}
+	}
+	var changed []int
+	for _, u := range updates {
+		if !m.NoOpUpdateIDs[u.ID] {
+			changed = append(changed, u.ID)
+		}
+	}
+	return changed, nil
+}
+
+func (m *MockProductRepository) SaveCategories(ctx context.Context, categories map[int]string) ([]int, error) {
+	if m.SaveCategoriesFunc != nil {
+		return m.SaveCategoriesFunc(ctx, categories)
+	}
+	return nil, nil
+}
+
+func (m *MockProductRepository) SavePrices(ctx context.Context, prices map[int]models.ProductPrice) ([]int, error) {
+	if m.SavePricesFunc != nil {
+		return m.SavePricesFunc(ctx, prices)
+	}
+	return nil, nil
+}
+
+func (m *MockProductRepository) SaveRawTitles(ctx context.Context, rawTitles map[int]string) error {
+	if m.SaveRawTitlesFunc != nil {
+		return m.SaveRawTitlesFunc(ctx, rawTitles)
 	}
 	return nil
 }
 
+func (m *MockProductRepository) CheckIntegrity(ctx context.Context) (*models.IntegrityReport, error) {
+	if m.CheckIntegrityFunc != nil {
+		return m.CheckIntegrityFunc(ctx)
+	}
+	return nil, nil
+}
+
+func (m *MockProductRepository) DeleteProducts(ctx context.Context, ids []int) (int, error) {
+	if m.DeleteProductsFunc != nil {
+		return m.DeleteProductsFunc(ctx, ids)
+	}
+	return len(ids), nil
+}
+
 // Test_SyncService_CompareAndSync_NewItems tests creating new items
 func Test_SyncService_CompareAndSync_NewItems(t *testing.T) {
 	ctx := context.Background()
@@ -97,10 +226,10 @@ func Test_SyncService_CompareAndSync_NewItems(t *testing.T) {
 	syncService := NewSyncService(mockRepo)
 
 	// External API data (mock)
-	externalItems := []map[string]interface{}{
-		{"ItemName": "Product A", "ItemCode": "A001"},
-		{"ItemName": "Product B", "ItemCode": "B001"},
-		{"ItemName": "Product C", "ItemCode": "C001"},
+	externalItems := []models.ExternalItem{
+		{ItemName: "Product A", ItemCode: "A001"},
+		{ItemName: "Product B", ItemCode: "B001"},
+		{ItemName: "Product C", ItemCode: "C001"},
 	}
 
 	result, err := syncService.CompareAndSync(ctx, externalItems)
@@ -121,6 +250,9 @@ func Test_SyncService_CompareAndSync_NewItems(t *testing.T) {
 	if len(result.Errors) != 0 {
 		t.Errorf("Expected 0 errors, got %d: %v", len(result.Errors), result.Errors)
 	}
+	if got := strings.Join(result.Handles.Created, ","); got != "product-a,product-b,product-c" {
+		t.Errorf("Expected the created handles to be listed, got %q", got)
+	}
 }
 
 // Test_SyncService_CompareAndSync_UpdateExisting tests updating existing items
@@ -136,9 +268,11 @@ func Test_SyncService_CompareAndSync_UpdateExisting(t *testing.T) {
 			}, nil
 		},
 		UpdateProductsBatchFunc: func(ctx context.Context, updates []struct {
-			ID     int
-			Title  string
-			Handle string
+			ID      int
+			Title   string
+			Handle  string
+			Fields  ProductFields
+			Version int
 		}) error {
 			// Verify we're updating the right products
 			if len(updates) != 2 {
@@ -159,9 +293,9 @@ func Test_SyncService_CompareAndSync_UpdateExisting(t *testing.T) {
 	syncService := NewSyncService(mockRepo)
 
 	// External API data with same titles but updated data
-	externalItems := []map[string]interface{}{
-		{"ItemName": "Product A", "ItemCode": "A001"},
-		{"ItemName": "Product B", "ItemCode": "B001"},
+	externalItems := []models.ExternalItem{
+		{ItemName: "Product A", ItemCode: "A001"},
+		{ItemName: "Product B", ItemCode: "B001"},
 	}
 
 	result, err := syncService.CompareAndSync(ctx, externalItems)
@@ -198,9 +332,9 @@ func Test_SyncService_CompareAndSync_UnchangedItems(t *testing.T) {
 	syncService := NewSyncService(mockRepo)
 
 	// External API data matching database
-	externalItems := []map[string]interface{}{
-		{"ItemName": "Product A", "ItemCode": "A001"},
-		{"ItemName": "Product B", "ItemCode": "B001"},
+	externalItems := []models.ExternalItem{
+		{ItemName: "Product A", ItemCode: "A001"},
+		{ItemName: "Product B", ItemCode: "B001"},
 	}
 
 	result, err := syncService.CompareAndSync(ctx, externalItems)
@@ -239,9 +373,11 @@ func Test_SyncService_CompareAndSync_MixedScenario(t *testing.T) {
 			return nil
 		},
 		UpdateProductsBatchFunc: func(ctx context.Context, updates []struct {
-			ID     int
-			Title  string
-			Handle string
+			ID      int
+			Title   string
+			Handle  string
+			Fields  ProductFields
+			Version int
 		}) error {
 			if len(updates) != 1 {
 				t.Errorf("Expected 1 product update, got %d", len(updates))
@@ -257,11 +393,11 @@ func Test_SyncService_CompareAndSync_MixedScenario(t *testing.T) {
 	syncService := NewSyncService(mockRepo)
 
 	// External API data: 1 unchanged, 1 updated (same title but handle changes), 2 new
-	externalItems := []map[string]interface{}{
-		{"ItemName": "Existing Product 1", "ItemCode": "E001"},  // Unchanged
-		{"ItemName": "Product To Update", "ItemCode": "U001"},   // Updated (handle will change from "old-handle" to "product-to-update")
-		{"ItemName": "Brand New Product A", "ItemCode": "N001"}, // New
-		{"ItemName": "Brand New Product B", "ItemCode": "N002"}, // New
+	externalItems := []models.ExternalItem{
+		{ItemName: "Existing Product 1", ItemCode: "E001"},  // Unchanged
+		{ItemName: "Product To Update", ItemCode: "U001"},   // Updated (handle will change from "old-handle" to "product-to-update")
+		{ItemName: "Brand New Product A", ItemCode: "N001"}, // New
+		{ItemName: "Brand New Product B", ItemCode: "N002"}, // New
 	}
 
 	result, err := syncService.CompareAndSync(ctx, externalItems)
@@ -304,11 +440,10 @@ func Test_SyncService_CompareAndSync_InvalidData(t *testing.T) {
 	syncService := NewSyncService(mockRepo)
 
 	// External API data with invalid items
-	externalItems := []map[string]interface{}{
-		{"ItemName": "", "ItemCode": "A001"},              // Invalid: empty name
-		{"ItemCode": "B001"},                              // Invalid: missing ItemName
-		{"ItemName": 123, "ItemCode": "C001"},             // Invalid: wrong type
-		{"ItemName": "Valid Product", "ItemCode": "D001"}, // Valid
+	externalItems := []models.ExternalItem{
+		{ItemName: "", ItemCode: "A001"},              // Invalid: empty name
+		{ItemCode: "B001"},                            // Invalid: missing ItemName
+		{ItemName: "Valid Product", ItemCode: "D001"}, // Valid
 	}
 
 	result, err := syncService.CompareAndSync(ctx, externalItems)
@@ -316,12 +451,12 @@ func Test_SyncService_CompareAndSync_InvalidData(t *testing.T) {
 		t.Fatalf("CompareAndSync failed: %v", err)
 	}
 
-	// Should have 3 errors and 1 created item
+	// Should have 2 errors and 1 created item (wrong types are rejected by the decoder)
 	if result.Created != 1 {
 		t.Errorf("Expected 1 item created, got %d", result.Created)
 	}
-	if len(result.Errors) != 3 {
-		t.Errorf("Expected 3 errors, got %d: %v", len(result.Errors), result.Errors)
+	if len(result.Errors) != 2 {
+		t.Errorf("Expected 2 errors, got %d: %v", len(result.Errors), result.Errors)
 	}
 }
 
@@ -341,9 +476,9 @@ func Test_SyncService_CompareAndSync_CaseInsensitiveMatching(t *testing.T) {
 	syncService := NewSyncService(mockRepo)
 
 	// External API data with different casing
-	externalItems := []map[string]interface{}{
-		{"ItemName": "COFFEE BEANS", "ItemCode": "C001"}, // Same as "Coffee Beans"
-		{"ItemName": "tea leaves", "ItemCode": "T001"},   // Same as "TEA LEAVES"
+	externalItems := []models.ExternalItem{
+		{ItemName: "COFFEE BEANS", ItemCode: "C001"}, // Same as "Coffee Beans"
+		{ItemName: "tea leaves", ItemCode: "T001"},   // Same as "TEA LEAVES"
 	}
 
 	result, err := syncService.CompareAndSync(ctx, externalItems)
@@ -361,6 +496,189 @@ func Test_SyncService_CompareAndSync_CaseInsensitiveMatching(t *testing.T) {
 	}
 }
 
+// Test_SyncService_CompareAndSync_IntegrityDegraded tests that failed post-apply assertions degrade the run
+func Test_SyncService_CompareAndSync_IntegrityDegraded(t *testing.T) {
+	ctx := context.Background()
+
+	mockRepo := &MockProductRepository{
+		GetAllProductsFunc: func(ctx context.Context) ([]models.Product, error) {
+			return []models.Product{
+				{ID: 1, Title: "Product A", Handle: "product-a"},
+			}, nil
+		},
+		CheckIntegrityFunc: func(ctx context.Context) (*models.IntegrityReport, error) {
+			// One create was planned but the row count did not grow
+			return &models.IntegrityReport{TotalProducts: 1, EmptyHandles: 1}, nil
+		},
+	}
+
+	syncService := NewSyncService(mockRepo)
+
+	externalItems := []models.ExternalItem{
+		{ItemName: "Product A", ItemCode: "A001"},
+		{ItemName: "Product B", ItemCode: "B001"},
+	}
+
+	result, err := syncService.CompareAndSync(ctx, externalItems)
+	if err != nil {
+		t.Fatalf("CompareAndSync failed: %v", err)
+	}
+
+	if result.Status != models.SyncStatusDegraded {
+		t.Errorf("Expected status %q, got %q", models.SyncStatusDegraded, result.Status)
+	}
+	if len(result.IntegrityIssues) != 2 {
+		t.Errorf("Expected 2 integrity issues, got %d: %v", len(result.IntegrityIssues), result.IntegrityIssues)
+	}
+}
+
+// Test_SyncService_CompareAndSync_IntegrityOK tests that passing assertions keep the run healthy
+func Test_SyncService_CompareAndSync_IntegrityOK(t *testing.T) {
+	ctx := context.Background()
+
+	mockRepo := &MockProductRepository{
+		CheckIntegrityFunc: func(ctx context.Context) (*models.IntegrityReport, error) {
+			return &models.IntegrityReport{TotalProducts: 1}, nil
+		},
+	}
+
+	syncService := NewSyncService(mockRepo)
+
+	result, err := syncService.CompareAndSync(ctx, []models.ExternalItem{
+		{ItemName: "Product A", ItemCode: "A001"},
+	})
+	if err != nil {
+		t.Fatalf("CompareAndSync failed: %v", err)
+	}
+
+	if result.Status != models.SyncStatusOK {
+		t.Errorf("Expected status %q, got %q: %v", models.SyncStatusOK, result.Status, result.IntegrityIssues)
+	}
+}
+
+// Test_SyncService_CompareAndSync_DryRun tests that dry runs report planned changes without writing
+func Test_SyncService_CompareAndSync_DryRun(t *testing.T) {
+	ctx := context.Background()
+
+	mockRepo := &MockProductRepository{
+		GetAllProductsFunc: func(ctx context.Context) ([]models.Product, error) {
+			return []models.Product{
+				{ID: 1, Title: "Product A", Handle: "old-handle-a"},
+			}, nil
+		},
+		CreateProductsBatchFunc: func(ctx context.Context, products []struct{ Title, Handle string }) error {
+			t.Error("CreateProductsBatch must not be called in dry-run mode")
+			return nil
+		},
+		UpdateProductsBatchFunc: func(ctx context.Context, updates []struct {
+			ID      int
+			Title   string
+			Handle  string
+			Fields  ProductFields
+			Version int
+		}) error {
+			t.Error("UpdateProductsBatch must not be called in dry-run mode")
+			return nil
+		},
+	}
+
+	syncService := NewSyncService(mockRepo)
+	syncService.SetDryRun(true)
+
+	result, err := syncService.CompareAndSync(ctx, []models.ExternalItem{
+		{ItemName: "Product A", ItemCode: "A001"},
+		{ItemName: "Product B", ItemCode: "B001"},
+	})
+	if err != nil {
+		t.Fatalf("CompareAndSync failed: %v", err)
+	}
+
+	if !result.DryRun {
+		t.Error("Expected result to be marked as dry run")
+	}
+	if result.Created != 1 || result.Updated != 1 {
+		t.Errorf("Expected 1 planned create and 1 planned update, got %d and %d", result.Created, result.Updated)
+	}
+}
+
+// Test_SyncService_CompareAndSync_TitleLookup tests looking up only the titles present in the batch
+func Test_SyncService_CompareAndSync_TitleLookup(t *testing.T) {
+	ctx := context.Background()
+
+	var lookups [][]string
+	mockRepo := &MockProductRepository{
+		GetAllProductsFunc: func(ctx context.Context) ([]models.Product, error) {
+			t.Error("GetAllProducts must not be called when a lookup batch size is set")
+			return nil, nil
+		},
+		CountProductsFunc: func(ctx context.Context) (int, error) {
+			return 1000, nil
+		},
+		GetProductsByTitlesFunc: func(ctx context.Context, titles []string) ([]models.Product, error) {
+			lookups = append(lookups, titles)
+			for _, title := range titles {
+				if title == "product a" {
+					return []models.Product{{ID: 1, Title: "Product A", Handle: "product-a"}}, nil
+				}
+			}
+			return nil, nil
+		},
+		CheckIntegrityFunc: func(ctx context.Context) (*models.IntegrityReport, error) {
+			return &models.IntegrityReport{TotalProducts: 1002}, nil
+		},
+	}
+
+	syncService := NewSyncService(mockRepo)
+	syncService.SetLookupBatchSize(2)
+
+	result, err := syncService.CompareAndSync(ctx, []models.ExternalItem{
+		{ItemName: "Product A", ItemCode: "A001"},
+		{ItemName: "Product A", ItemCode: "A002"}, // Same title, looked up once
+		{ItemName: "Product B", ItemCode: "B001"},
+		{ItemName: "Product C", ItemCode: "C001"},
+	})
+	if err != nil {
+		t.Fatalf("CompareAndSync failed: %v", err)
+	}
+
+	if len(lookups) != 2 || len(lookups[0]) != 2 || len(lookups[1]) != 1 {
+		t.Errorf("Expected titles to be looked up in chunks of 2, got %v", lookups)
+	}
+	if result.Created != 2 || result.Unchanged != 2 {
+		t.Errorf("Expected 2 created and 2 unchanged, got %d and %d", result.Created, result.Unchanged)
+	}
+	if result.Status != models.SyncStatusOK {
+		t.Errorf("Expected status %q, got %q: %v", models.SyncStatusOK, result.Status, result.IntegrityIssues)
+	}
+}
+
+// Test_SyncService_FindStale tests detection of products missing from the external feed
+func Test_SyncService_FindStale(t *testing.T) {
+	ctx := context.Background()
+
+	mockRepo := &MockProductRepository{
+		GetAllProductsFunc: func(ctx context.Context) ([]models.Product, error) {
+			return []models.Product{
+				{ID: 1, Title: "Product A", Handle: "product-a"},
+				{ID: 2, Title: "Discontinued", Handle: "discontinued"},
+			}, nil
+		},
+	}
+
+	syncService := NewSyncService(mockRepo)
+
+	stale, err := syncService.FindStale(ctx, []models.ExternalItem{
+		{ItemName: "PRODUCT A", ItemCode: "A001"},
+	})
+	if err != nil {
+		t.Fatalf("FindStale failed: %v", err)
+	}
+
+	if len(stale) != 1 || stale[0].ID != 2 {
+		t.Errorf("Expected only product 2 to be stale, got %v", stale)
+	}
+}
+
 // Test_generateHandle tests the handle generation function
 func Test_generateHandle(t *testing.T) {
 	tests := []struct {
@@ -408,3 +726,425 @@ func Test_normalizeTitle(t *testing.T) {
 		})
 	}
 }
+
+// Test_SyncService_CompareAndSync_TimedOutDuringWrites tests that an expiring context yields a partial result
+func Test_SyncService_CompareAndSync_TimedOutDuringWrites(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mockRepo := &MockProductRepository{
+		GetAllProductsFunc: func(ctx context.Context) ([]models.Product, error) {
+			return []models.Product{{ID: 1, Title: "Product A", Handle: "old-handle"}}, nil
+		},
+		CreateProductsBatchFunc: func(ctx context.Context, products []struct{ Title, Handle string }) error {
+			return nil // Committed before the deadline
+		},
+		UpdateProductsBatchFunc: func(ctx context.Context, updates []struct {
+			ID      int
+			Title   string
+			Handle  string
+			Fields  ProductFields
+			Version int
+		}) error {
+			cancel() // Deadline hits mid-batch
+			return ctx.Err()
+		},
+		CheckIntegrityFunc: func(ctx context.Context) (*models.IntegrityReport, error) {
+			t.Error("CheckIntegrity must not run after a timeout")
+			return nil, nil
+		},
+	}
+
+	result, err := NewSyncService(mockRepo).CompareAndSync(ctx, []models.ExternalItem{
+		{ItemName: "Product A", ItemCode: "A001"},
+		{ItemName: "Product B", ItemCode: "B001"},
+	})
+	if err != nil {
+		t.Fatalf("Expected a partial result instead of an error, got %v", err)
+	}
+
+	if result.Status != models.SyncStatusTimedOut {
+		t.Errorf("Expected status %q, got %q", models.SyncStatusTimedOut, result.Status)
+	}
+	if result.Created != 1 || result.Updated != 0 {
+		t.Errorf("Expected only the committed create to be counted, got %d created and %d updated", result.Created, result.Updated)
+	}
+}
+
+// Test_SyncService_CompareAndSync_TimedOutBeforeLoad tests that an expired context is reported as a timeout
+func Test_SyncService_CompareAndSync_TimedOutBeforeLoad(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	mockRepo := &MockProductRepository{
+		GetAllProductsFunc: func(ctx context.Context) ([]models.Product, error) {
+			return nil, ctx.Err()
+		},
+	}
+
+	result, err := NewSyncService(mockRepo).CompareAndSync(ctx, []models.ExternalItem{{ItemName: "Product A"}})
+	if err != nil {
+		t.Fatalf("Expected a partial result instead of an error, got %v", err)
+	}
+	if result.Status != models.SyncStatusTimedOut {
+		t.Errorf("Expected status %q, got %q", models.SyncStatusTimedOut, result.Status)
+	}
+}
+
+// MockAuditRepository captures recorded changes
+type MockAuditRepository struct {
+	Changes []models.ProductChange
+}
+
+func (m *MockAuditRepository) RecordChanges(ctx context.Context, changes []models.ProductChange) error {
+	m.Changes = append(m.Changes, changes...)
+	return nil
+}
+
+func (m *MockAuditRepository) ListChangesByProduct(ctx context.Context, productID, limit int) ([]models.ProductChange, error) {
+	return nil, nil
+}
+
+func (m *MockAuditRepository) ListChangesByRun(ctx context.Context, runID, limit int) ([]models.ProductChange, error) {
+	return nil, nil
+}
+
+// Test_SyncService_CompareAndSync_RecordsAudit tests that applied changes are audited with their previous values
+func Test_SyncService_CompareAndSync_RecordsAudit(t *testing.T) {
+	mockRepo := &MockProductRepository{
+		GetAllProductsFunc: func(ctx context.Context) ([]models.Product, error) {
+			return []models.Product{{ID: 7, Title: "Product A", Handle: "old-handle"}}, nil
+		},
+	}
+	audit := &MockAuditRepository{}
+
+	syncService := NewSyncService(mockRepo)
+	syncService.SetAudit(audit, 42)
+
+	_, err := syncService.CompareAndSync(context.Background(), []models.ExternalItem{
+		{ItemName: "Product A", ItemCode: "A001"},
+		{ItemName: "Product B", ItemCode: "B001"},
+	})
+	if err != nil {
+		t.Fatalf("CompareAndSync failed: %v", err)
+	}
+
+	if len(audit.Changes) != 2 {
+		t.Fatalf("Expected 2 audited changes, got %d", len(audit.Changes))
+	}
+	for _, c := range audit.Changes {
+		if c.RunID != 42 {
+			t.Errorf("Expected run ID 42, got %d", c.RunID)
+		}
+		switch c.Action {
+		case models.ChangeActionCreate:
+			if c.NewTitle != "Product B" || c.NewHandle != "product-b" || c.OldTitle != "" {
+				t.Errorf("Unexpected create entry: %+v", c)
+			}
+		case models.ChangeActionUpdate:
+			if c.ProductID != 7 || c.OldHandle != "old-handle" || c.NewHandle != "product-a" {
+				t.Errorf("Unexpected update entry: %+v", c)
+			}
+		default:
+			t.Errorf("Unexpected action %q", c.Action)
+		}
+	}
+}
+
+// Test_SyncService_CompareAndSync_DryRunSkipsAudit tests that dry runs leave no audit trail
+func Test_SyncService_CompareAndSync_DryRunSkipsAudit(t *testing.T) {
+	audit := &MockAuditRepository{}
+
+	syncService := NewSyncService(&MockProductRepository{})
+	syncService.SetDryRun(true)
+	syncService.SetAudit(audit, 1)
+
+	if _, err := syncService.CompareAndSync(context.Background(), []models.ExternalItem{{ItemName: "Product A"}}); err != nil {
+		t.Fatalf("CompareAndSync failed: %v", err)
+	}
+	if len(audit.Changes) != 0 {
+		t.Errorf("Expected no audited changes in dry-run, got %d", len(audit.Changes))
+	}
+}
+
+// Test_SyncService_CompareAndSync_UnrecordedRunSkipsAudit tests that the
+// changes of a run that could not be recorded are not audited
+func Test_SyncService_CompareAndSync_UnrecordedRunSkipsAudit(t *testing.T) {
+	audit := &MockAuditRepository{}
+
+	syncService := NewSyncService(&MockProductRepository{})
+	syncService.SetAudit(audit, 0)
+
+	if _, err := syncService.CompareAndSync(context.Background(), []models.ExternalItem{{ItemName: "Product A"}}); err != nil {
+		t.Fatalf("CompareAndSync failed: %v", err)
+	}
+	if len(audit.Changes) != 0 {
+		t.Errorf("Expected no audited changes without a run, got %d", len(audit.Changes))
+	}
+}
+
+// Test_SyncService_CompareAndSync_NoOpUpdates tests that updates the database skipped are not counted or audited
+func Test_SyncService_CompareAndSync_NoOpUpdates(t *testing.T) {
+	mockRepo := &MockProductRepository{
+		GetAllProductsFunc: func(ctx context.Context) ([]models.Product, error) {
+			return []models.Product{
+				{ID: 1, Title: "Product A", Handle: "old-handle-a"},
+				{ID: 2, Title: "Product B", Handle: "old-handle-b"},
+			}, nil
+		},
+		// A concurrent sync already fixed product 2
+		NoOpUpdateIDs: map[int]bool{2: true},
+	}
+	audit := &MockAuditRepository{}
+
+	syncService := NewSyncService(mockRepo)
+	syncService.SetAudit(audit, 1)
+
+	result, err := syncService.CompareAndSync(context.Background(), []models.ExternalItem{
+		{ItemName: "Product A"},
+		{ItemName: "Product B"},
+	})
+	if err != nil {
+		t.Fatalf("CompareAndSync failed: %v", err)
+	}
+
+	if result.Updated != 1 || result.UpdatesAttempted != 2 {
+		t.Errorf("Expected 1 of 2 updates applied, got %d of %d", result.Updated, result.UpdatesAttempted)
+	}
+	if len(audit.Changes) != 1 || audit.Changes[0].ProductID != 1 {
+		t.Errorf("Expected only product 1 in the audit log, got %+v", audit.Changes)
+	}
+}
+
+// Test_SyncService_CompareAndSync_SavesRawTitles tests that unsanitized
+// titles are stored by product ID, a created product being told apart from
+// another product already holding its handle by its title
+func Test_SyncService_CompareAndSync_SavesRawTitles(t *testing.T) {
+	var saved map[int]string
+	mockRepo := &MockProductRepository{
+		GetAllProductsFunc: func(ctx context.Context) ([]models.Product, error) {
+			return []models.Product{{ID: 1, Title: "Product A", Handle: "product-a"}, {ID: 2, Title: "Product C!", Handle: "product-c"}}, nil
+		},
+		GetProductsByTitlesFunc: func(ctx context.Context, titles []string) ([]models.Product, error) {
+			return []models.Product{{ID: 2, Title: "Product C!", Handle: "product-c"}, {ID: 3, Title: "Product B", Handle: "product-b"}}, nil
+		},
+		SaveRawTitlesFunc: func(ctx context.Context, rawTitles map[int]string) error {
+			saved = rawTitles
+			return nil
+		},
+	}
+
+	_, err := NewSyncService(mockRepo).CompareAndSync(context.Background(), []models.ExternalItem{
+		{ItemName: "Product A", RawItemName: "<b>Product A</b>"},
+		{ItemName: "Product B", RawItemName: "<i>Product B</i>"},
+		{ItemName: "Product C", RawItemName: "<i>Product C</i>"},
+		{ItemName: "Product D"},
+	})
+	if err != nil {
+		t.Fatalf("CompareAndSync failed: %v", err)
+	}
+
+	want := map[int]string{1: "<b>Product A</b>", 3: "<i>Product B</i>"}
+	if !reflect.DeepEqual(saved, want) {
+		t.Errorf("Expected the raw titles %v, got %v", want, saved)
+	}
+}
+
+// Test_SyncService_CompareAndSync_ReactivatesArchived tests that archived products reappearing in the feed are reactivated
+func Test_SyncService_CompareAndSync_ReactivatesArchived(t *testing.T) {
+	var reactivated []int
+	mockRepo := &MockProductRepository{
+		GetAllProductsFunc: func(ctx context.Context) ([]models.Product, error) {
+			return []models.Product{
+				{ID: 1, Title: "Product A", Handle: "product-a", Status: models.ProductStatusArchived},
+				{ID: 2, Title: "Product B", Handle: "product-b", Status: models.ProductStatusActive},
+			}, nil
+		},
+		ReactivateProductsBatchFunc: func(ctx context.Context, ids []int) (int, error) {
+			reactivated = ids
+			return len(ids), nil
+		},
+	}
+	audit := &MockAuditRepository{}
+	service := NewSyncService(mockRepo)
+	service.SetAudit(audit, 5)
+
+	result, err := service.CompareAndSync(context.Background(), []models.ExternalItem{
+		{ItemName: "Product A"},
+		{ItemName: "Product B"},
+	})
+	if err != nil {
+		t.Fatalf("CompareAndSync failed: %v", err)
+	}
+
+	if len(reactivated) != 1 || reactivated[0] != 1 {
+		t.Errorf("Expected product 1 to be reactivated, got %v", reactivated)
+	}
+	if result.Reactivated != 1 || result.Unchanged != 1 {
+		t.Errorf("Expected 1 reactivated and 1 unchanged, got %+v", result)
+	}
+	if len(audit.Changes) != 1 || audit.Changes[0].Action != models.ChangeActionReactivate {
+		t.Errorf("Expected a reactivate audit entry, got %+v", audit.Changes)
+	}
+}
+
+// Test_SyncService_CompareAndSync_NormalizeCache tests that repeated names are normalized once per run
+func Test_SyncService_CompareAndSync_NormalizeCache(t *testing.T) {
+	mockRepo := &MockProductRepository{
+		GetAllProductsFunc: func(ctx context.Context) ([]models.Product, error) {
+			return []models.Product{{ID: 1, Title: "Variant Item", Handle: "variant-item"}}, nil
+		},
+	}
+
+	externalItems := []models.ExternalItem{
+		{ItemCode: "A1", ItemName: "Variant Item"},
+		{ItemCode: "A2", ItemName: "Variant Item"},
+		{ItemCode: "A3", ItemName: "Variant Item"},
+	}
+
+	result, err := NewSyncService(mockRepo).CompareAndSync(context.Background(), externalItems)
+	if err != nil {
+		t.Fatalf("CompareAndSync failed: %v", err)
+	}
+	if result.Performance == nil {
+		t.Fatal("Expected a performance breakdown")
+	}
+	// Only the product title and the handle of the first item miss, everything else hits
+	if result.Performance.NormalizeCacheMisses != 2 || result.Performance.NormalizeCacheHits != 5 {
+		t.Errorf("Expected 2 misses and 5 hits, got %d and %d",
+			result.Performance.NormalizeCacheMisses, result.Performance.NormalizeCacheHits)
+	}
+}
+
+// Test_SyncService_CompareAndSync_PartialCreate tests that only committed creates are counted and audited
+func Test_SyncService_CompareAndSync_PartialCreate(t *testing.T) {
+	mockRepo := &MockProductRepository{
+		CreateProductsBatchFunc: func(ctx context.Context, products []struct{ Title, Handle string }) error {
+			return &CreateBatchError{Total: len(products), Failed: []FailedCreate{
+				{Title: "Product B", Handle: "product-b", Err: errors.New("value too long")},
+			}}
+		},
+	}
+	audit := &MockAuditRepository{}
+
+	syncService := NewSyncService(mockRepo)
+	syncService.SetAudit(audit, 1)
+
+	result, err := syncService.CompareAndSync(context.Background(), []models.ExternalItem{
+		{ItemName: "Product A", ItemCode: "A001"},
+		{ItemName: "Product B", ItemCode: "B001"},
+	})
+	if err != nil {
+		t.Fatalf("CompareAndSync failed: %v", err)
+	}
+
+	if result.Created != 1 {
+		t.Errorf("Expected 1 created product, got %d", result.Created)
+	}
+	if len(result.Errors) != 1 {
+		t.Errorf("Expected the failed row to be reported, got %v", result.Errors)
+	}
+	if len(audit.Changes) != 1 || audit.Changes[0].NewHandle != "product-a" {
+		t.Errorf("Expected only product-a to be audited, got %+v", audit.Changes)
+	}
+}
+
+// Test_SyncService_CompareAndSync_RecoversPanic tests that a panicking batch write is reported as an error
+func Test_SyncService_CompareAndSync_RecoversPanic(t *testing.T) {
+	mockRepo := &MockProductRepository{
+		CreateProductsBatchFunc: func(ctx context.Context, products []struct{ Title, Handle string }) error {
+			var m map[string]int
+			m["boom"]++
+			return nil
+		},
+	}
+
+	syncService := NewSyncService(mockRepo)
+	result, err := syncService.CompareAndSync(context.Background(), []models.ExternalItem{
+		{ItemName: "Product A", ItemCode: "A001"},
+	})
+	if err != nil {
+		t.Fatalf("CompareAndSync failed: %v", err)
+	}
+
+	if result.Created != 0 {
+		t.Errorf("Expected no created products, got %d", result.Created)
+	}
+	if len(result.Errors) != 1 || !strings.HasPrefix(result.Errors[0], "batch create failed: panic:") {
+		t.Errorf("Expected the panic to be reported, got %v", result.Errors)
+	}
+}
+
+// Test_SyncService_CompareAndSync_Conflicts tests that updates carry the
+// version they were computed from and that conflicts are reported, not failed
+func Test_SyncService_CompareAndSync_Conflicts(t *testing.T) {
+	var versions []int
+	mockRepo := &MockProductRepository{
+		GetAllProductsFunc: func(ctx context.Context) ([]models.Product, error) {
+			return []models.Product{{ID: 1, Title: "Product A", Handle: "product-a", Version: 4}}, nil
+		},
+		UpdateProductsBatchFunc: func(ctx context.Context, updates []struct {
+			ID      int
+			Title   string
+			Handle  string
+			Fields  ProductFields
+			Version int
+		}) error {
+			for _, u := range updates {
+				versions = append(versions, u.Version)
+			}
+			return &UpdateConflictError{IDs: []int{1}}
+		},
+	}
+
+	result, err := NewSyncService(mockRepo).CompareAndSync(context.Background(), []models.ExternalItem{{ItemCode: "A001", ItemName: "PRODUCT A"}})
+	if err != nil {
+		t.Fatalf("CompareAndSync failed: %v", err)
+	}
+	if len(versions) != 1 || versions[0] != 4 {
+		t.Errorf("Expected the update to carry version 4, got %v", versions)
+	}
+	if len(result.Conflicts) != 1 || result.Conflicts[0] != "product-a" || len(result.Errors) != 0 || result.Updated != 0 {
+		t.Errorf("Expected a reported conflict and no error, got %+v", result)
+	}
+}
+
+// Test_SyncService_CompareAndSync_Locked tests that locked products keep
+// their title and handle and are reported as skipped
+func Test_SyncService_CompareAndSync_Locked(t *testing.T) {
+	var updated []int
+	mockRepo := &MockProductRepository{
+		GetAllProductsFunc: func(ctx context.Context) ([]models.Product, error) {
+			return []models.Product{
+				{ID: 1, Title: "Product A", Handle: "hand-tuned-a", Locked: true},
+				{ID: 2, Title: "Product B", Handle: "product-b"},
+			}, nil
+		},
+		UpdateProductsBatchFunc: func(ctx context.Context, updates []struct {
+			ID      int
+			Title   string
+			Handle  string
+			Fields  ProductFields
+			Version int
+		}) error {
+			for _, u := range updates {
+				updated = append(updated, u.ID)
+			}
+			return nil
+		},
+	}
+
+	result, err := NewSyncService(mockRepo).CompareAndSync(context.Background(), []models.ExternalItem{
+		{ItemCode: "A001", ItemName: "PRODUCT A"},
+		{ItemCode: "B001", ItemName: "PRODUCT B"},
+	})
+	if err != nil {
+		t.Fatalf("CompareAndSync failed: %v", err)
+	}
+	if len(updated) != 1 || updated[0] != 2 {
+		t.Errorf("Expected only the unlocked product to be updated, got %v", updated)
+	}
+	if result.Skipped != 1 || len(result.Locked) != 1 || result.Locked[0] != "hand-tuned-a" {
+		t.Errorf("Expected the locked product to be skipped, got %+v", result)
+	}
+}
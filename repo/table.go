@@ -0,0 +1,94 @@
+package repo
+
+import (
+	"database/sql"
+	"go-cron/models"
+	"regexp"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// productsRef matches the references to the products table in SQL written
+// against the default table
+var productsRef = regexp.MustCompile(`\b(FROM|INTO|UPDATE|JOIN|ON|EXISTS|TABLE)(\s+)products\b`)
+
+// productsIndex matches the names of the indexes of the products table, which
+// are named after the table
+var productsIndex = regexp.MustCompile(`\b(INDEX IF NOT EXISTS\s+)products_(\w+)`)
+
+// productsTable is the table the products are stored in, the products table
+// of the search path when zero. The repositories write their SQL against the
+// default table and run it through sql.
+type productsTable struct {
+	// quoted is the quoted, schema-qualified table, name and schema its
+	// unquoted name and schema
+	quoted string
+	name   string
+	schema string
+}
+
+// newProductsTable returns the table name of schema; empty values keep the
+// defaults. The identifiers are quoted, so names checked by
+// models.ValidIdentifier keep their meaning and others cannot inject SQL.
+func newProductsTable(schema, name string) productsTable {
+	if name == "" {
+		name = "products"
+	}
+	if schema == "" && name == "products" {
+		return productsTable{}
+	}
+	t := productsTable{quoted: pq.QuoteIdentifier(name), name: name, schema: schema}
+	if schema != "" {
+		t.quoted = pq.QuoteIdentifier(schema) + "." + t.quoted
+	}
+	return t
+}
+
+// String returns the table as written in SQL
+func (t productsTable) String() string {
+	if t.quoted == "" {
+		return "products"
+	}
+	return t.quoted
+}
+
+// sql returns query, written against the products table, reading and writing t
+func (t productsTable) sql(query string) string {
+	if t.quoted == "" {
+		return query
+	}
+	query = productsRef.ReplaceAllStringFunc(query, func(ref string) string {
+		return strings.TrimSuffix(ref, "products") + t.quoted
+	})
+	return productsIndex.ReplaceAllStringFunc(query, func(ref string) string {
+		m := productsIndex.FindStringSubmatch(ref)
+		return m[1] + pq.QuoteIdentifier(t.name+"_"+m[2])
+	})
+}
+
+// NewProductRepositoryFromConfig creates a product repository of the products
+// table of config
+func NewProductRepositoryFromConfig(db *sql.DB, config models.DatabaseConfig) *ProductRepository {
+	r := NewProductRepository(db)
+	r.SetTable(config.Schema, config.ProductsTable)
+	return r
+}
+
+// SetTable makes the repository read and write the products in the table
+// name of schema instead of the products table of the search path
+func (r *ProductRepository) SetTable(schema, name string) {
+	r.table = newProductsTable(schema, name)
+}
+
+// SetTable makes the repository store picture URLs on the products in the
+// table name of schema, like ProductRepository.SetTable
+func (r *MediaRepository) SetTable(schema, name string) {
+	r.table = newProductsTable(schema, name)
+}
+
+// SetTable makes the repository look up the products of changes in the table
+// name of schema, like ProductRepository.SetTable
+func (r *AuditRepository) SetTable(schema, name string) {
+	r.table = newProductsTable(schema, name)
+}
@@ -0,0 +1,65 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+)
+
+// Test_ProductsTable_SQL tests that the SQL of the repositories reads and
+// writes the configured table, leaving the other tables alone
+func Test_ProductsTable_SQL(t *testing.T) {
+	table := newProductsTable("catalog", "items")
+	tests := []struct {
+		query, want string
+	}{
+		{`SELECT id FROM products WHERE handle = $1`, `SELECT id FROM "catalog"."items" WHERE handle = $1`},
+		{`UPDATE products SET title = $1`, `UPDATE "catalog"."items" SET title = $1`},
+		{`INSERT INTO products (title) SELECT title FROM products_staging`, `INSERT INTO "catalog"."items" (title) SELECT title FROM products_staging`},
+		{`CREATE TABLE IF NOT EXISTS products (id SERIAL)`, `CREATE TABLE IF NOT EXISTS "catalog"."items" (id SERIAL)`},
+		{`ALTER TABLE products ADD COLUMN IF NOT EXISTS search_vector TSVECTOR`, `ALTER TABLE "catalog"."items" ADD COLUMN IF NOT EXISTS search_vector TSVECTOR`},
+		{`CREATE UNIQUE INDEX IF NOT EXISTS products_handle_key ON products (handle)`, `CREATE UNIQUE INDEX IF NOT EXISTS "items_handle_key" ON "catalog"."items" (handle)`},
+		{`SELECT COUNT(*) FROM products p`, `SELECT COUNT(*) FROM "catalog"."items" p`},
+		{`DELETE FROM product_images WHERE handle = $1`, `DELETE FROM product_images WHERE handle = $1`},
+	}
+	for _, tt := range tests {
+		if got := table.sql(tt.query); got != tt.want {
+			t.Errorf("sql(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+
+	for _, table := range []productsTable{{}, newProductsTable("", ""), newProductsTable("", "products")} {
+		if got := table.sql(tests[0].query); got != tests[0].query {
+			t.Errorf("Expected the default table to leave the query alone, got %q", got)
+		}
+	}
+	if got := newProductsTable("", "items").String(); got != `"items"` {
+		t.Errorf("Expected an unqualified table without a schema, got %q", got)
+	}
+}
+
+// Test_ProductRepository_EnsureSchema_Table tests that the bootstrap creates
+// the schema and the table configured
+func Test_ProductRepository_EnsureSchema_Table(t *testing.T) {
+	db, err := sql.Open("recording", "")
+	if err != nil {
+		t.Fatalf("failed to open the recording driver: %v", err)
+	}
+	defer db.Close()
+
+	recorder.execs = nil
+	r := NewProductRepository(db)
+	r.SetTable("catalog", "items")
+	if err := r.EnsureSchema(context.Background()); err != nil {
+		t.Fatalf("EnsureSchema failed: %v", err)
+	}
+	if got := recorder.execs[0].query; got != `CREATE SCHEMA IF NOT EXISTS "catalog"` {
+		t.Errorf("Expected the schema first, got %q", got)
+	}
+	for _, exec := range recorder.execs[1:] {
+		if strings.Contains(exec.query, " products ") {
+			t.Errorf("Expected the configured table, got %q", exec.query)
+		}
+	}
+}
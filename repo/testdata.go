@@ -11,32 +11,32 @@ func NewTestDataHelper() *TestDataHelper {
 }
 
 // GetMockExternalItems returns mock external API items
-func (h *TestDataHelper) GetMockExternalItems() []map[string]interface{} {
-	return []map[string]interface{}{
+func (h *TestDataHelper) GetMockExternalItems() []models.ExternalItem {
+	return []models.ExternalItem{
 		{
-			"ItemCode":       "ITEM001",
-			"ItemName":       "Premium Coffee Beans",
-			"ItemsGroupCode": 100,
+			ItemCode:       "ITEM001",
+			ItemName:       "Premium Coffee Beans",
+			ItemsGroupCode: 100,
 		},
 		{
-			"ItemCode":       "ITEM002",
-			"ItemName":       "Organic Green Tea",
-			"ItemsGroupCode": 101,
+			ItemCode:       "ITEM002",
+			ItemName:       "Organic Green Tea",
+			ItemsGroupCode: 101,
 		},
 		{
-			"ItemCode":       "ITEM003",
-			"ItemName":       "Dark Chocolate Bar",
-			"ItemsGroupCode": 121,
+			ItemCode:       "ITEM003",
+			ItemName:       "Dark Chocolate Bar",
+			ItemsGroupCode: 121,
 		},
 		{
-			"ItemCode":       "ITEM004",
-			"ItemName":       "Vanilla Extract",
-			"ItemsGroupCode": 100,
+			ItemCode:       "ITEM004",
+			ItemName:       "Vanilla Extract",
+			ItemsGroupCode: 100,
 		},
 		{
-			"ItemCode":       "ITEM005",
-			"ItemName":       "Honey Jar 500g",
-			"ItemsGroupCode": 101,
+			ItemCode:       "ITEM005",
+			ItemName:       "Honey Jar 500g",
+			ItemsGroupCode: 101,
 		},
 	}
 }
@@ -63,13 +63,13 @@ func (h *TestDataHelper) GetMockDatabaseProducts() []models.Product {
 }
 
 // GetMockExternalItemsLarge returns a large set of mock items for performance testing
-func (h *TestDataHelper) GetMockExternalItemsLarge(count int) []map[string]interface{} {
-	items := make([]map[string]interface{}, count)
+func (h *TestDataHelper) GetMockExternalItemsLarge(count int) []models.ExternalItem {
+	items := make([]models.ExternalItem, count)
 	for i := 0; i < count; i++ {
-		items[i] = map[string]interface{}{
-			"ItemCode":       formatItemCode(i),
-			"ItemName":       formatItemName(i),
-			"ItemsGroupCode": 100 + (i % 3),
+		items[i] = models.ExternalItem{
+			ItemCode:       formatItemCode(i),
+			ItemName:       formatItemName(i),
+			ItemsGroupCode: 100 + (i % 3),
 		}
 	}
 	return items
@@ -94,58 +94,53 @@ func padLeft(num int, length int) string {
 }
 
 // GetMockExternalItemsWithInvalidData returns items with various invalid data
-func (h *TestDataHelper) GetMockExternalItemsWithInvalidData() []map[string]interface{} {
-	return []map[string]interface{}{
+func (h *TestDataHelper) GetMockExternalItemsWithInvalidData() []models.ExternalItem {
+	return []models.ExternalItem{
 		{
-			"ItemCode":       "VALID001",
-			"ItemName":       "Valid Product 1",
-			"ItemsGroupCode": 100,
+			ItemCode:       "VALID001",
+			ItemName:       "Valid Product 1",
+			ItemsGroupCode: 100,
 		},
 		{
-			"ItemCode":       "INVALID001",
-			"ItemName":       "", // Invalid: empty name
-			"ItemsGroupCode": 100,
+			ItemCode:       "INVALID001",
+			ItemName:       "", // Invalid: empty name
+			ItemsGroupCode: 100,
 		},
 		{
-			"ItemCode": "INVALID002",
+			ItemCode: "INVALID002",
 			// Missing ItemName
-			"ItemsGroupCode": 100,
+			ItemsGroupCode: 100,
 		},
 		{
-			"ItemCode":       "INVALID003",
-			"ItemName":       123, // Invalid: wrong type
-			"ItemsGroupCode": 100,
-		},
-		{
-			"ItemCode":       "VALID002",
-			"ItemName":       "Valid Product 2",
-			"ItemsGroupCode": 101,
+			ItemCode:       "VALID002",
+			ItemName:       "Valid Product 2",
+			ItemsGroupCode: 101,
 		},
 	}
 }
 
 // GetMockExternalItemsWithSpecialCharacters returns items with special characters
-func (h *TestDataHelper) GetMockExternalItemsWithSpecialCharacters() []map[string]interface{} {
-	return []map[string]interface{}{
+func (h *TestDataHelper) GetMockExternalItemsWithSpecialCharacters() []models.ExternalItem {
+	return []models.ExternalItem{
 		{
-			"ItemCode": "SPECIAL001",
-			"ItemName": "Café Latté",
+			ItemCode: "SPECIAL001",
+			ItemName: "Café Latté",
 		},
 		{
-			"ItemCode": "SPECIAL002",
-			"ItemName": "Product @ #$% Special & Chars",
+			ItemCode: "SPECIAL002",
+			ItemName: "Product @ #$% Special & Chars",
 		},
 		{
-			"ItemCode": "SPECIAL003",
-			"ItemName": "Product_With_Underscores",
+			ItemCode: "SPECIAL003",
+			ItemName: "Product_With_Underscores",
 		},
 		{
-			"ItemCode": "SPECIAL004",
-			"ItemName": "Product   With   Multiple   Spaces",
+			ItemCode: "SPECIAL004",
+			ItemName: "Product   With   Multiple   Spaces",
 		},
 		{
-			"ItemCode": "SPECIAL005",
-			"ItemName": "123 Numeric Product 456",
+			ItemCode: "SPECIAL005",
+			ItemName: "123 Numeric Product 456",
 		},
 	}
 }
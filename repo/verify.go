@@ -0,0 +1,111 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"go-cron/models"
+	"log"
+)
+
+// verifyLookupBatchSize is the number of titles read back per query when the
+// service loads the whole catalog instead of looking titles up
+const verifyLookupBatchSize = 500
+
+// sampleWrites returns n of the written products spread evenly over them, or
+// all of them when n is zero or covers them all
+func sampleWrites(written []models.Product, n int) []models.Product {
+	if n <= 0 || n >= len(written) {
+		return written
+	}
+	sample := make([]models.Product, n)
+	for i := range sample {
+		sample[i] = written[i*len(written)/n]
+	}
+	return sample
+}
+
+// verifyWrites reads back the written products, or a sample of them, and
+// records the ones whose row does not hold the intended values. A create
+// skipped by ON CONFLICT shows up as a missing product, a trigger rewriting a
+// column as a mismatch. Any mismatch degrades the result.
+func (s *SyncService) verifyWrites(ctx context.Context, written []models.Product, names *normalizeCache, result *models.SyncResult) {
+	sample := sampleWrites(written, s.options.VerifySample)
+	if len(sample) == 0 {
+		return
+	}
+	verification := &models.WriteVerification{Written: len(written), Checked: len(sample)}
+	result.Verification = verification
+
+	seen := make(map[string]bool, len(sample))
+	var keys []string
+	for _, p := range sample {
+		if key := names.title(p.Title); !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	size := s.options.LookupBatchSize
+	if size <= 0 {
+		size = verifyLookupBatchSize
+	}
+	stored := make(map[string][]models.Product, len(keys))
+	for start := 0; start < len(keys); start += size {
+		end := start + size
+		if end > len(keys) {
+			end = len(keys)
+		}
+		products, err := s.repo.GetProductsByTitles(ctx, keys[start:end])
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("failed to verify writes: %v", err))
+			return
+		}
+		for _, p := range products {
+			key := names.title(p.Title)
+			stored[key] = append(stored[key], p)
+		}
+	}
+
+	for _, want := range sample {
+		if mismatch := writeMismatch(want, stored[names.title(want.Title)]); mismatch != "" {
+			verification.Mismatches = append(verification.Mismatches, mismatch)
+		}
+	}
+	if len(verification.Mismatches) > 0 {
+		result.Status = models.WorseStatus(result.Status, models.SyncStatusDegraded)
+		log.Printf("%d of %d written products read back with other values", len(verification.Mismatches), len(sample))
+	}
+}
+
+// writeMismatch compares a written product with the products stored under its
+// title key and describes the difference, or returns "" when one matches.
+// Products are told apart by ID when the write knew it, by handle otherwise.
+func writeMismatch(want models.Product, candidates []models.Product) string {
+	var got *models.Product
+	for i := range candidates {
+		if (want.ID != 0 && candidates[i].ID == want.ID) || (want.ID == 0 && candidates[i].Handle == want.Handle) {
+			got = &candidates[i]
+			break
+		}
+	}
+	if got == nil {
+		if want.ID != 0 {
+			return fmt.Sprintf("product %d (%q) was not found", want.ID, want.Title)
+		}
+		return fmt.Sprintf("product %q with handle %q was not found", want.Title, want.Handle)
+	}
+
+	name := fmt.Sprintf("product %d", got.ID)
+	switch {
+	case got.Title != want.Title:
+		return fmt.Sprintf("%s has title %q, expected %q", name, got.Title, want.Title)
+	case got.Handle != want.Handle:
+		return fmt.Sprintf("%s has handle %q, expected %q", name, got.Handle, want.Handle)
+	case got.Status != want.Status:
+		return fmt.Sprintf("%s has status %q, expected %q", name, got.Status, want.Status)
+	case want.Category != "" && got.Category != want.Category:
+		return fmt.Sprintf("%s has category %q, expected %q", name, got.Category, want.Category)
+	case want.Price != nil && productPrice(*got) != productPrice(want):
+		return fmt.Sprintf("%s has price %q, expected %q", name, productPrice(*got), productPrice(want))
+	}
+	return ""
+}
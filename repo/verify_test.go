@@ -0,0 +1,80 @@
+package repo
+
+import (
+	"context"
+	"go-cron/models"
+	"reflect"
+	"testing"
+)
+
+// Test_SyncService_CompareAndSync_VerifyWrites tests that skipped and rewritten rows are reported after the writes
+func Test_SyncService_CompareAndSync_VerifyWrites(t *testing.T) {
+	mockRepo := &MockProductRepository{
+		GetAllProductsFunc: func(ctx context.Context) ([]models.Product, error) {
+			return []models.Product{
+				{ID: 1, Title: "NEW NAME", Handle: "new-name", Status: models.ProductStatusActive},
+				{ID: 2, Title: "SHIRT XL", Handle: "shirt", Status: models.ProductStatusActive},
+			}, nil
+		},
+		// Product 2 got the new title, but a trigger rewrote its handle; the
+		// create of "Mug" was skipped by a conflicting handle
+		GetProductsByTitlesFunc: func(ctx context.Context, titles []string) ([]models.Product, error) {
+			stored := map[string]models.Product{
+				"new name":  {ID: 1, Title: "New Name", Handle: "new-name", Status: models.ProductStatusActive},
+				"shirt xl":  {ID: 2, Title: "Shirt XL", Handle: "shirt-xl-1", Status: models.ProductStatusActive},
+				"green tea": {ID: 3, Title: "Green Tea", Handle: "green-tea", Status: models.ProductStatusActive},
+			}
+			var products []models.Product
+			for _, title := range titles {
+				if p, ok := stored[title]; ok {
+					products = append(products, p)
+				}
+			}
+			return products, nil
+		},
+	}
+	syncService := NewSyncService(mockRepo)
+	opts := syncService.Options()
+	opts.VerifyWrites = true
+	syncService.SetOptions(opts)
+
+	items := []models.ExternalItem{
+		{ItemCode: "A", ItemName: "New Name"},
+		{ItemCode: "B", ItemName: "Shirt XL"},
+		{ItemCode: "C", ItemName: "Green Tea"},
+		{ItemCode: "D", ItemName: "Mug"},
+	}
+	result, err := syncService.CompareAndSync(context.Background(), items)
+	if err != nil {
+		t.Fatalf("CompareAndSync failed: %v", err)
+	}
+
+	want := &models.WriteVerification{Written: 4, Checked: 4, Mismatches: []string{
+		`product "Mug" with handle "mug" was not found`,
+		`product 2 has handle "shirt-xl-1", expected "shirt-xl"`,
+	}}
+	if !reflect.DeepEqual(result.Verification, want) {
+		t.Errorf("Expected verification %+v, got %+v", want, result.Verification)
+	}
+	if result.Status != models.SyncStatusDegraded {
+		t.Errorf("Expected a degraded sync, got %q", result.Status)
+	}
+}
+
+// Test_sampleWrites tests that samples spread over the written products
+func Test_sampleWrites(t *testing.T) {
+	written := make([]models.Product, 10)
+	for i := range written {
+		written[i].ID = i
+	}
+	var ids []int
+	for _, p := range sampleWrites(written, 3) {
+		ids = append(ids, p.ID)
+	}
+	if !reflect.DeepEqual(ids, []int{0, 3, 6}) {
+		t.Errorf("Expected products 0, 3 and 6, got %v", ids)
+	}
+	if got := sampleWrites(written, 0); len(got) != 10 {
+		t.Errorf("Expected every product without a sample size, got %d", len(got))
+	}
+}
@@ -0,0 +1,71 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"go-cron/models"
+	"time"
+)
+
+// incrementalOverlap is subtracted from the watermark of an incremental sync.
+// SAP's UpdateDate has no time of day and follows the server's timezone, so a
+// day of overlap guarantees no update is missed at the cost of a few re-syncs.
+const incrementalOverlap = 24 * time.Hour
+
+// WatermarkRepository records when each entity was last synced successfully
+type WatermarkRepository struct {
+	db *sql.DB
+}
+
+// NewWatermarkRepository creates a new watermark repository
+func NewWatermarkRepository(db *sql.DB) *WatermarkRepository {
+	return &WatermarkRepository{db: db}
+}
+
+// GetWatermark returns the watermark of entity, or nil if it was never synced successfully
+func (r *WatermarkRepository) GetWatermark(ctx context.Context, entity string) (*models.SyncWatermark, error) {
+	w := models.SyncWatermark{Entity: entity}
+	var lastFull sql.NullTime
+	err := r.db.QueryRowContext(ctx,
+		`SELECT last_sync_at, last_full_sync_at FROM sync_watermarks WHERE entity = $1`, entity).
+		Scan(&w.LastSyncAt, &lastFull)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sync watermark: %w", err)
+	}
+	w.LastSyncAt, w.LastFullSyncAt = w.LastSyncAt.UTC(), lastFull.Time.UTC()
+	return &w, nil
+}
+
+// AdvanceWatermark records a successful sync of entity started at syncedAt,
+// also moving the full sync watermark when mode is models.SyncModeFull
+func (r *WatermarkRepository) AdvanceWatermark(ctx context.Context, entity, mode string, syncedAt time.Time) error {
+	query := `
+		INSERT INTO sync_watermarks (entity, last_sync_at, last_full_sync_at)
+		VALUES ($1, $2, CASE WHEN $3 THEN $2 END)
+		ON CONFLICT (entity) DO UPDATE
+		SET last_sync_at = EXCLUDED.last_sync_at,
+		    last_full_sync_at = COALESCE(EXCLUDED.last_full_sync_at, sync_watermarks.last_full_sync_at)`
+
+	if _, err := r.db.ExecContext(ctx, query, entity, syncedAt.UTC(), mode == models.SyncModeFull); err != nil {
+		return fmt.Errorf("failed to advance sync watermark: %w", err)
+	}
+	return nil
+}
+
+// ChooseSyncMode decides whether a sync runs incrementally, and from when.
+// It falls back to a full sync when incremental mode is off, a full sync was
+// requested, nothing was synced yet, or the last full sync is older than
+// config.FullSyncEvery.
+func ChooseSyncMode(config models.SyncConfig, watermark *models.SyncWatermark, forceFull bool, now time.Time) (string, time.Time) {
+	if !config.Incremental || forceFull || watermark == nil || watermark.LastFullSyncAt.IsZero() {
+		return models.SyncModeFull, time.Time{}
+	}
+	if now.Sub(watermark.LastFullSyncAt) >= config.FullSyncEvery {
+		return models.SyncModeFull, time.Time{}
+	}
+	return models.SyncModeIncremental, watermark.LastSyncAt.Add(-incrementalOverlap)
+}
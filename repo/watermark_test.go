@@ -0,0 +1,41 @@
+package repo
+
+import (
+	"go-cron/models"
+	"testing"
+	"time"
+)
+
+// Test_ChooseSyncMode tests when syncs run incrementally and when they fall back to a full sync
+func Test_ChooseSyncMode(t *testing.T) {
+	now := time.Date(2026, 3, 10, 6, 0, 0, 0, time.UTC)
+	incremental := models.SyncConfig{Incremental: true, FullSyncEvery: 7 * 24 * time.Hour}
+	recent := &models.SyncWatermark{LastSyncAt: now.Add(-time.Hour), LastFullSyncAt: now.Add(-48 * time.Hour)}
+
+	tests := []struct {
+		name      string
+		config    models.SyncConfig
+		watermark *models.SyncWatermark
+		forceFull bool
+		wantMode  string
+	}{
+		{"incremental disabled", models.SyncConfig{}, recent, false, models.SyncModeFull},
+		{"never synced", incremental, nil, false, models.SyncModeFull},
+		{"never fully synced", incremental, &models.SyncWatermark{LastSyncAt: now}, false, models.SyncModeFull},
+		{"full requested", incremental, recent, true, models.SyncModeFull},
+		{"weekly full sync due", incremental, &models.SyncWatermark{LastSyncAt: now.Add(-time.Hour), LastFullSyncAt: now.Add(-8 * 24 * time.Hour)}, false, models.SyncModeFull},
+		{"incremental", incremental, recent, false, models.SyncModeIncremental},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mode, since := ChooseSyncMode(tt.config, tt.watermark, tt.forceFull, now)
+			if mode != tt.wantMode {
+				t.Errorf("mode = %q, want %q", mode, tt.wantMode)
+			}
+			if mode == models.SyncModeIncremental && !since.Equal(recent.LastSyncAt.Add(-incrementalOverlap)) {
+				t.Errorf("since = %v, want the last sync minus the overlap", since)
+			}
+		})
+	}
+}
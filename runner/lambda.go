@@ -0,0 +1,268 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go-cron/internal/utils"
+)
+
+// lambdaRuntimeAPI is the version prefix of the Lambda Runtime API
+const lambdaRuntimeAPI = "/2018-06-01/runtime/invocation/"
+
+// lambdaEvent holds the fields of the Lambda events the runner handles: HTTP
+// requests from a function URL or an API Gateway HTTP API (payload 2.0) or
+// REST API (payload 1.0), and scheduled events of EventBridge
+type lambdaEvent struct {
+	// Payload 2.0
+	RawPath        string   `json:"rawPath"`
+	RawQueryString string   `json:"rawQueryString"`
+	Cookies        []string `json:"cookies"`
+	RequestContext struct {
+		HTTP struct {
+			Method   string `json:"method"`
+			SourceIP string `json:"sourceIp"`
+		} `json:"http"`
+		Identity struct {
+			SourceIP string `json:"sourceIp"`
+		} `json:"identity"`
+	} `json:"requestContext"`
+	// Payload 1.0
+	HTTPMethod                      string              `json:"httpMethod"`
+	Path                            string              `json:"path"`
+	MultiValueQueryStringParameters map[string][]string `json:"multiValueQueryStringParameters"`
+	MultiValueHeaders               map[string][]string `json:"multiValueHeaders"`
+	// Both payloads
+	Headers         map[string]string `json:"headers"`
+	Body            string            `json:"body"`
+	IsBase64Encoded bool              `json:"isBase64Encoded"`
+	// EventBridge
+	Detail json.RawMessage `json:"detail"`
+}
+
+// lambdaResponse is the response of an HTTP event, understood by function
+// URLs and both API Gateway payloads
+type lambdaResponse struct {
+	StatusCode      int               `json:"statusCode"`
+	Headers         map[string]string `json:"headers"`
+	Body            string            `json:"body"`
+	IsBase64Encoded bool              `json:"isBase64Encoded"`
+}
+
+// Lambda runs the trigger of a Lambda event and returns the response to send
+// back. HTTP events are served like requests to Vercel. Any other event, such
+// as an EventBridge schedule, runs a sync with the configuration: invoking
+// the function already takes AWS credentials, so the request is given the
+// credentials of the cron secret, and the detail of the event, when it is an
+// object, is the sync request body. An allowlist of AUTH_ALLOWED_IPS must
+// include 127.0.0.1 for scheduled events.
+func (rn *Runner) Lambda(ctx context.Context, payload []byte) ([]byte, error) {
+	var event lambdaEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("invalid Lambda event: %w", err)
+	}
+	r, err := rn.lambdaRequest(ctx, event)
+	if err != nil {
+		return nil, err
+	}
+
+	w := newLambdaResponseWriter()
+	rn.ServeHTTP(w, r)
+	return json.Marshal(w.response())
+}
+
+// lambdaRequest returns the HTTP request of event
+func (rn *Runner) lambdaRequest(ctx context.Context, event lambdaEvent) (*http.Request, error) {
+	method, path, query := event.RequestContext.HTTP.Method, event.RawPath, event.RawQueryString
+	remoteIP := event.RequestContext.HTTP.SourceIP
+	if method == "" && event.HTTPMethod != "" {
+		method, path, query = event.HTTPMethod, event.Path, url.Values(event.MultiValueQueryStringParameters).Encode()
+		remoteIP = event.RequestContext.Identity.SourceIP
+	}
+	if method == "" {
+		return rn.scheduledRequest(ctx, event.Detail)
+	}
+
+	body := []byte(event.Body)
+	if event.IsBase64Encoded {
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(event.Body); err != nil {
+			return nil, fmt.Errorf("invalid Lambda event body: %w", err)
+		}
+	}
+	target := path
+	if query != "" {
+		target += "?" + query
+	}
+	r, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Lambda event request: %w", err)
+	}
+	for name, values := range event.MultiValueHeaders {
+		for _, value := range values {
+			r.Header.Add(name, value)
+		}
+	}
+	for name, value := range event.Headers {
+		if r.Header.Get(name) == "" {
+			r.Header.Set(name, value)
+		}
+	}
+	for _, cookie := range event.Cookies {
+		r.Header.Add("Cookie", cookie)
+	}
+	// The caller is the source address seen by API Gateway; an inbound
+	// X-Forwarded-For is whatever the caller sent
+	r.Header.Del("X-Forwarded-For")
+	if remoteIP != "" {
+		r.RemoteAddr = remoteIP + ":0"
+	}
+	return r, nil
+}
+
+// scheduledRequest returns the authenticated trigger of a scheduled event
+func (rn *Runner) scheduledRequest(ctx context.Context, detail json.RawMessage) (*http.Request, error) {
+	var body []byte
+	if trimmed := bytes.TrimSpace(detail); len(trimmed) > 0 && trimmed[0] == '{' && !bytes.Equal(trimmed, []byte("{}")) {
+		body = trimmed
+	}
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, "/api/index", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	r.RemoteAddr = "127.0.0.1:0"
+	utils.AuthenticateRequest(r, rn.loadConfig().Auth, body)
+	return r, nil
+}
+
+// lambdaResponseWriter buffers the response of a trigger for Lambda
+type lambdaResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newLambdaResponseWriter() *lambdaResponseWriter {
+	return &lambdaResponseWriter{header: make(http.Header)}
+}
+
+func (w *lambdaResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *lambdaResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *lambdaResponseWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(p)
+}
+
+// response returns the buffered response, base64 encoding bodies that are
+// compressed or not text
+func (w *lambdaResponseWriter) response() lambdaResponse {
+	resp := lambdaResponse{StatusCode: w.status, Headers: make(map[string]string, len(w.header))}
+	if resp.StatusCode == 0 {
+		resp.StatusCode = http.StatusOK
+	}
+	for name, values := range w.header {
+		resp.Headers[name] = strings.Join(values, ", ")
+	}
+	if w.header.Get("Content-Encoding") != "" || !utf8.Valid(w.body.Bytes()) {
+		resp.Body, resp.IsBase64Encoded = base64.StdEncoding.EncodeToString(w.body.Bytes()), true
+	} else {
+		resp.Body = w.body.String()
+	}
+	return resp
+}
+
+// StartLambda serves the invocations of a Lambda function on a custom
+// runtime (provided.al2023), reading them from the Runtime API named by
+// AWS_LAMBDA_RUNTIME_API, until ctx is done or the Runtime API fails
+func (rn *Runner) StartLambda(ctx context.Context) error {
+	api := os.Getenv("AWS_LAMBDA_RUNTIME_API")
+	if api == "" {
+		return fmt.Errorf("AWS_LAMBDA_RUNTIME_API is not set; not running in Lambda")
+	}
+	base := "http://" + api + lambdaRuntimeAPI
+	for ctx.Err() == nil {
+		if err := rn.invokeNext(ctx, base); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// invokeNext waits for the next invocation of the Runtime API at base and
+// posts its response or error
+func (rn *Runner) invokeNext(ctx context.Context, base string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+"next", nil)
+	if err != nil {
+		return err
+	}
+	// Waiting for the next invocation has no timeout
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to get the next invocation: %w", err)
+	}
+	payload, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read the next invocation: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to get the next invocation: status %d: %s", resp.StatusCode, payload)
+	}
+	requestID := resp.Header.Get("Lambda-Runtime-Aws-Request-Id")
+	if traceID := resp.Header.Get("Lambda-Runtime-Trace-Id"); traceID != "" {
+		os.Setenv("_X_AMZN_TRACE_ID", traceID)
+	}
+	// The sync ends within the timeout of the function, like it does within Vercel's
+	invokeCtx := ctx
+	if ms, err := strconv.ParseInt(resp.Header.Get("Lambda-Runtime-Deadline-Ms"), 10, 64); err == nil {
+		var cancel context.CancelFunc
+		invokeCtx, cancel = context.WithDeadline(ctx, time.UnixMilli(ms))
+		defer cancel()
+	}
+
+	result, err := rn.Lambda(invokeCtx, payload)
+	if err != nil {
+		log.Printf("Lambda invocation %s failed: %v\n", requestID, err)
+		result, _ = json.Marshal(map[string]string{"errorMessage": err.Error(), "errorType": "InvocationError"})
+		return postRuntime(ctx, base+requestID+"/error", result)
+	}
+	return postRuntime(ctx, base+requestID+"/response", result)
+}
+
+// postRuntime posts body to the Runtime API
+func postRuntime(ctx context.Context, target string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post to the Runtime API: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("failed to post to the Runtime API: status %d", resp.StatusCode)
+	}
+	return nil
+}
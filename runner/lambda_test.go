@@ -0,0 +1,94 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-cron/internal/testserver"
+	"go-cron/internal/utils"
+	"go-cron/models"
+)
+
+// setupRunner points the configuration at a fake Service Layer and a
+// database that cannot be reached, and returns the configuration
+func setupRunner(t *testing.T) *models.AppConfig {
+	t.Helper()
+	server := testserver.New()
+	t.Cleanup(server.Close)
+	server.Setenv(t)
+	t.Setenv("GO_CRON_CONFIG", "")
+	t.Setenv("CRON_SECRET", "test-secret")
+	t.Setenv("DATABASE_URL", "postgres://gocron@127.0.0.1:1/gocron?sslmode=disable&connect_timeout=1")
+	return New().loadConfig()
+}
+
+// Test_Runner_lambdaRequest tests translating the HTTP events of both API
+// Gateway payloads and scheduled events into trigger requests
+func Test_Runner_lambdaRequest(t *testing.T) {
+	config := setupRunner(t)
+	rn := New()
+
+	var v2 lambdaEvent
+	v2.RequestContext.HTTP.Method, v2.RequestContext.HTTP.SourceIP = http.MethodPost, "203.0.113.7"
+	v2.RawPath, v2.RawQueryString = "/api/index", "maxItems=5"
+	v2.Headers = map[string]string{"authorization": "Bearer test-secret", "x-forwarded-for": "10.0.0.1"}
+	v2.Body, v2.IsBase64Encoded = "eyJkcnlSdW4iOnRydWV9", true
+	r, err := rn.lambdaRequest(context.Background(), v2)
+	if err != nil {
+		t.Fatalf("lambdaRequest failed: %v", err)
+	}
+	body, _ := io.ReadAll(r.Body)
+	if r.Method != http.MethodPost || r.URL.Query().Get("maxItems") != "5" || string(body) != `{"dryRun":true}` ||
+		r.RemoteAddr != "203.0.113.7:0" || r.Header.Get("X-Forwarded-For") != "" || !utils.Authenticate(r, config.Auth) {
+		t.Errorf("Unexpected request of a payload 2.0 event: %s %s %q from %s", r.Method, r.URL, body, r.RemoteAddr)
+	}
+
+	v1 := lambdaEvent{HTTPMethod: http.MethodGet, Path: "/api/index", MultiValueQueryStringParameters: map[string][]string{"full": {"true"}}}
+	if r, err := rn.lambdaRequest(context.Background(), v1); err != nil || r.Method != http.MethodGet || r.URL.Query().Get("full") != "true" {
+		t.Errorf("Unexpected request of a payload 1.0 event: %v %v", r, err)
+	}
+
+	scheduled := lambdaEvent{Detail: json.RawMessage(`{"maxItems":10}`)}
+	r, err = rn.lambdaRequest(context.Background(), scheduled)
+	if err != nil {
+		t.Fatalf("lambdaRequest failed: %v", err)
+	}
+	body, _ = io.ReadAll(r.Body)
+	if r.Method != http.MethodPost || string(body) != `{"maxItems":10}` || !utils.Authenticate(r, config.Auth) {
+		t.Errorf("Expected an authenticated trigger of the scheduled event, got %s %q", r.Method, body)
+	}
+}
+
+// Test_Runner_invokeNext tests serving an invocation of the Runtime API
+func Test_Runner_invokeNext(t *testing.T) {
+	setupRunner(t)
+
+	var response lambdaResponse
+	runtime := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case lambdaRuntimeAPI + "next":
+			w.Header().Set("Lambda-Runtime-Aws-Request-Id", "req-1")
+			w.Write([]byte(`{"rawPath":"/api/index","requestContext":{"http":{"method":"POST"}},"headers":{"authorization":"Bearer wrong"}}`))
+		case lambdaRuntimeAPI + "req-1/response":
+			if err := json.NewDecoder(r.Body).Decode(&response); err != nil {
+				t.Errorf("Invalid response: %v", err)
+			}
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			t.Errorf("Unexpected Runtime API request %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer runtime.Close()
+
+	if err := New().invokeNext(context.Background(), runtime.URL+lambdaRuntimeAPI); err != nil {
+		t.Fatalf("invokeNext failed: %v", err)
+	}
+	if response.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected the unauthorized trigger to answer 401, got %+v", response)
+	}
+}
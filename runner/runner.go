@@ -0,0 +1,433 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-cron/config"
+	"go-cron/engine"
+	"go-cron/external"
+	"go-cron/internal/recovery"
+	"go-cron/internal/utils"
+	"go-cron/models"
+	"go-cron/notify"
+	"go-cron/repo"
+	"go-cron/sinks"
+	"go-cron/tracing"
+)
+
+// Runner runs the syncs of the trigger endpoint: it authenticates the
+// trigger, applies its options, runs the engine and records, notifies and
+// answers the run. It holds the whole orchestration of a run, so hosting the
+// trigger elsewhere than on Vercel only takes an adapter translating the
+// invocations of the platform into HTTP requests, like Lambda.
+type Runner struct {
+	loadConfig func() *models.AppConfig
+}
+
+// New creates a runner reading the configuration of every trigger from the
+// environment and the config file
+func New() *Runner {
+	return &Runner{loadConfig: config.LoadConfig}
+}
+
+// SetConfigLoader replaces how the configuration of a trigger is read, for
+// platforms keeping the settings elsewhere than in the environment
+func (rn *Runner) SetConfigLoader(load func() *models.AppConfig) {
+	rn.loadConfig = load
+}
+
+// ServeHTTP runs a sync for the trigger r
+func (rn *Runner) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Verbose results of large catalogs compress well; deferred first so the
+	// gzip stream ends after a recovered panic is answered
+	w, finishResponse := utils.CompressResponse(w, r)
+	defer finishResponse()
+	defer utils.RecoverPanic(w)
+	startTime := utils.Now()
+
+	// --- 1. Security Check ---
+	config := rn.loadConfig()
+	if !utils.Authenticate(r, config.Auth) {
+		log.Println("Unauthorized access attempt.")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !utils.ConfigValid(w, config) {
+		return
+	}
+	// Scripts ask for NDJSON and operators for plain text; JSON stays the default
+	format := utils.NegotiateFormat(r, utils.FormatJSON, utils.FormatText, utils.FormatNDJSON)
+	if format == "" {
+		utils.WriteError(w, http.StatusNotAcceptable, "Acceptable formats: application/json, text/plain, application/x-ndjson")
+		return
+	}
+	verbose, _ := strconv.ParseBool(r.URL.Query().Get("verbose"))
+	db, ok := utils.Database(w, config)
+	if !ok {
+		return
+	}
+	if config, ok = utils.ProfileConfig(w, r, config, db); !ok {
+		return
+	}
+	if config.Profile != "" {
+		log.Printf("Syncing with profile %q\n", config.Profile)
+	}
+	// A JSON body overrides the configuration for this run
+	request, err := syncRequest(w, r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid sync options: "+err.Error())
+		return
+	}
+	if config, err = request.Apply(config); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid sync options: "+err.Error())
+		return
+	}
+	names := request.Destinations
+	if names == nil && len(config.Sinks.Destinations) > 0 {
+		names = config.Sinks.Destinations
+	}
+	destinations, err := sinks.Select(sinks.FromConfig(config, repo.NewSinkMappingRepository(db)), names)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid sync options: "+err.Error())
+		return
+	}
+
+	// Create context with timeout
+	// Spans of the run join the trace of the caller, if it sent one
+	ctx, cancel := context.WithTimeout(tracing.Extract(r.Context(), r.Header), config.Sync.Timeout)
+	defer cancel()
+
+	// Refuse new work while shutting down so in-flight syncs can drain
+	done, err := utils.BeginSync()
+	if err != nil {
+		utils.WriteFailure(w, http.StatusServiceUnavailable, models.ErrorCodeShuttingDown, "Service is shutting down")
+		return
+	}
+	defer done()
+
+	// Initialize the sync engine
+	eng := engine.New(config, db)
+	eng.SetClock(utils.Now)
+	if config.Database.Driver == models.DatabaseDriverPgx {
+		pool, err := utils.PgxPool(config)
+		if err != nil {
+			log.Printf("Database unavailable: %v\n", err)
+			utils.WriteFailure(w, http.StatusServiceUnavailable, models.ErrorCodeDatabase, "Database unavailable")
+			return
+		}
+		eng.UsePgx(pool)
+	}
+	// While the external API is down, invocations in the backoff window exit before logging in
+	var backoffErr *engine.BackoffError
+	if err := eng.CheckBackoff(ctx); errors.As(err, &backoffErr) {
+		log.Println(backoffErr)
+		w.Header().Set("Retry-After", strconv.Itoa(int(backoffErr.Until.Sub(utils.Now()).Seconds())+1))
+		utils.WriteFailure(w, http.StatusServiceUnavailable, models.ErrorCodeCircuitOpen, backoffErr.Error())
+		return
+	}
+	runRepo := repo.NewRunRepository(db)
+	outboxRepo := repo.NewOutboxRepository(db)
+	fanOut := sinks.NewFanOut(outboxRepo, destinations...)
+	eng.SetOutbox(outboxRepo, fanOut.Names())
+
+	notifier, err := notify.NewFromConfig(ctx, config, repo.NewNotificationTemplateRepository(db), repo.NewDigestRepository(db))
+	if err != nil {
+		log.Printf("Notifications disabled: %v\n", err)
+		notifier = notify.NewDispatcher(nil)
+	}
+
+	// A retried trigger with the same Idempotency-Key gets the stored response instead of a second sync
+	idempotencyRepo := repo.NewIdempotencyRepository(db)
+	idempotencyRepo.SetClock(utils.Now)
+	idempotencyKey := strings.TrimSpace(r.Header.Get(models.IdempotencyKeyHeader))
+	if len(idempotencyKey) > 255 {
+		utils.WriteError(w, http.StatusBadRequest, "Idempotency-Key must be at most 255 characters")
+		return
+	}
+	if idempotencyKey != "" {
+		record, err := idempotencyRepo.Reserve(ctx, idempotencyKey, config.Sync.IdempotencyTTL, config.Sync.Timeout)
+		if errors.Is(err, repo.ErrIdempotencyInProgress) {
+			utils.WriteError(w, http.StatusConflict, "A sync with this Idempotency-Key is in progress")
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to reserve idempotency key: %v\n", err)
+			utils.WriteError(w, http.StatusInternalServerError, "Failed to check Idempotency-Key")
+			return
+		}
+		if record != nil {
+			log.Printf("Replaying response of idempotency key %q from %s\n", idempotencyKey, record.CreatedAt.Format(time.RFC3339))
+			w.Header().Set(models.IdempotencyReplayedHeader, "true")
+			var replay models.TriggerResponse
+			if err := json.Unmarshal(record.Response, &replay); err != nil {
+				utils.WriteRawJSON(w, record.StatusCode, record.Response)
+				return
+			}
+			utils.WriteTriggerResponse(w, record.StatusCode, replay, format, verbose)
+			return
+		}
+		// Failed and incomplete syncs are not stored, so a retry runs them again
+		defer func() {
+			if idempotencyKey == "" {
+				return
+			}
+			if err := idempotencyRepo.Release(context.Background(), idempotencyKey); err != nil {
+				log.Printf("Failed to release idempotency key: %v\n", err)
+			}
+		}()
+	}
+
+	// With sharding each invocation syncs the next pending shard of the current
+	// cycle; dry runs preview the whole catalog instead
+	shardRepo := repo.NewShardRepository(db)
+	shardRepo.SetClock(utils.Now)
+	var shard *models.ShardAssignment
+	if config.Sync.Shards > 1 && !request.DryRun {
+		requested := utils.QueryInt(r, "shard", -1, -1, config.Sync.Shards-1)
+		shard, err = shardRepo.ClaimShard(ctx, config.Sync.Shards, requested, config.Sync.Timeout)
+		if errors.Is(err, repo.ErrNoShardAvailable) {
+			utils.WriteError(w, http.StatusConflict, "No shard available: every shard of the current cycle is done or running")
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to claim shard: %v\n", err)
+			utils.WriteError(w, http.StatusInternalServerError, "Failed to claim shard")
+			return
+		}
+		log.Printf("Claimed shard %d/%d of cycle %d\n", shard.Shard+1, shard.Shards, shard.CycleID)
+	}
+
+	// Record the run up front so its changes can be audited, and finish it
+	// whatever the outcome. Dry runs leave no trace in the run history.
+	run := &models.SyncRun{Entity: models.EntityProducts, Trigger: models.RunTriggerHTTP, StartedAt: startTime.UTC()}
+	if !request.DryRun {
+		if _, err := runRepo.StartRun(ctx, run); err != nil {
+			log.Printf("Failed to start sync run, its changes will not be audited: %v\n", err)
+		}
+	}
+	// finishShard records the shard outcome once, reporting the cycle progress
+	var shardProgress *models.ShardProgress
+	finishShard := func() {
+		if shard == nil {
+			return
+		}
+		progress, err := shardRepo.FinishShard(context.Background(), *shard, run.ID, run.Status, run.Result)
+		if err != nil {
+			log.Printf("Failed to record shard %d: %v\n", shard.Shard, err)
+		} else if progress.Complete {
+			log.Printf("Shard cycle %d complete - Created: %d, Updated: %d, Unchanged: %d\n",
+				progress.CycleID, progress.Report.Created, progress.Report.Updated, progress.Report.Unchanged)
+		}
+		shard, shardProgress = nil, progress
+	}
+	defer func() {
+		run.FinishedAt = utils.Now().UTC()
+		finishShard()
+		if run.ID != 0 {
+			if err := runRepo.FinishRun(context.Background(), run); err != nil {
+				log.Printf("Failed to record sync run: %v\n", err)
+			}
+		}
+		if request.DryRun {
+			return
+		}
+		notifier.Notify(context.Background(), models.RunSummary{
+			Run:      run.In(config.Display.Location),
+			Duration: run.FinishedAt.Sub(run.StartedAt),
+			Timezone: config.Display.Timezone,
+		})
+	}()
+	// A panic fails the run before it is recorded and notified above;
+	// RecoverPanic then answers the request
+	defer func() {
+		if err := recovery.Error(recover()); err != nil {
+			run.Status, run.Error = models.SyncStatusFailed, err.Error()
+			panic(err)
+		}
+	}()
+
+	// Fetch the items and sync them; ?full=true forces a full sync when incremental ones are enabled
+	forceFull, _ := strconv.ParseBool(r.URL.Query().Get("full"))
+	// A named profile syncs part of the catalog, such as some item groups
+	partial := request.Partial() || config.Profile != ""
+	report, err := eng.Run(ctx, engine.Options{
+		ForceFull: forceFull,
+		DryRun:    request.DryRun,
+		RunID:     run.ID,
+		Shard:     shard,
+		MaxItems:  request.MaxItems,
+		Sample:    request.Sample,
+		Partial:   partial,
+		Confirm:   request.Confirm,
+	})
+	if err != nil {
+		run.Status, run.Error, run.Result = models.SyncStatusFailed, err.Error(), report.Result
+		var stageErr *engine.StageError
+		if !errors.As(err, &stageErr) {
+			stageErr = &engine.StageError{Stage: engine.StageSync, Err: err}
+		}
+		switch stageErr.Stage {
+		case engine.StagePreflight:
+			log.Printf("Preflight failed: %v\n", stageErr.Err)
+			status, code := fetchFailure(stageErr.Err)
+			if code == models.ErrorCodeUpstreamError {
+				code = models.ErrorCodePreflight
+			}
+			utils.WriteFailure(w, status, code, fmt.Sprintf("Preflight failed: %v", stageErr.Err))
+		case engine.StageFetch:
+			log.Printf("Fetch failed: %v\n", stageErr.Err)
+			status, code := fetchFailure(stageErr.Err)
+			utils.WriteFailure(w, status, code, fmt.Sprintf("Fetch failed: %v", stageErr.Err))
+		case engine.StageFeedCheck:
+			// The failed run triggers the alert
+			log.Printf("Sync aborted: %v\n", stageErr.Err)
+			utils.WriteFailure(w, http.StatusBadGateway, models.ErrorCodeFeedCheck, fmt.Sprintf("Sync aborted: %v", stageErr.Err))
+		default:
+			log.Printf("Sync failed: %v\n", stageErr.Err)
+			utils.WriteFailure(w, http.StatusInternalServerError, models.ErrorCodeSync, fmt.Sprintf("Sync failed: %v", stageErr.Err))
+		}
+		return
+	}
+	fetched, syncResult := report.Fetched, report.Result
+	run.Status, run.Result = syncResult.Status, syncResult
+
+	// Deliver queued changes to downstream sinks
+	var sinkResults []models.SinkDispatchResult
+	if !request.DryRun {
+		sinkResults = fanOut.Dispatch(ctx)
+		syncResult.Pushed = sinks.Pushed(sinkResults, syncResult.Changes)
+	}
+
+	duration := utils.Now().Sub(startTime)
+	log.Printf("Sync completed in %v - Status: %s, Created: %d, Updated: %d, Reactivated: %d, Unchanged: %d, Deadlock retries: %d\n",
+		duration, syncResult.Status, syncResult.Created, syncResult.Updated, syncResult.Reactivated, syncResult.Unchanged, eng.Products().DeadlockRetries())
+
+	finishShard()
+
+	// A sync cut short by the deadline still reports what it applied
+	message := "Successfully synchronized data from external API"
+	// Changes out of proportion with the catalog wait for a confirmed run
+	if guard := syncResult.Guard; guard != nil && !guard.Confirmed && !request.DryRun {
+		message = "Sync held back by the change guard; send confirm to apply the changes"
+		if guard.PlanID != 0 {
+			message = fmt.Sprintf("Sync held back by the change guard; POST /api/sync/%d/approve to apply the changes", guard.PlanID)
+		}
+	}
+
+	// Return response, keeping it with the changed handles for replays of the
+	// same Idempotency-Key in any format
+	response := models.TriggerResponse{
+		Message:      message,
+		TotalItems:   fetched.TotalCount,
+		ItemsFetched: len(fetched.Items),
+		SyncResult:   syncResult,
+		Sinks:        sinkResults,
+		Shard:        shardProgress,
+		StartedAt:    startTime.In(config.Display.Location).Format(time.RFC3339),
+		Duration:     duration.String(),
+		Timings:      triggerTimings(fetched, syncResult, duration),
+		Handles:      &syncResult.Handles,
+	}
+	// A sync that ran into problems answers 207 with their categories, so callers can alert on them
+	statusCode := utils.TriggerOutcome(&response, request.DryRun)
+	if statusCode == http.StatusMultiStatus {
+		response.Message = "Synchronized data from external API with errors"
+	}
+	stored, err := json.Marshal(response)
+	if err != nil {
+		log.Printf("Failed to encode response: %v\n", err)
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to encode response")
+		return
+	}
+	if idempotencyKey != "" {
+		// Only completed syncs are replayed: a retry of one cut short by its
+		// deadline or held back by the change guard runs again
+		if statusCode >= http.StatusOK && statusCode < http.StatusMultipleChoices {
+			if err := idempotencyRepo.Complete(context.Background(), idempotencyKey, statusCode, stored); err != nil {
+				log.Printf("Failed to store idempotent response: %v\n", err)
+			} else {
+				idempotencyKey = ""
+			}
+		}
+		if _, err := idempotencyRepo.PurgeIdempotencyKeys(context.Background(), config.Sync.IdempotencyTTL); err != nil {
+			log.Printf("Failed to purge idempotency keys: %v\n", err)
+		}
+	}
+	utils.WriteTriggerResponse(w, statusCode, response, format, verbose)
+}
+
+// fetchFailure returns the HTTP status and error code of a failure to fetch
+// the items: 503 while the external API is down, 504 when the fetch ran out
+// of time and 502 when the external API rejected a request
+func fetchFailure(err error) (int, string) {
+	switch {
+	case external.IsCircuitOpen(err):
+		// The recorded failure skips the next runs until its backoff ends
+		return http.StatusServiceUnavailable, models.ErrorCodeCircuitOpen
+	case external.IsUnavailable(err):
+		return http.StatusServiceUnavailable, models.ErrorCodeUpstreamUnavailable
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, models.ErrorCodeTimedOut
+	default:
+		return http.StatusBadGateway, models.ErrorCodeUpstreamError
+	}
+}
+
+// syncRequest decodes the optional JSON body of a trigger and its query
+// options. A trigger without either, like the ones sent by Vercel Cron, runs
+// with the configuration.
+func syncRequest(w http.ResponseWriter, r *http.Request) (models.SyncRequest, error) {
+	var request models.SyncRequest
+	if r.Body != nil {
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+			return request, err
+		}
+	}
+	return request, syncQuery(r, &request)
+}
+
+// syncQuery applies the ?maxItems= and ?sample= options of r over those of
+// the request body, so a cron URL can cap or sample its runs
+func syncQuery(r *http.Request, request *models.SyncRequest) error {
+	query := r.URL.Query()
+	if v := query.Get("maxItems"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("maxItems must be a number, got %q", v)
+		}
+		request.MaxItems = n
+	}
+	if v := query.Get("sample"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("sample must be a number, got %q", v)
+		}
+		request.Sample = f
+	}
+	return nil
+}
+
+// triggerTimings returns the timings of a trigger that took total: the steps
+// of its fetch and the diff and writes of its sync
+func triggerTimings(fetched *external.FetchResult, result *models.SyncResult, total time.Duration) *models.Timings {
+	var timings models.Timings
+	if fetched.Timings != nil {
+		timings = *fetched.Timings
+	}
+	if perf := result.Performance; perf != nil {
+		timings.DiffMs, timings.DBWriteMs = perf.DiffMs, perf.DBWriteMs
+	}
+	timings.TotalMs = total.Milliseconds()
+	return &timings
+}
@@ -0,0 +1,61 @@
+package runner
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-cron/external"
+	"go-cron/models"
+)
+
+// Test_SyncRequest_Query tests that the query options override the body and are checked
+func Test_SyncRequest_Query(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/api?maxItems=50&sample=0.1", strings.NewReader(`{"maxItems":10,"dryRun":true}`))
+	request, err := syncRequest(httptest.NewRecorder(), r)
+	if err != nil {
+		t.Fatalf("syncRequest failed: %v", err)
+	}
+	if request.MaxItems != 50 || request.Sample != 0.1 || !request.DryRun || !request.Partial() {
+		t.Errorf("Expected a partial dry run of 50 items sampled at 0.1, got %+v", request)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/api?sample=all", nil)
+	if _, err := syncRequest(httptest.NewRecorder(), r); err == nil {
+		t.Error("Expected an invalid sample to be rejected")
+	}
+	if _, err := (models.SyncRequest{Sample: 1.5}).Apply(&models.AppConfig{}); err == nil {
+		t.Error("Expected a sample above 1 to be rejected")
+	}
+	if _, err := (models.SyncRequest{Workers: models.MaxRequestWorkers + 1}).Apply(&models.AppConfig{}); err == nil {
+		t.Error("Expected workers above the cap to be rejected")
+	}
+	if _, err := (models.SyncRequest{PageSize: models.MaxRequestPageSize + 1}).Apply(&models.AppConfig{}); err == nil {
+		t.Error("Expected a page size above the cap to be rejected")
+	}
+}
+
+// Test_triggerTimings tests that the timings combine the steps of the fetch
+// and of the sync
+func Test_triggerTimings(t *testing.T) {
+	fetched := &external.FetchResult{Timings: &models.Timings{LoginMs: 100, CountMs: 20, FetchMs: 3000,
+		Pages: &models.PageTimings{Count: 2, MinMs: 1000, AvgMs: 1500, MaxMs: 2000}}}
+	result := &models.SyncResult{}
+	result.AddTimings(400*time.Millisecond, 900*time.Millisecond)
+
+	got := triggerTimings(fetched, result, 5*time.Second)
+	want := models.Timings{LoginMs: 100, CountMs: 20, FetchMs: 3000, Pages: fetched.Timings.Pages, DiffMs: 400, DBWriteMs: 900, TotalMs: 5000}
+	if *got != want {
+		t.Errorf("Expected %+v, got %+v", want, *got)
+	}
+	if fetched.Timings.TotalMs != 0 {
+		t.Error("Expected the timings of the fetch to be left alone")
+	}
+
+	got = triggerTimings(&external.FetchResult{}, &models.SyncResult{}, time.Second)
+	if *got != (models.Timings{TotalMs: 1000}) {
+		t.Errorf("Expected only the total without steps, got %+v", *got)
+	}
+}
@@ -0,0 +1,360 @@
+package sinks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go-cron/models"
+	"go-cron/repo"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ShopifySinkName is the name of the Shopify sink in the outbox
+const ShopifySinkName = "shopify"
+
+// Pushed returns how many of the changes a run queued a dispatch delivered to
+// Shopify; the backlog of earlier runs it delivered too is not counted
+func Pushed(results []models.SinkDispatchResult, changes []int64) int {
+	queued := make(map[int64]bool, len(changes))
+	for _, id := range changes {
+		queued[id] = true
+	}
+	pushed := 0
+	for _, r := range results {
+		if r.Sink != ShopifySinkName {
+			continue
+		}
+		for _, id := range r.Changes {
+			if queued[id] {
+				pushed++
+			}
+		}
+	}
+	return pushed
+}
+
+// maxShopifyAttempts bounds how often a throttled or failed request is sent
+const maxShopifyAttempts = 4
+
+// shopifyRetryDelay is the wait before retrying a request that gave no Retry-After, growing with every attempt
+var shopifyRetryDelay = time.Second
+
+// ShopifySink pushes product changes to the Shopify Admin GraphQL API with
+// productSet, keyed by the product's Shopify ID when it is known and by its
+// handle otherwise. Requests are spaced to the configured rate and retried
+// when Shopify throttles them or fails.
+type ShopifySink struct {
+	endpoint string
+	token    string
+	client   *http.Client
+	ids      *repo.IDMapCache
+	limiter  *rateLimiter
+}
+
+// NewShopifySink creates a sink for the shop (e.g. my-store.myshopify.com)
+// sending at most perSecond requests per second. Shopify IDs are remembered
+// in ids.
+func NewShopifySink(shop, token, apiVersion string, perSecond float64, ids *repo.IDMapCache) *ShopifySink {
+	return &ShopifySink{
+		endpoint: "https://" + shop + "/admin/api/" + apiVersion + "/graphql.json",
+		token:    token,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		ids:      ids,
+		limiter:  newRateLimiter(perSecond),
+	}
+}
+
+// Name returns the sink name
+func (s *ShopifySink) Name() string {
+	return ShopifySinkName
+}
+
+const productSetMutation = `
+mutation productSet($identifier: ProductSetIdentifiers, $input: ProductSetInput!) {
+  productSet(identifier: $identifier, input: $input, synchronous: true) {
+    product { id }
+    userErrors { field message }
+  }
+}`
+
+const productDeleteMutation = `
+mutation productDelete($input: ProductDeleteInput!) {
+  productDelete(input: $input) {
+    deletedProductId
+    userErrors { field message }
+  }
+}`
+
+const productByHandleQuery = `
+query productByHandle($identifier: ProductIdentifierInput!) {
+  productByIdentifier(identifier: $identifier) { id }
+}`
+
+// Deliver pushes the change to Shopify. Archived products are archived in
+// Shopify too; deleted ones are deleted. Products Shopify does not know are
+// skipped when archived or deleted.
+func (s *ShopifySink) Deliver(ctx context.Context, change models.Change) error {
+	id, err := s.resolve(ctx, change)
+	if err != nil {
+		return err
+	}
+
+	switch change.Action {
+	case models.ChangeActionDelete:
+		if id == "" {
+			return nil
+		}
+		var data struct {
+			ProductDelete struct {
+				UserErrors []shopifyUserError `json:"userErrors"`
+			} `json:"productDelete"`
+		}
+		if err := s.graphql(ctx, productDeleteMutation, map[string]any{"input": map[string]any{"id": id}}, &data); err != nil {
+			return err
+		}
+		if err := userErrors(data.ProductDelete.UserErrors); err != nil {
+			return err
+		}
+		if change.ProductID != 0 {
+			return s.ids.Forget(ctx, ShopifySinkName, change.ProductID)
+		}
+		return nil
+
+	case models.ChangeActionArchive:
+		if id == "" {
+			return nil
+		}
+		return s.set(ctx, change, id, map[string]any{"status": "ARCHIVED"})
+
+	default:
+		return s.set(ctx, change, id, map[string]any{"title": change.Title, "handle": change.Handle, "status": "ACTIVE"})
+	}
+}
+
+// resolve returns the Shopify ID of the changed product, from the ID map or
+// by its handle, or "" when Shopify does not know it. A renamed product is
+// looked up by the handle Shopify last got first.
+func (s *ShopifySink) resolve(ctx context.Context, change models.Change) (string, error) {
+	if change.ProductID != 0 {
+		id, ok, err := s.ids.Lookup(ctx, ShopifySinkName, change.ProductID)
+		if err != nil || ok {
+			return id, err
+		}
+	}
+
+	if change.OldHandle != "" && change.OldHandle != change.Handle {
+		id, err := s.byHandle(ctx, change.OldHandle)
+		if err != nil || id != "" {
+			return id, err
+		}
+	}
+	return s.byHandle(ctx, change.Handle)
+}
+
+// byHandle returns the Shopify ID of the product with handle, or "" when
+// Shopify does not know it
+func (s *ShopifySink) byHandle(ctx context.Context, handle string) (string, error) {
+	var data struct {
+		ProductByIdentifier *struct {
+			ID string `json:"id"`
+		} `json:"productByIdentifier"`
+	}
+	vars := map[string]any{"identifier": map[string]any{"handle": handle}}
+	if err := s.graphql(ctx, productByHandleQuery, vars, &data); err != nil {
+		return "", err
+	}
+	if data.ProductByIdentifier == nil {
+		return "", nil
+	}
+	return data.ProductByIdentifier.ID, nil
+}
+
+// set creates or updates a product with productSet and remembers its Shopify ID
+func (s *ShopifySink) set(ctx context.Context, change models.Change, id string, input map[string]any) error {
+	identifier := map[string]any{"handle": change.Handle}
+	if id != "" {
+		identifier = map[string]any{"id": id}
+	}
+
+	var data struct {
+		ProductSet struct {
+			Product *struct {
+				ID string `json:"id"`
+			} `json:"product"`
+			UserErrors []shopifyUserError `json:"userErrors"`
+		} `json:"productSet"`
+	}
+	if err := s.graphql(ctx, productSetMutation, map[string]any{"identifier": identifier, "input": input}, &data); err != nil {
+		return err
+	}
+	if err := userErrors(data.ProductSet.UserErrors); err != nil {
+		return err
+	}
+	if data.ProductSet.Product == nil {
+		return fmt.Errorf("shopify productSet returned no product for %s", change.Handle)
+	}
+	if change.ProductID != 0 && data.ProductSet.Product.ID != id {
+		return s.ids.Store(ctx, ShopifySinkName, change.ProductID, data.ProductSet.Product.ID)
+	}
+	return nil
+}
+
+// shopifyUserError is a validation error of a Shopify mutation
+type shopifyUserError struct {
+	Field   []string `json:"field"`
+	Message string   `json:"message"`
+}
+
+// userErrors turns the validation errors of a mutation into an error
+func userErrors(errs []shopifyUserError) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	messages := make([]string, len(errs))
+	for i, e := range errs {
+		messages[i] = e.Message
+		if len(e.Field) > 0 {
+			messages[i] = strings.Join(e.Field, ".") + ": " + e.Message
+		}
+	}
+	return fmt.Errorf("shopify rejected the product: %s", strings.Join(messages, "; "))
+}
+
+// shopifyResponse is the envelope of a GraphQL response
+type shopifyResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string `json:"message"`
+		Extensions struct {
+			Code string `json:"code"`
+		} `json:"extensions"`
+	} `json:"errors"`
+}
+
+// retryableShopifyError is a throttled or failed request worth sending again
+type retryableShopifyError struct {
+	err   error
+	after time.Duration
+}
+
+func (e *retryableShopifyError) Error() string {
+	return e.err.Error()
+}
+
+// graphql sends a query, retrying throttled and failed requests, and decodes its data into out
+func (s *ShopifySink) graphql(ctx context.Context, query string, variables map[string]any, out any) error {
+	body, err := json.Marshal(map[string]any{"query": query, "variables": variables})
+	if err != nil {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := s.send(ctx, body, out)
+		retryable, ok := err.(*retryableShopifyError)
+		if !ok {
+			return err
+		}
+		if attempt == maxShopifyAttempts {
+			return retryable.err
+		}
+
+		wait := retryable.after
+		if wait <= 0 {
+			wait = time.Duration(attempt) * shopifyRetryDelay
+		}
+		log.Printf("Shopify request failed (attempt %d), retrying in %v: %v", attempt, wait, retryable.err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// send sends a single request once the rate limiter allows it
+func (s *ShopifySink) send(ctx context.Context, body []byte, out any) error {
+	if err := s.limiter.wait(ctx); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Shopify-Access-Token", s.token)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return &retryableShopifyError{err: err}
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		after, _ := strconv.ParseFloat(resp.Header.Get("Retry-After"), 64)
+		return &retryableShopifyError{
+			err:   fmt.Errorf("shopify failed with status %d: %s", resp.StatusCode, string(respBody)),
+			after: time.Duration(after * float64(time.Second)),
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("shopify failed with status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	var envelope shopifyResponse
+	if err := json.Unmarshal(respBody, &envelope); err != nil {
+		return fmt.Errorf("invalid shopify response: %w", err)
+	}
+	if len(envelope.Errors) > 0 {
+		err := fmt.Errorf("shopify error: %s", envelope.Errors[0].Message)
+		if envelope.Errors[0].Extensions.Code == "THROTTLED" {
+			return &retryableShopifyError{err: err}
+		}
+		return err
+	}
+	return json.Unmarshal(envelope.Data, out)
+}
+
+// rateLimiter spaces requests evenly to a maximum rate
+type rateLimiter struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// newRateLimiter creates a limiter allowing perSecond requests per second; zero or less disables it
+func newRateLimiter(perSecond float64) *rateLimiter {
+	l := &rateLimiter{}
+	if perSecond > 0 {
+		l.interval = time.Duration(float64(time.Second) / perSecond)
+	}
+	return l
+}
+
+// wait blocks until the next request may be sent or ctx is done
+func (l *rateLimiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(time.Until(at)):
+		return nil
+	}
+}
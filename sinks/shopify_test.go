@@ -0,0 +1,152 @@
+package sinks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go-cron/models"
+	"go-cron/repo"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mockMappings is an in-memory implementation of repo.SinkMappingRepositoryInterface for testing
+type mockMappings map[int]string
+
+func (m mockMappings) GetSinkMapping(ctx context.Context, sink string, productID int) (*models.SinkMapping, error) {
+	id, ok := m[productID]
+	if !ok {
+		return nil, nil
+	}
+	return &models.SinkMapping{ProductID: productID, Sink: sink, ExternalID: id}, nil
+}
+
+func (m mockMappings) SaveSinkMapping(ctx context.Context, mapping models.SinkMapping) error {
+	m[mapping.ProductID] = mapping.ExternalID
+	return nil
+}
+
+func (m mockMappings) DeleteSinkMapping(ctx context.Context, sink string, productID int) error {
+	delete(m, productID)
+	return nil
+}
+
+// Test_ShopifySink_Deliver tests pushing a change with productSet, retrying a throttled request
+func Test_ShopifySink_Deliver(t *testing.T) {
+	defer func(delay time.Duration) { shopifyRetryDelay = delay }(shopifyRetryDelay)
+	shopifyRetryDelay = time.Millisecond
+
+	var sets, throttled int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Shopify-Access-Token") != "token" {
+			t.Errorf("Expected the access token, got %q", r.Header.Get("X-Shopify-Access-Token"))
+		}
+		var req struct {
+			Query     string                     `json:"query"`
+			Variables map[string]json.RawMessage `json:"variables"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("Invalid request: %v", err)
+		}
+
+		switch {
+		case strings.Contains(req.Query, "productByIdentifier"):
+			fmt.Fprint(w, `{"data":{"productByIdentifier":null}}`)
+		case strings.Contains(req.Query, "productSet"):
+			if throttled == 0 {
+				throttled++
+				fmt.Fprint(w, `{"errors":[{"message":"Throttled","extensions":{"code":"THROTTLED"}}]}`)
+				return
+			}
+			sets++
+			if string(req.Variables["identifier"]) != `{"handle":"blue-shirt"}` {
+				t.Errorf("Expected an unknown product to be set by handle, got %s", req.Variables["identifier"])
+			}
+			fmt.Fprint(w, `{"data":{"productSet":{"product":{"id":"gid://shopify/Product/1"},"userErrors":[]}}}`)
+		default:
+			t.Errorf("Unexpected query %s", req.Query)
+		}
+	}))
+	defer server.Close()
+
+	mappings := mockMappings{}
+	sink := NewShopifySink("shop", "token", "2025-01", 0, repo.NewIDMapCache(mappings, 10))
+	sink.endpoint = server.URL
+
+	change := models.Change{Action: models.ChangeActionUpdate, ProductID: 7, Title: "Blue Shirt", Handle: "blue-shirt"}
+	if err := sink.Deliver(context.Background(), change); err != nil {
+		t.Fatalf("Deliver failed: %v", err)
+	}
+	if throttled != 1 || sets != 1 {
+		t.Errorf("Expected the throttled productSet to be retried once, got %d throttled and %d sets", throttled, sets)
+	}
+	if mappings[7] != "gid://shopify/Product/1" {
+		t.Errorf("Expected the Shopify ID to be remembered, got %q", mappings[7])
+	}
+
+	// Unknown products are not created just to be archived
+	archive := models.Change{Action: models.ChangeActionArchive, Title: "Red Shirt", Handle: "red-shirt"}
+	if err := sink.Deliver(context.Background(), archive); err != nil {
+		t.Fatalf("Deliver failed: %v", err)
+	}
+	if sets != 1 {
+		t.Errorf("Expected no productSet for an unknown archived product, got %d", sets)
+	}
+}
+
+// Test_ShopifySink_Deliver_OldHandle tests that a renamed product without a
+// mapping is found by the handle Shopify last got
+func Test_ShopifySink_Deliver_OldHandle(t *testing.T) {
+	var lookups []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Query     string                     `json:"query"`
+			Variables map[string]json.RawMessage `json:"variables"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("Invalid request: %v", err)
+		}
+
+		switch {
+		case strings.Contains(req.Query, "productByIdentifier"):
+			lookups = append(lookups, string(req.Variables["identifier"]))
+			if string(req.Variables["identifier"]) == `{"handle":"old-shirt"}` {
+				fmt.Fprint(w, `{"data":{"productByIdentifier":{"id":"gid://shopify/Product/2"}}}`)
+				return
+			}
+			fmt.Fprint(w, `{"data":{"productByIdentifier":null}}`)
+		case strings.Contains(req.Query, "productSet"):
+			if string(req.Variables["identifier"]) != `{"id":"gid://shopify/Product/2"}` {
+				t.Errorf("Expected the renamed product to be set by ID, got %s", req.Variables["identifier"])
+			}
+			fmt.Fprint(w, `{"data":{"productSet":{"product":{"id":"gid://shopify/Product/2"},"userErrors":[]}}}`)
+		}
+	}))
+	defer server.Close()
+
+	sink := NewShopifySink("shop", "token", "2025-01", 0, repo.NewIDMapCache(mockMappings{}, 10))
+	sink.endpoint = server.URL
+
+	change := models.Change{Action: models.ChangeActionUpdate, ProductID: 8, Title: "New Shirt", Handle: "new-shirt", OldHandle: "old-shirt"}
+	if err := sink.Deliver(context.Background(), change); err != nil {
+		t.Fatalf("Deliver failed: %v", err)
+	}
+	if len(lookups) != 1 || lookups[0] != `{"handle":"old-shirt"}` {
+		t.Errorf("Expected a single lookup by the old handle, got %v", lookups)
+	}
+}
+
+// Test_Pushed tests counting the changes of a run delivered to Shopify,
+// leaving out the backlog delivered with them
+func Test_Pushed(t *testing.T) {
+	results := []models.SinkDispatchResult{
+		{Sink: "webhook", Delivered: 2, Changes: []int64{1, 2}},
+		{Sink: ShopifySinkName, Delivered: 3, Failed: 1, Changes: []int64{1, 2, 3}},
+	}
+	if got := Pushed(results, []int64{2, 3, 4}); got != 2 {
+		t.Errorf("Expected 2 pushed changes, got %d", got)
+	}
+}
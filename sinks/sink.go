@@ -0,0 +1,168 @@
+package sinks
+
+import (
+	"context"
+	"fmt"
+	"go-cron/internal/recovery"
+	"go-cron/models"
+	"go-cron/repo"
+	"log"
+	"sync"
+)
+
+// dispatchBatchSize is the number of pending deliveries fetched per round trip
+const dispatchBatchSize = 100
+
+// Sink is a downstream system that receives product changes from the outbox
+type Sink interface {
+	Name() string
+	Deliver(ctx context.Context, change models.Change) error
+}
+
+// FromConfig builds the list of sinks enabled in the configuration; push
+// sinks remember the IDs of their objects in mappings
+func FromConfig(config *models.AppConfig, mappings repo.SinkMappingRepositoryInterface) []Sink {
+	var sinks []Sink
+	if config.Sinks.WebhookURL != "" {
+		webhook := NewWebhookSink("webhook", config.Sinks.WebhookURL)
+		webhook.SetSecret(config.Sinks.WebhookSecret)
+		sinks = append(sinks, webhook)
+	}
+	if config.Sinks.ShopifyShop != "" {
+		ids := repo.NewIDMapCache(mappings, config.Sinks.IDMapCacheSize)
+		sinks = append(sinks, NewShopifySink(config.Sinks.ShopifyShop, config.Sinks.ShopifyAccessToken,
+			config.Sinks.ShopifyAPIVersion, config.Sinks.ShopifyRateLimit, ids))
+	}
+	return sinks
+}
+
+// Select returns the sinks named in names, in that order, or every sink when
+// names is nil. Naming a sink that is not configured is an error.
+func Select(sinks []Sink, names []string) ([]Sink, error) {
+	if names == nil {
+		return sinks, nil
+	}
+	byName := make(map[string]Sink, len(sinks))
+	for _, s := range sinks {
+		byName[s.Name()] = s
+	}
+	selected := make([]Sink, 0, len(names))
+	for _, name := range names {
+		s, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("sink %q is not configured", name)
+		}
+		selected = append(selected, s)
+	}
+	return selected, nil
+}
+
+// FanOut delivers outbox changes to every sink independently, so a failing
+// sink never blocks or re-sends to the others
+type FanOut struct {
+	outbox repo.OutboxRepositoryInterface
+	sinks  map[string]Sink
+	names  []string
+}
+
+// NewFanOut creates a new fan-out dispatcher
+func NewFanOut(outbox repo.OutboxRepositoryInterface, sinks ...Sink) *FanOut {
+	f := &FanOut{outbox: outbox, sinks: make(map[string]Sink, len(sinks))}
+	for _, s := range sinks {
+		f.sinks[s.Name()] = s
+		f.names = append(f.names, s.Name())
+	}
+	return f
+}
+
+// Names returns the names of the configured sinks
+func (f *FanOut) Names() []string {
+	return f.names
+}
+
+// Dispatch delivers pending changes to all sinks concurrently
+func (f *FanOut) Dispatch(ctx context.Context) []models.SinkDispatchResult {
+	results := make([]models.SinkDispatchResult, len(f.names))
+
+	var wg sync.WaitGroup
+	for i, name := range f.names {
+		wg.Add(1)
+		go func(i int, sink Sink) {
+			defer wg.Done()
+			// A panicking sink fails its own delivery only
+			defer func() {
+				if err := recovery.Error(recover()); err != nil {
+					results[i] = models.SinkDispatchResult{Sink: sink.Name(), Error: err.Error()}
+				}
+			}()
+			results[i] = f.dispatch(ctx, sink)
+		}(i, f.sinks[name])
+	}
+	wg.Wait()
+
+	return results
+}
+
+// DispatchSink delivers pending changes to a single sink
+func (f *FanOut) DispatchSink(ctx context.Context, name string) (models.SinkDispatchResult, error) {
+	sink, ok := f.sinks[name]
+	if !ok {
+		return models.SinkDispatchResult{}, fmt.Errorf("unknown sink %q", name)
+	}
+	return f.dispatch(ctx, sink), nil
+}
+
+// RetrySink re-queues the failed deliveries of one sink and dispatches them,
+// without re-sending anything to the other sinks
+func (f *FanOut) RetrySink(ctx context.Context, name string) (models.SinkDispatchResult, error) {
+	if _, ok := f.sinks[name]; !ok {
+		return models.SinkDispatchResult{}, fmt.Errorf("unknown sink %q", name)
+	}
+
+	reset, err := f.outbox.ResetFailed(ctx, name)
+	if err != nil {
+		return models.SinkDispatchResult{Sink: name}, err
+	}
+	log.Printf("Retrying %d failed deliveries to %s", reset, name)
+
+	return f.DispatchSink(ctx, name)
+}
+
+// dispatch drains the pending deliveries of a sink; failed deliveries are
+// marked as such and left for an explicit retry
+func (f *FanOut) dispatch(ctx context.Context, sink Sink) models.SinkDispatchResult {
+	result := models.SinkDispatchResult{Sink: sink.Name()}
+
+	for {
+		deliveries, err := f.outbox.PendingDeliveries(ctx, sink.Name(), dispatchBatchSize)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+
+		for _, d := range deliveries {
+			if err := sink.Deliver(ctx, d.Change); err != nil {
+				result.Failed++
+				if markErr := f.outbox.MarkFailed(ctx, d.Change.ID, sink.Name(), err.Error()); markErr != nil {
+					result.Error = markErr.Error()
+					return result
+				}
+				continue
+			}
+
+			result.Delivered++
+			result.Changes = append(result.Changes, d.Change.ID)
+			if err := f.outbox.MarkDelivered(ctx, d.Change.ID, sink.Name()); err != nil {
+				result.Error = err.Error()
+				return result
+			}
+		}
+
+		if len(deliveries) < dispatchBatchSize {
+			break
+		}
+	}
+
+	log.Printf("Sink %s: delivered %d, failed %d", sink.Name(), result.Delivered, result.Failed)
+	return result
+}
@@ -0,0 +1,193 @@
+package sinks
+
+import (
+	"context"
+	"errors"
+	"go-cron/models"
+	"go-cron/webhooksig"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// MockOutbox is an in-memory implementation of repo.OutboxRepositoryInterface for testing
+type MockOutbox struct {
+	mu         sync.Mutex
+	deliveries []*models.Delivery
+}
+
+func (m *MockOutbox) EnqueueChanges(ctx context.Context, changes []models.Change, sinks []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, c := range changes {
+		c.ID = int64(len(m.deliveries) + i + 1)
+		changes[i].ID = c.ID
+		for _, sink := range sinks {
+			m.deliveries = append(m.deliveries, &models.Delivery{Change: c, Sink: sink, Status: models.DeliveryPending})
+		}
+	}
+	return nil
+}
+
+func (m *MockOutbox) PendingDeliveries(ctx context.Context, sink string, limit int) ([]models.Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var pending []models.Delivery
+	for _, d := range m.deliveries {
+		if d.Sink == sink && d.Status == models.DeliveryPending && len(pending) < limit {
+			pending = append(pending, *d)
+		}
+	}
+	return pending, nil
+}
+
+func (m *MockOutbox) MarkDelivered(ctx context.Context, changeID int64, sink string) error {
+	return m.setStatus(changeID, sink, models.DeliveryDelivered)
+}
+
+func (m *MockOutbox) MarkFailed(ctx context.Context, changeID int64, sink string, reason string) error {
+	return m.setStatus(changeID, sink, models.DeliveryFailed)
+}
+
+func (m *MockOutbox) ResetFailed(ctx context.Context, sink string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	reset := 0
+	for _, d := range m.deliveries {
+		if d.Sink == sink && d.Status == models.DeliveryFailed {
+			d.Status = models.DeliveryPending
+			reset++
+		}
+	}
+	return reset, nil
+}
+
+func (m *MockOutbox) SinkLag(ctx context.Context) ([]models.SinkLag, error) {
+	return nil, nil
+}
+
+func (m *MockOutbox) setStatus(changeID int64, sink, status string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, d := range m.deliveries {
+		if d.Change.ID == changeID && d.Sink == sink {
+			d.Status = status
+			d.Attempts++
+		}
+	}
+	return nil
+}
+
+// recordingSink records delivered changes and can be told to fail
+type recordingSink struct {
+	name      string
+	fail      bool
+	mu        sync.Mutex
+	delivered []models.Change
+}
+
+func (s *recordingSink) Name() string { return s.name }
+
+func (s *recordingSink) Deliver(ctx context.Context, change models.Change) error {
+	if s.fail {
+		return errors.New("sink unavailable")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delivered = append(s.delivered, change)
+	return nil
+}
+
+// Test_FanOut_TracksStatusPerSink tests that a failing sink does not affect the others
+func Test_FanOut_TracksStatusPerSink(t *testing.T) {
+	ctx := context.Background()
+	outbox := &MockOutbox{}
+	healthy := &recordingSink{name: "search"}
+	broken := &recordingSink{name: "shopify", fail: true}
+
+	fanOut := NewFanOut(outbox, healthy, broken)
+	_ = outbox.EnqueueChanges(ctx, []models.Change{
+		{Action: models.ChangeActionCreate, Title: "Product A", Handle: "product-a"},
+		{Action: models.ChangeActionCreate, Title: "Product B", Handle: "product-b"},
+	}, fanOut.Names())
+
+	results := fanOut.Dispatch(ctx)
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 sink results, got %d", len(results))
+	}
+	if results[0].Delivered != 2 || results[0].Failed != 0 {
+		t.Errorf("Expected search to deliver 2 changes, got %+v", results[0])
+	}
+	if results[1].Delivered != 0 || results[1].Failed != 2 {
+		t.Errorf("Expected shopify to fail 2 changes, got %+v", results[1])
+	}
+}
+
+// Test_Select tests choosing the destinations of a run by name
+func Test_Select(t *testing.T) {
+	webhook, shopify := &recordingSink{name: "webhook"}, &recordingSink{name: "shopify"}
+	all := []Sink{webhook, shopify}
+
+	if selected, err := Select(all, nil); err != nil || len(selected) != 2 {
+		t.Errorf("Expected every sink without names, got %v (%v)", selected, err)
+	}
+	if selected, err := Select(all, []string{}); err != nil || len(selected) != 0 {
+		t.Errorf("Expected no sink with an empty list, got %v (%v)", selected, err)
+	}
+	if selected, err := Select(all, []string{"shopify"}); err != nil || len(selected) != 1 || selected[0] != shopify {
+		t.Errorf("Expected only shopify, got %v (%v)", selected, err)
+	}
+	if _, err := Select(all, []string{"search"}); err == nil {
+		t.Error("Expected an error for a sink that is not configured")
+	}
+}
+
+// Test_FanOut_RetrySinkOnlyResendsToThatSink tests retrying a single sink
+func Test_FanOut_RetrySinkOnlyResendsToThatSink(t *testing.T) {
+	ctx := context.Background()
+	outbox := &MockOutbox{}
+	healthy := &recordingSink{name: "search"}
+	broken := &recordingSink{name: "shopify", fail: true}
+
+	fanOut := NewFanOut(outbox, healthy, broken)
+	_ = outbox.EnqueueChanges(ctx, []models.Change{
+		{Action: models.ChangeActionUpdate, ProductID: 1, Title: "Product A", Handle: "product-a"},
+	}, fanOut.Names())
+	fanOut.Dispatch(ctx)
+
+	broken.fail = false
+	result, err := fanOut.RetrySink(ctx, "shopify")
+	if err != nil {
+		t.Fatalf("RetrySink failed: %v", err)
+	}
+
+	if result.Delivered != 1 {
+		t.Errorf("Expected 1 redelivered change, got %d", result.Delivered)
+	}
+	if len(healthy.delivered) != 1 {
+		t.Errorf("Expected search to receive the change exactly once, got %d", len(healthy.delivered))
+	}
+	if _, err := fanOut.RetrySink(ctx, "unknown"); err == nil {
+		t.Error("Expected an error for an unknown sink")
+	}
+}
+
+func TestWebhookSink_SignsDeliveries(t *testing.T) {
+	var verifyErr error
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		verifyErr = webhooksig.VerifySignature("secret", r.Header.Get(webhooksig.Header), body)
+	}))
+	defer server.Close()
+
+	sink := NewWebhookSink("webhook", server.URL)
+	sink.SetSecret("secret")
+	if err := sink.Deliver(context.Background(), models.Change{Action: models.ChangeActionCreate, Title: "A", Handle: "a"}); err != nil {
+		t.Fatalf("Deliver failed: %v", err)
+	}
+	if verifyErr != nil {
+		t.Errorf("Receiver rejected the signature: %v", verifyErr)
+	}
+}
@@ -0,0 +1,70 @@
+package sinks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go-cron/models"
+	"go-cron/webhooksig"
+	"io"
+	"net/http"
+	"time"
+)
+
+// WebhookSink posts every change as JSON to a configured URL
+type WebhookSink struct {
+	name   string
+	url    string
+	secret string
+	client *http.Client
+}
+
+// NewWebhookSink creates a new webhook sink
+func NewWebhookSink(name, url string) *WebhookSink {
+	return &WebhookSink{
+		name:   name,
+		url:    url,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// SetSecret makes the sink sign every request with secret (see package webhooksig)
+func (s *WebhookSink) SetSecret(secret string) {
+	s.secret = secret
+}
+
+// Name returns the sink name
+func (s *WebhookSink) Name() string {
+	return s.name
+}
+
+// Deliver posts the change to the webhook URL
+func (s *WebhookSink) Deliver(ctx context.Context, change models.Change) error {
+	body, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.secret != "" {
+		req.Header.Set(webhooksig.Header, webhooksig.Sign(s.secret, body, time.Now()))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("webhook failed with status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	return nil
+}
@@ -0,0 +1,151 @@
+package sources
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"go-cron/external"
+	"go-cron/models"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CSVSource reads the items from a CSV export, e.g. to onboard a catalog
+// before Service Layer access is ready. The first row names the columns:
+// ItemCode and ItemName are required, ItemsGroupCode is optional. The file is
+// taken as the catalog as is; ITEMS_FILTER and ITEMS_GROUP_CODES do not apply.
+type CSVSource struct {
+	path     string
+	sanitize models.SanitizeConfig
+}
+
+// NewCSVSource creates a source reading the CSV file at path on every fetch
+func NewCSVSource(path string, sanitize models.SanitizeConfig) *CSVSource {
+	return &CSVSource{path: path, sanitize: sanitize}
+}
+
+// Name returns the source name
+func (s *CSVSource) Name() string {
+	return models.SourceCSV
+}
+
+// FetchAll reads every item of the file
+func (s *CSVSource) FetchAll(ctx context.Context) (*external.FetchResult, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open item file: %w", err)
+	}
+	defer f.Close()
+
+	items, invalid, err := ReadCSVItems(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read item file %s: %w", s.path, err)
+	}
+	external.SanitizeItems(items, s.sanitize)
+	return &external.FetchResult{Items: items, TotalCount: len(items) + countItems(invalid), Invalid: invalid}, nil
+}
+
+// FetchUpdatedSince reads every item of the file; a CSV export has no update dates
+func (s *CSVSource) FetchUpdatedSince(ctx context.Context, since time.Time) (*external.FetchResult, error) {
+	return s.FetchAll(ctx)
+}
+
+// FetchByCodes reads the items among codes, in the order of codes
+func (s *CSVSource) FetchByCodes(ctx context.Context, codes []string) (*external.FetchResult, error) {
+	all, err := s.FetchAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byCode := make(map[string]models.ExternalItem, len(all.Items))
+	for _, item := range all.Items {
+		byCode[item.ItemCode] = item
+	}
+	wanted := make(map[string]bool, len(codes))
+	result := &external.FetchResult{}
+	for _, code := range codes {
+		wanted[code] = true
+		if item, ok := byCode[code]; ok {
+			result.Items = append(result.Items, item)
+		}
+	}
+	for _, invalid := range all.Invalid {
+		if wanted[invalid.ItemCode] {
+			result.Invalid = append(result.Invalid, invalid)
+		}
+	}
+	result.TotalCount = len(result.Items)
+	return result, nil
+}
+
+// ReadCSVItems decodes the items of a CSV export. Rows with an empty
+// ItemCode or a non-numeric ItemsGroupCode are skipped and reported, so a
+// single malformed row never fails the whole file. A missing header or
+// required column is an error.
+func ReadCSVItems(r io.Reader) ([]models.ExternalItem, []models.ItemValidationError, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil, errors.New("missing header row")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	codeCol, okCode := columns["itemcode"]
+	nameCol, okName := columns["itemname"]
+	if !okCode || !okName {
+		return nil, nil, errors.New("header must name the ItemCode and ItemName columns")
+	}
+	groupCol, okGroup := columns["itemsgroupcode"]
+
+	var items []models.ExternalItem
+	var invalid []models.ItemValidationError
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		field := func(col int) string {
+			if col < len(record) {
+				return strings.TrimSpace(record[col])
+			}
+			return ""
+		}
+
+		item := models.ExternalItem{ItemCode: field(codeCol), ItemName: field(nameCol)}
+		if item.ItemCode == "" {
+			invalid = append(invalid, models.ItemValidationError{ItemCode: fmt.Sprintf("row %d", row), Field: "ItemCode", Message: "is empty"})
+			continue
+		}
+		if raw := field(groupCol); okGroup && raw != "" {
+			if item.ItemsGroupCode, err = strconv.Atoi(raw); err != nil {
+				invalid = append(invalid, models.ItemValidationError{ItemCode: item.ItemCode, Field: "ItemsGroupCode", Message: fmt.Sprintf("expected an integer, got %q", raw)})
+				continue
+			}
+		}
+		items = append(items, item)
+	}
+	return items, invalid, nil
+}
+
+// countItems returns the number of distinct items among validation errors
+func countItems(invalid []models.ItemValidationError) int {
+	seen := make(map[string]bool, len(invalid))
+	for _, e := range invalid {
+		seen[e.ItemCode] = true
+	}
+	return len(seen)
+}
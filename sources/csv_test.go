@@ -0,0 +1,70 @@
+package sources
+
+import (
+	"context"
+	"go-cron/models"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Test_ReadCSVItems tests decoding a CSV export, reporting malformed rows
+func Test_ReadCSVItems(t *testing.T) {
+	data := "\ufeffitemcode, ItemName ,ItemsGroupCode\n" +
+		"A1,Blue Shirt,100\n" +
+		",No Code,100\n" +
+		"A2,Red Shirt,shirts\n" +
+		"A3,Hat\n"
+
+	items, invalid, err := ReadCSVItems(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("ReadCSVItems failed: %v", err)
+	}
+
+	want := []models.ExternalItem{
+		{ItemCode: "A1", ItemName: "Blue Shirt", ItemsGroupCode: 100},
+		{ItemCode: "A3", ItemName: "Hat"},
+	}
+	if len(items) != len(want) {
+		t.Fatalf("Expected %d items, got %+v", len(want), items)
+	}
+	for i := range want {
+		if !reflect.DeepEqual(items[i], want[i]) {
+			t.Errorf("Expected item %d to be %+v, got %+v", i, want[i], items[i])
+		}
+	}
+	if len(invalid) != 2 || invalid[0].ItemCode != "row 3" || invalid[1].ItemCode != "A2" || invalid[1].Field != "ItemsGroupCode" {
+		t.Errorf("Expected the empty code and the bad group code to be reported, got %+v", invalid)
+	}
+
+	if _, _, err := ReadCSVItems(strings.NewReader("Code,Name\nA1,Shirt\n")); err == nil {
+		t.Error("Expected an error for a header without ItemCode and ItemName")
+	}
+}
+
+// Test_CSVSource_FetchByCodes tests reading selected items in the order asked for
+func Test_CSVSource_FetchByCodes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "items.csv")
+	if err := os.WriteFile(path, []byte("ItemCode,ItemName\nA1,Shirt\nA2,Hat\nA3,Scarf\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	source := NewCSVSource(path, models.SanitizeConfig{})
+
+	fetched, err := source.FetchByCodes(context.Background(), []string{"A3", "missing", "A1"})
+	if err != nil {
+		t.Fatalf("FetchByCodes failed: %v", err)
+	}
+	if len(fetched.Items) != 2 || fetched.Items[0].ItemCode != "A3" || fetched.Items[1].ItemCode != "A1" {
+		t.Errorf("Expected A3 then A1, got %+v", fetched.Items)
+	}
+
+	all, err := source.FetchAll(context.Background())
+	if err != nil {
+		t.Fatalf("FetchAll failed: %v", err)
+	}
+	if all.TotalCount != 3 {
+		t.Errorf("Expected 3 items, got %d", all.TotalCount)
+	}
+}
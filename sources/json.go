@@ -0,0 +1,47 @@
+package sources
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-cron/external"
+	"go-cron/models"
+	"io"
+)
+
+// ReadJSONItems decodes the items of a JSON export: an array of items, or a
+// Service Layer page holding them in "value". Like ReadCSVItems, items with an
+// empty ItemCode or a field of the wrong type are skipped and reported.
+func ReadJSONItems(r io.Reader) ([]models.ExternalItem, []models.ItemValidationError, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	var raw []json.RawMessage
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var page struct {
+			Value []json.RawMessage `json:"value"`
+		}
+		if err := json.Unmarshal(trimmed, &page); err != nil {
+			return nil, nil, err
+		}
+		if page.Value == nil {
+			return nil, nil, errors.New(`expected an array of items or an object with a "value" array`)
+		}
+		raw = page.Value
+	} else if err := json.Unmarshal(trimmed, &raw); err != nil {
+		return nil, nil, err
+	}
+
+	decoded, invalid := external.DecodeItems(raw)
+	items := decoded[:0]
+	for _, item := range decoded {
+		if item.ItemCode == "" {
+			invalid = append(invalid, models.ItemValidationError{ItemCode: fmt.Sprintf("item %q", item.ItemName), Field: "ItemCode", Message: "is empty"})
+			continue
+		}
+		items = append(items, item)
+	}
+	return items, invalid, nil
+}
@@ -0,0 +1,37 @@
+package sources
+
+import (
+	"strings"
+	"testing"
+)
+
+// Test_ReadJSONItems tests decoding arrays and Service Layer pages of items,
+// reporting malformed ones
+func Test_ReadJSONItems(t *testing.T) {
+	array := `[
+		{"ItemCode": "A1", "ItemName": "Blue Shirt", "ItemsGroupCode": 100},
+		{"ItemCode": "", "ItemName": "No Code"},
+		{"ItemCode": "A2", "ItemName": "Red Shirt", "ItemsGroupCode": "shirts"}
+	]`
+	items, invalid, err := ReadJSONItems(strings.NewReader(array))
+	if err != nil {
+		t.Fatalf("ReadJSONItems failed: %v", err)
+	}
+	if len(items) != 1 || items[0].ItemCode != "A1" || items[0].ItemsGroupCode != 100 {
+		t.Errorf("Expected only A1, got %+v", items)
+	}
+	if len(invalid) != 2 || invalid[0].ItemCode != "A2" || invalid[1].ItemCode != `item "No Code"` {
+		t.Errorf("Expected the bad group code and the empty code to be reported, got %+v", invalid)
+	}
+
+	items, _, err = ReadJSONItems(strings.NewReader(`{"value": [{"ItemCode": "B1", "ItemName": "Hat"}]}`))
+	if err != nil || len(items) != 1 || items[0].ItemName != "Hat" {
+		t.Errorf("Expected the item of the page, got %+v (%v)", items, err)
+	}
+
+	for _, bad := range []string{`{"items": []}`, `not json`} {
+		if _, _, err := ReadJSONItems(strings.NewReader(bad)); err == nil {
+			t.Errorf("Expected an error for %s", bad)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package sources
+
+import (
+	"context"
+	"go-cron/external"
+	"go-cron/models"
+	"time"
+)
+
+// SAPSource fetches the items from the SAP Service Layer with the configured
+// filter, pagination and timeouts
+type SAPSource struct {
+	config *models.AppConfig
+}
+
+// NewSAPSource creates a Service Layer source for the configuration
+func NewSAPSource(config *models.AppConfig) *SAPSource {
+	return &SAPSource{config: config}
+}
+
+// Name returns the source name
+func (s *SAPSource) Name() string {
+	return models.SourceSAP
+}
+
+// FetchAll fetches every item matching the configured filter
+func (s *SAPSource) FetchAll(ctx context.Context) (*external.FetchResult, error) {
+	return external.FetchAllItems(ctx, s.config)
+}
+
+// FetchUpdatedSince fetches the items created or updated on or after the day of since
+func (s *SAPSource) FetchUpdatedSince(ctx context.Context, since time.Time) (*external.FetchResult, error) {
+	return external.FetchItemsUpdatedSince(ctx, s.config, since)
+}
+
+// FetchByCodes fetches the items among codes that match the configured filter
+func (s *SAPSource) FetchByCodes(ctx context.Context, codes []string) (*external.FetchResult, error) {
+	return external.FetchItemsByCodes(ctx, s.config, codes)
+}
+
+// Preflight checks the selected and mapped fields on a single item, keeping
+// its session for the fetch that follows
+func (s *SAPSource) Preflight(ctx context.Context) error {
+	return external.Preflight(ctx, s.config)
+}
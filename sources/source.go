@@ -0,0 +1,37 @@
+package sources
+
+import (
+	"context"
+	"go-cron/external"
+	"go-cron/models"
+	"time"
+)
+
+// Source is an upstream system the items of a sync are read from. Every
+// source feeds the same pipeline: the feed check, CompareAndSync and the
+// outbox behave the same whatever the origin of the items.
+type Source interface {
+	Name() string
+	// FetchAll returns every item of the catalog
+	FetchAll(ctx context.Context) (*external.FetchResult, error)
+	// FetchUpdatedSince returns at least the items created or updated on or
+	// after since; sources that cannot tell may return the whole catalog
+	FetchUpdatedSince(ctx context.Context, since time.Time) (*external.FetchResult, error)
+	// FetchByCodes returns the items among codes, in the order of codes
+	FetchByCodes(ctx context.Context, codes []string) (*external.FetchResult, error)
+}
+
+// Preflighter is implemented by sources that can check their setup on a
+// single item before a full fetch
+type Preflighter interface {
+	Preflight(ctx context.Context) error
+}
+
+// FromConfig builds the source selected in the configuration. Unknown kinds
+// are rejected by cfg.Validate; the Service Layer is the default.
+func FromConfig(config *models.AppConfig) Source {
+	if config.Source.Kind == models.SourceCSV {
+		return NewCSVSource(config.Source.CSVFile, config.Sanitize)
+	}
+	return NewSAPSource(config)
+}
@@ -0,0 +1,127 @@
+package tracing
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+
+	"go-cron/models"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxQueuedSpans bounds the spans kept between flushes; later spans are dropped
+const maxQueuedSpans = 4096
+
+// flushThreshold is the number of queued spans that triggers a background flush
+const flushThreshold = 512
+
+// provider is the OpenTelemetry SDK exporting the spans of one configuration
+type provider struct {
+	config models.TracingConfig
+	sdk    *sdktrace.TracerProvider
+	tracer trace.Tracer
+}
+
+// current is the provider spans are sent to, nil while tracing is disabled
+var (
+	currentMu sync.RWMutex
+	current   *provider
+)
+
+// currentTracer returns the tracer of the current provider, or nil
+func currentTracer() trace.Tracer {
+	currentMu.RLock()
+	defer currentMu.RUnlock()
+	if current == nil {
+		return nil
+	}
+	return current.tracer
+}
+
+// Configure exports spans as described by config from now on. An empty
+// endpoint disables tracing. Configuring the settings already in use keeps the
+// queued spans; other settings flush them to the previous endpoint first.
+func Configure(config models.TracingConfig) {
+	currentMu.Lock()
+	defer currentMu.Unlock()
+	if current != nil && config.Endpoint != "" && sameConfig(current.config, config) {
+		return
+	}
+	if current != nil {
+		go shutdown(current.sdk)
+		current = nil
+	}
+	if config.Endpoint == "" {
+		return
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(), exporterOptions(config)...)
+	if err != nil {
+		log.Printf("Tracing disabled, invalid exporter settings: %v\n", err)
+		return
+	}
+	sdk := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter,
+			sdktrace.WithMaxQueueSize(maxQueuedSpans),
+			sdktrace.WithMaxExportBatchSize(flushThreshold)),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", config.ServiceName))),
+	)
+	current = &provider{config: config, sdk: sdk, tracer: sdk.Tracer("go-cron/tracing")}
+}
+
+// exporterOptions returns the OTLP/HTTP exporter settings of config
+func exporterOptions(config models.TracingConfig) []otlptracehttp.Option {
+	headers := make(map[string]string, len(config.Headers))
+	for _, header := range config.Headers {
+		if name, value, ok := strings.Cut(header, "="); ok {
+			headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+	}
+	return []otlptracehttp.Option{
+		otlptracehttp.WithEndpointURL(tracesURL(config.Endpoint)),
+		otlptracehttp.WithHeaders(headers),
+		otlptracehttp.WithTimeout(config.Timeout),
+		// Functions flush before they return; retrying a failed export would hold them up
+		otlptracehttp.WithRetry(otlptracehttp.RetryConfig{Enabled: false}),
+	}
+}
+
+// shutdown exports the spans still queued by a replaced provider
+func shutdown(sdk *sdktrace.TracerProvider) {
+	if err := sdk.Shutdown(context.Background()); err != nil {
+		log.Printf("Failed to export spans: %v\n", err)
+	}
+}
+
+// sameConfig reports whether two configurations export alike
+func sameConfig(a, b models.TracingConfig) bool {
+	return a.Endpoint == b.Endpoint && a.ServiceName == b.ServiceName && a.Timeout == b.Timeout &&
+		strings.Join(a.Headers, ",") == strings.Join(b.Headers, ",")
+}
+
+// Flush exports the queued spans. Functions must flush before they return,
+// since their instance may be frozen right after.
+func Flush(ctx context.Context) error {
+	currentMu.RLock()
+	p := current
+	currentMu.RUnlock()
+	if p == nil {
+		return nil
+	}
+	return p.sdk.ForceFlush(ctx)
+}
+
+// tracesURL returns the traces endpoint of an OTLP/HTTP base endpoint, unless
+// endpoint already names it
+func tracesURL(endpoint string) string {
+	if strings.HasSuffix(endpoint, "/v1/traces") {
+		return endpoint
+	}
+	return strings.TrimSuffix(endpoint, "/") + "/v1/traces"
+}
@@ -0,0 +1,107 @@
+// Package tracing records spans of the sync and exports them to an
+// OpenTelemetry collector over OTLP/HTTP. Spans nest through the context, and
+// outgoing requests carry the W3C traceparent header so the external API can
+// join the trace. Until Configure sets an endpoint every span is a no-op.
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Attribute is a key and value recorded on a span
+type Attribute = attribute.KeyValue
+
+// String returns a string attribute
+func String(key, value string) Attribute {
+	return attribute.String(key, value)
+}
+
+// Int returns an integer attribute
+func Int(key string, value int) Attribute {
+	return attribute.Int(key, value)
+}
+
+// Bool returns a boolean attribute
+func Bool(key string, value bool) Attribute {
+	return attribute.Bool(key, value)
+}
+
+// Span is a timed operation of a trace. A nil span records nothing, so
+// callers never check whether tracing is enabled.
+type Span struct {
+	span trace.Span
+}
+
+// propagator reads and writes the W3C traceparent header
+var propagator = propagation.TraceContext{}
+
+// Start starts a span named name as a child of the span of ctx, or as the
+// root of a new trace, and returns a context carrying it
+func Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, *Span) {
+	tracer := currentTracer()
+	if tracer == nil {
+		return ctx, nil
+	}
+	ctx, span := tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+	return ctx, &Span{span: span}
+}
+
+// FromContext returns the span of ctx, or nil
+func FromContext(ctx context.Context) *Span {
+	span := trace.SpanFromContext(ctx)
+	if !span.SpanContext().IsValid() {
+		return nil
+	}
+	return &Span{span: span}
+}
+
+// SetAttributes records attributes on the span
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.span.SetAttributes(attrs...)
+}
+
+// RecordError marks the span as failed with err; a nil err is ignored
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+// End ends the span and queues it for export. Only the first call counts.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.span.End()
+}
+
+// TraceID returns the hex trace ID of the span, or "" for a nil span
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return s.span.SpanContext().TraceID().String()
+}
+
+// Inject sets the W3C traceparent header for the span of ctx, so the
+// receiving service continues the trace
+func Inject(ctx context.Context, h http.Header) {
+	propagator.Inject(ctx, propagation.HeaderCarrier(h))
+}
+
+// Extract returns ctx carrying the remote parent of a W3C traceparent header,
+// so the spans started from it join the caller's trace. Invalid or missing
+// headers leave ctx alone.
+func Extract(ctx context.Context, h http.Header) context.Context {
+	return propagator.Extract(ctx, propagation.HeaderCarrier(h))
+}
@@ -0,0 +1,100 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-cron/models"
+
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracev1 "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// Test_Disabled tests that spans are no-ops until an endpoint is configured
+func Test_Disabled(t *testing.T) {
+	Configure(models.TracingConfig{})
+	ctx, span := Start(context.Background(), "noop")
+	span.SetAttributes(Int("n", 1))
+	span.RecordError(errors.New("ignored"))
+	span.End()
+	if span != nil || FromContext(ctx) != nil {
+		t.Error("Expected no span without an endpoint")
+	}
+	if err := Flush(ctx); err != nil {
+		t.Errorf("Expected Flush to do nothing, got %v", err)
+	}
+}
+
+// Test_Flush tests that nested spans are exported over OTLP/HTTP with their parent, attributes and status
+func Test_Flush(t *testing.T) {
+	var got collectortrace.ExportTraceServiceRequest
+	var apiKey string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			t.Errorf("Expected the traces path, got %s", r.URL.Path)
+		}
+		apiKey = r.Header.Get("X-Api-Key")
+		body, _ := io.ReadAll(r.Body)
+		if err := proto.Unmarshal(body, &got); err != nil {
+			t.Errorf("Failed to decode export: %v", err)
+		}
+	}))
+	defer server.Close()
+	Configure(models.TracingConfig{Endpoint: server.URL, Headers: []string{"X-Api-Key=secret"}, ServiceName: "go-cron", Timeout: time.Second})
+	defer Configure(models.TracingConfig{})
+
+	ctx, root := Start(context.Background(), "sync.run")
+	_, child := Start(ctx, "db.update_chunk", Int("db.rows", 500))
+	child.RecordError(errors.New("deadlock"))
+	child.End()
+	root.End()
+	if err := Flush(context.Background()); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	if apiKey != "secret" {
+		t.Errorf("Expected the configured header, got %q", apiKey)
+	}
+	if len(got.ResourceSpans) != 1 || got.ResourceSpans[0].Resource.Attributes[0].Value.GetStringValue() != "go-cron" {
+		t.Fatalf("Expected the spans of the go-cron service, got %+v", &got)
+	}
+	spans := got.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(spans))
+	}
+	exported, parent := spans[0], spans[1]
+	if !bytes.Equal(exported.TraceId, parent.TraceId) || !bytes.Equal(exported.ParentSpanId, parent.SpanId) || len(parent.ParentSpanId) != 0 {
+		t.Errorf("Expected the chunk to be a child of the run, got %+v and %+v", exported, parent)
+	}
+	if exported.Status.Code != tracev1.Status_STATUS_CODE_ERROR || exported.Status.Message != "deadlock" {
+		t.Errorf("Expected an error status, got %+v", exported.Status)
+	}
+	if a := exported.Attributes[0]; a.Key != "db.rows" || a.Value.GetIntValue() != 500 {
+		t.Errorf("Expected the row count attribute, got %+v", exported.Attributes)
+	}
+}
+
+// Test_Propagation tests that the traceparent header continues a trace in another service
+func Test_Propagation(t *testing.T) {
+	Configure(models.TracingConfig{Endpoint: "http://collector.invalid", Timeout: time.Second})
+	defer Configure(models.TracingConfig{})
+
+	ctx, span := Start(context.Background(), "sap.page")
+	h := http.Header{}
+	Inject(ctx, h)
+
+	_, remote := Start(Extract(context.Background(), h), "handler")
+	if remote.TraceID() != span.TraceID() || h.Get("traceparent") != "00-"+span.TraceID()+"-"+span.span.SpanContext().SpanID().String()+"-01" {
+		t.Errorf("Expected the remote span to continue the trace, got header %q", h.Get("traceparent"))
+	}
+	if FromContext(Extract(context.Background(), http.Header{"Traceparent": {"garbage"}})) != nil {
+		t.Error("Expected an invalid traceparent to be ignored")
+	}
+}
@@ -0,0 +1,16 @@
+package webhooksig
+
+// RequestContent returns the content signed for a request sent to go-cron
+// when its endpoints use HMAC authentication: the method, the path with its
+// query and the body. Binding the method and path keeps a captured signature
+// from being replayed against another endpoint.
+//
+//	header := webhooksig.Sign(secret, webhooksig.RequestContent("POST", "/api/index", nil), time.Now())
+func RequestContent(method, uri string, body []byte) []byte {
+	content := make([]byte, 0, len(method)+len(uri)+len(body)+2)
+	content = append(content, method...)
+	content = append(content, ' ')
+	content = append(content, uri...)
+	content = append(content, '\n')
+	return append(content, body...)
+}
@@ -0,0 +1,108 @@
+// Package webhooksig signs and verifies the webhooks sent by go-cron.
+//
+// Every webhook carries a Signature header of the form
+//
+//	t=<unix timestamp>,v1=<hex HMAC-SHA256 of "<timestamp>.<body>">
+//
+// Receivers should call VerifySignature with the shared secret, the header
+// value and the raw request body before trusting a payload. The timestamp is
+// part of the signed content, so a captured request cannot be replayed once
+// it is older than the tolerance.
+//
+// Callers of go-cron configured with AUTH_SCHEME=hmac sign their requests the
+// same way, over the RequestContent of the request instead of its body.
+package webhooksig
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Header is the HTTP header carrying the signature
+const Header = "X-GoCron-Signature"
+
+// DefaultTolerance is how far a signature timestamp may be from the receiver's clock
+const DefaultTolerance = 5 * time.Minute
+
+var (
+	// ErrMissingSignature is returned when the header is empty or has no v1 signature
+	ErrMissingSignature = errors.New("webhooksig: missing signature")
+	// ErrInvalidHeader is returned when the header cannot be parsed
+	ErrInvalidHeader = errors.New("webhooksig: invalid signature header")
+	// ErrTimestampOutOfRange is returned when the signature is older or newer than the tolerance allows
+	ErrTimestampOutOfRange = errors.New("webhooksig: timestamp outside tolerance")
+	// ErrSignatureMismatch is returned when no signature matches the body
+	ErrSignatureMismatch = errors.New("webhooksig: signature mismatch")
+)
+
+// Sign returns the header value signing body with secret at time t
+func Sign(secret string, body []byte, t time.Time) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return fmt.Sprintf("t=%s,v1=%s", ts, compute(secret, ts, body))
+}
+
+// VerifySignature checks that header signs body with secret and was produced
+// within DefaultTolerance of now
+func VerifySignature(secret, header string, body []byte) error {
+	return VerifySignatureAt(secret, header, body, time.Now(), DefaultTolerance)
+}
+
+// VerifySignatureAt is VerifySignature with an explicit clock and tolerance.
+// A zero tolerance disables the timestamp check.
+func VerifySignatureAt(secret, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	if header == "" {
+		return ErrMissingSignature
+	}
+
+	var ts string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return ErrInvalidHeader
+		}
+		switch key {
+		case "t":
+			ts = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	if len(signatures) == 0 {
+		return ErrMissingSignature
+	}
+
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ErrInvalidHeader
+	}
+	if tolerance > 0 {
+		if age := now.Sub(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+			return ErrTimestampOutOfRange
+		}
+	}
+
+	// Several v1 signatures may be present while a secret is being rotated
+	expected := []byte(compute(secret, ts, body))
+	for _, sig := range signatures {
+		if hmac.Equal(expected, []byte(sig)) {
+			return nil
+		}
+	}
+	return ErrSignatureMismatch
+}
+
+// compute returns the hex HMAC-SHA256 of "<ts>.<body>"
+func compute(secret, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
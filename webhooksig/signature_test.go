@@ -0,0 +1,43 @@
+package webhooksig
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVerifySignatureAt(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"action":"create"}`)
+	header := Sign("secret", body, now)
+
+	tests := []struct {
+		name    string
+		secret  string
+		header  string
+		body    []byte
+		now     time.Time
+		wantErr error
+	}{
+		{"valid", "secret", header, body, now, nil},
+		{"within tolerance", "secret", header, body, now.Add(4 * time.Minute), nil},
+		{"replayed", "secret", header, body, now.Add(6 * time.Minute), ErrTimestampOutOfRange},
+		{"from the future", "secret", header, body, now.Add(-6 * time.Minute), ErrTimestampOutOfRange},
+		{"wrong secret", "other", header, body, now, ErrSignatureMismatch},
+		{"tampered body", "secret", header, []byte(`{"action":"delete"}`), now, ErrSignatureMismatch},
+		{"rotated secret", "secret", Sign("old", body, now) + "," + header[len("t=1700000000,"):], body, now, nil},
+		{"missing header", "secret", "", body, now, ErrMissingSignature},
+		{"no v1", "secret", "t=1700000000", body, now, ErrMissingSignature},
+		{"bad timestamp", "secret", "t=abc,v1=00", body, now, ErrInvalidHeader},
+		{"malformed", "secret", "garbage", body, now, ErrInvalidHeader},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifySignatureAt(tt.secret, tt.header, tt.body, tt.now, DefaultTolerance)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("VerifySignatureAt() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}